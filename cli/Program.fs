@@ -1,23 +1,94 @@
 ﻿// Gazelle: a cross-platform engine for structural analysis & design.
 open System
+open System.Globalization
 open System.IO
 open System.Text.Json
+open System.Text.Json.Nodes
 open System.Text.Json.Serialization
 open Spectre.Console
+open Gazelle
+open Gazelle.Model
+open Gazelle.Analysis
 
 // Types
 type CliOptions =
   { Command: string
     InputFile: string option
+    /// Input files after the first, e.g. the tables of gz import.
+    MoreInputs: string list
+    InputFormat: string option
+    Settings: string list
     OutputFile: string option
     Format: string
     Verbose: bool
     Detailed: bool
+    Strict: bool
+    Cases: string list option
+    Combinations: string list option
+    Save: string list option
+    InitialState: string option
+    Solver: string option
+    AnalysisType: string
+    Integrator: string option
+    TransientMethod: string option
+    ModeCount: int
+    Stations: int
+    MassMatrix: string option
+    Spectrum: string option
+    Direction: string
+    Combination: string option
+    Iterations: int
+    Convergence: float
+    MinStep: float
+    MaxStep: float
+    Scheme: string option
+    LineSearch: bool
+    ReactionSign: string option
+    ModelFile: string option
+    TargetFile: string option
+    Pairs: string list
+    Tolerance: float
+    Ledger: string option
+    Prefixes: string list
+    TargetUnits: string option
+    Planes: string list
+    Imperfections: string list
+    Vehicle: string option
+    Path: string list
+    Step: float
+    Scale: float option
+    Case: string option
+    Temperatures: string option
+    Reference: float
+    Measured: string option
+    Tune: string list
+    /// Targets of gz optimize.
+    MaxUtilisation: float
+    MinFrequency: float option
+    MaxDeflection: float option
+    Vary: string option
+    Against: string option
+    Libraries: string list
+    Columns: string list
+    Fire: string option
     Template: string option
     Parameters: string option
     OutputDir: string option
     Progress: bool
     Workers: int
+    Block: string
+    Record: int
+    Limit: int option
+    Offset: int
+    Filters: string list
+    Nodes: string list
+    DampingRatio: float
+    ResultsFile: string option
+    Port: int
+    Update: bool
+    Batch: bool
+    /// Export assembled matrices rather than the model.
+    Matrices: bool
     Help: bool }
 
 type ModelInfo =
@@ -27,14 +98,183 @@ type ModelInfo =
     ElementCount: int
     LoadCases: int }
 
+type LoadSetResult =
+  { Name: string
+    Kind: string
+    LoadCount: int
+    Applied: Map<string, float>
+    /// Second-order over first-order displacement, if analysed for P-Delta.
+    Amplification: float option
+    /// Load increments of a second-order analysis.
+    Steps: int option
+    /// Out-of-balance force over the applied force, see Equilibrium.
+    Residual: float
+    /// Whether the reactions balance the loads within tolerance.
+    Converged: bool }
+
+/// One natural mode, with its shape by node and degree of freedom.
+type ModeResult =
+  { Number: int
+    Frequency: float
+    Period: float
+    Shape: Map<string, Map<string, float>> }
+
+/// End forces of one member under one load set, in member axes.
+type MemberForceResult =
+  { Element: string
+    LoadSet: string
+    Forces: float[] }
+
+/// Internal forces of one member under one load set, at stations along it.
+type InternalForceResult =
+  { Element: string
+    LoadSet: string
+    Stations: Station[] }
+
+/// Stresses in one member or plate under one load set.
+type StressResult =
+  { Element: string
+    LoadSet: string
+    Axial: float option
+    Bending: float option
+    VonMises: float option
+    Stress: float
+    /// Stress over the yield strength of the material, if it has one.
+    Ratio: float option }
+
+/// Work done by one load set and the strain energy it stores.
+type EnergyResult =
+  { LoadSet: string
+    ExternalWork: float
+    StrainEnergy: float
+    /// Strain energy of elastic supports and rigid links.
+    Supports: float
+    /// External work less strain energy over the external work.
+    Imbalance: float
+    /// Strain energy of each element, by ID.
+    Elements: Map<string, float> }
+
+/// Reaction of one support under one load set.
+type ReactionResult =
+  { LoadSet: string
+    Node: string
+    /// Reaction by restrained degree of freedom, in global axes.
+    Global: Map<string, float>
+    /// Reaction in the axes of an inclined support.
+    Local: Map<string, float> option
+    /// Inclination of an inclined support in degrees.
+    Angle: float option }
+
 type AnalysisResult =
-  { ModelName: string
+  {
+    /// Layout version of the results, see ResultFormat.
+    FormatVersion: int
+    ModelName: string
+    /// Unit system of the model, see ResultUnits.
+    Units: string
     Status: string
     MaxDisplacement: float option
     MaxStress: float option
+    MaxUtilisation: float option
+    InitialState: string option
+    Saved: string[]
+    LoadSets: LoadSetResult[]
+    Modes: ModeResult[]
+    /// Sign convention of the reactions, in words.
+    ReactionConvention: string option
+    Reactions: ReactionResult[]
+    MemberForces: MemberForceResult[]
+    InternalForces: InternalForceResult[]
+    Stresses: StressResult[]
+    Energies: EnergyResult[]
     Warnings: string[]
+    Errors: string[]
+    /// Engine, solver, model and machine that produced the results.
+    Provenance: Provenance option
+  }
+
+/// State of a model at one step of a time-history analysis.
+type TimeStepResult =
+  { Units: string
+    Time: float
+    Displacements: Map<string, Map<string, float>>
+    Velocities: Map<string, Map<string, float>>
+    Accelerations: Map<string, Map<string, float>>
+    KineticEnergy: float
+    StrainEnergy: float
+    /// Energy dissipated by damping since time zero.
+    DampingEnergy: float
+    /// Work done by the loads since time zero.
+    ExternalWork: float }
+
+type DynamicSummary =
+  { ModelName: string
+    Method: string
+    Integrator: string
+    Steps: int
+    TimeStep: float
+    PeakDisplacement: float
+    PeakNode: string option
+    PeakTime: float
+    /// Largest energy imbalance over the largest external work.
+    EnergyImbalance: float }
+
+/// Peak response of one mode to a response spectrum.
+type SpectralModeResult =
+  { Number: int
+    Period: float
+    Acceleration: float
+    Participation: float
+    MassRatio: float }
+
+type SpectrumSummary =
+  { ModelName: string
+    Combination: string
+    Direction: string
+    Modes: SpectralModeResult[]
+    MassParticipation: float
+    BaseShear: float
+    MaxDisplacement: float
+    Displacements: Map<string, Map<string, float>> }
+
+/// One line of batch output, flat so it can also be written as CSV.
+type BatchResult =
+  { File: string
+    Status: string
+    ModelName: string option
+    Units: string option
+    MaxDisplacement: float option
+    MaxStress: float option
     Errors: string[] }
 
+/// One node or element of a results listing.
+type ResultRow =
+  { Id: string
+    Components: Map<string, float> }
+
+type ResultListing =
+  { Block: string
+    Record: int
+    Matched: int
+    Offset: int
+    Rows: ResultRow[] }
+
+/// Spectral acceleration of an oscillator of one natural period.
+type SpectrumPoint = { Period: float; Acceleration: float }
+
+/// Frequency content of the acceleration history of one node.
+type FrequencyReport =
+  { Node: string
+    Direction: string
+    Steps: int
+    TimeStep: float
+    PeakAcceleration: float
+    /// Frequency in Hz of the largest Fourier amplitude.
+    DominantFrequency: float option
+    DampingRatio: float
+    Fourier: FourierComponent[]
+    Spectrum: SpectrumPoint[] }
+
 type ValidationResult =
   { IsValid: bool
     Errors: string[]
@@ -51,12 +291,224 @@ type Template =
     Description: string
     Parameters: string[] }
 
+/// Outcome of one gz doctor check: "ok", "warn" or "fail".
+type HealthCheck =
+  { Name: string
+    Status: string
+    Detail: string }
+
+type HealthReport =
+  { Version: string
+    Healthy: bool
+    Checks: HealthCheck[] }
+
+/// Benchmark checks of gz verify, passing within Tolerance percent.
+type VerificationReport =
+  { Passed: bool
+    Tolerance: float
+    Checks: BenchmarkCheck[] }
+
+/// Analysis options of a gz snapshot, so gz snapshot verify can re-run it.
+type SnapshotOptions =
+  { Cases: string list option
+    Combinations: string list option
+    Save: string list option
+    /// Whether the analysis started from an initial state, bundled with it.
+    InitialState: bool
+    Solver: string option
+    AnalysisType: string
+    ModeCount: int
+    Stations: int
+    MassMatrix: string option
+    Iterations: int
+    Convergence: float
+    MinStep: float
+    MaxStep: float
+    Scheme: string option
+    LineSearch: bool
+    ReactionSign: string option
+    Imperfections: string list }
+
+/// Outcome of re-running a snapshot with gz snapshot verify.
+type SnapshotReport =
+  { Reproduced: bool
+    ModelName: string
+    ModelHash: string
+    /// Engine version that made the snapshot, and the one re-running it.
+    RecordedVersion: string
+    Version: string
+    Differences: SnapshotDifference[] }
+
+/// Outcome of checking one expected results file with gz test.
+/// Governing check of one member across the results files checked.
+type MemberCheckResult =
+  { Element: string
+    Utilisation: float
+    Strength: float option
+    Buckling: float option
+    File: string
+    LoadSet: string }
+
+/// Governing punching check of one slab support across the results files
+/// checked.
+type PunchingCheckResult =
+  { Node: string
+    Utilisation: float
+    Force: float
+    Stress: float
+    Resistance: float
+    File: string
+    LoadSet: string }
+
+/// Governing fire check of one steel member across the results files
+/// checked.
+type FireCheckResult =
+  { Element: string
+    Utilisation: float
+    Temperature: float
+    CriticalTemperature: float option
+    File: string
+    LoadSet: string }
+
+type CheckReport =
+  { ModelName: string
+    Files: string[]
+    Members: MemberCheckResult[]
+    Punching: PunchingCheckResult[]
+    Exposure: string option
+    Fire: FireCheckResult[]
+    Warnings: string[]
+    Errors: string[] }
+
+/// Elements ranked by strain energy density with gz rank.
+type EnergyRankReport =
+  { ModelName: string
+    File: string
+    /// Governing density of each element, densest first.
+    Elements: EnergyDensity[]
+    Warnings: string[] }
+
+/// Measurement beside the prediction of it with gz calibrate.
+type CalibrationRow =
+  { Quantity: string
+    Set: string option
+    Node: string option
+    Dof: string option
+    Mode: int option
+    Measured: float
+    Predicted: float
+    /// Relative error of the prediction.
+    Error: float
+    /// Prediction and its relative error with the tuned parameters.
+    Tuned: float option
+    TunedError: float option }
+
+type CalibratedParameter =
+  { Name: string
+    Initial: float
+    Tuned: float }
+
+/// Comparison of a model with measurements with gz calibrate.
+type CalibrationReport =
+  { ModelName: string
+    File: string
+    Measurements: CalibrationRow[]
+    /// Root mean square of the relative errors, before and after tuning.
+    Rms: float
+    TunedRms: float option
+    Parameters: CalibratedParameter[]
+    Iterations: int option
+    Converged: bool option }
+
+/// Members resized by gz optimize and the response they were sized on.
+type SizingReport =
+  { ModelName: string
+    /// Targets sized to.
+    MaxUtilisation: float
+    MinFrequency: float option
+    MaxDeflection: float option
+    Members: SizedMember[]
+    Utilisation: float
+    Frequency: float option
+    Deflection: float
+    InitialMass: float option
+    Mass: float option
+    Iterations: int
+    /// Resized model written with --output.
+    Output: string option }
+
+/// Natural frequency of a mode tracked through gz sweep, by step.
+type SweepMode =
+  { Number: int
+    /// Frequency in Hz at each value, or null where the mode is not found.
+    Frequencies: Nullable<float>[]
+    /// MAC to the mode's shape at the step it was last found.
+    Mac: Nullable<float>[] }
+
+/// Natural frequencies of a model over the values of a parameter.
+type SweepReport =
+  { ModelName: string
+    Parameter: string
+    Values: float[]
+    Modes: SweepMode[] }
+
+/// Mode of one of the sets of shapes compared by gz mac.
+type MacMode =
+  { Number: int
+    /// Frequency in Hz, or null if the shapes give none.
+    Frequency: Nullable<float> }
+
+/// Mode of the second set whose shape best matches one of the first.
+type MacPair =
+  { Mode: int
+    Match: int
+    Mac: float
+    /// (Second - First) / First frequency, if both are known.
+    FrequencyError: Nullable<float> }
+
+/// MAC matrix of two sets of mode shapes with gz mac.
+type MacReport =
+  { First: string
+    Second: string
+    FirstModes: MacMode[]
+    SecondModes: MacMode[]
+    /// MAC of each mode of the first set (rows) with each of the second.
+    Mac: float[][]
+    Pairs: MacPair[] }
+
+/// Natural mode of a model and of its reduction with gz reduce.
+type ReducedMode =
+  { Number: int
+    /// Frequency of the full model in Hz.
+    Frequency: float
+    /// Frequency of the reduced model in Hz.
+    Reduced: float
+    /// MAC of the expanded reduced shape with the full shape.
+    Mac: float }
+
+/// Matrices of a model reduced to master freedoms with gz reduce.
+type ReductionReport =
+  { ModelName: string
+    Method: string
+    /// Master freedoms, as node:dof, in the order of the matrices.
+    Masters: string[]
+    Stiffness: float[][]
+    Mass: float[][]
+    Modes: ReducedMode[] }
+
+type GoldenTestResult =
+  { File: string
+    Passed: bool
+    Mismatches: string[]
+    Error: string option }
+
 // JSON serialization helpers
 let private jsonOptions =
   let options = JsonSerializerOptions()
   options.PropertyNamingPolicy <- JsonNamingPolicy.CamelCase
   options.WriteIndented <- true
   options.DefaultIgnoreCondition <- JsonIgnoreCondition.WhenWritingNull
+  options.NumberHandling <- JsonNumberHandling.AllowNamedFloatingPointLiterals
   options
 
 let serialize<'T> (value: 'T) : string =
@@ -66,19 +518,98 @@ let serializeToFile<'T> (filePath: string) (value: 'T) =
   let json = serialize value
   File.WriteAllText(filePath, json)
 
+/// Writes a value as the Protocol Buffers encoding of its JSON, which
+/// readResults reads back.
+let serializeToBinary<'T> (filePath: string) (value: 'T) =
+  let node = JsonSerializer.SerializeToNode(value, jsonOptions)
+  File.WriteAllBytes(filePath, Protobuf.writeRecord node)
+
+/// Reads a results file as JSON or, if it ends .pb, as Protocol Buffers,
+/// raising JsonException if it is malformed.
+let readResults (path: string) : JsonNode =
+  if Path.GetExtension(path).ToLowerInvariant() = ".pb" then
+    match Protobuf.readRecord (File.ReadAllBytes path) with
+    | Ok node -> node
+    | Error reason -> raise (JsonException reason)
+  else
+    JsonNode.Parse(File.ReadAllText path)
+
 // Default options
 let defaultOptions =
   { Command = ""
     InputFile = None
+    MoreInputs = []
+    InputFormat = None
+    Settings = []
     OutputFile = None
     Format = "text"
     Verbose = false
     Detailed = false
+    Strict = false
+    Cases = None
+    Combinations = None
+    Save = None
+    InitialState = None
+    Solver = None
+    AnalysisType = "static"
+    Integrator = None
+    TransientMethod = None
+    ModeCount = 10
+    Stations = 11
+    MassMatrix = None
+    Spectrum = None
+    Direction = "X"
+    Combination = None
+    Iterations = SecondOrder.defaults.MaxIterations
+    Convergence = SecondOrder.defaults.Tolerance
+    MinStep = SecondOrder.defaults.MinStep
+    MaxStep = SecondOrder.defaults.MaxStep
+    Scheme = None
+    LineSearch = false
+    ReactionSign = None
+    ModelFile = None
+    TargetFile = None
+    Pairs = []
+    Tolerance = 1e-3
+    Ledger = None
+    Prefixes = []
+    TargetUnits = None
+    Planes = []
+    Imperfections = []
+    Vehicle = None
+    Path = []
+    Step = 1.0
+    Scale = None
+    Case = None
+    Temperatures = None
+    Reference = 0.0
+    Measured = None
+    Tune = []
+    MaxUtilisation = 1.0
+    MinFrequency = None
+    MaxDeflection = None
+    Vary = None
+    Against = None
+    Libraries = []
+    Columns = []
+    Fire = None
     Template = None
     Parameters = None
     OutputDir = None
     Progress = false
     Workers = Environment.ProcessorCount
+    Block = "displacements"
+    Record = 0
+    Limit = None
+    Offset = 0
+    Filters = []
+    Nodes = []
+    DampingRatio = 0.05
+    ResultsFile = None
+    Port = 8080
+    Update = false
+    Batch = false
+    Matrices = false
     Help = false }
 
 // Available templates
@@ -88,10 +619,13 @@ let templates =
       Parameters = [| "span"; "load" |] }
     { Name = "truss"
       Description = "Truss structure"
-      Parameters = [| "width"; "height"; "loads" |] }
+      Parameters = [| "width"; "height"; "load" |] }
     { Name = "frame"
       Description = "Portal frame structure"
-      Parameters = [| "width"; "height"; "loads" |] } ]
+      Parameters = [| "width"; "height"; "load" |] }
+    { Name = "cable-stayed"
+      Description = "Single-pylon bridge with pretensioned stays"
+      Parameters = [| "span"; "height"; "cables"; "pretension"; "load" |] } ]
 
 let showHelp () =
   AnsiConsole.WriteLine()
@@ -130,7 +664,157 @@ let showHelp () =
 
   grid.AddRow(
     "  [green]validate[/] [cyan]<model>[/]",
-    "Validate model structure"
+    "Validate model structure (--strict fails on warnings)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]renumber[/] [cyan]<model>[/]",
+    "Renumber entities to sequential IDs (--prefix nodes=n,elements=e)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]convert-units[/] [cyan]<model>[/] [grey]--to[/] [cyan]<units>[/]",
+    "Convert model between unit systems, e.g. kip-in to SI"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]import[/] [cyan]<model.std|tables.csv...|model.xlsx>[/]",
+    "Convert a STAAD.Pro input file, CSV tables or an Excel workbook"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]edit add-symmetry[/] [cyan]<model>[/]",
+    "Halve a symmetric model on --plane YZ (repeat --plane to quarter)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]edit add-imperfections[/] [cyan]<model>[/]",
+    "Perturb geometry with EC3 sway and bow, e.g. --imperfection sway:X"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]edit add-patterns[/] [cyan]<model>[/]",
+    "Add pattern (skip) cases of --cases LL over continuous beam spans"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]edit add-vehicle[/] [cyan]<model>[/]",
+    "Add a case per position of --vehicle crossing --path, e.g. hs20"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]edit add-panel-loads[/] [cyan]<model>[/]",
+    "Distribute slab panel loads to their beams by tributary area"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]edit add-temperatures[/] [cyan]<model>[/]",
+    "Add a thermal case from a --temperatures CSV of node/element values"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]transfer[/] [cyan]<source> <target>[/]",
+    "Apply support reactions of one model as loads on another"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]track[/] [cyan][[model]][/]",
+    "Record run metrics in the project ledger and print their trend"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]run[/] [cyan]<script.star>[/]",
+    "Run a Starlark script against the scripting API, e.g. with --model"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]test[/] [cyan]<path>[/]",
+    "Check models against expected results; --update records them"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]check[/] [cyan]<results>[/]",
+    "Check members and slab punching of --model; --batch for many"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]rank[/] [cyan]<results>[/]",
+    "Rank elements of --model by strain energy density for redesign"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]calibrate[/] [cyan]<model>[/]",
+    "Compare with --measured data; --tune fits model parameters to it"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]optimize[/] [cyan]<model>[/]",
+    "Size members to --max-utilisation, --min-frequency and --max-deflection"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]sweep[/] [cyan]<model>[/]",
+    "Track natural frequencies over a parameter, e.g. --vary span=6:9:0.5"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]mac[/] [cyan]<model>[/]",
+    "MAC matrix of the modes with those of --against, a model or test CSV"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]reduce[/] [cyan]<model>[/]",
+    "Guyan or IRS (--type irs) matrices at masters, e.g. --node n3:Uy"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]verify[/]",
+    "Compare the solver with closed-form benchmark problems"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]doctor[/]",
+    "Check the environment and run a self-test, e.g. for bug reports"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]snapshot[/] [cyan]<model>[/]",
+    "Bundle a model, its results and environment into one archive"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]snapshot verify[/] [cyan]<archive>[/]",
+    "Re-run a snapshot and confirm its results are reproduced"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]export[/] [cyan]<model>[/]",
+    "Export a glTF scene, OpenSees, Abaqus or Excel files, or --matrices"
   )
   |> ignore
 
@@ -145,6 +829,30 @@ let showHelp () =
   )
   |> ignore
 
+  grid.AddRow(
+    "  [green]results[/] [cyan]<file>[/]",
+    "List nodal or element results from a .jsonl results file"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]spectra[/] [cyan]<file>[/]",
+    "Fourier and response spectra of accelerations in a time history"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]view[/] [cyan]<model> [[results]][/]",
+    "Open an interactive 3D viewer in the browser"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [green]lsp[/]",
+    "Serve diagnostics, hover and analysis to editors over stdio"
+  )
+  |> ignore
+
   grid.AddEmptyRow() |> ignore
   grid.AddRow("[yellow]ETABS INTEGRATION:[/]", "") |> ignore
 
@@ -163,373 +871,5250 @@ let showHelp () =
   )
   |> ignore
 
+  grid.AddRow("  [green]version[/]", "Show version and build metadata")
+  |> ignore
+
   grid.AddRow("  [green]help[/]", "Show this help") |> ignore
   grid.AddEmptyRow() |> ignore
 
   grid.AddRow("[yellow]GLOBAL OPTIONS:[/]", "") |> ignore
 
   grid.AddRow(
-    "  [grey]--format[/] [cyan]<json|text>[/]",
-    "Output format (default: text)"
+    "  [grey]--format[/] [cyan]<json|text|pb>[/]",
+    "Output format (default: text; pb writes binary to --output)"
   )
   |> ignore
 
   grid.AddRow("  [grey]--output[/] [cyan]<file>[/]", "Output file path")
   |> ignore
 
-  grid.AddRow("  [grey]--verbose[/]", "Enable verbose output") |> ignore
+  grid.AddRow(
+    "  [grey]--input-format[/] [cyan]<json|yaml|ifc|std|inp|pb>[/]",
+    "Force model parser (default: by extension; '-' reads stdin)"
+  )
+  |> ignore
 
-  grid.AddRow("  [grey]--quiet[/]", "Suppress all output except errors")
+  grid.AddRow(
+    "  [grey]--set[/] [cyan]<key=value>[/]",
+    "Override a declared model parameter (repeatable)"
+  )
   |> ignore
 
-  grid.AddEmptyRow() |> ignore
+  grid.AddRow(
+    "  [grey]--cases[/] [cyan]<a,b,...>[/]",
+    "Load cases to analyze (default: all)"
+  )
+  |> ignore
 
-  grid.AddRow("[yellow]EXAMPLES:[/]", "") |> ignore
-  grid.AddRow("  [dim]gz info model.json --format json[/]", "") |> ignore
+  grid.AddRow(
+    "  [grey]--combinations[/] [cyan]<a,b,...>[/]",
+    "Load combinations to analyze (default: all)"
+  )
+  |> ignore
 
   grid.AddRow(
-    "  [dim]gz analyze beam.json --output results.json --detailed[/]",
-    ""
+    "  [grey]--save[/] [cyan]<a,b,...>[/]",
+    "Result blocks to store (default: all): displacements, reactions, "
+    + "member-forces, internal-forces, stresses, modes"
   )
   |> ignore
 
-  grid.AddRow("  [dim]gz create --template truss --output model.json[/]", "")
+  grid.AddRow(
+    "  [grey]--initial-state[/] [cyan]<file>[/]",
+    "Start iterative solves from the displacements in a results file"
+  )
   |> ignore
 
-  grid.AddRow("  [dim]gz etabs demo --verbose[/]", "") |> ignore
+  grid.AddRow(
+    "  [grey]--solver[/] [cyan]<name>[/]",
+    "Linear solver: skyline (default), skyline:rcm, skyline:natural, "
+    + "dense, pcg or pcg:jacobi"
+  )
+  |> ignore
 
-  AnsiConsole.Write(grid)
-  AnsiConsole.WriteLine()
+  grid.AddRow(
+    "  [grey]--type[/] [cyan]<kind>[/]",
+    "Analysis type: static (default), second-order, dynamic or spectrum"
+  )
+  |> ignore
 
-// Argument parsing
-let rec parseArgs args options =
-  match args with
-  | [] -> options
-  | "--help" :: _
-  | "help" :: _ -> { options with Help = true }
-  | "--format" :: format :: tail ->
-    parseArgs tail { options with Format = format }
-  | "--output" :: file :: tail ->
-    parseArgs tail { options with OutputFile = Some file }
-  | "--verbose" :: tail -> parseArgs tail { options with Verbose = true }
-  | "--detailed" :: tail -> parseArgs tail { options with Detailed = true }
-  | "--template" :: template :: tail ->
-    parseArgs
-      tail
-      { options with
-          Template = Some template }
-  | "--params" :: paramsFile :: tail ->
-    parseArgs
-      tail
-      { options with
-          Parameters = Some paramsFile }
-  | "--output-dir" :: dir :: tail ->
-    parseArgs tail { options with OutputDir = Some dir }
-  | "--progress" :: tail -> parseArgs tail { options with Progress = true }
-  | "--workers" :: workers :: tail ->
-    match Int32.TryParse workers with
-    | (true, n) -> parseArgs tail { options with Workers = n }
-    | (false, _) -> parseArgs tail options
-  | cmd :: tail when not (cmd.StartsWith "--") && options.Command = "" ->
-    // Handle ETABS subcommands
-    if cmd = "etabs" then
-      match tail with
-      | subCmd :: restTail ->
-        parseArgs
-          restTail
-          { options with
-              Command = $"etabs-{subCmd}" }
-      | [] -> parseArgs tail { options with Command = "etabs-help" }
-    // For commands that don't take a file argument (like 'create'), just set command
-    elif cmd = "create" || cmd = "templates" then
-      parseArgs tail { options with Command = cmd }
-    else
-      // For commands that take a file, expect next argument to be file
-      match tail with
-      | file :: restTail when not (file.StartsWith "--") ->
-        parseArgs
-          restTail
+  grid.AddRow(
+    "  [grey]--plane[/] [cyan]<YZ|XZ|XY>[/]",
+    "Analyse half a symmetric model, mirroring results (repeatable)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--iterations[/] [cyan]<count>[/]",
+    "Second-order iteration limit (default: 20)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--convergence[/] [cyan]<ratio>[/]",
+    "Second-order displacement tolerance (default: 1e-6)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--max-step[/] [cyan]<fraction>[/]",
+    "Largest second-order load increment (default: 1, the whole load)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--min-step[/] [cyan]<fraction>[/]",
+    "Smallest increment a diverging step is cut to (default: 0.01)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--scheme[/] [cyan]<newton|bfgs>[/]",
+    "Second-order iteration: Newton-Raphson (default) or BFGS updates"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--line-search[/]",
+    "Scale each second-order correction by a line search"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--scale[/] [cyan]<factor>[/]",
+    "Magnify exported displacements, adding a deformed shape per load set"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--imperfection[/] [cyan]<pattern>[/]",
+    "Imperfect geometry, e.g. sway:X:4, bow:X:c or buckling mode1:L/250"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--vehicle[/] [cyan]<id[[:name=value,...]]>[/]",
+    "Vehicle, e.g. hs20:spacing=9, lm1, crane:wheel=150e3"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--path[/] [cyan]<e1,e2,...>[/]",
+    "Members a vehicle travels along, in order"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--step[/] [cyan]<length>[/]",
+    "Distance between vehicle positions (default: 1)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--vehicles[/] [cyan]<file>[/]",
+    "Library of further vehicles, overriding standard ones (repeatable)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--integrator[/] [cyan]<scheme>[/]",
+    "Time integrator: newmark (default), hht-alpha, generalized-alpha, ..."
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--method[/] [cyan]<method>[/]",
+    "Time-history method: direct (default), or modal:N over N modes"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--spectrum[/] [cyan]<file>[/]",
+    "Response spectrum of period against acceleration, e.g. CSV"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--direction[/] [cyan]<axis>[/]",
+    "Direction of spectral excitation: X (default), Y or Z"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--node[/] [cyan]<id>[/]",
+    "Node whose time history spectra reports (repeatable; default: all)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--damping[/] [cyan]<ratio>[/]",
+    "Damping ratio of response spectrum oscillators (default: 0.05)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--to[/] [cyan]<units>[/]",
+    "Unit system to read results in, e.g. kip-in, for results and spectra"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--combine[/] [cyan]<rule>[/]",
+    "Modal combination: cqc (default) or srss"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--reaction-sign[/] [cyan]<convention>[/]",
+    "Reactions as forces on the structure (default) or on the support"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--modes[/] [cyan]<count>[/]",
+    "Natural modes to compute when saving modes (default: 10)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--stations[/] [cyan]<count>[/]",
+    "Stations along each member for internal forces (default: 11)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--mass[/] [cyan]<kind>[/]",
+    "Mass matrix for modes: consistent (default) or lumped"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--max-utilisation[/] [cyan]<ratio>[/]",
+    "Greatest member utilisation for optimize (default: 1)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--min-frequency[/] [cyan]<hz>[/]",
+    "Least fundamental frequency for optimize, e.g. 3 for a footbridge"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--max-deflection[/] [cyan]<distance>[/]",
+    "Greatest nodal translation under any load set for optimize"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--map[/] [cyan]<source=target>[/]",
+    "Pair a support node with a target node for transfer (repeatable)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--tolerance[/] [cyan]<distance>[/]",
+    "Greatest distance between nodes matched by position (default: 0.001)"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--ledger[/] [cyan]<file>[/]",
+    "Ledger for track (default: gazelle-ledger.jsonl)"
+  )
+  |> ignore
+
+  grid.AddRow("  [grey]--verbose[/]", "Enable verbose output") |> ignore
+
+  grid.AddRow("  [grey]--strict[/]", "Treat validation warnings as failures")
+  |> ignore
+
+  grid.AddRow("  [grey]--batch[/]", "Read a pattern of results files for check")
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--column[/] [cyan]<[[node=]]c1xc2>[/]",
+    "Column size for punching checks, e.g. 0.4x0.4 or n5=0.3x0.6"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--fire[/] [cyan]<exposure>[/]",
+    "Check steel members in fire: R60 minutes or a 550C steel temperature"
+  )
+  |> ignore
+
+  grid.AddRow(
+    "  [grey]--workers[/] [cyan]<count>[/]",
+    "Files processed in parallel (default: processor count)"
+  )
+  |> ignore
+
+  grid.AddRow("  [grey]--quiet[/]", "Suppress all output except errors")
+  |> ignore
+
+  grid.AddRow("  [grey]--version[/]", "Show version and build metadata")
+  |> ignore
+
+  grid.AddEmptyRow() |> ignore
+
+  grid.AddRow("[yellow]EXAMPLES:[/]", "") |> ignore
+  grid.AddRow("  [dim]gz info model.json --format json[/]", "") |> ignore
+
+  grid.AddRow(
+    "  [dim]gz analyze beam.json --output results.json --detailed[/]",
+    ""
+  )
+  |> ignore
+
+  grid.AddRow("  [dim]gz create --template truss --output model.json[/]", "")
+  |> ignore
+
+  grid.AddRow("  [dim]gz analyze frame.json --set span=7.5 --set bays=3[/]", "")
+  |> ignore
+
+  grid.AddRow(
+    "  [dim]gz analyze frame.json --cases DL,LL --combinations ULS1[/]",
+    ""
+  )
+  |> ignore
+
+  grid.AddRow("  [dim]gz etabs demo --verbose[/]", "") |> ignore
+
+  AnsiConsole.Write(grid)
+  AnsiConsole.WriteLine()
+
+/// Splits a comma-separated list argument, e.g. --cases DL,LL.
+let private splitList (value: string) : string list =
+  value.Split(',', StringSplitOptions.RemoveEmptyEntries)
+  |> Array.map (fun s -> s.Trim())
+  |> Array.filter (fun s -> s <> "")
+  |> Array.toList
+
+// Argument parsing
+let rec parseArgs args options =
+  match args with
+  | [] -> options
+  | "--help" :: _
+  | "help" :: _ -> { options with Help = true }
+  | "--version" :: tail -> parseArgs tail { options with Command = "version" }
+  | "--format" :: format :: tail ->
+    parseArgs tail { options with Format = format }
+  | "--input-format" :: format :: tail ->
+    parseArgs
+      tail
+      { options with
+          InputFormat = Some format }
+  | "--set" :: setting :: tail ->
+    parseArgs
+      tail
+      { options with
+          Settings = options.Settings @ [ setting ] }
+  | "--output" :: file :: tail ->
+    parseArgs tail { options with OutputFile = Some file }
+  | "--verbose" :: tail -> parseArgs tail { options with Verbose = true }
+  | "--detailed" :: tail -> parseArgs tail { options with Detailed = true }
+  | "--strict" :: tail -> parseArgs tail { options with Strict = true }
+  | "--line-search" :: tail -> parseArgs tail { options with LineSearch = true }
+  | "--scheme" :: scheme :: tail ->
+    parseArgs tail { options with Scheme = Some scheme }
+  | "--cases" :: cases :: tail ->
+    parseArgs
+      tail
+      { options with
+          Cases = Some(splitList cases) }
+  | "--combinations" :: combinations :: tail ->
+    parseArgs
+      tail
+      { options with
+          Combinations = Some(splitList combinations) }
+  | "--save" :: blocks :: tail ->
+    parseArgs tail { options with Save = Some(splitList blocks) }
+  | "--initial-state" :: file :: tail ->
+    parseArgs tail { options with InitialState = Some file }
+  | "--solver" :: solver :: tail ->
+    parseArgs tail { options with Solver = Some solver }
+  | "--type" :: kind :: tail ->
+    parseArgs tail { options with AnalysisType = kind.ToLowerInvariant() }
+  | "--integrator" :: name :: tail ->
+    parseArgs tail { options with Integrator = Some name }
+  | "--method" :: name :: tail ->
+    parseArgs tail { options with TransientMethod = Some name }
+  | "--modes" :: count :: tail ->
+    match Int32.TryParse count with
+    | (true, n) when n > 0 -> parseArgs tail { options with ModeCount = n }
+    | _ -> parseArgs tail options
+  | "--stations" :: count :: tail ->
+    match Int32.TryParse count with
+    | (true, n) when n >= 2 -> parseArgs tail { options with Stations = n }
+    | _ -> parseArgs tail options
+  | "--mass" :: kind :: tail ->
+    parseArgs tail { options with MassMatrix = Some kind }
+  | "--spectrum" :: file :: tail ->
+    parseArgs tail { options with Spectrum = Some file }
+  | "--direction" :: direction :: tail ->
+    parseArgs tail { options with Direction = direction }
+  | "--combine" :: rule :: tail ->
+    parseArgs tail { options with Combination = Some rule }
+  | "--iterations" :: count :: tail ->
+    match Int32.TryParse count with
+    | (true, n) when n > 0 -> parseArgs tail { options with Iterations = n }
+    | _ -> parseArgs tail options
+  | "--column" :: column :: tail ->
+    parseArgs tail { options with Columns = options.Columns @ [ column ] }
+  | "--fire" :: fire :: tail ->
+    parseArgs tail { options with Fire = Some fire }
+  | "--model" :: file :: tail ->
+    parseArgs tail { options with ModelFile = Some file }
+  | "--reaction-sign" :: convention :: tail ->
+    parseArgs tail { options with ReactionSign = Some convention }
+  | "--convergence" :: ratio :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(ratio, styles, culture) with
+    | (true, x) when x > 0.0 -> parseArgs tail { options with Convergence = x }
+    | _ -> parseArgs tail options
+  | "--min-step" :: fraction :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(fraction, styles, culture) with
+    | (true, x) when x > 0.0 && x <= 1.0 ->
+      parseArgs tail { options with MinStep = x }
+    | _ -> parseArgs tail options
+  | "--max-step" :: fraction :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(fraction, styles, culture) with
+    | (true, x) when x > 0.0 && x <= 1.0 ->
+      parseArgs tail { options with MaxStep = x }
+    | _ -> parseArgs tail options
+  | "--ledger" :: ledger :: tail ->
+    parseArgs tail { options with Ledger = Some ledger }
+  | "--map" :: pair :: tail ->
+    parseArgs tail { options with Pairs = options.Pairs @ [ pair ] }
+  | "--tolerance" :: tolerance :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(tolerance, styles, culture) with
+    | (true, x) when x >= 0.0 -> parseArgs tail { options with Tolerance = x }
+    | _ -> parseArgs tail options
+  | "--to" :: units :: tail ->
+    parseArgs tail { options with TargetUnits = Some units }
+  | "--prefix" :: prefixes :: tail ->
+    parseArgs
+      tail
+      { options with
+          Prefixes = options.Prefixes @ splitList prefixes }
+  | "--plane" :: plane :: tail ->
+    parseArgs tail { options with Planes = options.Planes @ [ plane ] }
+  | "--imperfection" :: imperfection :: tail ->
+    parseArgs
+      tail
+      { options with
+          Imperfections = options.Imperfections @ [ imperfection ] }
+  | "--vehicle" :: vehicle :: tail ->
+    parseArgs tail { options with Vehicle = Some vehicle }
+  | "--path" :: path :: tail ->
+    parseArgs tail { options with Path = options.Path @ splitList path }
+  | "--step" :: step :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(step, styles, culture) with
+    | (true, x) -> parseArgs tail { options with Step = x }
+    | _ -> parseArgs tail options
+  | "--scale" :: scale :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(scale, styles, culture) with
+    | (true, x) -> parseArgs tail { options with Scale = Some x }
+    | _ -> parseArgs tail options
+  | "--case" :: case :: tail -> parseArgs tail { options with Case = Some case }
+  | "--temperatures" :: field :: tail ->
+    parseArgs tail { options with Temperatures = Some field }
+  | "--reference" :: reference :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(reference, styles, culture) with
+    | (true, x) -> parseArgs tail { options with Reference = x }
+    | _ -> parseArgs tail options
+  | "--measured" :: file :: tail ->
+    parseArgs tail { options with Measured = Some file }
+  | "--tune" :: names :: tail ->
+    parseArgs tail { options with Tune = splitList names }
+  | "--max-utilisation" :: limit :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(limit, styles, culture) with
+    | (true, x) -> parseArgs tail { options with MaxUtilisation = x }
+    | _ -> parseArgs tail options
+  | "--min-frequency" :: frequency :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(frequency, styles, culture) with
+    | (true, x) -> parseArgs tail { options with MinFrequency = Some x }
+    | _ -> parseArgs tail options
+  | "--max-deflection" :: deflection :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(deflection, styles, culture) with
+    | (true, x) -> parseArgs tail { options with MaxDeflection = Some x }
+    | _ -> parseArgs tail options
+  | "--vary" :: sweep :: tail ->
+    parseArgs tail { options with Vary = Some sweep }
+  | "--against" :: file :: tail ->
+    parseArgs tail { options with Against = Some file }
+  | "--vehicles" :: library :: tail ->
+    parseArgs tail { options with Libraries = options.Libraries @ [ library ] }
+  | "--template" :: template :: tail ->
+    parseArgs
+      tail
+      { options with
+          Template = Some template }
+  | "--params" :: paramsFile :: tail ->
+    parseArgs
+      tail
+      { options with
+          Parameters = Some paramsFile }
+  | "--output-dir" :: dir :: tail ->
+    parseArgs tail { options with OutputDir = Some dir }
+  | "--progress" :: tail -> parseArgs tail { options with Progress = true }
+  | "--update" :: tail -> parseArgs tail { options with Update = true }
+  | "--batch" :: tail -> parseArgs tail { options with Batch = true }
+  | "--matrices" :: tail -> parseArgs tail { options with Matrices = true }
+  | "--workers" :: workers :: tail ->
+    match Int32.TryParse workers with
+    | (true, n) -> parseArgs tail { options with Workers = n }
+    | (false, _) -> parseArgs tail options
+  | "--block" :: block :: tail -> parseArgs tail { options with Block = block }
+  | "--record" :: record :: tail ->
+    match Int32.TryParse record with
+    | (true, n) -> parseArgs tail { options with Record = n }
+    | (false, _) -> parseArgs tail options
+  | "--limit" :: limit :: tail ->
+    match Int32.TryParse limit with
+    | (true, n) -> parseArgs tail { options with Limit = Some n }
+    | (false, _) -> parseArgs tail options
+  | "--offset" :: offset :: tail ->
+    match Int32.TryParse offset with
+    | (true, n) -> parseArgs tail { options with Offset = n }
+    | (false, _) -> parseArgs tail options
+  | "--filter" :: filter :: tail ->
+    parseArgs tail { options with Filters = options.Filters @ [ filter ] }
+  | "--node" :: node :: tail ->
+    parseArgs tail { options with Nodes = options.Nodes @ [ node ] }
+  | "--damping" :: ratio :: tail ->
+    let culture = Globalization.CultureInfo.InvariantCulture
+    let styles = Globalization.NumberStyles.Float
+
+    match Double.TryParse(ratio, styles, culture) with
+    | (true, x) -> parseArgs tail { options with DampingRatio = x }
+    | _ -> parseArgs tail options
+  | "--port" :: port :: tail ->
+    match Int32.TryParse port with
+    | (true, n) -> parseArgs tail { options with Port = n }
+    | (false, _) -> parseArgs tail options
+  | cmd :: tail when not (cmd.StartsWith "--") && options.Command = "" ->
+    // Handle ETABS subcommands
+    if cmd = "etabs" then
+      match tail with
+      | subCmd :: restTail ->
+        parseArgs
+          restTail
           { options with
-              Command = cmd
+              Command = $"etabs-{subCmd}" }
+      | [] -> parseArgs tail { options with Command = "etabs-help" }
+    // Edit subcommands take a model file after the subcommand
+    elif cmd = "edit" then
+      match tail with
+      | subCmd :: file :: restTail when not (file.StartsWith "--") ->
+        parseArgs
+          restTail
+          { options with
+              Command = $"edit-{subCmd}"
               InputFile = Some file }
-      | _ -> parseArgs tail { options with Command = cmd }
-  | unknownArg :: tail ->
-    // Skip unknown arguments but continue parsing
-    parseArgs tail options
+      | subCmd :: restTail ->
+        parseArgs restTail { options with Command = $"edit-{subCmd}" }
+      | [] -> parseArgs tail { options with Command = cmd }
+    // View takes a model file and optionally a results file
+    elif cmd = "view" then
+      match tail with
+      | file :: results :: restTail when
+        not (file.StartsWith "--") && not (results.StartsWith "--")
+        ->
+        parseArgs
+          restTail
+          { options with
+              Command = cmd
+              InputFile = Some file
+              ResultsFile = Some results }
+      | file :: restTail when not (file.StartsWith "--") ->
+        parseArgs
+          restTail
+          { options with
+              Command = cmd
+              InputFile = Some file }
+      | _ -> parseArgs tail { options with Command = cmd }
+    // Snapshot takes a model, or verify and an archive
+    elif cmd = "snapshot" then
+      match tail with
+      | "verify" :: file :: restTail when not (file.StartsWith "--") ->
+        parseArgs
+          restTail
+          { options with
+              Command = "snapshot-verify"
+              InputFile = Some file }
+      | "verify" :: restTail ->
+        parseArgs restTail { options with Command = "snapshot-verify" }
+      | file :: restTail when not (file.StartsWith "--") ->
+        parseArgs
+          restTail
+          { options with
+              Command = cmd
+              InputFile = Some file }
+      | _ -> parseArgs tail { options with Command = cmd }
+    // Transfer takes a source model and a target model
+    elif cmd = "transfer" then
+      match tail with
+      | source :: target :: restTail when
+        not (source.StartsWith "--") && not (target.StartsWith "--")
+        ->
+        parseArgs
+          restTail
+          { options with
+              Command = cmd
+              InputFile = Some source
+              TargetFile = Some target }
+      | _ -> parseArgs tail { options with Command = cmd }
+    // For commands that don't take a file argument (like 'create'), just set command
+    elif
+      cmd = "create"
+      || cmd = "templates"
+      || cmd = "version"
+      || cmd = "lsp"
+      || cmd = "doctor"
+      || cmd = "verify"
+    then
+      parseArgs tail { options with Command = cmd }
+    else
+      // For commands that take a file, expect next argument to be file
+      match tail with
+      | file :: restTail when not (file.StartsWith "--") ->
+        parseArgs
+          restTail
+          { options with
+              Command = cmd
+              InputFile = Some file }
+      | _ -> parseArgs tail { options with Command = cmd }
+  // Import takes any number of tables
+  | file :: tail when
+    options.Command = "import" && not (file.StartsWith "--")
+    ->
+    parseArgs tail { options with MoreInputs = options.MoreInputs @ [ file ] }
+  | unknownArg :: tail ->
+    // Skip unknown arguments but continue parsing
+    parseArgs tail options
+
+let parse (args: string[]) =
+  let argsList = Array.toList args
+  parseArgs argsList defaultOptions
+
+// Modern output helpers with colors
+let outputResult format content =
+  match format with
+  | "json" ->
+    let json = serialize content
+    let panel = Panel(json)
+    panel.Header <- PanelHeader(" JSON Output ")
+    panel.Border <- BoxBorder.Rounded
+    panel.BorderStyle <- Style.Parse("green")
+    AnsiConsole.Write(panel)
+  | _ ->
+    let table = Table()
+    table.AddColumn("Property") |> ignore
+    table.AddColumn("Value") |> ignore
+    table.Border <- TableBorder.Rounded
+    table.BorderStyle <- Style.Parse("blue")
+
+    // Format content based on type
+    match box content with
+    | :? ModelInfo as model ->
+      table.Title <- TableTitle("Model Information")
+      table.AddRow("[cyan]Name[/]", model.Name) |> ignore
+      table.AddRow("[cyan]Version[/]", model.Version) |> ignore
+      table.AddRow("[cyan]Nodes[/]", model.NodeCount.ToString()) |> ignore
+      table.AddRow("[cyan]Elements[/]", model.ElementCount.ToString()) |> ignore
+      table.AddRow("[cyan]Load Cases[/]", model.LoadCases.ToString()) |> ignore
+    | :? AnalysisResult as result ->
+      table.Title <- TableTitle("Analysis Results")
+      table.AddRow("[cyan]Model[/]", result.ModelName) |> ignore
+      table.AddRow("[cyan]Status[/]", $"[green]{result.Status}[/]") |> ignore
+
+      match result.MaxDisplacement with
+      | Some d ->
+        table.AddRow("[cyan]Max Displacement[/]", $"{d:F3} m") |> ignore
+      | None -> ()
+
+      // Stresses are in the model's units, force / length².
+      match result.MaxStress with
+      | Some s ->
+        let stress =
+          match UnitSystem.tryFind result.Units, UnitSystem.tryFind "SI" with
+          | Ok source, Ok si ->
+            let pascals = s * UnitSystem.factor source si -2 1
+            $"{pascals / 1e6:F1} MPa"
+          | _ -> $"{s:G4} {result.Units}"
+
+        table.AddRow("[cyan]Max Stress[/]", stress) |> ignore
+      | None -> ()
+
+      match result.MaxUtilisation with
+      | Some u -> table.AddRow("[cyan]Max Utilisation[/]", $"{u:F2}") |> ignore
+      | None -> ()
+
+      match result.InitialState with
+      | Some file -> table.AddRow("[cyan]Initial State[/]", file) |> ignore
+      | None -> ()
+
+      for set in result.LoadSets do
+        let applied =
+          set.Applied
+          |> Map.toList
+          |> List.map (fun (direction, total) -> $"{direction}={total:F2}")
+
+        let amplification =
+          set.Amplification
+          |> Option.map (fun x -> $"amplification {x:F3}")
+          |> Option.toList
+
+        let steps =
+          set.Steps
+          |> Option.filter (fun n -> n > 1)
+          |> Option.map (fun n -> $"{n} load steps")
+          |> Option.toList
+
+        let loads = $"{set.LoadCount} load(s)"
+        let summary =
+          String.Join(", ", loads :: applied @ amplification @ steps)
+
+        table.AddRow($"[cyan]{set.Kind} {set.Name}[/]", summary) |> ignore
+
+      match result.ReactionConvention with
+      | Some text -> table.AddRow("[cyan]Reaction Sign[/]", text) |> ignore
+      | None -> ()
+
+      for r in result.Reactions do
+        let format (forces: Map<string, float>) =
+          forces |> Map.toList |> List.map (fun (dof, x) -> $"{dof}={x:F2}")
+
+        let local =
+          match r.Local, r.Angle with
+          | Some forces, Some angle ->
+            let parts = String.Join(", ", format forces)
+            [ $"local at {angle:F1}°: {parts}" ]
+          | _ -> []
+
+        let summary = String.Join(", ", format r.Global @ local)
+        let name = $"[cyan]Reaction {r.Node} ({r.LoadSet})[/]"
+        table.AddRow(name, summary) |> ignore
+
+      for e in result.Energies do
+        let most =
+          if e.Elements.IsEmpty || e.StrainEnergy = 0.0 then
+            ""
+          else
+            let id, u = e.Elements |> Map.toSeq |> Seq.maxBy snd
+            $", most in {id} ({u / e.StrainEnergy:P0})"
+
+        let summary =
+          $"work {e.ExternalWork:G4}, imbalance {e.Imbalance:P2}{most}"
+
+        let name = $"[cyan]Energy ({e.LoadSet})[/]"
+        table.AddRow(name, summary) |> ignore
+
+      for mode in result.Modes do
+        let summary = $"{mode.Frequency:F3} Hz, T = {mode.Period:F3} s"
+        table.AddRow($"[cyan]Mode {mode.Number}[/]", summary) |> ignore
+
+      match result.Provenance with
+      | Some p ->
+        let tolerance =
+          p.Tolerance |> Option.map (fun t -> $", tolerance {t:G3}")
+
+        let solver = p.Solver + Option.defaultValue "" tolerance
+        let times = $"{p.WallTime:F3} s wall, {p.CpuTime:F3} s CPU"
+        let run = $"Gazelle {p.GazelleVersion} on {p.Hostname}, {times}"
+        table.AddRow("[cyan]Solver[/]", solver) |> ignore
+        table.AddRow("[cyan]Run[/]", run) |> ignore
+        table.AddRow("[cyan]Started[/]", $"{p.Timestamp:u}") |> ignore
+        table.AddRow("[cyan]Model Hash[/]", p.ModelHash) |> ignore
+      | None -> ()
+    | :? DynamicSummary as result ->
+      table.Title <- TableTitle("Time-History Results")
+      table.AddRow("[cyan]Model[/]", result.ModelName) |> ignore
+      table.AddRow("[cyan]Method[/]", result.Method) |> ignore
+      table.AddRow("[cyan]Integrator[/]", result.Integrator) |> ignore
+      table.AddRow("[cyan]Steps[/]", result.Steps.ToString()) |> ignore
+      table.AddRow("[cyan]Time Step[/]", $"{result.TimeStep:G4} s") |> ignore
+
+      let at =
+        match result.PeakNode with
+        | Some node -> $" at {node}, t = {result.PeakTime:F3} s"
+        | None -> ""
+
+      let peak = $"{result.PeakDisplacement:G4} m{at}"
+      table.AddRow("[cyan]Peak Displacement[/]", peak) |> ignore
+
+      let imbalance = $"{result.EnergyImbalance:P2} of the external work"
+      table.AddRow("[cyan]Energy Imbalance[/]", imbalance) |> ignore
+    | :? SpectrumSummary as result ->
+      table.Title <- TableTitle("Response Spectrum Results")
+      table.AddRow("[cyan]Model[/]", result.ModelName) |> ignore
+      table.AddRow("[cyan]Combination[/]", result.Combination) |> ignore
+      table.AddRow("[cyan]Direction[/]", result.Direction) |> ignore
+
+      for mode in result.Modes do
+        let summary =
+          $"T = {mode.Period:F3} s, Sa = {mode.Acceleration:G4}, "
+          + $"mass {mode.MassRatio:P1}"
+
+        table.AddRow($"[cyan]Mode {mode.Number}[/]", summary) |> ignore
+
+      let participation = $"{result.MassParticipation:P1}"
+      table.AddRow("[cyan]Mass Participation[/]", participation) |> ignore
+      table.AddRow("[cyan]Base Shear[/]", $"{result.BaseShear:G4}") |> ignore
+
+      let peak = $"{result.MaxDisplacement:G4} m"
+      table.AddRow("[cyan]Max Displacement[/]", peak) |> ignore
+    | :? BuildInfo as info ->
+      table.Title <- TableTitle("Version Information")
+      table.AddRow("[cyan]Version[/]", info.Version) |> ignore
+      table.AddRow("[cyan]Commit[/]", info.Commit) |> ignore
+      table.AddRow("[cyan]Build Date[/]", info.BuildDate) |> ignore
+      table.AddRow("[cyan]Runtime[/]", info.Runtime) |> ignore
+      table.AddRow("[cyan]Platform[/]", info.Platform) |> ignore
+
+      table.AddRow("[cyan]Backends[/]", String.Join(", ", info.Backends))
+      |> ignore
+    | :? ValidationResult as validation ->
+      table.Title <- TableTitle("Validation Results")
+      let statusColor = if validation.IsValid then "green" else "red"
+      let statusText = if validation.IsValid then "✓ Valid" else "✗ Invalid"
+
+      table.AddRow("[cyan]Status[/]", $"[{statusColor}]{statusText}[/]")
+      |> ignore
+
+      table.AddRow("[cyan]Errors[/]", validation.Errors.Length.ToString())
+      |> ignore
+
+      table.AddRow("[cyan]Warnings[/]", validation.Warnings.Length.ToString())
+      |> ignore
+    | _ ->
+      let contentStr = content.ToString()
+      table.AddRow("[cyan]Result[/]", contentStr) |> ignore
+
+    AnsiConsole.Write(table)
+
+let outputToFile format (filePath: string) content =
+  AnsiConsole
+    .Status()
+    .Start(
+      $"Writing to {Path.GetFileName(filePath)}...",
+      fun ctx ->
+        ctx.Spinner <- Spinner.Known.Star
+        ctx.SpinnerStyle <- Style.Parse("green")
+
+        match format with
+        | "json" -> serializeToFile filePath content
+        | "pb" -> serializeToBinary filePath content
+        | _ when Path.GetExtension(filePath).ToLowerInvariant() = ".pb" ->
+          serializeToBinary filePath content
+        | _ ->
+          let text = sprintf "%A" content
+          File.WriteAllText(filePath, text)
+
+        System.Threading.Thread.Sleep(500) // Brief pause to show spinner
+    )
+
+  AnsiConsole.MarkupLine($"[green]✓[/] Results written to [cyan]{filePath}[/]")
+
+let showSuccess message =
+  AnsiConsole.MarkupLine($"[green]✓[/] {message}")
+
+let showError message =
+  AnsiConsole.MarkupLine($"[red]✗[/] {message}")
+
+let showWarning message =
+  AnsiConsole.MarkupLine($"[yellow]⚠[/] {message}")
+
+let showInfo message =
+  AnsiConsole.MarkupLine($"[blue]ℹ[/] {message}")
+
+let withProgress<'T> (message: string) (work: unit -> 'T) =
+  AnsiConsole
+    .Status()
+    .Start(
+      message,
+      fun ctx ->
+        ctx.Spinner <- Spinner.Known.Dots
+        ctx.SpinnerStyle <- Style.Parse("yellow")
+        work ()
+    )
+
+/// Parses repeated --set key=value arguments into parameter overrides.
+let parseSettings
+  (settings: string list)
+  : Result<Map<string, string>, string> =
+  let folder acc (setting: string) =
+    acc
+    |> Result.bind (fun overrides ->
+      match setting.IndexOf '=' with
+      | i when i > 0 ->
+        let key = setting.Substring(0, i).Trim()
+        Ok(Map.add key (setting.Substring(i + 1)) overrides)
+      | _ -> Error $"Invalid --set '{setting}', expected key=value")
+
+  List.fold folder (Ok Map.empty) settings
+
+/// Loads the input model, honouring --input-format, --set and "-" for stdin.
+let loadModel (options: CliOptions) (file: string) : Result<Model, string> =
+  let format =
+    match options.InputFormat with
+    | Some name ->
+      ModelFormat.tryParse name
+      |> Result.map Some
+      |> Result.mapError ModelError.getAsString
+    | None -> Ok None
+
+  match format, parseSettings options.Settings with
+  | Ok f, Ok parameters ->
+    Parts.readWith { Format = f; Parameters = parameters } file
+    |> Result.mapError ModelError.getAsString
+  | Error msg, _
+  | _, Error msg -> Error msg
+
+/// Writes a model to --output as YAML for a .yaml or .yml file, Protocol
+/// Buffers for a .pb file, else JSON.
+let saveModel (file: string) (m: Model) =
+  let format =
+    match ModelFormat.fromPath file with
+    | Ok Yaml -> Yaml
+    | Ok Protobuf -> Protobuf
+    | _ -> Json
+
+  Model.write format file m
+
+// Commands
+let infoCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    showError "No model file specified"
+    1
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file ->
+    try
+      match loadModel options file with
+      | Error msg ->
+        showError $"Error reading model: {msg}"
+        1
+      | Ok model ->
+        let modelInfo =
+          { Name = model.Info.Name
+            Version = model.Info.Version
+            NodeCount = model.Nodes.Count
+            ElementCount = model.Elements.Count
+            LoadCases = (LoadCases.cases model).Length }
+
+        match options.OutputFile with
+        | Some outputFile -> outputToFile options.Format outputFile modelInfo
+        | None -> outputResult options.Format modelInfo
+
+        0
+    with ex ->
+      showError $"Error reading model: {ex.Message}"
+      1
+
+/// Reads the --solver option, defaulting to skyline Cholesky.
+let linearSolver (options: CliOptions) : Result<LinearSolver, string> =
+  match options.Solver with
+  | None -> Ok LinearSolver.defaultSolver
+  | Some name ->
+    LinearSolver.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error(
+        $"Unknown solver '{name}'. Available: skyline, skyline:rcm, "
+        + "skyline:natural, dense, pcg, pcg:jacobi."
+      )
+    )
+
+/// Reads the --mass option, defaulting to consistent mass.
+let massMatrix (options: CliOptions) : Result<MassMatrix, string> =
+  match options.MassMatrix with
+  | None -> Ok MassMatrix.Consistent
+  | Some name ->
+    MassMatrix.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error $"Unknown mass matrix '{name}'. Available: consistent, lumped."
+    )
+
+/// Reads the --reaction-sign option, defaulting to forces on the structure.
+let reactionConvention
+  (options: CliOptions)
+  : Result<ReactionConvention, string> =
+  match options.ReactionSign with
+  | None -> Ok ReactionConvention.OnStructure
+  | Some name ->
+    ReactionConvention.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error $"Unknown reaction sign '{name}'. Available: structure, support."
+    )
+
+/// Reads the --scheme option, defaulting to Newton-Raphson.
+let iterationScheme (options: CliOptions) : Result<IterationScheme, string> =
+  match options.Scheme with
+  | None -> Ok IterationScheme.NewtonRaphson
+  | Some name ->
+    IterationScheme.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error $"Unknown iteration scheme '{name}'. Available: newton, bfgs."
+    )
+
+/// Names the degrees of freedom of nodal values, e.g. for JSON output.
+let private namedDofs (values: Map<string, Map<Dof, float>>) =
+  values
+  |> Map.map (fun _ dofs ->
+    dofs |> Map.toSeq |> Seq.map (fun (d, x) -> Dof.getAsString d, x) |> Map)
+
+/// Computes the natural modes of a model with the --modes and --mass
+/// options.
+let modesOf
+  (kind: MassMatrix)
+  (options: CliOptions)
+  (model: Model)
+  : Result<ModeResult[], string> =
+  Modal.analyse kind options.ModeCount model
+  |> Result.mapError ModalError.getAsString
+  |> Result.map (fun r ->
+    [| for mode in r.Modes do
+         let f = Modal.frequency mode
+
+         { Number = mode.Number
+           Frequency = f
+           Period = 1.0 / f
+           Shape = Modal.shape r mode |> namedDofs } |])
+
+/// Analyses a loaded model with the --save, --cases, --combinations,
+/// --initial-state, --solver, --plane, --modes and --mass options.
+let private analyzeSets
+  (options: CliOptions)
+  (model: Model)
+  : Result<AnalysisResult, string> =
+  let saved =
+    match options.Save with
+    | Some names -> ResultBlock.parseAll names
+    | None -> Ok(Set.ofList ResultBlock.all)
+
+  match saved with
+  | Error name ->
+    let known =
+      String.Join(", ", ResultBlock.all |> List.map ResultBlock.getAsString)
+
+    Error $"Unknown result block '{name}'. Available: {known}."
+  | Ok saved ->
+    let initial =
+      match options.InitialState with
+      | None -> Ok InitialState.empty
+      | Some path ->
+        InitialState.read path
+        |> Result.bind (InitialState.check model)
+        |> Result.mapError InitialStateError.getAsString
+
+    let selected =
+      LoadCases.select model options.Cases options.Combinations
+
+    // A symmetric model is analysed by its part on one side of each
+    // --plane, its results mirrored back to the whole, last cut first.
+    let cut =
+      options.Planes
+      |> List.fold
+        (fun acc name ->
+          acc
+          |> Result.bind (fun (part, cuts) ->
+            SymmetryPlane.tryParse name
+            |> Result.bind (fun p ->
+              Symmetry.apply p part
+              |> Result.map (fun half -> half, (p, part) :: cuts))))
+        (Ok(model, []))
+      |> Result.mapError SymmetryError.getAsString
+
+    let solver =
+      linearSolver options
+      |> Result.bind (fun s -> massMatrix options |> Result.map (fun k -> s, k))
+      |> Result.bind (fun (s, k) ->
+        reactionConvention options |> Result.map (fun c -> s, k, c))
+      |> Result.bind (fun (s, k, c) ->
+        iterationScheme options |> Result.map (fun i -> s, k, c, i))
+
+    match initial, selected, solver, cut with
+    | Error e, _, _, _
+    | _, _, Error e, _
+    | _, _, _, Error e -> Error e
+    | _, Error e, _, _ -> Error(SelectionError.getAsString e)
+    | Ok initial,
+      Ok sets,
+      Ok(solver, kind, convention, scheme),
+      Ok(part, cuts) ->
+      let settings: SecondOrderSettings =
+        { Tolerance = options.Convergence
+          MaxIterations = options.Iterations
+          MaxStep = options.MaxStep
+          MinStep = min options.MinStep options.MaxStep
+          Scheme = scheme
+          LineSearch = options.LineSearch }
+
+      let solve model a loads =
+        match options.AnalysisType with
+        | "second-order" ->
+          SecondOrder.solveWith settings solver initial model a loads
+          |> Result.mapError SecondOrderError.getAsString
+          |> Result.map (fun r -> r.Response, Some(r.Amplification, r.Steps))
+        | _ ->
+          Static.solveWith solver model a loads
+          |> Result.mapError StaticError.getAsString
+          |> Result.map (fun r -> r, None)
+
+      // Imperfections apply in turn; a buckling mode is that of the set.
+      let imperfect (set: LoadSet) =
+        options.Imperfections
+        |> List.fold
+          (fun acc text ->
+            acc
+            |> Result.bind (fun m ->
+              Imperfection.tryParse text
+              |> Result.mapError FailedImperfection
+              |> Result.bind (fun i -> Stability.imperfect set i m)))
+          (Ok part)
+        |> Result.mapError StabilityError.getAsString
+
+      // The loads of a set that remain on the part analysed.
+      let within (set: LoadSet) =
+        match cuts, set.Kind with
+        | [], _ -> set
+        | _, LoadCase -> LoadCases.ofCase part set.Name
+        | _, LoadCombination ->
+          LoadCases.ofCombination part part.Combinations[set.Name]
+
+      let mirrored (r: StaticResult) =
+        cuts |> List.fold (fun r (p, m) -> Static.mirror p m r) r
+
+      // Loads on the whole model, for its applied load.
+      let applied (whole: LoadSet) loads =
+        match cuts with
+        | [] -> Ok loads
+        | _ ->
+          NodalLoads.ofLoadSet model whole
+          |> Result.mapError LoadError.getAsString
+
+      let summarise (whole: LoadSet) =
+        let set = within whole
+
+        imperfect set
+        |> Result.bind (fun model ->
+          NodalLoads.ofLoadSet model set
+          |> Result.mapError LoadError.getAsString
+          |> Result.map (fun loads -> model, loads))
+        |> Result.bind (fun (model, loads) ->
+          Static.assemble model
+          |> Result.mapError StaticError.getAsString
+          |> Result.bind (fun a ->
+            solve model a loads
+            |> Result.map (fun (response, amplification) ->
+              // Balances hold for the linear stiffness only.
+              let energy =
+                match options.AnalysisType with
+                | "second-order" -> None
+                | _ when saved.Contains Energies ->
+                  Energy.ofStatic model a loads response
+                  |> Result.mapError StaticError.getAsString
+                  |> Some
+                | _ -> None
+
+              response, amplification, energy))
+          |> Result.bind (fun (response, amplification, energy) ->
+            Static.withThermal model set response
+            |> Result.mapError StaticError.getAsString
+            |> Result.map (fun r -> r, amplification, energy))
+          |> Result.bind (fun (response, amplification, energy) ->
+            applied whole loads
+            |> Result.map (fun total ->
+              let balance =
+                Equilibrium.check Equilibrium.Tolerance model loads response
+
+              let summary =
+                { Name = whole.Name
+                  Kind =
+                    match whole.Kind with
+                    | LoadCase -> "Case"
+                    | LoadCombination -> "Combination"
+                  LoadCount = whole.Loads.Length
+                  Applied = NodalLoads.resultant total
+                  Amplification = amplification |> Option.map fst
+                  Steps = amplification |> Option.map snd
+                  Residual = balance.Residual
+                  Converged = balance.Converged }
+
+              (summary, mirrored response), energy)))
+
+      let analysed =
+        List.foldBack
+          (fun set acc ->
+            match summarise set, acc with
+            | Ok summary, Ok rest -> Ok(summary :: rest)
+            | Error e, _
+            | _, Error e -> Error e)
+          sets
+          (Ok [])
+
+      match analysed with
+      | Error e -> Error e
+      | Ok analysed ->
+        let analysed, balances = List.unzip analysed
+
+        let keep block value =
+          if saved.Contains block then Some value else None
+
+        let responses = analysed |> List.map snd
+
+        let maxDisplacement =
+          [ for r in responses do
+              for KeyValue(_, dofs) in r.Displacements do
+                let at dof = dofs.TryFind dof |> Option.defaultValue 0.0
+                sqrt (at Ux ** 2.0 + at Uy ** 2.0 + at Uz ** 2.0) ]
+          |> List.fold max 0.0
+
+        // Members take the moments of the loads along them.
+        let elementStresses =
+          List.foldBack
+            (fun (set: LoadSet, (_, r)) acc ->
+              match Design.stresses model set r, acc with
+              | Ok stresses, Ok rest -> Ok((set.Name, stresses) :: rest)
+              | Error e, _ -> Error(LoadError.getAsString e)
+              | _, Error e -> Error e)
+            (List.zip sets analysed)
+            (Ok [])
+
+        let stressed = elementStresses |> Result.defaultValue []
+
+        let maxStress =
+          [ for _, stresses in stressed do
+              for s in stresses -> s.Stress ]
+          |> List.fold max 0.0
+
+        // Stress over yield strength, for members whose material has one.
+        let maxUtilisation =
+          [ for _, stresses in stressed do
+              for s in stresses do
+                yield! Option.toList s.Ratio ]
+          |> List.fold (fun acc u -> Some(max u (defaultArg acc 0.0))) None
+
+        let stresses: StressResult[] =
+          [| if saved.Contains Stresses then
+               for set, stresses in stressed do
+                 for s in stresses ->
+                   { Element = s.Element
+                     LoadSet = set
+                     Axial = s.Axial
+                     Bending = s.Bending
+                     VonMises = s.VonMises
+                     Stress = s.Stress
+                     Ratio = s.Ratio } |]
+
+        let energies: EnergyResult[] =
+          [| for (set, _), balance in List.zip analysed balances do
+               match balance with
+               | Some(Ok b) ->
+                 { LoadSet = set.Name
+                   ExternalWork = b.ExternalWork
+                   StrainEnergy = b.StrainEnergy
+                   Supports = b.Supports
+                   Imbalance = b.Imbalance
+                   Elements = b.Elements }
+               | _ -> () |]
+
+        let angles =
+          model.Constraints
+          |> Map.toSeq
+          |> Seq.choose (fun (_, c) ->
+            c.Angle |> Option.map (fun angle -> c.Node, angle))
+          |> Map.ofSeq
+
+        let reactions =
+          [| if saved.Contains Reactions then
+               for set, r in analysed do
+                 let named = ReactionConvention.apply convention >> namedDofs
+                 let local = named r.LocalReactions
+
+                 for KeyValue(node, forces) in named r.Reactions do
+                   { LoadSet = set.Name
+                     Node = node
+                     Global = forces
+                     Local = local.TryFind node
+                     Angle = angles.TryFind node } |]
+
+        let memberForces: MemberForceResult[] =
+          [| if saved.Contains MemberForces then
+               for set, r in analysed do
+                 for KeyValue(id, forces) in r.MemberForces ->
+                   { Element = id
+                     LoadSet = set.Name
+                     Forces = forces } |]
+
+        let diagrams =
+          if saved.Contains InternalForces then
+            List.zip sets analysed
+            |> List.fold
+              (fun acc (set, (_, r)) ->
+                let members =
+                  Diagrams.ofResult model set options.Stations r
+                  |> Result.mapError LoadError.getAsString
+
+                match acc, members with
+                | Ok rest, Ok members ->
+                  Ok
+                    [ yield! rest
+                      for KeyValue(id, stations) in members ->
+                        { Element = id
+                          LoadSet = set.Name
+                          Stations = Array.ofList stations } ]
+                | Error e, _
+                | _, Error e -> Error e)
+              (Ok [])
+          else
+            Ok []
+
+        let internalForces: InternalForceResult[] =
+          diagrams |> Result.defaultValue [] |> Array.ofList
+
+        // Only models with a known mass have natural modes to report.
+        let modes =
+          match Mass.total model with
+          | Some _ when saved.Contains Modes -> modesOf kind options model
+          | _ -> Ok [||]
+
+        Ok
+          { FormatVersion = ResultFormat.Version
+            ModelName = model.Info.Name
+            Units = model.Info.Units
+            Status = "Success"
+            MaxDisplacement = keep Displacements maxDisplacement
+            MaxStress = keep MemberForces maxStress
+            MaxUtilisation = maxUtilisation |> Option.bind (keep MemberForces)
+            InitialState = options.InitialState
+            Saved =
+              ResultBlock.all
+              |> List.filter saved.Contains
+              |> List.map ResultBlock.getAsString
+              |> List.toArray
+            LoadSets = analysed |> List.map fst |> List.toArray
+            Modes = modes |> Result.defaultValue [||]
+            ReactionConvention =
+              if reactions.Length > 0 then
+                Some(ReactionConvention.describe convention)
+              else
+                None
+            Reactions = reactions
+            MemberForces = memberForces
+            InternalForces = internalForces
+            Stresses = stresses
+            Energies = energies
+            Warnings =
+              [| match modes with
+                 | Error e -> $"Modal analysis skipped: {e}"
+                 | Ok _ -> ()
+                 match diagrams with
+                 | Error e -> $"Internal forces skipped: {e}"
+                 | Ok _ -> ()
+                 match elementStresses with
+                 | Error e -> $"Stresses skipped: {e}"
+                 | Ok _ -> ()
+                 for (set, _), balance in List.zip analysed balances do
+                   match balance with
+                   | Some(Error e) ->
+                     $"Energy balance of '{set.Name}' skipped: {e}"
+                   | _ -> ()
+                 for set, _ in analysed do
+                   if not set.Converged then
+                     $"Load set '{set.Name}' is out of equilibrium: its "
+                     + $"reactions miss its loads by {set.Residual:g3} of "
+                     + "the applied force" |]
+            Errors = [||]
+            Provenance = None }
+
+/// Analyses a loaded model as analyzeSets does, recording the provenance
+/// of its results.
+let analyzeModel
+  (options: CliOptions)
+  (model: Model)
+  : Result<AnalysisResult, string> =
+  let solver =
+    linearSolver options |> Result.defaultValue LinearSolver.defaultSolver
+
+  let tolerance =
+    match options.AnalysisType, solver with
+    | "second-order", _ -> Some options.Convergence
+    | _, LinearSolver.Pcg _ -> Some LinearSolver.Tolerance
+    | _ -> None
+
+  let result, provenance =
+    Provenance.measure
+      (LinearSolver.getAsString solver)
+      tolerance
+      model
+      (fun () -> analyzeSets options model)
+
+  result |> Result.map (fun r -> { r with Provenance = Some provenance })
+
+/// Reads the --integrator option, defaulting to Newmark's constant average
+/// acceleration scheme.
+let integrator (options: CliOptions) : Result<Integrator, string> =
+  match options.Integrator with
+  | None -> Ok(Newmark(0.25, 0.5))
+  | Some name ->
+    Integrator.tryParse name |> Result.mapError TransientError.getAsString
+
+/// Reads the --method option, defaulting to direct integration.
+let transientMethod (options: CliOptions) : Result<TransientMethod, string> =
+  match options.TransientMethod with
+  | None -> Ok DirectIntegration
+  | Some name ->
+    TransientMethod.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error $"Unknown time-history method '{name}'. Available: direct, modal:N."
+    )
+
+/// Integrates the time history of a loaded model with the --method,
+/// --integrator and --mass options, streaming each time step to the
+/// --output file, or to standard output as JSON Lines.
+let analyzeDynamic (options: CliOptions) (model: Model) : int =
+  let target =
+    match options.OutputFile with
+    | None -> Ok None
+    | Some path ->
+      match StreamFormat.fromPath path with
+      | Some f -> Ok(Some(f, path))
+      | None ->
+        Error $"Unsupported time-history output '{path}'; use .jsonl or .csv"
+
+  let prepared =
+    integrator options
+    |> Result.bind (fun i -> massMatrix options |> Result.map (fun k -> i, k))
+    |> Result.bind (fun (i, kind) ->
+      Dynamic.prepare kind model
+      |> Result.mapError DynamicError.getAsString
+      |> Result.map (fun d -> i, d))
+
+  match target, transientMethod options, prepared with
+  | Error msg, _, _
+  | _, Error msg, _
+  | _, _, Error msg ->
+    showError msg
+    1
+  | Ok target, Ok method, Ok(i, d) ->
+    let stream =
+      match target with
+      | Some(f, path) -> ResultStream.create f path
+      | None -> ResultStream.ofStream JsonLines (Console.OpenStandardOutput())
+
+    let mutable peak = 0.0, None, 0.0
+    let mutable step = 0
+    let mutable energy = None
+    let mutable imbalance = 0.0, 0.0
+
+    let observe time u v a =
+      let displacements = Dynamic.byNode d.Dofs u
+      let e = Energy.advance d step energy u v
+      energy <- Some(e, Array.copy u, Array.copy v)
+      step <- step + 1
+
+      let largest, work = imbalance
+      imbalance <- max largest (abs e.Imbalance), max work (abs e.ExternalWork)
+
+      for KeyValue(node, dofs) in displacements do
+        let at dof = dofs.TryFind dof |> Option.defaultValue 0.0
+        let x = sqrt (at Ux ** 2.0 + at Uy ** 2.0 + at Uz ** 2.0)
+        let largest, _, _ = peak
+
+        if x > largest then
+          peak <- x, Some node, time
+
+      ResultStream.write
+        stream
+        { Units = model.Info.Units
+          Time = time
+          Displacements = namedDofs displacements
+          Velocities = namedDofs (Dynamic.byNode d.Dofs v)
+          Accelerations = namedDofs (Dynamic.byNode d.Dofs a)
+          KineticEnergy = e.Kinetic
+          StrainEnergy = e.Strain
+          DampingEnergy = e.Damping
+          ExternalWork = e.ExternalWork }
+
+    let outcome =
+      try
+        Dynamic.runWith method i model d observe
+      finally
+        ResultStream.close stream
+
+    match outcome, target with
+    | Error e, _ ->
+      showError (DynamicError.getAsString e)
+      1
+    | Ok(), None -> 0
+    | Ok(), Some(_, path) ->
+      let largest, node, time = peak
+      let excess, work = imbalance
+
+      let summary: DynamicSummary =
+        { ModelName = model.Info.Name
+          Method = TransientMethod.getAsString method
+          Integrator = Integrator.getAsString i
+          Steps = d.Loads.Length
+          TimeStep = d.TimeStep
+          PeakDisplacement = largest
+          PeakNode = node
+          PeakTime = time
+          EnergyImbalance = if work = 0.0 then 0.0 else excess / work }
+
+      outputResult options.Format summary
+
+      showSuccess $"Time history written to [cyan]{path}[/]"
+      0
+
+/// Reads the --direction option as the translation it excites.
+let direction (options: CliOptions) : Result<Dof, string> =
+  match options.Direction.Trim().ToUpperInvariant() with
+  | "X"
+  | "UX" -> Ok Ux
+  | "Y"
+  | "UY" -> Ok Uy
+  | "Z"
+  | "UZ" -> Ok Uz
+  | other -> Error $"Unknown direction '{other}'. Available: X, Y, Z."
+
+/// Reads the --combine option, defaulting to CQC.
+let combination (options: CliOptions) : Result<ModalCombination, string> =
+  match options.Combination with
+  | None -> Ok ModalCombination.Cqc
+  | Some name ->
+    ModalCombination.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error $"Unknown modal combination '{name}'. Available: cqc, srss."
+    )
+
+/// Computes the peak response of a loaded model to the --spectrum file
+/// with the --direction, --combine, --modes and --mass options.
+let analyzeSpectrum
+  (options: CliOptions)
+  (model: Model)
+  : Result<SpectrumSummary, string> =
+  let spectrum =
+    match options.Spectrum with
+    | None -> Error "Spectrum analysis needs a --spectrum file"
+    | Some path ->
+      Spectrum.read path |> Result.mapError SpectrumError.getAsString
+
+  spectrum
+  |> Result.bind (fun s -> direction options |> Result.map (fun d -> s, d))
+  |> Result.bind (fun (s, d) ->
+    combination options |> Result.map (fun rule -> s, d, rule))
+  |> Result.bind (fun (s, d, rule) ->
+    massMatrix options |> Result.map (fun kind -> s, d, rule, kind))
+  |> Result.bind (fun (s, d, rule, kind) ->
+    Spectrum.analyse rule kind options.ModeCount d s model
+    |> Result.mapError SpectrumError.getAsString
+    |> Result.map (fun r -> d, rule, r))
+  |> Result.map (fun (d, rule, r) ->
+    let ratio x = if r.Mass > 0.0 then x / r.Mass else 0.0
+    let displacements = Dynamic.byNode r.Dofs r.Displacements
+
+    let largest =
+      displacements
+      |> Map.toSeq
+      |> Seq.map (fun (_, dofs) ->
+        let at dof = dofs.TryFind dof |> Option.defaultValue 0.0
+        sqrt (at Ux ** 2.0 + at Uy ** 2.0 + at Uz ** 2.0))
+      |> Seq.fold max 0.0
+
+    { ModelName = model.Info.Name
+      Combination = ModalCombination.getAsString rule
+      Direction = Dof.getAsString d
+      Modes =
+        [| for m in r.Modes ->
+             { Number = m.Mode.Number
+               Period = m.Period
+               Acceleration = m.Acceleration
+               Participation = m.Participation
+               MassRatio = ratio m.EffectiveMass } |]
+      MassParticipation =
+        r.Modes |> List.sumBy (fun m -> m.EffectiveMass) |> ratio
+      BaseShear = r.BaseShear
+      MaxDisplacement = largest
+      Displacements = namedDofs displacements })
+
+let analyzeCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    showError "No model file specified"
+    1
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    eprintfn "Error: Model file not found: %s" file
+    1
+  | Some file ->
+    try
+      if options.Verbose then
+        showInfo $"Analyzing model: {file}"
+
+      match loadModel options file with
+      | Error msg ->
+        showError $"Error reading model: {msg}"
+        1
+      | Ok model ->
+        match options.AnalysisType with
+        | "dynamic" -> analyzeDynamic options model
+        | "spectrum" ->
+          match analyzeSpectrum options model with
+          | Error msg ->
+            showError msg
+            1
+          | Ok result ->
+            match options.OutputFile with
+            | Some outputFile -> outputToFile options.Format outputFile result
+            | None -> outputResult options.Format result
+
+            0
+        | "static"
+        | "second-order" ->
+          match analyzeModel options model with
+          | Error msg ->
+            showError msg
+            1
+          | Ok result ->
+            match options.OutputFile with
+            | Some outputFile -> outputToFile options.Format outputFile result
+            | None -> outputResult options.Format result
+
+            0
+        | other ->
+          let kinds = "static, second-order, dynamic or spectrum"
+          showError $"Unknown analysis type '{other}'; use {kinds}."
+          1
+    with ex ->
+      showError $"Error during analysis: {ex.Message}"
+      1
+
+let validateCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    eprintfn "Error: No model file specified"
+    1
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    eprintfn "Error: Model file not found: %s" file
+    1
+  | Some file ->
+    try
+      if options.Verbose then
+        printfn "Validating model: %s" file
+
+      let report =
+        match loadModel options file with
+        | Ok model -> Ok(Validation.validate model)
+        | Error msg -> Error msg
+
+      let result =
+        match report with
+        | Ok r ->
+          { IsValid = Validation.passes options.Strict r
+            Errors =
+              r.Errors |> List.map ValidationError.getAsString |> List.toArray
+            Warnings =
+              r.Warnings
+              |> List.map ValidationWarning.getAsString
+              |> List.toArray }
+        | Error msg ->
+          { IsValid = false
+            Errors = [| msg |]
+            Warnings = [||] }
+
+      match options.OutputFile with
+      | Some outputFile -> outputToFile options.Format outputFile result
+      | None ->
+        outputResult options.Format result
+
+        if options.Format <> "json" then
+          result.Errors |> Array.iter showError
+          result.Warnings |> Array.iter showWarning
+
+      // Exit codes: 0 valid, 1 errors, 2 warnings under --strict.
+      match result with
+      | r when r.IsValid -> 0
+      | r when r.Errors.Length > 0 -> 1
+      | _ -> 2
+    with ex ->
+      eprintfn "Error during validation: %s" ex.Message
+      1
+
+/// Applies --prefix kind=prefix arguments to the default renumber options.
+let parsePrefixes (prefixes: string list) : Result<RenumberOptions, string> =
+  let folder acc (prefix: string) =
+    acc
+    |> Result.bind (fun (o: RenumberOptions) ->
+      match prefix.Split('=', 2) |> Array.map (fun s -> s.Trim()) with
+      | [| "nodes"; p |] -> Ok { o with NodePrefix = p }
+      | [| "elements"; p |] -> Ok { o with ElementPrefix = p }
+      | [| "loads"; p |] -> Ok { o with LoadPrefix = p }
+      | [| "constraints"; p |] -> Ok { o with ConstraintPrefix = p }
+      | _ ->
+        let kinds = "nodes|elements|loads|constraints"
+        Error $"Invalid --prefix '{prefix}', expected {kinds}=<prefix>")
+
+  List.fold folder (Ok Renumber.defaultOptions) prefixes
+
+let renumberCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    showError "No model file specified"
+    1
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file ->
+    match loadModel options file, parsePrefixes options.Prefixes with
+    | Error msg, _ ->
+      showError $"Error reading model: {msg}"
+      1
+    | _, Error msg ->
+      showError msg
+      1
+    | Ok model, Ok renumberOptions ->
+      let renumbered = Renumber.apply renumberOptions model
+
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile renumbered
+        showSuccess $"Renumbered model written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json renumbered)
+
+      0
+
+/// Imports a model from CSV tables with gz import --format csv.
+/// Imports a model from CSV tables or a workbook, warning of any
+/// validation errors.
+let private importTables
+  (options: CliOptions)
+  (read: string list -> Result<Model, ModelError>)
+  (files: string list)
+  =
+  match files |> List.tryFind (File.Exists >> not) with
+  | Some file ->
+    showError $"Table not found: {file}"
+    1
+  | None ->
+    match read files with
+    | Error e ->
+      showError $"Error reading tables: {ModelError.getAsString e}"
+      1
+    | Ok model ->
+      let report = Validation.validate model
+
+      for e in report.Errors do
+        showWarning (Markup.Escape(ValidationError.getAsString e))
+
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        let nodes, elements = model.Nodes.Count, model.Elements.Count
+
+        showSuccess
+          $"Imported model written to {outputFile} ({nodes} nodes, \
+            {elements} elements, {model.Loads.Count} loads)"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+let importCommand (options: CliOptions) =
+  let files = Option.toList options.InputFile @ options.MoreInputs
+
+  let extension (file: string) = Path.GetExtension(file).ToLowerInvariant()
+
+  let csv =
+    options.Format.ToLowerInvariant() = "csv"
+    || not files.IsEmpty && List.forall (extension >> (=) ".csv") files
+
+  let workbook =
+    options.Format.ToLowerInvariant() = "xlsx"
+    || files.Length = 1 && extension files.Head = ".xlsx"
+
+  let staad =
+    match options.InputFormat, options.InputFile with
+    | Some name, _ -> ModelFormat.tryParse name = Ok Staad
+    | None, Some file -> ModelFormat.fromPath file = Ok Staad
+    | None, None -> false
+
+  match options.InputFile with
+  | None ->
+    showError "No STAAD file, CSV tables or workbook specified"
+    1
+  | Some _ when csv -> importTables options Model.readTables files
+  | Some _ when workbook && files.Length > 1 ->
+    showError "Import reads one workbook at a time"
+    1
+  | Some _ when workbook ->
+    importTables options (List.head >> Model.readWorkbook) files
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"STAAD file not found: {file}"
+    1
+  | Some _ when not staad || not options.MoreInputs.IsEmpty ->
+    showError
+      "Import reads a STAAD.Pro input file (.std or --input-format std), \
+       CSV tables with --format csv or an Excel workbook (.xlsx)"
+
+    1
+  | Some file ->
+    let text =
+      if file = Model.StdIn then stdin.ReadToEnd() else File.ReadAllText file
+
+    let model =
+      Staad.unsupported text
+      |> Result.bind (fun notes ->
+        Model.parse Staad text |> Result.map (fun m -> m, notes))
+      |> Result.mapError ModelError.getAsString
+
+    match model with
+    | Error msg ->
+      showError $"Error reading model: {msg}"
+      1
+    | Ok(model, notes) ->
+      for n in notes do
+        showWarning (Markup.Escape n)
+
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        let skipped = notes.Length
+
+        showSuccess
+          $"Imported model written to {outputFile} ({skipped} not imported)"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+let convertUnitsCommand (options: CliOptions) =
+  match options.InputFile, options.TargetUnits with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, None ->
+    let names = String.Join(", ", UnitSystem.all |> List.map (fun u -> u.Name))
+    showError $"No target units specified. Use --to <{names}>"
+    1
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file, Some units ->
+    let converted =
+      loadModel options file
+      |> Result.bind (fun model ->
+        UnitSystem.tryFind units
+        |> Result.bind (fun target -> UnitSystem.convert target model)
+        |> Result.mapError ConversionError.getAsString)
+
+    match converted with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Model converted to {model.Info.Units}: {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Cuts a model on each --plane in turn, halving or quartering it.
+let addSymmetryCommand (options: CliOptions) =
+  match options.InputFile, options.Planes with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, [] ->
+    showError "No symmetry plane specified. Use --plane <YZ|XZ|XY>[:offset]"
+    1
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file, planes ->
+    let reduced =
+      loadModel options file
+      |> Result.bind (fun model ->
+        planes
+        |> List.fold
+          (fun acc name ->
+            acc
+            |> Result.bind (fun m ->
+              SymmetryPlane.tryParse name
+              |> Result.bind (fun p -> Symmetry.apply p m)))
+          (Ok model)
+        |> Result.mapError SymmetryError.getAsString)
+
+    match reduced with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Symmetric model written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Applies each --imperfection in turn, e.g. sway:X:4 then bow:X:c.
+let addImperfectionsCommand (options: CliOptions) =
+  match options.InputFile, options.Imperfections with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, [] ->
+    showError "No imperfection specified. Use e.g. --imperfection sway:X"
+    1
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file, imperfections ->
+    let imperfect =
+      loadModel options file
+      |> Result.bind (fun model ->
+        imperfections
+        |> List.fold
+          (fun acc text ->
+            acc
+            |> Result.bind (fun m ->
+              Imperfection.tryParse text
+              |> Result.bind (fun i -> Imperfections.apply i m)))
+          (Ok model)
+        |> Result.mapError ImperfectionError.getAsString)
+
+    match imperfect with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Imperfect model written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Adds a load case for each position of --vehicle as it crosses --path.
+let addVehicleCommand (options: CliOptions) =
+  match options.InputFile, options.Vehicle, options.Path with
+  | None, _, _ ->
+    showError "No model file specified"
+    1
+  | _, None, _ ->
+    showError "No vehicle specified. Use e.g. --vehicle hs20"
+    1
+  | _, _, [] ->
+    showError "No path specified. Use e.g. --path e1,e2,e3"
+    1
+  | Some file, _, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file, Some vehicle, path ->
+    let loaded =
+      loadModel options file
+      |> Result.bind (fun model ->
+        UnitSystem.tryFind model.Info.Units
+        |> Result.mapError ConversionError.getAsString
+        |> Result.map (fun units -> model, units))
+
+    let crossed =
+      loaded
+      |> Result.bind (fun (model, units) ->
+        Vehicles.tryParse vehicle
+        |> Result.bind (fun (id, overrides) ->
+          Vehicles.library options.Libraries
+          |> Result.bind (fun library ->
+            Vehicles.resolve library id overrides units))
+        |> Result.bind (fun v ->
+          let case = Option.defaultValue v.Id options.Case
+          Vehicles.cross v path options.Step case model)
+        |> Result.mapError VehicleError.getAsString)
+
+    match crossed with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Model with vehicle positions written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Adds the pattern arrangements of each case in --cases, e.g. LL.
+let addPatternsCommand (options: CliOptions) =
+  match options.InputFile, options.Cases with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, None
+  | _, Some [] ->
+    showError "No load case specified. Use e.g. --cases LL"
+    1
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file, Some cases ->
+    let patterned =
+      loadModel options file
+      |> Result.bind (fun model ->
+        cases
+        |> List.fold
+          (fun acc case -> acc |> Result.bind (Patterns.generate case))
+          (Ok model)
+        |> Result.mapError PatternError.getAsString)
+
+    match patterned with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Patterned model written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Replaces the slab panels of a model with triangular and trapezoidal line
+/// loads on the beams along their edges.
+let addPanelLoadsCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    showError "No model file specified"
+    1
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file ->
+    let distributed =
+      loadModel options file
+      |> Result.bind (
+        Tributary.distribute >> Result.mapError TributaryError.getAsString
+      )
+
+    match distributed with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Model with panel loads written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Adds a load case of thermal loads on the members of a model from a
+/// temperature field, relative to the --reference temperature.
+let addTemperaturesCommand (options: CliOptions) =
+  match options.InputFile, options.Temperatures with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, None ->
+    showError "No temperatures specified. Use e.g. --temperatures field.csv"
+    1
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | _, Some field when not (File.Exists field) ->
+    showError $"Temperature field not found: {field}"
+    1
+  | Some file, Some field ->
+    let heated =
+      loadModel options file
+      |> Result.bind (fun model ->
+        let case = Option.defaultValue "Temperature" options.Case
+
+        Temperatures.read field
+        |> Result.bind (fun readings ->
+          Temperatures.apply readings options.Reference case model)
+        |> Result.mapError TemperatureError.getAsString)
+
+    match heated with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Model with thermal loads written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Applies the support reactions of the source model as loads on the target
+/// model, pairing nodes with --map or by position within --tolerance.
+let transferCommand (options: CliOptions) =
+  let missing =
+    [ options.InputFile; options.TargetFile ]
+    |> List.choose id
+    |> List.tryFind (fun f -> f <> Model.StdIn && not (File.Exists f))
+
+  match options.InputFile, options.TargetFile, missing with
+  | None, _, _
+  | _, None, _ ->
+    showError "Specify a source model and a target model"
+    1
+  | _, _, Some file ->
+    showError $"Model file not found: {file}"
+    1
+  | Some source, Some target, None ->
+    let pairs =
+      options.Pairs
+      |> List.fold
+        (fun acc text ->
+          match acc, Transfer.tryParsePair text with
+          | Ok ps, Ok p -> Ok(ps @ [ p ])
+          | Error e, _
+          | _, Error e -> Error e)
+        (Ok [])
+      |> Result.mapError TransferError.getAsString
+
+    let transferred =
+      loadModel options source
+      |> Result.bind (fun s ->
+        loadModel options target |> Result.map (fun t -> s, t))
+      |> Result.bind (fun (s, t) ->
+        match pairs, linearSolver options with
+        | Error e, _
+        | _, Error e -> Error e
+        | Ok pairs, Ok solver ->
+          Transfer.apply solver options.Tolerance pairs options.Cases s t
+          |> Result.mapError TransferError.getAsString)
+
+    match transferred with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      match options.OutputFile with
+      | Some outputFile ->
+        saveModel outputFile model
+        showSuccess $"Loaded target model written to {outputFile}"
+      | None -> printfn "%s" (Model.serialize Json model)
+
+      0
+
+/// Reads a template's numeric parameters from --set onto its defaults.
+let private templateOptions
+  (parameters: (string * ('T -> float -> 'T)) list)
+  (defaults: 'T)
+  (settings: Map<string, string>)
+  : Result<'T, string> =
+  let culture = Globalization.CultureInfo.InvariantCulture
+  let styles = Globalization.NumberStyles.Float
+  let known = parameters |> List.map fst |> set
+
+  let number (options: Result<'T, string>) (name, apply) =
+    options
+    |> Result.bind (fun o ->
+      match settings.TryFind name with
+      | None -> Ok o
+      | Some text ->
+        match Double.TryParse(text, styles, culture) with
+        | true, x -> Ok(apply o x)
+        | _ -> Error $"Invalid --set {name}='{text}', expected a number")
+
+  match settings |> Map.tryFindKey (fun k _ -> not (known.Contains k)) with
+  | Some name -> Error $"Unknown template parameter '{name}'"
+  | None -> List.fold number (Ok defaults) parameters
+
+/// Reads cable-stayed bridge dimensions from --set, e.g. span=250.
+let cableStayedOptions
+  (settings: Map<string, string>)
+  : Result<CableStayedOptions, string> =
+  templateOptions
+    [ "span", (fun (o: CableStayedOptions) x -> { o with Span = x })
+      "height", (fun o x -> { o with PylonHeight = x })
+      "cables", (fun o x -> { o with CablesPerSide = int x })
+      "pretension", (fun o x -> { o with Pretension = x })
+      "load", (fun o x -> { o with LiveLoad = x }) ]
+    Examples.defaultCableStayed
+    settings
+
+/// Reads truss or frame dimensions from --set, e.g. width=12.
+let private bayOptions (defaults: BayOptions) settings =
+  templateOptions
+    [ "width", (fun (o: BayOptions) x -> { o with Width = x })
+      "height", (fun o x -> { o with Height = x })
+      "load", (fun o x -> { o with Load = x }) ]
+    defaults
+    settings
+
+/// Generates a model from --template, writing it to --output, as YAML for a
+/// .yaml or .yml file, or to stdout.
+let createCommand (options: CliOptions) =
+  match options.Template with
+  | None ->
+    showError "No template specified. Use --template <name>"
+    1
+  | Some name ->
+    let generate (build: 'T -> Result<Model, ExampleError>) parsed =
+      parsed |> Result.bind (build >> Result.mapError ExampleError.getAsString)
+
+    let model =
+      parseSettings options.Settings
+      |> Result.bind (fun settings ->
+        match name with
+        | "beam" ->
+          templateOptions
+            [ "span", (fun (o: BeamOptions) x -> { o with Span = x })
+              "load", (fun o x -> { o with Load = x }) ]
+            Examples.defaultBeam
+            settings
+          |> generate Examples.beam
+        | "truss" ->
+          bayOptions Examples.defaultTruss settings
+          |> generate Examples.truss
+        | "frame" ->
+          bayOptions Examples.defaultFrame settings
+          |> generate Examples.frame
+        | "cable-stayed" ->
+          cableStayedOptions settings |> generate Examples.cableStayed
+        | _ ->
+          let available =
+            String.Join(", ", templates |> List.map (fun t -> t.Name))
+
+          Error $"Template '{name}' not found. Available: {available}")
+
+    if options.Verbose then
+      printfn "Creating model from template: %s" name
+
+    match model, options.OutputFile with
+    | Error msg, _ ->
+      showError msg
+      1
+    | Ok m, Some outputFile ->
+      saveModel outputFile m
+      printfn "Model created: %s" outputFile
+      0
+    | Ok m, None ->
+      printfn "%s" (Model.serialize Json m)
+      0
+
+let templatesCommand (options: CliOptions) =
+  try
+    match options.Format with
+    | "json" ->
+      let json = serialize templates
+      let panel = Panel(json)
+      panel.Header <- PanelHeader(" Available Templates ")
+      panel.Border <- BoxBorder.Rounded
+      panel.BorderStyle <- Style.Parse("green")
+      AnsiConsole.Write(panel)
+    | _ ->
+      let table = Table()
+      table.AddColumn("Template") |> ignore
+      table.AddColumn("Description") |> ignore
+      table.AddColumn("Parameters") |> ignore
+      table.Border <- TableBorder.Rounded
+      table.BorderStyle <- Style.Parse("blue")
+      table.Title <- TableTitle("Available Templates")
+
+      for template in templates do
+        let parameters = String.Join(", ", template.Parameters)
+
+        table.AddRow(
+          $"[green]{template.Name}[/]",
+          template.Description,
+          $"[dim]{parameters}[/]"
+        )
+        |> ignore
+
+      AnsiConsole.Write(table)
+
+    0
+  with ex ->
+    showError $"Error listing templates: {ex.Message}"
+    1
+
+/// Expands a file pattern such as models/*.json into sorted paths.
+let private expandPattern (pattern: string) : string list =
+  let directory =
+    match Path.GetDirectoryName pattern with
+    | null
+    | "" -> "."
+    | d -> d
+
+  if Directory.Exists directory then
+    Directory.GetFiles(directory, Path.GetFileName pattern)
+    |> Array.sort
+    |> Array.toList
+  else
+    []
+
+/// Analyses every model matching a pattern, streaming one result per model
+/// to --output (.jsonl or .csv) or stdout as each completes.
+let batchAnalyzeCommand (options: CliOptions) =
+  match options.InputFile |> Option.map expandPattern with
+  | None ->
+    showError "No model pattern specified, e.g. 'models/*.json'"
+    1
+  | Some [] ->
+    showError $"No models match '{options.InputFile.Value}'"
+    1
+  | Some files ->
+    let format =
+      match options.OutputFile with
+      | None -> Ok None
+      | Some path ->
+        match StreamFormat.fromPath path with
+        | Some f -> Ok(Some(f, path))
+        | None -> Error $"Unsupported batch output '{path}'; use .jsonl or .csv"
+
+    match format with
+    | Error msg ->
+      showError msg
+      1
+    | Ok target ->
+      let stream =
+        match target with
+        | Some(f, path) -> ResultStream.create f path
+        | None -> ResultStream.ofStream JsonLines (Console.OpenStandardOutput())
+
+      let analyse file =
+        match loadModel options file |> Result.bind (analyzeModel options) with
+        | Ok r ->
+          { File = file
+            Status = r.Status
+            ModelName = Some r.ModelName
+            Units = Some r.Units
+            MaxDisplacement = r.MaxDisplacement
+            MaxStress = r.MaxStress
+            Errors = r.Errors }
+        | Error msg ->
+          { File = file
+            Status = "Failed"
+            ModelName = None
+            Units = None
+            MaxDisplacement = None
+            MaxStress = None
+            Errors = [| msg |] }
+
+      let failures =
+        try
+          files
+          |> List.sumBy (fun file ->
+            let result = analyse file
+
+            ResultStream.write stream result
+
+            if options.Progress then
+              showInfo $"{result.Status}: {file}"
+
+            if result.Status = "Failed" then 1 else 0)
+        finally
+          ResultStream.close stream
+
+      match target with
+      | Some(_, path) ->
+        let succeeded = files.Length - failures
+        showSuccess $"{succeeded} of {files.Length} models analysed"
+        showSuccess $"Results written to {path}"
+      | None -> ()
+
+      if failures = 0 then 0 else 1
+
+/// Opens a results file, reading its records in the --to units if given.
+let private openResults
+  (options: CliOptions)
+  (file: string)
+  : Result<ResultFile, string> =
+  let target =
+    match options.TargetUnits with
+    | None -> Ok None
+    | Some units ->
+      UnitSystem.tryFind units
+      |> Result.map Some
+      |> Result.mapError ConversionError.getAsString
+
+  target
+  |> Result.bind (fun target ->
+    ResultFile.openFile file
+    |> Result.mapError ResultFileError.getAsString
+    |> Result.map (fun f ->
+      match target with
+      | Some units -> ResultFile.convertTo units f
+      | None -> f))
+
+/// Lists one block of a results file, filtered with --filter and paged
+/// with --offset and --limit, in the --to units if given.
+let resultsCommand (options: CliOptions) =
+  let filters =
+    options.Filters
+    |> List.map (fun text -> text, ResultFilter.tryParse text)
+
+  match options.InputFile, filters |> List.tryFind (snd >> Option.isNone) with
+  | None, _ ->
+    showError "No results file specified"
+    1
+  | _, Some(text, _) ->
+    showError $"Invalid filter '{text}'; expected e.g. 'uy<-0.01'"
+    1
+  | Some file, None ->
+    let filters = filters |> List.choose snd
+
+    match openResults options file with
+    | Error msg ->
+      showError msg
+      1
+    | Ok results ->
+      try
+        match ResultFile.select results options.Record options.Block [] with
+        | Error e ->
+          showError (ResultFileError.getAsString e)
+          1
+        | Ok entries ->
+          let components (entry: JsonNode) =
+            match entry with
+            | :? JsonObject as o ->
+              o
+              |> Seq.choose (fun kv ->
+                match kv.Value with
+                | :? JsonValue as v when
+                  v.GetValueKind() = JsonValueKind.Number
+                  ->
+                  Some(kv.Key, v.GetValue<float>())
+                | _ -> None)
+              |> Map.ofSeq
+            | _ -> Map.empty
+
+          let matched =
+            entries
+            |> Map.toList
+            |> List.filter (fun (_, entry) ->
+              filters |> List.forall (fun f -> ResultFilter.matches f entry))
+
+          let page =
+            matched
+            |> List.skip (min (max options.Offset 0) matched.Length)
+            |> fun rows ->
+                match options.Limit with
+                | Some n -> List.truncate (max n 0) rows
+                | None -> rows
+
+          let listing =
+            { Block = options.Block
+              Record = options.Record
+              Matched = matched.Length
+              Offset = options.Offset
+              Rows =
+                page
+                |> List.map (fun (id, entry) ->
+                  { Id = id
+                    Components = components entry })
+                |> List.toArray }
+
+          match options.Format with
+          | "json" -> printfn "%s" (serialize listing)
+          | _ ->
+            let columns =
+              listing.Rows
+              |> Seq.collect (fun r -> r.Components |> Map.keys)
+              |> Seq.distinct
+              |> Seq.toList
+
+            let table = Table()
+            table.AddColumn("ID") |> ignore
+
+            for c in columns do
+              table.AddColumn(c) |> ignore
+
+            table.Border <- TableBorder.Rounded
+            table.BorderStyle <- Style.Parse("blue")
+            table.Title <- TableTitle($"{listing.Block} ({listing.Record})")
+
+            for row in listing.Rows do
+              let cells =
+                columns
+                |> List.map (fun c ->
+                  match Map.tryFind c row.Components with
+                  | Some x -> x.ToString("G6", CultureInfo.InvariantCulture)
+                  | None -> "")
+
+              table.AddRow(Array.ofList ($"[cyan]{row.Id}[/]" :: cells))
+              |> ignore
+
+            AnsiConsole.Write(table)
+            let first = if page.IsEmpty then 0 else listing.Offset + 1
+            let last = listing.Offset + page.Length
+            showInfo $"Showing {first}-{last} of {listing.Matched} entries"
+
+          0
+      finally
+        ResultFile.close results
+
+/// Periods of the response spectra reported by gz spectra.
+let private spectrumPeriods = Frequency.periods 50 0.05 5.0
+
+/// Reads the time and the acceleration of selected nodes along one
+/// direction at each step of a time-history results file.
+let private accelerationHistory
+  (results: ResultFile)
+  (nodes: string list)
+  (dof: string)
+  : Result<float array * Map<string, float array>, string> =
+  let number (node: JsonNode) =
+    match node with
+    | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+      Some(v.GetValue<float>())
+    | _ -> None
+
+  let steps =
+    [ for i in 0 .. ResultFile.count results - 1 ->
+        ResultFile.record results i
+        |> Result.mapError ResultFileError.getAsString
+        |> Result.bind (fun o ->
+          let entries =
+            match o["accelerations"] with
+            | :? JsonObject as entries -> entries
+            | _ -> JsonObject()
+
+          let at (node: string) =
+            match entries[node] with
+            | :? JsonObject as dofs ->
+              dofs[dof] |> Option.ofObj |> Option.bind number
+            | _ -> None
+
+          match o["time"] |> Option.ofObj |> Option.bind number with
+          | None -> Error $"Record {i} has no time; expected a time history"
+          | Some t ->
+            let wanted =
+              if nodes.IsEmpty then
+                entries |> Seq.map (fun kv -> kv.Key) |> List.ofSeq
+              else
+                nodes
+
+            let values =
+              wanted |> List.map (fun n -> n, defaultArg (at n) 0.0)
+
+            Ok(t, values)) ]
+
+  let failed =
+    steps
+    |> List.tryPick (function
+      | Error e -> Some e
+      | Ok _ -> None)
+
+  match failed with
+  | Some e -> Error e
+  | None ->
+    let steps = steps |> List.choose Result.toOption
+    let times = steps |> List.map fst |> Array.ofList
+
+    let histories =
+      steps
+      |> List.collect snd
+      |> List.groupBy fst
+      |> List.map (fun (node, xs) -> node, xs |> List.map snd |> Array.ofList)
+      |> Map.ofList
+
+    match nodes |> List.tryFind (fun n -> not (histories.ContainsKey n)) with
+    | Some node -> Error $"Node '{node}' has no accelerations in the results"
+    | None -> Ok(times, histories)
+
+/// Reports the Fourier amplitude and response spectra of the accelerations
+/// of --node nodes along --direction in a time-history results file.
+let spectraCommand (options: CliOptions) =
+  let ratio = options.DampingRatio
+
+  let reports file =
+    direction options
+    |> Result.bind (fun dof ->
+      openResults options file
+      |> Result.bind (fun results ->
+        try
+          accelerationHistory results options.Nodes (Dof.getAsString dof)
+        finally
+          ResultFile.close results)
+      |> Result.bind (fun (times, histories) ->
+        let dt = if times.Length > 1 then times[1] - times[0] else 0.0
+
+        let uniform =
+          times
+          |> Array.pairwise
+          |> Array.forall (fun (a, b) -> abs (b - a - dt) <= 1e-6 * dt)
+
+        if not uniform then
+          Error "Time steps of the history must be uniform"
+        else
+          histories
+          |> Map.toList
+          |> List.map (fun (node, a) ->
+            Frequency.amplitudes dt a
+            |> Result.bind (fun fourier ->
+              a
+              |> Frequency.responseSpectrum ratio dt spectrumPeriods
+              |> Result.map (fun s -> fourier, s))
+            |> Result.mapError FrequencyError.getAsString
+            |> Result.map (fun (fourier, s) ->
+              { Node = node
+                Direction = Dof.getAsString dof
+                Steps = a.Length
+                TimeStep = dt
+                PeakAcceleration = a |> Array.map abs |> Array.max
+                DominantFrequency =
+                  Frequency.dominant fourier
+                  |> Option.map (fun c -> c.Frequency)
+                DampingRatio = ratio
+                Fourier = fourier
+                Spectrum =
+                  List.map2
+                    (fun t x -> { Period = t; Acceleration = x })
+                    s.Periods
+                    s.Accelerations
+                  |> Array.ofList }))
+          |> List.fold
+            (fun acc r ->
+              match acc, r with
+              | Ok xs, Ok x -> Ok(xs @ [ x ])
+              | Error e, _
+              | _, Error e -> Error e)
+            (Ok [])))
+
+  match options.InputFile with
+  | None ->
+    showError "No results file specified"
+    1
+  | Some file when not (File.Exists file) ->
+    showError $"Results file not found: {file}"
+    1
+  | Some file ->
+    match reports file with
+    | Error msg ->
+      showError msg
+      1
+    | Ok reports ->
+      let reports = Array.ofList reports
+
+      match options.OutputFile, options.Format with
+      | Some path, format -> outputToFile format path reports
+      | None, "json" -> printfn "%s" (serialize reports)
+      | None, _ ->
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+        table.Title <- TableTitle($"gz spectra ({ratio:P0} damping)")
+
+        for column in [ "Node"; "Peak"; "Dominant"; "Peak Sa"; "At" ] do
+          table.AddColumn(column) |> ignore
+
+        for r in reports do
+          let dominant =
+            r.DominantFrequency
+            |> Option.map (fun f -> $"{f:F3} Hz")
+            |> Option.defaultValue "-"
+
+          let top =
+            r.Spectrum |> Array.sortByDescending (fun p -> p.Acceleration)
+
+          let sa, at =
+            match Array.tryHead top with
+            | Some p -> $"{p.Acceleration:G4}", $"T = {p.Period:F3} s"
+            | None -> "-", "-"
+
+          table.AddRow(
+            $"[cyan]{r.Node} {r.Direction}[/]",
+            $"{r.PeakAcceleration:G4}",
+            dominant,
+            sa,
+            at
+          )
+          |> ignore
+
+        AnsiConsole.Write(table)
+        showInfo "Use --format json for the full Fourier and response spectra"
+
+      0
+
+/// Prints the entries of a ledger with a sparkline per metric.
+let private showTrend (format: string) (entries: LedgerEntry list) =
+  match format with
+  | "json" -> printfn "%s" (serialize (Array.ofList entries))
+  | _ ->
+    let number (x: float option) =
+      x
+      |> Option.map (fun x -> x.ToString("G4", CultureInfo.InvariantCulture))
+      |> Option.defaultValue "-"
+
+    let metrics: (string * (LedgerEntry -> float option)) list =
+      [ "Mass", (fun e -> e.Mass)
+        "Max Displacement", (fun e -> e.MaxDisplacement)
+        "Max Utilisation", (fun e -> e.MaxUtilisation)
+        "Frequency", (fun e -> e.Frequency) ]
+
+    let table = Table()
+    table.Border <- TableBorder.Rounded
+    table.BorderStyle <- Style.Parse("blue")
+    table.Title <- TableTitle("Design History")
+
+    for column in [ "#"; "Recorded"; "Model" ] @ List.map fst metrics do
+      table.AddColumn(column) |> ignore
+
+    entries
+    |> List.iteri (fun i e ->
+      let recorded = e.Timestamp.ToString("yyyy-MM-dd HH:mm")
+      let values = metrics |> List.map (fun (_, f) -> number (f e))
+
+      table.AddRow(Array.ofList ($"{i + 1}" :: recorded :: e.Model :: values))
+      |> ignore)
+
+    AnsiConsole.Write(table)
+
+    let trend = Grid()
+    trend.AddColumn() |> ignore
+    trend.AddColumn() |> ignore
+    trend.AddColumn() |> ignore
+
+    for name, f in metrics do
+      let values = entries |> List.map f
+
+      let change =
+        match values |> List.choose id with
+        | first :: _ :: _ as known when first <> 0.0 ->
+          let last = List.last known
+          let percent = (last - first) / abs first * 100.0
+          let culture = CultureInfo.InvariantCulture
+          let signed = percent.ToString("+0.0;-0.0", culture)
+          $"{number (Some first)} → {number (Some last)} ({signed}%%)"
+        | _ -> ""
+
+      trend.AddRow($"[cyan]{name}[/]", Ledger.sparkline values, change)
+      |> ignore
+
+    AnsiConsole.Write(trend)
+
+/// Records the metrics of an analysis run in the --ledger, then prints the
+/// trend of every run recorded. Without a model, only prints the trend.
+let trackCommand (options: CliOptions) =
+  let ledger = options.Ledger |> Option.defaultValue Ledger.DefaultPath
+
+  let record =
+    match options.InputFile with
+    | None -> Ok()
+    | Some file when file <> Model.StdIn && not (File.Exists file) ->
+      Error $"Model file not found: {file}"
+    | Some file ->
+      loadModel options file
+      |> Result.bind (fun model ->
+        analyzeModel options model
+        |> Result.map (fun r ->
+          { Timestamp = DateTimeOffset.Now
+            Model = model.Info.Name
+            Nodes = model.Nodes.Count
+            Elements = model.Elements.Count
+            Mass = Mass.total model
+            MaxDisplacement = r.MaxDisplacement
+            MaxUtilisation = r.MaxUtilisation
+            Frequency =
+              r.Modes |> Array.tryHead |> Option.map (fun m -> m.Frequency) }))
+      |> Result.map (Ledger.append ledger)
+
+  let entries =
+    record
+    |> Result.bind (fun () ->
+      if File.Exists ledger then
+        Ledger.read ledger |> Result.mapError LedgerError.getAsString
+      else
+        Error $"Ledger not found: {ledger}")
+
+  match entries with
+  | Error msg ->
+    showError msg
+    1
+  | Ok entries ->
+    showTrend options.Format entries
+    0
+
+/// Runs a Starlark script in the engine's own interpreter, passing the
+/// --model file to its model() builtin. Fails if the script does or any
+/// check it makes fails.
+let runCommand (options: CliOptions) =
+  match options.InputFile, options.ModelFile with
+  | None, _ ->
+    showError "No script specified"
+    1
+  | Some script, _ when not (File.Exists script) ->
+    showError $"Script not found: {script}"
+    1
+  | _, Some model when not (File.Exists model) ->
+    showError $"Model file not found: {model}"
+    1
+  | Some script, model ->
+    match model with
+    | Some path ->
+      Environment.SetEnvironmentVariable(
+        Script.ModelVariable,
+        Path.GetFullPath path
+      )
+    | None -> ()
+
+    if options.Verbose then
+      showInfo $"Running script: {script}"
+
+    match Starlark.run (File.ReadAllText script) with
+    | Ok _ -> Script.exitCode ()
+    | Error e ->
+      showError $"{script}: {ScriptError.getAsString e}"
+      1
+
+/// Checks models against their expected results, given a model, an expected
+/// results file or a directory to search for them. With --update, records
+/// the current results of a model as expected instead.
+let testCommand (options: CliOptions) =
+  let check (file: string) =
+    match Golden.check file with
+    | Ok mismatches ->
+      { File = file
+        Passed = mismatches.IsEmpty
+        Mismatches = mismatches |> List.map Golden.describe |> Array.ofList
+        Error = None }
+    | Error e ->
+      { File = file
+        Passed = false
+        Mismatches = [||]
+        Error = Some(GoldenError.getAsString e) }
+
+  match options.InputFile with
+  | None ->
+    showError "No model, expected results or directory specified"
+    1
+  | Some path when options.Update ->
+    let recorded =
+      if File.Exists path then
+        loadModel options path
+        |> Result.bind (fun model ->
+          Golden.analyse model |> Result.mapError GoldenError.getAsString)
+      else
+        Error $"Model file not found: {path}"
+
+    match recorded with
+    | Error msg ->
+      showError msg
+      1
+    | Ok results ->
+      let target = Golden.pathFor path
+      Golden.record (Path.GetFileName path) results |> Golden.write target
+      showSuccess $"Expected results written to [cyan]{target}[/]"
+      0
+  | Some path ->
+    let files =
+      if Directory.Exists path then
+        let pattern = "*" + Golden.Extension
+        Directory.GetFiles(path, pattern, SearchOption.AllDirectories)
+        |> Array.sort
+      elif path.EndsWith Golden.Extension then
+        [| path |]
+      else
+        [| Golden.pathFor path |]
+
+    match files with
+    | [||] ->
+      showError $"No expected results found in {path}"
+      1
+    | files ->
+      let results = files |> Array.map check
+
+      match options.OutputFile, options.Format with
+      | Some file, format -> outputToFile format file results
+      | None, "json" -> printfn "%s" (serialize results)
+      | None, _ ->
+        for r in results do
+          let file = Markup.Escape r.File
+
+          if r.Passed then
+            showSuccess file
+          else
+            showError file
+
+          for line in Array.append r.Mismatches (Option.toArray r.Error) do
+            AnsiConsole.MarkupLine($"    {Markup.Escape line}")
+
+        let passed = results |> Array.filter (fun r -> r.Passed)
+        showInfo $"{passed.Length} of {results.Length} passed"
+
+      if results |> Array.forall (fun r -> r.Passed) then 0 else 1
+
+/// Reads --column sizes, e.g. 0.4x0.4 for every column or n5=0.3x0.6 for
+/// the column at n5, into the size of the column at each node.
+let private columnSizes
+  (columns: string list)
+  : Result<string -> (float * float) option, string> =
+  let size (text: string) =
+    let culture = CultureInfo.InvariantCulture
+    let styles = NumberStyles.Float
+
+    let parse (x: string) =
+      match Double.TryParse(x, styles, culture) with
+      | (true, c) when c >= 0.0 -> Some c
+      | _ -> None
+
+    match text.Split('x', 'X') with
+    | [| a; b |] ->
+      match parse a, parse b with
+      | Some c1, Some c2 -> Some(c1, c2)
+      | _ -> None
+    | _ -> None
+
+  columns
+  |> List.fold
+    (fun acc text ->
+      acc
+      |> Result.bind (fun (all, nodes) ->
+        match text.Split('=', 2) with
+        | [| node; c |] ->
+          match size c with
+          | Some s -> Ok(all, Map.add (node.Trim()) s nodes)
+          | None -> Error $"Invalid column size '{text}'; use e.g. n5=0.3x0.6"
+        | _ ->
+          match size text with
+          | Some s -> Ok(Some s, nodes)
+          | None -> Error $"Invalid column size '{text}'; use e.g. 0.4x0.4"))
+    (Ok(None, Map.empty))
+  |> Result.map (fun (all, nodes) ->
+    fun node -> nodes.TryFind node |> Option.orElse all)
+
+/// Checks the members of a model against the member forces of one
+/// analysis results file, in fire too when given an exposure, and its slabs
+/// for punching at the reactions, read in the units of the model, keeping
+/// each governing load set.
+let private checkResults
+  (model: Model)
+  (columns: string -> (float * float) option)
+  (exposure: FireExposure option)
+  (hash: string)
+  (file: string)
+  : Result<
+      GoverningCheck list
+      * GoverningPunching list
+      * GoverningFire list
+      * string list,
+      string
+     > =
+  try
+    match readResults file with
+    | :? JsonObject as o ->
+      ResultFormat.migrate o
+      |> Result.mapError (fun e ->
+        $"{file} {ResultFormatError.getAsString e}")
+      |> Result.bind (fun o ->
+        UnitSystem.tryFind model.Info.Units
+        |> Result.mapError ConversionError.getAsString
+        |> Result.bind (fun units ->
+          match ResultUnits.convert units o with
+          | Ok o -> Ok(o, true)
+          | Error UnstatedUnits -> Ok(o, false)
+          | Error e -> Error $"{file} {ResultUnitsError.getAsString e}"))
+      |> Result.bind (fun (o, stated) ->
+        match o["memberForces"] with
+        | null -> Error $"{file} holds no analysis results"
+        | block ->
+          let entries = block.Deserialize<MemberForceResult[]>(jsonOptions)
+
+          let reactions =
+            match o["reactions"] with
+            | null -> [||]
+            | block -> block.Deserialize<ReactionResult[]>(jsonOptions)
+
+          Ok(o, stated, entries, reactions))
+      |> Result.map (fun (o, stated, entries, reactions) ->
+
+        let analysed =
+          match o["provenance"] with
+          | :? JsonObject as p -> p["modelHash"] |> Option.ofObj
+          | _ -> None
+
+        // Load sets of the model, for the moments of loads along members,
+        // which the member end forces leave out.
+        let sets =
+          LoadCases.select model None None
+          |> Result.map (List.map (fun set -> set.Name, set) >> Map.ofList)
+          |> Result.defaultValue Map.empty
+
+        let entries =
+          entries
+          |> Array.map (fun x ->
+            let stations =
+              sets.TryFind x.LoadSet
+              |> Option.bind (fun set ->
+                Diagrams.critical model set x.Element x.Forces
+                |> Result.toOption)
+              |> Option.defaultValue []
+
+            x, stations)
+
+        let unknown =
+          entries
+          |> Seq.map (fun (x, _) -> x.LoadSet)
+          |> Seq.filter (sets.ContainsKey >> not)
+          |> Seq.distinct
+          |> List.ofSeq
+
+        let checks =
+          entries
+          |> Seq.choose (fun (x, stations) ->
+            Design.check model x.Element x.Forces stations
+            |> Option.map (fun check ->
+              { Scenario = file
+                LoadSet = x.LoadSet
+                Check = check }))
+          |> Design.govern
+
+        let punching =
+          reactions
+          |> Seq.choose (fun r ->
+            Punching.check model (columns r.Node) r.Node r.Global
+            |> Option.map (fun check ->
+              ({ Scenario = file
+                 LoadSet = r.LoadSet
+                 Check = check }
+              : GoverningPunching)))
+          |> Punching.govern
+
+        let fire =
+          match exposure with
+          | None -> []
+          | Some exposure ->
+            entries
+            |> Seq.choose (fun (x, stations) ->
+              Fire.check model exposure x.Element x.Forces stations
+              |> Option.map (fun check ->
+                ({ Scenario = file
+                   LoadSet = x.LoadSet
+                   Check = check }
+                : GoverningFire)))
+            |> Fire.govern
+
+        let warnings =
+          [ match analysed with
+            | Some h when h.GetValue<string>() <> hash ->
+              $"{file} was analysed from a different model"
+            | _ -> ()
+            if not stated then
+              $"{file} states no units; its forces are taken to be in "
+              + "those of the model"
+            for name in unknown do
+              $"{file} load set '{name}' is not in the model; loads along "
+              + "its members are left out of their checks"
+            if entries.Length = 0 && punching.IsEmpty then
+              $"{file} has no member forces; analyse with the member-forces "
+              + "block saved" ]
+
+        checks, punching, fire, warnings)
+    | _ -> Error $"{file} is not a JSON object"
+  with
+  | :? JsonException as ex -> Error $"{file} is malformed: {ex.Message}"
+  | :? IOException as ex -> Error $"{file} is unreadable: {ex.Message}"
+
+/// Checks members for strength and buckling under the member forces of
+/// analysis results, and in fire with --fire, reporting each member's worst
+/// utilisation. With --batch, the input is a pattern whose files are
+/// checked in parallel.
+let checkCommand (options: CliOptions) =
+  let files =
+    match options.InputFile with
+    | Some pattern when options.Batch -> expandPattern pattern
+    | Some file -> [ file ]
+    | None -> []
+
+  match options.ModelFile, files with
+  | None, _ ->
+    showError "No model specified; use --model"
+    1
+  | _, [] ->
+    let input = defaultArg options.InputFile ""
+    showError $"No results files match '{input}'"
+    1
+  | Some path, files ->
+    let exposure =
+      match options.Fire with
+      | None -> Ok None
+      | Some text ->
+        match FireExposure.tryParse text with
+        | Some e -> Ok(Some e)
+        | None ->
+          Error $"Invalid fire exposure '{text}'; use e.g. R60 or 550C"
+
+    match
+      loadModel options path, columnSizes options.Columns, exposure
+    with
+    | Error msg, _, _ ->
+      showError $"Error reading model: {msg}"
+      1
+    | _, Error msg, _
+    | _, _, Error msg ->
+      showError msg
+      1
+    | Ok model, Ok columns, Ok exposure ->
+      let hash = Provenance.modelHash model
+      let files = Array.ofList files
+      let outcomes = Array.zeroCreate files.Length
+
+      let parallelism =
+        Threading.Tasks.ParallelOptions(
+          MaxDegreeOfParallelism = max 1 options.Workers
+        )
+
+      Threading.Tasks.Parallel.For(
+        0,
+        files.Length,
+        parallelism,
+        fun i ->
+          outcomes[i] <- checkResults model columns exposure hash files[i]
+      )
+      |> ignore
+
+      let checks, punching, fire, warnings =
+        outcomes
+        |> Array.choose Result.toOption
+        |> Array.fold
+          (fun (checks, punching, fire, warnings) (c, p, f, w) ->
+            checks @ c, punching @ p, fire @ f, warnings @ w)
+          ([], [], [], [])
+
+      let warnings =
+        match exposure with
+        | Some _ when fire.IsEmpty && not checks.IsEmpty ->
+          warnings @ [ "No steel members to check in fire" ]
+        | _ -> warnings
+
+      let report =
+        { ModelName = model.Info.Name
+          Files = files
+          Members =
+            Design.govern checks
+            |> List.map (fun g ->
+              { Element = g.Check.Element
+                Utilisation = g.Check.Utilisation
+                Strength = g.Check.Strength
+                Buckling = g.Check.Buckling
+                File = g.Scenario
+                LoadSet = g.LoadSet })
+            |> Array.ofList
+          Punching =
+            Punching.govern punching
+            |> List.map (fun g ->
+              { Node = g.Check.Node
+                Utilisation = g.Check.Utilisation
+                Force = g.Check.Force
+                Stress = g.Check.Stress
+                Resistance = g.Check.Resistance
+                File = g.Scenario
+                LoadSet = g.LoadSet })
+            |> Array.ofList
+          Exposure = exposure |> Option.map FireExposure.getAsString
+          Fire =
+            Fire.govern fire
+            |> List.map (fun g ->
+              { Element = g.Check.Element
+                Utilisation = g.Check.Utilisation
+                Temperature = g.Check.Temperature
+                CriticalTemperature = g.Check.CriticalTemperature
+                File = g.Scenario
+                LoadSet = g.LoadSet })
+            |> Array.ofList
+          Warnings = Array.ofList warnings
+          Errors =
+            outcomes
+            |> Array.choose (function
+              | Error e -> Some e
+              | Ok _ -> None) }
+
+      let failed =
+        report.Members |> Array.filter (fun m -> m.Utilisation > 1.0)
+
+      let punched =
+        report.Punching |> Array.filter (fun p -> p.Utilisation > 1.0)
+
+      let burnt = report.Fire |> Array.filter (fun f -> f.Utilisation > 1.0)
+
+      match options.OutputFile, options.Format with
+      | Some file, format -> outputToFile format file report
+      | None, "json" -> printfn "%s" (serialize report)
+      | None, _ ->
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+
+        for column in
+          [ "Element"; "Utilisation"; "Strength"; "Buckling"; "Governs" ] do
+          table.AddColumn(column) |> ignore
+
+        let ratio (x: float option) =
+          match x with
+          | Some x -> x.ToString("F3", CultureInfo.InvariantCulture)
+          | None -> "-"
+
+        for m in report.Members do
+          let colour = if m.Utilisation > 1.0 then "red" else "green"
+          let governs = Markup.Escape $"{m.LoadSet} in {m.File}"
+
+          table.AddRow(
+            $"[cyan]{m.Element}[/]",
+            $"[{colour}]{ratio (Some m.Utilisation)}[/]",
+            ratio m.Strength,
+            ratio m.Buckling,
+            governs
+          )
+          |> ignore
+
+        AnsiConsole.Write(table)
+
+        if report.Punching.Length > 0 then
+          let punching = Table()
+          punching.Border <- TableBorder.Rounded
+          punching.BorderStyle <- Style.Parse("blue")
+
+          for column in
+            [ "Node"; "Utilisation"; "V_Ed"; "v_Ed"; "v_Rd,c"; "Governs" ] do
+            punching.AddColumn(column) |> ignore
+
+          let number (x: float) = x.ToString("G4", CultureInfo.InvariantCulture)
+
+          for p in report.Punching do
+            let colour = if p.Utilisation > 1.0 then "red" else "green"
+            let governs = Markup.Escape $"{p.LoadSet} in {p.File}"
+
+            punching.AddRow(
+              $"[cyan]{p.Node}[/]",
+              $"[{colour}]{ratio (Some p.Utilisation)}[/]",
+              number p.Force,
+              number p.Stress,
+              number p.Resistance,
+              governs
+            )
+            |> ignore
+
+          AnsiConsole.Write(punching)
+
+        if report.Fire.Length > 0 then
+          let fire = Table()
+          fire.Border <- TableBorder.Rounded
+          fire.BorderStyle <- Style.Parse("blue")
+
+          for column in
+            [ "Element"; "Utilisation"; "Steel °C"; "Critical °C"; "Governs" ] do
+            fire.AddColumn(column) |> ignore
+
+          let celsius (x: float) =
+            x.ToString("F0", CultureInfo.InvariantCulture)
+
+          for f in report.Fire do
+            let colour = if f.Utilisation > 1.0 then "red" else "green"
+            let governs = Markup.Escape $"{f.LoadSet} in {f.File}"
+
+            fire.AddRow(
+              $"[cyan]{f.Element}[/]",
+              $"[{colour}]{ratio (Some f.Utilisation)}[/]",
+              celsius f.Temperature,
+              f.CriticalTemperature
+              |> Option.map celsius
+              |> Option.defaultValue "-",
+              governs
+            )
+            |> ignore
+
+          AnsiConsole.Write(fire)
+
+        for w in report.Warnings do
+          showWarning (Markup.Escape w)
+
+        for e in report.Errors do
+          showError (Markup.Escape e)
+
+        let passed = report.Members.Length - failed.Length
+        let count = report.Members.Length
+        showInfo $"{passed} of {count} members pass in {files.Length} file(s)"
+
+        if report.Punching.Length > 0 then
+          let supports = report.Punching.Length
+          let passed = supports - punched.Length
+          showInfo $"{passed} of {supports} supports pass punching"
+
+        match report.Exposure with
+        | Some exposure when report.Fire.Length > 0 ->
+          let count = report.Fire.Length
+          let passed = count - burnt.Length
+          showInfo $"{passed} of {count} steel members pass in fire {exposure}"
+        | _ -> ()
+
+      let clean = failed.Length = 0 && punched.Length = 0 && burnt.Length = 0
+
+      if clean && report.Errors.Length = 0 then 0 else 1
+
+/// Reads the strain energy of each element by load set from the energies
+/// block of an analysis results file, in the units of the model.
+let private readEnergies
+  (model: Model)
+  (file: string)
+  : Result<(string * Map<string, float>) list * string list, string> =
+  try
+    match readResults file with
+    | :? JsonObject as o ->
+      ResultFormat.migrate o
+      |> Result.mapError (fun e ->
+        $"{file} {ResultFormatError.getAsString e}")
+      |> Result.bind (fun o ->
+        UnitSystem.tryFind model.Info.Units
+        |> Result.mapError ConversionError.getAsString
+        |> Result.bind (fun units ->
+          match ResultUnits.convert units o with
+          | Ok o -> Ok(o, true)
+          | Error UnstatedUnits -> Ok(o, false)
+          | Error e -> Error $"{file} {ResultUnitsError.getAsString e}"))
+      |> Result.map (fun (o, stated) ->
+        let entries =
+          match o["energies"] with
+          | null -> [||]
+          | block -> block.Deserialize<EnergyResult[]>(jsonOptions)
+
+        let analysed =
+          match o["provenance"] with
+          | :? JsonObject as p -> p["modelHash"] |> Option.ofObj
+          | _ -> None
+
+        let warnings =
+          [ match analysed with
+            | Some h when h.GetValue<string>() <> Provenance.modelHash model ->
+              $"{file} was analysed from a different model"
+            | _ -> ()
+            if not stated then
+              $"{file} states no units; its energies are taken to be in "
+              + "those of the model"
+            if entries.Length = 0 then
+              $"{file} has no energies; analyse with the energies block saved" ]
+
+        [ for e in entries -> e.LoadSet, e.Elements ], warnings)
+    | _ -> Error $"{file} is not a JSON object"
+  with
+  | :? JsonException as ex -> Error $"{file} is malformed: {ex.Message}"
+  | :? IOException as ex -> Error $"{file} is unreadable: {ex.Message}"
+
+/// Ranks the elements of --model by strain energy density under the
+/// energies of an analysis results file, densest first, to find members
+/// to redesign. --limit keeps the densest only.
+let rankCommand (options: CliOptions) =
+  match options.ModelFile, options.InputFile with
+  | None, _ ->
+    showError "No model specified; use --model"
+    1
+  | _, None ->
+    showError "No results file specified"
+    1
+  | Some path, Some file ->
+    match loadModel options path with
+    | Error msg ->
+      showError $"Error reading model: {msg}"
+      1
+    | Ok model ->
+      match readEnergies model file with
+      | Error msg ->
+        showError msg
+        1
+      | Ok(energies, warnings) ->
+        let ranked = Energy.rank model energies
+
+        let kept =
+          match options.Limit with
+          | Some n -> List.truncate n ranked
+          | None -> ranked
+
+        let report =
+          { ModelName = model.Info.Name
+            File = file
+            Elements = Array.ofList kept
+            Warnings = Array.ofList warnings }
+
+        match options.OutputFile, options.Format with
+        | Some output, format -> outputToFile format output report
+        | None, "json" -> printfn "%s" (serialize report)
+        | None, _ ->
+          let table = Table()
+          table.Border <- TableBorder.Rounded
+          table.BorderStyle <- Style.Parse("blue")
+
+          for column in
+            [ "Rank"; "Element"; "Density"; "Relative"; "Energy"; "Governs" ] do
+            table.AddColumn(column) |> ignore
+
+          let number (x: float) = x.ToString("G4", CultureInfo.InvariantCulture)
+
+          for i, d in List.indexed kept do
+            table.AddRow(
+              string (i + 1),
+              $"[cyan]{Markup.Escape d.Element}[/]",
+              number d.Density,
+              d.Relative.ToString("F2", CultureInfo.InvariantCulture),
+              number d.Energy,
+              Markup.Escape d.LoadSet
+            )
+            |> ignore
+
+          AnsiConsole.Write(table)
+
+          for w in report.Warnings do
+            showWarning (Markup.Escape w)
+
+          showInfo
+            $"{kept.Length} of {ranked.Length} elements by strain energy \
+              density; relative to the structure's average under each set"
+
+        0
+
+/// Cells of a row of the gz calibrate table: the measurement, its measured
+/// and predicted values and error, and the tuned ones if it was tuned.
+let calibrationCells (row: CalibrationRow) : string list =
+  let invariant = CultureInfo.InvariantCulture
+  let number (x: float) = x.ToString("G5", invariant)
+  let percent (x: float) = (100.0 * x).ToString("F1", invariant) + "%"
+
+  let measurement =
+    match row.Set, row.Node, row.Dof, row.Mode with
+    | Some set, Some node, Some dof, _ -> $"{set}: {node} {dof}"
+    | _, _, _, Some mode -> $"f{mode} (Hz)"
+    | _ -> row.Quantity
+
+  [ yield $"[cyan]{Markup.Escape measurement}[/]"
+    yield number row.Measured
+    yield number row.Predicted
+    yield percent row.Error
+    match row.Tuned, row.TunedError with
+    | Some x, Some e ->
+      yield number x
+      yield percent e
+    | _ -> () ]
+
+/// Compares the predictions of a model with --measured displacements and
+/// frequencies, e.g. from monitoring sensors, and with --tune fits the
+/// named model parameters to them by least squares.
+let calibrateCommand (options: CliOptions) =
+  match options.InputFile, options.Measured with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, None ->
+    showError "No measurements specified. Use e.g. --measured sensors.csv"
+    1
+  | Some file, Some measured ->
+    let invariant = CultureInfo.InvariantCulture
+
+    // Re-reads the model with the tuned values as --set overrides.
+    let build (values: Map<string, float>) =
+      let settings =
+        [ for KeyValue(name, x) in values ->
+            name + "=" + x.ToString("R", invariant) ]
+
+      loadModel { options with Settings = options.Settings @ settings } file
+
+    let calibration =
+      loadModel options file
+      |> Result.bind (fun model ->
+        massMatrix options
+        |> Result.bind (fun mass ->
+          Calibration.read measured
+          |> Result.bind (fun measurements ->
+            let before = Calibration.compare mass model measurements
+
+            match options.Tune with
+            | [] -> Result.map (fun b -> b, None) before
+            | names ->
+              Calibration.tune mass build names model measurements
+              |> Result.map (fun r -> r.Before, Some r))
+          |> Result.mapError CalibrationError.getAsString
+          |> Result.map (fun (before, tuned) -> model, before, tuned)))
+
+    match calibration with
+    | Error msg ->
+      showError msg
+      1
+    | Ok(model, before, tuned) ->
+      let after =
+        match tuned with
+        | Some r -> List.map Some r.After
+        | None -> List.map (fun _ -> None) before
+
+      let rows =
+        List.map2
+          (fun (c: CalibrationComparison) (t: CalibrationComparison option) ->
+            let row =
+              { Quantity = "frequency"
+                Set = None
+                Node = None
+                Dof = None
+                Mode = None
+                Measured = c.Measured
+                Predicted = c.Predicted
+                Error = c.Error
+                Tuned = t |> Option.map (fun t -> t.Predicted)
+                TunedError = t |> Option.map (fun t -> t.Error) }
+
+            match c.Measurement with
+            | MeasuredDisplacement(set, node, dof, _) ->
+              { row with
+                  Quantity = "displacement"
+                  Set = Some set
+                  Node = Some node
+                  Dof = Some(Dof.getAsString dof) }
+            | MeasuredFrequency(mode, _) -> { row with Mode = Some mode })
+          before
+          after
+
+      let parameters =
+        match tuned with
+        | Some r ->
+          [| for KeyValue(name, x) in r.Tuned ->
+               { Name = name
+                 Initial = r.Initial[name]
+                 Tuned = x } |]
+        | None -> [||]
+
+      let report =
+        { ModelName = model.Info.Name
+          File = measured
+          Measurements = Array.ofList rows
+          Rms = Calibration.rms before
+          TunedRms = tuned |> Option.map (fun r -> Calibration.rms r.After)
+          Parameters = parameters
+          Iterations = tuned |> Option.map (fun r -> r.Iterations)
+          Converged = tuned |> Option.map (fun r -> r.Converged) }
+
+      match options.OutputFile, options.Format with
+      | Some output, format -> outputToFile format output report
+      | None, "json" -> printfn "%s" (serialize report)
+      | None, _ ->
+        let number (x: float) = x.ToString("G5", invariant)
+        let percent (x: float) = (100.0 * x).ToString("F1", invariant) + "%"
+
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+
+        for column in [ "Measurement"; "Measured"; "Predicted"; "Error" ] do
+          table.AddColumn(column) |> ignore
+
+        if tuned.IsSome then
+          for column in [ "Tuned"; "Error" ] do
+            table.AddColumn(column) |> ignore
+
+        for row in rows do
+          table.AddRow(Array.ofList (calibrationCells row)) |> ignore
+
+        AnsiConsole.Write(table)
+
+        match tuned with
+        | None ->
+          showInfo $"RMS error {percent report.Rms}; use --tune to fit \
+            model parameters"
+        | Some r ->
+          let fitted = Table()
+          fitted.Border <- TableBorder.Rounded
+          fitted.BorderStyle <- Style.Parse("blue")
+
+          for column in [ "Parameter"; "Initial"; "Tuned"; "Change" ] do
+            fitted.AddColumn(column) |> ignore
+
+          for p in parameters do
+            fitted.AddRow(
+              $"[cyan]{Markup.Escape p.Name}[/]",
+              number p.Initial,
+              number p.Tuned,
+              percent (p.Tuned / p.Initial - 1.0)
+            )
+            |> ignore
+
+          AnsiConsole.Write(fitted)
+
+          let settings =
+            parameters
+            |> Array.map (fun p -> $"--set {p.Name}={number p.Tuned}")
+            |> String.concat " "
+
+          showInfo
+            $"RMS error {percent report.Rms} to \
+              {percent (Calibration.rms r.After)} in {r.Iterations} \
+              iterations; analyse with {Markup.Escape settings}"
+
+          if not r.Converged then
+            showWarning "Tuning stopped at the iteration limit"
+
+      0
+
+/// Sizes the members of a model to --max-utilisation and, optionally, a
+/// --min-frequency and --max-deflection, writing the resized model to
+/// --output.
+let optimizeCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    showError "No model file specified"
+    1
+  | Some file ->
+    let targets: SizingTargets =
+      { MaxUtilisation = options.MaxUtilisation
+        MinFrequency = options.MinFrequency
+        MaxDeflection = options.MaxDeflection }
+
+    let sizing =
+      loadModel options file
+      |> Result.bind (fun model ->
+        massMatrix options
+        |> Result.bind (fun mass ->
+          Sizing.size mass targets model
+          |> Result.mapError SizingError.getAsString))
+      |> Result.bind (fun r ->
+        match options.OutputFile with
+        | Some output ->
+          Model.save output r.Model
+          |> Result.mapError ModelError.getAsString
+          |> Result.map (fun () -> r)
+        | None -> Ok r)
+
+    match sizing with
+    | Error msg ->
+      showError msg
+      1
+    | Ok r ->
+      let report: SizingReport =
+        { ModelName = r.Model.Info.Name
+          MaxUtilisation = targets.MaxUtilisation
+          MinFrequency = targets.MinFrequency
+          MaxDeflection = targets.MaxDeflection
+          Members = Array.ofList r.Members
+          Utilisation = r.Utilisation
+          Frequency = r.Frequency
+          Deflection = r.Deflection
+          InitialMass = r.InitialMass
+          Mass = r.Mass
+          Iterations = r.Iterations
+          Output = options.OutputFile }
+
+      match options.Format with
+      | "json" -> printfn "%s" (serialize report)
+      | _ ->
+        let invariant = CultureInfo.InvariantCulture
+        let number (x: float) = x.ToString("G4", invariant)
+
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+        table.Title <- TableTitle("Sized Members")
+
+        for column in [ "Member"; "Area Factor"; "Utilisation" ] do
+          table.AddColumn(column) |> ignore
+
+        for m in r.Members do
+          let utilisation =
+            m.Utilisation |> Option.map number |> Option.defaultValue "-"
+
+          table.AddRow(
+            $"[cyan]{Markup.Escape m.Element}[/]",
+            number m.Scale,
+            utilisation
+          )
+          |> ignore
+
+        AnsiConsole.Write(table)
+
+        let frequency =
+          r.Frequency
+          |> Option.map (fun f -> $", f1 {number f} Hz")
+          |> Option.defaultValue ""
+
+        let mass =
+          match r.InitialMass, r.Mass with
+          | Some before, Some after ->
+            $"; mass {number before} to {number after} kg"
+          | _ -> ""
+
+        showInfo
+          $"Utilisation {number r.Utilisation}, deflection \
+            {number r.Deflection}{frequency}{mass} in {r.Iterations} \
+            iterations"
+
+        match options.OutputFile with
+        | Some output -> showInfo $"Sized model written to {output}"
+        | None -> showInfo "Use --output to write the sized model"
+
+      0
+
+/// Parses --vary, e.g. span=6:9:0.5 for 6 to 9 in steps of 0.5 or
+/// span=6,7.5,9 for listed values, into the parameter and its values.
+let private parseSweep (sweep: string) : Result<string * float list, string> =
+  let culture = CultureInfo.InvariantCulture
+  let invalid = Error $"Invalid --vary '{sweep}', expected e.g. span=6:9:0.5"
+
+  let number (s: string) =
+    match Double.TryParse(s.Trim(), NumberStyles.Float, culture) with
+    | true, x when Double.IsFinite x -> Some x
+    | _ -> None
+
+  match sweep.IndexOf '=' with
+  | i when i > 0 ->
+    let name = sweep.Substring(0, i).Trim()
+    let values = sweep.Substring(i + 1)
+
+    match values.Split ':' |> Array.map number with
+    | [| Some first; Some last; Some step |] when
+      step > 0.0 && last >= first
+      ->
+      // Tolerates rounding in the number of steps.
+      let count = int (floor ((last - first) / step + 1e-9))
+      Ok(name, [ for k in 0..count -> first + float k * step ])
+    | [| _ |] ->
+      let listed = values.Split ',' |> Array.map number
+
+      if Array.forall Option.isSome listed then
+        Ok(name, listed |> Array.choose id |> List.ofArray)
+      else
+        invalid
+    | _ -> invalid
+  | _ -> invalid
+
+/// Computes the natural frequencies of a model at each value of a
+/// parameter given by --vary, tracking each mode by its shape so that
+/// modes whose frequencies cross keep their columns.
+let sweepCommand (options: CliOptions) =
+  match options.InputFile, options.Vary |> Option.map parseSweep with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, None ->
+    showError "No parameter to vary. Use e.g. --vary span=6:9:0.5"
+    1
+  | _, Some(Error msg) ->
+    showError msg
+    1
+  | Some file, Some(Ok(name, values)) ->
+    let culture = CultureInfo.InvariantCulture
+
+    let analyse kind (value: float) =
+      let setting = name + "=" + value.ToString("R", culture)
+
+      loadModel { options with Settings = options.Settings @ [ setting ] } file
+      |> Result.bind (fun model ->
+        Modal.analyse kind options.ModeCount model
+        |> Result.mapError ModalError.getAsString
+        |> Result.map (fun r -> model, r))
+      |> Result.mapError (fun msg -> $"{name} = {value}: {msg}")
+
+    let sweep =
+      massMatrix options
+      |> Result.bind (fun kind ->
+        List.foldBack
+          (fun value acc ->
+            match analyse kind value, acc with
+            | Ok r, Ok rest -> Ok(r :: rest)
+            | Error msg, _
+            | _, Error msg -> Error msg)
+          values
+          (Ok []))
+
+    match sweep with
+    | Error msg ->
+      showError msg
+      1
+    | Ok steps ->
+      let tracks = steps |> List.map snd |> Modal.track
+
+      let report =
+        { ModelName = (fst steps.Head).Info.Name
+          Parameter = name
+          Values = Array.ofList values
+          Modes =
+            [| for t in tracks ->
+                 let entry f =
+                   t.Modes
+                   |> List.map (Option.map f >> Option.toNullable)
+                   |> Array.ofList
+
+                 { Number = t.Number
+                   Frequencies = entry (fst >> Modal.frequency)
+                   Mac = entry snd } |] }
+
+      let number (x: float) = x.ToString("G6", culture)
+
+      let cell (x: Nullable<float>) =
+        if x.HasValue then number x.Value else ""
+
+      match options.OutputFile, options.Format with
+      | Some output, _ when
+        Path.GetExtension(output).ToLowerInvariant() = ".csv"
+        ->
+        let rows =
+          [ yield
+              name :: [ for m in report.Modes -> $"mode {m.Number} (Hz)" ]
+            for i, value in List.indexed values do
+              yield
+                number value
+                :: [ for m in report.Modes -> cell m.Frequencies[i] ] ]
+
+        let lines = rows |> List.map (String.concat ",")
+        File.WriteAllLines(output, lines)
+        showSuccess $"Frequencies written to {Markup.Escape output}"
+      | Some output, format -> outputToFile format output report
+      | None, "json" -> printfn "%s" (serialize report)
+      | None, _ ->
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+        table.AddColumn(Markup.Escape name) |> ignore
+
+        for m in report.Modes do
+          table.AddColumn($"Mode {m.Number} (Hz)") |> ignore
+
+        for i, value in List.indexed values do
+          let cells =
+            [ for m in report.Modes ->
+                let f = cell m.Frequencies[i]
+
+                // Marks modes whose shape changed markedly since last found.
+                match Option.ofNullable m.Mac[i] with
+                | Some c when c < 0.8 -> $"[yellow]{f}[/]"
+                | _ -> f ]
+
+          table.AddRow(Array.ofList (number value :: cells)) |> ignore
+
+        AnsiConsole.Write(table)
+
+        showInfo
+          $"{report.Modes.Length} modes tracked by MAC over {values.Length} \
+            values; blanks are modes outside the lowest {options.ModeCount}"
+
+      0
+
+/// Computes the modes of a model with --modes and --mass, or reads mode
+/// shapes, e.g. from a vibration test, from a .csv file.
+let private modeShapesOf
+  (options: CliOptions)
+  (kind: MassMatrix)
+  (file: string)
+  : Result<ModalResult, string> =
+  if Path.GetExtension(file).ToLowerInvariant() = ".csv" then
+    ModeShapes.read file |> Result.mapError ModeShapeError.getAsString
+  else
+    loadModel options file
+    |> Result.bind (fun model ->
+      Modal.analyse kind options.ModeCount model
+      |> Result.mapError ModalError.getAsString)
+    |> Result.mapError (fun msg -> $"{file}: {msg}")
+
+/// Correlates the mode shapes of a model with those of --against, another
+/// model or test data, by the modal assurance criterion of every pair.
+let macCommand (options: CliOptions) =
+  match options.InputFile, options.Against with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, None ->
+    showError "No shapes to compare. Use e.g. --against test.csv"
+    1
+  | Some file, Some against ->
+    let shapes =
+      massMatrix options
+      |> Result.bind (fun kind ->
+        modeShapesOf options kind file
+        |> Result.bind (fun a ->
+          modeShapesOf options kind against |> Result.map (fun b -> a, b)))
+
+    match shapes with
+    | Error msg ->
+      showError msg
+      1
+    | Ok(a, b) ->
+      let matrix = Modal.macMatrix a b
+
+      let modes (r: ModalResult) =
+        [| for m in r.Modes ->
+             let f = Modal.frequency m
+
+             { Number = m.Number
+               Frequency =
+                 if Double.IsNaN f then Nullable() else Nullable f } |]
+
+      let first, second = modes a, modes b
+
+      let pairs =
+        [| for i, m in Array.indexed first do
+             if second.Length > 0 then
+               let j =
+                 Array.init second.Length id
+                 |> Array.maxBy (fun j -> matrix[i, j])
+
+               let f, g = m.Frequency, second[j].Frequency
+
+               { Mode = m.Number
+                 Match = second[j].Number
+                 Mac = matrix[i, j]
+                 FrequencyError =
+                   if f.HasValue && g.HasValue then
+                     Nullable((g.Value - f.Value) / f.Value)
+                   else
+                     Nullable() } |]
+
+      let report =
+        { First = file
+          Second = against
+          FirstModes = first
+          SecondModes = second
+          Mac =
+            Array.init first.Length (fun i ->
+              Array.init second.Length (fun j -> matrix[i, j]))
+          Pairs = pairs }
+
+      let culture = CultureInfo.InvariantCulture
+      let decimal (x: float) = x.ToString("F2", culture)
+
+      let label (m: MacMode) =
+        if m.Frequency.HasValue then
+          let f = m.Frequency.Value.ToString("G4", culture)
+          $"{m.Number} ({f} Hz)"
+        else
+          string m.Number
+
+      match options.OutputFile, options.Format with
+      | Some output, _ when
+        Path.GetExtension(output).ToLowerInvariant() = ".csv"
+        ->
+        let header =
+          "mode" :: [ for m in second -> string m.Number ] |> String.concat ","
+
+        let rows =
+          [ for i, m in Array.indexed first ->
+              string m.Number
+              :: [ for x in report.Mac[i] -> x.ToString("R", culture) ]
+              |> String.concat "," ]
+
+        File.WriteAllLines(output, header :: rows)
+        showSuccess $"MAC matrix written to {Markup.Escape output}"
+      | Some output, format -> outputToFile format output report
+      | None, "json" -> printfn "%s" (serialize report)
+      | None, _ ->
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+        table.AddColumn("Mode") |> ignore
+
+        for m in second do
+          table.AddColumn(label m) |> ignore
+
+        for i, m in Array.indexed first do
+          let cells =
+            [ for x in report.Mac[i] ->
+                if x >= 0.9 then $"[green]{decimal x}[/]"
+                elif x >= 0.5 then $"[yellow]{decimal x}[/]"
+                else $"[grey]{decimal x}[/]" ]
+
+          table.AddRow(Array.ofList (label m :: cells)) |> ignore
+
+        AnsiConsole.Write(table)
+
+        let correlated = pairs |> Array.filter (fun p -> p.Mac >= 0.9)
+
+        showInfo
+          $"{correlated.Length} of {first.Length} modes of \
+            {Markup.Escape file} match one of {Markup.Escape against} \
+            with a MAC of 0.9 or more"
+
+      0
+
+/// Reads the --type option of a reduction, defaulting to Guyan.
+let reductionMethod (options: CliOptions) : Result<ReductionMethod, string> =
+  match options.AnalysisType with
+  | "static" -> Ok ReductionMethod.Guyan
+  | name ->
+    ReductionMethod.tryParse name
+    |> Option.map Ok
+    |> Option.defaultValue (
+      Error $"Unknown reduction '{name}'. Available: guyan, irs."
+    )
+
+/// Reads master freedoms from --node options, as node, or node:dof for one
+/// freedom.
+let masterDofs
+  (options: CliOptions)
+  : Result<(string * Dof option) list, string> =
+  options.Nodes
+  |> List.map (fun text ->
+    match text.Split(':') with
+    | [| node |] -> Ok(node, None)
+    | [| node; dof |] ->
+      match Dof.tryParse dof with
+      | Some d -> Ok(node, Some d)
+      | None -> Error $"Unknown degree of freedom '{dof}' in '{text}'"
+    | _ -> Error $"Masters are node or node:dof, not '{text}'")
+  |> List.fold
+    (fun acc x ->
+      match acc, x with
+      | Ok xs, Ok x -> Ok(xs @ [ x ])
+      | Error e, _
+      | _, Error e -> Error e)
+    (Ok [])
+
+/// Writes matrices as Matrix Market files: the stiffness to a path ending
+/// .mtx, the mass beside it ending .mass.mtx and the freedoms ending
+/// .dofs.csv. Returns the files written.
+let writeMatrices (path: string) (matrices: SystemMatrices) : string list =
+  let stem = Path.ChangeExtension(path, null)
+  let dofs = stem + ".dofs.csv"
+  File.WriteAllText(path, MatrixExport.toMatrixMarket matrices.Stiffness)
+  File.WriteAllText(dofs, MatrixExport.dofMap matrices.Dofs)
+
+  match matrices.Mass with
+  | Some mass ->
+    let file = stem + ".mass.mtx"
+    File.WriteAllText(file, MatrixExport.toMatrixMarket mass)
+    [ path; file; dofs ]
+  | None -> [ path; dofs ]
+
+let reduceCommand (options: CliOptions) =
+  match options.InputFile with
+  | None ->
+    showError "No model file specified"
+    1
+  | Some file when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some _ when options.Nodes.IsEmpty ->
+    showError "No master freedoms. Use e.g. --node n3:Uy --node n5"
+    1
+  | Some file ->
+    let reduced =
+      reductionMethod options
+      |> Result.bind (fun method ->
+        masterDofs options
+        |> Result.bind (fun masters ->
+          massMatrix options
+          |> Result.bind (fun kind ->
+            loadModel options file
+            |> Result.bind (fun model ->
+              Reduction.reduce method kind masters model
+              |> Result.mapError ReductionError.getAsString
+              |> Result.bind (fun r ->
+                let full =
+                  Modal.analyse kind options.ModeCount model
+                  |> Result.mapError ModalError.getAsString
+
+                let count = min options.ModeCount r.Masters.Length
+
+                Reduction.modes count r
+                |> Result.mapError ModalError.getAsString
+                |> Result.bind (fun modes ->
+                  full |> Result.map (fun full -> model, r, full, modes)))))))
+
+    match reduced with
+    | Error msg ->
+      showError msg
+      1
+    | Ok(model, r, full, modes) ->
+      let rows (a: float[,]) =
+        Array.init (Array2D.length1 a) (fun i ->
+          Array.init (Array2D.length2 a) (fun j -> a[i, j]))
+
+      let report =
+        { ModelName = model.Info.Name
+          Method = ReductionMethod.getAsString r.Method
+          Masters =
+            r.Masters
+            |> Array.map (fun (node, dof) -> $"{node}:{Dof.getAsString dof}")
+          Stiffness = rows r.Stiffness
+          Mass = rows r.Mass
+          Modes =
+            [| for a, b in Seq.zip full.Modes modes.Modes ->
+                 { Number = a.Number
+                   Frequency = Modal.frequency a
+                   Reduced = Modal.frequency b
+                   Mac = Modal.mac full a modes b } |] }
+
+      match options.OutputFile, options.Format with
+      | Some output, _ when
+        Path.GetExtension(output).ToLowerInvariant() = ".mtx"
+        ->
+        let files = writeMatrices output (MatrixExport.ofReduced r)
+        let written = files |> List.map Markup.Escape |> String.concat ", "
+        showSuccess $"Reduced matrices written to {written}"
+      | Some output, format -> outputToFile format output report
+      | None, "json" -> printfn "%s" (serialize report)
+      | None, _ ->
+        let culture = CultureInfo.InvariantCulture
+        let hertz (x: float) = x.ToString("F3", culture)
+
+        let table = Table()
+        table.Border <- TableBorder.Rounded
+        table.BorderStyle <- Style.Parse("blue")
+        table.AddColumn("Mode") |> ignore
+        table.AddColumn("Full (Hz)") |> ignore
+        table.AddColumn($"{report.Method} (Hz)") |> ignore
+        table.AddColumn("Error") |> ignore
+        table.AddColumn("MAC") |> ignore
+
+        for m in report.Modes do
+          let error = (m.Reduced - m.Frequency) / m.Frequency
+          let percent = error.ToString("P2", culture)
+
+          table.AddRow(
+            string m.Number,
+            hertz m.Frequency,
+            hertz m.Reduced,
+            (if abs error <= 0.01 then
+               $"[green]{percent}[/]"
+             else
+               $"[yellow]{percent}[/]"),
+            m.Mac.ToString("F3", culture)
+          )
+          |> ignore
+
+        AnsiConsole.Write(table)
+
+        showInfo
+          $"{report.Masters.Length} of {r.Dofs.Length} free degrees of \
+            freedom kept; write the matrices with --output reduced.json \
+            or reduced.mtx"
+
+      0
+
+/// Reads the viewer page embedded in the CLI assembly.
+let private viewerPage () =
+  let assembly = Reflection.Assembly.GetExecutingAssembly()
+  use stream = assembly.GetManifestResourceStream "viewer.html"
+  use reader = new StreamReader(stream)
+  reader.ReadToEnd()
+
+/// Axial forces of the members under each load set, for the viewer's force
+/// flow mode.
+let private axialForcesOf (model: Model) : Result<string, string> =
+  LoadCases.select model None None
+  |> Result.mapError SelectionError.getAsString
+  |> Result.bind (fun sets ->
+    List.foldBack
+      (fun (set: LoadSet) acc ->
+        match Static.analyse model set, acc with
+        | Ok r, Ok rest ->
+          Ok({| Name = set.Name; Forces = Static.axialForces r |} :: rest)
+        | Error e, _ -> Error(StaticError.getAsString e)
+        | _, Error e -> Error e)
+      sets
+      (Ok []))
+  |> Result.map serialize
+
+/// Factored loads of each load set, for the viewer's load overlays.
+let private loadSetsOf (options: CliOptions) (model: Model) =
+  LoadCases.select model options.Cases options.Combinations
+  |> Result.mapError SelectionError.getAsString
+  |> Result.map (fun sets ->
+    sets
+    |> List.map (fun set ->
+      {| Name = set.Name
+         Kind =
+          match set.Kind with
+          | LoadCase -> "Case"
+          | LoadCombination -> "Combination"
+         Loads =
+          set.Loads
+          |> List.map (fun (factor, l) ->
+            let scaled = Option.map (fun q -> factor * q)
+
+            {| Id = l.Id
+               Type = l.Type
+               Node = l.Node
+               Element = l.Element
+               Direction = l.Direction
+               Magnitude = factor * l.Magnitude
+               Position = l.Position
+               End = l.End
+               EndMagnitude = scaled l.EndMagnitude |}) |})
+    |> serialize)
+
+/// <summary>
+/// Content served by gz view, by request path: the viewer page, the model,
+/// its axial forces and factored loads under each load set, and results.
+/// </summary>
+/// <param name="options">Options selecting the load sets to overlay.</param>
+/// <param name="model">Model to view.</param>
+/// <param name="results">Results JSON, if given.</param>
+/// <returns>Content type and body of each path.</returns>
+let viewRoutes
+  (options: CliOptions)
+  (model: Model)
+  (results: string option)
+  : Map<string, string * string> =
+  // The model is still shown when it cannot be analysed.
+  let orEmpty (name: string) (json: Result<string, string>) =
+    match json with
+    | Ok json -> json
+    | Error msg ->
+      showWarning $"{name} unavailable: {msg}"
+      "[]"
+
+  [ "/", ("text/html", viewerPage ())
+    "/model.json", ("application/json", Model.serialize Json model)
+    "/forces.json",
+    ("application/json", orEmpty "Axial forces" (axialForcesOf model))
+    "/loads.json",
+    ("application/json", orEmpty "Load sets" (loadSetsOf options model)) ]
+  @ (results
+     |> Option.map (fun r -> "/results.json", ("application/json", r))
+     |> Option.toList)
+  |> Map.ofList
+
+/// <summary>
+/// Routes a request of gz view.
+/// </summary>
+/// <param name="routes">Content of each path, see viewRoutes.</param>
+/// <param name="path">Absolute path of the request URL.</param>
+/// <returns>Content type and UTF-8 body, or None if not found.</returns>
+let viewRoute
+  (routes: Map<string, string * string>)
+  (path: string)
+  : (string * byte array) option =
+  Map.tryFind path routes
+  |> Option.map (fun (contentType, body) ->
+    $"{contentType}; charset=utf-8", Text.Encoding.UTF8.GetBytes(body: string))
+
+/// Serves a model, optional results and an embedded 3D viewer on localhost
+/// until interrupted.
+let viewCommand (options: CliOptions) =
+  let results =
+    match options.ResultsFile with
+    | Some path when not (File.Exists path) ->
+      Error $"Results file not found: {path}"
+    | Some path ->
+      // Results of earlier formats are upgraded before the viewer reads them.
+      try
+        match readResults path with
+        | :? JsonObject as o ->
+          ResultFormat.migrate o
+          |> Result.mapError (fun e ->
+            $"Results file {ResultFormatError.getAsString e}")
+          |> Result.map (fun o -> Some(o.ToJsonString()))
+        | _ -> Error $"Results file is not a JSON object: {path}"
+      with :? JsonException as ex ->
+        Error $"Malformed results file: {ex.Message}"
+    | None -> Ok None
+
+  match options.InputFile, results with
+  | None, _ ->
+    showError "No model file specified"
+    1
+  | _, Error msg ->
+    showError msg
+    1
+  | Some file, Ok results ->
+    match loadModel options file with
+    | Error msg ->
+      showError $"Error reading model: {msg}"
+      1
+    | Ok model ->
+      let routes = viewRoutes options model results
+      let url = $"http://localhost:{options.Port}/"
+      use listener = new Net.HttpListener()
+      listener.Prefixes.Add url
+
+      try
+        listener.Start()
+        showSuccess $"Viewing {file} at [cyan]{url}[/] (Ctrl+C to stop)"
+
+        while listener.IsListening do
+          let context = listener.GetContext()
+          let response = context.Response
+
+          match viewRoute routes context.Request.Url.AbsolutePath with
+          | Some(contentType, bytes) ->
+            response.ContentType <- contentType
+            response.ContentLength64 <- int64 bytes.Length
+            response.OutputStream.Write(bytes, 0, bytes.Length)
+          | None -> response.StatusCode <- 404
+
+          response.Close()
+
+        0
+      with :? Net.HttpListenerException as ex ->
+        showError $"Cannot serve on {url}: {ex.Message}"
+        1
+
+/// Zero-based line and character of an offset in a document.
+let private positionOf (text: string) (offset: int) =
+  let before = text.Substring(0, min offset text.Length)
+  let line = before |> Seq.filter ((=) '\n') |> Seq.length
+  JsonObject(
+    dict
+      [ "line", JsonValue.Create line :> JsonNode
+        "character",
+        JsonValue.Create(before.Length - before.LastIndexOf '\n' - 1) ]
+  )
+
+/// Editor range of an entity's key, or of the first line when the entity
+/// is not found or the diagnostic is model-wide.
+let private rangeOf (text: string) (id: string option) =
+  let start, length =
+    let found =
+      id
+      |> Option.map (fun id ->
+        let key = Text.RegularExpressions.Regex.Escape $"\"{id}\""
+        Text.RegularExpressions.Regex.Match(text, key + @"\s*:"))
+      |> Option.filter (fun m -> m.Success)
+
+    match found with
+    | Some m -> m.Index, id.Value.Length + 2
+    | None -> 0, 0
+
+  JsonObject(
+    dict
+      [ "start", positionOf text start :> JsonNode
+        "end", positionOf text (start + length) ]
+  )
+
+/// Diagnostics of a model document: a parse error, or validation errors
+/// and warnings placed at the entity they concern.
+let private diagnosticsOf (text: string) : JsonNode list =
+  let diagnostic severity range (message: string) =
+    JsonObject(
+      dict
+        [ "range", range :> JsonNode
+          "severity", JsonValue.Create(severity: int)
+          "source", JsonValue.Create "gazelle"
+          "message", JsonValue.Create message ]
+    )
+    :> JsonNode
+
+  match Model.parse Json text with
+  | Error e ->
+    // System.Text.Json reports zero-based positions of syntax errors.
+    let at =
+      Text.RegularExpressions.Regex.Match(
+        ModelError.getAsString e,
+        @"LineNumber: (\d+) \| BytePositionInLine: (\d+)"
+      )
+
+    let range =
+      if at.Success then
+        let position =
+          JsonObject(
+            dict
+              [ "line", JsonValue.Create(int at.Groups[1].Value) :> JsonNode
+                "character", JsonValue.Create(int at.Groups[2].Value) ]
+          )
+
+        JsonObject(
+          dict [ "start", position :> JsonNode; "end", position.DeepClone() ]
+        )
+      else
+        rangeOf text None
+
+    [ diagnostic 1 range (ModelError.getAsString e) ]
+  | Ok model ->
+    let report = Validation.validate model
+
+    [ for e in report.Errors do
+        let range = rangeOf text (ValidationError.subject e)
+        diagnostic 1 range (ValidationError.getAsString e)
+      for w in report.Warnings do
+        let range = rangeOf text (ValidationWarning.subject w)
+        diagnostic 2 range (ValidationWarning.getAsString w) ]
+
+/// Markdown describing the entity whose ID is under the cursor.
+let private describe (model: Model) (id: string) : string option =
+  let culture = CultureInfo.InvariantCulture
+  let number (x: float) = x.ToString("G6", culture)
+  let list (xs: string list) = String.Join(", ", xs)
+
+  match id with
+  | _ when model.Nodes.ContainsKey id ->
+    let n = model.Nodes[id]
+    Some $"**Node {id}** ({number n.X}, {number n.Y}, {number n.Z})"
+  | _ when model.Elements.ContainsKey id ->
+    let e = model.Elements[id]
+    Some $"**{e.Type} {id}** nodes {list e.Nodes}, material {e.Material}"
+  | _ when model.Materials.ContainsKey id ->
+    let m = model.Materials[id]
+    Some $"**Material {id}** {m.Name}, E = {number m.ElasticModulus}"
+  | _ when model.Loads.ContainsKey id ->
+    let l = model.Loads[id]
+    let target = l.Node |> Option.orElse l.Element |> Option.defaultValue ""
+    let case = l.Case |> Option.defaultValue "DL"
+    let magnitude = number l.Magnitude
+    Some $"**{l.Type} {id}** {l.Direction} = {magnitude} on {target} ({case})"
+  | _ when model.Constraints.ContainsKey id ->
+    let c = model.Constraints[id]
+    Some $"**{c.Type} {id}** restrains {list c.Dof} at {c.Node}"
+  | _ when defaultArg model.Panels Map.empty |> Map.containsKey id ->
+    let p = model.Panels.Value[id]
+    Some $"**{p.Type} panel {id}** corners {list p.Nodes}"
+  | _ when model.Combinations.ContainsKey id ->
+    let factors =
+      model.Combinations[id].Factors
+      |> Map.toList
+      |> List.map (fun (case, f) -> $"{number f}×{case}")
+
+    let sum = String.Join(" + ", factors)
+    Some $"**Combination {id}** {sum}"
+  | _ -> None
+
+/// Returns the JSON string under a zero-based line and character.
+let private stringAt (text: string) (line: int) (character: int) =
+  let lines = text.Split('\n')
+
+  if line < 0 || line >= lines.Length then
+    None
+  else
+    let l = lines[line]
+    let c = min character l.Length
+    let opening = if c = 0 then -1 else l.LastIndexOf('"', c - 1)
+    let closing = l.IndexOf('"', c)
+
+    if opening >= 0 && closing > opening then
+      Some(l.Substring(opening + 1, closing - opening - 1))
+    else
+      None
+
+/// <summary>
+/// Serves an editor with JSON-RPC: diagnostics as documents are opened and
+/// changed, hover descriptions of entities, and analysis on request through
+/// the gazelle/analyze method.
+/// </summary>
+/// <param name="options">Options of analyses requested.</param>
+/// <param name="input">Stream of requests, e.g. standard input.</param>
+/// <param name="output">Stream of responses, e.g. standard output.</param>
+/// <returns>Exit code, 0 once the editor exits or the input ends.</returns>
+let lspServe (options: CliOptions) (input: Stream) (output: Stream) : int =
+  let documents = Collections.Generic.Dictionary<string, string>()
+  let node (value: 'T) = JsonSerializer.SerializeToNode(value, jsonOptions)
+
+  let publish (uri: string) (diagnostics: JsonNode list) =
+    let parameters =
+      JsonObject(
+        dict
+          [ "uri", JsonValue.Create uri :> JsonNode
+            "diagnostics", JsonArray(Array.ofList diagnostics) ]
+      )
+
+    Rpc.notification "textDocument/publishDiagnostics" parameters
+    |> Rpc.write output
+
+  let open' (uri: string) (text: string) =
+    documents[uri] <- text
+    publish uri (diagnosticsOf text)
+
+  // Returns the result of a request, or an error code and message.
+  let handle name (parameters: JsonNode) : Result<JsonNode, int * string> =
+    let uri () =
+      let document = parameters["textDocument"]
+      document["uri"].GetValue<string>()
+
+    let document () =
+      match documents.TryGetValue(uri ()) with
+      | true, text -> Ok text
+      | _ -> Error(Rpc.InvalidParams, $"Document {uri ()} is not open.")
+
+    match name with
+    | "initialize" ->
+      let version =
+        Reflection.Assembly.GetExecutingAssembly().GetName().Version
+        |> fun v -> v.ToString(3)
+
+      Ok(
+        node
+          {| capabilities = {| textDocumentSync = 1; hoverProvider = true |}
+             serverInfo = {| name = "gazelle"; version = version |} |}
+      )
+    | "shutdown" -> Ok null
+    | "textDocument/hover" ->
+      document ()
+      |> Result.map (fun text ->
+        let position = parameters["position"]
+
+        let contents =
+          match Model.parse Json text with
+          | Ok model ->
+            stringAt
+              text
+              (position["line"].GetValue<int>())
+              (position["character"].GetValue<int>())
+            |> Option.bind (describe model)
+          | Error _ -> None
+
+        match contents with
+        | Some markdown ->
+          node {| contents = {| kind = "markdown"; value = markdown |} |}
+        | None -> null)
+    | "gazelle/analyze" ->
+      document ()
+      |> Result.bind (fun text ->
+        Model.parse Json text
+        |> Result.mapError ModelError.getAsString
+        |> Result.bind (fun model ->
+          let report = Validation.validate model
+
+          match report.Errors with
+          | [] -> analyzeModel options model
+          | errors ->
+            Error $"Model has {errors.Length} validation error(s).")
+        |> Result.map node
+        |> Result.mapError (fun msg -> Rpc.InvalidParams, msg))
+    | _ -> Error(Rpc.MethodNotFound, $"Unknown method '{name}'.")
+
+  let rec serve () =
+    match Rpc.read input with
+    | None -> 0
+    | Some(Error reason) ->
+      Rpc.write output (Rpc.error null Rpc.ParseError reason)
+      serve ()
+    | Some(Ok message) ->
+      let name = message["method"] |> Option.ofObj |> Option.map string
+      let parameters = message["params"]
+
+      match name, message["id"] with
+      | Some "exit", _ -> 0
+      | Some name, null ->
+        // Notifications expect no response.
+        match name with
+        | "textDocument/didOpen" ->
+          let document = parameters["textDocument"]
+
+          open'
+            (document["uri"].GetValue<string>())
+            (document["text"].GetValue<string>())
+        | "textDocument/didChange" ->
+          let document = parameters["textDocument"]
+          let changes = parameters["contentChanges"].AsArray()
 
-let parse (args: string[]) =
-  let argsList = Array.toList args
-  parseArgs argsList defaultOptions
+          if changes.Count > 0 then
+            let latest = changes[changes.Count - 1]
 
-// Modern output helpers with colors
-let outputResult format content =
-  match format with
-  | "json" ->
-    let json = serialize content
-    let panel = Panel(json)
-    panel.Header <- PanelHeader(" JSON Output ")
-    panel.Border <- BoxBorder.Rounded
-    panel.BorderStyle <- Style.Parse("green")
-    AnsiConsole.Write(panel)
-  | _ ->
+            open'
+              (document["uri"].GetValue<string>())
+              (latest["text"].GetValue<string>())
+        | "textDocument/didClose" ->
+          let document = parameters["textDocument"]
+          let uri = document["uri"].GetValue<string>()
+          documents.Remove uri |> ignore
+          publish uri []
+        | _ -> ()
+
+        serve ()
+      | Some name, id ->
+        let reply =
+          try
+            match handle name parameters with
+            | Ok result -> Rpc.response id result
+            | Error(code, msg) -> Rpc.error id code msg
+          with ex ->
+            Rpc.error id Rpc.InvalidParams ex.Message
+
+        Rpc.write output reply
+        serve ()
+      | None, id ->
+        Rpc.write output (Rpc.error id Rpc.MethodNotFound "Missing method.")
+        serve ()
+
+  serve ()
+
+/// Serves editors over stdio, see lspServe.
+let lspCommand (options: CliOptions) =
+  lspServe options (Console.OpenStandardInput()) (Console.OpenStandardOutput())
+
+let versionCommand (options: CliOptions) =
+  let info = BuildInfo.ofAssembly (Reflection.Assembly.GetExecutingAssembly())
+
+  match options.Format with
+  | "json" -> printfn "%s" (BuildInfo.toJson info)
+  | _ -> outputResult options.Format info
+
+  0
+
+/// <summary>
+/// Checks the runtime, processors, memory, temporary space and the project
+/// ledger, then analyses an example model and checks its equilibrium, so
+/// the report can be attached to bug reports.
+/// </summary>
+/// <param name="options">Output options and the ledger.</param>
+/// <param name="example">Model of the self-test, or why it is missing.</param>
+/// <returns>0 if no check failed, 1 otherwise.</returns>
+let doctor (options: CliOptions) (example: Result<Model, string>) : int =
+  let gb = 1024.0 * 1024.0 * 1024.0
+  let check name status detail =
+    { Name = name
+      Status = status
+      Detail = detail }
+
+  let guard name (f: unit -> HealthCheck) =
+    try
+      f ()
+    with ex ->
+      check name "fail" ex.Message
+
+  let runtime () =
+    let info = Runtime.InteropServices.RuntimeInformation.FrameworkDescription
+    let platform = Runtime.InteropServices.RuntimeInformation.RuntimeIdentifier
+
+    if Environment.Is64BitProcess then
+      check "Runtime" "ok" $"{info} on {platform}"
+    else
+      let detail = $"{info} on {platform}, 32-bit"
+      check "Runtime" "warn" $"{detail}: large models need 64-bit"
+
+  let processors () =
+    let count = Environment.ProcessorCount
+    let workers = $"batch-analyze uses {options.Workers}"
+    check "Processors" "ok" $"{count} logical processor(s); {workers}"
+
+  let memory () =
+    let available = float (GC.GetGCMemoryInfo().TotalAvailableMemoryBytes) / gb
+    let detail = $"{available:F1} GB available"
+
+    if available < 2.0 then
+      check "Memory" "warn" $"{detail}; large models may not fit"
+    else
+      check "Memory" "ok" detail
+
+  let temporary () =
+    let folder = Path.GetTempPath()
+    let probe = Path.Combine(folder, $"gz-doctor-{Guid.NewGuid()}.tmp")
+    File.WriteAllText(probe, "gz")
+    File.Delete probe
+    let free = float (DriveInfo(folder).AvailableFreeSpace) / gb
+    let detail = $"{folder} is writable with {free:F1} GB free"
+
+    if free < 1.0 then
+      check "Temporary Space" "warn" $"{detail}; result files may not fit"
+    else
+      check "Temporary Space" "ok" detail
+
+  let ledger () =
+    let path = options.Ledger |> Option.defaultValue Ledger.DefaultPath
+
+    if not (File.Exists path) then
+      check "Ledger" "ok" $"no ledger at {path}"
+    else
+      match Ledger.read path with
+      | Ok entries -> check "Ledger" "ok" $"{path} has {entries.Length} run(s)"
+      | Error e -> check "Ledger" "fail" (LedgerError.getAsString e)
+
+  // Reactions must balance the loads of every case and combination.
+  let selfTest () =
+    let watch = Diagnostics.Stopwatch.StartNew()
+
+    let imbalance (m: Model) (set: LoadSet) =
+      NodalLoads.ofLoadSet m set
+      |> Result.mapError LoadError.getAsString
+      |> Result.bind (fun loads ->
+        Static.analyse m set
+        |> Result.mapError StaticError.getAsString
+        |> Result.map (fun r ->
+          (Equilibrium.check Equilibrium.Tolerance m loads r).Residual))
+
+    let outcome =
+      example
+      |> Result.bind (fun m ->
+        LoadCases.select m None None
+        |> Result.mapError SelectionError.getAsString
+        |> Result.bind (fun sets ->
+          sets
+          |> List.map (imbalance m)
+          |> List.fold
+            (fun acc x -> Result.bind (fun a -> Result.map (max a) x) acc)
+            (Ok 0.0)
+          |> Result.map (fun worst -> sets.Length, worst)))
+
+    match outcome with
+    | Error msg -> check "Self-Test" "fail" msg
+    | Ok(_, worst) when worst > Equilibrium.Tolerance ->
+      check "Self-Test" "fail" $"reactions miss equilibrium by {worst:E2}"
+    | Ok(count, _) ->
+      let ms = watch.ElapsedMilliseconds
+      check "Self-Test" "ok" $"{count} load set(s) in equilibrium in {ms} ms"
+
+  let checks =
+    [| guard "Runtime" runtime
+       guard "Processors" processors
+       guard "Memory" memory
+       guard "Temporary Space" temporary
+       guard "Ledger" ledger
+       guard "Self-Test" selfTest |]
+
+  let report =
+    { Version =
+        Reflection.Assembly.GetExecutingAssembly().GetName().Version.ToString(3)
+      Healthy = checks |> Array.forall (fun c -> c.Status <> "fail")
+      Checks = checks }
+
+  match options.OutputFile, options.Format with
+  | Some file, format -> outputToFile format file report
+  | None, "json" -> printfn "%s" (serialize report)
+  | None, _ ->
     let table = Table()
-    table.AddColumn("Property") |> ignore
-    table.AddColumn("Value") |> ignore
     table.Border <- TableBorder.Rounded
     table.BorderStyle <- Style.Parse("blue")
+    table.Title <- TableTitle($"gz doctor {report.Version}")
+    table.AddColumn("Check") |> ignore
+    table.AddColumn("Status") |> ignore
+    table.AddColumn("Detail") |> ignore
 
-    // Format content based on type
-    match box content with
-    | :? ModelInfo as model ->
-      table.Title <- TableTitle("Model Information")
-      table.AddRow("[cyan]Name[/]", model.Name) |> ignore
-      table.AddRow("[cyan]Version[/]", model.Version) |> ignore
-      table.AddRow("[cyan]Nodes[/]", model.NodeCount.ToString()) |> ignore
-      table.AddRow("[cyan]Elements[/]", model.ElementCount.ToString()) |> ignore
-      table.AddRow("[cyan]Load Cases[/]", model.LoadCases.ToString()) |> ignore
-    | :? AnalysisResult as result ->
-      table.Title <- TableTitle("Analysis Results")
-      table.AddRow("[cyan]Model[/]", result.ModelName) |> ignore
-      table.AddRow("[cyan]Status[/]", $"[green]{result.Status}[/]") |> ignore
+    for c in checks do
+      let status =
+        match c.Status with
+        | "ok" -> "[green]✓ ok[/]"
+        | "warn" -> "[yellow]! warn[/]"
+        | _ -> "[red]✗ fail[/]"
 
-      match result.MaxDisplacement with
-      | Some d ->
-        table.AddRow("[cyan]Max Displacement[/]", $"{d:F3} m") |> ignore
-      | None -> ()
+      table.AddRow($"[cyan]{c.Name}[/]", status, Markup.Escape c.Detail)
+      |> ignore
 
-      match result.MaxStress with
-      | Some s -> table.AddRow("[cyan]Max Stress[/]", $"{s:F1} MPa") |> ignore
-      | None -> ()
-    | :? ValidationResult as validation ->
-      table.Title <- TableTitle("Validation Results")
-      let statusColor = if validation.IsValid then "green" else "red"
-      let statusText = if validation.IsValid then "✓ Valid" else "✗ Invalid"
+    AnsiConsole.Write(table)
 
-      table.AddRow("[cyan]Status[/]", $"[{statusColor}]{statusText}[/]")
-      |> ignore
+  if report.Healthy then 0 else 1
 
-      table.AddRow("[cyan]Errors[/]", validation.Errors.Length.ToString())
-      |> ignore
+/// Runs gz doctor with the example cable-stayed bridge as its self-test.
+let doctorCommand (options: CliOptions) =
+  Examples.cableStayed Examples.defaultCableStayed
+  |> Result.mapError ExampleError.getAsString
+  |> doctor options
 
-      table.AddRow("[cyan]Warnings[/]", validation.Warnings.Length.ToString())
-      |> ignore
-    | _ ->
-      let contentStr = content.ToString()
-      table.AddRow("[cyan]Result[/]", contentStr) |> ignore
+/// Runs the built-in closed-form benchmarks and reports the computed and
+/// theoretical value of each quantity with its percentage error.
+let verifyCommand (options: CliOptions) =
+  match Verification.runAll () with
+  | Error e ->
+    showError (VerificationError.getAsString e)
+    1
+  | Ok checks ->
+    let report =
+      { Passed = checks |> List.forall (fun c -> c.Passed)
+        Tolerance = Verification.tolerance
+        Checks = Array.ofList checks }
 
-    AnsiConsole.Write(table)
+    match options.OutputFile, options.Format with
+    | Some file, format -> outputToFile format file report
+    | None, "json" -> printfn "%s" (serialize report)
+    | None, _ ->
+      let table = Table()
+      table.Border <- TableBorder.Rounded
+      table.BorderStyle <- Style.Parse("blue")
+      table.Title <- TableTitle("gz verify")
 
-let outputToFile format (filePath: string) content =
-  AnsiConsole
-    .Status()
-    .Start(
-      $"Writing to {Path.GetFileName(filePath)}...",
-      fun ctx ->
-        ctx.Spinner <- Spinner.Known.Star
-        ctx.SpinnerStyle <- Style.Parse("green")
+      for column in [ "Benchmark"; "Quantity"; "Computed"; "Theory"; "Error" ] do
+        table.AddColumn(column) |> ignore
 
-        match format with
-        | "json" -> serializeToFile filePath content
-        | _ ->
-          let text = sprintf "%A" content
-          File.WriteAllText(filePath, text)
+      for c in checks do
+        let error =
+          if c.Passed then
+            $"[green]{c.PercentError:F4} %%[/]"
+          else
+            $"[red]{c.PercentError:F4} %%[/]"
 
-        System.Threading.Thread.Sleep(500) // Brief pause to show spinner
-    )
+        table.AddRow(
+          $"[cyan]{Markup.Escape c.Benchmark}[/]",
+          Markup.Escape c.Quantity,
+          $"{c.Computed:G6}",
+          $"{c.Theoretical:G6}",
+          error
+        )
+        |> ignore
 
-  AnsiConsole.MarkupLine($"[green]✓[/] Results written to [cyan]{filePath}[/]")
+      AnsiConsole.Write(table)
 
-let showSuccess message =
-  AnsiConsole.MarkupLine($"[green]✓[/] {message}")
+      let passed = checks |> List.filter (fun c -> c.Passed)
 
-let showError message =
-  AnsiConsole.MarkupLine($"[red]✗[/] {message}")
+      showInfo
+        $"{passed.Length} of {checks.Length} within {Verification.tolerance} %% of theory"
 
-let showWarning message =
-  AnsiConsole.MarkupLine($"[yellow]⚠[/] {message}")
+    if report.Passed then 0 else 1
 
-let showInfo message =
-  AnsiConsole.MarkupLine($"[blue]ℹ[/] {message}")
+/// Files of a snapshot besides the model and its manifest.
+[<Literal>]
+let SnapshotOptionsEntry = "options.json"
 
-let withProgress<'T> (message: string) (work: unit -> 'T) =
-  AnsiConsole
-    .Status()
-    .Start(
-      message,
-      fun ctx ->
-        ctx.Spinner <- Spinner.Known.Dots
-        ctx.SpinnerStyle <- Style.Parse("yellow")
-        work ()
-    )
+[<Literal>]
+let SnapshotResultsEntry = "results.json"
 
-// Commands
-let infoCommand (options: CliOptions) =
-  match options.InputFile with
-  | None ->
+[<Literal>]
+let SnapshotRenderEntry = "render.svg"
+
+[<Literal>]
+let SnapshotInitialStateEntry = "initial-state.json"
+
+/// Analyses a model as gz analyze would and packs it, with the options, the
+/// results, a render coloured by utilisation and the environment, into one
+/// archive for checkers or issue reports.
+let snapshotCommand (options: CliOptions) =
+  let target =
+    match options.InputFile, options.OutputFile with
+    | _, Some path -> Ok path
+    | Some file, None when file <> Model.StdIn ->
+      Ok(Path.ChangeExtension(file, ".snapshot.zip"))
+    | _ -> Error "A snapshot of standard input needs an --output"
+
+  match options.InputFile, target with
+  | None, _ ->
     showError "No model file specified"
     1
-  | Some file when not (File.Exists file) ->
+  | _, Error msg ->
+    showError msg
+    1
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
     showError $"Model file not found: {file}"
     1
-  | Some file ->
-    try
-      // Mock implementation - replace with actual model loading
-      let modelInfo =
-        { Name = Path.GetFileNameWithoutExtension(file)
-          Version = "1.0"
-          NodeCount = 10
-          ElementCount = 8
-          LoadCases = 2 }
+  | _ when
+    options.AnalysisType <> "static" && options.AnalysisType <> "second-order"
+    ->
+    showError "Snapshots support static and second-order analyses only."
+    1
+  | Some file, Ok path ->
+    let analysed =
+      loadModel options file
+      |> Result.bind (fun m ->
+        analyzeModel options m |> Result.map (fun r -> m, r))
 
-      match options.OutputFile with
-      | Some outputFile -> outputToFile options.Format outputFile modelInfo
-      | None -> outputResult options.Format modelInfo
+    match analysed with
+    | Error msg ->
+      showError msg
+      1
+    | Ok(model, result) ->
+      let settings: SnapshotOptions =
+        { Cases = options.Cases
+          Combinations = options.Combinations
+          Save = options.Save
+          InitialState = options.InitialState.IsSome
+          Solver = options.Solver
+          AnalysisType = options.AnalysisType
+          ModeCount = options.ModeCount
+          Stations = options.Stations
+          MassMatrix = options.MassMatrix
+          Iterations = options.Iterations
+          Convergence = options.Convergence
+          MinStep = options.MinStep
+          MaxStep = options.MaxStep
+          Scheme = options.Scheme
+          LineSearch = options.LineSearch
+          ReactionSign = options.ReactionSign
+          Imperfections = options.Imperfections }
+
+      let ratios =
+        result.Stresses
+        |> Seq.choose (fun s -> s.Ratio |> Option.map (fun r -> s.Element, r))
+        |> Seq.groupBy fst
+        |> Seq.map (fun (id, rs) -> id, rs |> Seq.map snd |> Seq.max)
+        |> Map.ofSeq
+
+      let text (s: string) = Text.Encoding.UTF8.GetBytes s
+
+      let files =
+        Map.ofList
+          [ SnapshotOptionsEntry, text (serialize settings)
+            SnapshotResultsEntry, text (serialize result)
+            SnapshotRenderEntry, text (Snapshot.render model ratios)
+            match options.InitialState with
+            | Some state -> SnapshotInitialStateEntry, File.ReadAllBytes state
+            | None -> () ]
+
+      let manifest = Snapshot.write path model files
+
+      match options.Format with
+      | "json" -> printfn "%s" (serialize manifest)
+      | _ ->
+        let name = Markup.Escape model.Info.Name
+
+        showSuccess
+          $"Snapshot of [cyan]{name}[/] written to \
+            [cyan]{Markup.Escape path}[/] ({manifest.Files.Count} files)"
 
       0
-    with ex ->
-      showError $"Error reading model: {ex.Message}"
-      1
 
-let analyzeCommand (options: CliOptions) =
+/// Re-runs the analysis of a snapshot with its options and compares the
+/// results with those it holds, ignoring their provenance.
+let snapshotVerifyCommand (options: CliOptions) =
+  let read file =
+    Snapshot.read file
+    |> Result.mapError SnapshotError.getAsString
+    |> Result.bind (fun (manifest, model, files) ->
+      let entry name =
+        files.TryFind name
+        |> Option.map (Text.Encoding.UTF8.GetString >> Ok)
+        |> Option.defaultValue (
+          Error(SnapshotError.getAsString (MissingEntry name))
+        )
+
+      entry SnapshotOptionsEntry
+      |> Result.bind (fun settings ->
+        entry SnapshotResultsEntry
+        |> Result.map (fun results ->
+          let settings =
+            JsonSerializer.Deserialize<SnapshotOptions>(settings, jsonOptions)
+
+          manifest, model, files, settings, JsonNode.Parse results)))
+
   match options.InputFile with
   | None ->
-    showError "No model file specified"
+    showError "No snapshot specified"
     1
   | Some file when not (File.Exists file) ->
-    eprintfn "Error: Model file not found: %s" file
+    showError $"Snapshot not found: {file}"
     1
   | Some file ->
     try
-      if options.Verbose then
-        showInfo $"Analyzing model: {file}"
+      match read file with
+      | Error msg ->
+        showError msg
+        1
+      | Ok(manifest, model, files, settings, expected) ->
+        let state =
+          match settings.InitialState, files.TryFind SnapshotInitialStateEntry
+            with
+          | true, Some bytes ->
+            let path = Path.GetTempFileName()
+            File.WriteAllBytes(path, bytes)
+            Some path
+          | _ -> None
 
-      // Mock analysis - replace with actual analysis
-      let result =
-        { ModelName = Path.GetFileNameWithoutExtension(file)
-          Status = "Success"
-          MaxDisplacement = Some 0.025
-          MaxStress = Some 145.2
-          Warnings = [||]
-          Errors = [||] }
+        let rerun =
+          { defaultOptions with
+              Cases = settings.Cases
+              Combinations = settings.Combinations
+              Save = settings.Save
+              InitialState = state
+              Solver = settings.Solver
+              AnalysisType = settings.AnalysisType
+              ModeCount = settings.ModeCount
+              Stations = settings.Stations
+              MassMatrix = settings.MassMatrix
+              Iterations = settings.Iterations
+              Convergence = settings.Convergence
+              MinStep = settings.MinStep
+              MaxStep = settings.MaxStep
+              Scheme = settings.Scheme
+              LineSearch = settings.LineSearch
+              ReactionSign = settings.ReactionSign
+              Imperfections = settings.Imperfections }
 
-      match options.OutputFile with
-      | Some outputFile -> outputToFile options.Format outputFile result
-      | None -> outputResult options.Format result
+        let result =
+          try
+            analyzeModel rerun model
+          finally
+            state |> Option.iter File.Delete
 
-      0
-    with ex ->
-      showError $"Error during analysis: {ex.Message}"
+        match result with
+        | Error msg ->
+          showError msg
+          1
+        | Ok result ->
+          let differences =
+            Snapshot.compare
+              (set [ "provenance"; "initialState" ])
+              expected
+              (JsonNode.Parse(serialize result))
+
+          let assembly = Reflection.Assembly.GetExecutingAssembly()
+
+          let report =
+            { Reproduced = differences.IsEmpty
+              ModelName = manifest.ModelName
+              ModelHash = manifest.ModelHash
+              RecordedVersion = manifest.GazelleVersion
+              Version = assembly.GetName().Version.ToString(3)
+              Differences = Array.ofList differences }
+
+          match options.OutputFile, options.Format with
+          | Some output, format -> outputToFile format output report
+          | None, "json" -> printfn "%s" (serialize report)
+          | None, _ ->
+            let name = Markup.Escape manifest.ModelName
+
+            if report.Reproduced then
+              showSuccess $"Snapshot of [cyan]{name}[/] reproduced"
+            else
+              let table = Table()
+              table.Border <- TableBorder.Rounded
+              table.BorderStyle <- Style.Parse("blue")
+              table.Title <- TableTitle($"gz snapshot verify {name}")
+
+              for column in [ "Path"; "Recorded"; "Re-run" ] do
+                table.AddColumn(column) |> ignore
+
+              for d in differences do
+                table.AddRow(
+                  Markup.Escape d.Path,
+                  Markup.Escape d.Expected,
+                  Markup.Escape(Option.defaultValue "missing" d.Actual)
+                )
+                |> ignore
+
+              AnsiConsole.Write(table)
+
+              showWarning
+                $"{differences.Length} results differ from the snapshot, \
+                  made with Gazelle {manifest.GazelleVersion} on \
+                  {Markup.Escape manifest.Platform}"
+
+          if report.Reproduced then 0 else 1
+    with :? JsonException as ex ->
+      showError $"Snapshot options or results are unreadable: {ex.Message}"
       1
 
-let validateCommand (options: CliOptions) =
-  match options.InputFile with
-  | None ->
-    eprintfn "Error: No model file specified"
+/// Reads the --format option of gz export, else the extension of its
+/// --output, defaulting to glTF JSON. OpenSees scripts are Tcl unless
+/// written to a .py file, for OpenSeesPy.
+let exportFormat (options: CliOptions) : Result<string, string> =
+  let extension =
+    options.OutputFile
+    |> Option.map (fun path -> Path.GetExtension(path).ToLowerInvariant())
+
+  match options.Format.ToLowerInvariant(), extension with
+  | _ when options.Matrices -> Ok "mtx"
+  | "gltf", _ -> Ok "gltf"
+  | "glb", _ -> Ok "glb"
+  | "opensees", Some ".py" -> Ok "py"
+  | "opensees", _ -> Ok "tcl"
+  | "abaqus", _ -> Ok "inp"
+  | "xlsx", _ -> Ok "xlsx"
+  | "text", Some ".glb" -> Ok "glb"
+  | "text", Some ".tcl" -> Ok "tcl"
+  | "text", Some ".py" -> Ok "py"
+  | "text", Some ".inp" -> Ok "inp"
+  | "text", Some ".mtx" -> Ok "mtx"
+  | "text", Some ".xlsx" -> Ok "xlsx"
+  | "text", _ -> Ok "gltf"
+  | other, _ ->
+    Error
+      $"Unknown export format '{other}'. \
+        Available: gltf, glb, opensees, abaqus, xlsx."
+
+let exportCommand (options: CliOptions) =
+  let target =
+    exportFormat options
+    |> Result.bind (fun format ->
+      match options.InputFile, options.OutputFile with
+      | _, Some path -> Ok(format, path)
+      | Some file, None when file <> Model.StdIn ->
+        match Path.ChangeExtension(file, "." + format) with
+        | path when path = file -> Error "The export needs an --output"
+        | path -> Ok(format, path)
+      | _ -> Error "An export of standard input needs an --output")
+
+  match options.InputFile, target with
+  | None, _ ->
+    showError "No model file specified"
     1
-  | Some file when not (File.Exists file) ->
-    eprintfn "Error: Model file not found: %s" file
+  | _, Error msg ->
+    showError msg
     1
-  | Some file ->
-    try
-      // Mock validation - replace with actual validation
-      let result =
-        { IsValid = true
-          Errors = [||]
-          Warnings = [||] }
+  | Some file, _ when file <> Model.StdIn && not (File.Exists file) ->
+    showError $"Model file not found: {file}"
+    1
+  | Some file, Ok(("tcl" | "py") as format, path) ->
+    let language =
+      if format = "py" then
+        OpenSeesLanguage.Python
+      else
+        OpenSeesLanguage.Tcl
 
-      if options.Verbose then
-        printfn "Validating model: %s" file
+    let exported =
+      loadModel options file
+      |> Result.bind (fun model ->
+        LoadCases.select model options.Cases options.Combinations
+        |> Result.mapError SelectionError.getAsString
+        |> Result.bind (
+          OpenSees.toScript language model
+          >> Result.mapError OpenSeesError.getAsString
+        )
+        |> Result.map (fun script -> model, script))
 
-      match options.OutputFile with
-      | Some outputFile -> outputToFile options.Format outputFile result
-      | None -> outputResult options.Format result
+    match exported with
+    | Error msg ->
+      showError msg
+      1
+    | Ok(model, script) ->
+      File.WriteAllText(path, script)
+      let name = Markup.Escape model.Info.Name
 
-      if result.IsValid then 0 else 1
-    with ex ->
-      eprintfn "Error during validation: %s" ex.Message
+      showSuccess
+        $"OpenSees script of [cyan]{name}[/] written to \
+          [cyan]{Markup.Escape path}[/]"
+
+      0
+  | Some file, Ok("inp", path) ->
+    let exported =
+      loadModel options file
+      |> Result.bind (fun model ->
+        LoadCases.select model options.Cases options.Combinations
+        |> Result.mapError SelectionError.getAsString
+        |> Result.bind (
+          AbaqusExport.toInput model >> Result.mapError AbaqusError.getAsString
+        )
+        |> Result.map (fun input -> model, input))
+
+    match exported with
+    | Error msg ->
+      showError msg
       1
+    | Ok(model, input) ->
+      File.WriteAllText(path, input)
+      let name = Markup.Escape model.Info.Name
 
-let createCommand (options: CliOptions) =
-  match options.Template with
-  | None ->
-    showError "No template specified. Use --template <name>"
-    1
-  | Some templateName ->
-    let template = templates |> List.tryFind (fun t -> t.Name = templateName)
+      showSuccess
+        $"Abaqus input file of [cyan]{name}[/] written to \
+          [cyan]{Markup.Escape path}[/]"
 
-    match template with
-    | None ->
-      eprintfn "Error: Template '%s' not found" templateName
+      0
+  | Some file, Ok("xlsx", path) ->
+    match loadModel options file with
+    | Error msg ->
+      showError msg
+      1
+    | Ok model ->
+      Model.writeWorkbook path model
+      let name = Markup.Escape model.Info.Name
+
+      showSuccess
+        $"Workbook of [cyan]{name}[/] written to [cyan]{Markup.Escape path}[/]"
+
+      // Parts of a model that have no sheet.
+      let omitted =
+        [ if model.Parameters.IsSome then "parameters"
+          if model.Gravity.IsSome then "gravity"
+          if model.Damping.IsSome then "damping"
+          if model.TimeHistory.IsSome then "time history"
+          if model.Masses.IsSome then "point masses"
+          if model.Panels.IsSome then "panels" ]
+
+      if not omitted.IsEmpty then
+        let parts = String.Join(", ", omitted)
+        showWarning $"The workbook leaves out the model's {parts}"
 
-      eprintfn
-        "Available templates: %s"
-        (String.Join(", ", templates |> List.map (fun t -> t.Name)))
+      0
+  | Some file, Ok("mtx", path) ->
+    // Reduced to masters if any are given, else every free freedom.
+    let matrices kind model =
+      if options.Nodes.IsEmpty then
+        MatrixExport.ofModel kind model
+        |> Result.mapError StaticError.getAsString
+      else
+        reductionMethod options
+        |> Result.bind (fun method ->
+          masterDofs options
+          |> Result.bind (fun masters ->
+            Reduction.reduce method kind masters model
+            |> Result.mapError ReductionError.getAsString))
+        |> Result.map MatrixExport.ofReduced
+
+    let exported =
+      massMatrix options
+      |> Result.bind (fun kind ->
+        loadModel options file
+        |> Result.bind (fun model ->
+          matrices kind model |> Result.map (fun x -> model, x)))
 
+    match exported with
+    | Error msg ->
+      showError msg
       1
-    | Some tmpl ->
-      try
-        if options.Verbose then
-          printfn "Creating model from template: %s" templateName
+    | Ok(model, matrices) ->
+      let files = writeMatrices path matrices
+      let written = files |> List.map Markup.Escape |> String.concat ", "
+      let name = Markup.Escape model.Info.Name
+      showSuccess $"Matrices of [cyan]{name}[/] written to {written}"
 
-        // Mock model creation - replace with actual implementation
-        let newModel =
-          { Name = sprintf "Generated_%s" templateName
-            Version = "1.0"
-            NodeCount = 4
-            ElementCount = 3
-            LoadCases = 1 }
+      if matrices.Mass.IsNone then
+        showWarning "No mass matrix: the materials have no density"
 
-        match options.OutputFile with
-        | Some outputFile ->
-          serializeToFile outputFile newModel
-          printfn "Model created: %s" outputFile
-        | None -> outputResult options.Format newModel
+      0
+  | Some file, Ok(format, path) ->
+    // Each selected load set adds its deformed shape when scaled.
+    let deformed (model: Model) =
+      match options.Scale with
+      | None -> Ok []
+      | Some _ ->
+        LoadCases.select model options.Cases options.Combinations
+        |> Result.mapError SelectionError.getAsString
+        |> Result.bind (fun sets ->
+          sets
+          |> List.fold
+            (fun acc set ->
+              acc
+              |> Result.bind (fun shapes ->
+                Static.analyse model set
+                |> Result.mapError StaticError.getAsString
+                |> Result.map (fun r ->
+                  let shape: GltfShape =
+                    { Name = set.Name
+                      Displacements = r.Displacements }
 
-        0
-      with ex ->
-        eprintfn "Error creating model: %s" ex.Message
-        1
+                  shapes @ [ shape ])))
+            (Ok []))
 
-let templatesCommand (options: CliOptions) =
-  try
-    match options.Format with
-    | "json" ->
-      let json = serialize templates
-      let panel = Panel(json)
-      panel.Header <- PanelHeader(" Available Templates ")
-      panel.Border <- BoxBorder.Rounded
-      panel.BorderStyle <- Style.Parse("green")
-      AnsiConsole.Write(panel)
-    | _ ->
-      let table = Table()
-      table.AddColumn("Template") |> ignore
-      table.AddColumn("Description") |> ignore
-      table.AddColumn("Parameters") |> ignore
-      table.Border <- TableBorder.Rounded
-      table.BorderStyle <- Style.Parse("blue")
-      table.Title <- TableTitle("Available Templates")
+    let exported =
+      loadModel options file
+      |> Result.bind (fun m -> deformed m |> Result.map (fun s -> m, s))
 
-      for template in templates do
-        let parameters = String.Join(", ", template.Parameters)
+    match exported with
+    | Error msg ->
+      showError msg
+      1
+    | Ok(model, shapes) ->
+      let scale = Option.defaultValue 1.0 options.Scale
 
-        table.AddRow(
-          $"[green]{template.Name}[/]",
-          template.Description,
-          $"[dim]{parameters}[/]"
-        )
-        |> ignore
+      match format with
+      | "glb" -> File.WriteAllBytes(path, Gltf.toGlb model shapes scale)
+      | _ -> File.WriteAllText(path, Gltf.toGltf model shapes scale)
 
-      AnsiConsole.Write(table)
+      let name = Markup.Escape model.Info.Name
 
-    0
-  with ex ->
-    showError $"Error listing templates: {ex.Message}"
-    1
+      let shown =
+        match shapes with
+        | [] -> ""
+        | _ -> $" with {shapes.Length} deformed shapes at {scale:G4}×"
 
-let batchAnalyzeCommand (options: CliOptions) =
-  // Mock implementation - would process multiple files
-  printfn "Batch analysis not yet implemented"
-  0
+      showSuccess
+        $"Scene of [cyan]{name}[/]{shown} written to \
+          [cyan]{Markup.Escape path}[/]"
+
+      0
 
 // ETABS Commands
 let etabsDemoCommand (options: CliOptions) =
@@ -696,9 +6281,39 @@ let executeCommand (options: CliOptions) =
   | "info" -> infoCommand options
   | "analyze" -> analyzeCommand options
   | "validate" -> validateCommand options
+  | "renumber" -> renumberCommand options
+  | "convert-units" -> convertUnitsCommand options
+  | "import" -> importCommand options
+  | "edit-add-symmetry" -> addSymmetryCommand options
+  | "edit-add-imperfections" -> addImperfectionsCommand options
+  | "edit-add-patterns" -> addPatternsCommand options
+  | "edit-add-vehicle" -> addVehicleCommand options
+  | "edit-add-panel-loads" -> addPanelLoadsCommand options
+  | "edit-add-temperatures" -> addTemperaturesCommand options
+  | "transfer" -> transferCommand options
+  | "track" -> trackCommand options
+  | "run" -> runCommand options
+  | "test" -> testCommand options
+  | "check" -> checkCommand options
+  | "rank" -> rankCommand options
+  | "calibrate" -> calibrateCommand options
+  | "optimize" -> optimizeCommand options
+  | "sweep" -> sweepCommand options
+  | "mac" -> macCommand options
+  | "reduce" -> reduceCommand options
+  | "verify" -> verifyCommand options
   | "create" -> createCommand options
   | "templates" -> templatesCommand options
   | "batch-analyze" -> batchAnalyzeCommand options
+  | "results" -> resultsCommand options
+  | "spectra" -> spectraCommand options
+  | "view" -> viewCommand options
+  | "lsp" -> lspCommand options
+  | "version" -> versionCommand options
+  | "doctor" -> doctorCommand options
+  | "snapshot" -> snapshotCommand options
+  | "snapshot-verify" -> snapshotVerifyCommand options
+  | "export" -> exportCommand options
   // ETABS Commands
   | "etabs-demo" -> etabsDemoCommand options
   | "etabs-units" -> etabsUnitsCommand options
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+/// <summary>
+/// JSON-RPC 2.0 messages framed with Content-Length headers, as used by the
+/// Language Server Protocol, for serving editors over stdio.
+/// </summary>
+[<RequireQualifiedAccess>]
+module Rpc
+
+open System
+open System.IO
+open System.Text
+open System.Text.Json.Nodes
+
+/// Error codes defined by JSON-RPC 2.0.
+[<Literal>]
+let ParseError = -32700
+
+[<Literal>]
+let MethodNotFound = -32601
+
+[<Literal>]
+let InvalidParams = -32602
+
+/// Reads header lines up to the blank line ending them, or None at the end
+/// of the stream.
+let private readHeaders (input: Stream) =
+  let line = StringBuilder()
+
+  let rec next (headers: string list) =
+    match input.ReadByte() with
+    | -1 -> None
+    | 10 ->
+      let text = line.ToString().TrimEnd('\r')
+      line.Clear() |> ignore
+
+      if text = "" then
+        if headers.IsEmpty then next headers else Some headers
+      else
+        next (text :: headers)
+    | b ->
+      line.Append(char b) |> ignore
+      next headers
+
+  next []
+
+/// <summary>
+/// Reads the next message from a stream.
+/// </summary>
+/// <param name="input">Stream, e.g. standard input.</param>
+/// <returns>
+/// The message, Error for a malformed one, or None at the end of the stream.
+/// </returns>
+let read (input: Stream) : Result<JsonObject, string> option =
+  readHeaders input
+  |> Option.map (fun headers ->
+    let length =
+      headers
+      |> List.tryPick (fun h ->
+        match h.Split(':', 2) with
+        | [| name; value |] when
+          String.Equals(
+            name.Trim(),
+            "Content-Length",
+            StringComparison.OrdinalIgnoreCase
+          )
+          ->
+          match Int32.TryParse(value.Trim()) with
+          | true, n -> Some n
+          | _ -> None
+        | _ -> None)
+
+    match length with
+    | None -> Error "missing Content-Length header"
+    | Some n ->
+      let body = Array.zeroCreate<byte> n
+      let mutable offset = 0
+
+      while offset < n do
+        match input.Read(body, offset, n - offset) with
+        | 0 -> offset <- n
+        | count -> offset <- offset + count
+
+      try
+        match JsonNode.Parse(Encoding.UTF8.GetString body) with
+        | :? JsonObject as message -> Ok message
+        | _ -> Error "message is not an object"
+      with :? Text.Json.JsonException as ex ->
+        Error ex.Message)
+
+/// <summary>
+/// Writes a message to a stream.
+/// </summary>
+/// <param name="output">Stream, e.g. standard output.</param>
+/// <param name="message">Message.</param>
+let write (output: Stream) (message: JsonObject) : unit =
+  message["jsonrpc"] <- JsonValue.Create "2.0"
+  let body = Encoding.UTF8.GetBytes(message.ToJsonString())
+  let header = Encoding.ASCII.GetBytes $"Content-Length: {body.Length}\r\n\r\n"
+  output.Write(header, 0, header.Length)
+  output.Write(body, 0, body.Length)
+  output.Flush()
+
+/// <summary>
+/// Creates the response to a request.
+/// </summary>
+/// <param name="id">ID of the request.</param>
+/// <param name="result">Result, or null.</param>
+/// <returns>Response message.</returns>
+let response (id: JsonNode) (result: JsonNode) : JsonObject =
+  JsonObject(
+    dict
+      [ "id", (if isNull id then null else id.DeepClone())
+        "result", result ]
+  )
+
+/// <summary>
+/// Creates an error response to a request.
+/// </summary>
+/// <param name="id">ID of the request, or null if unknown.</param>
+/// <param name="code">JSON-RPC error code.</param>
+/// <param name="message">Description of the error.</param>
+/// <returns>Response message.</returns>
+let error (id: JsonNode) (code: int) (message: string) : JsonObject =
+  let error =
+    JsonObject(
+      dict
+        [ "code", JsonValue.Create code :> JsonNode
+          "message", JsonValue.Create message ]
+    )
+
+  JsonObject(
+    dict
+      [ "id", (if isNull id then null else id.DeepClone())
+        "error", error :> JsonNode ]
+  )
+
+/// <summary>
+/// Creates a notification, which expects no response.
+/// </summary>
+/// <param name="method">Method name, e.g. "window/logMessage".</param>
+/// <param name="parameters">Parameters.</param>
+/// <returns>Notification message.</returns>
+let notification (method: string) (parameters: JsonNode) : JsonObject =
+  JsonObject(
+    dict
+      [ "method", JsonValue.Create method :> JsonNode
+        "params", parameters ]
+  )
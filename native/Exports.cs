@@ -0,0 +1,281 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+using System;
+using System.Linq;
+using System.Runtime.InteropServices;
+using System.Text.Json;
+using System.Text.Json.Nodes;
+using Gazelle.Analysis;
+using Gazelle.Model;
+using Microsoft.FSharp.Collections;
+using Microsoft.FSharp.Core;
+
+namespace Gazelle.Native;
+
+/// <summary>
+/// C ABI over the library, so Python, C# or MATLAB can load models, analyse
+/// them and read results in-process.
+/// </summary>
+/// <remarks>
+/// Models and results files are passed as opaque handles, freed with
+/// <c>gz_model_free</c> and <c>gz_results_free</c>. Strings are UTF-8; those
+/// returned are owned by the caller and freed with <c>gz_string_free</c>.
+/// Functions return a null handle or string, or -1, on failure, after which
+/// <c>gz_last_error</c> describes the error on the calling thread.
+/// </remarks>
+public static class Exports
+{
+  [ThreadStatic]
+  private static string? lastError;
+
+  private static readonly JsonSerializerOptions JsonOptions =
+    new() { PropertyNamingPolicy = JsonNamingPolicy.CamelCase };
+
+  private static IntPtr Fail(string message)
+  {
+    lastError = message;
+    return IntPtr.Zero;
+  }
+
+  private static string Text(IntPtr ptr) =>
+    ptr == IntPtr.Zero ? "" : Marshal.PtrToStringUTF8(ptr) ?? "";
+
+  private static IntPtr OwnedText(string s) => Marshal.StringToCoTaskMemUTF8(s);
+
+  private static IntPtr Json<T>(T value) =>
+    OwnedText(JsonSerializer.Serialize(value, JsonOptions));
+
+  private static IntPtr Allocate(object value) =>
+    GCHandle.ToIntPtr(GCHandle.Alloc(value));
+
+  private static T? Target<T>(IntPtr handle)
+    where T : class =>
+    handle == IntPtr.Zero ? null : GCHandle.FromIntPtr(handle).Target as T;
+
+  private static void Release(IntPtr handle)
+  {
+    if (handle == IntPtr.Zero)
+      return;
+
+    var h = GCHandle.FromIntPtr(handle);
+    (h.Target as IDisposable)?.Dispose();
+    h.Free();
+  }
+
+  // Exceptions must not cross the ABI, so each export reports them through
+  // gz_last_error instead.
+  private static IntPtr Guard(Func<IntPtr> f)
+  {
+    try
+    {
+      return f();
+    }
+    catch (Exception ex)
+    {
+      return Fail(ex.Message);
+    }
+  }
+
+  /// <summary>Returns the library version, e.g. "0.0.9".</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_version")]
+  public static IntPtr Version()
+  {
+    var v = typeof(Model.Model).Assembly.GetName().Version;
+    return OwnedText($"{v?.Major}.{v?.Minor}.{v?.Build}");
+  }
+
+  /// <summary>Returns the last error on the calling thread, or null.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_last_error")]
+  public static IntPtr LastError() =>
+    lastError is null ? IntPtr.Zero : OwnedText(lastError);
+
+  /// <summary>Frees a string returned by the library.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_string_free")]
+  public static void FreeString(IntPtr s) => Marshal.FreeCoTaskMem(s);
+
+  /// <summary>Reads a model file, returning a model handle.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_model_load")]
+  public static IntPtr LoadModel(IntPtr path) =>
+    Guard(() =>
+    {
+      var format = FSharpOption<ModelFormat>.None;
+      var result = ModelModule.read(format, Text(path));
+
+      return result.IsOk
+        ? Allocate(result.ResultValue)
+        : Fail(ModelErrorModule.getAsString(result.ErrorValue));
+    });
+
+  /// <summary>Frees a model handle.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_model_free")]
+  public static void FreeModel(IntPtr model) => Release(model);
+
+  /// <summary>Serialises a model to JSON.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_model_json")]
+  public static IntPtr ModelJson(IntPtr model) =>
+    Guard(() =>
+      Target<Model.Model>(model) is { } m
+        ? OwnedText(ModelModule.serialize(ModelFormat.Json, m))
+        : Fail("Invalid model handle."));
+
+  /// <summary>
+  /// Validates a model, returning JSON lists of errors and warnings.
+  /// </summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_model_validate")]
+  public static IntPtr ValidateModel(IntPtr model) =>
+    Guard(() =>
+    {
+      if (Target<Model.Model>(model) is not { } m)
+        return Fail("Invalid model handle.");
+
+      var report = Validation.validate(m);
+
+      return Json(new
+      {
+        Errors = report.Errors.Select(ValidationErrorModule.getAsString),
+        Warnings = report.Warnings.Select(ValidationWarningModule.getAsString)
+      });
+    });
+
+  // Nodal values by node and DOF name, as results files hold them.
+  private static JsonObject Named(
+    FSharpMap<string, FSharpMap<Dof, double>> values
+  )
+  {
+    var nodes = new JsonObject();
+
+    foreach (var node in values)
+    {
+      var dofs = new JsonObject();
+
+      foreach (var dof in node.Value)
+        dofs[DofModule.getAsString(dof.Key)] = dof.Value;
+
+      nodes[node.Key] = dofs;
+    }
+
+    return nodes;
+  }
+
+  // Forces of each element, in the order StaticResult holds them.
+  private static JsonObject Forces(FSharpMap<string, double[]> values)
+  {
+    var elements = new JsonObject();
+
+    foreach (var element in values)
+      elements[element.Key] = new JsonArray(
+        element.Value.Select(x => (JsonNode?)x).ToArray()
+      );
+
+    return elements;
+  }
+
+  // Static response to one load set, built as a JSON tree rather than by
+  // reflection, which ahead-of-time compilation trims away.
+  private static JsonObject Response(LoadSet set, StaticResult r) =>
+    new()
+    {
+      ["name"] = set.Name,
+      ["kind"] = set.Kind.IsLoadCase ? "Case" : "Combination",
+      ["displacements"] = Named(r.Displacements),
+      ["reactions"] = Named(r.Reactions),
+      ["memberForces"] = Forces(r.MemberForces),
+      ["plateForces"] = Forces(r.PlateForces),
+      ["springForces"] = Named(r.SpringForces)
+    };
+
+  /// <summary>
+  /// Analyses every load case and combination of a model by linear static
+  /// analysis, returning JSON displacements, reactions and member forces
+  /// per load set.
+  /// </summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_analyze")]
+  public static IntPtr Analyze(IntPtr model) =>
+    Guard(() =>
+    {
+      if (Target<Model.Model>(model) is not { } m)
+        return Fail("Invalid model handle.");
+
+      var sets = LoadCases.select(m, null, null);
+
+      if (sets.IsError)
+        return Fail(SelectionErrorModule.getAsString(sets.ErrorValue));
+
+      var results = new JsonArray();
+
+      foreach (var set in sets.ResultValue)
+      {
+        var analysed = Static.analyse(m, set);
+
+        if (analysed.IsError)
+          return Fail(
+            $"{set.Name}: {StaticErrorModule.getAsString(analysed.ErrorValue)}"
+          );
+
+        results.Add(Response(set, analysed.ResultValue));
+      }
+
+      return OwnedText(results.ToJsonString());
+    });
+
+  /// <summary>Opens a JSON Lines results file, returning a handle.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_results_open")]
+  public static IntPtr OpenResults(IntPtr path) =>
+    Guard(() =>
+    {
+      var result = ResultFileModule.openFile(Text(path));
+
+      return result.IsOk
+        ? Allocate(result.ResultValue)
+        : Fail(ResultFileErrorModule.getAsString(result.ErrorValue));
+    });
+
+  /// <summary>Returns the number of records in a results file, or -1.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_results_count")]
+  public static int CountResults(IntPtr results)
+  {
+    if (Target<ResultFile>(results) is { } f)
+      return ResultFileModule.count(f);
+
+    Fail("Invalid results handle.");
+    return -1;
+  }
+
+  /// <summary>
+  /// Reads one block of a record as JSON, for the comma-separated node or
+  /// element IDs given, or for all when ids is null or empty.
+  /// </summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_results_select")]
+  public static IntPtr SelectResults(
+    IntPtr results,
+    int record,
+    IntPtr block,
+    IntPtr ids
+  ) =>
+    Guard(() =>
+    {
+      if (Target<ResultFile>(results) is not { } f)
+        return Fail("Invalid results handle.");
+
+      var names = Text(ids)
+        .Split(',', StringSplitOptions.RemoveEmptyEntries)
+        .Select(id => id.Trim());
+
+      var entries = ResultFileModule.select(
+        f,
+        record,
+        Text(block),
+        ListModule.OfSeq(names)
+      );
+
+      return entries.IsOk
+        ? Json(entries.ResultValue)
+        : Fail(ResultFileErrorModule.getAsString(entries.ErrorValue));
+    });
+
+  /// <summary>Closes a results file and frees its handle.</summary>
+  [UnmanagedCallersOnly(EntryPoint = "gz_results_free")]
+  public static void FreeResults(IntPtr results) => Release(results);
+}
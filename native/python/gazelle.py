@@ -0,0 +1,144 @@
+# SPDX-License-Identifier: AGPL-3.0-or-later
+# Gazelle: a fast, cross-platform engine for structural analysis & design.
+# Copyright (C) 2024 James S. Bayley
+
+"""Thin ctypes wrapper over the Gazelle native library.
+
+Build the library with ``dotnet publish native -r linux-x64 -c Release``
+(or ``win-x64``, ``osx-arm64``) and point ``GAZELLE_NATIVE`` at the
+resulting ``gazelle_native`` shared library, or pass its path to ``load``.
+
+    import gazelle
+    with gazelle.Model("bridge.json") as model:
+        print(model.validate())
+        print(model.analyze())
+"""
+
+import ctypes
+import json
+import os
+
+_lib = None
+
+
+def load(path=None):
+    """Loads the native library, from ``path`` or ``GAZELLE_NATIVE``."""
+    global _lib
+    default = os.environ.get("GAZELLE_NATIVE", "gazelle_native")
+    lib = ctypes.CDLL(path or default)
+
+    handle, text, number = ctypes.c_void_p, ctypes.c_char_p, ctypes.c_int
+    signatures = {
+        "gz_version": ([], handle),
+        "gz_last_error": ([], handle),
+        "gz_string_free": ([handle], None),
+        "gz_model_load": ([text], handle),
+        "gz_model_free": ([handle], None),
+        "gz_model_json": ([handle], handle),
+        "gz_model_validate": ([handle], handle),
+        "gz_analyze": ([handle], handle),
+        "gz_results_open": ([text], handle),
+        "gz_results_count": ([handle], number),
+        "gz_results_select": ([handle, number, text, text], handle),
+        "gz_results_free": ([handle], None),
+    }
+
+    for name, (arguments, result) in signatures.items():
+        function = getattr(lib, name)
+        function.argtypes = arguments
+        function.restype = result
+
+    _lib = lib
+    return lib
+
+
+def _library():
+    return _lib or load()
+
+
+class GazelleError(Exception):
+    """Error reported by the native library."""
+
+
+def _check(pointer):
+    """Returns an owned string as text, raising the last error on null."""
+    lib = _library()
+
+    if not pointer:
+        error = lib.gz_last_error()
+        message = ctypes.string_at(error).decode() if error else "unknown"
+        if error:
+            lib.gz_string_free(error)
+        raise GazelleError(message)
+
+    try:
+        return ctypes.string_at(pointer).decode()
+    finally:
+        lib.gz_string_free(pointer)
+
+
+def _handle(pointer):
+    if not pointer:
+        _check(pointer)
+    return pointer
+
+
+def version():
+    """Returns the version of the native library."""
+    return _check(_library().gz_version())
+
+
+class Model:
+    """Structural model loaded from a file."""
+
+    def __init__(self, path):
+        self._handle = _handle(_library().gz_model_load(path.encode()))
+
+    def to_json(self):
+        return json.loads(_check(_library().gz_model_json(self._handle)))
+
+    def validate(self):
+        return json.loads(_check(_library().gz_model_validate(self._handle)))
+
+    def analyze(self):
+        return json.loads(_check(_library().gz_analyze(self._handle)))
+
+    def close(self):
+        if self._handle:
+            _library().gz_model_free(self._handle)
+            self._handle = None
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *_):
+        self.close()
+
+
+class Results:
+    """JSON Lines results file, read one record at a time."""
+
+    def __init__(self, path):
+        self._handle = _handle(_library().gz_results_open(path.encode()))
+
+    def __len__(self):
+        return _library().gz_results_count(self._handle)
+
+    def select(self, record, block="displacements", ids=()):
+        """Returns the entries of a block for the given node or element IDs,
+        or for all of them when none are given."""
+        pointer = _library().gz_results_select(
+            self._handle, record, block.encode(), ",".join(ids).encode()
+        )
+        return json.loads(_check(pointer))
+
+    def close(self):
+        if self._handle:
+            _library().gz_results_free(self._handle)
+            self._handle = None
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *_):
+        self.close()
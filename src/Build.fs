@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle
+
+open System
+open System.Reflection
+open System.Runtime.InteropServices
+open System.Text.Json
+
+/// <summary>
+/// Build metadata reported by gz version, for triaging reports of
+/// numerical differences between builds.
+/// </summary>
+type BuildInfo =
+  {
+    /// Assembly version, e.g. "1.2.0".
+    Version: string
+    /// Git commit the build was made from, or "unknown".
+    Commit: string
+    /// UTC time of the build in ISO 8601, or "unknown".
+    BuildDate: string
+    /// .NET runtime, e.g. ".NET 9.0.0".
+    Runtime: string
+    /// Runtime identifier, e.g. "linux-x64".
+    Platform: string
+    /// Linear solvers compiled into the build, e.g. "skyline", then any
+    /// optional interop, e.g. "etabs".
+    Backends: string array
+  }
+
+[<RequireQualifiedAccess>]
+module BuildInfo =
+
+  let private jsonOptions =
+    JsonSerializerOptions(
+      PropertyNamingPolicy = JsonNamingPolicy.CamelCase,
+      WriteIndented = true
+    )
+
+  /// Reads metadata injected at compile time, e.g. -p:GitCommit=<sha>.
+  let private metadata (assembly: Assembly) (key: string) =
+    assembly.GetCustomAttributes<AssemblyMetadataAttribute>()
+    |> Seq.tryFind (fun a -> a.Key = key && not (String.IsNullOrEmpty a.Value))
+    |> Option.map (fun a -> a.Value)
+    |> Option.defaultValue "unknown"
+
+  /// Linear solvers and optional interop compiled into this build.
+  let backends: string array =
+    [| yield! Gazelle.Analysis.LinearSolver.all
+       if Gazelle.IO.ETABS.ETABS.isAvailable then
+         "etabs" |]
+
+  /// <summary>
+  /// Returns the build metadata of an assembly and the running process.
+  /// </summary>
+  /// <param name="assembly">Assembly carrying GitCommit and BuildDate.</param>
+  /// <returns>Build metadata.</returns>
+  let ofAssembly (assembly: Assembly) : BuildInfo =
+    { Version = assembly.GetName().Version.ToString(3)
+      Commit = metadata assembly "GitCommit"
+      BuildDate = metadata assembly "BuildDate"
+      Runtime = RuntimeInformation.FrameworkDescription
+      Platform = RuntimeInformation.RuntimeIdentifier
+      Backends = backends }
+
+  /// <summary>
+  /// Serialises build metadata as printed by gz version --format json, with
+  /// camel-case fields in declaration order.
+  /// </summary>
+  /// <param name="info">Build metadata.</param>
+  /// <returns>Indented JSON object.</returns>
+  let toJson (info: BuildInfo) : string =
+    JsonSerializer.Serialize(info, jsonOptions)
@@ -0,0 +1,529 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open Gazelle.Model
+
+/// <summary>
+/// Errors raised whilst translating a model into an Abaqus input file.
+/// </summary>
+type AbaqusError =
+  | UnexportableElement of element: string * reason: string
+  | UnexportableSupport of support: string * reason: string
+  | UnexportableLoad of LoadError
+
+[<RequireQualifiedAccess>]
+module AbaqusError =
+
+  let getAsString (e: AbaqusError) : string =
+    match e with
+    | UnexportableElement(element, reason) ->
+      $"Element '{element}' cannot be exported to Abaqus: {reason}."
+    | UnexportableSupport(support, reason) ->
+      $"Constraint '{support}' cannot be exported to Abaqus: {reason}."
+    | UnexportableLoad e -> LoadError.getAsString e
+
+/// <summary>
+/// Abaqus input files (.inp) of models, for academic and commercial finite
+/// element workflows built around Abaqus/Standard.
+/// </summary>
+/// <remarks>
+/// Nodes and elements are numbered 1, 2, ... in the order of their IDs,
+/// which a table at the end of the file lists. Truss members become T2D2
+/// or T3D2 trusses, cables and struts of materials with *NO COMPRESSION or
+/// *NO TENSION; frames B23 or B33 Euler-Bernoulli beams of general sections
+/// whose 1-axis is Gazelle's member y, with their end releases; plates and
+/// shells S3 or S4 shells; springs and elastic supports SPRING1 and SPRING2
+/// elements; and rigid links BEAM multi-point constraints. Each load set is
+/// a linear perturbation step of its own: uniform loads along whole frames
+/// become PX, PY or PZ distributed loads, pressures on plates and shells P
+/// loads, self-weight a GRAV load and every other load Gazelle's equivalent
+/// nodal loads as *CLOAD. Support settlements are imposed in every step.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module AbaqusExport =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  let private real (x: float) = x.ToString("R", culture)
+
+  /// Name of a material or step, quoted to keep its case and characters.
+  let private quote (name: string) = "\"" + name.Replace("\"", "'") + "\""
+
+  /// Applies a function to each item in order, stopping at the first error.
+  let private traverse (f: 'T -> Result<'U, AbaqusError>) (items: 'T list) =
+    let folder acc item =
+      match acc, f item with
+      | Ok xs, Ok x -> Ok(x :: xs)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.fold folder (Ok []) items |> Result.map List.rev
+
+  /// Element of an Abaqus element set: its label, type, node labels, and
+  /// the keyword and data lines of the set's section.
+  type private Piece =
+    { Label: int
+      Type: string
+      Nodes: int list
+      Section: string * string list }
+
+  /// Abaqus number of a freedom.
+  let private number (d: Dof) =
+    match d with
+    | Ux -> 1
+    | Uy -> 2
+    | Uz -> 3
+    | Rx -> 4
+    | Ry -> 5
+    | Rz -> 6
+
+  /// <summary>
+  /// Writes a model as an Abaqus input file that analyses its load sets
+  /// linearly, as Gazelle's static analysis does.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="sets">Load sets to analyse, e.g. from LoadCases.select.
+  /// </param>
+  /// <returns>Input file, or the first part that Abaqus cannot take.
+  /// </returns>
+  let toInput (m: Model) (sets: LoadSet list) : Result<string, AbaqusError> =
+    let members =
+      m.Elements
+      |> Map.values
+      |> Seq.filter (fun e -> e.Type <> "Spring" && e.Type <> "RigidLink")
+      |> List.ofSeq
+
+    // Plane models, or models of plane members only, take three freedoms.
+    let plane =
+      Dof.ofDimensions m = Dof.plane
+      || not members.IsEmpty
+         && members |> List.forall (fun e -> e.Type.EndsWith "2D")
+
+    let dofs = if plane then Dof.plane else Dof.all
+
+    let tags =
+      m.Nodes |> Map.keys |> Seq.mapi (fun i id -> id, i + 1) |> Map.ofSeq
+
+    let elementTags =
+      m.Elements |> Map.keys |> Seq.mapi (fun i id -> id, i + 1) |> Map.ofSeq
+
+    let next = ref m.Elements.Count
+
+    let fresh () =
+      next.Value <- next.Value + 1
+      next.Value
+
+    // Materials by name, with the option that limits them to tension or
+    // compression.
+    let materials = Collections.Generic.Dictionary<string, Material * string>()
+
+    let materialOf (e: Element) (material: Material) (option: string) =
+      let declared = m.Materials.TryFind e.Material = Some material
+      let name = if declared then e.Material else $"{e.Material}-{e.Id}"
+
+      let name =
+        match option with
+        | "" -> name
+        | "NO COMPRESSION" -> name + "-tension"
+        | _ -> name + "-compression"
+
+      materials[name] <- (material, option)
+      name
+
+    // One SPRING1 or SPRING2 element per freedom a stiffness acts along.
+    let springs (first: int option) (nodes: int list) stiffness =
+      stiffness
+      |> List.mapi (fun i (d: Dof, k: float) ->
+        let label =
+          match first with
+          | Some tag when i = 0 -> tag
+          | _ -> fresh ()
+
+        let freedoms =
+          List.replicate nodes.Length (string (number d)) |> String.concat ", "
+
+        { Label = label
+          Type = if nodes.Length = 1 then "SPRING1" else "SPRING2"
+          Nodes = nodes
+          Section = "*SPRING", [ freedoms; real k ] })
+
+    let stiffnessOf (e: Element) =
+      let properties = defaultArg e.Properties Map.empty
+
+      dofs
+      |> List.choose (fun d ->
+        properties.TryFind((Dof.getAsString d).ToLowerInvariant())
+        |> Option.map (fun k -> d, k))
+
+    let translate (id: string, e: Element) =
+      let tag = elementTags[id]
+      let fail reason = Error(UnexportableElement(id, reason))
+
+      let property (names: string list) =
+        let value =
+          e.Properties |> Option.bind (fun ps -> List.tryPick ps.TryFind names)
+
+        match value with
+        | Some x -> Ok x
+        | None -> fail $"needs property '{names.Head}'"
+
+      let nodes = e.Nodes |> List.map (fun n -> tags[n])
+
+      let piece kind section =
+        { Label = tag
+          Type = kind
+          Nodes = nodes
+          Section = section }
+
+      // Releases of a member, as Abaqus codes by end.
+      let releases () =
+        let given = defaultArg e.Releases Map.empty
+
+        [ for side, n in List.indexed e.Nodes |> List.truncate 2 do
+            let names = defaultArg (given.TryFind n) []
+
+            let codes =
+              if plane then
+                [ if List.contains "Rz" names then "M1" ]
+              else
+                [ if List.contains "Ry" names then "M1"
+                  if List.contains "Rz" names then "M2"
+                  if List.contains "Rx" names then "T" ]
+
+            match codes with
+            | [] -> ()
+            | [ _; _; _ ] -> $"{tag}, S{side + 1}, ALLM"
+            | codes -> $"{tag}, S{side + 1}, " + String.Join("-", codes) ]
+
+      let chord () =
+        match e.Nodes |> List.map m.Nodes.TryFind with
+        | [ Some a; Some b ] ->
+          Vector3.sub (Vector3.ofNode b) (Vector3.ofNode a)
+        | _ -> Vector3.zero
+
+      match e.Type, Materials.ofElement m e with
+      | _ when e.Nodes |> List.exists (fun n -> not (tags.ContainsKey n)) ->
+        fail "connects a node that does not exist"
+      | "RigidLink", _ ->
+        match nodes with
+        | master :: slaves when not slaves.IsEmpty ->
+          Ok([], [ for s in slaves -> $"BEAM, {s}, {master}" ], [])
+        | _ -> fail "must connect 2 or more nodes"
+      | "Spring", _ ->
+        match nodes, stiffnessOf e with
+        | _, [] -> fail "needs a stiffness such as 'ux'"
+        | ([ _ ] | [ _; _ ]), stiffness ->
+          Ok(springs (Some tag) nodes stiffness, [], [])
+        | _ -> fail "must connect 1 or 2 nodes"
+      | _, None -> fail $"needs material '{e.Material}'"
+      | ("Truss2D" | "Truss3D" | "Cable" | "Strut"), Some material ->
+        property [ "area"; "a" ]
+        |> Result.map (fun area ->
+          let option =
+            match e.Type with
+            | "Cable" -> "NO COMPRESSION"
+            | "Strut" -> "NO TENSION"
+            | _ -> ""
+
+          let name = materialOf e material option
+          let kind = if plane then "T2D2" else "T3D2"
+          let section = $"*SOLID SECTION, MATERIAL={quote name}", [ real area ]
+          [ piece kind section ], [], [])
+      | ("Beam2D" | "Beam3D"), _ ->
+        fail "Abaqus beams take axial load, so it must be a frame"
+      | "Frame2D", Some _ when not plane ->
+        fail "it is a plane member in a space model"
+      | ("Frame2D" | "Frame3D"), Some _ when Vector3.norm (chord ()) = 0.0 ->
+        fail "it has zero length"
+      | ("Frame2D" | "Frame3D"), Some material ->
+        let shear =
+          match material.ShearModulus with
+          | Some g -> Ok g
+          | None when plane -> Ok(material.ElasticModulus / 2.6)
+          | None -> fail $"needs the shear modulus of material '{e.Material}'"
+
+        let bending =
+          if plane then
+            property [ "i"; "iz" ]
+            |> Result.map (fun i -> i, i, i, { X = 0.0; Y = 0.0; Z = -1.0 })
+          else
+            let iz = property [ "iz"; "i" ]
+
+            match property [ "iy" ], iz, property [ "j" ] with
+            | Ok iy, Ok iz, Ok j ->
+              let _, y, _ = Vector3.memberAxes (chord ())
+              Ok(iy, iz, j, y)
+            | Error e, _, _
+            | _, Error e, _
+            | _, _, Error e -> Error e
+
+        match property [ "area"; "a" ], shear, bending with
+        | Error e, _, _
+        | _, Error e, _
+        | _, _, Error e -> Error e
+        | Ok area, Ok g, Ok(i11, i22, j, n1) ->
+          let density =
+            match material.Density with
+            | Some rho -> $", DENSITY={real rho}"
+            | None -> ""
+
+          let moduli =
+            [ real material.ElasticModulus; real g ]
+            @ (material.ThermalExpansion |> Option.map real |> Option.toList)
+
+          let section =
+            $"*BEAM GENERAL SECTION, SECTION=GENERAL{density}",
+            [ String.Join(", ", [ real area; real i11; "0."; real i22; real j ])
+              $"{real n1.X}, {real n1.Y}, {real n1.Z}"
+              String.Join(", ", moduli) ]
+
+          let kind = if plane then "B23" else "B33"
+          Ok([ piece kind section ], [], releases ())
+      | ("Plate" | "Shell"), Some _ when plane ->
+        fail "it is a plate in a plane model"
+      | ("Plate" | "Shell"), Some material ->
+        match property [ "thickness"; "t" ], material.ShearModulus, nodes with
+        | Error e, _, _ -> Error e
+        | _, None, _ ->
+          fail $"needs the shear modulus of material '{e.Material}'"
+        | Ok t, Some _, ([ _; _; _ ] | [ _; _; _; _ ]) ->
+          let name = materialOf e material ""
+          let kind = if nodes.Length = 4 then "S4" else "S3"
+          let section = $"*SHELL SECTION, MATERIAL={quote name}", [ real t ]
+          Ok([ piece kind section ], [], [])
+        | _ -> fail "it must connect 3 or 4 nodes"
+      | t, _ -> fail $"Abaqus has no counterpart to type '{t}'"
+
+    let supports =
+      m.Constraints
+      |> Map.toList
+      |> traverse (fun (id, c) ->
+        match c.Angle with
+        | Some angle when angle % 360.0 <> 0.0 ->
+          Error(UnexportableSupport(id, "Abaqus needs a transform for it"))
+        | _ when not (tags.ContainsKey c.Node) ->
+          Error(UnexportableSupport(id, $"node '{c.Node}' does not exist"))
+        | _ -> Ok c)
+
+    let held (c: Constraint) =
+      c.Dof
+      |> List.choose Dof.tryParse
+      |> List.filter (fun d -> List.contains d dofs)
+
+    let imposed (c: Constraint) (d: Dof) =
+      defaultArg c.Displacement Map.empty |> Map.tryFind (Dof.getAsString d)
+
+    let beams = set [ "Frame2D"; "Frame3D" ]
+
+    // Distributed load lines of loads Abaqus applies to elements directly,
+    // else the equivalent nodal loads.
+    let load (factor: float, l: Load) =
+      let target = l.Element |> Option.bind m.Elements.TryFind
+      let uniform = l.EndMagnitude |> Option.forall ((=) l.Magnitude)
+      let whole = defaultArg l.Position 0.0 = 0.0 && defaultArg l.End 1.0 = 1.0
+
+      match l.Type, target with
+      | "Distributed", Some e when
+        beams.Contains e.Type
+        && uniform
+        && whole
+        && List.contains l.Direction [ "Fx"; "Fy"; "Fz" ]
+        ->
+        let axis = "P" + l.Direction.Substring(1).ToUpperInvariant()
+        let tag = elementTags[e.Id]
+        Ok(Choice1Of2 $"{tag}, {axis}, {real (factor * l.Magnitude)}")
+      | "Pressure", Some e when
+        (e.Type = "Plate" || e.Type = "Shell") && l.Direction = "Normal"
+        ->
+        // Abaqus pressures push against the normal.
+        let tag = elementTags[e.Id]
+        Ok(Choice1Of2 $"{tag}, P, {real (-factor * l.Magnitude)}")
+      | "SelfWeight", None when l.Node.IsNone ->
+        match Gravity.acceleration (Gravity.resolve m) with
+        | Some(x, y, z) ->
+          let g = sqrt (x * x + y * y + z * z)
+          let scale = factor * l.Magnitude * g
+          let direction = [ x / g; y / g; z / g ] |> List.map real
+          let along = String.Join(", ", direction)
+          Ok(Choice1Of2 $"EALL, GRAV, {real scale}, {along}")
+        | None ->
+          let reason = "needs gravity with a direction"
+          Error(UnexportableLoad(UnsupportedLoad(l.Id, reason)))
+      | _ ->
+        NodalLoads.ofLoad m factor l
+        |> Result.mapError UnexportableLoad
+        |> Result.bind (fun loads ->
+          let missing (x: NodalLoad) = not (tags.ContainsKey x.Node)
+
+          match List.tryFind missing loads with
+          | Some x ->
+            let reason = $"acts on node '{x.Node}' which does not exist"
+            Error(UnexportableLoad(UnsupportedLoad(l.Id, reason)))
+          | None -> Ok(Choice2Of2 loads))
+
+    let step (supports: Constraint list) (set: LoadSet) =
+      set.Loads
+      |> traverse load
+      |> Result.map (fun translated ->
+        let distributed =
+          translated
+          |> List.choose (function
+            | Choice1Of2 x -> Some x
+            | _ -> None)
+
+        let concentrated =
+          [ for t in translated do
+              match t with
+              | Choice2Of2 loads -> yield! loads
+              | _ -> () ]
+          |> List.choose (fun x ->
+            Dof.ofDirection x.Direction
+            |> Option.filter (fun d -> List.contains d dofs)
+            |> Option.map (fun d -> (tags[x.Node], number d), x.Magnitude))
+          |> List.groupBy fst
+          |> List.map (fun ((node, d), xs) -> node, d, List.sumBy snd xs)
+          |> List.filter (fun (_, _, x) -> x <> 0.0)
+          |> List.sort
+
+        let settlements =
+          [ for c in supports do
+              for d in held c do
+                match imposed c d with
+                | Some u ->
+                  let n = number d
+                  $"{tags[c.Node]}, {n}, {n}, {real u}"
+                | None -> () ]
+
+        [ $"*STEP, NAME={quote set.Name}, PERTURBATION"
+          "*STATIC"
+          if not settlements.IsEmpty then
+            "*BOUNDARY"
+            yield! settlements
+          if not concentrated.IsEmpty then
+            "*CLOAD"
+
+            for node, d, x in concentrated do
+              $"{node}, {d}, {real x}"
+          if not distributed.IsEmpty then
+            "*DLOAD"
+            yield! distributed
+          "*NODE PRINT"
+          "U, RF"
+          "*END STEP" ])
+
+    let elements =
+      m.Elements |> Map.toList |> traverse translate
+
+    match supports, elements with
+    | Error e, _
+    | _, Error e -> Error e
+    | Ok supports, Ok translated ->
+      let pieces = translated |> List.collect (fun (p, _, _) -> p)
+      let links = translated |> List.collect (fun (_, l, _) -> l)
+      let released = translated |> List.collect (fun (_, _, r) -> r)
+
+      // Elastic supports, as springs to ground.
+      let grounded =
+        [ for c in supports do
+            let stiffness =
+              defaultArg c.Stiffness Map.empty
+              |> Map.toList
+              |> List.filter (fun (name, _) -> not (List.contains name c.Dof))
+              |> List.choose (fun (name, k) ->
+                Dof.tryParse name
+                |> Option.filter (fun d -> List.contains d dofs)
+                |> Option.map (fun d -> d, k))
+
+            yield! springs None [ tags[c.Node] ] stiffness ]
+
+      // One element set per element type and section.
+      let groups =
+        pieces @ grounded
+        |> List.groupBy (fun p -> p.Type, p.Section)
+        |> List.mapi (fun i ((kind, section), ps) ->
+          $"E{i + 1}", kind, section, ps)
+
+      let fixes =
+        [ for c in supports do
+            for d in held c do
+              if (imposed c d).IsNone then
+                let n = number d
+                $"{tags[c.Node]}, {n}, {n}" ]
+
+      sets
+      |> traverse (step supports)
+      |> Result.map (fun steps ->
+        let lines =
+          [ $"** Gazelle model '{m.Info.Name}', in {m.Info.Units}."
+            "** Nodes and elements are numbered in the order of their IDs."
+            "*HEADING"
+            m.Info.Name
+            "*NODE"
+            for KeyValue(id, n) in m.Nodes do
+              let coordinates =
+                if plane then [ n.X; n.Y ] else [ n.X; n.Y; n.Z ]
+
+              String.Join(", ", string tags[id] :: List.map real coordinates)
+            for name, kind, (keyword, data), ps in groups do
+              $"*ELEMENT, TYPE={kind}, ELSET={name}"
+
+              for p in List.sortBy (fun p -> p.Label) ps do
+                String.Join(", ", p.Label :: p.Nodes)
+
+              $"{keyword}, ELSET={name}"
+              yield! data
+            let structural =
+              groups
+              |> List.filter (fun (_, kind, _, _) ->
+                not (kind.StartsWith "SPRING"))
+              |> List.map (fun (name, _, _, _) -> name)
+            if not structural.IsEmpty then
+              "*ELSET, ELSET=EALL"
+              String.Join(", ", structural)
+            for KeyValue(name, (material, option)) in materials do
+              let poisson =
+                match material.ShearModulus with
+                | Some g -> material.ElasticModulus / (2.0 * g) - 1.0
+                | None -> 0.0
+
+              $"*MATERIAL, NAME={quote name}"
+              "*ELASTIC"
+              $"{real material.ElasticModulus}, {real poisson}"
+
+              match material.Density with
+              | Some rho ->
+                "*DENSITY"
+                real rho
+              | None -> ()
+
+              match material.ThermalExpansion with
+              | Some alpha ->
+                "*EXPANSION"
+                real alpha
+              | None -> ()
+
+              if option <> "" then
+                $"*{option}"
+            if not released.IsEmpty then
+              "*RELEASE"
+              yield! released
+            if not links.IsEmpty then
+              "*MPC"
+              yield! links
+            if not fixes.IsEmpty then
+              "*BOUNDARY"
+              yield! fixes
+            yield! List.concat steps
+            "** Node labels"
+            for KeyValue(id, tag) in tags do
+              $"** {tag}, {id}"
+            "** Element labels"
+            for KeyValue(id, tag) in elementTags do
+              $"** {tag}, {id}" ]
+
+        String.Join("\n", lines) + "\n")
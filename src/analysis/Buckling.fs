@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Flexural buckling properties of a member about one section axis.
+/// </summary>
+type MemberBuckling =
+  { Element: string
+    /// Section axis, e.g. "y" or "z"; empty for planar members.
+    Axis: string
+    EffectiveLengthFactor: float
+    EffectiveLength: float
+    /// Effective length over radius of gyration.
+    Slenderness: float
+    /// Elastic critical (Euler) load.
+    CriticalLoad: float }
+
+/// <summary>
+/// Errors raised whilst deriving member buckling properties.
+/// </summary>
+type BucklingError =
+  | MissingProperty of element: string * property: string
+  | UndefinedMaterial of element: string * material: string
+
+[<RequireQualifiedAccess>]
+module BucklingError =
+
+  let getAsString (e: BucklingError) : string =
+    match e with
+    | MissingProperty(element, property) ->
+      $"Missing Property: element '{element}' needs '{property}'."
+    | UndefinedMaterial(element, material) ->
+      $"Undefined Material: element '{element}' uses '{material}'."
+
+/// <summary>
+/// Elastic flexural buckling of members under axial compression.
+/// </summary>
+/// <remarks>
+/// Effective length factors are taken from the "k", "ky" or "kz" element
+/// properties. Otherwise they are derived from the member's end conditions
+/// using theoretical values: 0.5 fixed-fixed, 0.7 fixed-pinned, 1.0
+/// pinned-pinned and 2.0 fixed-free. Ends connected to other elements are
+/// treated as pinned, i.e. a braced frame is assumed, as are ends that
+/// release a rotation.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Buckling =
+
+  type private EndCondition =
+    | Fixed
+    | Pinned
+    | Free
+
+  let private endCondition (m: Model) (e: Element) (node: string) =
+    let rotations =
+      Dof.ofElementType e.Type
+      |> Option.defaultValue Dof.all
+      |> List.filter (fun d -> List.contains d [ Rx; Ry; Rz ])
+
+    let restrained =
+      [ for KeyValue(_, c) in m.Constraints do
+          if c.Node = node then
+            yield! c.Dof |> List.choose Dof.tryParse ]
+
+    let released =
+      e.Releases
+      |> Option.bind (fun rs -> rs.TryFind node)
+      |> Option.defaultValue []
+      |> List.choose Dof.tryParse
+
+    let connected =
+      m.Elements
+      |> Map.exists (fun id other ->
+        id <> e.Id && List.contains node other.Nodes)
+
+    let isFixed =
+      not rotations.IsEmpty
+      && rotations |> List.forall (fun r -> List.contains r restrained)
+      && rotations |> List.forall (fun r -> not (List.contains r released))
+
+    match restrained, connected with
+    | [], false -> Free
+    | _ when isFixed -> Fixed
+    | _ -> Pinned
+
+  /// <summary>
+  /// Derives the effective length factor of a member from its end conditions.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="e">Two-node member.</param>
+  /// <returns>Effective length factor.</returns>
+  let effectiveLengthFactor (m: Model) (e: Element) : float =
+    match e.Nodes |> List.map (endCondition m e) with
+    | [ Fixed; Fixed ] -> 0.5
+    | [ Fixed; Pinned ]
+    | [ Pinned; Fixed ] -> 0.7
+    | [ Fixed; Free ]
+    | [ Free; Fixed ] -> 2.0
+    | _ -> 1.0
+
+  /// <summary>
+  /// Derives the buckling properties of a member about each section axis
+  /// for which a second moment of area ("i", "iy" or "iz") is given.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="e">Two-node member with an "area" property.</param>
+  /// <returns>Buckling properties per axis, or BucklingError.</returns>
+  let ofElement
+    (m: Model)
+    (e: Element)
+    : Result<MemberBuckling list, BucklingError> =
+    let properties = e.Properties |> Option.defaultValue Map.empty
+    let property (names: string list) = names |> List.tryPick properties.TryFind
+
+    let length =
+      match e.Nodes |> List.map (fun n -> Vector3.ofNode m.Nodes[n]) with
+      | [ a; b ] -> Vector3.norm (Vector3.sub b a)
+      | _ -> 0.0
+
+    let axes =
+      [ "", "i", "k"; "y", "iy", "ky"; "z", "iz", "kz" ]
+      |> List.choose (fun (axis, i, k) ->
+        properties.TryFind i |> Option.map (fun i -> axis, i, k))
+
+    match Materials.ofElement m e, property [ "area"; "a" ], axes with
+    | None, _, _ -> Error(UndefinedMaterial(e.Id, e.Material))
+    | _, None, _ -> Error(MissingProperty(e.Id, "area"))
+    | _, _, [] -> Error(MissingProperty(e.Id, "i"))
+    | Some material, Some area, axes ->
+      axes
+      |> List.map (fun (axis, i, k) ->
+        let factor =
+          property [ k; "k" ]
+          |> Option.defaultWith (fun () -> effectiveLengthFactor m e)
+
+        let effective = factor * length
+
+        { Element = e.Id
+          Axis = axis
+          EffectiveLengthFactor = factor
+          EffectiveLength = effective
+          Slenderness = effective / sqrt (i / area)
+          CriticalLoad =
+            Math.PI ** 2.0 * material.ElasticModulus * i / effective ** 2.0 })
+      |> Ok
+
+  /// <summary>
+  /// Derives buckling properties for every two-node member in a model.
+  /// Cables carry tension only and so are skipped.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Buckling properties, or the first BucklingError.</returns>
+  let ofModel (m: Model) : Result<MemberBuckling list, BucklingError> =
+    let folder (e: Element) acc =
+      match ofElement m e, acc with
+      | Ok xs, Ok rest -> Ok(xs @ rest)
+      | Error err, _
+      | _, Error err -> Error err
+
+    let members =
+      m.Elements
+      |> Map.toList
+      |> List.map snd
+      |> List.filter (fun e ->
+        e.Nodes.Length = 2 && e.Type <> "Cable" && Materials.isRequired e)
+
+    List.foldBack folder members (Ok [])
+
+  /// <summary>
+  /// Returns the buckling utilisation of a member under an axial force,
+  /// i.e. compression over the elastic critical load.
+  /// </summary>
+  /// <param name="axialForce">Axial force; tension positive.</param>
+  /// <param name="b">Buckling properties about one axis.</param>
+  /// <returns>Utilisation; zero in tension.</returns>
+  let utilisation (axialForce: float) (b: MemberBuckling) : float =
+    max 0.0 (-axialForce) / b.CriticalLoad
@@ -0,0 +1,402 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.IO
+open Gazelle.Model
+
+/// <summary>
+/// Quantity measured on a structure, e.g. by a sensor.
+/// </summary>
+type Measurement =
+  /// Displacement of a node along a degree of freedom under a load set.
+  | MeasuredDisplacement of set: string * node: string * dof: Dof * value: float
+  /// Natural frequency of a mode, numbered from 1, in hertz.
+  | MeasuredFrequency of mode: int * value: float
+
+/// <summary>
+/// Measured value beside the model's prediction of it.
+/// </summary>
+type CalibrationComparison =
+  { Measurement: Measurement
+    Measured: float
+    Predicted: float
+    /// (Predicted - Measured) / |Measured|.
+    Error: float }
+
+/// <summary>
+/// Parameters tuned to fit measurements, and the fit before and after.
+/// </summary>
+type CalibrationResult =
+  { Initial: Map<string, float>
+    Tuned: Map<string, float>
+    Before: CalibrationComparison list
+    After: CalibrationComparison list
+    /// Least-squares iterations, each differencing every parameter.
+    Iterations: int
+    /// Whether the fit stopped improving before the iteration limit.
+    Converged: bool }
+
+/// <summary>
+/// Errors raised whilst comparing a model with measurements.
+/// </summary>
+type CalibrationError =
+  | MalformedMeasurements of line: int * reason: string
+  | UnreadableMeasurements of reason: string
+  | UnknownLoadSet of name: string
+  | UnpredictedFreedom of node: string * dof: Dof
+  | MissingMode of mode: int
+  | UntunableParameter of name: string
+  | FailedPrediction of reason: string
+
+[<RequireQualifiedAccess>]
+module CalibrationError =
+
+  let getAsString (e: CalibrationError) : string =
+    match e with
+    | MalformedMeasurements(line, reason) ->
+      $"Malformed measurements: line {line} {reason}."
+    | UnreadableMeasurements reason -> $"Cannot read measurements: {reason}"
+    | UnknownLoadSet name -> $"Measured load set '{name}' is not in the model."
+    | UnpredictedFreedom(node, dof) ->
+      $"Model predicts no {Dof.getAsString dof} displacement of node '{node}'."
+    | MissingMode mode -> $"Model has no mode {mode} to compare."
+    | UntunableParameter name ->
+      $"Parameter '{name}' cannot be tuned: it must be a declared, \
+        positive model parameter."
+    | FailedPrediction reason -> $"Cannot predict measurements: {reason}"
+
+/// <summary>
+/// Compares a model with measurements of the structure it represents, and
+/// tunes its parameters to fit them, for structural health monitoring.
+/// </summary>
+/// <remarks>
+/// Measurements are displacements under load sets, analysed statically,
+/// and natural frequencies. Each is compared by its relative error, so
+/// that millimetres and hertz weigh alike. Tuning varies named model
+/// parameters, e.g. an elastic modulus or spring stiffness declared in the
+/// "parameters" block, to minimise the sum of the squared relative errors
+/// by Levenberg-Marquardt iteration with forward-difference derivatives.
+/// Parameters vary on a logarithmic scale, so they stay positive and those
+/// of different magnitudes converge alike.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Calibration =
+
+  /// Iterations after which tuning stops.
+  let private limit = 50
+
+  /// Relative change of a parameter when differencing.
+  let private step = 1e-6
+
+  /// Relative fall in the squared error at which tuning stops.
+  let private tolerance = 1e-10
+
+  /// <summary>
+  /// Parses measurements from text, e.g. CSV, with one per line:
+  /// "displacement, set, node, dof, value" or "frequency, mode, value".
+  /// </summary>
+  /// <param name="text">Measurement text.</param>
+  /// <returns>Measurements in order, or MalformedMeasurements.</returns>
+  let parse (text: string) : Result<Measurement list, CalibrationError> =
+    let culture = CultureInfo.InvariantCulture
+    let styles = NumberStyles.Float
+
+    let number (s: string) =
+      match Double.TryParse(s, styles, culture) with
+      | true, x when Double.IsFinite x -> Some x
+      | _ -> None
+
+    let fields (line: string) =
+      line.Split([| ','; ';'; '\t' |]) |> Array.map (fun f -> f.Trim())
+
+    let measurement (line: int, text: string) =
+      let malformed reason = Error(MalformedMeasurements(line, reason))
+
+      let measured (value: string) =
+        match number value with
+        | Some 0.0 -> malformed "measures zero, which has no relative error"
+        | Some x -> Ok x
+        | None -> malformed $"has value '{value}'"
+
+      match fields text with
+      | [| kind; set; node; dof; value |] when
+        kind.ToLowerInvariant() = "displacement"
+        ->
+        match Dof.tryParse dof with
+        | Some d ->
+          measured value
+          |> Result.map (fun x -> MeasuredDisplacement(set, node, d, x))
+        | None -> malformed $"has degree of freedom '{dof}'"
+      | [| kind; mode; value |] when kind.ToLowerInvariant() = "frequency" ->
+        match Int32.TryParse mode with
+        | true, n when n > 0 ->
+          measured value |> Result.map (fun x -> MeasuredFrequency(n, x))
+        | _ -> malformed $"has mode '{mode}'"
+      | fs ->
+        malformed $"has quantity '{fs[0]}', not displacement or frequency"
+
+    let lines =
+      text.Split('\n')
+      |> Array.mapi (fun i line -> i + 1, line.Trim())
+      |> Array.filter (fun (_, line) -> line <> "" && not (line.StartsWith '#'))
+      |> List.ofArray
+
+    let quantities = [ "displacement"; "frequency" ]
+
+    // A header names the columns rather than a quantity.
+    let rows =
+      match lines with
+      | (_, first) :: rest when
+        let header = fields first
+        not (List.contains (header[0].ToLowerInvariant()) quantities)
+        ->
+        rest
+      | all -> all
+
+    let folder row acc =
+      match measurement row, acc with
+      | Ok x, Ok rest -> Ok(x :: rest)
+      | Error e, _
+      | _, Error e -> Error e
+
+    match List.foldBack folder rows (Ok []) with
+    | Ok [] -> Error(MalformedMeasurements(0, "has no measurements"))
+    | other -> other
+
+  /// <summary>
+  /// Reads a measurements file.
+  /// </summary>
+  /// <param name="path">Path to measurements file, e.g. CSV.</param>
+  /// <returns>Measurements, or CalibrationError.</returns>
+  let read (path: string) : Result<Measurement list, CalibrationError> =
+    try
+      File.ReadAllText path |> parse
+    with
+    | :? IOException as ex -> Error(UnreadableMeasurements ex.Message)
+    | :? UnauthorizedAccessException as ex ->
+      Error(UnreadableMeasurements ex.Message)
+
+  /// <summary>
+  /// Compares measurements with the model's predictions of them.
+  /// </summary>
+  /// <param name="mass">Mass matrix for natural frequencies.</param>
+  /// <param name="m">Model.</param>
+  /// <param name="measurements">Measurements.</param>
+  /// <returns>Comparisons in order, or CalibrationError.</returns>
+  let compare
+    (mass: MassMatrix)
+    (m: Model)
+    (measurements: Measurement list)
+    : Result<CalibrationComparison list, CalibrationError> =
+    let sets =
+      measurements
+      |> List.choose (function
+        | MeasuredDisplacement(set, _, _, _) -> Some set
+        | _ -> None)
+      |> List.distinct
+
+    let modes =
+      measurements
+      |> List.choose (function
+        | MeasuredFrequency(mode, _) -> Some mode
+        | _ -> None)
+
+    // Displacements under each measured load set.
+    let displacements =
+      match LoadCases.select m None None with
+      | Error e -> Error(FailedPrediction(SelectionError.getAsString e))
+      | Ok available ->
+        sets
+        |> List.fold
+          (fun acc name ->
+            acc
+            |> Result.bind (fun found ->
+              match available |> List.tryFind (fun s -> s.Name = name) with
+              | None -> Error(UnknownLoadSet name)
+              | Some set ->
+                Static.analyse m set
+                |> Result.mapError (
+                  StaticError.getAsString >> FailedPrediction
+                )
+                |> Result.map (fun r -> Map.add name r.Displacements found)))
+          (Ok Map.empty)
+
+    let frequencies =
+      match modes with
+      | [] -> Ok []
+      | _ ->
+        Modal.analyse mass (List.max modes) m
+        |> Result.mapError (ModalError.getAsString >> FailedPrediction)
+        |> Result.map (fun r -> r.Modes |> List.map Modal.frequency)
+
+    let predict displacements (frequencies: float list) measurement =
+      match measurement with
+      | MeasuredDisplacement(set, node, dof, _) ->
+        Map.find set displacements
+        |> Map.tryFind node
+        |> Option.bind (Map.tryFind dof)
+        |> Option.map Ok
+        |> Option.defaultValue (Error(UnpredictedFreedom(node, dof)))
+      | MeasuredFrequency(mode, _) ->
+        List.tryItem (mode - 1) frequencies
+        |> Option.map Ok
+        |> Option.defaultValue (Error(MissingMode mode))
+
+    match displacements, frequencies with
+    | Error e, _
+    | _, Error e -> Error e
+    | Ok displacements, Ok frequencies ->
+      List.foldBack
+        (fun measurement acc ->
+          match predict displacements frequencies measurement, acc with
+          | Ok predicted, Ok rest ->
+            let measured =
+              match measurement with
+              | MeasuredDisplacement(_, _, _, x)
+              | MeasuredFrequency(_, x) -> x
+
+            let comparison =
+              { Measurement = measurement
+                Measured = measured
+                Predicted = predicted
+                Error = (predicted - measured) / abs measured }
+
+            Ok(comparison :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        measurements
+        (Ok [])
+
+  /// <summary>
+  /// Returns the root mean square of the relative errors of comparisons.
+  /// </summary>
+  /// <param name="comparisons">Comparisons.</param>
+  /// <returns>RMS relative error, or 0 for none.</returns>
+  let rms (comparisons: CalibrationComparison list) : float =
+    match comparisons with
+    | [] -> 0.0
+    | _ -> comparisons |> List.averageBy (fun c -> c.Error * c.Error) |> sqrt
+
+  /// <summary>
+  /// Tunes model parameters to fit measurements by least squares.
+  /// </summary>
+  /// <param name="mass">Mass matrix for natural frequencies.</param>
+  /// <param name="build">Builds the model with parameter values, e.g. by
+  /// reading it with them as overrides.</param>
+  /// <param name="names">Parameters to tune, declared by the model.</param>
+  /// <param name="m">Model, with its initial parameter values.</param>
+  /// <param name="measurements">Measurements.</param>
+  /// <returns>Tuned parameters and the fit, or CalibrationError.</returns>
+  let tune
+    (mass: MassMatrix)
+    (build: Map<string, float> -> Result<Model, string>)
+    (names: string list)
+    (m: Model)
+    (measurements: Measurement list)
+    : Result<CalibrationResult, CalibrationError> =
+    let declared = defaultArg m.Parameters Map.empty
+
+    let untunable =
+      names
+      |> List.tryFind (fun name ->
+        declared.TryFind name |> Option.forall (fun x -> x <= 0.0))
+
+    // Undeclared parameters start at 0 but are rejected before tuning.
+    let start =
+      names
+      |> List.map (fun name -> declared.TryFind name |> Option.defaultValue 0.0)
+      |> Array.ofList
+
+    let values (x: float array) =
+      Array.map2 (fun p0 xi -> p0 * exp xi) start x
+      |> Array.zip (Array.ofList names)
+      |> Map.ofArray
+
+    let fit (x: float array) =
+      build (values x)
+      |> Result.mapError FailedPrediction
+      |> Result.bind (fun tuned -> compare mass tuned measurements)
+
+    let residuals (comparisons: CalibrationComparison list) =
+      comparisons |> List.map (fun c -> c.Error) |> Array.ofList
+
+    let cost (r: float array) = Array.sumBy (fun e -> e * e) r
+
+    // Columns of the Jacobian of the residuals r at x, by forward
+    // differences.
+    let jacobian (x: float array) (r: float array) =
+      [ 0 .. x.Length - 1 ]
+      |> List.fold
+        (fun acc j ->
+          acc
+          |> Result.bind (fun columns ->
+            let shifted =
+              Array.mapi (fun i xi -> if i = j then xi + step else xi) x
+
+            fit shifted
+            |> Result.map (fun c ->
+              let slope a b = (a - b) / step
+              columns @ [ Array.map2 slope (residuals c) r ])))
+        (Ok [])
+      |> Result.map Array.ofList
+
+    // Damped Gauss-Newton step: (JᵀJ + λ·diag(JᵀJ))·δ = -Jᵀr.
+    let solve (columns: float array array) (r: float array) (lambda: float) =
+      let n = columns.Length
+      let dot (a: float array) (b: float array) =
+        Array.fold2 (fun s x y -> s + x * y) 0.0 a b
+
+      let a =
+        Array2D.init n n (fun i j ->
+          let x = dot columns[i] columns[j]
+          if i = j then x * (1.0 + lambda) + 1e-300 else x)
+
+      let g = Array.init n (fun i -> -(dot columns[i] r))
+      Matrix.factorise a |> Option.map (fun lu -> Matrix.solve lu g)
+
+    let rec iterate x (current: CalibrationComparison list) lambda count =
+      let r = residuals current
+
+      if count = limit then
+        Ok(x, current, count, false)
+      else
+        jacobian x r
+        |> Result.bind (fun columns ->
+          // Raises the damping until a step lowers the error.
+          let rec attempt lambda =
+            match solve columns r lambda with
+            | Some delta when lambda <= 1e12 ->
+              let next = Array.map2 (+) x delta
+
+              fit next
+              |> Result.bind (fun trial ->
+                let before, after = cost r, cost (residuals trial)
+
+                if after >= before then
+                  attempt (lambda * 10.0)
+                elif before - after <= tolerance * before then
+                  Ok(next, trial, count + 1, true)
+                else
+                  iterate next trial (lambda / 10.0) (count + 1))
+            | _ -> Ok(x, current, count + 1, true)
+
+          attempt lambda)
+
+    match untunable with
+    | Some name -> Error(UntunableParameter name)
+    | None ->
+      compare mass m measurements
+      |> Result.bind (fun before ->
+        iterate (Array.zeroCreate start.Length) before 1e-3 0
+        |> Result.map (fun (x, after, count, converged) ->
+          { Initial = values (Array.zeroCreate start.Length)
+            Tuned = values x
+            Before = before
+            After = after
+            Iterations = count
+            Converged = converged }))
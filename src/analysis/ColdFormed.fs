@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Local buckling of the thin plate elements of cold-formed, light-gauge
+/// steel sections, by the effective width method of EN 1993-1-5 4.4 as
+/// EN 1993-1-3 applies it.
+/// </summary>
+/// <remarks>
+/// A member of a material of type "ColdFormedSteel" declares the flat
+/// width <c>flat_width</c> and thickness <c>t</c> of its most slender
+/// compressed plate element, with its buckling factor <c>k_sigma</c>: 4 for
+/// an internal element such as a web, the default, or 0.43 for an outstand
+/// such as a lip-less flange. Its plate slenderness under uniform
+/// compression is λp = (b/t) / (28.4·ε·√kσ), with ε = √(235/fy) in MPa,
+/// and its reduction factor ρ is (λp − 0.22)/λp² for internal and
+/// (λp − 0.188)/λp² for outstand elements once λp exceeds 0.673 or 0.748.
+/// The whole section is taken to be reduced by ρ, so its area and section
+/// moduli become ρ·A and ρ·W, which is conservative for sections whose
+/// other elements are stockier. Members without a flat width are fully
+/// effective.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module ColdFormed =
+
+  /// <summary>
+  /// Returns whether a material is cold-formed steel.
+  /// </summary>
+  /// <param name="x">Material.</param>
+  /// <returns>True for a material of type "ColdFormedSteel".</returns>
+  let isColdFormed (x: Material) : bool =
+    String.Equals(x.Type, "ColdFormedSteel", StringComparison.OrdinalIgnoreCase)
+
+  /// <summary>
+  /// Returns the reduction factor of a plate element for local buckling.
+  /// </summary>
+  /// <param name="slenderness">Plate slenderness λp.</param>
+  /// <param name="factor">Buckling factor kσ: 4 internal, 0.43 outstand.
+  /// </param>
+  /// <returns>ρ, at most 1.</returns>
+  let reduction (slenderness: float) (factor: float) : float =
+    let limit, offset = if factor >= 4.0 then 0.673, 0.22 else 0.748, 0.188
+
+    if slenderness <= limit then
+      1.0
+    else
+      min 1.0 ((slenderness - offset) / slenderness ** 2.0)
+
+  /// <summary>
+  /// Returns the factor by which local buckling reduces the section of a
+  /// cold-formed member.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="e">Member.</param>
+  /// <returns>ρ, 1 for members that are fully effective or not of
+  /// cold-formed steel.</returns>
+  let effectiveFactor (m: Model) (e: Element) : float =
+    let properties = Option.defaultValue Map.empty e.Properties
+    let property (names: string list) = names |> List.tryPick properties.TryFind
+
+    // Factor from the units of the model to N and mm.
+    let toNmm =
+      match UnitSystem.tryFind m.Info.Units, UnitSystem.tryFind "N-mm" with
+      | Ok source, Ok target -> Some(UnitSystem.factor source target)
+      | _ -> None
+
+    match
+      Materials.ofElement m e,
+      property [ "flat_width" ],
+      property [ "thickness"; "t" ],
+      toNmm
+    with
+    | Some x, Some b, Some t, Some toNmm when
+      isColdFormed x && b > 0.0 && t > 0.0
+      ->
+      match x.YieldStrength with
+      | Some fy when fy > 0.0 ->
+        let factor = property [ "k_sigma" ] |> Option.defaultValue 4.0
+        let epsilon = sqrt (235.0 / (fy * toNmm -2 1))
+        let slenderness = b / t / (28.4 * epsilon * sqrt factor)
+        reduction slenderness factor
+      | _ -> 1.0
+    | _ -> 1.0
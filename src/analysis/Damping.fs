@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Resolves modal damping ratios, e.g. for mixed steel and concrete
+/// structures whose modes dissipate energy differently.
+/// </summary>
+/// <remarks>
+/// A ratio declared for a mode takes precedence. Otherwise, when every
+/// element's material declares a damping ratio, the ratios are combined by
+/// weighting each element by its strain energy in the mode. Failing that,
+/// the model's default ratio applies, or 5 % when none is declared.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Damping =
+
+  /// Ratio used when a model declares no damping.
+  [<Literal>]
+  let DefaultRatio = 0.05
+
+  /// <summary>
+  /// Combines damping ratios weighted by strain energy.
+  /// </summary>
+  /// <param name="parts">Damping ratio and strain energy of each part.</param>
+  /// <returns>Composite ratio, or None without strain energy.</returns>
+  let composite (parts: (float * float) list) : float option =
+    let dissipated = parts |> List.sumBy (fun (ratio, energy) -> ratio * energy)
+
+    match parts |> List.sumBy snd with
+    | total when total > 0.0 -> Some(dissipated / total)
+    | _ -> None
+
+  /// <summary>
+  /// Returns the damping ratio of a mode.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="mode">Mode number, starting at 1.</param>
+  /// <param name="energies">Strain energy of each element in the mode.</param>
+  /// <returns>Damping ratio.</returns>
+  let ratio (m: Model) (mode: int) (energies: Map<string, float>) : float =
+    let declared =
+      m.Damping
+      |> Option.bind (fun d -> d.Modes)
+      |> Option.bind (fun modes -> modes.TryFind(string mode))
+
+    let materialRatio (e: Element) =
+      Materials.ofElement m e |> Option.bind (fun x -> x.DampingRatio)
+
+    let weighted () =
+      let parts =
+        [ for KeyValue(id, e) in m.Elements do
+            if Materials.isRequired e then
+              materialRatio e, energies.TryFind id |> Option.defaultValue 0.0 ]
+
+      if parts.IsEmpty || parts |> List.exists (fst >> Option.isNone) then
+        None
+      else
+        parts |> List.map (fun (r, energy) -> r.Value, energy) |> composite
+
+    declared
+    |> Option.orElseWith weighted
+    |> Option.orElse (m.Damping |> Option.bind (fun d -> d.Ratio))
+    |> Option.defaultValue DefaultRatio
@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Verification of one member under one set of end forces.
+/// </summary>
+type MemberCheck =
+  { Element: string
+    /// Axial plus bending stress over the yield strength, if the material
+    /// declares one.
+    Strength: float option
+    /// Compression over the elastic critical load, if the member has the
+    /// section properties to buckle.
+    Buckling: float option
+    /// Greater of the strength and buckling utilisations.
+    Utilisation: float }
+
+/// <summary>
+/// Stresses in an element under one load set.
+/// </summary>
+type ElementStress =
+  {
+    Element: string
+    /// Axial stress of a member with an "area", positive in tension.
+    Axial: float option
+    /// Greatest bending stress at the extreme fibres: about each axis of a
+    /// member with an elastic section modulus, or 6M/t² of a plate.
+    Bending: float option
+    /// Greatest von Mises stress at the extreme fibres of a plate or shell.
+    VonMises: float option
+    /// Governing stress: the axial plus bending stress of a member, or the
+    /// von Mises stress of a plate.
+    Stress: float
+    /// Stress over the yield strength, if the material declares one.
+    Ratio: float option
+  }
+
+/// <summary>
+/// Governing verification of a member across analysed scenarios.
+/// </summary>
+type GoverningCheck =
+  {
+    /// Scenario the check governs in, e.g. a results file.
+    Scenario: string
+    LoadSet: string
+    Check: MemberCheck
+  }
+
+/// <summary>
+/// Member design checks on analysis results.
+/// </summary>
+/// <remarks>
+/// A member passes when its utilisation is at most 1. Strength is the
+/// elastic stress of the member, its axial stress plus the bending stress
+/// about each axis with an elastic section modulus ("zz", or "zy" for
+/// space frames), over the yield strength of its material. Each is taken
+/// at its greatest along the member, as Diagrams recovers the internal
+/// forces, since the end forces exclude the fixed-end forces of loads
+/// along it. Buckling is the greatest compression over the elastic
+/// critical load about the weaker axis, as derived by Buckling. Members
+/// that support neither check are skipped. Cold-formed steel members are
+/// stressed on their effective section, as ColdFormed reduces it for local
+/// buckling. Masonry members are instead checked for their vertical load
+/// resistance by Masonry, at their ends for strength and at mid-height for
+/// buckling, as are masonry wall panels in place of their stress ratio.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Design =
+
+  let private propertiesOf (m: Model) (id: string) =
+    m.Elements.TryFind id
+    |> Option.bind (fun e -> e.Properties)
+    |> Option.defaultValue Map.empty
+
+  /// Stress over the yield strength of an element's material.
+  let private ratio (m: Model) (id: string) (stress: float) =
+    match m.Elements.TryFind id |> Option.bind (Materials.ofElement m) with
+    | Some { YieldStrength = Some fy } when fy > 0.0 -> Some(stress / fy)
+    | _ -> None
+
+  /// <summary>
+  /// Returns the stresses in a member from its end forces and the internal
+  /// forces along it: the axial stress where an "area" is given, and the
+  /// bending stress about each axis where an elastic section modulus "zz"
+  /// or "zy" is given, each at its greatest along the member.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="id">Member ID.</param>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <param name="stations">Internal forces along the member, as from
+  /// Diagrams.critical; empty to take the end forces alone, which miss the
+  /// moments of loads along it.</param>
+  /// <returns>Stresses of the member.</returns>
+  let memberStress
+    (m: Model)
+    (id: string)
+    (forces: float array)
+    (stations: Station list)
+    =
+    let properties = propertiesOf m id
+
+    // Effective share of a cold-formed section under local buckling.
+    let effective =
+      m.Elements.TryFind id
+      |> Option.map (ColdFormed.effectiveFactor m)
+      |> Option.defaultValue 1.0
+    let at i = if i < forces.Length then abs forces[i] else 0.0
+    let peak f = stations |> List.fold (fun acc s -> max acc (abs (f s))) 0.0
+
+    let major, minor =
+      match forces.Length with
+      | 2 -> 0.0, 0.0
+      | 4 -> max (at 1) (at 3), 0.0
+      | 10 -> max (at 4) (at 9), max (at 3) (at 8)
+      | 12 -> max (at 5) (at 11), max (at 4) (at 10)
+      | _ -> max (at 2) (at 5), 0.0
+
+    let major, minor =
+      if forces.Length = 2 then
+        major, minor
+      else
+        max major (peak (fun s -> s.MomentZ)),
+        max minor (peak (fun s -> s.MomentY))
+
+    let area =
+      properties.TryFind "area" |> Option.orElse (properties.TryFind "a")
+
+    let about modulus moment =
+      properties.TryFind modulus
+      |> Option.map (fun z -> moment / (effective * z))
+
+    let axial =
+      match area, Static.axialForce forces with
+      | Some a, Some n ->
+        let n =
+          stations
+          |> List.fold (fun n s -> if abs s.Axial > abs n then s.Axial else n) n
+
+        Some(n / (effective * a))
+      | _ -> None
+
+    let bending =
+      match about "zz" major, about "zy" minor with
+      | None, None -> None
+      | a, b -> Some(defaultArg a 0.0 + defaultArg b 0.0)
+
+    let stress = abs (defaultArg axial 0.0) + defaultArg bending 0.0
+
+    { Element = id
+      Axial = axial
+      Bending = bending
+      VonMises = None
+      Stress = stress
+      Ratio = ratio m id stress }
+
+  /// <summary>
+  /// Returns the greatest elastic stress in a member, its axial plus bending
+  /// stress, on the effective section of a cold-formed member.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="id">Member ID.</param>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <param name="stations">Internal forces along the member.</param>
+  /// <returns>Stress magnitude.</returns>
+  let stress
+    (m: Model)
+    (id: string)
+    (forces: float array)
+    (stations: Station list)
+    : float =
+    (memberStress m id forces stations).Stress
+
+  /// <summary>
+  /// Returns the stresses at the extreme fibres of a plate or shell, each
+  /// face taking σ = N/t ± 6M/t² in plane stress.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="id">Plate ID.</param>
+  /// <param name="forces">Stress resultants per unit width.</param>
+  /// <returns>
+  /// Stresses, zero without a "thickness"; a masonry panel's ratio is its
+  /// utilisation under vertical load.
+  /// </returns>
+  let surfaceStress (m: Model) (id: string) (forces: float array) =
+    let properties = propertiesOf m id
+
+    let thickness =
+      properties.TryFind "thickness" |> Option.orElse (properties.TryFind "t")
+
+    match thickness with
+    | Some t ->
+      let face side k = forces[k] / t + side * 6.0 * forces[k + 3] / t ** 2.0
+
+      let vonMises side =
+        let sx, sy, txy = face side 0, face side 1, face side 2
+        sqrt (sx * sx - sx * sy + sy * sy + 3.0 * txy * txy)
+
+      let bending =
+        6.0 * max (abs forces[3]) (abs forces[4]) / t ** 2.0
+
+      let stress = max (vonMises 1.0) (vonMises -1.0)
+
+      let masonry =
+        m.Elements.TryFind id
+        |> Option.bind (fun e -> Masonry.panel m e forces)
+
+      { Element = id
+        Axial = None
+        Bending = Some bending
+        VonMises = Some stress
+        Stress = stress
+        Ratio = masonry |> Option.orElse (ratio m id stress) }
+    | None ->
+      { Element = id
+        Axial = None
+        Bending = None
+        VonMises = None
+        Stress = 0.0
+        Ratio = None }
+
+  /// <summary>
+  /// Returns the greatest von Mises stress at the extreme fibres of a plate.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="id">Plate ID.</param>
+  /// <param name="forces">Stress resultants per unit width.</param>
+  /// <returns>Stress magnitude, or zero without a "thickness".</returns>
+  let plateStress (m: Model) (id: string) (forces: float array) : float =
+    (surfaceStress m id forces).Stress
+
+  /// <summary>
+  /// Returns the stresses in every member and plate of a static response,
+  /// members taking the moments of the loads along them.
+  /// </summary>
+  /// <param name="m">Model analysed.</param>
+  /// <param name="set">Load set the response is to.</param>
+  /// <param name="r">Static response.</param>
+  /// <returns>
+  /// Stresses of each element, ordered by ID, or the first LoadError.
+  /// </returns>
+  let stresses
+    (m: Model)
+    (set: LoadSet)
+    (r: StaticResult)
+    : Result<ElementStress list, LoadError> =
+    r.MemberForces
+    |> Map.toList
+    |> List.fold
+      (fun acc (id, forces) ->
+        match acc, Diagrams.critical m set id forces with
+        | Ok rest, Ok stations -> Ok(memberStress m id forces stations :: rest)
+        | Error e, _
+        | _, Error e -> Error e)
+      (Ok [])
+    |> Result.map (fun members ->
+      [ yield! members
+        for KeyValue(id, forces) in r.PlateForces -> surfaceStress m id forces ]
+      |> List.sortBy (fun s -> s.Element))
+
+  /// <summary>
+  /// Checks a member under one set of end forces and the internal forces
+  /// along it.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="id">Member ID.</param>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <param name="stations">Internal forces along the member, as from
+  /// Diagrams.critical; empty to take the end forces alone.</param>
+  /// <returns>Check, or None when neither check applies.</returns>
+  let check
+    (m: Model)
+    (id: string)
+    (forces: float array)
+    (stations: Station list)
+    : MemberCheck option =
+    match m.Elements.TryFind id with
+    | None -> None
+    | Some e ->
+      match Masonry.check m e forces stations with
+      | Some(ends, middle) ->
+        Some
+          { Element = id
+            Strength = Some ends
+            Buckling = Some middle
+            Utilisation = max ends middle }
+      | None ->
+
+      let strength = (memberStress m id forces stations).Ratio
+
+      // Greatest compression along the member.
+      let compression =
+        Static.axialForce forces
+        |> Option.map (fun n ->
+          stations |> List.fold (fun n s -> min n s.Axial) n)
+
+      let buckling =
+        match compression, Buckling.ofElement m e with
+        | Some n, Ok axes when e.Type <> "Cable" && not axes.IsEmpty ->
+          Some(axes |> List.map (Buckling.utilisation n) |> List.max)
+        | _ -> None
+
+      match strength, buckling with
+      | None, None -> None
+      | _ ->
+        Some
+          { Element = id
+            Strength = strength
+            Buckling = buckling
+            Utilisation =
+              max (defaultArg strength 0.0) (defaultArg buckling 0.0) }
+
+  /// <summary>
+  /// Finds the governing check of each member: its greatest utilisation
+  /// across every scenario and load set.
+  /// </summary>
+  /// <param name="checks">Checks with their scenario and load set.</param>
+  /// <returns>Governing check of each member, ordered by member ID.</returns>
+  let govern (checks: GoverningCheck seq) : GoverningCheck list =
+    checks
+    |> Seq.groupBy (fun c -> c.Check.Element)
+    |> Seq.map (snd >> Seq.maxBy (fun c -> c.Check.Utilisation))
+    |> Seq.sortBy (fun c -> c.Check.Element)
+    |> List.ofSeq
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Internal forces of a member at a station along it, in member axes: the
+/// forces and moments the part beyond the station exerts on the part
+/// before it.
+/// </summary>
+type Station =
+  {
+    /// Distance from the member's first node.
+    Distance: float
+    /// Axial force, positive in tension.
+    Axial: float
+    ShearY: float
+    ShearZ: float
+    Torsion: float
+    MomentY: float
+    /// Moment about local z, positive sagging for planar members loaded
+    /// against local y.
+    MomentZ: float
+  }
+
+/// <summary>
+/// Recovers axial force, shear and bending moment diagrams of members from
+/// their end forces and the loads along them.
+/// </summary>
+/// <remarks>
+/// Member end forces exclude the fixed-end forces of point and distributed
+/// loads on the member, so these are added back at the first end, as
+/// NodalLoads derives them, before the internal forces at each station
+/// follow by statics of the part of the member before it. At the second
+/// end the stations therefore give the complete end forces. Self-weight is
+/// lumped at the nodes, as the solver applies it, so does not vary along
+/// members; a point load at a station counts beyond it, except at the
+/// second end.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Diagrams =
+
+  /// Load along a member in its axes, at or between distances from its
+  /// first node.
+  type private Along =
+    | Point of at: float * force: Vector3
+    | Spread of start: float * finish: float * q0: Vector3 * q1: Vector3
+
+  let private vector x y z = { X = x; Y = y; Z = z }
+
+  /// Force and moment at the first end of a member, in its axes, from the
+  /// layout of StaticResult.MemberForces.
+  let private firstEnd (f: float array) =
+    match f.Length with
+    | 2 -> Some(vector f[0] 0.0 0.0, Vector3.zero)
+    | 4 -> Some(vector 0.0 f[0] 0.0, vector 0.0 0.0 f[1])
+    | 6 -> Some(vector f[0] f[1] 0.0, vector 0.0 0.0 f[2])
+    | 10 -> Some(vector 0.0 f[0] f[1], vector f[2] f[3] f[4])
+    | 12 -> Some(vector f[0] f[1] f[2], vector f[3] f[4] f[5])
+    | _ -> None
+
+  /// Global axis of a force or moment direction, e.g. "Fy" or "Mz".
+  let private axis (direction: string) =
+    match Dof.ofDirection direction with
+    | Some Ux
+    | Some Rx -> Some(vector 1.0 0.0 0.0)
+    | Some Uy
+    | Some Ry -> Some(vector 0.0 1.0 0.0)
+    | Some Uz
+    | Some Rz -> Some(vector 0.0 0.0 1.0)
+    | None -> None
+
+  let private isMoment (direction: string) =
+    match Dof.ofDirection direction with
+    | Some Rx
+    | Some Ry
+    | Some Rz -> true
+    | _ -> false
+
+  /// Resultant of a load before distance x, and its first moment about x,
+  /// the integral of (s - x) over the load.
+  let private before (x: float) (last: bool) (load: Along) =
+    match load with
+    | Point(a, p) when a < x || last -> p, Vector3.scale (a - x) p
+    | Point _ -> Vector3.zero, Vector3.zero
+    | Spread(a, b, q0, q1) ->
+      let u = min x b - a
+
+      if u <= 0.0 then
+        Vector3.zero, Vector3.zero
+      else
+        let k = Vector3.scale (1.0 / (b - a)) (Vector3.sub q1 q0)
+        let d = a - x
+
+        Vector3.add (Vector3.scale u q0) (Vector3.scale (u * u / 2.0) k),
+        Vector3.add
+          (Vector3.scale (d * u + u * u / 2.0) q0)
+          (Vector3.scale (d * u * u / 2.0 + u ** 3.0 / 3.0) k)
+
+  let private traverse f xs =
+    List.foldBack
+      (fun x acc ->
+        match f x, acc with
+        | Ok y, Ok ys -> Ok(y :: ys)
+        | Error e, _
+        | _, Error e -> Error e)
+      xs
+      (Ok [])
+
+  /// Distances of count stations spaced equally along a member.
+  let private spaced (count: int) (length: float) =
+    let count = max 2 count
+    [ for k in 0 .. count - 1 -> length * float k / float (count - 1) ]
+
+  /// Internal forces of one member at stations placed by distances, given
+  /// its length and the loads along it.
+  let private ofMember
+    (m: Model)
+    (set: LoadSet)
+    (distances: float -> Along list -> float list)
+    (e: Element)
+    (forces: float array)
+    =
+    match e.Nodes, firstEnd forces with
+    | [ i; j ], Some(f1, m1) ->
+      let chord =
+        Vector3.sub (Vector3.ofNode m.Nodes[j]) (Vector3.ofNode m.Nodes[i])
+
+      let length = Vector3.norm chord
+      let x, y, z = Vector3.memberAxes chord
+      let local g =
+        vector (Vector3.dot g x) (Vector3.dot g y) (Vector3.dot g z)
+
+      // Static.withThermal has already restored the end forces of thermal
+      // loads.
+      let loads =
+        set.Loads
+        |> List.filter (fun (_, l) ->
+          l.Element = Some e.Id
+          && (l.Type = "Force" || l.Type = "Distributed"))
+
+      let along =
+        [ for factor, l in loads do
+            match l.Type, axis l.Direction with
+            | "Force", Some d ->
+              let p = Vector3.scale (factor * l.Magnitude) d
+              Point(defaultArg l.Position 0.0 * length, local p)
+            | "Distributed", Some d ->
+              let q0 = factor * l.Magnitude
+              let q1 = factor * defaultArg l.EndMagnitude l.Magnitude
+
+              Spread(
+                defaultArg l.Position 0.0 * length,
+                defaultArg l.End 1.0 * length,
+                local (Vector3.scale q0 d),
+                local (Vector3.scale q1 d)
+              )
+            | _ -> () ]
+
+      // Fixed-end forces at the first end are its equivalent loads reversed.
+      let fixedEnd =
+        loads
+        |> traverse (fun (factor, l) -> NodalLoads.ofLoad m factor l)
+        |> Result.map (fun nodal ->
+          let total moments =
+            [ for n in List.concat nodal do
+                match axis n.Direction with
+                | Some u when n.Node = i && isMoment n.Direction = moments ->
+                  Vector3.scale -n.Magnitude u
+                | _ -> () ]
+            |> List.fold Vector3.add Vector3.zero
+            |> local
+
+          total false, total true)
+
+      fixedEnd
+      |> Result.map (fun (ff, mf) ->
+        let f1 = Vector3.add f1 ff
+        let m1 = Vector3.add m1 mf
+        let ex = vector 1.0 0.0 0.0
+
+        [ for s in distances length along ->
+            let p, q =
+              along
+              |> List.map (before s (s >= length))
+              |> List.fold
+                (fun (p, q) (dp, dq) -> Vector3.add p dp, Vector3.add q dq)
+                (Vector3.zero, Vector3.zero)
+
+            let force = Vector3.scale -1.0 (Vector3.add f1 p)
+            let lever = Vector3.cross ex (Vector3.add (Vector3.scale -s f1) q)
+            let moment = Vector3.scale -1.0 (Vector3.add m1 lever)
+
+            { Distance = s
+              Axial = force.X
+              ShearY = force.Y
+              ShearZ = force.Z
+              Torsion = moment.X
+              MomentY = moment.Y
+              MomentZ = moment.Z } ]
+        |> Some)
+    | _ -> Ok None
+
+  /// <summary>
+  /// Returns the internal forces of every member at stations spaced equally
+  /// along it, from the results of a load set.
+  /// </summary>
+  /// <param name="m">Model analysed.</param>
+  /// <param name="set">Load set the results are for.</param>
+  /// <param name="count">Stations per member, including both ends; at
+  /// least 2.</param>
+  /// <param name="r">Static response to the load set.</param>
+  /// <returns>Stations by member ID, or the first LoadError.</returns>
+  let ofResult
+    (m: Model)
+    (set: LoadSet)
+    (count: int)
+    (r: StaticResult)
+    : Result<Map<string, Station list>, LoadError> =
+    r.MemberForces
+    |> Map.toList
+    |> List.choose (fun (id, forces) ->
+      m.Elements.TryFind id |> Option.map (fun e -> id, e, forces))
+    |> traverse (fun (id, e, forces) ->
+      ofMember m set (fun length _ -> spaced count length) e forces
+      |> Result.map (Option.map (fun stations -> id, stations)))
+    |> Result.map (List.choose id >> Map.ofList)
+
+  /// <summary>
+  /// Returns the internal forces of one member at the stations where the
+  /// extremes of its diagrams lie: its ends, the points and ends of the
+  /// loads along it, and 21 stations spaced equally between, which find the
+  /// peak moment under a distributed load to within 1%.
+  /// </summary>
+  /// <param name="m">Model analysed.</param>
+  /// <param name="set">Load set the end forces are for.</param>
+  /// <param name="id">Member ID.</param>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <returns>
+  /// Stations ordered by distance, none for an element that is not a
+  /// member, or the first LoadError.
+  /// </returns>
+  let critical
+    (m: Model)
+    (set: LoadSet)
+    (id: string)
+    (forces: float array)
+    : Result<Station list, LoadError> =
+    let distances length along =
+      [ yield! spaced 21 length
+        for load in along do
+          match load with
+          | Point(a, _) -> a
+          | Spread(a, b, _, _) ->
+            a
+            b ]
+      |> List.filter (fun s -> s >= 0.0 && s <= length)
+      |> List.distinct
+      |> List.sort
+
+    match m.Elements.TryFind id with
+    | Some e ->
+      ofMember m set distances e forces
+      |> Result.map (Option.defaultValue [])
+    | None -> Ok []
@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Equations of motion of a model over its free degrees of freedom, with
+/// the load at each time step.
+/// </summary>
+type DynamicSystem =
+  {
+    /// Node and degree of freedom of each equation.
+    Dofs: (string * Dof) array
+    System: StructuralSystem
+    TimeStep: float
+    /// Load on each degree of freedom at each step, from time zero.
+    Loads: float array array
+  }
+
+/// <summary>
+/// Response of a model at each step of a time-history analysis.
+/// </summary>
+type DynamicResult =
+  { Dofs: (string * Dof) array
+    Times: float array
+    Response: TransientResponse }
+
+/// <summary>
+/// Errors raised whilst setting up or integrating a time-history analysis.
+/// </summary>
+type DynamicError =
+  | NoTimeHistory
+  | FailedHistoryCase of SelectionError
+  | FailedSystem of StaticError
+  | FailedDamping of ModalError
+  | FailedModes of ModalError
+  | FailedIntegration of TransientError
+
+[<RequireQualifiedAccess>]
+module DynamicError =
+
+  let getAsString (e: DynamicError) : string =
+    match e with
+    | NoTimeHistory -> "Model declares no time history to integrate."
+    | FailedHistoryCase e -> SelectionError.getAsString e
+    | FailedSystem e -> StaticError.getAsString e
+    | FailedDamping e -> $"Rayleigh damping: {ModalError.getAsString e}"
+    | FailedModes e -> $"Modal superposition: {ModalError.getAsString e}"
+    | FailedIntegration e -> TransientError.getAsString e
+
+/// <summary>
+/// Time-history analysis: the response of a model from rest to the load
+/// cases of its time history, each scaled by a piecewise-linear factor,
+/// found by direct integration of M·ü + C·u̇ + K·u = f(t).
+/// </summary>
+/// <remarks>
+/// Damping is of Rayleigh form, C = a0·M + a1·K. Unless the coefficients
+/// are declared, they are chosen to give the model's damping ratio in its
+/// first two modes. Integration needs a non-singular mass matrix, so
+/// frame models need consistent mass to give their rotations inertia.
+///
+/// Modal superposition instead integrates the system projected onto its
+/// lowest modes, each damped by its modal damping ratio, resolved as for
+/// response spectra, rather than by the Rayleigh coefficients.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Dynamic =
+
+  /// Maps each item, stopping at the first error.
+  let private collect f items =
+    List.foldBack
+      (fun item acc ->
+        match f item, acc with
+        | Ok x, Ok rest -> Ok(x :: rest)
+        | Error e, _
+        | _, Error e -> Error e)
+      items
+      (Ok [])
+
+  /// <summary>
+  /// Returns the factor of a load history at a time, interpolating linearly
+  /// between the times given and zero outside them.
+  /// </summary>
+  /// <param name="h">Load history.</param>
+  /// <param name="t">Time.</param>
+  /// <returns>Factor on the load case.</returns>
+  let factor (h: LoadHistory) (t: float) : float =
+    let points = List.zip h.Times h.Factors
+
+    let segment =
+      points
+      |> List.pairwise
+      |> List.tryFind (fun ((t0, _), (t1, _)) -> t >= t0 && t <= t1)
+
+    match segment with
+    | Some((t0, f0), (t1, f1)) -> f0 + (f1 - f0) * (t - t0) / (t1 - t0)
+    | None ->
+      // A single point applies at its own time only.
+      points
+      |> List.tryFind (fst >> (=) t)
+      |> Option.map snd
+      |> Option.defaultValue 0.0
+
+  /// <summary>
+  /// Returns the Rayleigh coefficients giving a damping ratio at two
+  /// natural frequencies; between them the ratio is slightly lower.
+  /// </summary>
+  /// <param name="ratio">Damping ratio, e.g. 0.05.</param>
+  /// <param name="omega1">First circular frequency in rad/s.</param>
+  /// <param name="omega2">Second circular frequency in rad/s.</param>
+  /// <returns>Mass and stiffness-proportional coefficients.</returns>
+  let rayleigh (ratio: float) (omega1: float) (omega2: float) : Rayleigh =
+    { Mass = 2.0 * ratio * omega1 * omega2 / (omega1 + omega2)
+      Stiffness = 2.0 * ratio / (omega1 + omega2) }
+
+  /// <summary>
+  /// Assembles the equations of motion of a model and its loads over time.
+  /// </summary>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="m">Valid model with a time history.</param>
+  /// <returns>Dynamic system, or DynamicError.</returns>
+  let prepare
+    (kind: MassMatrix)
+    (m: Model)
+    : Result<DynamicSystem, DynamicError> =
+    match m.TimeHistory with
+    | None -> Error NoTimeHistory
+    | Some h ->
+      let assembled =
+        Static.assemble m
+        |> Result.bind (fun a ->
+          Static.assembleMass kind m a |> Result.map (fun mass -> a, mass))
+        |> Result.mapError FailedSystem
+
+      let cases =
+        let names = h.Cases |> Map.toList |> List.map fst
+
+        LoadCases.select m (Some names) None
+        |> Result.mapError FailedHistoryCase
+
+      match assembled, cases with
+      | Error e, _
+      | _, Error e -> Error e
+      | Ok(a, mass), Ok sets ->
+        let free = Static.free a
+        let k = Sparse.select free a.Stiffness
+        let mff = Sparse.select free mass
+
+        let damping =
+          let declared = m.Damping |> Option.bind (fun d -> d.Rayleigh)
+
+          let ratio =
+            m.Damping
+            |> Option.bind (fun d -> d.Ratio)
+            |> Option.defaultValue Damping.DefaultRatio
+
+          match declared with
+          | Some r -> Ok r
+          | None ->
+            match Modal.lowestModes 2 k mff with
+            | Ok [ first; second ] ->
+              Ok(rayleigh ratio first.AngularFrequency second.AngularFrequency)
+            | Ok [ only ] ->
+              Ok(rayleigh ratio only.AngularFrequency only.AngularFrequency)
+            | Ok _ -> Ok { Mass = 0.0; Stiffness = 0.0 }
+            | Error e -> Error(FailedDamping e)
+
+        let vectors =
+          sets
+          |> collect (fun set ->
+            NodalLoads.ofLoadSet m set
+            |> Result.mapError FailedLoads
+            |> Result.bind (Static.loadVector a)
+            |> Result.map (fun f ->
+              h.Cases[set.Name], free |> Array.map (Array.get f))
+            |> Result.mapError FailedSystem)
+
+        match damping, vectors with
+        | Error e, _
+        | _, Error e -> Error e
+        | Ok r, Ok vectors ->
+          let kd = Sparse.toMatrix k
+          let md = Sparse.toMatrix mff
+          let steps = int (floor (h.Duration / h.TimeStep + 1e-9)) + 1
+
+          let loadAt step =
+            let t = float step * h.TimeStep
+
+            vectors
+            |> List.fold
+              (fun acc (history, f) ->
+                let x = factor history t
+                Array.map2 (fun s fi -> s + x * fi) acc f)
+              (Array.zeroCreate free.Length)
+
+          Ok
+            { Dofs = free |> Array.map (fun i -> a.Dofs[i])
+              System =
+                { Mass = md
+                  Damping = Matrix.combine [ r.Mass, md; r.Stiffness, kd ]
+                  Stiffness = kd }
+              TimeStep = h.TimeStep
+              Loads = Array.init steps loadAt }
+
+  /// <summary>
+  /// Integrates a dynamic system from rest, passing the state at each step
+  /// to an observer as it is computed, e.g. to stream it to disk.
+  /// </summary>
+  /// <param name="i">Integration scheme.</param>
+  /// <param name="d">Dynamic system.</param>
+  /// <param name="observe">
+  /// Receives the time, displacements, velocities and accelerations.
+  /// </param>
+  /// <returns>Unit, or DynamicError.</returns>
+  let run
+    (i: Integrator)
+    (d: DynamicSystem)
+    (observe: float -> float array -> float array -> float array -> unit)
+    : Result<unit, DynamicError> =
+    TimeHistory.run i d.System d.TimeStep d.Loads (fun k u v a ->
+      observe (float k * d.TimeStep) u v a)
+    |> Result.mapError FailedIntegration
+
+  /// <summary>
+  /// Integrates a dynamic system from rest by a transient method, passing
+  /// the state at each step to an observer. The integration scheme is
+  /// unused by modal superposition, which observes each step once the
+  /// response of every mode is known.
+  /// </summary>
+  /// <param name="method">Direct integration or modal superposition.</param>
+  /// <param name="i">Integration scheme.</param>
+  /// <param name="m">Model the system was prepared from.</param>
+  /// <param name="d">Dynamic system.</param>
+  /// <param name="observe">
+  /// Receives the time, displacements, velocities and accelerations.
+  /// </param>
+  /// <returns>Unit, or DynamicError.</returns>
+  let runWith
+    (method: TransientMethod)
+    (i: Integrator)
+    (m: Model)
+    (d: DynamicSystem)
+    (observe: float -> float array -> float array -> float array -> unit)
+    : Result<unit, DynamicError> =
+    match method with
+    | DirectIntegration -> run i d observe
+    | ModalSuperposition count ->
+      let s = d.System
+
+      let modes =
+        Modal.lowestModes
+          count
+          (Sparse.ofMatrix s.Stiffness)
+          (Sparse.ofMatrix s.Mass)
+        |> Result.mapError FailedModes
+
+      // Each mode is damped by the ratio its element strain energies give.
+      let ratios (a: Assembly) (modes: Mode list) =
+        let index = a.Dofs |> Array.mapi (fun j x -> x, j) |> Map.ofArray
+
+        let ratio (x: Mode) =
+          let u = Array.zeroCreate a.Dofs.Length
+          x.Shape |> Array.iteri (fun j y -> u[index[d.Dofs[j]]] <- y)
+
+          Static.strainEnergies m a u
+          |> Result.map (fun e -> x.Number, Damping.ratio m x.Number e)
+
+        modes
+        |> collect ratio
+        |> Result.map Map.ofList
+        |> Result.mapError FailedSystem
+
+      Static.assemble m
+      |> Result.mapError FailedSystem
+      |> Result.bind (fun a ->
+        modes
+        |> Result.bind (fun modes ->
+          ratios a modes |> Result.map (fun r -> modes, r)))
+      |> Result.bind (fun (modes, r) ->
+        let ratio (x: Mode) = r[x.Number]
+
+        ModalSuperposition.history count ratio modes d.TimeStep d.Loads
+        |> Result.mapError FailedIntegration)
+      |> Result.map (fun r ->
+        for k in 0 .. d.Loads.Length - 1 do
+          observe
+            (float k * d.TimeStep)
+            r.Displacements[k]
+            r.Velocities[k]
+            r.Accelerations[k])
+
+  /// <summary>
+  /// Computes the time-history response of a model from rest.
+  /// </summary>
+  /// <param name="i">Integration scheme.</param>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="m">Valid model with a time history.</param>
+  /// <returns>Response at each step, or DynamicError.</returns>
+  let analyse
+    (i: Integrator)
+    (kind: MassMatrix)
+    (m: Model)
+    : Result<DynamicResult, DynamicError> =
+    prepare kind m
+    |> Result.bind (fun d ->
+      TimeHistory.integrate i d.System d.TimeStep d.Loads
+      |> Result.mapError FailedIntegration
+      |> Result.map (fun r ->
+        { Dofs = d.Dofs
+          Times = Array.init d.Loads.Length (fun k -> float k * d.TimeStep)
+          Response = r }))
+
+  /// <summary>
+  /// Groups values over the degrees of freedom of a dynamic system by node.
+  /// </summary>
+  /// <param name="dofs">Node and degree of freedom of each value.</param>
+  /// <param name="values">Values, e.g. displacements at one step.</param>
+  /// <returns>Value of each degree of freedom, by node.</returns>
+  let byNode
+    (dofs: (string * Dof) array)
+    (values: float array)
+    : Map<string, Map<Dof, float>> =
+    values
+    |> Array.mapi (fun i x -> dofs[i], x)
+    |> Array.groupBy (fst >> fst)
+    |> Array.map (fun (node, xs) ->
+      node, xs |> Array.map (fun ((_, dof), x) -> dof, x) |> Map.ofArray)
+    |> Map.ofArray
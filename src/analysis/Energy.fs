@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Work done on a structure by one load set and the strain energy it
+/// stores, in the energy units of the model, e.g. J in SI.
+/// </summary>
+type EnergyBalance =
+  {
+    /// Work of the loads and of the supports' prescribed displacements,
+    /// ½·Σ(f + R)·u.
+    ExternalWork: float
+    /// Strain energy of the whole structure, ½·uᵀ·K·u.
+    StrainEnergy: float
+    /// Strain energy of each element, by ID.
+    Elements: Map<string, float>
+    /// Strain energy of elastic supports and rigid links: the rest.
+    Supports: float
+    /// External work less strain energy over the external work, zero when
+    /// nothing is loaded.
+    Imbalance: float
+  }
+
+/// <summary>
+/// Energy of a time-history response at one time step.
+/// </summary>
+type EnergyStep =
+  {
+    Time: float
+    /// Kinetic energy, ½·vᵀ·M·v.
+    Kinetic: float
+    /// Strain energy, ½·uᵀ·K·u.
+    Strain: float
+    /// Energy dissipated by damping since time zero.
+    Damping: float
+    /// Work done by the loads since time zero.
+    ExternalWork: float
+    /// External work less the kinetic, strain and damping energy.
+    Imbalance: float
+  }
+
+/// <summary>
+/// Strain energy density of one element under one load set.
+/// </summary>
+type EnergyDensity =
+  {
+    Element: string
+    LoadSet: string
+    /// Strain energy stored in the element.
+    Energy: float
+    Volume: float
+    /// Strain energy per unit volume.
+    Density: float
+    /// Density over that of all the elements with a volume under the load
+    /// set: above 1 the element works harder than the structure on average.
+    Relative: float
+  }
+
+/// <summary>
+/// Energy balances of static and time-history responses, to verify a
+/// solution and find where its energy concentrates.
+/// </summary>
+/// <remarks>
+/// A linear static solution in equilibrium stores exactly the work done on
+/// it, so an imbalance beyond rounding marks an out-of-balance solution,
+/// e.g. of an iterative solver stopped short. Energies are those of the
+/// linear stiffness; second-order responses are not balanced here.
+///
+/// Over a time history, the work of the loads and of damping accumulate
+/// by the trapezoidal rule over each step's change in displacement,
+/// W += ½·(f₀ + f₁)·Δu and D += ½·(C·v₀ + C·v₁)·Δu. The average
+/// acceleration Newmark scheme conserves energy under this rule, so its
+/// imbalance stays at rounding; schemes with numerical damping, e.g.
+/// HHT-α, show what they dissipate as a growing imbalance.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Energy =
+
+  let private dot (x: float array) (y: float array) =
+    Array.fold2 (fun acc a b -> acc + a * b) 0.0 x y
+
+  /// Half of x·A·x.
+  let private quadratic (a: float[,]) (x: float array) =
+    0.5 * dot x (Matrix.multiply a x)
+
+  /// Rotates the Ux and Uy values of a node back to the axes of its
+  /// inclined support, if any; the inverse of Static.toGlobal.
+  let private toSupport
+    (a: Assembly)
+    (node: string)
+    (values: Map<Dof, float>)
+    =
+    match a.Angles.TryFind node with
+    | Some angle when values.ContainsKey Ux || values.ContainsKey Uy ->
+      let at dof = values.TryFind dof |> Option.defaultValue 0.0
+      let c, s = cos angle, sin angle
+
+      values
+      |> Map.add Ux (c * at Ux + s * at Uy)
+      |> Map.add Uy (-s * at Ux + c * at Uy)
+    | _ -> values
+
+  let private unilateral = set [ "Cable"; "Strut" ]
+
+  /// <summary>
+  /// Balances the work of a load set on a linear static response against
+  /// the strain energy it stores.
+  /// </summary>
+  /// <param name="m">Model the response belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="loads">Nodal loads of the load set.</param>
+  /// <param name="r">Static response to the loads.</param>
+  /// <returns>Energy balance, or StaticError.</returns>
+  let ofStatic
+    (m: Model)
+    (a: Assembly)
+    (loads: NodalLoad list)
+    (r: StaticResult)
+    : Result<EnergyBalance, StaticError> =
+    // Cables and struts left without force went slack in the solution.
+    let slack =
+      m.Elements
+      |> Map.filter (fun id e ->
+        unilateral.Contains e.Type
+        && r.MemberForces.TryFind id
+           |> Option.exists (Array.forall (fun x -> x = 0.0)))
+      |> Map.keys
+      |> Set.ofSeq
+
+    let assembly =
+      if slack = a.Inactive then Ok a else Static.assembleWithout slack m
+
+    assembly
+    |> Result.bind (fun a ->
+      let u =
+        a.Dofs
+        |> Array.map (fun (node, dof) ->
+          r.Displacements.TryFind node
+          |> Option.map (toSupport a node)
+          |> Option.bind (fun values -> values.TryFind dof)
+          |> Option.defaultValue 0.0)
+
+      // Pretension does work as a load on the cables' ends.
+      Static.loadVector a loads
+      |> Result.bind (fun f ->
+        Static.pretensionLoads m a |> Result.map (Array.map2 (+) f))
+      |> Result.bind (fun f ->
+        Static.strainEnergies m a u
+        |> Result.map (fun elements ->
+          let ku = Sparse.multiply a.Stiffness u
+
+          // Supports do work only through the displacements they impose.
+          let work =
+            Array.init u.Length (fun i ->
+              if a.Restrained[i] then ku[i] * u[i] else f[i] * u[i])
+            |> Array.sum
+            |> (*) 0.5
+
+          let strain = 0.5 * dot u ku
+
+          { ExternalWork = work
+            StrainEnergy = strain
+            Elements = elements
+            Supports = strain - (elements |> Map.values |> Seq.sum)
+            Imbalance =
+              if work = 0.0 then 0.0 else (work - strain) / work })))
+
+  /// <summary>
+  /// Advances the energy of a time history by one step.
+  /// </summary>
+  /// <param name="d">Dynamic system.</param>
+  /// <param name="step">Index of the step, from zero.</param>
+  /// <param name="previous">
+  /// Energy, displacements and velocities at the step before, if any.
+  /// </param>
+  /// <param name="u">Displacements at the step.</param>
+  /// <param name="v">Velocities at the step.</param>
+  /// <returns>Energy at the step.</returns>
+  let advance
+    (d: DynamicSystem)
+    (step: int)
+    (previous: (EnergyStep * float array * float array) option)
+    (u: float array)
+    (v: float array)
+    : EnergyStep =
+    let kinetic = quadratic d.System.Mass v
+    let strain = quadratic d.System.Stiffness u
+
+    let damping, work =
+      match previous with
+      | None -> 0.0, 0.0
+      | Some(last, u0, v0) ->
+        let du = Array.map2 (-) u u0
+        let force = Array.map2 (+) d.Loads[step - 1] d.Loads[step]
+        let drag = Matrix.multiply d.System.Damping (Array.map2 (+) v0 v)
+
+        last.Damping + 0.5 * dot drag du,
+        last.ExternalWork + 0.5 * dot force du
+
+    { Time = float step * d.TimeStep
+      Kinetic = kinetic
+      Strain = strain
+      Damping = damping
+      ExternalWork = work
+      Imbalance = work - kinetic - strain - damping }
+
+  /// <summary>
+  /// Returns the energy of a time history at each of its steps.
+  /// </summary>
+  /// <param name="d">Dynamic system integrated.</param>
+  /// <param name="r">Response of the system.</param>
+  /// <returns>Energy at each step, from time zero.</returns>
+  let ofDynamic (d: DynamicSystem) (r: DynamicResult) : EnergyStep array =
+    let us = r.Response.Displacements
+    let vs = r.Response.Velocities
+
+    Array.init us.Length id
+    |> Array.scan
+      (fun previous k ->
+        let energy = advance d k previous us[k] vs[k]
+        Some(energy, us[k], vs[k]))
+      None
+    |> Array.choose (Option.map (fun (e, _, _) -> e))
+
+  /// <summary>
+  /// Ranks elements by their strain energy density, a quick proxy for
+  /// members that are over-stressed, at the top, or inefficient, at the
+  /// bottom. Each element is ranked by its densest load set.
+  /// </summary>
+  /// <remarks>
+  /// In a member of one material under uniform axial stress σ, the density
+  /// is σ²/2E, so across members of a material it orders them by stress.
+  /// Elements without a volume, e.g. springs or members without an area,
+  /// are left out; see Mass.volume.
+  /// </remarks>
+  /// <param name="m">Model the energies belong to.</param>
+  /// <param name="energies">Strain energy of each element, by load set.
+  /// </param>
+  /// <returns>Governing density of each element, densest first.</returns>
+  let rank
+    (m: Model)
+    (energies: (string * Map<string, float>) list)
+    : EnergyDensity list =
+    let volumes =
+      m.Elements
+      |> Map.toSeq
+      |> Seq.choose (fun (id, e) ->
+        Mass.volume m e
+        |> Option.filter (fun v -> v > 0.0)
+        |> Option.map (fun v -> id, v))
+      |> Map.ofSeq
+
+    energies
+    |> List.collect (fun (set, elements) ->
+      let stored = elements |> Map.filter (fun id _ -> volumes.ContainsKey id)
+      let total = stored |> Map.values |> Seq.sum
+      let volume = stored |> Map.keys |> Seq.sumBy (fun id -> volumes[id])
+      let mean = if volume > 0.0 then total / volume else 0.0
+
+      [ for KeyValue(id, energy) in stored ->
+          let density = energy / volumes[id]
+
+          { Element = id
+            LoadSet = set
+            Energy = energy
+            Volume = volumes[id]
+            Density = density
+            Relative = if mean > 0.0 then density / mean else 0.0 } ])
+    |> List.groupBy (fun d -> d.Element)
+    |> List.map (snd >> List.maxBy (fun d -> d.Density))
+    |> List.sortByDescending (fun d -> d.Density)
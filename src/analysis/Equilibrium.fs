@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Balance of the applied loads against the support reactions of a static
+/// response, per global direction.
+/// </summary>
+type EquilibriumCheck =
+  {
+    /// Applied force by direction, e.g. "Fy".
+    Applied: Map<string, float>
+    /// Force the supports exert on the structure, by direction.
+    Reactions: Map<string, float>
+    /// Largest out-of-balance force over the total applied force.
+    Residual: float
+    /// Whether the residual is within the tolerance.
+    Converged: bool
+  }
+
+/// <summary>
+/// Checks that the reactions of a static solution balance its loads, so
+/// that a solver's results can be trusted.
+/// </summary>
+/// <remarks>
+/// The applied and reaction forces are summed along global X, Y and Z.
+/// Springs to ground act as supports, pushing back against the movement of
+/// their node. The residual is taken over the sum of the magnitudes of the
+/// applied forces, so loads that cancel still give a meaningful ratio; it
+/// is the out-of-balance force itself when no force is applied.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Equilibrium =
+
+  /// Default relative residual within which a solution is in equilibrium.
+  [<Literal>]
+  let Tolerance = 1e-6
+
+  let private directions = [ Ux, "Fx"; Uy, "Fy"; Uz, "Fz" ]
+
+  /// <summary>
+  /// Checks the equilibrium of a static response.
+  /// </summary>
+  /// <param name="tolerance">Largest acceptable relative residual.</param>
+  /// <param name="m">Model analysed.</param>
+  /// <param name="loads">Nodal loads the response is to.</param>
+  /// <param name="r">Static response.</param>
+  /// <returns>Applied forces, reactions and the residual.</returns>
+  let check
+    (tolerance: float)
+    (m: Model)
+    (loads: NodalLoad list)
+    (r: StaticResult)
+    : EquilibriumCheck =
+    let grounded =
+      m.Elements
+      |> Map.filter (fun _ e -> e.Type = "Spring" && e.Nodes.Length = 1)
+
+    let along dof =
+      let supports =
+        r.Reactions
+        |> Map.toSeq
+        |> Seq.sumBy (fun (_, xs) -> xs.TryFind dof |> Option.defaultValue 0.0)
+
+      // A spring in tension pulls its node back towards the ground.
+      let springs =
+        r.SpringForces
+        |> Map.toSeq
+        |> Seq.filter (fun (id, _) -> grounded.ContainsKey id)
+        |> Seq.sumBy (fun (_, xs) -> xs.TryFind dof |> Option.defaultValue 0.0)
+
+      supports - springs
+
+    let applied = NodalLoads.resultant loads
+
+    let forces = directions |> List.map snd |> set
+
+    let total =
+      loads
+      |> List.filter (fun l -> forces.Contains l.Direction)
+      |> List.sumBy (fun l -> abs l.Magnitude)
+
+    let reactions =
+      directions |> List.map (fun (dof, name) -> name, along dof) |> Map.ofList
+
+    let imbalance =
+      directions
+      |> List.map (fun (_, name) ->
+        let load = applied.TryFind name |> Option.defaultValue 0.0
+        abs (load + reactions[name]))
+      |> List.max
+
+    let residual = if total > 0.0 then imbalance / total else imbalance
+
+    { Applied =
+        directions
+        |> List.map (fun (_, name) ->
+          name, applied.TryFind name |> Option.defaultValue 0.0)
+        |> Map.ofList
+      Reactions = reactions
+      Residual = residual
+      Converged = residual <= tolerance }
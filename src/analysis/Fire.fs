@@ -0,0 +1,315 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open Gazelle.Model
+
+/// <summary>
+/// Fire a steel member is exposed to.
+/// </summary>
+[<RequireQualifiedAccess>]
+type FireExposure =
+  /// Uniform steel temperature in degrees Celsius.
+  | Temperature of celsius: float
+  /// Minutes of the standard ISO 834 fire, heating unprotected steel.
+  | Duration of minutes: float
+
+[<RequireQualifiedAccess>]
+module FireExposure =
+
+  let getAsString (e: FireExposure) : string =
+    let culture = CultureInfo.InvariantCulture
+
+    match e with
+    | FireExposure.Temperature c -> c.ToString("0.#", culture) + "C"
+    | FireExposure.Duration t -> "R" + t.ToString("0.#", culture)
+
+  /// <summary>
+  /// Parses a fire exposure: "R60" for 60 minutes of the standard fire, up
+  /// to R240, or "550C", or just "550", for a steel temperature of 550 °C,
+  /// below 1200 °C where steel keeps no strength.
+  /// </summary>
+  /// <param name="text">Exposure, in any case.</param>
+  /// <returns>Matching exposure, or None.</returns>
+  let tryParse (text: string) : FireExposure option =
+    let text = text.Trim().ToUpperInvariant()
+
+    let culture = CultureInfo.InvariantCulture
+
+    let number (x: string) =
+      match Double.TryParse(x, NumberStyles.Float, culture) with
+      | true, v when v >= 0.0 && not (Double.IsInfinity v) -> Some v
+      | _ -> None
+
+    if text.StartsWith "R" then
+      number text[1..]
+      |> Option.filter (fun t -> t > 0.0 && t <= 240.0)
+      |> Option.map FireExposure.Duration
+    else
+      number (text.TrimEnd 'C')
+      |> Option.filter (fun c -> c < 1200.0)
+      |> Option.map FireExposure.Temperature
+
+/// <summary>
+/// Verification of a steel member at elevated temperature under one set of
+/// end forces.
+/// </summary>
+type FireCheck =
+  {
+    Element: string
+    /// Steel temperature in degrees Celsius.
+    Temperature: float
+    /// Reduction factor for the effective yield strength, k_y,θ.
+    YieldFactor: float
+    /// Reduction factor for the slope of the linear elastic range, k_E,θ.
+    ModulusFactor: float
+    /// Stress over the reduced yield strength, if the material declares one.
+    Strength: float option
+    /// Compression over the reduced elastic critical load, if the member
+    /// has the section properties to buckle.
+    Buckling: float option
+    /// Greater of the strength and buckling utilisations.
+    Utilisation: float
+    /// Steel temperature at which the utilisation reaches 1, or None when
+    /// it exceeds 1 at ambient temperature.
+    CriticalTemperature: float option
+  }
+
+/// <summary>
+/// Governing fire check of a member across analysed scenarios.
+/// </summary>
+type GoverningFire =
+  {
+    /// Scenario the check governs in, e.g. a results file.
+    Scenario: string
+    LoadSet: string
+    Check: FireCheck
+  }
+
+/// <summary>
+/// Fire checks of steel members to EN 1993-1-2, re-evaluating the checks
+/// of Design with the strength and stiffness of steel reduced for its
+/// temperature.
+/// </summary>
+/// <remarks>
+/// A member of a material of type "Steel" takes the effective yield
+/// strength k_y,θ·fy and the elastic modulus k_E,θ·E of Table 3.1,
+/// interpolated linearly, so its strength utilisation is divided by k_y,θ
+/// and its buckling utilisation by k_E,θ. Under the standard fire, the
+/// temperature of unprotected steel follows 4.2.5.1 in steps of 5 s, with
+/// the member's <c>section_factor</c> Am/V and no shadow effect; a member
+/// without one is taken at the gas temperature, which is conservative.
+/// The critical temperature is found by bisection, as the strength and
+/// stiffness only fall as the steel heats. The forces are those of the
+/// results checked, e.g. of the accidental combination for fire.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Fire =
+
+  /// Temperature, k_y,θ and k_E,θ of EN 1993-1-2 Table 3.1.
+  let private table =
+    [| 20.0, 1.0, 1.0
+       100.0, 1.0, 1.0
+       200.0, 1.0, 0.9
+       300.0, 1.0, 0.8
+       400.0, 1.0, 0.7
+       500.0, 0.78, 0.6
+       600.0, 0.47, 0.31
+       700.0, 0.23, 0.13
+       800.0, 0.11, 0.09
+       900.0, 0.06, 0.0675
+       1000.0, 0.04, 0.045
+       1100.0, 0.02, 0.0225
+       1200.0, 0.0, 0.0 |]
+
+  /// Ambient temperature, °C.
+  [<Literal>]
+  let Ambient = 20.0
+
+  /// <summary>
+  /// Returns the reduction factors of carbon steel at a temperature.
+  /// </summary>
+  /// <param name="temperature">Steel temperature, °C.</param>
+  /// <returns>k_y,θ and k_E,θ: 1 up to 20 °C, 0 from 1200 °C.</returns>
+  let reduction (temperature: float) : float * float =
+    match Array.tryFindIndex (fun (t, _, _) -> t >= temperature) table with
+    | Some 0 -> 1.0, 1.0
+    | None -> 0.0, 0.0
+    | Some i ->
+      let t0, y0, e0 = table[i - 1]
+      let t1, y1, e1 = table[i]
+      let s = (temperature - t0) / (t1 - t0)
+      y0 + s * (y1 - y0), e0 + s * (e1 - e0)
+
+  /// <summary>
+  /// Returns the gas temperature of the standard ISO 834 fire,
+  /// 20 + 345·log10(8t + 1).
+  /// </summary>
+  /// <param name="minutes">Time from ignition, minutes.</param>
+  /// <returns>Gas temperature, °C.</returns>
+  let standardFire (minutes: float) : float =
+    Ambient + 345.0 * log10 (8.0 * minutes + 1.0)
+
+  /// Specific heat of carbon steel in J/kgK, EN 1993-1-2 3.4.1.2.
+  let private specificHeat (t: float) =
+    if t < 600.0 then
+      425.0 + 0.773 * t - 1.69e-3 * t ** 2.0 + 2.22e-6 * t ** 3.0
+    elif t < 735.0 then
+      666.0 + 13002.0 / (738.0 - t)
+    elif t < 900.0 then
+      545.0 + 17820.0 / (t - 731.0)
+    else
+      650.0
+
+  /// <summary>
+  /// Returns the temperature of unprotected steel after a duration of the
+  /// standard fire, to EN 1993-1-2 4.2.5.1.
+  /// </summary>
+  /// <param name="sectionFactor">Section factor Am/V, per metre.</param>
+  /// <param name="minutes">Duration of the fire, minutes.</param>
+  /// <returns>Steel temperature, °C.</returns>
+  let steelTemperature (sectionFactor: float) (minutes: float) : float =
+    let step = 5.0
+    let steps = int (ceil (minutes * 60.0 / step))
+    let density = 7850.0
+    let convection = 25.0
+    let emissivity = 0.7
+    let stefanBoltzmann = 5.67e-8
+
+    let rec heat k (steel: float) =
+      if k = steps then
+        steel
+      else
+        let dt = min step (minutes * 60.0 - float k * step)
+        let gas = standardFire ((float k * step + dt) / 60.0)
+
+        let flux =
+          convection * (gas - steel)
+          + emissivity
+            * stefanBoltzmann
+            * ((gas + 273.0) ** 4.0 - (steel + 273.0) ** 4.0)
+
+        let rise =
+          sectionFactor / (specificHeat steel * density) * flux * dt
+
+        heat (k + 1) (steel + rise)
+
+    heat 0 Ambient
+
+  /// Utilisation at a temperature from those at ambient temperature.
+  let private utilisation strength buckling temperature =
+    let ky, ke = reduction temperature
+
+    let reduce u k =
+      u
+      |> Option.map (fun u ->
+        if u = 0.0 then 0.0
+        elif k > 0.0 then u / k
+        else infinity)
+
+    reduce strength ky, reduce buckling ke
+
+  /// <summary>
+  /// Returns the steel temperature at which a member's utilisation reaches
+  /// 1, from its utilisations at ambient temperature.
+  /// </summary>
+  /// <param name="strength">Strength utilisation at ambient, if any.</param>
+  /// <param name="buckling">Buckling utilisation at ambient, if any.</param>
+  /// <returns>Critical temperature to 0.1 °C, or None above 1 at ambient.
+  /// </returns>
+  let critical
+    (strength: float option)
+    (buckling: float option)
+    : float option =
+    let governing t =
+      let s, b = utilisation strength buckling t
+      max (defaultArg s 0.0) (defaultArg b 0.0)
+
+    let rec bisect low high =
+      if high - low < 0.1 then
+        high
+      else
+        let mid = (low + high) / 2.0
+
+        if governing mid >= 1.0 then bisect low mid else bisect mid high
+
+    if governing Ambient > 1.0 then None
+    elif governing 1200.0 < 1.0 then Some 1200.0
+    else Some(bisect Ambient 1200.0)
+
+  /// <summary>
+  /// Checks a steel member in fire under one set of end forces.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="exposure">Fire the member is exposed to.</param>
+  /// <param name="id">Member ID.</param>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <param name="stations">Internal forces along the member, as from
+  /// Diagrams.critical; empty to take the end forces alone.</param>
+  /// <returns>Check, or None when the member is not steel or neither
+  /// check applies.</returns>
+  let check
+    (m: Model)
+    (exposure: FireExposure)
+    (id: string)
+    (forces: float array)
+    (stations: Station list)
+    : FireCheck option =
+    let steel =
+      m.Elements.TryFind id
+      |> Option.bind (Materials.ofElement m)
+      |> Option.exists (fun x ->
+        String.Equals(x.Type, "Steel", StringComparison.OrdinalIgnoreCase))
+
+    // Section factor per metre, from the units of the model.
+    let sectionFactor () =
+      m.Elements.TryFind id
+      |> Option.bind (fun e -> e.Properties)
+      |> Option.bind (fun ps -> ps.TryFind "section_factor")
+      |> Option.bind (fun am ->
+        match UnitSystem.tryFind m.Info.Units, UnitSystem.tryFind "SI" with
+        | Ok source, Ok si -> Some(am * UnitSystem.factor source si -1 0)
+        | _ -> None)
+
+    match steel, Design.check m id forces stations with
+    | true, Some ambient ->
+      let temperature =
+        match exposure with
+        | FireExposure.Temperature t -> t
+        | FireExposure.Duration t ->
+          match sectionFactor () with
+          | Some am -> steelTemperature am t
+          | None -> standardFire t
+
+      let ky, ke = reduction temperature
+
+      let strength, buckling =
+        utilisation ambient.Strength ambient.Buckling temperature
+
+      Some
+        { Element = id
+          Temperature = temperature
+          YieldFactor = ky
+          ModulusFactor = ke
+          Strength = strength
+          Buckling = buckling
+          Utilisation = max (defaultArg strength 0.0) (defaultArg buckling 0.0)
+          CriticalTemperature = critical ambient.Strength ambient.Buckling }
+    | _ -> None
+
+  /// <summary>
+  /// Finds the governing fire check of each member: its greatest
+  /// utilisation across every scenario and load set.
+  /// </summary>
+  /// <param name="checks">Checks with their scenario and load set.</param>
+  /// <returns>Governing check of each member, ordered by member ID.</returns>
+  let govern (checks: GoverningFire seq) : GoverningFire list =
+    checks
+    |> Seq.groupBy (fun c -> c.Check.Element)
+    |> Seq.map (snd >> Seq.maxBy (fun c -> c.Check.Utilisation))
+    |> Seq.sortBy (fun c -> c.Check.Element)
+    |> List.ofSeq
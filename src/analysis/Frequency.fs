@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+
+/// <summary>
+/// Amplitude of one frequency in a sampled signal.
+/// </summary>
+type FourierComponent =
+  {
+    /// Frequency in Hz.
+    Frequency: float
+    /// Amplitude of the sinusoid at this frequency, in signal units.
+    Amplitude: float
+  }
+
+/// <summary>
+/// Errors raised whilst analysing the frequency content of a signal.
+/// </summary>
+type FrequencyError =
+  | TooFewSamples of count: int
+  | InvalidSampling of step: float
+  | InvalidDampingRatio of ratio: float
+
+[<RequireQualifiedAccess>]
+module FrequencyError =
+
+  let getAsString (e: FrequencyError) : string =
+    match e with
+    | TooFewSamples count ->
+      $"Signal has {count} sample(s); at least 2 required."
+    | InvalidSampling step -> $"Time step {step} must be positive."
+    | InvalidDampingRatio ratio ->
+      $"Damping ratio {ratio} must be in [0, 1)."
+
+/// <summary>
+/// Frequency content of time histories: Fourier amplitude spectra and
+/// response spectra of recorded accelerations.
+/// </summary>
+/// <remarks>
+/// Amplitudes come from a radix-2 fast Fourier transform of the signal,
+/// zero-padded to a power of two, and are scaled so that a sinusoid of
+/// amplitude A sampled over whole cycles shows a peak of A. Response
+/// spectra give the pseudo-acceleration ω²·max|u| of damped oscillators
+/// of unit mass driven from rest by the acceleration, each integrated
+/// exactly for accelerations varying linearly over a step, so they can be
+/// compared with a design spectrum or the input excitation.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Frequency =
+
+  /// In-place radix-2 transform of a signal whose length is a power of two.
+  let private fft (re: float array) (im: float array) =
+    let n = re.Length
+    let mutable j = 0
+
+    // Bit-reversal permutation.
+    for i in 1 .. n - 1 do
+      let mutable bit = n >>> 1
+
+      while j &&& bit <> 0 do
+        j <- j ^^^ bit
+        bit <- bit >>> 1
+
+      j <- j ^^^ bit
+
+      if i < j then
+        let r, m = re[i], im[i]
+        re[i] <- re[j]
+        im[i] <- im[j]
+        re[j] <- r
+        im[j] <- m
+
+    let mutable size = 2
+
+    while size <= n do
+      let angle = -2.0 * Math.PI / float size
+      let half = size / 2
+
+      for start in 0..size .. n - 1 do
+        for k in 0 .. half - 1 do
+          let c, s = cos (angle * float k), sin (angle * float k)
+          let a, b = start + k, start + k + half
+          let r = re[b] * c - im[b] * s
+          let m = re[b] * s + im[b] * c
+          re[b] <- re[a] - r
+          im[b] <- im[a] - m
+          re[a] <- re[a] + r
+          im[a] <- im[a] + m
+
+      size <- size * 2
+
+  let private validate (dt: float) (signal: float array) =
+    if signal.Length < 2 then Error(TooFewSamples signal.Length)
+    elif dt <= 0.0 || Double.IsNaN dt then Error(InvalidSampling dt)
+    else Ok()
+
+  /// <summary>
+  /// Returns the single-sided Fourier amplitude spectrum of a signal.
+  /// </summary>
+  /// <param name="dt">Time step between samples.</param>
+  /// <param name="signal">Sample at each step.</param>
+  /// <returns>
+  /// Amplitude at each frequency from zero to the Nyquist frequency, or
+  /// FrequencyError.
+  /// </returns>
+  let amplitudes
+    (dt: float)
+    (signal: float array)
+    : Result<FourierComponent array, FrequencyError> =
+    validate dt signal
+    |> Result.map (fun () ->
+      let mutable n = 1
+
+      while n < signal.Length do
+        n <- n * 2
+
+      let re =
+        Array.init n (fun i -> if i < signal.Length then signal[i] else 0.0)
+
+      let im = Array.zeroCreate n
+      fft re im
+
+      // Scale by the samples taken, not the padding, to keep amplitudes.
+      let count = float signal.Length
+
+      Array.init (n / 2 + 1) (fun k ->
+        let modulus = sqrt (re[k] * re[k] + im[k] * im[k])
+        let sides = if k = 0 || k = n / 2 then 1.0 else 2.0
+
+        { Frequency = float k / (float n * dt)
+          Amplitude = sides * modulus / count }))
+
+  /// <summary>
+  /// Returns the component of largest amplitude, ignoring the mean.
+  /// </summary>
+  /// <param name="components">Fourier amplitude spectrum.</param>
+  /// <returns>Dominant component, if any besides the mean.</returns>
+  let dominant (components: FourierComponent array) : FourierComponent option =
+    components
+    |> Array.filter (fun c -> c.Frequency > 0.0)
+    |> Array.sortByDescending (fun c -> c.Amplitude)
+    |> Array.tryHead
+
+  /// <summary>
+  /// Returns periods spaced evenly on a logarithmic scale.
+  /// </summary>
+  /// <param name="count">Number of periods, at least 2.</param>
+  /// <param name="shortest">Shortest period in seconds.</param>
+  /// <param name="longest">Longest period in seconds.</param>
+  /// <returns>Periods in ascending order.</returns>
+  let periods (count: int) (shortest: float) (longest: float) : float list =
+    let ratio = log (longest / shortest) / float (max (count - 1) 1)
+    [ for i in 0 .. count - 1 -> shortest * exp (ratio * float i) ]
+
+  /// <summary>
+  /// Computes the pseudo-acceleration response spectrum of an acceleration
+  /// history at given periods.
+  /// </summary>
+  /// <param name="ratio">Damping ratio of each oscillator, e.g. 0.05.</param>
+  /// <param name="dt">Time step between samples.</param>
+  /// <param name="periods">Natural periods in seconds.</param>
+  /// <param name="accelerations">Acceleration at each step.</param>
+  /// <returns>Response spectrum, or FrequencyError.</returns>
+  let responseSpectrum
+    (ratio: float)
+    (dt: float)
+    (periods: float list)
+    (accelerations: float array)
+    : Result<ResponseSpectrum, FrequencyError> =
+    match validate dt accelerations with
+    | Error e -> Error e
+    | Ok() when ratio < 0.0 || ratio >= 1.0 -> Error(InvalidDampingRatio ratio)
+    | Ok() ->
+      // A base acceleration loads an oscillator of unit mass by its reverse.
+      let load = accelerations |> Array.map (fun a -> -a)
+      let periods = periods |> List.filter (fun t -> t > 0.0) |> List.sort
+
+      let peak period =
+        let omega = 2.0 * Math.PI / period
+
+        ModalSuperposition.oscillator omega ratio dt load
+        |> Array.fold (fun x u -> max x (abs u)) 0.0
+        |> (*) (omega * omega)
+
+      Ok
+        { Periods = periods
+          Accelerations = periods |> List.map peak }
@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.IO
+open System.Text
+open System.Text.Json.Nodes
+open Gazelle.Model
+
+/// <summary>
+/// Deformed shape of a model to draw alongside it, e.g. under a load set.
+/// </summary>
+type GltfShape =
+  { Name: string
+    /// Displacements of each node, by degree of freedom.
+    Displacements: Map<string, Map<Dof, float>> }
+
+/// <summary>
+/// Scenes of models in glTF 2.0, the Khronos format read by standard 3D
+/// viewers, game engines and web apps.
+/// </summary>
+/// <remarks>
+/// The model, and each deformed shape with its displacements magnified by
+/// a scale factor, is a node of the scene whose mesh has points at the
+/// model's nodes, lines along its two-node elements and triangles across
+/// its plates and shells, fanned from their first node. The shapes share
+/// the model's lines and triangles and differ only in their positions.
+/// glTF is in metres with Y up, as models are by default, so coordinates
+/// are converted from the model's units but keep their axes; models in
+/// unknown units are taken to be in metres. Rotations are not drawn.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Gltf =
+
+  /// Component types and buffer targets of the glTF specification.
+  [<Literal>]
+  let private Float = 5126
+
+  [<Literal>]
+  let private UnsignedInt = 5125
+
+  [<Literal>]
+  let private ArrayBuffer = 34962
+
+  [<Literal>]
+  let private ElementArrayBuffer = 34963
+
+  let private number (x: float) : JsonNode = JsonValue.Create x
+  let private integer (x: int) : JsonNode = JsonValue.Create x
+  let private text (x: string) : JsonNode = JsonValue.Create x
+
+  let private list (xs: JsonNode seq) : JsonNode = JsonArray(Array.ofSeq xs)
+
+  let private record (properties: (string * JsonNode) list) : JsonNode =
+    let o = JsonObject()
+
+    for name, value in properties do
+      o[name] <- value
+
+    o
+
+  let private bytes (xs: Array) =
+    let out = Array.zeroCreate (Buffer.ByteLength xs)
+    Buffer.BlockCopy(xs, 0, out, 0, out.Length)
+    out
+
+  /// Material of a colour in linear RGB, seen from both sides.
+  let private material (name: string) (r: float) (g: float) (b: float) =
+    record
+      [ "name", text name
+        "doubleSided", JsonValue.Create true
+        "pbrMetallicRoughness",
+        record
+          [ "baseColorFactor", list [ number r; number g; number b; number 1.0 ]
+            "metallicFactor", number 0.0
+            "roughnessFactor", number 1.0 ] ]
+
+  /// Scene of a model in glTF JSON, with the binary buffer it refers to.
+  let private build
+    (m: Model)
+    (shapes: GltfShape list)
+    (scale: float)
+    : JsonObject * byte array =
+    let metres =
+      match UnitSystem.tryFind m.Info.Units with
+      | Ok units -> units.Length
+      | Error _ -> 1.0
+
+    let buffer = new MemoryStream()
+    let views = ResizeArray<JsonNode>()
+    let accessors = ResizeArray<JsonNode>()
+
+    // Appends data to the buffer as a view and an accessor of it.
+    let add target kind count (data: Array) bounds =
+      let data = bytes data
+
+      views.Add(
+        record
+          [ "buffer", integer 0
+            "byteOffset", integer (int buffer.Length)
+            "byteLength", integer data.Length
+            "target", integer target ]
+      )
+
+      buffer.Write(data, 0, data.Length)
+
+      accessors.Add(
+        record (
+          [ "bufferView", integer (views.Count - 1)
+            "componentType",
+            integer (if target = ArrayBuffer then Float else UnsignedInt)
+            "count", integer count
+            "type", text kind ]
+          @ bounds
+        )
+      )
+
+      accessors.Count - 1
+
+    let ids = m.Nodes |> Map.keys |> Array.ofSeq
+    let index = ids |> Array.mapi (fun i id -> id, uint32 i) |> Map.ofArray
+
+    let corners (e: Element) = e.Nodes |> List.choose index.TryFind
+
+    let lines =
+      [| for KeyValue(_, e) in m.Elements do
+           match corners e with
+           | [ a; b ] -> yield! [| a; b |]
+           | _ -> () |]
+
+    let triangles =
+      [| for KeyValue(_, e) in m.Elements do
+           match corners e with
+           | first :: (_ :: _ :: _ as rest) ->
+             for b, c in List.pairwise rest do
+               yield! [| first; b; c |]
+           | _ -> () |]
+
+    // Indices of each kind of primitive, shared by every mesh.
+    let primitives =
+      [ 0, Array.init ids.Length uint32; 1, lines; 4, triangles ]
+      |> List.filter (fun (_, indices) -> indices.Length > 0)
+      |> List.map (fun (mode, indices) ->
+        mode, add ElementArrayBuffer "SCALAR" indices.Length indices [])
+
+    let mesh (name: string) (material: int) (u: Map<string, Map<Dof, float>>) =
+      let points =
+        ids
+        |> Array.map (fun id ->
+          let n = m.Nodes[id]
+
+          let at dof =
+            u.TryFind id
+            |> Option.bind (Map.tryFind dof)
+            |> Option.defaultValue 0.0
+
+          [| n.X + scale * at Ux; n.Y + scale * at Uy; n.Z + scale * at Uz |]
+          |> Array.map (fun x -> float32 (x * metres)))
+
+      let bound f =
+        list
+          [ for axis in 0..2 ->
+              points |> Array.map (Array.item axis) |> f |> float |> number ]
+
+      let position =
+        add
+          ArrayBuffer
+          "VEC3"
+          points.Length
+          (Array.concat points)
+          [ "min", bound Array.min; "max", bound Array.max ]
+
+      record
+        [ "name", text name
+          "primitives",
+          list
+            [ for mode, indices in primitives ->
+                record
+                  [ "attributes", record [ "POSITION", integer position ]
+                    "indices", integer indices
+                    "mode", integer mode
+                    "material", integer material ] ] ]
+
+    // A model without nodes has nothing to draw.
+    let drawn =
+      if ids.Length = 0 then
+        []
+      else
+        (m.Info.Name, 0, Map.empty)
+        :: [ for s in shapes -> s.Name, 1, s.Displacements ]
+
+    let meshes = drawn |> List.map (fun (name, k, u) -> mesh name k u)
+
+    let nodes =
+      drawn
+      |> List.mapi (fun i (name, _, _) ->
+        record
+          [ "name", text name
+            "mesh", integer i
+            if i > 0 then
+              "extras", record [ "scale", number scale ] ])
+
+    let scene =
+      record
+        [ "asset",
+          record [ "version", text "2.0"; "generator", text "Gazelle" ]
+          "scene", integer 0
+          "scenes",
+          list
+            [ record
+                [ "name", text m.Info.Name
+                  "nodes", list (List.init nodes.Length integer) ] ]
+          "nodes", list nodes
+          "meshes", list meshes
+          "materials",
+          list
+            [ material "Model" 0.5 0.5 0.5
+              material "Deformed" 0.8 0.2 0.02 ]
+          "accessors", list accessors
+          "bufferViews", list views ]
+
+    scene.AsObject(), buffer.ToArray()
+
+  /// <summary>
+  /// Writes a model, and any deformed shapes of it, as a glTF scene with
+  /// its geometry embedded in the JSON, for a .gltf file.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="shapes">Deformed shapes, e.g. one per load set.</param>
+  /// <param name="scale">Factor the displacements are magnified by.</param>
+  /// <returns>glTF JSON.</returns>
+  let toGltf (m: Model) (shapes: GltfShape list) (scale: float) : string =
+    let scene, data = build m shapes scale
+
+    if data.Length > 0 then
+      let uri =
+        "data:application/octet-stream;base64," + Convert.ToBase64String data
+
+      scene["buffers"] <-
+        list [ record [ "byteLength", integer data.Length; "uri", text uri ] ]
+
+    scene.ToJsonString()
+
+  /// <summary>
+  /// Writes a model, and any deformed shapes of it, as a binary glTF scene,
+  /// for a .glb file.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="shapes">Deformed shapes, e.g. one per load set.</param>
+  /// <param name="scale">Factor the displacements are magnified by.</param>
+  /// <returns>GLB container of the scene and its buffer.</returns>
+  let toGlb (m: Model) (shapes: GltfShape list) (scale: float) : byte array =
+    let scene, data = build m shapes scale
+
+    if data.Length > 0 then
+      scene["buffers"] <- list [ record [ "byteLength", integer data.Length ] ]
+
+    // Chunks are padded to four bytes, JSON with spaces.
+    let pad (filler: byte) (chunk: byte array) =
+      Array.append chunk (Array.create ((4 - chunk.Length % 4) % 4) filler)
+
+    let json = pad 0x20uy (Encoding.UTF8.GetBytes(scene.ToJsonString()))
+    let binary = pad 0uy data
+
+    let chunks =
+      [ yield json, 0x4E4F534Au
+        if binary.Length > 0 then
+          yield binary, 0x004E4942u ]
+
+    let length (chunk: byte array, _) = 8u + uint32 chunk.Length
+
+    // Header: "glTF", the container version and the total length.
+    use out = new MemoryStream()
+    use writer = new BinaryWriter(out)
+    writer.Write 0x46546C67u
+    writer.Write 2u
+    writer.Write(12u + List.sumBy length chunks)
+
+    for chunk, kind in chunks do
+      writer.Write(uint32 chunk.Length)
+      writer.Write kind
+      writer.Write chunk
+
+    writer.Flush()
+    out.ToArray()
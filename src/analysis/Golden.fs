@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.IO
+open System.Text.Encodings.Web
+open System.Text.Json
+open Gazelle.Model
+
+/// <summary>
+/// Expected static response of a model to one load set. Only the values
+/// given are checked, so any block may be left out.
+/// </summary>
+type GoldenLoadSet =
+  {
+    /// Displacement by node and degree of freedom, e.g. "Uy".
+    Displacements: Map<string, Map<string, float>> option
+    /// Reaction by node and degree of freedom, in global axes.
+    Reactions: Map<string, Map<string, float>> option
+    MemberForces: Map<string, float list> option
+  }
+
+/// <summary>
+/// Expected results of a model, stored alongside it to verify later runs.
+/// </summary>
+type GoldenResults =
+  {
+    /// Path to the model, relative to the expected results file.
+    Model: string
+    /// Absolute tolerance, added to the relative one.
+    Absolute: float
+    /// Tolerance relative to the magnitude of each expected value.
+    Relative: float
+    LoadSets: Map<string, GoldenLoadSet>
+  }
+
+/// <summary>
+/// A value outside its tolerance, or missing from the results.
+/// </summary>
+type GoldenMismatch =
+  {
+    LoadSet: string
+    /// What was compared, e.g. "displacement n2 Uy" or "member force e1[3]".
+    Quantity: string
+    Expected: float
+    Actual: float option
+  }
+
+/// <summary>
+/// Errors raised whilst reading expected results or analysing their model.
+/// </summary>
+type GoldenError =
+  | UnreadableExpected of reason: string
+  | UnreadableModel of ModelError
+  | UnselectableLoads of SelectionError
+  | FailedLoadSet of loadSet: string * error: StaticError
+
+[<RequireQualifiedAccess>]
+module GoldenError =
+
+  let getAsString (e: GoldenError) : string =
+    match e with
+    | UnreadableExpected reason -> $"Unreadable Expected Results: {reason}."
+    | UnreadableModel e -> ModelError.getAsString e
+    | UnselectableLoads e -> SelectionError.getAsString e
+    | FailedLoadSet(set, e) -> $"Load set '{set}': {StaticError.getAsString e}"
+
+/// <summary>
+/// Golden-result regression testing: records the static results of a
+/// model once they have been verified, then checks later runs against
+/// them within a tolerance.
+/// </summary>
+/// <remarks>
+/// Expected results of "model.json" are kept in "model.expected.json" as
+/// indented JSON, so they can be reviewed and committed with the model.
+/// A value passes when it lies within Absolute + Relative·|expected| of
+/// the expected value. Test suites call check on each file and assert
+/// that no mismatches are returned, as gz test does.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Golden =
+
+  /// Suffix of expected results files, replacing the model's extension.
+  [<Literal>]
+  let Extension = ".expected.json"
+
+  /// Default absolute tolerance.
+  [<Literal>]
+  let Absolute = 1e-9
+
+  /// Default relative tolerance.
+  [<Literal>]
+  let Relative = 1e-6
+
+  let private jsonOptions =
+    JsonSerializerOptions(
+      PropertyNamingPolicy = JsonNamingPolicy.CamelCase,
+      Encoder = JavaScriptEncoder.UnsafeRelaxedJsonEscaping,
+      WriteIndented = true
+    )
+
+  /// <summary>
+  /// Returns the path of the expected results of a model.
+  /// </summary>
+  /// <param name="model">Path to model file.</param>
+  /// <returns>Path to expected results file.</returns>
+  let pathFor (model: string) : string =
+    Path.ChangeExtension(model, null) + Extension
+
+  /// <summary>
+  /// Analyses every load case and combination of a model.
+  /// </summary>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Static response by load set name, or GoldenError.</returns>
+  let analyse (m: Model) : Result<Map<string, StaticResult>, GoldenError> =
+    LoadCases.select m None None
+    |> Result.mapError UnselectableLoads
+    |> Result.bind (fun sets ->
+      List.foldBack
+        (fun (set: LoadSet) acc ->
+          match Static.analyse m set, acc with
+          | Ok r, Ok rest -> Ok(Map.add set.Name r rest)
+          | Error e, _ -> Error(FailedLoadSet(set.Name, e))
+          | _, Error e -> Error e)
+        sets
+        (Ok Map.empty))
+
+  /// <summary>
+  /// Records every displacement, reaction and member force of a model's
+  /// results as expected results with the default tolerances.
+  /// </summary>
+  /// <param name="model">Path to the model, relative to the results.</param>
+  /// <param name="results">Static response by load set name.</param>
+  /// <returns>Expected results.</returns>
+  let record
+    (model: string)
+    (results: Map<string, StaticResult>)
+    : GoldenResults =
+    let named (values: Map<string, Map<Dof, float>>) =
+      values
+      |> Map.map (fun _ dofs ->
+        dofs |> Map.toSeq |> Seq.map (fun (d, x) -> Dof.getAsString d, x))
+      |> Map.map (fun _ xs -> Map.ofSeq xs)
+
+    { Model = model
+      Absolute = Absolute
+      Relative = Relative
+      LoadSets =
+        results
+        |> Map.map (fun _ r ->
+          let forces = r.MemberForces |> Map.map (fun _ xs -> List.ofArray xs)
+
+          { Displacements = Some(named r.Displacements)
+            Reactions = Some(named r.Reactions)
+            MemberForces = Some forces })
+    }
+
+  /// <summary>
+  /// Returns whether a value lies within the tolerance of its expected
+  /// value.
+  /// </summary>
+  /// <param name="g">Expected results, giving the tolerances.</param>
+  /// <param name="expected">Expected value.</param>
+  /// <param name="actual">Value found.</param>
+  /// <returns>True when within tolerance.</returns>
+  let within (g: GoldenResults) (expected: float) (actual: float) : bool =
+    abs (actual - expected) <= g.Absolute + g.Relative * abs expected
+
+  /// <summary>
+  /// Compares results with the expected results, value by value.
+  /// </summary>
+  /// <param name="g">Expected results.</param>
+  /// <param name="results">Static response by load set name.</param>
+  /// <returns>Mismatches, in order; empty when the results pass.</returns>
+  let compare
+    (g: GoldenResults)
+    (results: Map<string, StaticResult>)
+    : GoldenMismatch list =
+    [ for KeyValue(name, expected) in g.LoadSets do
+        let actual = results.TryFind name
+
+        let mismatch quantity value found =
+          match found with
+          | Some x when within g value x -> []
+          | _ ->
+            [ { LoadSet = name
+                Quantity = quantity
+                Expected = value
+                Actual = found } ]
+
+        let nodal label values (pick: StaticResult -> Map<string, _>) =
+          [ for KeyValue(node, dofs) in defaultArg values Map.empty do
+              for KeyValue(dof, value) in dofs do
+                yield!
+                  actual
+                  |> Option.bind (fun r -> (pick r).TryFind node)
+                  |> Option.bind (fun (xs: Map<Dof, float>) ->
+                    Dof.tryParse dof |> Option.bind xs.TryFind)
+                  |> mismatch $"{label} {node} {dof}" value ]
+
+        let displaced = nodal "displacement" expected.Displacements
+        yield! displaced (fun r -> r.Displacements)
+        yield! nodal "reaction" expected.Reactions (fun r -> r.Reactions)
+
+        let forces = defaultArg expected.MemberForces Map.empty
+
+        for KeyValue(id, forces) in forces do
+          for i, value in List.indexed forces do
+            yield!
+              actual
+              |> Option.bind (fun r -> r.MemberForces.TryFind id)
+              |> Option.bind (Array.tryItem i)
+              |> mismatch $"member force {id}[{i}]" value ]
+
+  /// <summary>
+  /// Describes a mismatch for a test report.
+  /// </summary>
+  /// <param name="m">Mismatch.</param>
+  /// <returns>One line of text.</returns>
+  let describe (m: GoldenMismatch) : string =
+    match m.Actual with
+    | Some x ->
+      $"{m.LoadSet} {m.Quantity}: expected {m.Expected:G6}, got {x:G6}"
+    | None -> $"{m.LoadSet} {m.Quantity}: expected {m.Expected:G6}, missing"
+
+  /// <summary>
+  /// Reads expected results.
+  /// </summary>
+  /// <param name="path">Path to expected results file.</param>
+  /// <returns>Expected results, or UnreadableExpected.</returns>
+  let read (path: string) : Result<GoldenResults, GoldenError> =
+    try
+      let json = File.ReadAllText path
+
+      match JsonSerializer.Deserialize<GoldenResults>(json, jsonOptions) with
+      | g when obj.ReferenceEquals(g, null) ->
+        Error(UnreadableExpected "file is empty")
+      | g when isNull g.Model || isNull (box g.LoadSets) ->
+        Error(UnreadableExpected "file needs a model and load sets")
+      | g -> Ok g
+    with
+    | :? JsonException as ex -> Error(UnreadableExpected ex.Message)
+    | :? IOException
+    | :? UnauthorizedAccessException as ex ->
+      Error(UnreadableExpected ex.Message)
+
+  /// <summary>
+  /// Writes expected results as indented JSON.
+  /// </summary>
+  /// <param name="path">Destination file path.</param>
+  /// <param name="g">Expected results.</param>
+  let write (path: string) (g: GoldenResults) : unit =
+    File.WriteAllText(path, JsonSerializer.Serialize(g, jsonOptions))
+
+  /// <summary>
+  /// Analyses the model of an expected results file and compares its
+  /// results with them.
+  /// </summary>
+  /// <param name="path">Path to expected results file.</param>
+  /// <returns>
+  /// Mismatches, empty when the model passes, or GoldenError.
+  /// </returns>
+  let check (path: string) : Result<GoldenMismatch list, GoldenError> =
+    read path
+    |> Result.bind (fun g ->
+      let directory = Path.GetDirectoryName(Path.GetFullPath path)
+
+      Model.read None (Path.Combine(directory, g.Model))
+      |> Result.mapError UnreadableModel
+      |> Result.bind analyse
+      |> Result.map (compare g))
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.IO
+open System.Text.Json
+open System.Text.Json.Nodes
+open Gazelle.Model
+
+/// <summary>
+/// Displacements of a previous solution that an iterative solve starts
+/// from in place of rest, e.g. the last step of an incremental study.
+/// </summary>
+type InitialState =
+  {
+    /// Displacement of each degree of freedom, keyed by node ID.
+    Displacements: Map<string, Map<Dof, float>>
+  }
+
+/// <summary>
+/// Errors raised whilst reading an initial state.
+/// </summary>
+type InitialStateError =
+  | UnreadableState of reason: string
+  | MalformedState of reason: string
+  | UnknownNode of node: string
+
+[<RequireQualifiedAccess>]
+module InitialStateError =
+
+  let getAsString (e: InitialStateError) : string =
+    match e with
+    | UnreadableState reason -> $"Unreadable Initial State: {reason}."
+    | MalformedState reason -> $"Malformed Initial State: {reason}."
+    | UnknownNode node ->
+      $"Initial state has displacements at node '{node}' not in the model."
+
+/// <summary>
+/// Reads initial states from results files of a previous analysis.
+/// </summary>
+/// <remarks>
+/// The file holds a <c>displacements</c> object of nodes, each mapping DOF
+/// names to values, e.g. <c>{"displacements": {"n2": {"Uy": -0.01}}}</c>.
+/// Other properties of the results file are ignored, and DOFs that are
+/// omitted start from zero. Files of earlier ResultFormat versions are
+/// upgraded before they are read.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module InitialState =
+
+  /// State at rest, from which analyses start by default.
+  let empty = { Displacements = Map.empty }
+
+  let private components
+    (node: string)
+    (value: JsonNode)
+    : Result<Map<Dof, float>, InitialStateError> =
+    let invalid (name: string) reason =
+      Error(MalformedState $"'{name}' at node '{node}' is not {reason}")
+
+    match value with
+    | :? JsonObject as o ->
+      o
+      |> Seq.fold
+        (fun acc kv ->
+          match acc, Dof.tryParse kv.Key, kv.Value with
+          | Error e, _, _ -> Error e
+          | Ok _, None, _ -> invalid kv.Key "a DOF"
+          | Ok dofs, Some dof, (:? JsonValue as v) ->
+            match v.TryGetValue<float>() with
+            | true, x -> Ok(Map.add dof x dofs)
+            | _ -> invalid kv.Key "a number"
+          | Ok _, Some _, _ -> invalid kv.Key "a number")
+        (Ok Map.empty)
+    | _ -> Error(MalformedState $"node '{node}' is not an object")
+
+  /// <summary>
+  /// Parses an initial state from the JSON text of a results file.
+  /// </summary>
+  /// <param name="text">JSON text.</param>
+  /// <returns>Initial state, or InitialStateError.</returns>
+  let parse (text: string) : Result<InitialState, InitialStateError> =
+    let root =
+      try
+        Ok(JsonNode.Parse text)
+      with :? JsonException as ex ->
+        Error(MalformedState ex.Message)
+
+    let migrated =
+      match root with
+      | Ok(:? JsonObject as o) ->
+        ResultFormat.migrate o
+        |> Result.mapError (fun e ->
+          MalformedState $"results {ResultFormatError.getAsString e}")
+        |> Result.map (fun o -> o :> JsonNode)
+      | other -> other
+
+    match migrated with
+    | Error e -> Error e
+    | Ok(:? JsonObject as o) ->
+      match o["displacements"] with
+      | :? JsonObject as nodes ->
+        nodes
+        |> Seq.fold
+          (fun acc kv ->
+            match acc, components kv.Key kv.Value with
+            | Ok state, Ok dofs -> Ok(Map.add kv.Key dofs state)
+            | Error e, _
+            | _, Error e -> Error e)
+          (Ok Map.empty)
+        |> Result.map (fun d -> { Displacements = d })
+      | null -> Error(MalformedState "missing 'displacements'")
+      | _ -> Error(MalformedState "'displacements' is not an object")
+    | Ok _ -> Error(MalformedState "document is not an object")
+
+  /// <summary>
+  /// Reads an initial state from a results file.
+  /// </summary>
+  /// <param name="path">Path to results file.</param>
+  /// <returns>Initial state, or InitialStateError.</returns>
+  let read (path: string) : Result<InitialState, InitialStateError> =
+    let text =
+      try
+        Ok(File.ReadAllText path)
+      with
+      | :? IOException as ex -> Error(UnreadableState ex.Message)
+      | :? UnauthorizedAccessException as ex ->
+        Error(UnreadableState ex.Message)
+
+    text |> Result.bind parse
+
+  /// <summary>
+  /// Checks that an initial state only refers to nodes of a model.
+  /// </summary>
+  /// <param name="m">Model to analyse.</param>
+  /// <param name="s">Initial state.</param>
+  /// <returns>The state, or UnknownNode for the first stray node.</returns>
+  let check
+    (m: Model)
+    (s: InitialState)
+    : Result<InitialState, InitialStateError> =
+    let stray =
+      s.Displacements |> Map.tryFindKey (fun n _ -> not (m.Nodes.ContainsKey n))
+
+    match stray with
+    | Some node -> Error(UnknownNode node)
+    | None -> Ok s
+
+  /// <summary>
+  /// Returns the starting displacement of a degree of freedom.
+  /// </summary>
+  /// <param name="s">Initial state.</param>
+  /// <param name="node">Node ID.</param>
+  /// <param name="dof">Degree of freedom.</param>
+  /// <returns>Displacement, or zero when the state omits it.</returns>
+  let displacement (s: InitialState) (node: string) (dof: Dof) : float =
+    s.Displacements
+    |> Map.tryFind node
+    |> Option.bind (Map.tryFind dof)
+    |> Option.defaultValue 0.0
+
+  /// <summary>
+  /// Returns the displacements of an initial state over the degrees of
+  /// freedom of an assembly, to start an iterative solve from.
+  /// </summary>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="s">Initial state.</param>
+  /// <returns>Displacement of each row of the assembly.</returns>
+  let toVector (a: Assembly) (s: InitialState) : float array =
+    a.Dofs |> Array.map (fun (node, dof) -> displacement s node dof)
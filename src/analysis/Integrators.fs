@@ -0,0 +1,326 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+
+/// <summary>
+/// Direct time integration scheme for M·ü + C·u̇ + K·u = f(t).
+/// </summary>
+type Integrator =
+  /// Implicit Newmark-β scheme; β = 1/4 and γ = 1/2, constant average
+  /// acceleration, is unconditionally stable without numerical damping.
+  | Newmark of beta: float * gamma: float
+  /// Implicit Hilber-Hughes-Taylor scheme; alpha in [-1/3, 0] damps high
+  /// frequencies numerically, with 0 giving the trapezoidal rule.
+  | HhtAlpha of alpha: float
+  /// Implicit generalised-α scheme of Chung and Hulbert; the spectral
+  /// radius at infinite frequency, in [0, 1], controls numerical damping.
+  | GeneralizedAlpha of spectralRadius: float
+  /// Explicit central difference scheme, suited to short impact-type
+  /// loading; stable only below the critical time step.
+  | CentralDifference
+
+/// <summary>
+/// Assembled mass, damping and stiffness matrices of a structure.
+/// </summary>
+type StructuralSystem =
+  { Mass: float[,]
+    Damping: float[,]
+    Stiffness: float[,] }
+
+[<RequireQualifiedAccess>]
+module Integrator =
+
+  /// Numerical damping used when --integrator names a scheme only.
+  let defaults =
+    [ "newmark", Newmark(0.25, 0.5)
+      "hht-alpha", HhtAlpha -0.05
+      "generalized-alpha", GeneralizedAlpha 0.8
+      "central-difference", CentralDifference ]
+
+  let getAsString (i: Integrator) : string =
+    let culture = CultureInfo.InvariantCulture
+
+    match i with
+    | Newmark(beta, gamma) ->
+      $"newmark:{beta.ToString culture}:{gamma.ToString culture}"
+    | HhtAlpha alpha -> $"hht-alpha:{alpha.ToString culture}"
+    | GeneralizedAlpha rho -> $"generalized-alpha:{rho.ToString culture}"
+    | CentralDifference -> "central-difference"
+
+  /// <summary>
+  /// Parses an integrator, e.g. "newmark:0.25:0.5", "hht-alpha:-0.1",
+  /// "generalized-alpha:0.9" or "central-difference".
+  /// </summary>
+  /// <param name="name">Scheme name and optional parameter.</param>
+  /// <returns>Matching integrator, or the reason it is invalid.</returns>
+  let tryParse (name: string) : Result<Integrator, TransientError> =
+    let parts = name.Trim().ToLowerInvariant().Split(':')
+    let styles = NumberStyles.Float
+    let culture = CultureInfo.InvariantCulture
+    let names = String.Join(", ", defaults |> List.map fst)
+
+    let parameter (text: string) =
+      match Double.TryParse(text, styles, culture) with
+      | true, x -> Ok x
+      | _ -> Error(InvalidIntegrator $"parameter '{text}' is not a number")
+
+    match parts with
+    | [| scheme |] ->
+      match List.tryFind (fst >> (=) scheme) defaults with
+      | Some(_, i) -> Ok i
+      | None -> Error(InvalidIntegrator $"'{scheme}' is not one of {names}")
+    | [| "newmark"; b; g |] ->
+      parameter b
+      |> Result.bind (fun beta -> parameter g |> Result.map (fun g -> beta, g))
+      |> Result.bind (fun (beta, gamma) ->
+        if beta <= 0.0 then
+          Error(InvalidIntegrator $"beta {beta} is not positive")
+        elif gamma < 0.5 then
+          Error(InvalidIntegrator $"gamma {gamma} is less than 1/2")
+        else
+          Ok(Newmark(beta, gamma)))
+    | [| "hht-alpha"; text |] ->
+      parameter text
+      |> Result.bind (fun alpha ->
+        if alpha >= -1.0 / 3.0 && alpha <= 0.0 then
+          Ok(HhtAlpha alpha)
+        else
+          Error(InvalidIntegrator $"alpha {alpha} is not in [-1/3, 0]"))
+    | [| "generalized-alpha"; text |] ->
+      parameter text
+      |> Result.bind (fun rho ->
+        if rho >= 0.0 && rho <= 1.0 then
+          Ok(GeneralizedAlpha rho)
+        else
+          Error(InvalidIntegrator $"spectral radius {rho} is not in [0, 1]"))
+    | _ -> Error(InvalidIntegrator $"'{name}' is not one of {names}")
+
+/// <summary>
+/// Direct integration of the equations of motion from rest.
+/// </summary>
+/// <remarks>
+/// The implicit schemes share the generalised-α form, balancing inertia at
+/// t(n+1-αm) and the remaining forces at t(n+1-αf) with Newmark's update
+/// rules, which is unconditionally stable and second-order accurate. The
+/// explicit central difference scheme needs no stiffness factorisation but
+/// is stable only when dt &lt;= 2/ωmax.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module TimeHistory =
+
+  let private axpy (a: float) (x: float array) (y: float array) =
+    Array.map2 (fun xi yi -> a * xi + yi) x y
+
+  let private sum (terms: (float * float array) list) =
+    match terms with
+    | [] -> [||]
+    | (_, first) :: _ ->
+      let zero = Array.zeroCreate first.Length
+      terms |> List.fold (fun acc (a, x) -> axpy a x acc) zero
+
+  /// Returns αm, αf, β and γ of an implicit scheme.
+  let private parameters (i: Integrator) =
+    match i with
+    | Newmark(beta, gamma) -> 0.0, 0.0, beta, gamma
+    | HhtAlpha alpha ->
+      0.0, -alpha, (1.0 - alpha) ** 2.0 / 4.0, (1.0 - 2.0 * alpha) / 2.0
+    | GeneralizedAlpha rho ->
+      let am = (2.0 * rho - 1.0) / (rho + 1.0)
+      let af = rho / (rho + 1.0)
+      am, af, (1.0 - am + af) ** 2.0 / 4.0, 0.5 - am + af
+    | CentralDifference -> 0.0, 0.0, 0.0, 0.5
+
+  /// <summary>
+  /// Estimates the critical time step of the central difference scheme,
+  /// 2/ωmax, from the highest natural frequency of the undamped system.
+  /// </summary>
+  /// <param name="s">Structural system.</param>
+  /// <returns>Critical time step, or an error for a singular mass.</returns>
+  let criticalTimeStep (s: StructuralSystem) : Result<float, TransientError> =
+    match Matrix.factorise s.Mass with
+    | None -> Error(SingularMatrix "mass")
+    | Some mass ->
+      match Matrix.largestEigenvalue s.Stiffness mass with
+      | w2 when w2 > 0.0 -> Ok(2.0 / sqrt w2)
+      | _ -> Ok Double.PositiveInfinity
+
+  let private implicit
+    (i: Integrator)
+    (s: StructuralSystem)
+    (dt: float)
+    (loads: float array array)
+    (mass: LuFactors)
+    (observe: int -> float array -> float array -> float array -> unit)
+    =
+    let am, af, beta, gamma = parameters i
+    let c0, c1 = 1.0 / (beta * dt * dt), 1.0 / (beta * dt)
+    let c2 = 0.5 / beta - 1.0
+    let g0 = gamma / (beta * dt)
+    let g1, g2 = 1.0 - gamma / beta, dt * (1.0 - gamma / (2.0 * beta))
+
+    let effective =
+      Matrix.combine
+        [ (1.0 - am) * c0, s.Mass
+          (1.0 - af) * g0, s.Damping
+          1.0 - af, s.Stiffness ]
+
+    match Matrix.factorise effective with
+    | None -> Error(SingularMatrix "effective stiffness")
+    | Some lu ->
+      let n = loads[0].Length
+      let mutable u = Array.zeroCreate n
+      let mutable v = Array.zeroCreate n
+      let mutable a = Matrix.solve mass loads[0]
+      observe 0 u v a
+
+      for k in 0 .. loads.Length - 2 do
+        let f = sum [ 1.0 - af, loads[k + 1]; af, loads[k] ]
+
+        // Known parts of the acceleration at t(n+1-αm) and velocity at
+        // t(n+1-αf), after substituting Newmark's update rules.
+        let inertia =
+          sum
+            [ -(1.0 - am) * c0, u
+              -(1.0 - am) * c1, v
+              am - (1.0 - am) * c2, a ]
+
+        let viscous =
+          sum
+            [ -(1.0 - af) * g0, u
+              (1.0 - af) * g1 + af, v
+              (1.0 - af) * g2, a ]
+
+        let rhs =
+          sum
+            [ 1.0, f
+              -1.0, Matrix.multiply s.Mass inertia
+              -1.0, Matrix.multiply s.Damping viscous
+              -af, Matrix.multiply s.Stiffness u ]
+
+        let next = Matrix.solve lu rhs
+        let du = axpy -1.0 u next
+        let nextA = sum [ c0, du; -c1, v; -c2, a ]
+        v <- sum [ g0, du; g1, v; g2, a ]
+        u <- next
+        a <- nextA
+        observe (k + 1) u v a
+
+      Ok()
+
+  let private explicit
+    (s: StructuralSystem)
+    (dt: float)
+    (loads: float array array)
+    (mass: LuFactors)
+    (observe: int -> float array -> float array -> float array -> unit)
+    =
+    let dt2 = dt * dt
+    let lhs = Matrix.combine [ 1.0 / dt2, s.Mass; 0.5 / dt, s.Damping ]
+    let ahead = Matrix.combine [ 1.0, s.Stiffness; -2.0 / dt2, s.Mass ]
+    let behind = Matrix.combine [ 1.0 / dt2, s.Mass; -0.5 / dt, s.Damping ]
+
+    match Matrix.factorise lhs with
+    | None -> Error(SingularMatrix "mass")
+    | Some lu ->
+      let steps = loads.Length
+      let n = loads[0].Length
+      let a0 = Matrix.solve mass loads[0]
+      // Displacements at t(k-1) and t(k); the rates at t(k) follow once
+      // t(k+1) is known, holding the last load for the final step.
+      let mutable previous = Array.map (fun x -> 0.5 * dt2 * x) a0
+      let mutable current = Array.zeroCreate n
+
+      for k in 0 .. steps - 1 do
+        let next =
+          Matrix.solve
+            lu
+            (sum
+              [ 1.0, loads[k]
+                -1.0, Matrix.multiply ahead current
+                -1.0, Matrix.multiply behind previous ])
+
+        let v = sum [ 0.5 / dt, next; -0.5 / dt, previous ]
+
+        let a =
+          sum [ 1.0 / dt2, next; -2.0 / dt2, current; 1.0 / dt2, previous ]
+
+        observe k current v a
+        previous <- current
+        current <- next
+
+      Ok()
+
+  /// <summary>
+  /// Integrates the response of a structure from rest, passing the state at
+  /// each step to an observer as it is computed rather than retaining it,
+  /// e.g. to stream a long run to disk.
+  /// </summary>
+  /// <param name="i">Integration scheme.</param>
+  /// <param name="s">Structural system.</param>
+  /// <param name="dt">Time step.</param>
+  /// <param name="loads">Load on each degree of freedom at each step.</param>
+  /// <param name="observe">
+  /// Receives the step number, displacements, velocities and accelerations.
+  /// </param>
+  /// <returns>Unit, or TransientError.</returns>
+  let run
+    (i: Integrator)
+    (s: StructuralSystem)
+    (dt: float)
+    (loads: float array array)
+    (observe: int -> float array -> float array -> float array -> unit)
+    : Result<unit, TransientError> =
+    let n = Matrix.order s.Stiffness
+
+    let mismatched =
+      loads
+      |> Array.tryFindIndex (fun f -> f.Length <> n)
+      |> Option.map (fun k -> MismatchedLoads(k, n, loads[k].Length))
+
+    match mismatched, Matrix.factorise s.Mass with
+    | _ when dt <= 0.0 -> Error(InvalidTimeStep dt)
+    | Some e, _ -> Error e
+    | None, _ when loads.Length = 0 -> Ok()
+    | None, None -> Error(SingularMatrix "mass")
+    | None, Some mass ->
+      match i with
+      | CentralDifference ->
+        criticalTimeStep s
+        |> Result.bind (fun critical ->
+          if dt > critical then
+            Error(UnstableTimeStep(dt, critical))
+          else
+            explicit s dt loads mass observe)
+      | _ -> implicit i s dt loads mass observe
+
+  /// <summary>
+  /// Integrates the response of a structure from rest.
+  /// </summary>
+  /// <param name="i">Integration scheme.</param>
+  /// <param name="s">Structural system.</param>
+  /// <param name="dt">Time step.</param>
+  /// <param name="loads">Load on each degree of freedom at each step.</param>
+  /// <returns>Response at each step, or TransientError.</returns>
+  let integrate
+    (i: Integrator)
+    (s: StructuralSystem)
+    (dt: float)
+    (loads: float array array)
+    : Result<TransientResponse, TransientError> =
+    let u = Array.zeroCreate loads.Length
+    let v = Array.zeroCreate loads.Length
+    let a = Array.zeroCreate loads.Length
+
+    run i s dt loads (fun k uk vk ak ->
+      u[k] <- uk
+      v[k] <- vk
+      a[k] <- ak)
+    |> Result.map (fun () ->
+      { Displacements = u
+        Velocities = v
+        Accelerations = a })
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.IO
+open System.Text.Encodings.Web
+open System.Text.Json
+
+/// <summary>
+/// Key metrics of one analysis run of a model, as recorded in a ledger.
+/// </summary>
+type LedgerEntry =
+  {
+    /// When the run was recorded.
+    Timestamp: DateTimeOffset
+    /// Model name from its info.
+    Model: string
+    Nodes: int
+    Elements: int
+    /// Total mass of elements with a known density.
+    Mass: float option
+    /// Largest nodal translation over all load sets.
+    MaxDisplacement: float option
+    /// Largest member stress over yield strength over all load sets.
+    MaxUtilisation: float option
+    /// Fundamental natural frequency in Hz.
+    Frequency: float option
+  }
+
+/// <summary>
+/// Errors raised whilst reading a ledger.
+/// </summary>
+type LedgerError =
+  | UnreadableLedger of reason: string
+  | MalformedEntry of line: int * reason: string
+
+[<RequireQualifiedAccess>]
+module LedgerError =
+
+  let getAsString (e: LedgerError) : string =
+    match e with
+    | UnreadableLedger reason -> $"Unreadable Ledger: {reason}."
+    | MalformedEntry(line, reason) ->
+      $"Malformed Ledger: line {line} {reason}."
+
+/// <summary>
+/// Project ledger of analysis runs, so the metrics of successive design
+/// iterations can be compared.
+/// </summary>
+/// <remarks>
+/// A ledger is a JSON Lines file with one entry per run, appended in the
+/// order runs are recorded, so it can be kept under version control and
+/// merged line by line.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Ledger =
+
+  /// Ledger used when none is named.
+  [<Literal>]
+  let DefaultPath = "gazelle-ledger.jsonl"
+
+  let private jsonOptions =
+    JsonSerializerOptions(
+      PropertyNamingPolicy = JsonNamingPolicy.CamelCase,
+      Encoder = JavaScriptEncoder.UnsafeRelaxedJsonEscaping
+    )
+
+  /// <summary>
+  /// Appends an entry to a ledger, creating it if needed.
+  /// </summary>
+  /// <param name="path">Path to ledger file.</param>
+  /// <param name="entry">Metrics of a run.</param>
+  let append (path: string) (entry: LedgerEntry) : unit =
+    let line = JsonSerializer.Serialize(entry, jsonOptions)
+    File.AppendAllLines(path, [ line ])
+
+  /// <summary>
+  /// Reads every entry of a ledger, oldest first.
+  /// </summary>
+  /// <param name="path">Path to ledger file.</param>
+  /// <returns>Entries, or the first LedgerError.</returns>
+  let read (path: string) : Result<LedgerEntry list, LedgerError> =
+    let parse (number, line: string) =
+      try
+        match JsonSerializer.Deserialize<LedgerEntry>(line, jsonOptions) with
+        | entry when obj.ReferenceEquals(entry, null) ->
+          Error(MalformedEntry(number, "is null"))
+        | entry -> Ok entry
+      with :? JsonException as ex ->
+        Error(MalformedEntry(number, ex.Message))
+
+    let lines =
+      try
+        File.ReadAllLines path
+        |> Array.mapi (fun i line -> i + 1, line)
+        |> Array.filter (snd >> String.IsNullOrWhiteSpace >> not)
+        |> Ok
+      with
+      | :? IOException
+      | :? UnauthorizedAccessException as ex ->
+        Error(UnreadableLedger ex.Message)
+
+    lines
+    |> Result.bind (fun lines ->
+      Array.foldBack
+        (fun line acc ->
+          match parse line, acc with
+          | Ok entry, Ok rest -> Ok(entry :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        lines
+        (Ok []))
+
+  /// <summary>
+  /// Draws a series as a one-line chart of block characters, leaving gaps
+  /// where a value is missing.
+  /// </summary>
+  /// <param name="values">Values in order, e.g. one metric per run.</param>
+  /// <returns>One character per value.</returns>
+  let sparkline (values: float option list) : string =
+    let bars = "▁▂▃▄▅▆▇█"
+    let known = values |> List.choose id
+
+    match known with
+    | [] -> String(' ', values.Length)
+    | _ ->
+      let low, high = List.min known, List.max known
+
+      values
+      |> List.map (function
+        | None -> ' '
+        | Some _ when high = low -> bars[bars.Length / 2]
+        | Some x ->
+          let level = (x - low) / (high - low) * float (bars.Length - 1)
+          bars[int (round level)])
+      |> Array.ofList
+      |> String
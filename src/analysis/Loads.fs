@@ -0,0 +1,494 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Force or moment component acting at a node, as assembled by the solver.
+/// </summary>
+type NodalLoad =
+  { Node: string
+    Direction: string
+    Magnitude: float }
+
+/// <summary>
+/// Errors raised whilst converting model loads to nodal loads.
+/// </summary>
+type LoadError = UnsupportedLoad of load: string * reason: string
+
+[<RequireQualifiedAccess>]
+module LoadError =
+
+  let getAsString (e: LoadError) : string =
+    match e with
+    | UnsupportedLoad(load, reason) -> $"Unsupported Load: '{load}' {reason}."
+
+/// <summary>
+/// Converts model loads into consistent (work-equivalent) nodal loads.
+/// </summary>
+[<RequireQualifiedAccess>]
+module NodalLoads =
+
+  /// Shape function values and derivatives at an integration point.
+  type private Point =
+    { N: float[]
+      DXi: float[]
+      DEta: float[]
+      Weight: float }
+
+  /// 3-point Gauss rule over the parent quadrilateral, as (ξ, η, weight).
+  let private quadPoints =
+    let rule = [ -sqrt 0.6, 5.0 / 9.0; 0.0, 8.0 / 9.0; sqrt 0.6, 5.0 / 9.0 ]
+
+    [ for xi, wx in rule do
+        for eta, wy in rule do
+          { N =
+              [| (1.0 - xi) * (1.0 - eta) / 4.0
+                 (1.0 + xi) * (1.0 - eta) / 4.0
+                 (1.0 + xi) * (1.0 + eta) / 4.0
+                 (1.0 - xi) * (1.0 + eta) / 4.0 |]
+            DXi =
+              [| -(1.0 - eta) / 4.0
+                 (1.0 - eta) / 4.0
+                 (1.0 + eta) / 4.0
+                 -(1.0 + eta) / 4.0 |]
+            DEta =
+              [| -(1.0 - xi) / 4.0
+                 -(1.0 + xi) / 4.0
+                 (1.0 + xi) / 4.0
+                 (1.0 - xi) / 4.0 |]
+            Weight = wx * wy } ]
+
+  /// 3-point rule over the parent triangle, exact for quadratics.
+  let private trianglePoints =
+    [ 1.0 / 6.0, 1.0 / 6.0; 2.0 / 3.0, 1.0 / 6.0; 1.0 / 6.0, 2.0 / 3.0 ]
+    |> List.map (fun (xi, eta) ->
+      { N = [| 1.0 - xi - eta; xi; eta |]
+        DXi = [| -1.0; 1.0; 0.0 |]
+        DEta = [| -1.0; 0.0; 1.0 |]
+        Weight = 1.0 / 6.0 })
+
+  let private axis (direction: string) : Vector3 option =
+    match direction with
+    | "Fx" -> Some { Vector3.zero with X = 1.0 }
+    | "Fy" -> Some { Vector3.zero with Y = 1.0 }
+    | "Fz" -> Some { Vector3.zero with Z = 1.0 }
+    | _ -> None
+
+  /// Splits a vector at a node into its non-zero named components.
+  let private components
+    (directions: string list)
+    (node: string)
+    (v: Vector3)
+    : NodalLoad list =
+    List.zip directions [ v.X; v.Y; v.Z ]
+    |> List.filter (fun (_, x) -> x <> 0.0)
+    |> List.map (fun (direction, x) ->
+      { Node = node
+        Direction = direction
+        Magnitude = x })
+
+  let private forces = components [ "Fx"; "Fy"; "Fz" ]
+
+  let private moments = components [ "Mx"; "My"; "Mz" ]
+
+  /// Acceleration due to the model's gravity, if its direction is valid.
+  let private gravity (m: Model) : Vector3 option =
+    Gravity.resolve m
+    |> Gravity.acceleration
+    |> Option.map (fun (x, y, z) -> { X = x; Y = y; Z = z })
+
+  /// Applies a function to each item, stopping at the first error.
+  let private traverse
+    (f: 'T -> Result<'U list, LoadError>)
+    (items: 'T list)
+    : Result<'U list, LoadError> =
+    let folder item acc =
+      match f item, acc with
+      | Ok xs, Ok rest -> Ok(xs @ rest)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder items (Ok [])
+
+  /// Integrates a pressure over a 3- or 4-node plate into nodal forces.
+  let private surface
+    (m: Model)
+    (factor: float)
+    (l: Load)
+    (e: Element)
+    : Result<NodalLoad list, LoadError> =
+    let unsupported reason = Error(UnsupportedLoad(l.Id, reason))
+    let coordinates = e.Nodes |> List.map (fun n -> Vector3.ofNode m.Nodes[n])
+
+    let points =
+      match coordinates.Length with
+      | 3 -> Ok trianglePoints
+      | 4 -> Ok quadPoints
+      | n -> unsupported $"acts on a plate with {n} nodes"
+
+    let pressure =
+      match l.Type, l.Datum, gravity m with
+      | "Pressure", _, _ -> Ok(fun (_: Vector3) -> factor * l.Magnitude)
+      | "Hydrostatic", Some datum, Some g ->
+        // Depth below the datum, measured against gravity.
+        let up = Vector3.scale (-1.0 / Vector3.norm g) g
+        let depth p = datum - Vector3.dot p up
+        Ok(fun p -> factor * l.Magnitude * max 0.0 (depth p))
+      | "Hydrostatic", None, _ -> unsupported "is hydrostatic but has no datum"
+      | "Hydrostatic", _, None -> unsupported "needs a valid gravity direction"
+      | t, _, _ -> unsupported $"has unknown type '{t}'"
+
+    let direction =
+      match l.Direction, axis l.Direction with
+      | "Normal", _ -> Ok id
+      | _, Some a -> Ok(fun normal -> Vector3.scale (Vector3.norm normal) a)
+      | d, None -> unsupported $"has unknown direction '{d}'"
+
+    match points, pressure, direction with
+    | Ok points, Ok pressure, Ok direction ->
+      let interpolate (weights: float[]) =
+        List.fold2
+          (fun acc w x -> Vector3.add acc (Vector3.scale w x))
+          Vector3.zero
+          (List.ofArray weights)
+          coordinates
+
+      let totals = Array.create coordinates.Length Vector3.zero
+
+      for p in points do
+        let position = interpolate p.N
+        // Cross product of the tangents is the normal scaled by dA/dξdη.
+        let normal = Vector3.cross (interpolate p.DXi) (interpolate p.DEta)
+        let traction = Vector3.scale (pressure position) (direction normal)
+
+        for i in 0 .. totals.Length - 1 do
+          let share = Vector3.scale (p.N[i] * p.Weight) traction
+          totals[i] <- Vector3.add totals[i] share
+
+      List.zip e.Nodes (List.ofArray totals)
+      |> List.collect (fun (node, f) -> forces node f)
+      |> Ok
+    | Error e, _, _
+    | _, Error e, _
+    | _, _, Error e -> Error e
+
+  /// Bending stiffness of a member over [v1; θ1; v2; θ2] in proportion, or
+  /// over [w1; θ1; w2; θ2] when reversed, for bending about local y.
+  let private flexure (reversed: bool) (l: float) =
+    let s = if reversed then -6.0 * l else 6.0 * l
+
+    array2D
+      [ [ 12.0; s; -12.0; s ]
+        [ s; 4.0 * l * l; -s; 2.0 * l * l ]
+        [ -12.0; -s; 12.0; -s ]
+        [ s; 2.0 * l * l; -s; 4.0 * l * l ] ]
+
+  /// Redistributes the force and moment at each end of a member over the
+  /// freedoms its end releases leave, condensing them as the solver does
+  /// the member stiffness: a pinned end carries half its moment over.
+  let private release
+    (e: Element)
+    (chord: Vector3)
+    ((fi, mi): Vector3 * Vector3, (fj, mj): Vector3 * Vector3)
+    =
+    let releases = defaultArg e.Releases Map.empty
+
+    if releases.IsEmpty then
+      (fi, mi), (fj, mj)
+    else
+      let x, y, z = Vector3.memberAxes chord
+      let l = Vector3.norm chord
+
+      // Condenses out those of the named freedoms released at either end.
+      let condense k (dofs: string list) p =
+        let released =
+          [ for n, node in List.indexed e.Nodes do
+              let names = defaultArg (releases.TryFind node) []
+
+              for d, name in List.indexed dofs do
+                if List.contains name names then
+                  n * dofs.Length + d ]
+
+        Matrix.condense released k p |> snd
+
+      let axial =
+        condense
+          (array2D [ [ 1.0; -1.0 ]; [ -1.0; 1.0 ] ])
+          [ "Ux" ]
+          [| Vector3.dot fi x; Vector3.dot fj x |]
+
+      // Shears along one local axis with moments about the other.
+      let plane along about =
+        [| Vector3.dot fi along
+           Vector3.dot mi about
+           Vector3.dot fj along
+           Vector3.dot mj about |]
+
+      let v = condense (flexure false l) [ "Uy"; "Rz" ] (plane y z)
+      let w = condense (flexure true l) [ "Uz"; "Ry" ] (plane z y)
+
+      let compose a b c =
+        [ a, x; b, y; c, z ]
+        |> List.map (fun (k, u) -> Vector3.scale k u)
+        |> List.fold Vector3.add Vector3.zero
+
+      (compose axial[0] v[0] w[0], compose (Vector3.dot mi x) w[1] v[1]),
+      (compose axial[1] v[2] w[2], compose (Vector3.dot mj x) w[3] v[3])
+
+  /// <summary>
+  /// Replaces a point force on a member with the fixed-end forces it induces
+  /// (reversed), so no auxiliary node is needed at the point of application.
+  /// Pin-ended truss and cable members share the force statically without
+  /// moments.
+  /// </summary>
+  /// <remarks>
+  /// Equivalent nodal loads give exact nodal displacements; member end
+  /// forces must add back the fixed-end forces of the loaded member. Loads
+  /// on members with released ends are condensed onto the other freedoms.
+  /// </remarks>
+  let private memberForce
+    (m: Model)
+    (factor: float)
+    (l: Load)
+    (e: Element)
+    : Result<NodalLoad list, LoadError> =
+    let unsupported reason = Error(UnsupportedLoad(l.Id, reason))
+
+    match e.Nodes, axis l.Direction, l.Position with
+    | [ i; j ], Some direction, Some position ->
+      let chord =
+        Vector3.sub (Vector3.ofNode m.Nodes[j]) (Vector3.ofNode m.Nodes[i])
+
+      let length = Vector3.norm chord
+
+      if length = 0.0 then
+        unsupported $"acts on '{e.Id}' which has zero length"
+      else
+        let ex = Vector3.scale (1.0 / length) chord
+        let p = Vector3.scale (factor * l.Magnitude) direction
+        let a = position * length
+        let b = length - a
+
+        if e.Type.StartsWith "Truss" || e.Type = "Cable" || e.Type = "Strut" then
+          Ok(
+            forces i (Vector3.scale (b / length) p)
+            @ forces j (Vector3.scale (a / length) p)
+          )
+        else
+          let axial = Vector3.scale (Vector3.dot p ex) ex
+          let transverse = Vector3.sub p axial
+          let bending = Vector3.cross ex transverse
+          let l2, l3 = length ** 2.0, length ** 3.0
+
+          let share axialShare shearShare =
+            Vector3.add
+              (Vector3.scale axialShare axial)
+              (Vector3.scale shearShare transverse)
+
+          let (fi, mi), (fj, mj) =
+            release
+              e
+              chord
+              ((share (b / length) (b * b * (3.0 * a + b) / l3),
+                Vector3.scale (a * b * b / l2) bending),
+               (share (a / length) (a * a * (a + 3.0 * b) / l3),
+                Vector3.scale (-a * a * b / l2) bending))
+
+          Ok(forces i fi @ moments i mi @ forces j fj @ moments j mj)
+    | [ _; _ ], None, _ -> unsupported $"has unknown direction '{l.Direction}'"
+    | [ _; _ ], _, None -> unsupported "has no position along the member"
+    | _ -> unsupported $"acts on '{e.Id}' which is not a member"
+
+  /// <summary>
+  /// Replaces a linearly varying distributed load on a member with point
+  /// forces at the 3-point Gauss points of its extent, which give the same
+  /// fixed-end forces exactly, since these are quartic in the position.
+  /// </summary>
+  let private distributed
+    (m: Model)
+    (factor: float)
+    (l: Load)
+    (e: Element)
+    : Result<NodalLoad list, LoadError> =
+    let start = defaultArg l.Position 0.0
+    let finish = defaultArg l.End 1.0
+    let q0, q1 = l.Magnitude, defaultArg l.EndMagnitude l.Magnitude
+
+    let length =
+      match e.Nodes |> List.choose m.Nodes.TryFind with
+      | [ a; b ] ->
+        Vector3.norm (Vector3.sub (Vector3.ofNode b) (Vector3.ofNode a))
+      | _ -> 0.0
+
+    if start < 0.0 || finish > 1.0 || start >= finish then
+      Error(UnsupportedLoad(l.Id, "needs 0 <= position < end <= 1"))
+    else
+      [ -sqrt 0.6, 5.0 / 9.0; 0.0, 8.0 / 9.0; sqrt 0.6, 5.0 / 9.0 ]
+      |> traverse (fun (xi, w) ->
+        let t = (1.0 + xi) / 2.0
+        let q = q0 + t * (q1 - q0)
+        let extent = (finish - start) * length
+
+        memberForce
+          m
+          factor
+          { l with
+              Type = "Force"
+              Magnitude = q * w * extent / 2.0
+              Position = Some(start + t * (finish - start)) }
+          e)
+
+  /// <summary>
+  /// Replaces a temperature change of a member with the forces that would
+  /// hold it at its length and shape, reversed: axial forces E·A·α·ΔT at
+  /// its ends from a uniform change ΔT, and end moments E·I·α·g about
+  /// local z from a gradient g through its depth along local y.
+  /// </summary>
+  /// <remarks>
+  /// Beams without axial freedom take only the moments, and truss, cable
+  /// and strut members only the axial forces. Member end forces must add
+  /// back the restraining forces, as Static.withThermal does.
+  /// </remarks>
+  let private thermal
+    (m: Model)
+    (factor: float)
+    (l: Load)
+    (e: Element)
+    : Result<NodalLoad list, LoadError> =
+    let unsupported reason = Error(UnsupportedLoad(l.Id, reason))
+
+    let property names =
+      names
+      |> List.tryPick (fun name ->
+        e.Properties |> Option.bind (fun ps -> ps.TryFind name))
+
+    let material = Materials.ofElement m e
+    let axial = not (e.Type.StartsWith "Beam")
+
+    let bends =
+      not (e.Type.StartsWith "Truss" || e.Type = "Cable" || e.Type = "Strut")
+
+    match e.Nodes, material |> Option.bind (fun x -> x.ThermalExpansion) with
+    | [ i; j ], Some alpha ->
+      let chord =
+        Vector3.sub (Vector3.ofNode m.Nodes[j]) (Vector3.ofNode m.Nodes[i])
+
+      let x, _, z = Vector3.memberAxes chord
+      let modulus = material.Value.ElasticModulus
+      let gradient = defaultArg l.Gradient 0.0
+
+      let force =
+        match property [ "area"; "a" ] with
+        | _ when not axial || l.Magnitude = 0.0 -> Ok 0.0
+        | Some area -> Ok(modulus * area * alpha * factor * l.Magnitude)
+        | None -> unsupported $"needs the area of '{e.Id}'"
+
+      let moment =
+        match property [ "i"; "iz" ] with
+        | _ when gradient = 0.0 -> Ok 0.0
+        | _ when not bends ->
+          unsupported $"has a gradient but '{e.Id}' cannot bend"
+        | Some inertia -> Ok(modulus * inertia * alpha * factor * gradient)
+        | None -> unsupported $"needs the second moment of area of '{e.Id}'"
+
+      match force, moment with
+      | Ok n, Ok mz ->
+        let (fi, mi), (fj, mj) =
+          release
+            e
+            chord
+            ((Vector3.scale (-n) x, Vector3.scale mz z),
+             (Vector3.scale n x, Vector3.scale (-mz) z))
+
+        Ok(forces i fi @ moments i mi @ forces j fj @ moments j mj)
+      | Error e, _
+      | _, Error e -> Error e
+    | [ _; _ ], None ->
+      unsupported $"needs the thermal expansion of material '{e.Material}'"
+    | _ -> unsupported $"acts on '{e.Id}' which is not a member"
+
+  /// <summary>
+  /// Lumps the weight of every element equally onto its nodes. Members take
+  /// their "area" property and plates their "thickness"; springs and
+  /// rigid links are weightless.
+  /// </summary>
+  let private selfWeight
+    (m: Model)
+    (factor: float)
+    (l: Load)
+    : Result<NodalLoad list, LoadError> =
+    let unsupported reason = Error(UnsupportedLoad(l.Id, reason))
+
+    match gravity m with
+    | None -> unsupported "needs a valid gravity direction"
+    | Some g ->
+      m.Elements
+      |> Map.toList
+      |> List.filter (fun (_, e) -> Materials.isRequired e)
+      |> traverse (fun (id, e) ->
+        let density =
+          Materials.ofElement m e |> Option.bind (fun x -> x.Density)
+
+        match density, Mass.volume m e with
+        | Some rho, Some v ->
+          let share = factor * l.Magnitude * rho * v / float e.Nodes.Length
+          let weight = Vector3.scale share g
+          Ok(e.Nodes |> List.collect (fun n -> forces n weight))
+        | None, _ -> unsupported $"needs a density for material '{e.Material}'"
+        | _, None -> unsupported $"needs the area or thickness of '{id}'")
+
+  /// <summary>
+  /// Converts a factored model load into equivalent nodal loads.
+  /// </summary>
+  /// <param name="m">Model the load belongs to.</param>
+  /// <param name="factor">Load factor, e.g. from a combination.</param>
+  /// <param name="l">Load to convert.</param>
+  /// <returns>Nodal loads or LoadError.</returns>
+  let ofLoad
+    (m: Model)
+    (factor: float)
+    (l: Load)
+    : Result<NodalLoad list, LoadError> =
+    match l.Node, l.Element |> Option.bind m.Elements.TryFind with
+    | None, None when l.Type = "SelfWeight" -> selfWeight m factor l
+    | Some node, None ->
+      Ok
+        [ { Node = node
+            Direction = l.Direction
+            Magnitude = factor * l.Magnitude } ]
+    | None, Some e when l.Type = "Force" -> memberForce m factor l e
+    | None, Some e when l.Type = "Distributed" -> distributed m factor l e
+    | None, Some e when l.Type = "Thermal" -> thermal m factor l e
+    | None, Some e -> surface m factor l e
+    | _ -> Error(UnsupportedLoad(l.Id, "must act on a node or an element"))
+
+  /// <summary>
+  /// Converts every load in a load set into equivalent nodal loads.
+  /// </summary>
+  /// <param name="m">Model the load set belongs to.</param>
+  /// <param name="set">Load set.</param>
+  /// <returns>Nodal loads or the first LoadError.</returns>
+  let ofLoadSet (m: Model) (set: LoadSet) : Result<NodalLoad list, LoadError> =
+    let folder (factor, l) acc =
+      match ofLoad m factor l, acc with
+      | Ok loads, Ok rest -> Ok(loads @ rest)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder set.Loads (Ok [])
+
+  /// <summary>
+  /// Sums nodal load components per direction.
+  /// </summary>
+  /// <param name="loads">Nodal loads.</param>
+  /// <returns>Total magnitude keyed by direction, e.g. "Fy".</returns>
+  let resultant (loads: NodalLoad list) : Map<string, float> =
+    loads
+    |> List.groupBy (fun l -> l.Direction)
+    |> List.map (fun (direction, ls) ->
+      direction, ls |> List.sumBy (fun l -> l.Magnitude))
+    |> Map.ofList
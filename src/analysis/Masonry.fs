@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Vertical load resistance of unreinforced masonry walls and piers to EN
+/// 1996-1-1 6.1.2, reduced for the eccentricity of the load and, in
+/// members, for slenderness.
+/// </summary>
+/// <remarks>
+/// A material of type "Masonry" takes its <c>yield_strength</c> as the
+/// characteristic compressive strength fk of the masonry. The resistance
+/// Φ·t·fk is that of the section, without partial factors, as for the
+/// other checks of Design. At the ends of a member Φi = 1 − 2·ei/t, with
+/// ei = M/N + h_ef/450, and at mid-height Φm follows Annex G with no
+/// creep, M being the greatest moment along the member. The thickness t
+/// is the "thickness" or "t" property, else 6·zz/area of a rectangular
+/// section; the effective height h_ef is the member's length times its
+/// effective length factor, as in Buckling, and may not exceed 27·t.
+/// Eccentricities are at least 0.05·t. Unreinforced masonry carries no
+/// tension, so a member in tension, or in bending without compression, has
+/// no resistance. Wall panels of Plate and Shell elements are checked per
+/// unit length at their section, in each in-plane direction in
+/// compression, but not for slenderness.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Masonry =
+
+  /// Greatest effective height over thickness, EN 1996-1-1 5.5.1.4.
+  [<Literal>]
+  let SlendernessLimit = 27.0
+
+  /// <summary>
+  /// Returns whether a material is masonry.
+  /// </summary>
+  /// <param name="x">Material.</param>
+  /// <returns>True for a material of type "Masonry".</returns>
+  let isMasonry (x: Material) : bool =
+    String.Equals(x.Type, "Masonry", StringComparison.OrdinalIgnoreCase)
+
+  let private property (e: Element) (names: string list) =
+    let properties = Option.defaultValue Map.empty e.Properties
+    names |> List.tryPick properties.TryFind
+
+  /// <summary>
+  /// Returns the capacity reduction factor at the end of a member or across
+  /// a wall section, Φi = 1 − 2·e/t.
+  /// </summary>
+  /// <param name="t">Thickness.</param>
+  /// <param name="e">Eccentricity of the load.</param>
+  /// <returns>Factor, zero once the load leaves the section.</returns>
+  let endFactor (t: float) (e: float) : float =
+    max 0.0 (1.0 - 2.0 * max e (0.05 * t) / t)
+
+  /// <summary>
+  /// Returns the capacity reduction factor at mid-height of a member, Φm of
+  /// EN 1996-1-1 Annex G, without creep.
+  /// </summary>
+  /// <param name="t">Thickness.</param>
+  /// <param name="e">Eccentricity of the load at mid-height.</param>
+  /// <param name="height">Effective height h_ef.</param>
+  /// <param name="stiffness">Elastic modulus over fk.</param>
+  /// <returns>Factor, zero beyond the slenderness limit.</returns>
+  let middleFactor
+    (t: float)
+    (e: float)
+    (height: float)
+    (stiffness: float)
+    : float =
+    let slenderness = height / t
+    let ratio = max e (0.05 * t) / t
+    let a1 = 1.0 - 2.0 * ratio
+    let lambda = slenderness / sqrt stiffness
+    let u = (lambda - 0.063) / (0.73 - 1.17 * ratio)
+
+    if slenderness > SlendernessLimit || a1 <= 0.0 then
+      0.0
+    else
+      a1 * exp (-(u * u) / 2.0)
+
+  /// Compression over a resistance, unbounded where there is none.
+  let private utilisation (compression: float) (resistance: float) =
+    if resistance > 0.0 then compression / resistance else infinity
+
+  /// <summary>
+  /// Checks a masonry member under one set of end forces.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="e">Two-node member of masonry.</param>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <param name="stations">Internal forces along the member, as from
+  /// Diagrams.critical, where loads act along it; empty to take the end
+  /// forces alone.</param>
+  /// <returns>
+  /// Utilisations at the ends and at mid-height, or None when the member
+  /// is not masonry, lacks a strength or thickness, or does not bend in a
+  /// plane.
+  /// </returns>
+  let check
+    (m: Model)
+    (e: Element)
+    (forces: float array)
+    (stations: Station list)
+    : (float * float) option =
+    let at i = abs forces[i]
+
+    let along =
+      stations |> List.fold (fun acc s -> max acc (abs s.MomentZ)) 0.0
+
+    // Greatest moment in the plane of the thickness.
+    let moment =
+      match forces.Length with
+      | 4 -> Some(max (at 1) (at 3))
+      | 6 -> Some(max (at 2) (at 5))
+      | 12 -> Some(max (at 5) (at 11))
+      | _ -> None
+      |> Option.map (max along)
+
+    let thickness =
+      property e [ "thickness"; "t" ]
+      |> Option.orElse (
+        match property e [ "zz" ], property e [ "area"; "a" ] with
+        | Some z, Some a when a > 0.0 -> Some(6.0 * z / a)
+        | _ -> None
+      )
+
+    let area =
+      property e [ "area"; "a" ]
+      |> Option.orElse (
+        property e [ "width"; "b" ] |> Option.map2 (*) thickness
+      )
+
+    let length =
+      match e.Nodes |> List.map (fun n -> Vector3.ofNode m.Nodes[n]) with
+      | [ a; b ] -> Vector3.norm (Vector3.sub b a)
+      | _ -> 0.0
+
+    match Materials.ofElement m e, moment, thickness, area with
+    | Some x, Some moment, Some t, Some area when isMasonry x && t > 0.0 ->
+      x.YieldStrength
+      |> Option.filter (fun fk -> fk > 0.0)
+      |> Option.map (fun fk ->
+        let height =
+          property e [ "k" ]
+          |> Option.defaultWith (fun () -> Buckling.effectiveLengthFactor m e)
+          |> (*) length
+
+        // Compression, positive; axial force is positive in tension.
+        let n = -(Static.axialForce forces |> Option.defaultValue 0.0)
+
+        if n = 0.0 && moment = 0.0 then
+          0.0, 0.0
+        elif n <= 0.0 then
+          infinity, infinity
+        else
+          let eccentricity = moment / n + height / 450.0
+          let stiffness = x.ElasticModulus / fk
+          let ends = endFactor t eccentricity
+          let middle = middleFactor t eccentricity height stiffness
+          let resistance factor = factor * area * fk
+          utilisation n (resistance ends), utilisation n (resistance middle))
+    | _ -> None
+
+  /// <summary>
+  /// Checks a masonry wall panel under its stress resultants.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="e">Plate or Shell element of masonry.</param>
+  /// <param name="forces">Stress resultants per unit width.</param>
+  /// <returns>
+  /// Greatest utilisation of the directions in compression, zero if none
+  /// is, or None when the panel is not masonry or lacks a strength or
+  /// thickness.
+  /// </returns>
+  let panel (m: Model) (e: Element) (forces: float array) : float option =
+    match Materials.ofElement m e, property e [ "thickness"; "t" ] with
+    | Some x, Some t when isMasonry x && t > 0.0 && forces.Length >= 5 ->
+      x.YieldStrength
+      |> Option.filter (fun fk -> fk > 0.0)
+      |> Option.map (fun fk ->
+        [ forces[0], forces[3]; forces[1], forces[4] ]
+        |> List.choose (fun (force, moment) ->
+          let n = -force
+
+          if n > 0.0 then
+            Some(utilisation n (endFactor t (abs moment / n) * t * fk))
+          else
+            None)
+        |> List.fold max 0.0)
+    | _ -> None
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Volumes and masses of elements from their geometry, section properties
+/// and material densities.
+/// </summary>
+[<RequireQualifiedAccess>]
+module Mass =
+
+  let private property (e: Element) (names: string list) =
+    e.Properties |> Option.bind (fun ps -> names |> List.tryPick ps.TryFind)
+
+  let private halfCross u v = Vector3.norm (Vector3.cross u v) / 2.0
+
+  /// <summary>
+  /// Returns the volume of an element. Members take their "area" property
+  /// and plates their "thickness".
+  /// </summary>
+  /// <param name="m">Model the element belongs to.</param>
+  /// <param name="e">Element.</param>
+  /// <returns>Volume, or None without the section property needed.</returns>
+  let volume (m: Model) (e: Element) : float option =
+    let points = e.Nodes |> List.map (fun n -> Vector3.ofNode m.Nodes[n])
+
+    match points with
+    | [ a; b ] ->
+      property e [ "area"; "a" ]
+      |> Option.map (fun area -> area * Vector3.norm (Vector3.sub b a))
+    | [ a; b; c ] ->
+      let area = halfCross (Vector3.sub b a) (Vector3.sub c a)
+      property e [ "thickness"; "t" ] |> Option.map (fun t -> t * area)
+    | [ a; b; c; d ] ->
+      // Half the cross product of the diagonals is a planar quad's area.
+      let area = halfCross (Vector3.sub c a) (Vector3.sub d b)
+      property e [ "thickness"; "t" ] |> Option.map (fun t -> t * area)
+    | _ -> None
+
+  /// <summary>
+  /// Returns the mass of an element from its volume and material density.
+  /// </summary>
+  /// <param name="m">Model the element belongs to.</param>
+  /// <param name="e">Element.</param>
+  /// <returns>Mass, or None without a density or volume.</returns>
+  let ofElement (m: Model) (e: Element) : float option =
+    Materials.ofElement m e
+    |> Option.bind (fun x -> x.Density)
+    |> Option.bind (fun rho -> volume m e |> Option.map ((*) rho))
+
+  /// <summary>
+  /// Returns the total mass of the elements whose mass is known and of the
+  /// point masses at nodes.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Total mass, or None when no mass is known.</returns>
+  let total (m: Model) : float option =
+    let elements = m.Elements |> Map.toList |> List.choose (snd >> ofElement m)
+
+    let points =
+      [ for KeyValue(_, x) in defaultArg m.Masses Map.empty -> x.Mass ]
+
+    match elements @ points with
+    | [] -> None
+    | masses -> Some(List.sum masses)
@@ -0,0 +1,291 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+
+/// <summary>
+/// LU factorisation of a square matrix with partial pivoting, reused to
+/// solve for many right-hand sides.
+/// </summary>
+type LuFactors =
+  private
+    { Factors: float[,]
+      Pivots: int array }
+
+/// <summary>
+/// Dense matrix operations on <c>float[,]</c> for small systems.
+/// </summary>
+[<RequireQualifiedAccess>]
+module Matrix =
+
+  /// Pivots smaller than this, relative to the largest entry, are singular.
+  let private tolerance = 1e-12
+
+  /// <summary>
+  /// Returns the number of rows of a square matrix.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Order of the matrix.</returns>
+  let order (a: float[,]) : int = Array2D.length1 a
+
+  /// <summary>
+  /// Multiplies a matrix by a vector.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <param name="x">Vector.</param>
+  /// <returns>Product a·x.</returns>
+  let multiply (a: float[,]) (x: float array) : float array =
+    Array.init (Array2D.length1 a) (fun i ->
+      let mutable sum = 0.0
+
+      for j in 0 .. x.Length - 1 do
+        sum <- sum + a[i, j] * x[j]
+
+      sum)
+
+  /// <summary>
+  /// Sums scaled matrices of equal size, e.g. M/dt² + K.
+  /// </summary>
+  /// <param name="terms">Factor and matrix of each term.</param>
+  /// <returns>Linear combination of the matrices.</returns>
+  let combine (terms: (float * float[,]) list) : float[,] =
+    match terms with
+    | [] -> Array2D.zeroCreate 0 0
+    | (_, first) :: _ ->
+      Array2D.init (Array2D.length1 first) (Array2D.length2 first) (fun i j ->
+        terms |> List.sumBy (fun (factor, a) -> factor * a[i, j]))
+
+  /// <summary>
+  /// Multiplies two matrices.
+  /// </summary>
+  /// <param name="a">Left matrix.</param>
+  /// <param name="b">Right matrix.</param>
+  /// <returns>Product a·b.</returns>
+  let product (a: float[,]) (b: float[,]) : float[,] =
+    Array2D.init (Array2D.length1 a) (Array2D.length2 b) (fun i j ->
+      let mutable sum = 0.0
+
+      for k in 0 .. Array2D.length2 a - 1 do
+        sum <- sum + a[i, k] * b[k, j]
+
+      sum)
+
+  /// <summary>
+  /// Transposes a matrix.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Transpose of a.</returns>
+  let transpose (a: float[,]) : float[,] =
+    Array2D.init (Array2D.length2 a) (Array2D.length1 a) (fun i j -> a[j, i])
+
+  /// <summary>
+  /// Extracts the entries at the given rows and columns.
+  /// </summary>
+  /// <param name="rows">Row indices.</param>
+  /// <param name="columns">Column indices.</param>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Submatrix.</returns>
+  let select (rows: int array) (columns: int array) (a: float[,]) : float[,] =
+    Array2D.init rows.Length columns.Length (fun i j -> a[rows[i], columns[j]])
+
+  /// <summary>
+  /// Adds a matrix into a larger one at the given degrees of freedom, e.g.
+  /// an element or superelement into the global stiffness matrix.
+  /// </summary>
+  /// <param name="dofs">Row and column of each entry of a in target.</param>
+  /// <param name="a">Matrix to add.</param>
+  /// <param name="target">Matrix updated in place.</param>
+  let scatter (dofs: int array) (a: float[,]) (target: float[,]) : unit =
+    for i in 0 .. dofs.Length - 1 do
+      for j in 0 .. dofs.Length - 1 do
+        target[dofs[i], dofs[j]] <- target[dofs[i], dofs[j]] + a[i, j]
+
+  /// <summary>
+  /// Condenses freedoms out of a stiffness matrix and load vector one at a
+  /// time, e.g. the released ends of a member, leaving their rows and
+  /// columns zero. A freedom left without stiffness is dropped.
+  /// </summary>
+  /// <param name="dofs">Indices of the freedoms to condense out.</param>
+  /// <param name="k">Symmetric stiffness matrix; left unchanged.</param>
+  /// <param name="p">Load vector; left unchanged.</param>
+  /// <returns>Condensed stiffness and loads over the same freedoms.</returns>
+  let condense
+    (dofs: int list)
+    (k: float[,])
+    (p: float array)
+    : float[,] * float array =
+    let n = order k
+    let k, p = Array2D.copy k, Array.copy p
+    let scale = Seq.init n (fun i -> abs k[i, i]) |> Seq.fold max 0.0
+
+    for c in dofs do
+      let pivot = k[c, c]
+
+      if abs pivot > tolerance * scale then
+        for i in 0 .. n - 1 do
+          if i <> c then
+            let ratio = k[i, c] / pivot
+            p[i] <- p[i] - ratio * p[c]
+
+            for j in 0 .. n - 1 do
+              if j <> c then
+                k[i, j] <- k[i, j] - ratio * k[c, j]
+
+      for i in 0 .. n - 1 do
+        k[i, c] <- 0.0
+        k[c, i] <- 0.0
+
+      p[c] <- 0.0
+
+    k, p
+
+  /// <summary>
+  /// Factorises a square matrix as P·A = L·U.
+  /// </summary>
+  /// <param name="a">Matrix to factorise; left unchanged.</param>
+  /// <returns>Factors, or None when the matrix is singular.</returns>
+  let factorise (a: float[,]) : LuFactors option =
+    let n = order a
+    let lu = Array2D.copy a
+    let pivots = Array.init n id
+
+    let scale =
+      Seq.cast<float> a |> Seq.fold (fun m x -> max m (abs x)) 0.0
+
+    let rec eliminate k =
+      if k = n then
+        Some { Factors = lu; Pivots = pivots }
+      else
+        let p = [ k .. n - 1 ] |> List.maxBy (fun i -> abs lu[i, k])
+
+        if abs lu[p, k] <= tolerance * scale then
+          None
+        else
+          if p <> k then
+            for j in 0 .. n - 1 do
+              let t = lu[k, j]
+              lu[k, j] <- lu[p, j]
+              lu[p, j] <- t
+
+            let t = pivots[k]
+            pivots[k] <- pivots[p]
+            pivots[p] <- t
+
+          for i in k + 1 .. n - 1 do
+            lu[i, k] <- lu[i, k] / lu[k, k]
+
+            for j in k + 1 .. n - 1 do
+              lu[i, j] <- lu[i, j] - lu[i, k] * lu[k, j]
+
+          eliminate (k + 1)
+
+    if n = 0 || scale = 0.0 then None else eliminate 0
+
+  /// <summary>
+  /// Solves A·x = b using the factors of A.
+  /// </summary>
+  /// <param name="f">Factors of A.</param>
+  /// <param name="b">Right-hand side.</param>
+  /// <returns>Solution x.</returns>
+  let solve (f: LuFactors) (b: float array) : float array =
+    let lu = f.Factors
+    let n = Array2D.length1 lu
+    let x = Array.init n (fun i -> b[f.Pivots[i]])
+
+    for i in 0 .. n - 1 do
+      for j in 0 .. i - 1 do
+        x[i] <- x[i] - lu[i, j] * x[j]
+
+    for i in n - 1 .. -1 .. 0 do
+      for j in i + 1 .. n - 1 do
+        x[i] <- x[i] - lu[i, j] * x[j]
+
+      x[i] <- x[i] / lu[i, i]
+
+    x
+
+  /// <summary>
+  /// Estimates the largest eigenvalue λ of K·φ = λ·M·φ by power
+  /// iteration, e.g. the square of the highest natural frequency.
+  /// </summary>
+  /// <param name="k">Stiffness matrix.</param>
+  /// <param name="m">Factors of the mass matrix.</param>
+  /// <returns>Largest eigenvalue.</returns>
+  let largestEigenvalue (k: float[,]) (m: LuFactors) : float =
+    let n = order k
+
+    let normalise (x: float array) =
+      let size = sqrt (Array.sumBy (fun v -> v * v) x)
+      if size = 0.0 then x else Array.map (fun v -> v / size) x
+
+    // Start from an uneven vector so no mode is orthogonal to it.
+    let start = Array.init n (fun i -> 1.0 + float i / float (max n 1))
+
+    let rec iterate (x: float array) estimate count =
+      let y = solve m (multiply k x)
+      let next = Array.fold2 (fun s a b -> s + a * b) 0.0 x y
+
+      if count = 0 || abs (next - estimate) <= 1e-10 * abs next then
+        next
+      else
+        iterate (normalise y) next (count - 1)
+
+    if n = 0 then 0.0 else iterate (normalise start) Double.NaN 1000
+
+  /// <summary>
+  /// Computes every eigenvalue and eigenvector of a symmetric matrix by
+  /// cyclic Jacobi rotations.
+  /// </summary>
+  /// <param name="a">Symmetric matrix; left unchanged.</param>
+  /// <returns>
+  /// Eigenvalues in ascending order, and the unit eigenvectors as the
+  /// columns of a matrix in the same order.
+  /// </returns>
+  let symmetricEigen (a: float[,]) : float array * float[,] =
+    let n = order a
+    let d = Array2D.copy a
+    let v = Array2D.init n n (fun i j -> if i = j then 1.0 else 0.0)
+
+    let offDiagonal () =
+      seq {
+        for i in 0 .. n - 1 do
+          for j in i + 1 .. n - 1 do
+            d[i, j] * d[i, j]
+      }
+      |> Seq.sum
+
+    let scale = Seq.cast<float> a |> Seq.sumBy (fun x -> x * x)
+    let mutable sweeps = 0
+
+    while sweeps < 100 && offDiagonal () > 1e-30 * scale do
+      sweeps <- sweeps + 1
+
+      for p in 0 .. n - 2 do
+        for q in p + 1 .. n - 1 do
+          if d[p, q] <> 0.0 then
+            // Rotation through the angle that annuls d[p, q].
+            let theta = (d[q, q] - d[p, p]) / (2.0 * d[p, q])
+            let root = abs theta + sqrt (theta * theta + 1.0)
+            let t = if theta >= 0.0 then 1.0 / root else -1.0 / root
+            let c = 1.0 / sqrt (t * t + 1.0)
+            let s = t * c
+
+            for k in 0 .. n - 1 do
+              let kp, kq = d[k, p], d[k, q]
+              d[k, p] <- c * kp - s * kq
+              d[k, q] <- s * kp + c * kq
+              let vp, vq = v[k, p], v[k, q]
+              v[k, p] <- c * vp - s * vq
+              v[k, q] <- s * vp + c * vq
+
+            for k in 0 .. n - 1 do
+              let pk, qk = d[p, k], d[q, k]
+              d[p, k] <- c * pk - s * qk
+              d[q, k] <- s * pk + c * qk
+
+    let sorted = Array.init n id |> Array.sortBy (fun i -> d[i, i])
+    let values = sorted |> Array.map (fun i -> d[i, i])
+    values, Array2D.init n n (fun i j -> v[i, sorted[j]])
@@ -0,0 +1,337 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.IO
+open System.Text
+open Gazelle.Model
+
+/// <summary>
+/// Stiffness and mass matrices over the free degrees of freedom of a
+/// model, or over the masters of a reduced model.
+/// </summary>
+type SystemMatrices =
+  {
+    /// Node and degree of freedom of each row and column.
+    Dofs: (string * Dof) array
+    Stiffness: SparseMatrix
+    /// Mass matrix, or None if the model's materials have no density.
+    Mass: SparseMatrix option
+  }
+
+/// <summary>
+/// Errors raised whilst reading matrices.
+/// </summary>
+type MatrixError =
+  | UnreadableMatrix of reason: string
+  | MalformedMatrix of file: string * line: int * reason: string
+  | MismatchedMatrix of file: string * order: int * dofs: int
+
+[<RequireQualifiedAccess>]
+module MatrixError =
+
+  let getAsString (e: MatrixError) : string =
+    match e with
+    | UnreadableMatrix reason -> $"Matrix could not be read: {reason}"
+    | MalformedMatrix(file, line, reason) -> $"{file} line {line}: {reason}"
+    | MismatchedMatrix(file, order, dofs) ->
+      $"{file} is of order {order} but the map lists {dofs} degrees of "
+      + "freedom."
+
+/// Defect on a line of a matrix or map.
+type private MatrixException(line: int, reason: string) =
+  inherit Exception(reason)
+  member _.Line = line
+
+/// <summary>
+/// Assembled matrices of models in Matrix Market format, read by e.g.
+/// MATLAB, SciPy and most finite element tools, for study outside Gazelle,
+/// and matrices from them read back, e.g. of a vendor's bearing model.
+/// </summary>
+/// <remarks>
+/// Matrices are written as the nonzero entries on and below the diagonal
+/// of a symmetric coordinate matrix, numbered from 1 in the order of Dofs,
+/// which dofMap lists as CSV. Rows and columns are the free freedoms that
+/// static and modal analysis solve for, so supports are already applied.
+/// Real or integer matrices are read in coordinate or array format, general
+/// or symmetric.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module MatrixExport =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  /// <summary>
+  /// Assembles the free stiffness and mass matrices of a model.
+  /// </summary>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Matrices, or the first StaticError.</returns>
+  let ofModel
+    (kind: MassMatrix)
+    (m: Model)
+    : Result<SystemMatrices, StaticError> =
+    Static.assemble m
+    |> Result.bind (fun a ->
+      let free = Static.free a
+
+      let mass =
+        match Static.assembleMass kind m a with
+        | Ok mass -> Ok(Some(Sparse.select free mass))
+        | Error(MissingDensity _) -> Ok None
+        | Error e -> Error e
+
+      mass
+      |> Result.map (fun mass ->
+        { Dofs = free |> Array.map (fun i -> a.Dofs[i])
+          Stiffness = Sparse.select free a.Stiffness
+          Mass = mass }))
+
+  /// <summary>
+  /// Returns the matrices of a reduced model over its masters.
+  /// </summary>
+  /// <param name="r">Reduced model.</param>
+  /// <returns>Matrices of the masters.</returns>
+  let ofReduced (r: ReducedModel) : SystemMatrices =
+    { Dofs = r.Masters
+      Stiffness = Sparse.ofMatrix r.Stiffness
+      Mass = Some(Sparse.ofMatrix r.Mass) }
+
+  /// <summary>
+  /// Writes a symmetric matrix in Matrix Market coordinate format.
+  /// </summary>
+  /// <param name="a">Symmetric matrix, e.g. a stiffness matrix.</param>
+  /// <returns>The entries on and below the diagonal that are nonzero.
+  /// </returns>
+  let toMatrixMarket (a: SparseMatrix) : string =
+    let n = Sparse.order a
+
+    // Averaged with the transpose, as reduced matrices are symmetric only
+    // to rounding.
+    let entries =
+      [ for i in 0 .. n - 1 do
+          for j, x in Sparse.row a i do
+            if j <= i then
+              let x = (x + Sparse.get a j i) / 2.0
+
+              if x <> 0.0 then
+                i, j, x ]
+      |> List.sortBy (fun (i, j, _) -> j, i)
+
+    let text = StringBuilder()
+    text.Append("%%MatrixMarket matrix coordinate real symmetric\n") |> ignore
+    text.Append($"{n} {n} {entries.Length}\n") |> ignore
+
+    for i, j, x in entries do
+      let value = x.ToString("R", culture)
+      text.Append($"{i + 1} {j + 1} {value}\n") |> ignore
+
+    text.ToString()
+
+  /// <summary>
+  /// Lists the node and degree of freedom of each row and column as CSV.
+  /// </summary>
+  /// <param name="dofs">Freedoms in the order of the matrices.</param>
+  /// <returns>A header and one row per freedom, numbered from 1.</returns>
+  let dofMap (dofs: (string * Dof) array) : string =
+    let rows =
+      "index,node,dof"
+      :: [ for i, (node, dof) in Array.indexed dofs ->
+             $"{i + 1},{node},{Dof.getAsString dof}" ]
+
+    String.concat "\n" rows + "\n"
+
+  let private fail line reason = raise (MatrixException(line, reason))
+
+  let private number (line: int) (x: string) =
+    match Double.TryParse(x, NumberStyles.Float, culture) with
+    | true, v when Double.IsFinite v -> v
+    | _ -> fail line $"'{x}' is not a number"
+
+  let private index (line: int) (n: int) (x: string) =
+    match Int32.TryParse(x, NumberStyles.Integer, culture) with
+    | true, i when i >= 1 && i <= n -> i - 1
+    | _ -> fail line $"'{x}' is not an index from 1 to {n}"
+
+  /// <summary>
+  /// Reads a square matrix in Matrix Market format.
+  /// </summary>
+  /// <param name="file">Name of the file, for errors.</param>
+  /// <param name="text">Matrix Market text.</param>
+  /// <returns>Matrix, or MalformedMatrix naming the line at fault.
+  /// </returns>
+  let parseMatrixMarket
+    (file: string)
+    (text: string)
+    : Result<SparseMatrix, MatrixError> =
+    let lines =
+      text.Split '\n' |> Array.mapi (fun i line -> i + 1, line.Trim())
+
+    let words (x: string) =
+      x.Split([| ' '; '\t' |], StringSplitOptions.RemoveEmptyEntries)
+
+    try
+      let coordinate, symmetric =
+        let banner =
+          lines
+          |> Array.tryHead
+          |> Option.map (fun (_, x) -> words (x.ToLowerInvariant()))
+
+        match banner with
+        | Some [| "%%matrixmarket"; "matrix"; format; field; symmetry |] when
+          List.contains format [ "coordinate"; "array" ]
+          && List.contains format [ "coordinate"; "array" ]
+          && List.contains field [ "real"; "integer" ]
+          && List.contains symmetry [ "general"; "symmetric" ]
+          ->
+          format = "coordinate", symmetry = "symmetric"
+        | _ ->
+          let reason =
+            "is not the banner of a real or integer, general or symmetric "
+            + "Matrix Market matrix"
+
+          fail 1 reason
+
+      let data =
+        lines
+        |> Array.skip 1
+        |> Array.filter (fun (_, x) -> x <> "" && not (x.StartsWith '%'))
+        |> List.ofArray
+
+      match data with
+      | [] -> fail lines.Length "has no size"
+      | (line, size) :: body ->
+        let n =
+          match words size with
+          | [| rows; columns |]
+          | [| rows; columns; _ |] when rows = columns ->
+            index line Int32.MaxValue rows + 1
+          | _ -> fail line "is not the size of a square matrix"
+
+        // Row, column and value of each entry, mirrored if symmetric.
+        let mirrored (i, j, x) =
+          if symmetric && i <> j then [ i, j, x; j, i, x ] else [ i, j, x ]
+
+        let entries =
+          if coordinate then
+            let count =
+              match words size with
+              | [| _; _; count |] ->
+                match Int32.TryParse(count, NumberStyles.Integer, culture) with
+                | true, count when count >= 0 -> count
+                | _ -> fail line $"'{count}' is not a count of entries"
+              | _ -> fail line "has no count of entries"
+
+            if body.Length <> count then
+              fail line $"gives {count} entries but {body.Length} follow"
+
+            [ for line, x in body do
+                match words x with
+                | [| i; j; v |] ->
+                  let at = index line n
+                  yield! mirrored (at i, at j, number line v)
+                | _ -> fail line "is not a row, column and value" ]
+          else
+            // Columns in turn, from the diagonal down if symmetric.
+            let places =
+              [ for j in 0 .. n - 1 do
+                  for i in (if symmetric then j else 0) .. n - 1 -> i, j ]
+
+            if body.Length <> places.Length then
+              fail line $"needs {places.Length} values but {body.Length} follow"
+
+            [ for (i, j), (line, x) in List.zip places body do
+                yield! mirrored (i, j, number line x) ]
+
+        Ok(Sparse.ofEntries n entries)
+    with :? MatrixException as ex ->
+      Error(MalformedMatrix(file, ex.Line, ex.Message))
+
+  /// <summary>
+  /// Reads the node and degree of freedom of each row and column from CSV
+  /// rows of index, node and dof, as dofMap writes them.
+  /// </summary>
+  /// <param name="file">Name of the file, for errors.</param>
+  /// <param name="text">CSV text, with or without a header.</param>
+  /// <returns>Freedoms in order of index, or MalformedMatrix.</returns>
+  let parseDofMap
+    (file: string)
+    (text: string)
+    : Result<(string * Dof) array, MatrixError> =
+    let rows =
+      text.Split '\n'
+      |> Array.mapi (fun i line -> i + 1, line.Trim())
+      |> Array.filter (fun (_, x) -> x <> "" && not (x.StartsWith '#'))
+      |> Array.map (fun (i, x) -> i, x.Split ',' |> Array.map (fun f -> f.Trim()))
+      |> List.ofArray
+
+    let body =
+      match rows with
+      | (_, header) :: rest when header[0].ToLowerInvariant() = "index" ->
+        rest
+      | _ -> rows
+
+    try
+      let n = body.Length
+
+      let dofs =
+        [ for line, fields in body ->
+            match fields with
+            | [| i; node; dof |] when node <> "" ->
+              match Dof.tryParse dof with
+              | Some d -> index line n i, (node, d)
+              | None -> fail line $"'{dof}' is not a degree of freedom"
+            | _ -> fail line "is not an index, node and dof" ]
+
+      match dofs |> List.countBy fst |> List.tryFind (snd >> (<) 1) with
+      | Some(i, _) ->
+        let line = body |> List.item (dofs |> List.findIndexBack (fst >> (=) i))
+        fail (fst line) $"repeats index {i + 1}"
+      | None -> Ok(dofs |> List.sortBy fst |> List.map snd |> Array.ofList)
+    with :? MatrixException as ex ->
+      Error(MalformedMatrix(file, ex.Line, ex.Message))
+
+  /// <summary>
+  /// Reads matrices as gz export --matrices writes them: a stiffness file
+  /// ending .mtx, with the freedom of each row in the file beside it ending
+  /// .dofs.csv and any mass in the one ending .mass.mtx.
+  /// </summary>
+  /// <param name="path">Path to the stiffness, e.g. bearing.mtx.</param>
+  /// <returns>Matrices, or MatrixError.</returns>
+  let read (path: string) : Result<SystemMatrices, MatrixError> =
+    let stem = Path.ChangeExtension(path, null)
+    let mass, dofs = stem + ".mass.mtx", stem + ".dofs.csv"
+
+    let parse (path: string) =
+      parseMatrixMarket (Path.GetFileName path) (File.ReadAllText path)
+
+    // Each matrix must have a row per freedom.
+    let check (path: string) (dofs: (string * Dof) array) (a: SparseMatrix) =
+      match Sparse.order a with
+      | n when n = dofs.Length -> Ok a
+      | n -> Error(MismatchedMatrix(Path.GetFileName path, n, dofs.Length))
+
+    try
+      parseDofMap (Path.GetFileName dofs) (File.ReadAllText dofs)
+      |> Result.bind (fun dofs ->
+        parse path
+        |> Result.bind (check path dofs)
+        |> Result.bind (fun stiffness ->
+          let m =
+            if File.Exists mass then
+              parse mass |> Result.bind (check mass dofs) |> Result.map Some
+            else
+              Ok None
+
+          m
+          |> Result.map (fun m ->
+            { Dofs = dofs
+              Stiffness = stiffness
+              Mass = m })))
+    with
+    | :? IOException as ex -> Error(UnreadableMatrix ex.Message)
+    | :? UnauthorizedAccessException as ex -> Error(UnreadableMatrix ex.Message)
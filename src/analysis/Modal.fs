@@ -0,0 +1,403 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Natural modes of vibration of a model.
+/// </summary>
+type ModalResult =
+  {
+    /// Node and degree of freedom of each entry of a mode shape.
+    Dofs: (string * Dof) array
+    /// Modes in order of increasing frequency.
+    Modes: Mode list
+  }
+
+/// <summary>
+/// Mode followed through a sequence of modal analyses, e.g. a parameter
+/// sweep, by the similarity of its shape rather than its frequency order.
+/// </summary>
+type ModeTrack =
+  {
+    /// Order in which the track first appeared, from 1.
+    Number: int
+    /// The mode at each analysis, if matched, with the MAC to its shape at
+    /// the last analysis it was matched at; 1 where the track starts.
+    Modes: (Mode * float) option list
+  }
+
+/// <summary>
+/// Errors raised whilst computing natural modes.
+/// </summary>
+type ModalError =
+  | FailedAssembly of StaticError
+  | Massless
+  | UnconvergedModes of iterations: int
+
+[<RequireQualifiedAccess>]
+module ModalError =
+
+  let getAsString (e: ModalError) : string =
+    match e with
+    | FailedAssembly e -> StaticError.getAsString e
+    | Massless -> "No free degree of freedom carries mass."
+    | UnconvergedModes iterations ->
+      $"Mode shapes did not converge within {iterations} iterations."
+
+/// <summary>
+/// Modal analysis: natural frequencies and mass-normalised mode shapes from
+/// the generalised eigenproblem K·φ = ω²·M·φ over the free degrees of
+/// freedom.
+/// </summary>
+/// <remarks>
+/// The lowest modes are found by subspace iteration: a block of trial
+/// vectors is repeatedly multiplied by K⁻¹·M, using the skyline Cholesky
+/// factors of K, and the eigenproblem projected onto the block is solved
+/// exactly by Jacobi rotations. The block holds min(2p, p + 8) vectors for
+/// p modes, so the modes sought converge quickly. Degrees of freedom
+/// without mass, e.g. rotations under a lumped mass matrix, have no finite
+/// frequency, so at most one mode per massive degree of freedom is found.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Modal =
+
+  /// Relative change of the eigenvalues at which iteration stops.
+  let private tolerance = 1e-10
+
+  /// Iterations after which the modes are reported as unconverged.
+  let private limit = 200
+
+  let private dot (u: float array) (v: float array) =
+    Array.fold2 (fun s x y -> s + x * y) 0.0 u v
+
+  /// Cholesky factor L of a dense symmetric matrix, with A = L·Lᵀ.
+  let private cholesky (a: float[,]) =
+    let n = Matrix.order a
+    let l = Array2D.zeroCreate n n
+
+    let rec column j =
+      if j = n then
+        Some l
+      else
+        let mutable pivot = a[j, j]
+
+        for k in 0 .. j - 1 do
+          pivot <- pivot - l[j, k] * l[j, k]
+
+        if pivot <= 0.0 then
+          None
+        else
+          l[j, j] <- sqrt pivot
+
+          for i in j + 1 .. n - 1 do
+            let mutable sum = a[i, j]
+
+            for k in 0 .. j - 1 do
+              sum <- sum - l[i, k] * l[j, k]
+
+            l[i, j] <- sum / l[j, j]
+
+          column (j + 1)
+
+    column 0
+
+  /// Solves L·x = b for lower triangular L.
+  let private forward (l: float[,]) (b: float array) =
+    let x = Array.copy b
+
+    for i in 0 .. x.Length - 1 do
+      for k in 0 .. i - 1 do
+        x[i] <- x[i] - l[i, k] * x[k]
+
+      x[i] <- x[i] / l[i, i]
+
+    x
+
+  /// Solves Lᵀ·x = b for lower triangular L.
+  let private backward (l: float[,]) (b: float array) =
+    let x = Array.copy b
+
+    for i in x.Length - 1 .. -1 .. 0 do
+      for k in i + 1 .. x.Length - 1 do
+        x[i] <- x[i] - l[k, i] * x[k]
+
+      x[i] <- x[i] / l[i, i]
+
+    x
+
+  /// Sums vectors with weights.
+  let private combine (vectors: float array array) (weights: float array) =
+    let weighted i =
+      Array.fold2 (fun s (v: float array) w -> s + v[i] * w) 0.0 vectors weights
+
+    Array.init vectors[0].Length weighted
+
+  /// <summary>
+  /// Finds the lowest natural modes of a stiffness and mass matrix pair.
+  /// </summary>
+  /// <param name="count">Number of modes sought.</param>
+  /// <param name="k">Symmetric positive definite stiffness matrix.</param>
+  /// <param name="m">Symmetric positive semi-definite mass matrix.</param>
+  /// <returns>
+  /// Up to count modes in order of increasing frequency, or ModalError.
+  /// </returns>
+  let lowestModes
+    (count: int)
+    (k: SparseMatrix)
+    (m: SparseMatrix)
+    : Result<Mode list, ModalError> =
+    let n = Sparse.order k
+
+    let massive =
+      Array.init n id |> Array.filter (fun i -> Sparse.get m i i > 0.0)
+
+    let p = min count massive.Length
+    let q = min (min (2 * p) (p + 8)) massive.Length |> max p
+
+    match Skyline.ofSparse k |> Skyline.factorise with
+    | _ when p = 0 -> Error Massless
+    | None -> Error(FailedAssembly(Mechanism []))
+    | Some factors ->
+      // Start from the mass distribution and unit vectors at the degrees
+      // of freedom of greatest mass relative to stiffness.
+      let start =
+        let unit i = Array.init n (fun j -> if i = j then 1.0 else 0.0)
+
+        let flexible =
+          massive
+          |> Array.sortByDescending (fun i ->
+            Sparse.get m i i / Sparse.get k i i)
+
+        Array.init q (fun j ->
+          if j = 0 then
+            Array.init n (fun i -> Sparse.get m i i)
+          else
+            unit flexible[j - 1])
+
+      let rec iterate (x: float array array) (previous: float array) left =
+        let y = x |> Array.map (Sparse.multiply m)
+        let xb = y |> Array.map (Skyline.solve factors)
+        let my = xb |> Array.map (Sparse.multiply m)
+
+        // K·xb = y, so the projected stiffness needs no further products.
+        let kr = Array2D.init q q (fun i j -> dot xb[i] y[j])
+        let mr = Array2D.init q q (fun i j -> dot xb[i] my[j])
+
+        match cholesky kr with
+        // Trial vectors that have become dependent cannot be separated.
+        | None -> Error(UnconvergedModes(limit - left))
+        | Some l ->
+          // With Kr = L·Lᵀ, L⁻¹·Mr·L⁻ᵀ has eigenvalues μ = 1/ω².
+          let b =
+            Array.init q (fun j -> forward l (Array.init q (fun i -> mr[i, j])))
+
+          let rows =
+            Array.init q (fun i -> forward l (Array.init q (fun j -> b[j][i])))
+
+          let a = Array2D.init q q (fun i j -> (rows[i][j] + rows[j][i]) / 2.0)
+          let mu, vectors = Matrix.symmetricEigen a
+          let order = Array.init q id |> Array.rev
+
+          let lambda =
+            order
+            |> Array.map (fun i ->
+              if mu[i] > 0.0 then 1.0 / mu[i] else infinity)
+
+          let next =
+            order
+            |> Array.map (fun c ->
+              backward l (Array.init q (fun r -> vectors[r, c])) |> combine xb)
+
+          let settled i =
+            lambda[i] = previous[i]
+            || abs (lambda[i] - previous[i]) <= tolerance * abs lambda[i]
+
+          let converged =
+            previous.Length = q && Seq.forall settled (seq { 0 .. p - 1 })
+
+          if converged then
+            [ for i in 0 .. p - 1 do
+                if Double.IsFinite lambda[i] then
+                  let shape = next[i]
+                  let scale = sqrt (dot shape (Sparse.multiply m shape))
+
+                  { Number = i + 1
+                    AngularFrequency = sqrt lambda[i]
+                    Shape = shape |> Array.map (fun x -> x / scale) } ]
+            |> Ok
+          elif left = 0 then
+            Error(UnconvergedModes limit)
+          else
+            iterate next lambda (left - 1)
+
+      iterate start [||] limit
+
+  /// <summary>
+  /// Returns the natural frequency of a mode in hertz.
+  /// </summary>
+  /// <param name="mode">Mode.</param>
+  /// <returns>Frequency in Hz.</returns>
+  let frequency (mode: Mode) : float =
+    mode.AngularFrequency / (2.0 * Math.PI)
+
+  /// <summary>
+  /// Computes the lowest natural modes of a model.
+  /// </summary>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="count">Number of modes sought.</param>
+  /// <param name="m">Valid model whose members have density and area.</param>
+  /// <returns>Modes over the free degrees of freedom, or ModalError.</returns>
+  let analyse
+    (kind: MassMatrix)
+    (count: int)
+    (m: Model)
+    : Result<ModalResult, ModalError> =
+    Static.assemble m
+    |> Result.bind (fun a ->
+      Static.assembleMass kind m a |> Result.map (fun mass -> a, mass))
+    |> Result.mapError FailedAssembly
+    |> Result.bind (fun (a, mass) ->
+      let free = Static.free a
+
+      let k = Sparse.select free a.Stiffness
+
+      lowestModes count k (Sparse.select free mass)
+      |> Result.map (fun modes ->
+        { Dofs = free |> Array.map (fun i -> a.Dofs[i])
+          Modes = modes }))
+
+  /// <summary>
+  /// Returns the shape of a mode by node.
+  /// </summary>
+  /// <param name="r">Modal result the mode belongs to.</param>
+  /// <param name="mode">Mode.</param>
+  /// <returns>Displacement of each free degree of freedom, by node.</returns>
+  let shape (r: ModalResult) (mode: Mode) : Map<string, Map<Dof, float>> =
+    mode.Shape
+    |> Array.mapi (fun i x -> r.Dofs[i], x)
+    |> Array.groupBy (fst >> fst)
+    |> Array.map (fun (node, xs) ->
+      node, xs |> Array.map (fun ((_, dof), x) -> dof, x) |> Map.ofArray)
+    |> Map.ofArray
+
+  /// Least MAC at which modes of successive analyses are the same mode.
+  let private matching = 0.5
+
+  /// <summary>
+  /// Returns the modal assurance criterion of two mode shapes, from 0 for
+  /// orthogonal shapes to 1 for proportional ones.
+  /// </summary>
+  /// <remarks>
+  /// The shapes may come from different models, e.g. steps of a parameter
+  /// sweep or a model and a vibration test, so they are compared over the
+  /// node IDs and degrees of freedom they share only, e.g. those measured.
+  /// </remarks>
+  /// <param name="a">Modal result of the first mode.</param>
+  /// <param name="x">First mode.</param>
+  /// <param name="b">Modal result of the second mode.</param>
+  /// <param name="y">Second mode.</param>
+  /// <returns>MAC = (φxᵀφy)² / ((φxᵀφx)(φyᵀφy)).</returns>
+  let mac (a: ModalResult) (x: Mode) (b: ModalResult) (y: Mode) : float =
+    let others = Array.zip b.Dofs y.Shape |> Map.ofArray
+
+    let shared =
+      Array.zip a.Dofs x.Shape
+      |> Array.choose (fun (dof, xi) ->
+        others.TryFind dof |> Option.map (fun yi -> xi, yi))
+
+    let sum f = shared |> Array.sumBy f
+    let cross = sum (fun (xi, yi) -> xi * yi)
+    let xx, yy = sum (fun (xi, _) -> xi * xi), sum (fun (_, yi) -> yi * yi)
+
+    if xx = 0.0 || yy = 0.0 then 0.0 else cross * cross / (xx * yy)
+
+  /// <summary>
+  /// Returns the MAC of every mode of one result with every mode of
+  /// another, e.g. of a model and of a vibration test.
+  /// </summary>
+  /// <param name="a">Modal result of the rows.</param>
+  /// <param name="b">Modal result of the columns.</param>
+  /// <returns>MAC matrix, one row per mode of a.</returns>
+  let macMatrix (a: ModalResult) (b: ModalResult) : float[,] =
+    let rows, columns = Array.ofList a.Modes, Array.ofList b.Modes
+    let pair i j = mac a rows[i] b columns[j]
+    Array2D.init rows.Length columns.Length pair
+
+  /// <summary>
+  /// Follows modes through a sequence of modal analyses by their shapes,
+  /// so that crossing frequencies do not swap their labels.
+  /// </summary>
+  /// <remarks>
+  /// Each mode of an analysis is matched to the track whose last matched
+  /// shape it most resembles, pairing the highest MACs first and none
+  /// below 0.5. Tracks left unmatched skip the analysis and may match
+  /// again later, e.g. when a mode leaves and re-enters the modes
+  /// computed; modes left unmatched start new tracks.
+  /// </remarks>
+  /// <param name="results">Modal results in sequence.</param>
+  /// <returns>Tracks in order of first appearance, with one entry per
+  /// analysis.</returns>
+  let track (results: ModalResult list) : ModeTrack list =
+    // Each track with its entries so far, latest first, and the result and
+    // mode it was last matched at.
+    let step
+      (tracks: (int * (Mode * float) option list * _) list)
+      (k: int, r: ModalResult)
+      =
+      let pairs =
+        [ for number, _, last in tracks do
+            match last with
+            | Some(previous, pm) ->
+              for mode in r.Modes do
+                let c = mac previous pm r mode
+
+                if c >= matching then
+                  yield c, number, mode.Number
+            | None -> () ]
+        |> List.sortByDescending (fun (c, _, _) -> c)
+
+      let matches =
+        pairs
+        |> List.fold
+          (fun (acc: Map<int, float * int>) (c, number, mode) ->
+            let taken = acc |> Map.exists (fun _ (_, m) -> m = mode)
+
+            if acc.ContainsKey number || taken then
+              acc
+            else
+              Map.add number (c, mode) acc)
+          Map.empty
+
+      let find number = r.Modes |> List.find (fun m -> m.Number = number)
+
+      let continued =
+        tracks
+        |> List.map (fun (number, entries, last) ->
+          match matches.TryFind number with
+          | Some(c, mode) ->
+            let m = find mode
+            number, Some(m, c) :: entries, Some(r, m)
+          | None -> number, None :: entries, last)
+
+      let matched = matches |> Map.values |> Seq.map snd |> Set.ofSeq
+
+      let started =
+        r.Modes
+        |> List.filter (fun m -> not (matched.Contains m.Number))
+        |> List.mapi (fun i m ->
+          let entries = Some(m, 1.0) :: List.replicate k None
+          tracks.Length + i + 1, entries, Some(r, m))
+
+      continued @ started
+
+    results
+    |> List.indexed
+    |> List.fold step []
+    |> List.map (fun (number, entries, _) ->
+      { Number = number
+        Modes = List.rev entries })
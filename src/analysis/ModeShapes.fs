@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.IO
+open Gazelle.Model
+
+/// <summary>
+/// Errors raised whilst reading mode shapes.
+/// </summary>
+type ModeShapeError =
+  | MalformedShapes of line: int * reason: string
+  | UnreadableShapes of reason: string
+
+[<RequireQualifiedAccess>]
+module ModeShapeError =
+
+  let getAsString (e: ModeShapeError) : string =
+    match e with
+    | MalformedShapes(line, reason) ->
+      $"Malformed mode shapes: line {line} {reason}."
+    | UnreadableShapes reason -> $"Cannot read mode shapes: {reason}"
+
+/// <summary>
+/// Mode shapes from outside Gazelle, e.g. identified from vibration tests,
+/// to correlate with a model's modes.
+/// </summary>
+/// <remarks>
+/// Each line gives one entry of a shape, as the mode number, node ID,
+/// degree of freedom and value, or the frequency of a mode, as the mode
+/// number and frequency in hertz, separated by commas, semicolons or tabs.
+/// Blank lines, lines starting with '#' and a header line are skipped.
+/// Entries a mode omits are zero, and modes without a frequency have a
+/// frequency of NaN.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module ModeShapes =
+
+  /// <summary>
+  /// Parses mode shapes from text, e.g. CSV.
+  /// </summary>
+  /// <param name="text">Mode shape text.</param>
+  /// <returns>Modes in order of number, or MalformedShapes.</returns>
+  let parse (text: string) : Result<ModalResult, ModeShapeError> =
+    let culture = CultureInfo.InvariantCulture
+
+    let number (s: string) =
+      match Double.TryParse(s, NumberStyles.Float, culture) with
+      | true, x when Double.IsFinite x -> Some x
+      | _ -> None
+
+    let mode (s: string) =
+      match Int32.TryParse s with
+      | true, n when n > 0 -> Some n
+      | _ -> None
+
+    let fields (line: string) =
+      line.Split([| ','; ';'; '\t' |]) |> Array.map (fun f -> f.Trim())
+
+    let lines =
+      text.Split('\n')
+      |> Array.mapi (fun i line -> i + 1, line.Trim())
+      |> Array.filter (fun (_, line) -> line <> "" && not (line.StartsWith '#'))
+      |> List.ofArray
+
+    // A header names its mode column rather than numbering a mode.
+    let rows =
+      match lines with
+      | (_, first) :: rest when (fields first)[0] |> mode |> Option.isNone ->
+        rest
+      | all -> all
+
+    // Shape entries and frequencies by mode.
+    let entry (line: int, text: string) =
+      let malformed reason = Error(MalformedShapes(line, reason))
+
+      match fields text with
+      | [| n; node; dof; value |] ->
+        match mode n, Dof.tryParse dof, number value with
+        | Some n, Some dof, Some x -> Ok(Choice1Of2(n, (node, dof), x))
+        | None, _, _ -> malformed $"has mode '{n}'"
+        | _, None, _ -> malformed $"has degree of freedom '{dof}'"
+        | _, _, None -> malformed $"has value '{value}'"
+      | [| n; frequency |] ->
+        match mode n, number frequency with
+        | Some n, Some f when f > 0.0 -> Ok(Choice2Of2(n, f))
+        | None, _ -> malformed $"has mode '{n}'"
+        | _ -> malformed $"has frequency '{frequency}'"
+      | _ -> malformed "needs a mode, node, freedom and value, or a frequency"
+
+    let entries =
+      List.foldBack
+        (fun row acc ->
+          match entry row, acc with
+          | Ok e, Ok rest -> Ok(e :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        rows
+        (Ok [])
+
+    match entries with
+    | Error e -> Error e
+    | Ok entries ->
+      let values =
+        entries
+        |> List.choose (function
+          | Choice1Of2 v -> Some v
+          | _ -> None)
+
+      let frequencies =
+        entries
+        |> List.choose (function
+          | Choice2Of2 f -> Some f
+          | _ -> None)
+        |> Map.ofList
+
+      let dofs = values |> List.map (fun (_, d, _) -> d) |> List.distinct
+      let index = dofs |> List.mapi (fun i d -> d, i) |> Map.ofList
+
+      let modes =
+        values
+        |> List.groupBy (fun (n, _, _) -> n)
+        |> List.sortBy fst
+        |> List.map (fun (n, entries) ->
+          let shape = Array.zeroCreate dofs.Length
+
+          for _, d, x in entries do
+            shape[index[d]] <- x
+
+          let f = frequencies.TryFind n |> Option.defaultValue nan
+
+          { Number = n
+            AngularFrequency = 2.0 * Math.PI * f
+            Shape = shape })
+
+      if modes.IsEmpty then
+        Error(MalformedShapes(0, "has no mode shapes"))
+      else
+        Ok
+          { Dofs = Array.ofList dofs
+            Modes = modes }
+
+  /// <summary>
+  /// Reads a mode shapes file.
+  /// </summary>
+  /// <param name="path">Path to mode shapes file, e.g. CSV.</param>
+  /// <returns>Modes, or ModeShapeError.</returns>
+  let read (path: string) : Result<ModalResult, ModeShapeError> =
+    try
+      File.ReadAllText path |> parse
+    with
+    | :? IOException as ex -> Error(UnreadableShapes ex.Message)
+    | :? UnauthorizedAccessException as ex -> Error(UnreadableShapes ex.Message)
@@ -0,0 +1,690 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open Gazelle.Model
+
+/// <summary>
+/// Language of an OpenSees script.
+/// </summary>
+type OpenSeesLanguage =
+  /// Tcl, for the OpenSees interpreter.
+  | Tcl
+  /// Python, for OpenSeesPy.
+  | Python
+
+/// <summary>
+/// Errors raised whilst translating a model into an OpenSees script.
+/// </summary>
+type OpenSeesError =
+  | UntranslatableElement of element: string * reason: string
+  | UntranslatableSupport of support: string * reason: string
+  | UntranslatableLoad of LoadError
+
+[<RequireQualifiedAccess>]
+module OpenSeesError =
+
+  let getAsString (e: OpenSeesError) : string =
+    match e with
+    | UntranslatableElement(element, reason) ->
+      $"Element '{element}' cannot be exported to OpenSees: {reason}."
+    | UntranslatableSupport(support, reason) ->
+      $"Constraint '{support}' cannot be exported to OpenSees: {reason}."
+    | UntranslatableLoad e -> LoadError.getAsString e
+
+/// <summary>
+/// Scripts of models for OpenSees, the open-source finite element
+/// framework, to cross-check Gazelle's results against an established
+/// solver.
+/// </summary>
+/// <remarks>
+/// Nodes and elements are tagged 1, 2, ... in the order of their IDs, which
+/// the script notes beside them. Freedoms that no element at a node
+/// provides are fixed, as Gazelle leaves them out. Truss members become
+/// truss elements of elastic materials, tension-only for cables and
+/// compression-only for struts; beam and frame members elastic beam-column
+/// elements with their end releases; plates and shells MITC4 or DKGT
+/// shells; springs and elastic supports zero-length elements; and rigid
+/// links beam-type rigid links. Point and distributed loads on beams and
+/// frames become element loads in member axes, those that are partial or
+/// vary becoming point loads at the Gauss points Gazelle integrates them
+/// at; every other load is applied as Gazelle's equivalent nodal loads.
+/// Each load set is analysed in turn, printing the displacements of every
+/// node and the reactions of every support.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module OpenSees =
+
+  /// Argument of an OpenSees command.
+  type private Arg =
+    | Word of string
+    | Int of int
+    | Real of float
+
+  /// Line of a script, written out in either language.
+  type private Line =
+    | Blank
+    | Comment of string
+    | Command of name: string * args: Arg list * note: string option
+    /// Load pattern of its own linear time series, holding its loads.
+    | Pattern of tag: int * body: Line list
+    /// Variable listing the tags and IDs of nodes.
+    | Table of name: string * rows: (int * string) list
+    /// Prints the displacements and reactions of a load set.
+    | Report of set: string
+
+  let private command name args = Command(name, args, None)
+
+  let private quote (language: OpenSeesLanguage) (text: string) =
+    match language with
+    | Tcl -> "{" + text + "}"
+    | Python -> "'" + text.Replace("\\", "\\\\").Replace("'", "\\'") + "'"
+
+  let private argument (language: OpenSeesLanguage) (arg: Arg) =
+    match arg with
+    | Word w when language = Python -> quote Python w
+    | Word w -> w
+    | Int i -> string i
+    | Real x ->
+      // Reals keep their point, and lose the sign of zero.
+      let text = (x + 0.0).ToString("R", CultureInfo.InvariantCulture)
+      if text.IndexOfAny [| '.'; 'E' |] < 0 then text + ".0" else text
+
+  /// Lines of text of a command or comment, indented.
+  let private simple (language: OpenSeesLanguage) (indent: string) line =
+    let args xs = xs |> List.map (argument language)
+
+    match language, line with
+    | _, Comment text -> [ indent + "# " + text ]
+    | Tcl, Command(name, xs, note) ->
+      let text = String.Join(" ", name :: args xs)
+      let note = note |> Option.map (fun n -> " ;# " + n)
+      [ indent + text + Option.defaultValue "" note ]
+    | Python, Command(name, xs, note) ->
+      let text = $"ops.{name}(" + String.Join(", ", args xs) + ")"
+      let note = note |> Option.map (fun n -> "  # " + n)
+      [ indent + text + Option.defaultValue "" note ]
+    | _ -> [ "" ]
+
+  let private render (language: OpenSeesLanguage) (line: Line) =
+    match language, line with
+    | Tcl, Pattern(tag, body) ->
+      [ yield $"pattern Plain {tag} {tag} {{"
+        for l in body do
+          yield! simple Tcl "  " l
+        yield "}" ]
+    | Python, Pattern(tag, body) ->
+      [ yield $"ops.pattern('Plain', {tag}, {tag})"
+        for l in body do
+          yield! simple Python "" l ]
+    | Tcl, Table(name, rows) ->
+      let items = rows |> List.map (fun (tag, id) -> $"{tag} {quote Tcl id}")
+      [ $"set {name} {{" + String.Join(" ", items) + "}" ]
+    | Python, Table(name, rows) ->
+      let items =
+        rows |> List.map (fun (tag, id) -> $"({tag}, {quote Python id})")
+
+      [ $"{name} = [" + String.Join(", ", items) + "]" ]
+    | Tcl, Report set ->
+      [ "set loadSet " + quote Tcl set
+        "reactions"
+        "foreach {tag id} $nodes {"
+        "  puts \"$loadSet $id [nodeDisp $tag]\""
+        "}"
+        "foreach {tag id} $supports {"
+        "  puts \"$loadSet $id reaction [nodeReaction $tag]\""
+        "}" ]
+    | Python, Report set ->
+      [ "load_set = " + quote Python set
+        "ops.reactions()"
+        "for tag, id in nodes:"
+        "    print(load_set, id, *ops.nodeDisp(tag))"
+        "for tag, id in supports:"
+        "    print(load_set, id, 'reaction', *ops.nodeReaction(tag))" ]
+    | _ -> simple language "" line
+
+  /// Applies a function to each item in order, stopping at the first error.
+  let private traverse (f: 'T -> Result<'U, OpenSeesError>) (items: 'T list) =
+    let folder acc item =
+      match acc, f item with
+      | Ok xs, Ok x -> Ok(x :: xs)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.fold folder (Ok []) items |> Result.map List.rev
+
+  let private beams = set [ "Beam2D"; "Frame2D"; "Beam3D"; "Frame3D" ]
+
+  /// Vector from the first to the second node of a member.
+  let private chord (m: Model) (e: Element) =
+    match e.Nodes |> List.map m.Nodes.TryFind with
+    | [ Some a; Some b ] -> Vector3.sub (Vector3.ofNode b) (Vector3.ofNode a)
+    | _ -> Vector3.zero
+
+  /// 3-point Gauss points over [-1, 1] with their weights.
+  let private gauss =
+    [ -sqrt 0.6, 5.0 / 9.0; 0.0, 8.0 / 9.0; sqrt 0.6, 5.0 / 9.0 ]
+
+  /// Global direction of a force, e.g. "Fy".
+  let private axis (direction: string) : Vector3 option =
+    match direction with
+    | "Fx" -> Some { X = 1.0; Y = 0.0; Z = 0.0 }
+    | "Fy" -> Some { X = 0.0; Y = 1.0; Z = 0.0 }
+    | "Fz" -> Some { X = 0.0; Y = 0.0; Z = 1.0 }
+    | _ -> None
+
+  /// <summary>
+  /// Writes a model as an OpenSees script that analyses its load sets
+  /// linearly, as Gazelle's static analysis does.
+  /// </summary>
+  /// <param name="language">Tcl or Python.</param>
+  /// <param name="m">Model.</param>
+  /// <param name="sets">Load sets to analyse, e.g. from LoadCases.select.
+  /// </param>
+  /// <returns>Script, or the first part that OpenSees cannot take.</returns>
+  let toScript
+    (language: OpenSeesLanguage)
+    (m: Model)
+    (sets: LoadSet list)
+    : Result<string, OpenSeesError> =
+    let members =
+      m.Elements
+      |> Map.values
+      |> Seq.filter (fun e -> e.Type <> "Spring" && e.Type <> "RigidLink")
+      |> List.ofSeq
+
+    // Plane models, or models of plane members only, take three freedoms.
+    let plane =
+      Dof.ofDimensions m = Dof.plane
+      || not members.IsEmpty
+         && members |> List.forall (fun e -> e.Type.EndsWith "2D")
+
+    let dofs = if plane then Dof.plane else Dof.all
+
+    // Numbers of the freedoms in OpenSees, from 1.
+    let direction dof = 1 + List.findIndex ((=) dof) dofs
+
+    let coordinates (n: Node) =
+      if plane then
+        [ Real n.X; Real n.Y ]
+      else
+        [ Real n.X; Real n.Y; Real n.Z ]
+
+    let tags =
+      m.Nodes |> Map.keys |> Seq.mapi (fun i id -> id, i + 1) |> Map.ofSeq
+
+    let elementTags =
+      m.Elements |> Map.keys |> Seq.mapi (fun i id -> id, i + 1) |> Map.ofSeq
+
+    let fresh (counter: int ref) =
+      counter.Value <- counter.Value + 1
+      counter.Value
+
+    let nextNode = ref m.Nodes.Count
+    let nextElement = ref m.Elements.Count
+    let nextMaterial = ref 0
+
+    let springs (e: Element) =
+      let properties = defaultArg e.Properties Map.empty
+
+      dofs
+      |> List.choose (fun d ->
+        properties.TryFind((Dof.getAsString d).ToLowerInvariant())
+        |> Option.map (fun k -> d, k))
+
+    // Freedoms the elements at each node provide, shared across the nodes
+    // of rigid links.
+    let freedoms =
+      let own =
+        [ for KeyValue(_, e) in m.Elements do
+            let provided =
+              match e.Type with
+              | "Spring" -> springs e |> List.map fst
+              | "RigidLink" -> []
+              | t -> Dof.ofElementType t |> Option.defaultValue []
+
+            for n in e.Nodes -> n, provided ]
+
+      let byNode =
+        own
+        |> List.groupBy fst
+        |> List.map (fun (n, xs) -> n, List.collect snd xs)
+        |> Map.ofList
+
+      let linked =
+        [ for KeyValue(_, e) in m.Elements do
+            if e.Type = "RigidLink" then
+              let shared =
+                e.Nodes
+                |> List.collect (fun n -> defaultArg (byNode.TryFind n) [])
+
+              for n in e.Nodes -> n, shared ]
+
+      own @ linked
+      |> List.groupBy fst
+      |> List.map (fun (n, xs) -> n, xs |> List.collect snd |> set)
+      |> Map.ofList
+
+    let active node dof =
+      freedoms.TryFind node |> Option.exists (Set.contains dof)
+
+    // Ground node at a node, fixed in every freedom, for springs to it.
+    let ground (at: string) =
+      let tag = fresh nextNode
+
+      tag,
+      [ Command("node", Int tag :: coordinates m.Nodes[at], Some $"at {at}")
+        command "fix" (Int tag :: List.map (fun _ -> Int 1) dofs) ]
+
+    let zeroLength tag i j (stiffness: (Dof * float) list) note =
+      let materials =
+        stiffness |> List.map (fun (d, k) -> fresh nextMaterial, d, k)
+
+      [ for mt, _, k in materials do
+          command "uniaxialMaterial" [ Word "Elastic"; Int mt; Real k ]
+        Command(
+          "element",
+          [ Word "zeroLength"; Int tag; Int i; Int j; Word "-mat" ]
+          @ [ for mt, _, _ in materials -> Int mt ]
+          @ [ Word "-dir" ]
+          @ [ for _, d, _ in materials -> Int(direction d) ],
+          Some note
+        ) ]
+
+    let supports =
+      m.Constraints
+      |> Map.toList
+      |> traverse (fun (id, c) ->
+        match c.Angle with
+        | Some angle when angle % 360.0 <> 0.0 ->
+          Error(UntranslatableSupport(id, "OpenSees has no inclined supports"))
+        | _ when not (tags.ContainsKey c.Node) ->
+          Error(UntranslatableSupport(id, $"node '{c.Node}' does not exist"))
+        | _ -> Ok(id, c))
+
+    let held (c: Constraint) =
+      c.Dof
+      |> List.choose Dof.tryParse
+      |> List.filter (fun d -> List.contains d dofs)
+
+    // Imposed displacements, held by single-point constraints in each load
+    // set rather than fixed.
+    let settlements (supports: (string * Constraint) list) =
+      [ for _, c in supports do
+          for d in held c do
+            let imposed = defaultArg c.Displacement Map.empty
+
+            match imposed.TryFind(Dof.getAsString d) with
+            | Some u -> c.Node, d, u
+            | None -> () ]
+
+    let fixes (supports: (string * Constraint) list) =
+      let settled =
+        settlements supports |> List.map (fun (n, d, _) -> n, d) |> set
+
+      let restrained =
+        supports
+        |> List.collect (fun (_, c) -> held c |> List.map (fun d -> c.Node, d))
+        |> set
+
+      [ for KeyValue(id, tag) in tags do
+          let flags =
+            dofs
+            |> List.map (fun d ->
+              if settled.Contains(id, d) then 0
+              elif restrained.Contains(id, d) || not (active id d) then 1
+              else 0)
+
+          if List.contains 1 flags then
+            command "fix" (Int tag :: List.map Int flags) ]
+
+    // Elastic supports, as springs to ground, with the ground node tags.
+    let elasticSupports (supports: (string * Constraint) list) =
+      [ for id, c in supports do
+          let stiffness =
+            defaultArg c.Stiffness Map.empty
+            |> Map.toList
+            |> List.filter (fun (name, _) -> not (List.contains name c.Dof))
+            |> List.choose (fun (name, k) ->
+              Dof.tryParse name
+              |> Option.filter (fun d -> List.contains d dofs)
+              |> Option.map (fun d -> d, k))
+
+          if not stiffness.IsEmpty then
+            let at, lines = ground c.Node
+            let tag = fresh nextElement
+            let spring = zeroLength tag at tags[c.Node] stiffness id
+            (at, c.Node), lines @ spring ]
+
+    let translate (id: string, e: Element) : Result<Line list, OpenSeesError> =
+      let tag = elementTags[id]
+      let fail reason = Error(UntranslatableElement(id, reason))
+
+      let property (names: string list) =
+        let value =
+          e.Properties |> Option.bind (fun ps -> List.tryPick ps.TryFind names)
+
+        match value with
+        | Some x -> Ok x
+        | None -> fail $"needs property '{names.Head}'"
+
+      let nodes = e.Nodes |> List.map (fun n -> Int(tags[n]))
+      let element args = Command("element", args, Some id)
+
+      // Release code of a freedom: 1 at the first end, 2 at the second.
+      let released name =
+        let releases = defaultArg e.Releases Map.empty
+
+        e.Nodes
+        |> List.mapi (fun i n ->
+          let names = defaultArg (releases.TryFind n) []
+          if List.contains name names then i + 1 else 0)
+        |> List.sum
+
+      let unreleasable =
+        defaultArg e.Releases Map.empty
+        |> Map.values
+        |> Seq.concat
+        |> Seq.tryFind (fun name ->
+          name <> "Rz" && (plane || name <> "Ry"))
+
+      match e.Type, Materials.ofElement m e with
+      | _ when e.Nodes |> List.exists (fun n -> not (tags.ContainsKey n)) ->
+        fail "connects a node that does not exist"
+      | "RigidLink", _ ->
+        Ok
+          [ for slave in e.Nodes.Tail ->
+              Command(
+                "rigidLink",
+                [ Word "beam"; nodes.Head; Int(tags[slave]) ],
+                Some id
+              ) ]
+      | "Spring", _ ->
+        match e.Nodes, springs e with
+        | _, [] -> fail "needs a stiffness such as 'ux'"
+        | [ a ], stiffness ->
+          let at, lines = ground a
+          Ok(lines @ zeroLength tag at (tags[a]) stiffness id)
+        | [ a; b ], stiffness ->
+          Ok(zeroLength tag tags[a] tags[b] stiffness id)
+        | _ -> fail "must connect 1 or 2 nodes"
+      | _, None -> fail $"needs material '{e.Material}'"
+      | ("Truss2D" | "Truss3D" | "Cable" | "Strut"), Some material ->
+        property [ "area"; "a" ]
+        |> Result.map (fun area ->
+          let mt = fresh nextMaterial
+          let modulus = Real material.ElasticModulus
+
+          let uniaxial =
+            match e.Type with
+            | "Cable" -> [ Word "Elastic"; Int mt; modulus; Real 0.0; Real 0.0 ]
+            | "Strut" -> [ Word "ENT"; Int mt; modulus ]
+            | _ -> [ Word "Elastic"; Int mt; modulus ]
+
+          [ command "uniaxialMaterial" uniaxial
+            element ([ Word "truss"; Int tag ] @ nodes @ [ Real area; Int mt ])
+          ])
+      | t, Some _ when beams.Contains t && not plane && t.EndsWith "2D" ->
+        fail "it is a plane member in a space model"
+      | t, Some _ when beams.Contains t && Vector3.norm (chord m e) = 0.0 ->
+        fail "it has zero length"
+      | t, Some _ when beams.Contains t && unreleasable.IsSome ->
+        fail $"OpenSees cannot release its '{unreleasable.Value}'"
+      | t, Some material when beams.Contains t && plane ->
+        let area =
+          if t.StartsWith "Frame" then property [ "area"; "a" ] else Ok 0.0
+
+        match area, property [ "i"; "iz" ] with
+        | Error e, _
+        | _, Error e -> Error e
+        | Ok area, Ok iz ->
+          let release =
+            match released "Rz" with
+            | 0 -> []
+            | code -> [ Word "-release"; Int code ]
+
+          Ok
+            [ command "geomTransf" [ Word "Linear"; Int tag ]
+              element (
+                [ Word "elasticBeamColumn"; Int tag ]
+                @ nodes
+                @ [ Real area; Real material.ElasticModulus; Real iz; Int tag ]
+                @ release
+              ) ]
+      | t, Some material when beams.Contains t ->
+        let area = if t = "Frame3D" then property [ "area"; "a" ] else Ok 0.0
+
+        let shear =
+          match material.ShearModulus with
+          | Some g -> Ok g
+          | None -> fail $"needs the shear modulus of material '{e.Material}'"
+
+        let j, iy = property [ "j"; "ix" ], property [ "iy" ]
+
+        match area, shear, j, iy, property [ "iz"; "i" ] with
+        | Error e, _, _, _, _
+        | _, Error e, _, _, _
+        | _, _, Error e, _, _
+        | _, _, _, Error e, _
+        | _, _, _, _, Error e -> Error e
+        | Ok area, Ok g, Ok j, Ok iy, Ok iz ->
+          let _, _, z = Vector3.memberAxes (chord m e)
+
+          let releases =
+            [ for name, flag in [ "Rz", "-releasez"; "Ry", "-releasey" ] do
+                match released name with
+                | 0 -> ()
+                | code -> yield! [ Word flag; Int code ] ]
+
+          Ok
+            [ command
+                "geomTransf"
+                [ Word "Linear"; Int tag; Real z.X; Real z.Y; Real z.Z ]
+              element (
+                [ Word "elasticBeamColumn"; Int tag ]
+                @ nodes
+                @ [ Real area
+                    Real material.ElasticModulus
+                    Real g
+                    Real j
+                    Real iy
+                    Real iz
+                    Int tag ]
+                @ releases
+              ) ]
+      | ("Plate" | "Shell"), Some _ when plane ->
+        fail "it is a plate in a plane model"
+      | ("Plate" | "Shell"), Some material ->
+        match property [ "thickness"; "t" ], material.ShearModulus, nodes with
+        | Error e, _, _ -> Error e
+        | _, None, _ ->
+          fail $"needs the shear modulus of material '{e.Material}'"
+        | Ok t, Some g, ([ _; _; _ ] | [ _; _; _; _ ]) ->
+          let shell = if nodes.Length = 4 then "ShellMITC4" else "ShellDKGT"
+          let poisson = material.ElasticModulus / (2.0 * g) - 1.0
+
+          Ok
+            [ command
+                "section"
+                [ Word "ElasticMembranePlateSection"
+                  Int tag
+                  Real material.ElasticModulus
+                  Real poisson
+                  Real t
+                  Real(defaultArg material.Density 0.0) ]
+              element ([ Word shell; Int tag ] @ nodes @ [ Int tag ]) ]
+        | _ -> fail "it must connect 3 or 4 nodes"
+      | t, _ -> fail $"OpenSees has no counterpart to type '{t}'"
+
+    // Element load in member axes of a force, or of a force per unit length
+    // when uniform, at a fraction of the member length for a point load.
+    let elementLoad kind (e: Element) (p: Vector3) (position: float option) =
+      let x, y, z = Vector3.memberAxes (chord m e)
+
+      let values =
+        [ Real(Vector3.dot p y)
+          if not plane then
+            Real(Vector3.dot p z)
+          yield! position |> Option.map Real |> Option.toList
+          Real(Vector3.dot p x) ]
+
+      command
+        "eleLoad"
+        ([ Word "-ele"; Int(elementTags[e.Id]); Word "-type"; Word kind ]
+         @ values)
+
+    let nodalLoads (factor: float) (l: Load) =
+      let missing (x: NodalLoad) = not (tags.ContainsKey x.Node)
+
+      NodalLoads.ofLoad m factor l
+      |> Result.mapError UntranslatableLoad
+      |> Result.bind (fun loads ->
+        match List.tryFind missing loads with
+        | Some x ->
+          let reason = $"acts on node '{x.Node}' which does not exist"
+          Error(UntranslatableLoad(UnsupportedLoad(l.Id, reason)))
+        | None -> Ok(Choice2Of2 loads))
+
+    // Element loads of point and distributed loads on beams and frames,
+    // else equivalent nodal loads.
+    let load (factor: float, l: Load) =
+      let target =
+        l.Element
+        |> Option.bind m.Elements.TryFind
+        |> Option.filter (fun e -> beams.Contains e.Type && e.Nodes.Length = 2)
+
+      match target, axis l.Direction with
+      | Some e, Some direction ->
+        let start = defaultArg l.Position 0.0
+        let finish = defaultArg l.End 1.0
+        let q0, q1 = l.Magnitude, defaultArg l.EndMagnitude l.Magnitude
+        let along q = Vector3.scale (factor * q) direction
+
+        match l.Type with
+        | "Force" when l.Position.IsSome ->
+          Ok(Choice1Of2 [ elementLoad "-beamPoint" e (along q0) (Some start) ])
+        | "Distributed" when start = 0.0 && finish = 1.0 && q0 = q1 ->
+          Ok(Choice1Of2 [ elementLoad "-beamUniform" e (along q0) None ])
+        | "Distributed" when 0.0 <= start && start < finish && finish <= 1.0 ->
+          let extent = (finish - start) * Vector3.norm (chord m e)
+
+          Ok(
+            Choice1Of2
+              [ for xi, w in gauss ->
+                  let t = (1.0 + xi) / 2.0
+                  let q = (q0 + t * (q1 - q0)) * w * extent / 2.0
+                  let position = start + t * (finish - start)
+                  elementLoad "-beamPoint" e (along q) (Some position) ]
+          )
+        | _ -> nodalLoads factor l
+      | _ -> nodalLoads factor l
+
+    let analyse (settled: (string * Dof * float) list) i (set: LoadSet) =
+      set.Loads
+      |> traverse load
+      |> Result.map (fun translated ->
+        let elementLoads =
+          translated |> List.collect (function Choice1Of2 ls -> ls | _ -> [])
+
+        let nodal =
+          translated
+          |> List.collect (function Choice2Of2 ls -> ls | _ -> [])
+          |> List.groupBy (fun x -> x.Node)
+          |> List.map (fun (node, loads) ->
+            let values =
+              dofs
+              |> List.map (fun d ->
+                loads
+                |> List.filter (fun x -> Dof.ofDirection x.Direction = Some d)
+                |> List.sumBy (fun x -> x.Magnitude))
+
+            command "load" (Int(tags[node]) :: List.map Real values))
+
+        let imposed =
+          [ for node, d, u in settled ->
+              command "sp" [ Int(tags[node]); Int(direction d); Real u ] ]
+
+        // Rigid links need their constraints transformed out.
+        let handler =
+          if m.Elements |> Map.exists (fun _ e -> e.Type = "RigidLink") then
+            "Transformation"
+          else
+            "Plain"
+
+        [ Blank
+          Comment $"Load set {set.Name}"
+          command "timeSeries" [ Word "Linear"; Int i ]
+          Pattern(i, nodal @ elementLoads @ imposed)
+          command "constraints" [ Word handler ]
+          command "numberer" [ Word "RCM" ]
+          command "system" [ Word "BandGeneral" ]
+          command "test" [ Word "NormDispIncr"; Real 1e-10; Int 50 ]
+          command "algorithm" [ Word "Newton" ]
+          command "integrator" [ Word "LoadControl"; Real 1.0 ]
+          command "analysis" [ Word "Static" ]
+          command "analyze" [ Int 1 ]
+          Report set.Name
+          command "remove" [ Word "loadPattern"; Int i ]
+          command "reset" []
+          command "wipeAnalysis" [] ])
+
+    let elements =
+      m.Elements |> Map.toList |> traverse translate |> Result.map List.concat
+
+    match supports, elements with
+    | Error e, _
+    | _, Error e -> Error e
+    | Ok supports, Ok elementLines ->
+      let elastic = elasticSupports supports
+      let settled = settlements supports
+
+      let supported =
+        [ for _, c in supports do
+            if not (held c).IsEmpty then
+              tags[c.Node], c.Node ]
+        |> List.distinct
+        |> fun rows -> rows @ (elastic |> List.map fst)
+
+      sets
+      |> List.mapi (fun i set -> i + 1, set)
+      |> traverse (fun (i, set) -> analyse settled i set)
+      |> Result.map (fun analyses ->
+        let lines =
+          [ Comment $"Gazelle model '{m.Info.Name}', in {m.Info.Units}."
+            Comment "Nodes and elements are tagged in the order of their IDs."
+            command "wipe" []
+            command
+              "model"
+              [ Word "basic"
+                Word "-ndm"
+                Int(if plane then 2 else 3)
+                Word "-ndf"
+                Int dofs.Length ]
+            Blank
+            Comment "Nodes"
+            yield!
+              [ for KeyValue(id, n) in m.Nodes ->
+                  Command("node", Int(tags[id]) :: coordinates n, Some id) ]
+            Blank
+            Comment "Supports, and freedoms that no element provides"
+            yield! fixes supports
+            yield! elastic |> List.collect snd
+            Blank
+            Comment "Materials, sections and elements"
+            yield! elementLines
+            Blank
+            Table("nodes", [ for KeyValue(id, tag) in tags -> tag, id ])
+            Table("supports", supported)
+            yield! List.concat analyses ]
+
+        let preamble =
+          match language with
+          | Tcl -> []
+          | Python -> [ "import openseespy.opensees as ops"; "" ]
+
+        let text = preamble @ List.collect (render language) lines
+        String.Join("\n", text) + "\n")
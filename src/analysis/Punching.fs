@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Punching shear verification of a slab at one support under one set of
+/// reactions.
+/// </summary>
+type PunchingCheck =
+  {
+    Node: string
+    /// Reaction of the support normal to the slab, V_Ed.
+    Force: float
+    /// Effective depth of the slab, d.
+    Depth: float
+    /// Basic control perimeter at 2d from the column, u1.
+    Perimeter: float
+    /// Enhancement of the shear stress for unbalanced moment, β.
+    Beta: float
+    /// Design shear stress at the control perimeter, β·V_Ed / (u1·d).
+    Stress: float
+    /// Resistance without shear reinforcement, v_Rd,c.
+    Resistance: float
+    /// Stress over the resistance.
+    Utilisation: float
+  }
+
+/// <summary>
+/// Governing punching check of a support across analysed scenarios.
+/// </summary>
+type GoverningPunching =
+  {
+    /// Scenario the check governs in, e.g. a results file.
+    Scenario: string
+    LoadSet: string
+    Check: PunchingCheck
+  }
+
+/// <summary>
+/// Punching shear checks of concrete slabs at their supports, to EN
+/// 1992-1-1 6.4, from the support reactions of an analysis.
+/// </summary>
+/// <remarks>
+/// A slab is a Plate or Shell of a material of type "Concrete", whose
+/// <c>yield_strength</c> is taken as its characteristic cylinder strength
+/// fck. It is checked at every supported node, its effective depth being
+/// the property <c>d</c>, or 0.8 of its <c>thickness</c>, and its tension
+/// reinforcement ratios <c>rho_x</c> and <c>rho_y</c>, zero if omitted;
+/// where slabs of different properties meet, the least govern. The shear
+/// stress β·V_Ed / (u1·d) at the basic control perimeter is checked
+/// against v_Rd,c = 0.12·k·(100·ρl·fck)^⅓, at least 0.035·k^1.5·fck^½,
+/// with k = 1 + √(200/d) ≤ 2 and ρl = √(ρx·ρy) ≤ 0.02 in N and mm. The
+/// perimeter is that of the column, c1 by c2, plus 4πd for an internal
+/// support, in proportion to the angle of slab around the node, which also
+/// classes it as internal, edge or corner with β of 1.15, 1.4 or 1.5. A
+/// support without a column size is taken as a point, which is
+/// conservative. Loads within the control perimeter are not deducted.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Punching =
+
+  let private slabs = set [ "Plate"; "Shell" ]
+
+  let private property (e: Element) (names: string list) =
+    let properties = Option.defaultValue Map.empty e.Properties
+    names |> List.tryPick properties.TryFind
+
+  /// Interior angle of a plate at one of its corners, in degrees.
+  let private angleAt (m: Model) (e: Element) (node: string) =
+    let corners =
+      e.Nodes
+      |> List.fold
+        (fun acc n ->
+          match acc with
+          | last :: _ when last = n -> acc
+          | _ -> n :: acc)
+        []
+      |> List.rev
+      |> fun ns ->
+        if ns.Length > 1 && List.head ns = List.last ns then
+          List.take (ns.Length - 1) ns
+        else
+          ns
+
+    match List.tryFindIndex ((=) node) corners with
+    | Some i when corners.Length >= 3 ->
+      let count = corners.Length
+      let at k = Vector3.ofNode m.Nodes[corners[(k + count) % count]]
+      let p = at i
+      let a = Vector3.sub (at (i - 1)) p
+      let b = Vector3.sub (at (i + 1)) p
+      let cosine = Vector3.dot a b / (Vector3.norm a * Vector3.norm b)
+      acos (max -1.0 (min 1.0 cosine)) * 180.0 / Math.PI
+    | _ -> 0.0
+
+  /// Unit normal of a plate from its first three corners.
+  let private normal (m: Model) (e: Element) =
+    let at k = Vector3.ofNode m.Nodes[e.Nodes[k]]
+
+    let n =
+      Vector3.cross (Vector3.sub (at 1) (at 0)) (Vector3.sub (at 2) (at 0))
+
+    Vector3.scale (1.0 / Vector3.norm n) n
+
+  /// <summary>
+  /// Checks a slab for punching at a supported node.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="column">Column size c1 by c2, or None for a point.</param>
+  /// <param name="node">Supported node.</param>
+  /// <param name="reaction">Reaction by global direction, e.g. "Uz".</param>
+  /// <returns>Check, or None when no concrete slab meets the node.</returns>
+  let check
+    (m: Model)
+    (column: (float * float) option)
+    (node: string)
+    (reaction: Map<string, float>)
+    : PunchingCheck option =
+    // Factor from the units of the model to N and mm.
+    let toNmm =
+      match UnitSystem.tryFind m.Info.Units, UnitSystem.tryFind "N-mm" with
+      | Ok source, Ok target -> Some(UnitSystem.factor source target)
+      | _ -> None
+
+    let around =
+      m.Elements
+      |> Map.toList
+      |> List.map snd
+      |> List.filter (fun e ->
+        slabs.Contains e.Type && List.contains node e.Nodes)
+      |> List.choose (fun e ->
+        match Materials.ofElement m e with
+        | Some x when
+          String.Equals(x.Type, "Concrete", StringComparison.OrdinalIgnoreCase)
+          ->
+          x.YieldStrength
+          |> Option.filter (fun fck -> fck > 0.0)
+          |> Option.bind (fun fck ->
+            property e [ "d" ]
+            |> Option.orElse (
+              property e [ "thickness"; "t" ] |> Option.map ((*) 0.8)
+            )
+            |> Option.map (fun d -> e, fck, d))
+        | _ -> None)
+
+    match toNmm, around with
+    | None, _
+    | _, [] -> None
+    | Some toNmm, (first, _, _) :: _ ->
+      let fck = around |> List.map (fun (_, fck, _) -> fck) |> List.min
+      let d = around |> List.map (fun (_, _, d) -> d) |> List.min
+
+      let ratio name =
+        around
+        |> List.map (fun (e, _, _) ->
+          property e [ name ] |> Option.defaultValue 0.0)
+        |> List.min
+
+      let rho = min 0.02 (sqrt (max 0.0 (ratio "rho_x" * ratio "rho_y")))
+
+      let angle =
+        around |> List.sumBy (fun (e, _, _) -> angleAt m e node) |> min 360.0
+
+      let beta =
+        if angle >= 300.0 then 1.15
+        elif angle >= 135.0 then 1.4
+        else 1.5
+
+      let c1, c2 = Option.defaultValue (0.0, 0.0) column
+      let perimeter = (2.0 * (c1 + c2) + 4.0 * Math.PI * d) * angle / 360.0
+
+      let n = normal m first
+
+      let force =
+        abs (
+          Vector3.dot
+            n
+            { X = reaction.TryFind "Ux" |> Option.defaultValue 0.0
+              Y = reaction.TryFind "Uy" |> Option.defaultValue 0.0
+              Z = reaction.TryFind "Uz" |> Option.defaultValue 0.0 }
+        )
+
+      // Resistance in N and mm, returned to the units of the model.
+      let dmm = d * toNmm 1 0
+      let fckMpa = fck * toNmm -2 1
+      let k = min 2.0 (1.0 + sqrt (200.0 / dmm))
+      let vmin = 0.035 * k ** 1.5 * sqrt fckMpa
+      let vrdc = max vmin (0.12 * k * (100.0 * rho * fckMpa) ** (1.0 / 3.0))
+      let resistance = vrdc / toNmm -2 1
+
+      let stress =
+        if perimeter > 0.0 then beta * force / (perimeter * d) else 0.0
+
+      Some
+        { Node = node
+          Force = force
+          Depth = d
+          Perimeter = perimeter
+          Beta = beta
+          Stress = stress
+          Resistance = resistance
+          Utilisation = stress / resistance }
+
+  /// <summary>
+  /// Finds the governing check of each support: its greatest utilisation
+  /// across every scenario and load set.
+  /// </summary>
+  /// <param name="checks">Checks with their scenario and load set.</param>
+  /// <returns>Governing check of each support, ordered by node ID.</returns>
+  let govern (checks: GoverningPunching seq) : GoverningPunching list =
+    checks
+    |> Seq.groupBy (fun c -> c.Check.Node)
+    |> Seq.map (snd >> Seq.maxBy (fun c -> c.Check.Utilisation))
+    |> Seq.sortBy (fun c -> c.Check.Node)
+    |> List.ofSeq
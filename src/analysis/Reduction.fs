@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// How the freedoms other than the masters are eliminated.
+/// </summary>
+[<RequireQualifiedAccess>]
+type ReductionMethod =
+  /// Static (Guyan) condensation: the other freedoms follow the masters as
+  /// they would under static loads, which is exact for stiffness.
+  | Guyan
+  /// Improved Reduced System (O'Callahan): the static shapes are corrected
+  /// for the inertia of the other freedoms, so reduced frequencies stay
+  /// accurate further up the spectrum.
+  | Irs
+
+[<RequireQualifiedAccess>]
+module ReductionMethod =
+
+  let private names =
+    [ "guyan", ReductionMethod.Guyan; "irs", ReductionMethod.Irs ]
+
+  let getAsString (m: ReductionMethod) : string =
+    names |> List.find (snd >> (=) m) |> fst
+
+  /// <summary>
+  /// Parses a reduction method: "guyan" or "irs".
+  /// </summary>
+  /// <param name="text">Method, in any case.</param>
+  /// <returns>Matching method, or None.</returns>
+  let tryParse (text: string) : ReductionMethod option =
+    names
+    |> List.tryFind (fun (name, _) -> name = text.Trim().ToLowerInvariant())
+    |> Option.map snd
+
+/// <summary>
+/// Stiffness and mass of a model reduced to master degrees of freedom.
+/// </summary>
+type ReducedModel =
+  {
+    Method: ReductionMethod
+    /// Node and degree of freedom of each row and column of the matrices.
+    Masters: (string * Dof) array
+    Stiffness: float[,]
+    Mass: float[,]
+    /// Node and degree of freedom of every free freedom of the model.
+    Dofs: (string * Dof) array
+    /// Displacement of every free freedom per unit displacement of each
+    /// master, one column per master.
+    Transformation: float[,]
+  }
+
+/// <summary>
+/// Errors raised whilst reducing a model.
+/// </summary>
+type ReductionError =
+  | FailedAssembly of StaticError
+  | NoMasters
+  | UnknownMaster of node: string * dof: Dof option
+  | FailedCondensation of CondensationError
+  | MasslessMasters
+
+[<RequireQualifiedAccess>]
+module ReductionError =
+
+  let getAsString (e: ReductionError) : string =
+    match e with
+    | FailedAssembly e -> StaticError.getAsString e
+    | NoMasters -> "No master degrees of freedom were given."
+    | UnknownMaster(node, None) ->
+      $"Master node '{node}' has no free degree of freedom."
+    | UnknownMaster(node, Some dof) ->
+      $"Master {Dof.getAsString dof} at node '{node}' is not a free degree "
+      + "of freedom."
+    | FailedCondensation e -> CondensationError.getAsString e
+    | MasslessMasters ->
+      "The reduced mass is singular; choose masters that carry the mass, "
+      + "e.g. translations rather than rotations under lumped mass."
+
+/// <summary>
+/// Reduction of a model's stiffness and mass to a few master degrees of
+/// freedom, for coupling with other simulation tools or fast approximate
+/// dynamics.
+/// </summary>
+/// <remarks>
+/// Guyan reduction condenses the free freedoms of the model onto the
+/// masters with Superelement, giving K_R = Tᵀ·K·T and M_R = Tᵀ·M·T for the
+/// static shapes T. IRS adds the first-order inertia of the other freedoms,
+/// T_IRS = T + S·M·T·M_R⁻¹·K_R with S the inverse of their stiffness when
+/// the masters are held, and reduces with T_IRS instead. Both are accurate
+/// for modes well below the lowest frequency of the model with its masters
+/// held, IRS to a higher frequency than Guyan; masters should be the
+/// freedoms that carry most of the mass and move most in those modes.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Reduction =
+
+  /// Triple product Aᵀ·B·A.
+  let private project (a: float[,]) (b: float[,]) =
+    Matrix.product (Matrix.transpose a) (Matrix.product b a)
+
+  /// Columns of a matrix solved against factors.
+  let private solveColumns (lu: LuFactors) (b: float[,]) =
+    let rows, columns = Array2D.length1 b, Array2D.length2 b
+
+    let solved =
+      Array.init columns (fun j ->
+        Matrix.solve lu (Array.init rows (fun i -> b[i, j])))
+
+    Array2D.init rows columns (fun i j -> solved[j][i])
+
+  /// <summary>
+  /// Reduces the free stiffness and mass of a model to master freedoms.
+  /// </summary>
+  /// <param name="method">Guyan or IRS.</param>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="masters">Master freedoms, by node and degree of freedom;
+  /// a degree of freedom of None takes every free freedom of the node.
+  /// </param>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Reduced model, or ReductionError.</returns>
+  let reduce
+    (method: ReductionMethod)
+    (kind: MassMatrix)
+    (masters: (string * Dof option) list)
+    (m: Model)
+    : Result<ReducedModel, ReductionError> =
+    Static.assemble m
+    |> Result.bind (fun a ->
+      Static.assembleMass kind m a |> Result.map (fun mass -> a, mass))
+    |> Result.mapError FailedAssembly
+    |> Result.bind (fun (a, mass) ->
+      let free = Static.free a
+      let dofs = free |> Array.map (fun i -> a.Dofs[i])
+
+      let matches (node, dof) (n, d) =
+        n = node && Option.forall ((=) d) dof
+
+      let unknown =
+        masters
+        |> List.tryFind (fun master -> not (Array.exists (matches master) dofs))
+
+      match masters, unknown with
+      | [], _ -> Error NoMasters
+      | _, Some(node, dof) -> Error(UnknownMaster(node, dof))
+      | _ ->
+        let retained =
+          Array.init dofs.Length id
+          |> Array.filter (fun i ->
+            masters |> List.exists (fun x -> matches x dofs[i]))
+
+        let k = Sparse.select free a.Stiffness |> Sparse.toMatrix
+        let mm = Sparse.select free mass |> Sparse.toMatrix
+        let n = dofs.Length
+
+        { Mass = mm
+          Damping = Array2D.zeroCreate n n
+          Stiffness = k }
+        |> Superelement.condense retained
+        |> Result.mapError FailedCondensation
+        |> Result.bind (fun se ->
+          let b, i = se.Boundary, se.Interior
+
+          // Static shapes in the order of the free freedoms.
+          let shapes = Array2D.zeroCreate n b.Length
+
+          for j in 0 .. b.Length - 1 do
+            shapes[b[j], j] <- 1.0
+
+            for r in 0 .. i.Length - 1 do
+              shapes[i[r], j] <- se.Recovery[r, j]
+
+          let transformation =
+            match method, se.InteriorStiffness with
+            | ReductionMethod.Guyan, _
+            | _, None -> Ok shapes
+            | ReductionMethod.Irs, Some interior ->
+              match Matrix.factorise se.Reduced.Mass with
+              | None -> Error MasslessMasters
+              | Some reducedMass ->
+                // S·M·T·M_R⁻¹·K_R, where S acts on the interior alone.
+                let dynamic =
+                  solveColumns reducedMass se.Reduced.Stiffness
+                  |> Matrix.product (Matrix.product mm shapes)
+                  |> Matrix.select i [| 0 .. b.Length - 1 |]
+                  |> solveColumns interior
+
+                let corrected = Array2D.copy shapes
+
+                for r in 0 .. i.Length - 1 do
+                  for j in 0 .. b.Length - 1 do
+                    corrected[i[r], j] <- shapes[i[r], j] + dynamic[r, j]
+
+                Ok corrected
+
+          transformation
+          |> Result.map (fun t ->
+            { Method = method
+              Masters = b |> Array.map (fun j -> dofs[j])
+              Stiffness = project t k
+              Mass = project t mm
+              Dofs = dofs
+              Transformation = t })))
+
+  /// <summary>
+  /// Computes the lowest natural modes of a reduced model, expanded to
+  /// every free freedom of the model.
+  /// </summary>
+  /// <param name="count">Number of modes sought.</param>
+  /// <param name="r">Reduced model.</param>
+  /// <returns>Modes over the free degrees of freedom, or ModalError.</returns>
+  let modes (count: int) (r: ReducedModel) : Result<ModalResult, ModalError> =
+    let k, m = Sparse.ofMatrix r.Stiffness, Sparse.ofMatrix r.Mass
+
+    Modal.lowestModes count k m
+    |> Result.map (fun modes ->
+      { Dofs = r.Dofs
+        Modes =
+          modes
+          |> List.map (fun mode ->
+            { mode with
+                Shape = Matrix.multiply r.Transformation mode.Shape }) })
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.IO
+open System.IO.MemoryMappedFiles
+open System.Text.Json
+open System.Text.Json.Nodes
+open Gazelle.Model
+
+/// <summary>
+/// Results file opened for random access, with the position of each record
+/// indexed so that records are parsed only when they are read.
+/// </summary>
+type ResultFile =
+  private
+    { Map: MemoryMappedFile option
+      Offsets: int64 array
+      Lengths: int array
+      /// Unit system records are converted to as they are read, if any.
+      Units: UnitSystem option }
+
+  interface IDisposable with
+    member f.Dispose() = f.Map |> Option.iter (fun m -> m.Dispose())
+
+/// <summary>
+/// Errors raised whilst reading a results file.
+/// </summary>
+type ResultFileError =
+  | UnreadableResults of reason: string
+  | MissingRecord of index: int * count: int
+  | MalformedRecord of index: int * reason: string
+  | UnconvertibleRecord of index: int * reason: string
+
+[<RequireQualifiedAccess>]
+module ResultFileError =
+
+  let getAsString (e: ResultFileError) : string =
+    match e with
+    | UnreadableResults reason -> $"Unreadable Results: {reason}."
+    | MissingRecord(index, count) ->
+      $"Record {index} is outside the {count} records of the results file."
+    | MalformedRecord(index, reason) ->
+      $"Malformed Results: record {index} {reason}."
+    | UnconvertibleRecord(index, reason) ->
+      $"Record {index} {reason}, so cannot be converted."
+
+/// <summary>
+/// Lazy reader for large JSON Lines results files, e.g. one record per load
+/// set or time step as written by <c>ResultStream</c>.
+/// </summary>
+/// <remarks>
+/// Opening a file scans it once for line breaks and memory-maps it, so the
+/// cost of reading a record is independent of the size of the file. Only
+/// the requested nodes or elements of a record are retained.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module ResultFile =
+
+  /// Size of the buffer used to scan for line breaks.
+  let private chunk = 1 <<< 16
+
+  let private index (stream: Stream) =
+    let offsets = ResizeArray<int64>()
+    let lengths = ResizeArray<int>()
+    let buffer = Array.zeroCreate<byte> chunk
+    let mutable start = 0L
+    let mutable position = 0L
+    let mutable read = stream.Read(buffer, 0, chunk)
+
+    let add (finish: int64) =
+      // Skip blank lines, including the trailing break of the file.
+      if finish > start then
+        offsets.Add start
+        lengths.Add(int (finish - start))
+
+    while read > 0 do
+      for i in 0 .. read - 1 do
+        if buffer[i] = byte '\n' then
+          add (position + int64 i)
+          start <- position + int64 i + 1L
+
+      position <- position + int64 read
+      read <- stream.Read(buffer, 0, chunk)
+
+    add position
+    offsets.ToArray(), lengths.ToArray()
+
+  /// <summary>
+  /// Opens and indexes a JSON Lines results file.
+  /// </summary>
+  /// <param name="path">Path to results file.</param>
+  /// <returns>Indexed file; dispose it to close the file.</returns>
+  let openFile (path: string) : Result<ResultFile, ResultFileError> =
+    try
+      let offsets, lengths =
+        use stream = File.OpenRead path
+        index stream
+
+      let map =
+        if offsets.Length = 0 then
+          None
+        else
+          let access = MemoryMappedFileAccess.Read
+          let mode = FileMode.Open
+          Some(MemoryMappedFile.CreateFromFile(path, mode, null, 0L, access))
+
+      Ok
+        { Map = map
+          Offsets = offsets
+          Lengths = lengths
+          Units = None }
+    with
+    | :? IOException as ex -> Error(UnreadableResults ex.Message)
+    | :? UnauthorizedAccessException as ex ->
+      Error(UnreadableResults ex.Message)
+
+  /// <summary>
+  /// Returns the number of records, e.g. load sets or time steps.
+  /// </summary>
+  /// <param name="f">Results file.</param>
+  /// <returns>Number of records.</returns>
+  let count (f: ResultFile) : int = f.Offsets.Length
+
+  /// <summary>
+  /// Converts records to a unit system as they are read, whatever the
+  /// units of the model they came from.
+  /// </summary>
+  /// <param name="target">Unit system to read records in.</param>
+  /// <param name="f">Results file.</param>
+  /// <returns>The same file, reading records in the target units.</returns>
+  let convertTo (target: UnitSystem) (f: ResultFile) : ResultFile =
+    { f with Units = Some target }
+
+  /// <summary>
+  /// Reads and parses a single record, upgrading it to the current
+  /// ResultFormat version and converting it to the units asked for.
+  /// </summary>
+  /// <param name="f">Results file.</param>
+  /// <param name="i">Zero-based record index.</param>
+  /// <returns>Record, or ResultFileError.</returns>
+  let record (f: ResultFile) (i: int) : Result<JsonObject, ResultFileError> =
+    match f.Map with
+    | Some map when i >= 0 && i < f.Offsets.Length ->
+      let bytes = Array.zeroCreate<byte> f.Lengths[i]
+      let access = MemoryMappedFileAccess.Read
+
+      use view =
+        map.CreateViewAccessor(f.Offsets[i], int64 bytes.Length, access)
+
+      view.ReadArray(0L, bytes, 0, bytes.Length) |> ignore
+
+      try
+        match JsonNode.Parse(ReadOnlySpan bytes) with
+        | :? JsonObject as o ->
+          ResultFormat.migrate o
+          |> Result.mapError (fun e ->
+            MalformedRecord(i, ResultFormatError.getAsString e))
+          |> Result.bind (fun o ->
+            match f.Units with
+            | None -> Ok o
+            | Some target ->
+              ResultUnits.convert target o
+              |> Result.mapError (fun e ->
+                UnconvertibleRecord(i, ResultUnitsError.getAsString e)))
+        | _ -> Error(MalformedRecord(i, "is not an object"))
+      with :? JsonException as ex ->
+        Error(MalformedRecord(i, ex.Message))
+    | _ -> Error(MissingRecord(i, f.Offsets.Length))
+
+  /// <summary>
+  /// Reads the entries of a result block for selected nodes or elements.
+  /// </summary>
+  /// <param name="f">Results file.</param>
+  /// <param name="i">Zero-based record index.</param>
+  /// <param name="block">Block name, e.g. "displacements".</param>
+  /// <param name="ids">Node or element IDs; all entries when empty.</param>
+  /// <returns>Entry of each requested ID present, or ResultFileError.</returns>
+  let select
+    (f: ResultFile)
+    (i: int)
+    (block: string)
+    (ids: string list)
+    : Result<Map<string, JsonNode>, ResultFileError> =
+    record f i
+    |> Result.bind (fun o ->
+      match o[block] with
+      | null -> Ok Map.empty
+      | :? JsonObject as entries ->
+        let wanted = set ids
+
+        entries
+        |> Seq.filter (fun kv -> wanted.IsEmpty || wanted.Contains kv.Key)
+        |> Seq.map (fun kv ->
+          let value = if isNull kv.Value then null else kv.Value.DeepClone()
+          kv.Key, value)
+        |> Map.ofSeq
+        |> Ok
+      | _ -> Error(MalformedRecord(i, $"'{block}' is not an object")))
+
+  /// <summary>
+  /// Closes a results file.
+  /// </summary>
+  /// <param name="f">Results file.</param>
+  let close (f: ResultFile) : unit = (f :> IDisposable).Dispose()
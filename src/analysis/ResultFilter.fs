@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// <summary>
+/// Comparison applied by a result filter.
+/// </summary>
+type Comparison =
+  | LessThan
+  | LessOrEqual
+  | GreaterThan
+  | GreaterOrEqual
+  | EqualTo
+  | NotEqualTo
+
+/// <summary>
+/// Condition on one component of a nodal or element result, e.g. uy&lt;-0.01.
+/// </summary>
+type ResultFilter =
+  { Component: string
+    Comparison: Comparison
+    Value: float }
+
+[<RequireQualifiedAccess>]
+module ResultFilter =
+
+  /// Operators, longest first so "<=" is not read as "<".
+  let private operators =
+    [ "<=", LessOrEqual
+      ">=", GreaterOrEqual
+      "!=", NotEqualTo
+      "<", LessThan
+      ">", GreaterThan
+      "=", EqualTo ]
+
+  let getAsString (f: ResultFilter) : string =
+    let symbol = operators |> List.find (snd >> (=) f.Comparison) |> fst
+    let value = f.Value.ToString CultureInfo.InvariantCulture
+    $"{f.Component}{symbol}{value}"
+
+  /// <summary>
+  /// Parses a filter, e.g. "uy&lt;-0.01" or "Fx>=100".
+  /// </summary>
+  /// <param name="text">Component, operator and value.</param>
+  /// <returns>Matching filter, if the text is valid.</returns>
+  let tryParse (text: string) : ResultFilter option =
+    let styles = NumberStyles.Float
+    let culture = CultureInfo.InvariantCulture
+
+    operators
+    |> List.tryPick (fun (symbol, comparison) ->
+      match text.IndexOf(symbol, StringComparison.Ordinal) with
+      | i when i > 0 ->
+        let name = text.Substring(0, i).Trim()
+        let value = text.Substring(i + symbol.Length).Trim()
+
+        match Double.TryParse(value, styles, culture) with
+        | true, x when name <> "" ->
+          Some
+            { Component = name
+              Comparison = comparison
+              Value = x }
+        | _ -> None
+      | _ -> None)
+
+  /// <summary>
+  /// Tests a result entry against a filter.
+  /// </summary>
+  /// <param name="f">Filter.</param>
+  /// <param name="entry">Components of a node or element result.</param>
+  /// <returns>
+  /// True when the component, matched ignoring case, satisfies the filter;
+  /// false when the entry has no such numeric component.
+  /// </returns>
+  let matches (f: ResultFilter) (entry: JsonNode) : bool =
+    let value =
+      match entry with
+      | :? JsonObject as o ->
+        o
+        |> Seq.tryFind (fun kv ->
+          kv.Key.Equals(f.Component, StringComparison.OrdinalIgnoreCase))
+        |> Option.bind (fun kv ->
+          match kv.Value with
+          | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+            Some(v.GetValue<float>())
+          | _ -> None)
+      | _ -> None
+
+    match value, f.Comparison with
+    | Some x, LessThan -> x < f.Value
+    | Some x, LessOrEqual -> x <= f.Value
+    | Some x, GreaterThan -> x > f.Value
+    | Some x, GreaterOrEqual -> x >= f.Value
+    | Some x, EqualTo -> x = f.Value
+    | Some x, NotEqualTo -> x <> f.Value
+    | None, _ -> false
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// <summary>
+/// Errors raised whilst upgrading a result record to the current format.
+/// </summary>
+type ResultFormatError =
+  | InvalidVersion of reason: string
+  | NewerVersion of version: int
+
+[<RequireQualifiedAccess>]
+module ResultFormatError =
+
+  let getAsString (e: ResultFormatError) : string =
+    match e with
+    | InvalidVersion reason -> $"has a format version that {reason}"
+    | NewerVersion version ->
+      $"has format version {version}, written by a newer Gazelle; upgrade to "
+      + "read it"
+
+/// <summary>
+/// Versions the layout of result records, so files written by earlier
+/// releases stay readable as the results evolve.
+/// </summary>
+/// <remarks>
+/// Each record carries its version in a <c>formatVersion</c> property;
+/// records without one predate versioning and are version 1. Readers pass
+/// records through migrate, which applies one step per version in turn, so
+/// a change to the layout adds a step here rather than a branch in every
+/// reader. Records of a newer version than Version are rejected.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module ResultFormat =
+
+  /// Version of the records this release writes.
+  [<Literal>]
+  let Version = 7
+
+  /// Name of the property holding a record's version.
+  [<Literal>]
+  let Property = "formatVersion"
+
+  /// Adds an empty array for a block that records of earlier versions
+  /// omitted, when it is absent.
+  let private ensureArray (name: string) (record: JsonObject) =
+    if not (record.ContainsKey name) then
+      record[name] <- JsonArray()
+
+  /// Analysis results written before versioning may lack the reactions,
+  /// modes, warnings and errors blocks, which readers may now rely on.
+  let private fromVersion1 (record: JsonObject) =
+    if record.ContainsKey "loadSets" then
+      for name in [ "reactions"; "modes"; "warnings"; "errors" ] do
+        ensureArray name record
+
+  /// Version 3 added member end forces to analysis results.
+  let private fromVersion2 (record: JsonObject) =
+    if record.ContainsKey "loadSets" then
+      ensureArray "memberForces" record
+
+  /// Version 4 added the internal forces of members along their length.
+  let private fromVersion3 (record: JsonObject) =
+    if record.ContainsKey "loadSets" then
+      ensureArray "internalForces" record
+
+  /// Version 5 added the stresses of members and plates.
+  let private fromVersion4 (record: JsonObject) =
+    if record.ContainsKey "loadSets" then
+      ensureArray "stresses" record
+
+  /// Version 7 added the energy balance of each load set.
+  let private fromVersion6 (record: JsonObject) =
+    if record.ContainsKey "loadSets" then
+      ensureArray "energies" record
+
+  /// Steps upgrading a record from each version to the next. Version 6
+  /// added the unit system of the results, which earlier records cannot
+  /// recover, so they are left without; see ResultUnits.
+  let private migrations =
+    Map
+      [ 1, fromVersion1
+        2, fromVersion2
+        3, fromVersion3
+        4, fromVersion4
+        6, fromVersion6 ]
+
+  /// <summary>
+  /// Returns the format version of a record.
+  /// </summary>
+  /// <param name="record">Result record.</param>
+  /// <returns>Its version, 1 when it has none, or ResultFormatError.</returns>
+  let versionOf (record: JsonObject) : Result<int, ResultFormatError> =
+    match record[Property] with
+    | null -> Ok 1
+    | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+      match v.TryGetValue<int>() with
+      | true, version when version >= 1 -> Ok version
+      | _ -> Error(InvalidVersion "is not a positive whole number")
+    | _ -> Error(InvalidVersion "is not a number")
+
+  /// <summary>
+  /// Upgrades a record in place to the current format version.
+  /// </summary>
+  /// <param name="record">Result record of any version.</param>
+  /// <returns>The record at Version, or ResultFormatError.</returns>
+  let migrate (record: JsonObject) : Result<JsonObject, ResultFormatError> =
+    versionOf record
+    |> Result.bind (fun version ->
+      if version > Version then
+        Error(NewerVersion version)
+      else
+        for step in version .. Version - 1 do
+          migrations.TryFind step |> Option.iter (fun upgrade -> upgrade record)
+
+        record[Property] <- JsonValue.Create Version
+        Ok record)
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.IO
+open System.Text.Encodings.Web
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// <summary>
+/// Line-oriented formats results can be appended to as they are produced.
+/// </summary>
+type StreamFormat =
+  | JsonLines
+  | Csv
+
+/// <summary>
+/// Open file receiving one record per line, flushed as each is written so
+/// a long run that fails keeps everything written before it.
+/// </summary>
+type ResultStream =
+  private
+    { Writer: StreamWriter
+      Format: StreamFormat
+      mutable Columns: string list option }
+
+  interface IDisposable with
+    member s.Dispose() = s.Writer.Dispose()
+
+[<RequireQualifiedAccess>]
+module StreamFormat =
+
+  /// <summary>
+  /// Detects the stream format of a results file from its extension.
+  /// </summary>
+  /// <param name="path">Path to results file.</param>
+  /// <returns>JSON Lines for .jsonl or .ndjson, CSV for .csv.</returns>
+  let fromPath (path: string) : StreamFormat option =
+    match Path.GetExtension(path).ToLowerInvariant() with
+    | ".jsonl"
+    | ".ndjson" -> Some JsonLines
+    | ".csv" -> Some Csv
+    | _ -> None
+
+/// <summary>
+/// Writes results incrementally rather than buffering a whole run.
+/// </summary>
+/// <remarks>
+/// Records are serialised with camelCase names. JSON Lines records lead
+/// with their ResultFormat version. In CSV the first record's properties
+/// become the header; nested values are written as JSON text.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module ResultStream =
+
+  let private jsonOptions =
+    JsonSerializerOptions(
+      PropertyNamingPolicy = JsonNamingPolicy.CamelCase,
+      Encoder = JavaScriptEncoder.UnsafeRelaxedJsonEscaping
+    )
+
+  /// Quotes a CSV field when it contains separators, quotes or newlines.
+  let private field (text: string) =
+    if text.IndexOfAny([| ','; '"'; '\n'; '\r' |]) >= 0 then
+      "\"" + text.Replace("\"", "\"\"") + "\""
+    else
+      text
+
+  let private cell (node: JsonNode) =
+    match node with
+    | null -> ""
+    | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+      v.GetValue<string>()
+    | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+      v.GetValue<float>().ToString("R", CultureInfo.InvariantCulture)
+    | n -> n.ToJsonString jsonOptions
+
+  /// <summary>
+  /// Creates a results file, replacing any existing one.
+  /// </summary>
+  /// <param name="format">Stream format.</param>
+  /// <param name="path">Path to results file.</param>
+  /// <returns>Open stream; dispose it to close the file.</returns>
+  let create (format: StreamFormat) (path: string) : ResultStream =
+    { Writer = new StreamWriter(path, false)
+      Format = format
+      Columns = None }
+
+  /// <summary>
+  /// Writes results to an open stream, e.g. standard output.
+  /// </summary>
+  /// <param name="format">Stream format.</param>
+  /// <param name="stream">Destination, closed with the result stream.</param>
+  /// <returns>Open stream.</returns>
+  let ofStream (format: StreamFormat) (stream: Stream) : ResultStream =
+    { Writer = new StreamWriter(stream)
+      Format = format
+      Columns = None }
+
+  /// <summary>
+  /// Appends a record and flushes it to disk.
+  /// </summary>
+  /// <param name="s">Open stream.</param>
+  /// <param name="record">Record, e.g. a result per model or time step.</param>
+  let write (s: ResultStream) (record: 'T) : unit =
+    let node = JsonSerializer.SerializeToNode(record, jsonOptions)
+
+    match s.Format, node with
+    | JsonLines, (:? JsonObject as o) ->
+      // Records lead with their format version, moved rather than copied.
+      let stamped = JsonObject()
+      stamped[ResultFormat.Property] <- JsonValue.Create ResultFormat.Version
+
+      for name in o |> Seq.map (fun kv -> kv.Key) |> Seq.toList do
+        let value = o[name]
+        o.Remove name |> ignore
+        stamped[name] <- value
+
+      s.Writer.WriteLine(stamped.ToJsonString jsonOptions)
+    | JsonLines, _ -> s.Writer.WriteLine(node.ToJsonString jsonOptions)
+    | Csv, (:? JsonObject as o) ->
+      let columns =
+        match s.Columns with
+        | Some columns -> columns
+        | None ->
+          let columns = o |> Seq.map (fun kv -> kv.Key) |> Seq.toList
+          s.Writer.WriteLine(String.Join(",", columns |> List.map field))
+          s.Columns <- Some columns
+          columns
+
+      let values = columns |> List.map (fun c -> field (cell o[c]))
+      s.Writer.WriteLine(String.Join(",", values))
+    | Csv, other -> s.Writer.WriteLine(field (cell other))
+
+    s.Writer.Flush()
+
+  /// <summary>
+  /// Closes a results file.
+  /// </summary>
+  /// <param name="s">Open stream.</param>
+  let close (s: ResultStream) : unit = s.Writer.Dispose()
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Text.Json
+open System.Text.Json.Nodes
+open Gazelle.Model
+
+/// <summary>
+/// Errors raised whilst converting a result record between unit systems.
+/// </summary>
+type ResultUnitsError =
+  | UnstatedUnits
+  | UnknownResultUnits of name: string
+
+[<RequireQualifiedAccess>]
+module ResultUnitsError =
+
+  let getAsString (e: ResultUnitsError) : string =
+    match e with
+    | UnstatedUnits -> "states no units"
+    | UnknownResultUnits name -> $"is in unknown units '{name}'"
+
+/// <summary>
+/// Converts result records to the unit system a reader asks for, so that
+/// results of a model in one system are never read as another.
+/// </summary>
+/// <remarks>
+/// Records carry the unit system of their model in a <c>units</c>
+/// property, as named by ModelInfo.Units. Conversion scales each block by
+/// the dimension of its components: displacements, velocities and
+/// accelerations by length, with rotations unitless; reactions, applied
+/// loads and member forces by force, or force × length for moments; and
+/// stresses by force / length². Mode shapes are normalised and periods
+/// and times are in seconds in every system, so are left unchanged.
+/// Records of format versions before 6 state no units and cannot be
+/// converted.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module ResultUnits =
+
+  /// Name of the property holding a record's unit system.
+  [<Literal>]
+  let Property = "units"
+
+  /// Indices of the moments among member end forces, by their count; see
+  /// StaticResult.MemberForces.
+  let private moments (count: int) =
+    match count with
+    | 4 -> set [ 1; 3 ]
+    | 6 -> set [ 2; 5 ]
+    | 10 -> set [ 2; 3; 4; 7; 8; 9 ]
+    | 12 -> set [ 3; 4; 5; 9; 10; 11 ]
+    | _ -> Set.empty
+
+  let private objects (node: JsonNode) =
+    match node with
+    | :? JsonArray as xs ->
+      xs
+      |> Seq.choose (function
+        | :? JsonObject as o -> Some o
+        | _ -> None)
+      |> List.ofSeq
+    | _ -> []
+
+  let private names (o: JsonObject) =
+    o |> Seq.map (fun kv -> kv.Key) |> List.ofSeq
+
+  /// Scales a record in place by the factor of each dimension.
+  let private scaleWith (factor: int -> int -> float) (record: JsonObject) =
+    let scale length force (o: JsonObject) (name: string) =
+      match o[name] with
+      | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+        o[name] <- JsonValue.Create(v.GetValue<float>() * factor length force)
+      | _ -> ()
+
+    let starts (prefix: string) (name: string) =
+      name.StartsWith(prefix, StringComparison.Ordinal)
+
+    // Forces along, and moments about, each direction, e.g. "Fy" or "Rz".
+    let forces (node: JsonNode) =
+      match node with
+      | :? JsonObject as o ->
+        for name in names o do
+          if starts "F" name || starts "U" name then
+            scale 0 1 o name
+          elif starts "M" name || starts "R" name then
+            scale 1 1 o name
+      | _ -> ()
+
+    // Translations, and their rates, of each node; rotations are unitless.
+    let motions (node: JsonNode) =
+      match node with
+      | :? JsonObject as nodes ->
+        for KeyValue(_, dofs) in nodes do
+          match dofs with
+          | :? JsonObject as o ->
+            for name in names o do
+              if starts "U" name then scale 1 0 o name
+          | _ -> ()
+      | _ -> ()
+
+    scale 1 0 record "maxDisplacement"
+    scale -2 1 record "maxStress"
+
+    for block in [ "displacements"; "velocities"; "accelerations" ] do
+      motions record[block]
+
+    for loadSet in objects record["loadSets"] do
+      forces loadSet["applied"]
+
+    for reaction in objects record["reactions"] do
+      forces reaction["global"]
+      forces reaction["local"]
+
+    for entry in objects record["memberForces"] do
+      match entry["forces"] with
+      | :? JsonArray as xs ->
+        let moments = moments xs.Count
+
+        for i in 0 .. xs.Count - 1 do
+          match xs[i] with
+          | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+            let k = if moments.Contains i then factor 1 1 else factor 0 1
+            xs[i] <- JsonValue.Create(v.GetValue<float>() * k)
+          | _ -> ()
+      | _ -> ()
+
+    for entry in objects record["internalForces"] do
+      for station in objects entry["stations"] do
+        scale 1 0 station "distance"
+
+        for name in [ "axial"; "shearY"; "shearZ" ] do
+          scale 0 1 station name
+
+        for name in [ "torsion"; "momentY"; "momentZ" ] do
+          scale 1 1 station name
+
+    for entry in objects record["stresses"] do
+      for name in [ "axial"; "bending"; "vonMises"; "stress" ] do
+        scale -2 1 entry name
+
+    for entry in objects record["energies"] do
+      for name in [ "externalWork"; "strainEnergy"; "supports" ] do
+        scale 1 1 entry name
+
+      match entry["elements"] with
+      | :? JsonObject as o ->
+        for name in names o do
+          scale 1 1 o name
+      | _ -> ()
+
+    // Energies of a time step, at the top of its record.
+    for name in
+      [ "kineticEnergy"; "strainEnergy"; "dampingEnergy"; "externalWork" ] do
+      scale 1 1 record name
+
+  /// <summary>
+  /// Returns the unit system a record states, if any.
+  /// </summary>
+  /// <param name="record">Result record.</param>
+  /// <returns>Name of its unit system, e.g. "kN-m".</returns>
+  let unitsOf (record: JsonObject) : string option =
+    match record[Property] with
+    | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+      Some(v.GetValue<string>())
+    | _ -> None
+
+  /// <summary>
+  /// Converts a record in place to another unit system.
+  /// </summary>
+  /// <param name="target">Unit system to express the record in.</param>
+  /// <param name="record">Result record at the current format version.</param>
+  /// <returns>The converted record, or ResultUnitsError.</returns>
+  let convert
+    (target: UnitSystem)
+    (record: JsonObject)
+    : Result<JsonObject, ResultUnitsError> =
+    match unitsOf record with
+    | None -> Error UnstatedUnits
+    | Some name ->
+      match UnitSystem.tryFind name with
+      | Error _ -> Error(UnknownResultUnits name)
+      | Ok source ->
+        scaleWith (UnitSystem.factor source target) record
+        record[Property] <- JsonValue.Create target.Name
+        Ok record
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Diagnostics
+open System.Security.Cryptography
+open System.Text
+open Gazelle.Model
+
+/// <summary>
+/// Blocks of analysis output that can be computed and stored selectively,
+/// keeping result files small for large models.
+/// </summary>
+type ResultBlock =
+  | Displacements
+  | Reactions
+  | MemberForces
+  | InternalForces
+  | Stresses
+  | Modes
+  | Energies
+
+[<RequireQualifiedAccess>]
+module ResultBlock =
+
+  /// Every result block, in output order.
+  let all =
+    [ Displacements
+      Reactions
+      MemberForces
+      InternalForces
+      Stresses
+      Modes
+      Energies ]
+
+  let getAsString (b: ResultBlock) : string =
+    match b with
+    | Displacements -> "displacements"
+    | Reactions -> "reactions"
+    | MemberForces -> "member-forces"
+    | InternalForces -> "internal-forces"
+    | Stresses -> "stresses"
+    | Modes -> "modes"
+    | Energies -> "energies"
+
+  /// <summary>
+  /// Parses a result block name, e.g. from --save.
+  /// </summary>
+  /// <param name="name">Block name, case-insensitive.</param>
+  /// <returns>Matching block, if any.</returns>
+  let tryParse (name: string) : ResultBlock option =
+    let name = name.Trim().ToLowerInvariant()
+    all |> List.tryFind (fun b -> getAsString b = name)
+
+  /// <summary>
+  /// Parses a list of result block names.
+  /// </summary>
+  /// <param name="names">Block names.</param>
+  /// <returns>Selected blocks, or the first unrecognised name.</returns>
+  let parseAll (names: string list) : Result<Set<ResultBlock>, string> =
+    let folder acc name =
+      match acc, tryParse name with
+      | Ok blocks, Some b -> Ok(Set.add b blocks)
+      | Ok _, None -> Error name
+      | Error e, _ -> Error e
+
+    List.fold folder (Ok Set.empty) names
+
+/// <summary>
+/// How, where and when a set of results was produced, so result files are
+/// self-describing and auditable.
+/// </summary>
+type Provenance =
+  {
+    /// Version of the Gazelle engine, e.g. "0.1.0".
+    GazelleVersion: string
+    /// Linear solver, e.g. "skyline".
+    Solver: string
+    /// Convergence tolerance of an iterative solution, if any.
+    Tolerance: float option
+    /// SHA-256 hash of the model as serialised, in lowercase hex.
+    ModelHash: string
+    /// Time the analysis started.
+    Timestamp: DateTimeOffset
+    /// Name of the machine that ran the analysis.
+    Hostname: string
+    /// Elapsed time in seconds.
+    WallTime: float
+    /// Processor time in seconds, across every thread of the process.
+    CpuTime: float
+  }
+
+[<RequireQualifiedAccess>]
+module Provenance =
+
+  /// <summary>
+  /// Hashes a model by its content, so results can be traced to the exact
+  /// model analysed; parameters are already substituted.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>SHA-256 hash of its JSON, in lowercase hex.</returns>
+  let modelHash (m: Model) : string =
+    Model.serialize Json m
+    |> Encoding.UTF8.GetBytes
+    |> SHA256.HashData
+    |> Convert.ToHexString
+    |> fun hex -> hex.ToLowerInvariant()
+
+  /// <summary>
+  /// Runs an analysis and records its provenance.
+  /// </summary>
+  /// <param name="solver">Linear solver used, e.g. "skyline".</param>
+  /// <param name="tolerance">Convergence tolerance, if iterative.</param>
+  /// <param name="m">Model analysed.</param>
+  /// <param name="analyse">Analysis to run.</param>
+  /// <returns>Outcome of the analysis with its provenance.</returns>
+  let measure
+    (solver: string)
+    (tolerance: float option)
+    (m: Model)
+    (analyse: unit -> 'T)
+    : 'T * Provenance =
+    let started = DateTimeOffset.Now
+    let cpu = Process.GetCurrentProcess().TotalProcessorTime
+    let clock = Stopwatch.StartNew()
+    let outcome = analyse ()
+    clock.Stop()
+
+    let used = Process.GetCurrentProcess().TotalProcessorTime - cpu
+
+    outcome,
+    { GazelleVersion =
+        typeof<Provenance>.Assembly.GetName().Version.ToString(3)
+      Solver = solver
+      Tolerance = tolerance
+      ModelHash = modelHash m
+      Timestamp = started
+      Hostname = Environment.MachineName
+      WallTime = clock.Elapsed.TotalSeconds
+      CpuTime = used.TotalSeconds }
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Outcome of one check made by a script.
+/// </summary>
+type ScriptCheck = { Name: string; Passed: bool }
+
+/// <summary>
+/// Scripting API behind the builtins of scripts run by gz run, and for F#
+/// scripts, to build models, analyse them, post-process results and
+/// automate design checks.
+/// </summary>
+/// <remarks>
+/// F# scripts see the whole engine, e.g. Model, LoadCases and Static, and
+/// this module adds conveniences over it. Unlike the engine, these functions
+/// raise an exception with the error message on failure, so a script stops
+/// at its first error. Checks are recorded as they are made, and gz run
+/// fails if any of them did.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Script =
+
+  /// Environment variable naming the model passed with --model.
+  [<Literal>]
+  let ModelVariable = "GZ_MODEL"
+
+  let mutable private checks: ScriptCheck list = []
+
+  /// <summary>
+  /// Reads a model file, detecting its format from the extension.
+  /// </summary>
+  /// <param name="path">Path to model file.</param>
+  /// <returns>Model.</returns>
+  let load (path: string) : Model =
+    match Model.read None path with
+    | Ok m -> m
+    | Error e -> failwith (ModelError.getAsString e)
+
+  /// <summary>
+  /// Reads the model passed to gz run with --model.
+  /// </summary>
+  /// <returns>Model.</returns>
+  let model () : Model =
+    match Environment.GetEnvironmentVariable ModelVariable with
+    | null
+    | "" -> failwith "No model given; pass one to gz run with --model."
+    | path -> load path
+
+  /// <summary>
+  /// Writes a model file, choosing the format from the extension.
+  /// </summary>
+  /// <param name="path">Destination file path.</param>
+  /// <param name="m">Model to write.</param>
+  let save (path: string) (m: Model) : unit =
+    match Model.save path m with
+    | Ok() -> ()
+    | Error e -> failwith (ModelError.getAsString e)
+
+  /// <summary>
+  /// Analyses every load case and combination of a model.
+  /// </summary>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Static response by load set name.</returns>
+  let analyse (m: Model) : Map<string, StaticResult> =
+    match LoadCases.select m None None with
+    | Error e -> failwith (SelectionError.getAsString e)
+    | Ok sets ->
+      sets
+      |> List.map (fun set ->
+        match Static.analyse m set with
+        | Ok r -> set.Name, r
+        | Error e -> failwith $"{set.Name}: {StaticError.getAsString e}")
+      |> Map.ofList
+
+  /// <summary>
+  /// Returns the largest nodal translation of a response.
+  /// </summary>
+  /// <param name="r">Static response.</param>
+  /// <returns>Largest translation, or zero.</returns>
+  let maxDisplacement (r: StaticResult) : float =
+    [ for KeyValue(_, dofs) in r.Displacements do
+        let at dof = dofs.TryFind dof |> Option.defaultValue 0.0
+        sqrt (at Ux ** 2.0 + at Uy ** 2.0 + at Uz ** 2.0) ]
+    |> List.fold max 0.0
+
+  /// <summary>
+  /// Records and prints the outcome of a check.
+  /// </summary>
+  /// <param name="name">What was checked, e.g. "Sway within H/500".</param>
+  /// <param name="passed">Whether the check passed.</param>
+  let check (name: string) (passed: bool) : unit =
+    checks <- checks @ [ { Name = name; Passed = passed } ]
+    printfn "%s %s" (if passed then "PASS" else "FAIL") name
+
+  /// <summary>
+  /// Returns the checks recorded so far, in the order they were made.
+  /// </summary>
+  /// <returns>Checks.</returns>
+  let results () : ScriptCheck list = checks
+
+  /// <summary>
+  /// Returns the exit code for the checks recorded: 1 if any failed.
+  /// </summary>
+  /// <returns>Exit code.</returns>
+  let exitCode () : int =
+    if checks |> List.exists (fun c -> not c.Passed) then 1 else 0
@@ -0,0 +1,402 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open Gazelle.Model
+
+/// <summary>
+/// Scheme for the corrections of each iteration of a nonlinear analysis.
+/// </summary>
+[<RequireQualifiedAccess>]
+type IterationScheme =
+  /// Newton-Raphson, forming and factorising the tangent stiffness at every
+  /// iteration.
+  | NewtonRaphson
+  /// BFGS quasi-Newton updates of the tangent stiffness factorised at the
+  /// start of each load increment.
+  | Bfgs
+
+[<RequireQualifiedAccess>]
+module IterationScheme =
+
+  let getAsString (s: IterationScheme) : string =
+    match s with
+    | IterationScheme.NewtonRaphson -> "newton"
+    | IterationScheme.Bfgs -> "bfgs"
+
+  /// <summary>
+  /// Parses an iteration scheme name, e.g. from --scheme.
+  /// </summary>
+  /// <param name="text">"newton", "newton-raphson" or "bfgs", in any case.
+  /// </param>
+  /// <returns>Matching scheme, if any.</returns>
+  let tryParse (text: string) : IterationScheme option =
+    match text.Trim().ToLowerInvariant() with
+    | "newton"
+    | "newton-raphson" -> Some IterationScheme.NewtonRaphson
+    | "bfgs" -> Some IterationScheme.Bfgs
+    | _ -> None
+
+/// <summary>
+/// Convergence settings of a second-order analysis.
+/// </summary>
+type SecondOrderSettings =
+  {
+    /// Largest change in displacement over the largest displacement at
+    /// which iteration stops.
+    Tolerance: float
+    /// Iterations of one load increment after which it is cut.
+    MaxIterations: int
+    /// Largest load increment, as a fraction of the load set; 1 applies
+    /// the whole load at once.
+    MaxStep: float
+    /// Smallest load increment a diverging one may be cut to.
+    MinStep: float
+    Scheme: IterationScheme
+    /// Whether to scale each correction by a line search.
+    LineSearch: bool
+  }
+
+/// <summary>
+/// Second-order static response of a model to one load set.
+/// </summary>
+type SecondOrderResult =
+  {
+    /// Response on the deformed geometry, with amplified member forces.
+    Response: StaticResult
+    /// Newton-Raphson iterations taken, the first being linear, including
+    /// those of increments that were cut.
+    Iterations: int
+    /// Load increments the load set was applied in.
+    Steps: int
+    /// Largest second-order displacement over the largest first-order one.
+    Amplification: float
+  }
+
+/// <summary>
+/// Errors raised whilst iterating a second-order analysis.
+/// </summary>
+type SecondOrderError =
+  | FailedIteration of StaticError
+  | Unconverged of iterations: int
+  | Diverged of loadFactor: float
+
+[<RequireQualifiedAccess>]
+module SecondOrderError =
+
+  let getAsString (e: SecondOrderError) : string =
+    match e with
+    | FailedIteration e -> StaticError.getAsString e
+    | Unconverged iterations ->
+      $"Second-order analysis did not converge in {iterations} iterations; "
+      + "the loads may exceed the elastic critical load."
+    | Diverged factor ->
+      let percent = factor.ToString("P1", CultureInfo.InvariantCulture)
+
+      $"Second-order analysis converged only to {percent} of the load at "
+      + "the smallest step; the loads may exceed the elastic critical load."
+
+/// <summary>
+/// Geometrically nonlinear (P-Delta) static analysis, equilibrating the
+/// loads on the deformed structure.
+/// </summary>
+/// <remarks>
+/// Each member adds a geometric stiffness in proportion to its axial force,
+/// which softens members in compression and stiffens those in tension.
+/// Newton-Raphson iteration from the linear solution updates the axial
+/// forces, solving the tangent stiffness K + K_G for the out-of-balance
+/// load until the change in displacement falls within the tolerance.
+/// Member end forces include the geometric stiffness, so frame moments are
+/// amplified by sway. Rotations are assumed small. The pretension of
+/// Cable elements is an initial axial force, so it adds to their geometric
+/// stiffness as it does to their end forces.
+///
+/// The load, prescribed displacements included, is applied in increments
+/// of at most MaxStep, each equilibrated from the last. An increment that
+/// fails to converge within MaxIterations, or whose tangent stiffness
+/// cannot be solved, is halved and retried, down to MinStep; one that
+/// converges within a quarter of MaxIterations doubles the next, up to
+/// MaxStep. The first iteration from rest is linear, so its failure is
+/// reported at once. Given an initial state, e.g. the converged
+/// displacements of a nearby load, iteration starts from it instead, and
+/// the amplification is taken over a linear solution found apart.
+///
+/// BFGS keeps the tangent stiffness factorised at the start of an increment
+/// and updates its inverse from the change in out-of-balance load over
+/// each correction, skipping updates that would lose positive definiteness;
+/// it takes more iterations than Newton-Raphson but factorises once. A line
+/// search scales each correction by the step η at which the out-of-balance
+/// load is all but orthogonal to it, within 0.8 of its value at η = 0 or
+/// after five trials, with η from 0.1 to 2, damping the overshoot of
+/// softening members and of those that stiffen abruptly.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module SecondOrder =
+
+  /// Default settings: a tolerance of 10⁻⁶ within 20 iterations, the whole
+  /// load at once, cut to as little as 1 % of it if that diverges, and
+  /// Newton-Raphson without line search.
+  let defaults: SecondOrderSettings =
+    { Tolerance = 1e-6
+      MaxIterations = 20
+      MaxStep = 1.0
+      MinStep = 0.01
+      Scheme = IterationScheme.NewtonRaphson
+      LineSearch = false }
+
+  /// Ratio of the final to the initial slope at which a line search stops.
+  [<Literal>]
+  let private SearchTolerance = 0.8
+
+  [<Literal>]
+  let private SearchTrials = 5
+
+  /// <summary>
+  /// Solves an assembled model for nodal loads on its deformed geometry.
+  /// </summary>
+  /// <param name="settings">Convergence settings.</param>
+  /// <param name="solver">Solver for the free degrees of freedom.</param>
+  /// <param name="initial">Displacements to iterate from, e.g. those of a
+  /// previous solution; InitialState.empty starts from rest.</param>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="loads">Nodal loads, e.g. of a load set.</param>
+  /// <returns>Second-order response, or SecondOrderError.</returns>
+  let solveWith
+    (settings: SecondOrderSettings)
+    (solver: LinearSolver)
+    (initial: InitialState)
+    (m: Model)
+    (a: Assembly)
+    (loads: NodalLoad list)
+    : Result<SecondOrderResult, SecondOrderError> =
+    let largest (u: float array) =
+      u |> Array.fold (fun x y -> max x (abs y)) 0.0
+
+    // Pretension is applied with the loads, so cables stiffen as it grows.
+    let loaded =
+      Static.loadVector a loads
+      |> Result.bind (fun f ->
+        Static.pretensionLoads m a |> Result.map (Array.map2 (+) f))
+
+    match loaded with
+    | Error e -> Error(FailedIteration e)
+    | Ok f ->
+      let free = Static.free a
+      let isFree = Set.ofArray free
+
+      let restrained =
+        Array.init a.Prescribed.Length id
+        |> Array.filter (isFree.Contains >> not)
+
+      let dofs = Array.map (Array.get a.Dofs) free
+
+      let dot (x: float array) (y: float array) =
+        Array.fold2 (fun acc a b -> acc + a * b) 0.0 x y
+
+      let moved (u: float array) (eta: float) (d: float array) =
+        let v = Array.copy u
+        d |> Array.iteri (fun j x -> v[free[j]] <- v[free[j]] + eta * x)
+        v
+
+      // Out-of-balance load f - K(u)·u on the free freedoms, and the
+      // tangent.
+      let unbalanced (f: float array) (u: float array) =
+        Static.respond m a Map.empty u f
+        |> Result.map Static.axialForces
+        |> Result.bind (Static.tangentStiffness m a)
+        |> Result.map (fun k ->
+          let ku = Sparse.multiply k u
+          free |> Array.map (fun i -> f[i] - ku[i]), k)
+
+      // Largest displacement of the linear solution, the first iteration
+      // from rest under the whole load.
+      let linear () =
+        let u = Array.zeroCreate a.Prescribed.Length
+
+        for i in restrained do
+          u[i] <- a.Prescribed[i]
+
+        unbalanced f u
+        |> Result.bind (fun (r, k) ->
+          Sparse.select free k
+          |> Static.factoriseSystem solver dofs
+          |> Result.bind (fun solve -> solve r))
+        |> Result.map (fun d -> largest (moved u 1.0 d))
+
+      // Iterates at a load factor from u, in place, returning the
+      // iterations taken and the largest displacement after the first.
+      let equilibrate (factor: float) (u: float array) =
+        let f = Array.map ((*) factor) f
+
+        for i in restrained do
+          u[i] <- factor * a.Prescribed[i]
+
+        let outOfBalance = unbalanced f
+
+        // Step along d at which the out-of-balance load is all but
+        // orthogonal to it, interpolating the slope from that at zero.
+        let search (u: float array) (d: float array) (r: float array) =
+          let s0 = dot d r
+
+          let along eta =
+            outOfBalance (moved u eta d) |> Result.map (fst >> dot d)
+
+          let rec refine trial eta (s: float) (best, slope) =
+            let best, slope =
+              if abs s < abs slope then eta, s else best, slope
+
+            let next =
+              if s0 = s then eta
+              else eta * s0 / (s0 - s) |> max 0.1 |> min 2.0
+
+            if abs s <= SearchTolerance * abs s0 || trial >= SearchTrials then
+              Ok best
+            elif next = eta then
+              Ok best
+            else
+              along next
+              |> Result.bind (fun s -> refine (trial + 1) next s (best, slope))
+
+          if not settings.LineSearch || s0 <= 0.0 then
+            Ok 1.0
+          else
+            along 1.0 |> Result.bind (fun s -> refine 1 1.0 s (1.0, infinity))
+
+        // Correction for r: the factorised stiffness, updated by the BFGS
+        // pairs (s, y, 1/y·s), newest first, in two loops.
+        let correct solve (pairs: (float array * float array * float) list) r =
+          let q = Array.copy r
+
+          let alphas =
+            [ for s, y, rho in pairs do
+                let alpha = rho * dot s q
+                y |> Array.iteri (fun i x -> q[i] <- q[i] - alpha * x)
+                alpha ]
+
+          solve q
+          |> Result.map (fun (z: float array) ->
+            for (s, y, rho), alpha in List.zip pairs alphas |> List.rev do
+              let beta = rho * dot y z
+              s |> Array.iteri (fun i x -> z[i] <- z[i] + (alpha - beta) * x)
+
+            z)
+
+        let rec iterate iteration first factorised pairs previous =
+          let step =
+            outOfBalance u
+            |> Result.bind (fun (r, k) ->
+              // y is the fall in out-of-balance load over the last step.
+              let pairs =
+                match settings.Scheme, previous with
+                | IterationScheme.Bfgs, Some(s, last) ->
+                  let y = Array.map2 (-) last r
+                  let curvature = dot s y
+
+                  if curvature > 0.0 then (s, y, 1.0 / curvature) :: pairs
+                  else pairs
+                | _ -> pairs
+
+              let stiffness =
+                match settings.Scheme, factorised with
+                | IterationScheme.Bfgs, Some solve -> Ok solve
+                | _ ->
+                  Sparse.select free k |> Static.factoriseSystem solver dofs
+
+              stiffness
+              |> Result.bind (fun solve ->
+                correct solve pairs r
+                |> Result.bind (fun d ->
+                  search u d r
+                  |> Result.map (fun eta -> solve, pairs, r, d, eta))))
+
+          match step with
+          | Error e -> Error(iteration, FailedIteration e)
+          | Ok(solve, pairs, r, d, eta) ->
+            let first = if iteration = 1 then largest (moved u 1.0 d) else first
+            let du = Array.map ((*) eta) d
+            du |> Array.iteri (fun j x -> u[free[j]] <- u[free[j]] + x)
+
+            if largest du <= settings.Tolerance * largest u then
+              Ok(iteration, first)
+            elif
+              iteration >= settings.MaxIterations || Double.IsNaN(largest u)
+            then
+              Error(iteration, Unconverged iteration)
+            else
+              iterate (iteration + 1) first (Some solve) pairs (Some(du, r))
+
+        iterate 1 0.0 None [] None
+
+      let rec advance factor size steps iterations first (u: float array) =
+        if factor >= 1.0 then
+          // Forces follow from the converged axial forces.
+          Static.respond m a Map.empty u f
+          |> Result.map Static.axialForces
+          |> Result.bind (fun axial -> Static.respond m a axial u f)
+          |> Result.mapError FailedIteration
+          |> Result.map (fun r ->
+            { Response = r
+              Iterations = iterations
+              Steps = steps
+              Amplification =
+                if first > 0.0 then largest u / first else 1.0 })
+        else
+          let size = min size (1.0 - factor)
+          let target = if factor + size >= 1.0 then 1.0 else factor + size
+          let trial = Array.copy u
+
+          match equilibrate target trial with
+          | Ok(taken, largest) ->
+            // The first iteration from rest is the linear solution; from
+            // an initial state that is solved for at the outset.
+            let first =
+              if steps = 0 && first = 0.0 then largest / target else first
+
+            let next =
+              if taken <= settings.MaxIterations / 4 then
+                min settings.MaxStep (2.0 * size)
+              else
+                size
+
+            advance target next (steps + 1) (iterations + taken) first trial
+          | Error(1, (FailedIteration _ as e)) when steps = 0 -> Error e
+          | Error(_, e) when size / 2.0 < settings.MinStep ->
+            if steps = 0 then Error e else Error(Diverged factor)
+          | Error(taken, _) ->
+            advance factor (size / 2.0) steps (iterations + taken) first u
+
+      if initial.Displacements.IsEmpty then
+        Array.zeroCreate a.Prescribed.Length
+        |> advance 0.0 settings.MaxStep 0 0 0.0
+      else
+        linear ()
+        |> Result.mapError FailedIteration
+        |> Result.bind (fun first ->
+          InitialState.toVector a initial
+          |> advance 0.0 settings.MaxStep 0 0 first)
+
+  /// <summary>
+  /// Analyses a model under one load set on its deformed geometry.
+  /// </summary>
+  /// <param name="settings">Convergence settings.</param>
+  /// <param name="m">Valid model.</param>
+  /// <param name="set">Load set.</param>
+  /// <returns>Second-order response, or SecondOrderError.</returns>
+  let analyse
+    (settings: SecondOrderSettings)
+    (m: Model)
+    (set: LoadSet)
+    : Result<SecondOrderResult, SecondOrderError> =
+    NodalLoads.ofLoadSet m set
+    |> Result.mapError (FailedLoads >> FailedIteration)
+    |> Result.bind (fun loads ->
+      Static.assemble m
+      |> Result.mapError FailedIteration
+      |> Result.bind (fun a ->
+        let solver = LinearSolver.defaultSolver
+        solveWith settings solver InitialState.empty m a loads))
@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+/// <summary>
+/// Flat shell elements of 3 or 4 nodes, in the element's own axes: a
+/// bilinear membrane with MITC4 Reissner-Mindlin plate bending.
+/// </summary>
+/// <remarks>
+/// Each node has [u; v; w; θx; θy; θz] in local axes, with z normal to the
+/// element. Transverse shear strains are interpolated from the element's
+/// edges (the MITC4 scheme of Bathe and Dvorkin), so thin plates do not
+/// lock in shear. Triangles are quadrilaterals with their last two nodes
+/// coincident, which makes them stiffer than quadrilaterals of the same
+/// size. The in-plane rotation θz has no stiffness of its own, so a small
+/// drilling stiffness restrains it without resisting rigid rotation.
+/// Stress resultants are per unit width: membrane forces Nx, Ny and Nxy,
+/// moments Mx, My and Mxy, positive when they stretch the face on the
+/// positive local z side, and shear forces Qx and Qy.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Shell =
+
+  /// Natural coordinates of the corners, anticlockwise.
+  let private corners = [| -1.0, -1.0; 1.0, -1.0; 1.0, 1.0; -1.0, 1.0 |]
+
+  /// Points of the 2×2 Gauss rule, each of unit weight.
+  let private gauss =
+    let g = 1.0 / sqrt 3.0
+    [ -g, -g; g, -g; g, g; -g, g ]
+
+  /// Shear correction factor of a solid section.
+  let private shearFactor = 5.0 / 6.0
+
+  /// Drilling stiffness relative to the stiffest bending rotation.
+  let private drilling = 1e-3
+
+  let private functions xi eta =
+    corners
+    |> Array.map (fun (a, b) -> 0.25 * (1.0 + a * xi) * (1.0 + b * eta))
+
+  /// Derivatives of the shape functions along ξ and η.
+  let private derivatives xi eta =
+    corners |> Array.map (fun (a, b) -> 0.25 * a * (1.0 + b * eta)),
+    corners |> Array.map (fun (a, b) -> 0.25 * b * (1.0 + a * xi))
+
+  /// Jacobian [x,ξ y,ξ; x,η y,η] at a point of the element.
+  let private jacobian (x: float[]) (y: float[]) xi eta =
+    let dxi, deta = derivatives xi eta
+    let dot a b = Array.fold2 (fun s p q -> s + p * q) 0.0 a b
+    array2D [ [ dot dxi x; dot dxi y ]; [ dot deta x; dot deta y ] ]
+
+  /// Covariant transverse shear strain along ξ (axis 0) or η (axis 1),
+  /// w,ξ + θy·x,ξ - θx·y,ξ, over the degrees of freedom of the element.
+  let private covariant (x: float[]) (y: float[]) xi eta axis =
+    let n = functions xi eta
+    let dn = (if axis = 0 then fst else snd) (derivatives xi eta)
+    let j = jacobian x y xi eta
+    let row = Array.zeroCreate 24
+
+    for i in 0..3 do
+      row[6 * i + 2] <- dn[i]
+      row[6 * i + 3] <- -j[axis, 1] * n[i]
+      row[6 * i + 4] <- j[axis, 0] * n[i]
+
+    row
+
+  /// Membrane, bending and shear strains over the degrees of freedom of a
+  /// quadrilateral at each Gauss point, with the Jacobian determinant.
+  let private strains (x: float[]) (y: float[]) =
+    let blend (s: float) (a: float[]) (b: float[]) =
+      Array.map2 (fun p q -> 0.5 * (1.0 + s) * p + 0.5 * (1.0 - s) * q) a b
+
+    [ for xi, eta in gauss do
+        let j = jacobian x y xi eta
+        let det = j[0, 0] * j[1, 1] - j[0, 1] * j[1, 0]
+
+        let inverse =
+          array2D [ [ j[1, 1]; -j[0, 1] ]; [ -j[1, 0]; j[0, 0] ] ]
+          |> Array2D.map (fun v -> v / det)
+
+        // Cartesian derivatives of the shape functions.
+        let dxi, deta = derivatives xi eta
+        let along r i = inverse[r, 0] * dxi[i] + inverse[r, 1] * deta[i]
+        let dx, dy = Array.init 4 (along 0), Array.init 4 (along 1)
+        let membrane = Array2D.zeroCreate 3 24
+        let bending = Array2D.zeroCreate 3 24
+
+        for i in 0..3 do
+          let at = 6 * i
+          membrane[0, at] <- dx[i]
+          membrane[1, at + 1] <- dy[i]
+          membrane[2, at] <- dy[i]
+          membrane[2, at + 1] <- dx[i]
+          bending[0, at + 4] <- dx[i]
+          bending[1, at + 3] <- -dy[i]
+          bending[2, at + 3] <- -dx[i]
+          bending[2, at + 4] <- dy[i]
+
+        // Tied at the midpoints of the edges and interpolated across.
+        let alongXi =
+          blend eta (covariant x y 0.0 1.0 0) (covariant x y 0.0 (-1.0) 0)
+
+        let alongEta =
+          blend xi (covariant x y 1.0 0.0 1) (covariant x y (-1.0) 0.0 1)
+
+        let shear =
+          Array2D.init 2 24 (fun r c ->
+            inverse[r, 0] * alongXi[c] + inverse[r, 1] * alongEta[c])
+
+        membrane, bending, shear, det ]
+
+  /// Membrane, bending and shear rigidities of an isotropic section.
+  let private rigidities (modulus: float) (poisson: float) (t: float) =
+    let k = modulus / (1.0 - poisson * poisson)
+
+    let plane =
+      array2D
+        [ [ k; k * poisson; 0.0 ]
+          [ k * poisson; k; 0.0 ]
+          [ 0.0; 0.0; k * (1.0 - poisson) / 2.0 ] ]
+
+    let g = shearFactor * modulus / (2.0 * (1.0 + poisson)) * t
+
+    Array2D.map ((*) t) plane,
+    Array2D.map ((*) (t ** 3.0 / 12.0)) plane,
+    array2D [ [ g; 0.0 ]; [ 0.0; g ] ]
+
+  /// Expands the degrees of freedom of a triangle to those of a
+  /// quadrilateral whose last two nodes coincide.
+  let private collapse (nodes: int) =
+    Array2D.init 24 (6 * nodes) (fun r c ->
+      let node = min (r / 6) (nodes - 1)
+      if r % 6 = c % 6 && node = c / 6 then 1.0 else 0.0)
+
+  /// Corner coordinates of the quadrilateral, repeating a triangle's last.
+  let private quad (xy: (float * float) list) =
+    let xy = Array.ofList xy
+    let at i = xy[min i (xy.Length - 1)]
+    Array.init 4 (at >> fst), Array.init 4 (at >> snd)
+
+  /// <summary>
+  /// Returns the stiffness of a flat shell element in its own axes.
+  /// </summary>
+  /// <param name="modulus">Elastic modulus.</param>
+  /// <param name="poisson">Poisson's ratio.</param>
+  /// <param name="thickness">Thickness.</param>
+  /// <param name="xy">Corners in local axes, anticlockwise about z.</param>
+  /// <returns>Stiffness over [u; v; w; θx; θy; θz] at each corner.</returns>
+  let stiffness
+    (modulus: float)
+    (poisson: float)
+    (thickness: float)
+    (xy: (float * float) list)
+    : float[,] =
+    let x, y = quad xy
+    let dm, db, ds = rigidities modulus poisson thickness
+    let k = Array2D.zeroCreate 24 24
+
+    for membrane, bending, shear, det in strains x y do
+      for b, d in [ membrane, dm; bending, db; shear, ds ] do
+        let part = Matrix.product (Matrix.transpose b) (Matrix.product d b)
+        Matrix.scatter [| 0..23 |] (Array2D.map ((*) det) part) k
+
+    let n = xy.Length
+    let a = collapse n
+    let k = Matrix.product (Matrix.transpose a) (Matrix.product k a)
+
+    // Springs between the drilling rotations leave rigid rotation free.
+    let stiffest =
+      [ for i in 0 .. n - 1 do
+          for d in [ 3; 4 ] -> k[6 * i + d, 6 * i + d] ]
+      |> List.max
+
+    let springs =
+      Array2D.init n n (fun i j ->
+        let share = (if i = j then 1.0 else 0.0) - 1.0 / float n
+        drilling * stiffest * share)
+
+    Matrix.scatter (Array.init n (fun i -> 6 * i + 5)) springs k
+    k
+
+  /// <summary>
+  /// Returns the matrix recovering the mean stress resultants of a flat
+  /// shell element, averaged over its area, from its displacements.
+  /// </summary>
+  /// <param name="modulus">Elastic modulus.</param>
+  /// <param name="poisson">Poisson's ratio.</param>
+  /// <param name="thickness">Thickness.</param>
+  /// <param name="xy">Corners in local axes, anticlockwise about z.</param>
+  /// <returns>
+  /// Matrix from [u; v; w; θx; θy; θz] at each corner to
+  /// [Nx; Ny; Nxy; Mx; My; Mxy; Qx; Qy].
+  /// </returns>
+  let resultants
+    (modulus: float)
+    (poisson: float)
+    (thickness: float)
+    (xy: (float * float) list)
+    : float[,] =
+    let x, y = quad xy
+    let dm, db, ds = rigidities modulus poisson thickness
+    let r = Array2D.zeroCreate 8 24
+    let points = strains x y
+    let area = points |> List.sumBy (fun (_, _, _, det) -> det)
+
+    for membrane, bending, shear, det in points do
+      for at, b, d in [ 0, membrane, dm; 3, bending, db; 6, shear, ds ] do
+        let part = Matrix.product d b
+
+        for i in 0 .. Array2D.length1 part - 1 do
+          for j in 0..23 do
+            r[at + i, j] <- r[at + i, j] + part[i, j] * det / area
+
+    Matrix.product r (collapse xy.Length)
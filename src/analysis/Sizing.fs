@@ -0,0 +1,315 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Limits a sized structure must meet.
+/// </summary>
+type SizingTargets =
+  {
+    /// Greatest utilisation of any member, usually 1.
+    MaxUtilisation: float
+    /// Least fundamental natural frequency in hertz, e.g. to keep a floor
+    /// or footbridge clear of the pace of walking.
+    MinFrequency: float option
+    /// Greatest nodal translation under any load set.
+    MaxDeflection: float option
+  }
+
+/// <summary>
+/// Member resized to meet the targets.
+/// </summary>
+type SizedMember =
+  { Element: string
+    /// Factor on the member's original area.
+    Scale: float
+    /// Governing utilisation of the resized member, if it is checked.
+    Utilisation: float option }
+
+/// <summary>
+/// Resized model and the response it was sized on.
+/// </summary>
+type SizingResult =
+  { Model: Model
+    /// Members with an area, ordered by ID.
+    Members: SizedMember list
+    /// Greatest utilisation of any member.
+    Utilisation: float
+    /// Fundamental natural frequency in hertz, if a minimum was set.
+    Frequency: float option
+    /// Greatest nodal translation under any load set.
+    Deflection: float
+    /// Mass of the members before and after, if they have a density.
+    InitialMass: float option
+    Mass: float option
+    Iterations: int }
+
+/// <summary>
+/// Errors raised whilst sizing members.
+/// </summary>
+type SizingError =
+  | InvalidTarget of reason: string
+  | NoSizableMembers
+  | FailedResponse of reason: string
+  | InfeasibleMember of element: string * scale: float
+  | UnconvergedSizing of iterations: int
+
+[<RequireQualifiedAccess>]
+module SizingError =
+
+  let getAsString (e: SizingError) : string =
+    match e with
+    | InvalidTarget reason -> $"Invalid sizing target: {reason}."
+    | NoSizableMembers -> "Model has no members with an area to size."
+    | FailedResponse reason -> $"Cannot analyse sized model: {reason}"
+    | InfeasibleMember(element, scale) ->
+      $"Member '{element}' reached {scale} times its area without meeting \
+        the targets."
+    | UnconvergedSizing iterations ->
+      $"Sizing did not converge in {iterations} iterations."
+
+/// <summary>
+/// Sizes members to meet a utilisation limit, and optionally a least
+/// natural frequency and a greatest deflection, for strength-, vibration-
+/// and stiffness-driven design of e.g. floors and footbridges.
+/// </summary>
+/// <remarks>
+/// Each member with an area is resized by a factor on its section, as if
+/// every dimension grew by its square root: its area by the factor, its
+/// second moments ("i", "iy", "iz", "j" and "ix") by its square and its
+/// elastic moduli ("zz" and "zy") by its 1.5 power. Each iteration
+/// analyses every load set, checks each member as Design does and finds
+/// its demand: its utilisation over the limit, or the structure's
+/// deflection over its limit or squared least frequency over its
+/// frequency, whichever is greater, since stiffness serves the whole
+/// structure. Each factor then grows or shrinks by the square root of its
+/// member's demand, at most doubling or halving, until every demand is
+/// within 1 % of 1 or its member is at its smallest. Where strength
+/// governs, this is the fully stressed design. Members keep between 1 %
+/// and 100 times their original area; members that neither check nor
+/// stiffen against a target keep their size.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Sizing =
+
+  /// Iterations after which sizing stops.
+  let private limit = 100
+
+  /// Relative departure of a demand from 1 at which sizing stops.
+  let private tolerance = 0.01
+
+  /// Least and greatest factors on a member's original area.
+  let private smallest = 0.01
+  let private largest = 100.0
+
+  let private hasArea (e: Element) =
+    e.Properties
+    |> Option.exists (fun p -> p.ContainsKey "area" || p.ContainsKey "a")
+
+  /// <summary>
+  /// Scales a section as if every dimension grew by the square root of a
+  /// factor on its area.
+  /// </summary>
+  /// <param name="factor">Factor on the area.</param>
+  /// <param name="properties">Section properties of a member.</param>
+  /// <returns>Scaled properties; others, e.g. "k", are kept.</returns>
+  let scaleSection
+    (factor: float)
+    (properties: Map<string, float>)
+    : Map<string, float> =
+    properties
+    |> Map.map (fun key x ->
+      match key with
+      | "area"
+      | "a" -> x * factor
+      | "i"
+      | "iy"
+      | "iz"
+      | "j"
+      | "ix" -> x * factor ** 2.0
+      | "zz"
+      | "zy" -> x * factor ** 1.5
+      | _ -> x)
+
+  /// <summary>
+  /// Returns a model with members resized by factors on their areas.
+  /// </summary>
+  /// <param name="scales">Factor on the area of each member, by ID.</param>
+  /// <param name="m">Model with the original sections.</param>
+  /// <returns>Resized model.</returns>
+  let resize (scales: Map<string, float>) (m: Model) : Model =
+    { m with
+        Elements =
+          m.Elements
+          |> Map.map (fun id e ->
+            match scales.TryFind id with
+            | Some s ->
+              { e with
+                  Properties = e.Properties |> Option.map (scaleSection s) }
+            | None -> e) }
+
+  /// Largest nodal translation of a static response.
+  let private translation (r: StaticResult) =
+    [ for KeyValue(_, dofs) in r.Displacements do
+        let at dof = dofs.TryFind dof |> Option.defaultValue 0.0
+        sqrt (at Ux ** 2.0 + at Uy ** 2.0 + at Uz ** 2.0) ]
+    |> List.fold max 0.0
+
+  /// Greatest utilisation of each checked member under one load set.
+  let private utilisations (m: Model) (set: LoadSet) (r: StaticResult) =
+    r.MemberForces
+    |> Map.toList
+    |> List.fold
+      (fun acc (id, forces) ->
+        acc
+        |> Result.bind (fun (found: Map<string, float>) ->
+          Diagrams.critical m set id forces
+          |> Result.mapError (LoadError.getAsString >> FailedResponse)
+          |> Result.map (fun stations ->
+            match Design.check m id forces stations with
+            | Some c -> Map.add id c.Utilisation found
+            | None -> found)))
+      (Ok Map.empty)
+
+  /// Utilisation of each checked member and deflection over every load
+  /// set, and the fundamental frequency if a least one is sought.
+  let private respond mass (targets: SizingTargets) (m: Model) =
+    let merge (a: Map<string, float>) (b: Map<string, float>) =
+      b
+      |> Map.fold
+        (fun acc id u ->
+          Map.add id (max u (acc.TryFind id |> Option.defaultValue 0.0)) acc)
+        a
+
+    let statics =
+      LoadCases.select m None None
+      |> Result.mapError (SelectionError.getAsString >> FailedResponse)
+      |> Result.bind (
+        List.fold
+          (fun acc set ->
+            acc
+            |> Result.bind (fun (found, deflection) ->
+              Static.analyse m set
+              |> Result.mapError (fun e ->
+                FailedResponse $"{set.Name}: {StaticError.getAsString e}")
+              |> Result.bind (fun r ->
+                utilisations m set r
+                |> Result.map (fun u ->
+                  merge found u, max deflection (translation r)))))
+          (Ok(Map.empty, 0.0))
+      )
+
+    let frequency =
+      match targets.MinFrequency with
+      | None -> Ok None
+      | Some _ ->
+        Modal.analyse mass 1 m
+        |> Result.mapError (ModalError.getAsString >> FailedResponse)
+        |> Result.bind (fun r ->
+          match r.Modes with
+          | mode :: _ -> Ok(Some(Modal.frequency mode))
+          | [] -> Error(FailedResponse "no natural mode found"))
+
+    match statics, frequency with
+    | Error e, _
+    | _, Error e -> Error e
+    | Ok(u, deflection), Ok f -> Ok(u, f, deflection)
+
+  /// <summary>
+  /// Sizes the members of a model to meet targets.
+  /// </summary>
+  /// <param name="mass">Mass matrix for natural frequencies.</param>
+  /// <param name="targets">Limits to meet.</param>
+  /// <param name="m">Valid model whose members have an area.</param>
+  /// <returns>Resized model and its response, or SizingError.</returns>
+  let size
+    (mass: MassMatrix)
+    (targets: SizingTargets)
+    (m: Model)
+    : Result<SizingResult, SizingError> =
+    let sizable =
+      m.Elements |> Map.filter (fun _ e -> hasArea e) |> Map.keys |> List.ofSeq
+
+    let positive name (x: float option) =
+      match x with
+      | Some x when not (x > 0.0) -> Some $"{name} must be positive"
+      | _ -> None
+
+    let invalid =
+      [ positive "the utilisation limit" (Some targets.MaxUtilisation)
+        positive "the least frequency" targets.MinFrequency
+        positive "the deflection limit" targets.MaxDeflection ]
+      |> List.choose id
+      |> List.tryHead
+
+    let rec iterate (scales: Map<string, float>) count =
+      let trial = resize scales m
+
+      respond mass targets trial
+      |> Result.bind (fun (found: Map<string, float>, frequency, deflection) ->
+        // Demand on the stiffness of the whole structure: 1 at its limit.
+        let stiffness =
+          [ match targets.MaxDeflection with
+            | Some most -> deflection / most
+            | None -> ()
+            match targets.MinFrequency, frequency with
+            | Some least, Some f -> (least / f) ** 2.0
+            | _ -> () ]
+          |> List.fold max 0.0
+
+        let demand id =
+          match found.TryFind id with
+          | Some u -> Some(max (u / targets.MaxUtilisation) stiffness)
+          | None when stiffness > 0.0 -> Some stiffness
+          | None -> None
+
+        let settled id =
+          match demand id with
+          | None -> true
+          | Some d ->
+            abs (d - 1.0) <= tolerance || (d < 1.0 && scales[id] <= smallest)
+
+        let stuck =
+          sizable
+          |> List.tryFind (fun id ->
+            scales[id] >= largest
+            && demand id |> Option.exists (fun d -> d > 1.0 + tolerance))
+
+        if List.forall settled sizable then
+          Ok
+            { Model = trial
+              Members =
+                [ for id in sizable ->
+                    { Element = id
+                      Scale = scales[id]
+                      Utilisation = found.TryFind id } ]
+              Utilisation = found |> Map.fold (fun acc _ u -> max acc u) 0.0
+              Frequency = frequency
+              Deflection = deflection
+              InitialMass = Mass.total m
+              Mass = Mass.total trial
+              Iterations = count }
+        else
+          match stuck with
+          | Some id -> Error(InfeasibleMember(id, largest))
+          | None when count = limit -> Error(UnconvergedSizing count)
+          | None ->
+            let step (id: string) (s: float) =
+              match demand id with
+              | None -> s
+              | Some d ->
+                let factor = sqrt d |> max 0.5 |> min 2.0
+                s * factor |> max smallest |> min largest
+
+            iterate (Map.map step scales) (count + 1))
+
+    match invalid, sizable with
+    | Some reason, _ -> Error(InvalidTarget reason)
+    | None, [] -> Error NoSizableMembers
+    | None, _ ->
+      let scales = sizable |> List.map (fun id -> id, 1.0) |> Map.ofList
+      iterate scales 1
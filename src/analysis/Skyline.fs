@@ -0,0 +1,337 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+
+/// <summary>
+/// Order in which the rows and columns of a matrix are factorised. Fill-in
+/// of a skyline factor stays within the profile, so an ordering that keeps
+/// nonzeros near the diagonal saves both work and memory.
+/// </summary>
+[<RequireQualifiedAccess>]
+type Reordering =
+  /// Order in which the degrees of freedom are numbered.
+  | Natural
+  /// Reverse Cuthill-McKee, which narrows the band of most structures.
+  | ReverseCuthillMcKee
+  /// Whichever of the two holds fewer entries, so that a good numbering is
+  /// never made worse.
+  | Automatic
+
+/// <summary>
+/// Symmetric matrix in skyline storage: each column is held from its first
+/// nonzero row down to the diagonal, after reordering to narrow the band.
+/// </summary>
+type Skyline =
+  private
+    { Values: float array
+      /// Offset of each column in Values.
+      Starts: int array
+      /// First stored row of each column.
+      Tops: int array
+      /// Original index of each reordered row and column.
+      Ordering: int array }
+
+/// <summary>
+/// Cholesky factor U of a skyline matrix, with A = Uᵀ·U, reused to solve
+/// for many right-hand sides.
+/// </summary>
+type SkylineFactors = private { Factor: Skyline }
+
+/// <summary>
+/// Skyline storage and Cholesky factorisation of symmetric positive definite
+/// matrices, e.g. stiffness matrices of frames, whose nonzeros lie in a
+/// narrow band once nodes are numbered well.
+/// </summary>
+[<RequireQualifiedAccess>]
+module Skyline =
+
+  /// Pivots smaller than this, relative to the largest diagonal, are singular.
+  let private tolerance = 1e-12
+
+  /// Orders the vertices of a graph, given by their neighbours, by reverse
+  /// Cuthill-McKee.
+  let private reverseCuthillMcKee (neighbours: int array array) =
+    let n = neighbours.Length
+    let degree i = neighbours[i].Length
+    let visited = Array.zeroCreate n
+    let order = Collections.Generic.List<int>(n)
+
+    // Each connected part is searched breadth first from its node of least
+    // degree, visiting neighbours in order of increasing degree.
+    for start in Array.init n id |> Array.sortBy degree do
+      if not visited[start] then
+        let queue = Collections.Generic.Queue<int>()
+        visited[start] <- true
+        queue.Enqueue start
+
+        while queue.Count > 0 do
+          let i = queue.Dequeue()
+          order.Add i
+
+          for j in neighbours[i] |> Array.sortBy degree do
+            if not visited[j] then
+              visited[j] <- true
+              queue.Enqueue j
+
+    order.ToArray() |> Array.rev
+
+  /// <summary>
+  /// Orders the rows and columns of a symmetric matrix by reverse
+  /// Cuthill-McKee, so nonzeros gather near the diagonal.
+  /// </summary>
+  /// <param name="a">Symmetric matrix.</param>
+  /// <returns>Original index of each reordered row and column.</returns>
+  let ordering (a: float[,]) : int array =
+    let n = Matrix.order a
+
+    Array.init n (fun i ->
+      [| for j in 0 .. n - 1 do
+           if j <> i && a[i, j] <> 0.0 then
+             j |])
+    |> reverseCuthillMcKee
+
+  /// <summary>
+  /// Stores the upper triangle of a symmetric matrix in skyline form.
+  /// </summary>
+  /// <param name="ordering">
+  /// Original index of each reordered row and column, e.g. from
+  /// <c>Skyline.ordering</c>.
+  /// </param>
+  /// <param name="a">Symmetric matrix.</param>
+  /// <returns>Matrix in skyline storage.</returns>
+  let ofMatrix (ordering: int array) (a: float[,]) : Skyline =
+    let n = ordering.Length
+    let at i j = a[ordering[i], ordering[j]]
+
+    let tops =
+      Array.init n (fun j ->
+        seq { 0 .. j } |> Seq.find (fun i -> i = j || at i j <> 0.0))
+
+    let starts = Array.zeroCreate n
+    let mutable count = 0
+
+    for j in 0 .. n - 1 do
+      starts[j] <- count
+      count <- count + j - tops[j] + 1
+
+    let values = Array.zeroCreate count
+
+    for j in 0 .. n - 1 do
+      for i in tops[j] .. j do
+        values[starts[j] + i - tops[j]] <- at i j
+
+    { Values = values
+      Starts = starts
+      Tops = tops
+      Ordering = Array.copy ordering }
+
+  /// First stored row of each reordered column of a sparse matrix, given
+  /// its rows and the position of each original index.
+  let private topsOf (rows: (int * float) array array) (ordering: int array) =
+    let position = Array.zeroCreate ordering.Length
+    ordering |> Array.iteri (fun k i -> position[i] <- k)
+
+    // By symmetry, row i of the original holds column i of the upper triangle.
+    let tops =
+      Array.init ordering.Length (fun j ->
+        rows[ordering[j]]
+        |> Array.fold (fun top (c, _) -> min top position[c]) j)
+
+    tops, position
+
+  /// Number of entries a skyline holds under an ordering.
+  let private profile rows (ordering: int array) =
+    fst (topsOf rows ordering)
+    |> Array.mapi (fun j top -> j - top + 1)
+    |> Array.sum
+
+  /// <summary>
+  /// Reorders a sparse symmetric matrix and stores its upper triangle in
+  /// skyline form, without forming it densely.
+  /// </summary>
+  /// <param name="reordering">Ordering of the rows and columns.</param>
+  /// <param name="a">Symmetric matrix.</param>
+  /// <returns>Matrix in skyline storage.</returns>
+  let ofSparseWith (reordering: Reordering) (a: SparseMatrix) : Skyline =
+    let n = Sparse.order a
+    let rows = Array.init n (Sparse.row a)
+    let natural () = Array.init n id
+
+    let reversed () =
+      rows
+      |> Array.mapi (fun i row -> row |> Array.map fst |> Array.filter ((<>) i))
+      |> reverseCuthillMcKee
+
+    let ordering =
+      match reordering with
+      | Reordering.Natural -> natural ()
+      | Reordering.ReverseCuthillMcKee -> reversed ()
+      | Reordering.Automatic ->
+        [ reversed (); natural () ] |> List.minBy (profile rows)
+
+    let tops, position = topsOf rows ordering
+    let starts = Array.zeroCreate n
+    let mutable count = 0
+
+    for j in 0 .. n - 1 do
+      starts[j] <- count
+      count <- count + j - tops[j] + 1
+
+    let values = Array.zeroCreate count
+
+    for j in 0 .. n - 1 do
+      for c, x in rows[ordering[j]] do
+        let i = position[c]
+
+        if i <= j then
+          values[starts[j] + i - tops[j]] <- x
+
+    { Values = values
+      Starts = starts
+      Tops = tops
+      Ordering = ordering }
+
+  /// <summary>
+  /// Stores a sparse symmetric matrix in skyline form under the ordering of
+  /// fewer entries, as <c>ofSparseWith Reordering.Automatic</c>.
+  /// </summary>
+  /// <param name="a">Symmetric matrix.</param>
+  /// <returns>Matrix in skyline storage.</returns>
+  let ofSparse (a: SparseMatrix) : Skyline =
+    ofSparseWith Reordering.Automatic a
+
+  /// <summary>
+  /// Returns the number of entries held, which bounds the work and memory of
+  /// factorisation.
+  /// </summary>
+  /// <param name="s">Matrix in skyline storage.</param>
+  /// <returns>Number of stored entries.</returns>
+  let size (s: Skyline) : int = s.Values.Length
+
+  /// <summary>
+  /// Returns the half-bandwidth: the greatest distance of a stored entry from
+  /// the diagonal.
+  /// </summary>
+  /// <param name="s">Matrix in skyline storage.</param>
+  /// <returns>Half-bandwidth, 0 for a diagonal matrix.</returns>
+  let bandwidth (s: Skyline) : int =
+    s.Tops |> Array.mapi (fun j top -> j - top) |> Array.fold max 0
+
+  /// Factorises column by column. A column whose pivot vanishes stops the
+  /// factorisation, or with restrain is replaced by a unit column, as if
+  /// its freedom were held, so that every such column is found.
+  let private decompose (restrain: bool) (s: Skyline) =
+    let n = s.Tops.Length
+    let u = Array.copy s.Values
+    let held = Array.zeroCreate n
+    let index i j = s.Starts[j] + i - s.Tops[j]
+
+    let scale =
+      Seq.init n (fun j -> abs s.Values[index j j]) |> Seq.fold max 0.0
+
+    let rec column j singular =
+      if j = n || (not restrain && not (List.isEmpty singular)) then
+        u, List.rev singular
+      else
+        for i in s.Tops[j] .. j - 1 do
+          if held[i] then
+            u[index i j] <- 0.0
+          else
+            let mutable sum = u[index i j]
+
+            for k in max s.Tops[i] s.Tops[j] .. i - 1 do
+              sum <- sum - u[index k i] * u[index k j]
+
+            u[index i j] <- sum / u[index i i]
+
+        let mutable pivot = u[index j j]
+
+        for k in s.Tops[j] .. j - 1 do
+          pivot <- pivot - u[index k j] * u[index k j]
+
+        if pivot <= tolerance * scale then
+          let diagonal = s.Values[index j j]
+
+          let ratio =
+            if pivot > 0.0 then diagonal / pivot else infinity
+
+          held[j] <- true
+
+          for k in s.Tops[j] .. j - 1 do
+            u[index k j] <- 0.0
+
+          u[index j j] <- 1.0
+          column (j + 1) ((j, ratio) :: singular)
+        else
+          u[index j j] <- sqrt pivot
+          column (j + 1) singular
+
+    if n = 0 || scale = 0.0 then
+      u, List.init n (fun j -> j, infinity)
+    else
+      column 0 []
+
+  /// <summary>
+  /// Factorises a symmetric positive definite matrix as A = Uᵀ·U.
+  /// Fill-in stays within the skyline, so no storage is added.
+  /// </summary>
+  /// <param name="s">Matrix to factorise; left unchanged.</param>
+  /// <returns>
+  /// Factors, or None when the matrix is singular or not positive definite.
+  /// </returns>
+  let factorise (s: Skyline) : SkylineFactors option =
+    match decompose false s with
+    | u, [] when s.Tops.Length > 0 -> Some { Factor = { s with Values = u } }
+    | _ -> None
+
+  /// <summary>
+  /// Finds the rows of a matrix whose pivots vanish in factorisation, such
+  /// as the freedoms of a mechanism. Each is held as it is found, so one is
+  /// reported per independent way the matrix is singular.
+  /// </summary>
+  /// <param name="s">Matrix in skyline storage.</param>
+  /// <returns>
+  /// Original index of each singular row, ascending, with its diagonal over
+  /// its pivot: infinite where the pivot is not positive, and otherwise
+  /// vast where the row is a combination of others but for rounding.
+  /// </returns>
+  let singular (s: Skyline) : (int * float) list =
+    let _, rows = decompose true s
+    rows |> List.map (fun (j, ratio) -> s.Ordering[j], ratio) |> List.sort
+
+  /// <summary>
+  /// Solves A·x = b using the factors of A.
+  /// </summary>
+  /// <param name="f">Factors of A.</param>
+  /// <param name="b">Right-hand side, in the original ordering.</param>
+  /// <returns>Solution x, in the original ordering.</returns>
+  let solve (f: SkylineFactors) (b: float array) : float array =
+    let s = f.Factor
+    let n = s.Tops.Length
+    let index i j = s.Starts[j] + i - s.Tops[j]
+    let y = Array.init n (fun i -> b[s.Ordering[i]])
+
+    // Forward substitution with Uᵀ, column by column.
+    for j in 0 .. n - 1 do
+      for k in s.Tops[j] .. j - 1 do
+        y[j] <- y[j] - s.Values[index k j] * y[k]
+
+      y[j] <- y[j] / s.Values[index j j]
+
+    // Back substitution with U, column by column.
+    for j in n - 1 .. -1 .. 0 do
+      y[j] <- y[j] / s.Values[index j j]
+
+      for k in s.Tops[j] .. j - 1 do
+        y[k] <- y[k] - s.Values[index k j] * y[j]
+
+    let x = Array.zeroCreate n
+
+    for i in 0 .. n - 1 do
+      x[s.Ordering[i]] <- y[i]
+
+    x
@@ -0,0 +1,381 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.IO
+open System.IO.Compression
+open System.Runtime.InteropServices
+open System.Security.Cryptography
+open System.Text
+open System.Text.Encodings.Web
+open System.Text.Json
+open System.Text.Json.Nodes
+open Gazelle.Model
+
+/// <summary>
+/// Environment that made a snapshot, and the files it holds.
+/// </summary>
+type SnapshotManifest =
+  {
+    /// Layout version of the archive, see Snapshot.Version.
+    FormatVersion: int
+    /// Version of the Gazelle engine, e.g. "0.1.0".
+    GazelleVersion: string
+    /// .NET runtime, e.g. ".NET 8.0.4".
+    Runtime: string
+    /// Runtime identifier of the platform, e.g. "linux-x64".
+    Platform: string
+    Hostname: string
+    Created: DateTimeOffset
+    ModelName: string
+    /// Hash of the model, as Provenance.modelHash gives it.
+    ModelHash: string
+    /// SHA-256 hash of each file in the archive, in lowercase hex, by name.
+    Files: Map<string, string>
+  }
+
+/// <summary>
+/// A recorded value that a re-run does not reproduce.
+/// </summary>
+type SnapshotDifference =
+  {
+    /// Path of the value in its document, e.g. "$.reactions[2].global.Uy".
+    Path: string
+    Expected: string
+    /// Value found, or None when it is missing.
+    Actual: string option
+  }
+
+/// Manifest, model and the contents of the other files of a snapshot.
+type SnapshotContents = SnapshotManifest * Model * Map<string, byte array>
+
+/// <summary>
+/// Errors raised whilst reading a snapshot.
+/// </summary>
+type SnapshotError =
+  | UnreadableArchive of reason: string
+  | MissingEntry of name: string
+  | CorruptEntry of name: string
+  | InvalidModel of ModelError
+
+[<RequireQualifiedAccess>]
+module SnapshotError =
+
+  let getAsString (e: SnapshotError) : string =
+    match e with
+    | UnreadableArchive reason -> $"Cannot read snapshot: {reason}."
+    | MissingEntry name -> $"Snapshot has no '{name}'."
+    | CorruptEntry name ->
+      $"Snapshot file '{name}' does not match the hash it was recorded with."
+    | InvalidModel e -> ModelError.getAsString e
+
+/// <summary>
+/// Snapshots: single archives of a model, the results of its analysis and
+/// the environment that produced them, for submission to checkers or
+/// attachment to issue reports.
+/// </summary>
+/// <remarks>
+/// A snapshot is a zip archive holding <c>manifest.json</c>, the model as
+/// analysed in <c>model.json</c>, with parameters and composition already
+/// resolved, and any other files, e.g. analysis options, results and
+/// renders. The manifest records the hash of every file, so a snapshot
+/// that has been altered is refused when read. Re-running the analysis
+/// and comparing its results with those recorded, within the tolerances
+/// of Golden, confirms that it is reproducible.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Snapshot =
+
+  /// Current layout version of snapshot archives.
+  [<Literal>]
+  let Version = 1
+
+  [<Literal>]
+  let ManifestEntry = "manifest.json"
+
+  [<Literal>]
+  let ModelEntry = "model.json"
+
+  let private jsonOptions =
+    JsonSerializerOptions(
+      PropertyNamingPolicy = JsonNamingPolicy.CamelCase,
+      Encoder = JavaScriptEncoder.UnsafeRelaxedJsonEscaping,
+      WriteIndented = true
+    )
+
+  let private hash (bytes: byte array) =
+    (SHA256.HashData bytes |> Convert.ToHexString).ToLowerInvariant()
+
+  /// <summary>
+  /// Writes a snapshot of a model and other files, recording the
+  /// environment it was written in.
+  /// </summary>
+  /// <param name="path">Destination archive, replaced if it exists.</param>
+  /// <param name="m">Model as analysed.</param>
+  /// <param name="files">Contents of the other files, by name.</param>
+  /// <returns>Manifest written.</returns>
+  let write
+    (path: string)
+    (m: Model)
+    (files: Map<string, byte array>)
+    : SnapshotManifest =
+    let entries =
+      files
+      |> Map.add ModelEntry (Encoding.UTF8.GetBytes(Model.serialize Json m))
+
+    let manifest =
+      { FormatVersion = Version
+        GazelleVersion =
+          typeof<SnapshotManifest>.Assembly.GetName().Version.ToString(3)
+        Runtime = RuntimeInformation.FrameworkDescription
+        Platform = RuntimeInformation.RuntimeIdentifier
+        Hostname = Environment.MachineName
+        Created = DateTimeOffset.Now
+        ModelName = m.Info.Name
+        ModelHash = Provenance.modelHash m
+        Files = entries |> Map.map (fun _ bytes -> hash bytes) }
+
+    if File.Exists path then
+      File.Delete path
+
+    use archive = ZipFile.Open(path, ZipArchiveMode.Create)
+
+    let add name (bytes: byte array) =
+      use stream = archive.CreateEntry(name).Open()
+      stream.Write(bytes, 0, bytes.Length)
+
+    JsonSerializer.SerializeToUtf8Bytes(manifest, jsonOptions)
+    |> add ManifestEntry
+
+    for KeyValue(name, bytes) in entries do
+      add name bytes
+
+    manifest
+
+  /// <summary>
+  /// Reads a snapshot, checking every file against the hash it was
+  /// recorded with.
+  /// </summary>
+  /// <param name="path">Snapshot archive.</param>
+  /// <returns>
+  /// Manifest, model and the contents of the other files by name, or
+  /// SnapshotError.
+  /// </returns>
+  let read (path: string) : Result<SnapshotContents, SnapshotError> =
+    try
+      use archive = ZipFile.OpenRead path
+
+      let contents =
+        archive.Entries
+        |> Seq.map (fun entry ->
+          use stream = entry.Open()
+          use buffer = new MemoryStream()
+          stream.CopyTo buffer
+          entry.FullName, buffer.ToArray())
+        |> Map.ofSeq
+
+      let manifest =
+        match contents.TryFind ManifestEntry with
+        | None -> Error(MissingEntry ManifestEntry)
+        | Some bytes ->
+          match JsonSerializer.Deserialize<SnapshotManifest>(bytes, jsonOptions)
+            with
+          | x when isNull (box x) || isNull (box x.Files) ->
+            Error(UnreadableArchive "manifest is empty")
+          | x -> Ok x
+
+      manifest
+      |> Result.bind (fun manifest ->
+        let missing =
+          manifest.Files
+          |> Map.tryFindKey (fun name _ -> not (contents.ContainsKey name))
+
+        let corrupt =
+          manifest.Files
+          |> Map.tryFindKey (fun name h ->
+            contents.ContainsKey name && hash contents[name] <> h)
+
+        match missing, corrupt, contents.TryFind ModelEntry with
+        | Some name, _, _ -> Error(MissingEntry name)
+        | _, Some name, _ -> Error(CorruptEntry name)
+        | _, _, None -> Error(MissingEntry ModelEntry)
+        | None, None, Some model ->
+          Model.parse Json (Encoding.UTF8.GetString model)
+          |> Result.mapError InvalidModel
+          |> Result.bind (fun m ->
+            if Provenance.modelHash m <> manifest.ModelHash then
+              Error(CorruptEntry ModelEntry)
+            else
+              let others =
+                contents
+                |> Map.filter (fun name _ ->
+                  name <> ManifestEntry && name <> ModelEntry)
+
+              Ok(manifest, m, others)))
+    with
+    | :? InvalidDataException as ex -> Error(UnreadableArchive ex.Message)
+    | :? JsonException as ex -> Error(UnreadableArchive ex.Message)
+    | :? IOException
+    | :? UnauthorizedAccessException as ex ->
+      Error(UnreadableArchive ex.Message)
+
+  /// <summary>
+  /// Compares a re-run document with the one recorded, numbers within the
+  /// tolerances of Golden and everything else exactly.
+  /// </summary>
+  /// <param name="ignored">Properties left out anywhere, e.g. the
+  /// provenance, which names the time and machine of each run.</param>
+  /// <param name="expected">Recorded document.</param>
+  /// <param name="actual">Re-run document.</param>
+  /// <returns>Differences, in document order; empty when reproduced.
+  /// </returns>
+  let compare
+    (ignored: Set<string>)
+    (expected: JsonNode)
+    (actual: JsonNode)
+    : SnapshotDifference list =
+    let text (n: JsonNode) = if isNull n then "null" else n.ToJsonString()
+
+    let number (n: JsonNode) =
+      match n with
+      | :? JsonValue as v when v.GetValueKind() = JsonValueKind.Number ->
+        Some(v.GetValue<float>())
+      | _ -> None
+
+    let differ path (e: JsonNode) (a: JsonNode option) =
+      [ { Path = path
+          Expected = text e
+          Actual = a |> Option.map text } ]
+
+    let rec walk path (e: JsonNode) (a: JsonNode) =
+      match e, a with
+      | (:? JsonObject as eo), (:? JsonObject as ao) ->
+        [ for KeyValue(key, value) in eo do
+            if not (ignored.Contains key) then
+              let inner = $"{path}.{key}"
+
+              match ao.TryGetPropertyValue key with
+              | true, found -> yield! walk inner value found
+              | _ -> yield! differ inner value None
+          for KeyValue(key, value) in ao do
+            if not (ignored.Contains key || eo.ContainsKey key) then
+              { Path = $"{path}.{key}"
+                Expected = "missing"
+                Actual = Some(text value) } ]
+      | (:? JsonArray as ea), (:? JsonArray as aa) when ea.Count = aa.Count ->
+        [ for i in 0 .. ea.Count - 1 do
+            yield! walk $"{path}[{i}]" ea[i] aa[i] ]
+      | _ ->
+        match number e, number a with
+        | Some x, Some y when
+          abs (y - x) <= Golden.Absolute + Golden.Relative * abs x
+          ->
+          []
+        | Some _, _
+        | _, Some _ -> differ path e (Some a)
+        | None, None when text e = text a -> []
+        | None, None -> differ path e (Some a)
+
+    walk "$" expected actual
+
+  /// Colour of a member by its utilisation.
+  let private colour (ratio: float option) =
+    match ratio with
+    | None -> "#9e9e9e"
+    | Some r when r <= 0.5 -> "#2e7d32"
+    | Some r when r <= 0.9 -> "#f9a825"
+    | Some r when r <= 1.0 -> "#ef6c00"
+    | Some _ -> "#c62828"
+
+  /// <summary>
+  /// Draws a model as an SVG picture, its members coloured by utilisation:
+  /// green to 0.5, amber to 0.9, orange to 1 and red beyond, and grey
+  /// where none is known.
+  /// </summary>
+  /// <remarks>
+  /// A model in the XY plane is drawn in that plane, and any other in
+  /// oblique projection, with Z receding at 45° and half scale.
+  /// </remarks>
+  /// <param name="m">Model.</param>
+  /// <param name="ratios">Greatest utilisation of each element, by ID.</param>
+  /// <returns>SVG document.</returns>
+  let render (m: Model) (ratios: Map<string, float>) : string =
+    let culture = CultureInfo.InvariantCulture
+    let recede = 0.5 * cos (Math.PI / 4.0)
+
+    let project (n: Node) =
+      n.X + recede * n.Z, n.Y + recede * n.Z
+
+    let points = m.Nodes |> Map.map (fun _ n -> project n)
+    let xs = points |> Map.toList |> List.map (snd >> fst)
+    let ys = points |> Map.toList |> List.map (snd >> snd)
+
+    let size = 800.0
+    let margin = 40.0
+
+    let left, bottom =
+      match xs, ys with
+      | [], _
+      | _, [] -> 0.0, 0.0
+      | _ -> List.min xs, List.min ys
+
+    let extent =
+      match xs, ys with
+      | [], _
+      | _, [] -> 1.0
+      | _ ->
+        max (List.max xs - left) (List.max ys - bottom)
+        |> fun e -> if e > 0.0 then e else 1.0
+
+    let scale = (size - 2.0 * margin) / extent
+
+    // Screen position, with Y upwards.
+    let screen (x, y) =
+      let u = margin + (x - left) * scale
+      let v = size - margin - (y - bottom) * scale
+      u.ToString("0.##", culture) + "," + v.ToString("0.##", culture)
+
+    let out = StringBuilder()
+
+    let line (s: string) = out.Append(s).Append('\n') |> ignore
+
+    line
+      $"<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"{size}\" \
+        height=\"{size}\" viewBox=\"0 0 {size} {size}\">"
+
+    line $"  <title>{Security.SecurityElement.Escape m.Info.Name}</title>"
+
+    for KeyValue(id, e) in m.Elements do
+      let corners = e.Nodes |> List.choose points.TryFind |> List.map screen
+      let stroke = colour (ratios.TryFind id)
+      let id = Security.SecurityElement.Escape id
+
+      match corners with
+      | [ a; b ] ->
+        line
+          $"  <polyline id=\"{id}\" points=\"{a} {b}\" stroke=\"{stroke}\" \
+            stroke-width=\"3\" fill=\"none\"/>"
+      | _ :: _ :: _ ->
+        let all = String.Join(" ", corners)
+
+        line
+          $"  <polygon id=\"{id}\" points=\"{all}\" stroke=\"{stroke}\" \
+            stroke-width=\"1\" fill=\"{stroke}\" fill-opacity=\"0.2\"/>"
+      | _ -> ()
+
+    for KeyValue(_, c) in m.Constraints do
+      match points.TryFind c.Node with
+      | Some p ->
+        let at = (screen p).Split ','
+
+        line
+          $"  <rect x=\"{at[0]}\" y=\"{at[1]}\" width=\"8\" height=\"8\" \
+            transform=\"translate(-4,-4)\" fill=\"#1565c0\"/>"
+      | None -> ()
+
+    line "</svg>"
+    out.ToString()
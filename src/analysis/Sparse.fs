@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+
+/// <summary>
+/// Square matrix in compressed sparse row (CSR) storage, holding only its
+/// nonzero entries.
+/// </summary>
+type SparseMatrix =
+  private
+    {
+      /// Offset of each row in Columns and Values, then the entry count.
+      RowStarts: int array
+      /// Column of each entry, ascending within a row.
+      Columns: int array
+      Values: float array
+    }
+
+/// <summary>
+/// Approximate inverse of a matrix applied at each conjugate gradient
+/// iteration, so that fewer iterations are needed.
+/// </summary>
+[<RequireQualifiedAccess>]
+type Preconditioner =
+  /// Inverse of the diagonal; cheapest to build and apply.
+  | Jacobi
+  /// Incomplete Cholesky factor with the sparsity of the matrix, IC(0).
+  | IncompleteCholesky
+
+/// <summary>
+/// Sparse matrix operations for large systems, e.g. the stiffness matrix
+/// of a model with thousands of nodes, whose entries are mostly zero.
+/// </summary>
+[<RequireQualifiedAccess>]
+module Sparse =
+
+  /// <summary>
+  /// Builds a matrix from (row, column, value) entries, summing duplicates,
+  /// e.g. element stiffness contributions to shared degrees of freedom.
+  /// </summary>
+  /// <param name="n">Order of the matrix.</param>
+  /// <param name="entries">Entries; zeros are not stored.</param>
+  /// <returns>Matrix in CSR storage.</returns>
+  let ofEntries (n: int) (entries: (int * int * float) seq) : SparseMatrix =
+    let rows = Array.init n (fun _ -> Collections.Generic.SortedDictionary())
+
+    for i, j, x in entries do
+      match rows[i].TryGetValue j with
+      | true, y -> rows[i][j] <- y + x
+      | _ -> rows[i][j] <- x
+
+    let kept =
+      rows
+      |> Array.map (fun row ->
+        row |> Seq.filter (fun e -> e.Value <> 0.0) |> Array.ofSeq)
+
+    let starts = Array.zeroCreate (n + 1)
+
+    for i in 0 .. n - 1 do
+      starts[i + 1] <- starts[i] + kept[i].Length
+
+    { RowStarts = starts
+      Columns = kept |> Array.collect (Array.map (fun e -> e.Key))
+      Values = kept |> Array.collect (Array.map (fun e -> e.Value)) }
+
+  /// <summary>
+  /// Stores the nonzero entries of a dense matrix.
+  /// </summary>
+  /// <param name="a">Square matrix.</param>
+  /// <returns>Matrix in CSR storage.</returns>
+  let ofMatrix (a: float[,]) : SparseMatrix =
+    let n = Array2D.length1 a
+
+    seq {
+      for i in 0 .. n - 1 do
+        for j in 0 .. n - 1 do
+          if a[i, j] <> 0.0 then
+            i, j, a[i, j]
+    }
+    |> ofEntries n
+
+  /// <summary>
+  /// Returns the number of rows of a matrix.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Order of the matrix.</returns>
+  let order (a: SparseMatrix) : int = a.RowStarts.Length - 1
+
+  /// <summary>
+  /// Returns the number of entries stored.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Number of nonzero entries.</returns>
+  let nonZeros (a: SparseMatrix) : int = a.Values.Length
+
+  /// <summary>
+  /// Returns the nonzero entries of a row.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <param name="i">Row index.</param>
+  /// <returns>Column and value of each entry, by ascending column.</returns>
+  let row (a: SparseMatrix) (i: int) : (int * float) array =
+    [| for k in a.RowStarts[i] .. a.RowStarts[i + 1] - 1 ->
+         a.Columns[k], a.Values[k] |]
+
+  /// <summary>
+  /// Returns one entry of a matrix.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <param name="i">Row index.</param>
+  /// <param name="j">Column index.</param>
+  /// <returns>Entry, zero when not stored.</returns>
+  let get (a: SparseMatrix) (i: int) (j: int) : float =
+    let start = a.RowStarts[i]
+    let count = a.RowStarts[i + 1] - start
+
+    match Array.BinarySearch(a.Columns, start, count, j) with
+    | k when k >= 0 -> a.Values[k]
+    | _ -> 0.0
+
+  /// <summary>
+  /// Expands a matrix to dense storage.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Dense matrix.</returns>
+  let toMatrix (a: SparseMatrix) : float[,] =
+    let n = order a
+    let dense = Array2D.zeroCreate n n
+
+    for i in 0 .. n - 1 do
+      for j, x in row a i do
+        dense[i, j] <- x
+
+    dense
+
+  /// <summary>
+  /// Multiplies a matrix by a vector.
+  /// </summary>
+  /// <param name="a">Matrix.</param>
+  /// <param name="x">Vector.</param>
+  /// <returns>Product a·x.</returns>
+  let multiply (a: SparseMatrix) (x: float array) : float array =
+    Array.init (order a) (fun i ->
+      let mutable sum = 0.0
+
+      for k in a.RowStarts[i] .. a.RowStarts[i + 1] - 1 do
+        sum <- sum + a.Values[k] * x[a.Columns[k]]
+
+      sum)
+
+  /// <summary>
+  /// Extracts the entries at the given rows and columns, e.g. the free
+  /// degrees of freedom of a stiffness matrix.
+  /// </summary>
+  /// <param name="indices">Row and column indices, ascending.</param>
+  /// <param name="a">Matrix.</param>
+  /// <returns>Principal submatrix.</returns>
+  let select (indices: int array) (a: SparseMatrix) : SparseMatrix =
+    let position = Array.create (order a) -1
+    indices |> Array.iteri (fun k i -> position[i] <- k)
+
+    seq {
+      for k, i in Array.indexed indices do
+        for j, x in row a i do
+          if position[j] >= 0 then
+            k, position[j], x
+    }
+    |> ofEntries indices.Length
+
+  /// Shifts of the diagonal, relative to itself, tried in turn until an
+  /// incomplete Cholesky factorisation succeeds.
+  let private shifts = [ 0.0; 1e-3; 1e-2; 1e-1; 1.0 ]
+
+  /// Lower triangular factor L of A + shift·diag(A) ≈ L·Lᵀ, keeping only
+  /// the entries of the lower triangle of A; each row ends at its diagonal.
+  let private incompleteFactor (a: SparseMatrix) (shift: float) =
+    let n = order a
+    let factor = Array.zeroCreate<(int * float) array> n
+
+    let rec build i =
+      if i = n then
+        Some factor
+      else
+        let computed = Collections.Generic.Dictionary<int, float>()
+        let entries = ResizeArray<int * float>()
+
+        // Row i of L by the columns it shares with row k, left of k.
+        let dot k =
+          let mutable sum = 0.0
+
+          for j, x in factor[k] do
+            match computed.TryGetValue j with
+            | true, y when j < k -> sum <- sum + x * y
+            | _ -> ()
+
+          sum
+
+        let mutable pivot = 0.0
+
+        for j, x in row a i do
+          if j < i then
+            let value = (x - dot j) / snd (Array.last factor[j])
+            computed[j] <- value
+            entries.Add(j, value)
+          elif j = i then
+            pivot <- x * (1.0 + shift)
+
+        let d = pivot - Seq.sumBy (fun (_, x) -> x * x) entries
+
+        if d <= 0.0 then
+          None
+        else
+          entries.Add(i, sqrt d)
+          factor[i] <- entries.ToArray()
+          build (i + 1)
+
+    build 0
+
+  /// Applies the inverse of a preconditioner to a residual.
+  let private inverse (preconditioner: Preconditioner) (a: SparseMatrix) =
+    let diagonal = Array.init (order a) (fun i -> get a i i)
+    let jacobi (r: float array) = Array.map2 (/) r diagonal
+
+    let factor =
+      match preconditioner with
+      | Preconditioner.Jacobi -> None
+      | Preconditioner.IncompleteCholesky ->
+        shifts |> List.tryPick (incompleteFactor a)
+
+    match factor with
+    | None -> jacobi
+    | Some factor ->
+      // Forward substitution with L, then back substitution with Lᵀ by
+      // columns, as L is stored by rows.
+      fun (r: float array) ->
+        let z = Array.copy r
+
+        for i in 0 .. z.Length - 1 do
+          let entries = factor[i]
+          let mutable sum = z[i]
+
+          for k in 0 .. entries.Length - 2 do
+            let j, x = entries[k]
+            sum <- sum - x * z[j]
+
+          z[i] <- sum / snd entries[entries.Length - 1]
+
+        for i in z.Length - 1 .. -1 .. 0 do
+          let entries = factor[i]
+          z[i] <- z[i] / snd entries[entries.Length - 1]
+
+          for k in 0 .. entries.Length - 2 do
+            let j, x = entries[k]
+            z[j] <- z[j] - x * z[i]
+
+        z
+
+  /// <summary>
+  /// Solves A·x = b for a symmetric positive definite matrix by
+  /// preconditioned conjugate gradients.
+  /// </summary>
+  /// <param name="preconditioner">Approximate inverse of A.</param>
+  /// <param name="tolerance">Residual norm relative to that of b.</param>
+  /// <param name="a">Symmetric positive definite matrix.</param>
+  /// <param name="b">Right-hand side.</param>
+  /// <returns>
+  /// Solution, or None when the residual does not converge within twice as
+  /// many iterations as the order of the matrix, e.g. when it is singular.
+  /// </returns>
+  /// <remarks>
+  /// The incomplete Cholesky factor keeps the sparsity of A, so memory
+  /// stays proportional to its nonzeros. Where the factorisation breaks
+  /// down, the diagonal is shifted until it succeeds, falling back to
+  /// Jacobi when no shift does.
+  /// </remarks>
+  let preconditionedConjugateGradient
+    (preconditioner: Preconditioner)
+    (tolerance: float)
+    (a: SparseMatrix)
+    (b: float array)
+    : float array option =
+    let n = order a
+    let dot (u: float array) (v: float array) =
+      Array.fold2 (fun s x y -> s + x * y) 0.0 u v
+
+    if Seq.init n (fun i -> get a i i) |> Seq.exists (fun d -> d <= 0.0) then
+      None
+    else
+      let apply = inverse preconditioner a
+      let target = tolerance * sqrt (dot b b)
+      let x = Array.zeroCreate n
+      let r = Array.copy b
+      let p = apply r
+
+      let rec iterate rz count =
+        if sqrt (dot r r) <= target then
+          Some x
+        elif count = 0 then
+          None
+        else
+          let ap = multiply a p
+          let pap = dot p ap
+
+          if pap <= 0.0 then
+            None
+          else
+            let alpha = rz / pap
+
+            for i in 0 .. n - 1 do
+              x[i] <- x[i] + alpha * p[i]
+              r[i] <- r[i] - alpha * ap[i]
+
+            let z = apply r
+            let next = dot r z
+            let beta = next / rz
+
+            for i in 0 .. n - 1 do
+              p[i] <- z[i] + beta * p[i]
+
+            iterate next (count - 1)
+
+      // Rounding delays convergence of ill-conditioned systems beyond n.
+      iterate (dot r p) (max 10 (2 * n))
+
+  /// <summary>
+  /// Solves A·x = b for a symmetric positive definite matrix by conjugate
+  /// gradients with a Jacobi (diagonal) preconditioner.
+  /// </summary>
+  /// <param name="tolerance">Residual norm relative to that of b.</param>
+  /// <param name="a">Symmetric positive definite matrix.</param>
+  /// <param name="b">Right-hand side.</param>
+  /// <returns>Solution, or None when it does not converge.</returns>
+  let conjugateGradient
+    (tolerance: float)
+    (a: SparseMatrix)
+    (b: float array)
+    : float array option =
+    preconditionedConjugateGradient Preconditioner.Jacobi tolerance a b
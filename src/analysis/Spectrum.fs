@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Globalization
+open System.IO
+open Gazelle.Model
+
+/// <summary>
+/// Design response spectrum: peak acceleration of a damped oscillator
+/// against its natural period.
+/// </summary>
+type ResponseSpectrum =
+  {
+    /// Periods in seconds, in ascending order.
+    Periods: float list
+    /// Spectral acceleration at each period, in model units.
+    Accelerations: float list
+  }
+
+/// <summary>
+/// Rule combining the peak responses of modes that do not peak together.
+/// </summary>
+[<RequireQualifiedAccess>]
+type ModalCombination =
+  /// Square root of the sum of squares; for well-separated frequencies.
+  | Srss
+  /// Complete quadratic combination, correlating modes of close frequency.
+  | Cqc
+
+/// <summary>
+/// Peak response of one mode to a response spectrum.
+/// </summary>
+type ModalResponse =
+  { Mode: Mode
+    /// Natural period in seconds.
+    Period: float
+    DampingRatio: float
+    /// Spectral acceleration at the mode's period.
+    Acceleration: float
+    /// Modal participation factor Γ = φᵀ·M·r along the direction.
+    Participation: float
+    /// Effective modal mass Γ².
+    EffectiveMass: float }
+
+/// <summary>
+/// Peak response of a model to a response spectrum along one direction.
+/// </summary>
+type SpectrumResult =
+  {
+    /// Node and degree of freedom of each combined displacement.
+    Dofs: (string * Dof) array
+    Modes: ModalResponse list
+    /// Mass free to move along the direction.
+    Mass: float
+    /// Combined peak displacement of each degree of freedom.
+    Displacements: float array
+    /// Combined peak base shear.
+    BaseShear: float
+  }
+
+/// <summary>
+/// Errors raised whilst reading a spectrum or computing the response.
+/// </summary>
+type SpectrumError =
+  | UnreadableSpectrum of reason: string
+  | MalformedSpectrum of line: int * reason: string
+  | InvalidExcitation of direction: Dof
+  | FailedSpectrumSystem of StaticError
+  | FailedSpectrumModes of ModalError
+
+[<RequireQualifiedAccess>]
+module ModalCombination =
+
+  let getAsString (c: ModalCombination) : string =
+    match c with
+    | ModalCombination.Srss -> "srss"
+    | ModalCombination.Cqc -> "cqc"
+
+  /// <summary>
+  /// Parses a combination rule name, e.g. from --combine.
+  /// </summary>
+  /// <param name="text">Rule name, case-insensitive.</param>
+  /// <returns>Matching rule, if any.</returns>
+  let tryParse (text: string) : ModalCombination option =
+    match text.Trim().ToLowerInvariant() with
+    | "srss" -> Some ModalCombination.Srss
+    | "cqc" -> Some ModalCombination.Cqc
+    | _ -> None
+
+[<RequireQualifiedAccess>]
+module SpectrumError =
+
+  let getAsString (e: SpectrumError) : string =
+    match e with
+    | UnreadableSpectrum reason -> $"Unreadable Spectrum: {reason}."
+    | MalformedSpectrum(line, reason) ->
+      $"Malformed Spectrum: line {line} {reason}."
+    | InvalidExcitation dof ->
+      $"Excitation along {Dof.getAsString dof} must be a translation."
+    | FailedSpectrumSystem e -> StaticError.getAsString e
+    | FailedSpectrumModes e -> ModalError.getAsString e
+
+/// <summary>
+/// Response spectrum analysis: the peak response of each mode to a design
+/// spectrum along one direction, combined over the modes.
+/// </summary>
+/// <remarks>
+/// Each mode of a modal analysis responds with peak displacement
+/// φ·Γ·Sa(T)/ω², where Γ is its participation factor and Sa the spectral
+/// acceleration at its period. Peaks are combined by SRSS, or by CQC with
+/// the correlation coefficients of Der Kiureghian, which account for modes
+/// of close frequency. Each mode is damped at its ratio from the model's
+/// damping. The spectrum is held constant beyond its first and last
+/// periods.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Spectrum =
+
+  /// <summary>
+  /// Parses a spectrum from text with one period and acceleration per line,
+  /// separated by a comma, tab or spaces. Blank lines, lines starting with
+  /// '#' and a header line are skipped.
+  /// </summary>
+  /// <param name="text">Spectrum text, e.g. CSV.</param>
+  /// <returns>Spectrum, or MalformedSpectrum.</returns>
+  let parse (text: string) : Result<ResponseSpectrum, SpectrumError> =
+    let culture = CultureInfo.InvariantCulture
+    let styles = NumberStyles.Float
+    let separators = [| ','; ';'; '\t'; ' ' |]
+    let options = StringSplitOptions.RemoveEmptyEntries
+
+    let number (s: string) =
+      match Double.TryParse(s, styles, culture) with
+      | true, x -> Some x
+      | _ -> None
+
+    let lines =
+      text.Split('\n')
+      |> Array.mapi (fun i line -> i + 1, line.Trim())
+      |> Array.filter (fun (_, line) -> line <> "" && not (line.StartsWith '#'))
+      |> List.ofArray
+
+    let fields (text: string) = text.Split(separators, options)
+
+    let point (line, text) =
+      match fields text |> Array.map number with
+      | [| Some t; Some sa |] when t >= 0.0 -> Ok(t, sa)
+      | [| Some t; Some _ |] ->
+        Error(MalformedSpectrum(line, $"has negative period {t}"))
+      | _ -> Error(MalformedSpectrum(line, "needs a period and acceleration"))
+
+    let isHeader text =
+      fields text |> Array.forall (number >> Option.isNone)
+
+    let rows =
+      match lines with
+      | (_, first) :: rest when isHeader first -> rest
+      | all -> all
+
+    let points =
+      List.foldBack
+        (fun row acc ->
+          match point row, acc with
+          | Ok p, Ok rest -> Ok(p :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        rows
+        (Ok [])
+
+    match points with
+    | Error e -> Error e
+    | Ok [] -> Error(MalformedSpectrum(0, "has no points"))
+    | Ok points ->
+      let descending =
+        List.zip rows points
+        |> List.pairwise
+        |> List.tryFind (fun ((_, (t0, _)), (_, (t1, _))) -> t1 <= t0)
+
+      match descending with
+      | Some(_, ((line, _), _)) ->
+        Error(MalformedSpectrum(line, "period must exceed the one before"))
+      | None ->
+        Ok
+          { Periods = points |> List.map fst
+            Accelerations = points |> List.map snd }
+
+  /// <summary>
+  /// Reads a spectrum file.
+  /// </summary>
+  /// <param name="path">Path to spectrum file.</param>
+  /// <returns>Spectrum, or SpectrumError.</returns>
+  let read (path: string) : Result<ResponseSpectrum, SpectrumError> =
+    try
+      File.ReadAllText path |> parse
+    with
+    | :? IOException
+    | :? UnauthorizedAccessException as ex ->
+      Error(UnreadableSpectrum ex.Message)
+
+  /// <summary>
+  /// Returns the spectral acceleration at a period, interpolating linearly.
+  /// </summary>
+  /// <param name="s">Spectrum.</param>
+  /// <param name="period">Period in seconds.</param>
+  /// <returns>Spectral acceleration.</returns>
+  let acceleration (s: ResponseSpectrum) (period: float) : float =
+    let points = List.zip s.Periods s.Accelerations
+
+    match points with
+    | [] -> 0.0
+    | (t0, a0) :: _ when period <= t0 -> a0
+    | _ ->
+      points
+      |> List.pairwise
+      |> List.tryFind (fun ((_, _), (t1, _)) -> period <= t1)
+      |> Option.map (fun ((t0, a0), (t1, a1)) ->
+        a0 + (a1 - a0) * (period - t0) / (t1 - t0))
+      |> Option.defaultValue (List.last points |> snd)
+
+  /// <summary>
+  /// Returns the CQC correlation coefficient of two modes.
+  /// </summary>
+  /// <param name="zeta1">Damping ratio of the first mode.</param>
+  /// <param name="zeta2">Damping ratio of the second mode.</param>
+  /// <param name="omega1">Circular frequency of the first mode.</param>
+  /// <param name="omega2">Circular frequency of the second mode.</param>
+  /// <returns>Correlation in [0, 1]; 1 for a mode with itself.</returns>
+  let correlation
+    (zeta1: float)
+    (zeta2: float)
+    (omega1: float)
+    (omega2: float)
+    : float =
+    let r = omega2 / omega1
+
+    let numerator =
+      8.0 * sqrt (zeta1 * zeta2) * (zeta1 + r * zeta2) * r ** 1.5
+
+    let denominator =
+      (1.0 - r * r) ** 2.0
+      + 4.0 * zeta1 * zeta2 * r * (1.0 + r * r)
+      + 4.0 * (zeta1 * zeta1 + zeta2 * zeta2) * r * r
+
+    if denominator > 0.0 then numerator / denominator else 1.0
+
+  /// <summary>
+  /// Combines the peak values of a response over the modes.
+  /// </summary>
+  /// <param name="rule">Combination rule.</param>
+  /// <param name="modes">Damping ratio and frequency of each mode.</param>
+  /// <param name="peaks">Peak value of the response in each mode.</param>
+  /// <returns>Combined peak value, never negative.</returns>
+  let combine
+    (rule: ModalCombination)
+    (modes: (float * float) list)
+    (peaks: float list)
+    : float =
+    match rule with
+    | ModalCombination.Srss -> peaks |> List.sumBy (fun x -> x * x) |> sqrt
+    | ModalCombination.Cqc ->
+      let terms = List.zip modes peaks
+
+      [ for (z1, w1), x1 in terms do
+          for (z2, w2), x2 in terms -> correlation z1 z2 w1 w2 * x1 * x2 ]
+      |> List.sum
+      |> max 0.0
+      |> sqrt
+
+  /// <summary>
+  /// Computes the peak response of a model to a spectrum along a direction.
+  /// </summary>
+  /// <param name="rule">Modal combination rule.</param>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="count">Number of modes to combine.</param>
+  /// <param name="direction">Direction of excitation: Ux, Uy or Uz.</param>
+  /// <param name="s">Response spectrum.</param>
+  /// <param name="m">Valid model whose members have density and area.</param>
+  /// <returns>Combined response, or SpectrumError.</returns>
+  let analyse
+    (rule: ModalCombination)
+    (kind: MassMatrix)
+    (count: int)
+    (direction: Dof)
+    (s: ResponseSpectrum)
+    (m: Model)
+    : Result<SpectrumResult, SpectrumError> =
+    let assembled =
+      Static.assemble m
+      |> Result.bind (fun a ->
+        Static.assembleMass kind m a |> Result.map (fun mass -> a, mass))
+      |> Result.mapError FailedSpectrumSystem
+
+    match assembled with
+    | _ when not (List.contains direction [ Ux; Uy; Uz ]) ->
+      Error(InvalidExcitation direction)
+    | Error e -> Error e
+    | Ok(a, mass) ->
+      let free = Static.free a
+      let mff = Sparse.select free mass
+
+      let influence =
+        free
+        |> Array.map (fun i -> if snd a.Dofs[i] = direction then 1.0 else 0.0)
+
+      let mr = Sparse.multiply mff influence
+      let dot u v = Array.fold2 (fun acc x y -> acc + x * y) 0.0 u v
+
+      let respond (mode: Mode) =
+        let u = Array.zeroCreate a.Dofs.Length
+        mode.Shape |> Array.iteri (fun j x -> u[free[j]] <- x)
+
+        Static.strainEnergies m a u
+        |> Result.mapError FailedSpectrumSystem
+        |> Result.map (fun energies ->
+          let period = 2.0 * Math.PI / mode.AngularFrequency
+          let gamma = dot mode.Shape mr
+
+          { Mode = mode
+            Period = period
+            DampingRatio = Damping.ratio m mode.Number energies
+            Acceleration = acceleration s period
+            Participation = gamma
+            EffectiveMass = gamma * gamma })
+
+      Modal.lowestModes count (Sparse.select free a.Stiffness) mff
+      |> Result.mapError FailedSpectrumModes
+      |> Result.bind (fun modes ->
+        List.foldBack
+          (fun mode acc ->
+            match respond mode, acc with
+            | Ok r, Ok rest -> Ok(r :: rest)
+            | Error e, _
+            | _, Error e -> Error e)
+          modes
+          (Ok []))
+      |> Result.map (fun responses ->
+        let modes =
+          responses
+          |> List.map (fun r -> r.DampingRatio, r.Mode.AngularFrequency)
+
+        // Peak displacement of each mode, scaled from its shape.
+        let scales =
+          responses
+          |> List.map (fun r ->
+            r.Participation * r.Acceleration / r.Mode.AngularFrequency ** 2.0)
+
+        let displacement j =
+          List.map2
+            (fun (r: ModalResponse) x -> r.Mode.Shape[j] * x)
+            responses
+            scales
+          |> combine rule modes
+
+        { Dofs = free |> Array.map (fun i -> a.Dofs[i])
+          Modes = responses
+          Mass = dot influence mr
+          Displacements = Array.init free.Length displacement
+          BaseShear =
+            responses
+            |> List.map (fun r -> r.EffectiveMass * r.Acceleration)
+            |> combine rule modes })
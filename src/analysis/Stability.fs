@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Elastic buckling mode of a model under a load set.
+/// </summary>
+type BucklingMode =
+  { Number: int
+    /// Factor on the load set at which the model buckles in this mode.
+    LoadFactor: float
+    /// Displacement of each degree of freedom, scaled so that the largest
+    /// translation is one.
+    Shape: float array }
+
+/// <summary>
+/// Elastic buckling modes of a model.
+/// </summary>
+type StabilityResult =
+  {
+    /// Node and degree of freedom of each entry of a mode shape.
+    Dofs: (string * Dof) array
+    /// Modes in order of increasing load factor.
+    Modes: BucklingMode list
+  }
+
+/// <summary>
+/// Errors raised whilst computing buckling modes.
+/// </summary>
+type StabilityError =
+  | FailedReference of StaticError
+  | Unbuckled
+  | UnconvergedBuckling of iterations: int
+  | MissingMode of number: int
+  | FailedImperfection of ImperfectionError
+
+[<RequireQualifiedAccess>]
+module StabilityError =
+
+  let getAsString (e: StabilityError) : string =
+    match e with
+    | FailedReference e -> StaticError.getAsString e
+    | Unbuckled -> "No member is in compression, so the model cannot buckle."
+    | UnconvergedBuckling iterations ->
+      $"Buckling modes did not converge within {iterations} iterations."
+    | MissingMode number -> $"The model has no buckling mode {number}."
+    | FailedImperfection e -> ImperfectionError.getAsString e
+
+/// <summary>
+/// Linear buckling analysis: elastic critical load factors and mode shapes
+/// from the eigenproblem K·φ = λ·(−K_G)·φ over the free degrees of
+/// freedom.
+/// </summary>
+/// <remarks>
+/// The geometric stiffness K_G follows from the axial forces of a linear
+/// static analysis under the load set, so λ is the factor on the whole set
+/// at which the model buckles. The lowest positive λ are found by the
+/// subspace iteration of Modal with −K_G in place of the mass matrix;
+/// members in tension stiffen the model and give no mode.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Stability =
+
+  /// <summary>
+  /// Computes the lowest buckling modes of a model under a load set.
+  /// </summary>
+  /// <param name="count">Number of modes sought.</param>
+  /// <param name="m">Valid model.</param>
+  /// <param name="set">Load set whose factor is sought.</param>
+  /// <returns>Modes in order of load factor, or StabilityError.</returns>
+  let analyse
+    (count: int)
+    (m: Model)
+    (set: LoadSet)
+    : Result<StabilityResult, StabilityError> =
+    NodalLoads.ofLoadSet m set
+    |> Result.mapError FailedLoads
+    |> Result.bind (fun loads ->
+      Static.assemble m
+      |> Result.bind (fun a ->
+        Static.solveWith LinearSolver.defaultSolver m a loads
+        |> Result.map Static.axialForces
+        |> Result.bind (Static.geometricStiffness m a)
+        |> Result.map (fun kg -> a, kg)))
+    |> Result.mapError FailedReference
+    |> Result.bind (fun (a, kg) ->
+      let free = Static.free a
+      let kg = Sparse.select free kg
+      let n = Sparse.order kg
+
+      let softening =
+        seq {
+          for i in 0 .. n - 1 do
+            for j, x in Sparse.row kg i -> i, j, -x
+        }
+        |> Sparse.ofEntries n
+
+      Modal.lowestModes count (Sparse.select free a.Stiffness) softening
+      |> Result.mapError (function
+        | FailedAssembly e -> FailedReference e
+        | Massless -> Unbuckled
+        | UnconvergedModes iterations -> UnconvergedBuckling iterations)
+      |> Result.bind (fun modes ->
+        let dofs = free |> Array.map (fun i -> a.Dofs[i])
+
+        let translation (mode: Mode) =
+          mode.Shape
+          |> Array.mapi (fun i x ->
+            match snd dofs[i] with
+            | Ux
+            | Uy
+            | Uz -> abs x
+            | _ -> 0.0)
+          |> Array.fold max 0.0
+
+        match modes |> List.filter (fun x -> translation x > 0.0) with
+        | [] -> Error Unbuckled
+        | modes ->
+          Ok
+            { Dofs = dofs
+              Modes =
+                modes
+                |> List.mapi (fun i mode ->
+                  let peak = translation mode
+
+                  { Number = i + 1
+                    LoadFactor = mode.AngularFrequency ** 2.0
+                    Shape = mode.Shape |> Array.map (fun x -> x / peak) }) }))
+
+  /// <summary>
+  /// Returns the shape of a buckling mode by node.
+  /// </summary>
+  /// <param name="r">Buckling result the mode belongs to.</param>
+  /// <param name="mode">Mode.</param>
+  /// <returns>Displacement of each free degree of freedom, by node.</returns>
+  let shape
+    (r: StabilityResult)
+    (mode: BucklingMode)
+    : Map<string, Map<Dof, float>> =
+    mode.Shape
+    |> Array.mapi (fun i x -> r.Dofs[i], x)
+    |> Array.groupBy (fst >> fst)
+    |> Array.map (fun (node, xs) ->
+      node, xs |> Array.map (fun ((_, dof), x) -> dof, x) |> Map.ofArray)
+    |> Map.ofArray
+
+  /// <summary>
+  /// Applies an imperfection to a model, finding the buckling mode shape of
+  /// a mode imperfection under the load set.
+  /// </summary>
+  /// <param name="set">Load set the imperfect model is analysed for.</param>
+  /// <param name="i">Imperfection.</param>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Imperfect model, or StabilityError.</returns>
+  let imperfect
+    (set: LoadSet)
+    (i: Imperfection)
+    (m: Model)
+    : Result<Model, StabilityError> =
+    match i with
+    | Eigenmode(number, amplitude) ->
+      analyse number m set
+      |> Result.bind (fun r ->
+        match List.tryItem (number - 1) r.Modes with
+        | Some mode -> Ok(shape r mode)
+        | None -> Error(MissingMode number))
+      |> Result.bind (fun shape ->
+        Imperfections.applyShape amplitude shape m
+        |> Result.mapError FailedImperfection)
+    | _ -> Imperfections.apply i m |> Result.mapError FailedImperfection
@@ -0,0 +1,1383 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open System.Collections.Generic
+open System.Globalization
+open System.Text
+open Gazelle.Model
+
+/// <summary>
+/// Value of a script run by gz run.
+/// </summary>
+[<NoEquality; NoComparison>]
+type ScriptValue =
+  | NoneValue
+  | BoolValue of bool
+  | IntValue of int64
+  | FloatValue of float
+  | StringValue of string
+  | ListValue of ScriptValue list
+  /// Entries in the order they were first added.
+  | DictValue of (ScriptValue * ScriptValue) list
+  | FunctionValue of name: string * call: (ScriptValue list -> ScriptValue)
+  | ModelValue of Model
+  | ResultValue of StaticResult
+
+/// <summary>
+/// Errors that stop a script, at the line they arose on.
+/// </summary>
+type ScriptError =
+  | SyntaxError of line: int * reason: string
+  | RuntimeError of line: int * reason: string
+
+[<RequireQualifiedAccess>]
+module ScriptError =
+
+  let getAsString (e: ScriptError) : string =
+    match e with
+    | SyntaxError(line, reason) -> $"Syntax error on line {line}: {reason}."
+    | RuntimeError(line, reason) -> $"Error on line {line}: {reason}"
+
+/// Defect in the text of a script.
+type private SyntaxException(line: int, reason: string) =
+  inherit Exception(reason)
+  member _.Line = line
+
+/// Failure of a statement of a script.
+type private RuntimeException(line: int, reason: string) =
+  inherit Exception(reason)
+  member _.Line = line
+
+type private Token =
+  | Identifier of string
+  | IntToken of int64
+  | FloatToken of float
+  | Text of string
+  | Symbol of string
+  | Newline
+  | Indent
+  | Dedent
+  | EndOfInput
+
+[<NoEquality; NoComparison>]
+type private Expr =
+  | Constant of ScriptValue
+  | Name of string
+  | ListOf of Expr list
+  | DictOf of (Expr * Expr) list
+  | Comprehension of Expr * names: string list * items: Expr * Expr option
+  | Subscript of Expr * Expr
+  | Attribute of Expr * string
+  | Call of Expr * Expr list
+  | Unary of string * Expr
+  | Binary of string * Expr * Expr
+  | And of Expr * Expr
+  | Or of Expr * Expr
+  | Conditional of condition: Expr * whenTrue: Expr * whenFalse: Expr
+
+[<NoEquality; NoComparison>]
+type private Statement =
+  | Assign of line: int * name: string * index: Expr option * value: Expr
+  | Augment of line: int * name: string * operator: string * value: Expr
+  | Evaluate of line: int * Expr
+  | If of line: int * branches: (Expr * Statement list) list * Statement list
+  | For of line: int * names: string list * items: Expr * Statement list
+  | Def of line: int * name: string * parameters: string list * Statement list
+  | Return of line: int * Expr option
+  | Break of line: int
+  | Continue of line: int
+  | Pass
+
+/// How control leaves a statement.
+[<NoEquality; NoComparison>]
+type private Signal =
+  | Normal
+  | Returned of ScriptValue
+  | Broken
+  | Continued
+
+/// <summary>
+/// Runs scripts in a small dialect of Starlark, the Python-like language of
+/// Bazel, within the engine, so that gz run needs no SDK and works from a
+/// single-file build.
+/// </summary>
+/// <remarks>
+/// Scripts have assignment, if, for, def and return, with Python's
+/// operators, lists, dictionaries and comprehensions. Values are immutable:
+/// assigning to x[key] rebinds x to a copy with the entry replaced, and
+/// functions that change a model return a new one. The builtins wrap the
+/// Script API: model, load_model, save_model, analyse, max_displacement
+/// and check among them. A builtin that fails stops the script with its
+/// line and message.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Starlark =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  let private keywords =
+    set
+      [ "and"; "break"; "continue"; "def"; "elif"; "else"; "for"; "if"; "in"
+        "not"; "or"; "pass"; "return"; "None"; "True"; "False" ]
+
+  /// Symbols, longest first so that "**" is not read as two "*".
+  let private symbols =
+    [ "**"; "//"; "=="; "!="; "<="; ">="; "+="; "-="; "*="; "/="; "+"; "-"
+      "*"; "/"; "%"; "<"; ">"; "="; "("; ")"; "["; "]"; "{"; "}"; ","; ":"
+      "." ]
+
+  // Lexing.
+
+  let private tokenize (source: string) =
+    let tokens = ResizeArray<Token * int>()
+    let n = source.Length
+    let at k = if k < n then source[k] else '\000'
+    let mutable indents = [ 0 ]
+    let mutable line = 1
+    let mutable i = 0
+    let mutable depth = 0
+    let mutable lineStart = true
+
+    while i < n do
+      let c = source[i]
+
+      if lineStart && depth = 0 then
+        // Indentation opens or closes blocks on lines with a statement.
+        let mutable width = 0
+
+        while i < n && (source[i] = ' ' || source[i] = '\t') do
+          width <- if source[i] = '\t' then width + 8 - width % 8 else width + 1
+          i <- i + 1
+
+        match at i with
+        | _ when i >= n -> ()
+        | '#' ->
+          while i < n && source[i] <> '\n' do
+            i <- i + 1
+        | '\r' -> i <- i + 1
+        | '\n' ->
+          line <- line + 1
+          i <- i + 1
+        | _ ->
+          lineStart <- false
+
+          if width > List.head indents then
+            indents <- width :: indents
+            tokens.Add(Indent, line)
+          else
+            while width < List.head indents do
+              indents <- List.tail indents
+              tokens.Add(Dedent, line)
+
+            if width <> List.head indents then
+              let reason = "unindent does not match any outer level"
+              raise (SyntaxException(line, reason))
+      elif c = '\n' then
+        // Lines join within brackets, as in Python.
+        if depth = 0 then
+          tokens.Add(Newline, line)
+          lineStart <- true
+
+        line <- line + 1
+        i <- i + 1
+      elif c = ' ' || c = '\t' || c = '\r' then
+        i <- i + 1
+      elif c = '#' then
+        while i < n && source[i] <> '\n' do
+          i <- i + 1
+      elif c = '\\' && at (i + 1) = '\n' then
+        line <- line + 1
+        i <- i + 2
+      elif Char.IsDigit c || (c = '.' && Char.IsDigit(at (i + 1))) then
+        let start = i
+
+        let exponent k =
+          (source[k] = '+' || source[k] = '-')
+          && (source[k - 1] = 'e' || source[k - 1] = 'E')
+
+        while i < n
+              && (Char.IsLetterOrDigit(source[i])
+                  || source[i] = '.'
+                  || exponent i) do
+          i <- i + 1
+
+        let text = source.Substring(start, i - start)
+
+        match Int64.TryParse(text, NumberStyles.None, culture) with
+        | true, x -> tokens.Add(IntToken x, line)
+        | _ ->
+          match Double.TryParse(text, NumberStyles.Float, culture) with
+          | true, x -> tokens.Add(FloatToken x, line)
+          | _ -> raise (SyntaxException(line, $"invalid number '{text}'"))
+      elif Char.IsLetter c || c = '_' then
+        let start = i
+
+        while i < n && (Char.IsLetterOrDigit(source[i]) || source[i] = '_') do
+          i <- i + 1
+
+        tokens.Add(Identifier(source.Substring(start, i - start)), line)
+      elif c = '"' || c = '\'' then
+        let text = StringBuilder()
+        i <- i + 1
+
+        while i < n && source[i] <> c && source[i] <> '\n' do
+          if source[i] = '\\' && i + 1 < n then
+            match source[i + 1] with
+            | 'n' -> text.Append '\n' |> ignore
+            | 't' -> text.Append '\t' |> ignore
+            | x -> text.Append x |> ignore
+
+            i <- i + 2
+          else
+            text.Append(source[i]) |> ignore
+            i <- i + 1
+
+        if at i <> c then
+          raise (SyntaxException(line, "unterminated string"))
+
+        i <- i + 1
+        tokens.Add(Text(text.ToString()), line)
+      else
+        let here = i
+
+        let symbol =
+          symbols
+          |> List.tryFind (fun s ->
+            String.CompareOrdinal(source, here, s, 0, s.Length) = 0)
+
+        match symbol with
+        | Some s ->
+          match s with
+          | "("
+          | "["
+          | "{" -> depth <- depth + 1
+          | ")"
+          | "]"
+          | "}" -> depth <- max 0 (depth - 1)
+          | _ -> ()
+
+          tokens.Add(Symbol s, line)
+          i <- i + s.Length
+        | None -> raise (SyntaxException(line, $"unexpected character '{c}'"))
+
+    if not lineStart then
+      tokens.Add(Newline, line)
+
+    for _ in 1 .. indents.Length - 1 do
+      tokens.Add(Dedent, line)
+
+    tokens.Add(EndOfInput, line)
+    tokens.ToArray()
+
+  // Parsing.
+
+  let private describe (t: Token) =
+    match t with
+    | Identifier x -> $"'{x}'"
+    | IntToken x -> string x
+    | FloatToken x -> x.ToString culture
+    | Text _ -> "a string"
+    | Symbol s -> $"'{s}'"
+    | Newline -> "the end of the line"
+    | Indent -> "an indent"
+    | Dedent -> "an unindent"
+    | EndOfInput -> "the end of the script"
+
+  let private parse (tokens: (Token * int) array) =
+    let position = ref 0
+    let last = tokens.Length - 1
+    let peek () = fst (tokens[position.Value])
+    let next () = fst (tokens[min (position.Value + 1) last])
+    let line () = snd (tokens[position.Value])
+    let advance () = position.Value <- min (position.Value + 1) last
+    let fail reason = raise (SyntaxException(line (), reason))
+
+    let isSymbol s =
+      match peek () with
+      | Symbol x -> x = s
+      | _ -> false
+
+    let isKeyword k =
+      match peek () with
+      | Identifier x -> x = k
+      | _ -> false
+
+    let expect s =
+      if isSymbol s then
+        advance ()
+      else
+        fail $"expected '{s}' but found {describe (peek ())}"
+
+    let expectKeyword k =
+      if isKeyword k then
+        advance ()
+      else
+        fail $"expected '{k}' but found {describe (peek ())}"
+
+    let name () =
+      match peek () with
+      | Identifier x when not (keywords.Contains x) ->
+        advance ()
+        x
+      | t -> fail $"expected a name but found {describe t}"
+
+    /// Items separated by commas up to a closing symbol, which may follow
+    /// a trailing comma.
+    let separated closing item =
+      let rec go acc =
+        if isSymbol closing then
+          advance ()
+          List.rev acc
+        else
+          let x = item ()
+
+          if isSymbol "," then
+            advance ()
+            go (x :: acc)
+          else
+            expect closing
+            List.rev (x :: acc)
+
+      go []
+
+    let rec expression () =
+      let value = disjunction ()
+
+      if isKeyword "if" then
+        advance ()
+        let condition = disjunction ()
+        expectKeyword "else"
+        Conditional(condition, value, expression ())
+      else
+        value
+
+    and disjunction () =
+      let rec go left =
+        if isKeyword "or" then
+          advance ()
+          go (Or(left, conjunction ()))
+        else
+          left
+
+      go (conjunction ())
+
+    and conjunction () =
+      let rec go left =
+        if isKeyword "and" then
+          advance ()
+          go (And(left, negation ()))
+        else
+          left
+
+      go (negation ())
+
+    and negation () =
+      if isKeyword "not" then
+        advance ()
+        Unary("not", negation ())
+      else
+        comparison ()
+
+    and comparison () =
+      let rec go left =
+        match peek () with
+        | Symbol("==" | "!=" | "<" | "<=" | ">" | ">=" as op) ->
+          advance ()
+          go (Binary(op, left, sum ()))
+        | Identifier "in" ->
+          advance ()
+          go (Binary("in", left, sum ()))
+        | Identifier "not" when next () = Identifier "in" ->
+          advance ()
+          advance ()
+          go (Unary("not", Binary("in", left, sum ())))
+        | _ -> left
+
+      go (sum ())
+
+    and sum () =
+      let rec go left =
+        match peek () with
+        | Symbol("+" | "-" as op) ->
+          advance ()
+          go (Binary(op, left, product ()))
+        | _ -> left
+
+      go (product ())
+
+    and product () =
+      let rec go left =
+        match peek () with
+        | Symbol("*" | "/" | "//" | "%" as op) ->
+          advance ()
+          go (Binary(op, left, unary ()))
+        | _ -> left
+
+      go (unary ())
+
+    and unary () =
+      match peek () with
+      | Symbol("-" | "+" as op) ->
+        advance ()
+        Unary(op, unary ())
+      | _ -> power ()
+
+    and power () =
+      let base' = postfix ()
+
+      if isSymbol "**" then
+        advance ()
+        Binary("**", base', unary ())
+      else
+        base'
+
+    and postfix () =
+      let rec go target =
+        if isSymbol "(" then
+          advance ()
+          go (Call(target, separated ")" expression))
+        elif isSymbol "[" then
+          advance ()
+          let index = expression ()
+          expect "]"
+          go (Subscript(target, index))
+        elif isSymbol "." then
+          advance ()
+          go (Attribute(target, name ()))
+        else
+          target
+
+      go (atom ())
+
+    and atom () =
+      match peek () with
+      | IntToken x ->
+        advance ()
+        Constant(IntValue x)
+      | FloatToken x ->
+        advance ()
+        Constant(FloatValue x)
+      | Text x ->
+        advance ()
+
+        // Adjacent strings join, as in Python.
+        let rec join (acc: string) =
+          match peek () with
+          | Text y ->
+            advance ()
+            join (acc + y)
+          | _ -> acc
+
+        Constant(StringValue(join x))
+      | Identifier "None" ->
+        advance ()
+        Constant NoneValue
+      | Identifier "True" ->
+        advance ()
+        Constant(BoolValue true)
+      | Identifier "False" ->
+        advance ()
+        Constant(BoolValue false)
+      | Identifier x when not (keywords.Contains x) ->
+        advance ()
+        Name x
+      | Symbol "(" ->
+        advance ()
+        let inner = expression ()
+        expect ")"
+        inner
+      | Symbol "[" ->
+        advance ()
+
+        if isSymbol "]" then
+          advance ()
+          ListOf []
+        else
+          let first = expression ()
+
+          if isKeyword "for" then
+            advance ()
+            let names = targets ()
+            expectKeyword "in"
+            let items = disjunction ()
+
+            let condition =
+              if isKeyword "if" then
+                advance ()
+                Some(disjunction ())
+              else
+                None
+
+            expect "]"
+            Comprehension(first, names, items, condition)
+          elif isSymbol "," then
+            advance ()
+            ListOf(first :: separated "]" expression)
+          else
+            expect "]"
+            ListOf [ first ]
+      | Symbol "{" ->
+        advance ()
+
+        let entry () =
+          let key = expression ()
+          expect ":"
+          key, expression ()
+
+        DictOf(separated "}" entry)
+      | t -> fail $"unexpected {describe t}"
+
+    /// Names bound by a for loop, e.g. "name, r".
+    and targets () =
+      let rec go acc =
+        let acc = name () :: acc
+
+        if isSymbol "," then
+          advance ()
+          go acc
+        else
+          List.rev acc
+
+      go []
+
+    let endOfLine () =
+      match peek () with
+      | Newline -> advance ()
+      | EndOfInput -> ()
+      | t -> fail $"expected the end of the line but found {describe t}"
+
+    let rec statement () : Statement =
+      let at = line ()
+
+      match peek () with
+      | Identifier "if" ->
+        advance ()
+        let condition = expression ()
+        let body = block ()
+
+        let rec branches acc =
+          if isKeyword "elif" then
+            advance ()
+            let condition = expression ()
+            let body = block ()
+            branches ((condition, body) :: acc)
+          elif isKeyword "else" then
+            advance ()
+            List.rev acc, block ()
+          else
+            List.rev acc, []
+
+        let branches, otherwise = branches [ condition, body ]
+        If(at, branches, otherwise)
+      | Identifier "for" ->
+        advance ()
+        let names = targets ()
+        expectKeyword "in"
+        let items = expression ()
+        For(at, names, items, block ())
+      | Identifier "def" ->
+        advance ()
+        let called = name ()
+        expect "("
+        let parameters = separated ")" name
+        Def(at, called, parameters, block ())
+      | _ ->
+        let s = simple at
+        endOfLine ()
+        s
+
+    and simple at =
+      match peek () with
+      | Identifier "pass" ->
+        advance ()
+        Pass
+      | Identifier "break" ->
+        advance ()
+        Break at
+      | Identifier "continue" ->
+        advance ()
+        Continue at
+      | Identifier "return" ->
+        advance ()
+
+        match peek () with
+        | Newline
+        | EndOfInput -> Return(at, None)
+        | _ -> Return(at, Some(expression ()))
+      | _ ->
+        let target = expression ()
+
+        match peek (), target with
+        | Symbol "=", Name x ->
+          advance ()
+          Assign(at, x, None, expression ())
+        | Symbol "=", Subscript(Name x, index) ->
+          advance ()
+          Assign(at, x, Some index, expression ())
+        | Symbol "=", _ -> fail "can only assign to a name or name[key]"
+        | Symbol("+=" | "-=" | "*=" | "/=" as op), Name x ->
+          advance ()
+          Augment(at, x, op.Substring(0, 1), expression ())
+        | _ -> Evaluate(at, target)
+
+    /// Statements after a colon: indented lines, or one on the same line.
+    and block () =
+      expect ":"
+
+      match peek () with
+      | Newline ->
+        advance ()
+
+        match peek () with
+        | Indent -> advance ()
+        | t -> fail $"expected an indented block but found {describe t}"
+
+        let rec go acc =
+          match peek () with
+          | Dedent ->
+            advance ()
+            List.rev acc
+          | EndOfInput -> List.rev acc
+          | _ -> go (statement () :: acc)
+
+        go []
+      | _ ->
+        let s = simple (line ())
+        endOfLine ()
+        [ s ]
+
+    let rec file acc =
+      match peek () with
+      | EndOfInput -> List.rev acc
+      | Newline ->
+        advance ()
+        file acc
+      | _ -> file (statement () :: acc)
+
+    file []
+
+  // Values.
+
+  let private typeName (v: ScriptValue) =
+    match v with
+    | NoneValue -> "NoneType"
+    | BoolValue _ -> "bool"
+    | IntValue _ -> "int"
+    | FloatValue _ -> "float"
+    | StringValue _ -> "string"
+    | ListValue _ -> "list"
+    | DictValue _ -> "dict"
+    | FunctionValue _ -> "function"
+    | ModelValue _ -> "model"
+    | ResultValue _ -> "result"
+
+  let rec private show (quoted: bool) (v: ScriptValue) =
+    match v with
+    | NoneValue -> "None"
+    | BoolValue true -> "True"
+    | BoolValue false -> "False"
+    | IntValue x -> x.ToString culture
+    | FloatValue x ->
+      let text = x.ToString culture
+
+      if text |> String.exists (fun c -> Char.IsLetter c || c = '.') then
+        text
+      else
+        text + ".0"
+    | StringValue s when quoted -> "\"" + s.Replace("\"", "\\\"") + "\""
+    | StringValue s -> s
+    | ListValue xs -> "[" + String.Join(", ", xs |> List.map (show true)) + "]"
+    | DictValue entries ->
+      let entry (k, x) = show true k + ": " + show true x
+      "{" + String.Join(", ", entries |> List.map entry) + "}"
+    | FunctionValue(name, _) -> $"<function {name}>"
+    | ModelValue m -> $"<model {m.Info.Name}>"
+    | ResultValue _ -> "<result>"
+
+  /// <summary>
+  /// Returns the text of a value as str() would, e.g. "1.5" or "[1, 2]".
+  /// </summary>
+  /// <param name="v">Value.</param>
+  /// <returns>Text of the value.</returns>
+  let toString (v: ScriptValue) : string = show false v
+
+  let private truthy (v: ScriptValue) =
+    match v with
+    | NoneValue -> false
+    | BoolValue b -> b
+    | IntValue x -> x <> 0L
+    | FloatValue x -> x <> 0.0
+    | StringValue s -> s <> ""
+    | ListValue xs -> not xs.IsEmpty
+    | DictValue entries -> not entries.IsEmpty
+    | FunctionValue _
+    | ModelValue _
+    | ResultValue _ -> true
+
+  let private number (v: ScriptValue) =
+    match v with
+    | IntValue x -> float x
+    | FloatValue x -> x
+    | BoolValue b -> if b then 1.0 else 0.0
+    | v -> failwith $"expected a number but got {typeName v}"
+
+  let private text (v: ScriptValue) =
+    match v with
+    | StringValue s -> s
+    | v -> failwith $"expected a string but got {typeName v}"
+
+  let private items (v: ScriptValue) =
+    match v with
+    | ListValue xs -> xs
+    | DictValue entries -> entries |> List.map fst
+    | StringValue s -> [ for c in s -> StringValue(string c) ]
+    | v -> failwith $"{typeName v} is not iterable"
+
+  let rec private equal (a: ScriptValue) (b: ScriptValue) =
+    match a, b with
+    | NoneValue, NoneValue -> true
+    | BoolValue x, BoolValue y -> x = y
+    | (IntValue _ | FloatValue _), (IntValue _ | FloatValue _) ->
+      number a = number b
+    | StringValue x, StringValue y -> x = y
+    | ListValue xs, ListValue ys ->
+      xs.Length = ys.Length && List.forall2 equal xs ys
+    | DictValue xs, DictValue ys ->
+      xs.Length = ys.Length
+      && xs
+         |> List.forall (fun (k, x) ->
+           ys |> List.exists (fun (j, y) -> equal k j && equal x y))
+    | ModelValue x, ModelValue y -> LanguagePrimitives.PhysicalEquality x y
+    | ResultValue x, ResultValue y -> LanguagePrimitives.PhysicalEquality x y
+    | _ -> false
+
+  let rec private compare (a: ScriptValue) (b: ScriptValue) =
+    match a, b with
+    | (IntValue _ | FloatValue _), (IntValue _ | FloatValue _) ->
+      Operators.compare (number a) (number b)
+    | StringValue x, StringValue y -> String.CompareOrdinal(x, y)
+    | BoolValue x, BoolValue y -> Operators.compare x y
+    | ListValue xs, ListValue ys ->
+      let rec go xs ys =
+        match xs, ys with
+        | [], [] -> 0
+        | [], _ -> -1
+        | _, [] -> 1
+        | x :: xs, y :: ys ->
+          match compare x y with
+          | 0 -> go xs ys
+          | c -> c
+
+      go xs ys
+    | _ -> failwith $"cannot compare {typeName a} with {typeName b}"
+
+  let private lookup (entries: (ScriptValue * ScriptValue) list) key =
+    entries |> List.tryFind (fst >> equal key) |> Option.map snd
+
+  /// Sets an entry of a dictionary or item of a list, returning a copy.
+  let private update (target: ScriptValue) (key: ScriptValue) value =
+    match target, key with
+    | DictValue entries, _ ->
+      if entries |> List.exists (fst >> equal key) then
+        entries
+        |> List.map (fun (k, x) -> if equal k key then k, value else k, x)
+        |> DictValue
+      else
+        DictValue(entries @ [ key, value ])
+    | ListValue xs, IntValue i ->
+      let i = if i < 0L then int i + xs.Length else int i
+
+      if i < 0 || i >= xs.Length then
+        failwith "list index out of range"
+
+      ListValue(List.updateAt i value xs)
+    | v, _ -> failwith $"cannot assign to an item of {typeName v}"
+
+  let private index (target: ScriptValue) (key: ScriptValue) =
+    match target, key with
+    | DictValue entries, _ ->
+      match lookup entries key with
+      | Some x -> x
+      | None -> failwith $"key {show true key} not found"
+    | ListValue xs, IntValue i ->
+      let i = if i < 0L then int i + xs.Length else int i
+
+      if i < 0 || i >= xs.Length then
+        failwith "list index out of range"
+
+      xs[i]
+    | StringValue s, IntValue i ->
+      let i = if i < 0L then int i + s.Length else int i
+
+      if i < 0 || i >= s.Length then
+        failwith "string index out of range"
+
+      StringValue(string (s[i]))
+    | v, k -> failwith $"cannot index {typeName v} by {typeName k}"
+
+  let private arithmetic (op: string) (a: ScriptValue) (b: ScriptValue) =
+    match op, a, b with
+    | "+", StringValue x, StringValue y -> StringValue(x + y)
+    | "+", ListValue xs, ListValue ys -> ListValue(xs @ ys)
+    | "*", StringValue s, IntValue k
+    | "*", IntValue k, StringValue s ->
+      StringValue(String.replicate (max 0 (int k)) s)
+    | "*", ListValue xs, IntValue k
+    | "*", IntValue k, ListValue xs ->
+      ListValue(List.replicate (max 0 (int k)) xs |> List.concat)
+    | "%", StringValue s, _ ->
+      // Each %s, %d or %g takes the next argument, or the only one.
+      let args =
+        match b with
+        | ListValue xs -> xs
+        | x -> [ x ]
+
+      let result = StringBuilder()
+      let mutable rest = args
+      let mutable i = 0
+
+      while i < s.Length do
+        if s[i] = '%' && i + 1 < s.Length then
+          match s[i + 1], rest with
+          | '%', _ -> result.Append '%' |> ignore
+          | ('s' | 'd' | 'g'), x :: tail ->
+            result.Append(show false x) |> ignore
+            rest <- tail
+          | _ -> failwith "not enough arguments for the format"
+
+          i <- i + 2
+        else
+          result.Append(s[i]) |> ignore
+          i <- i + 1
+
+      StringValue(result.ToString())
+    | _, IntValue x, IntValue y ->
+      match op with
+      | "+" -> IntValue(x + y)
+      | "-" -> IntValue(x - y)
+      | "*" -> IntValue(x * y)
+      | "/" when y = 0L -> failwith "division by zero"
+      | "/" -> FloatValue(float x / float y)
+      | "//"
+      | "%" when y = 0L -> failwith "division by zero"
+      | "//" ->
+        let q = x / y
+        IntValue(if (x % y <> 0L) && ((x < 0L) <> (y < 0L)) then q - 1L else q)
+      | "%" ->
+        let r = x % y
+        IntValue(if r <> 0L && ((r < 0L) <> (y < 0L)) then r + y else r)
+      | _ when y >= 0L ->
+        let mutable p = 1L
+
+        for _ in 1L .. y do
+          p <- p * x
+
+        IntValue p
+      | _ -> FloatValue(Math.Pow(float x, float y))
+    | _, (IntValue _ | FloatValue _), (IntValue _ | FloatValue _) ->
+      let x, y = number a, number b
+
+      match op with
+      | "+" -> FloatValue(x + y)
+      | "-" -> FloatValue(x - y)
+      | "*" -> FloatValue(x * y)
+      | "/"
+      | "//"
+      | "%" when y = 0.0 -> failwith "division by zero"
+      | "/" -> FloatValue(x / y)
+      | "//" -> FloatValue(floor (x / y))
+      | "%" -> FloatValue(x - y * floor (x / y))
+      | _ -> FloatValue(Math.Pow(x, y))
+    | _ ->
+      let types = $"{typeName a} and {typeName b}"
+      failwith $"unsupported operand types for {op}: {types}"
+
+  let private binary (op: string) (a: ScriptValue) (b: ScriptValue) =
+    match op with
+    | "==" -> BoolValue(equal a b)
+    | "!=" -> BoolValue(not (equal a b))
+    | "<" -> BoolValue(compare a b < 0)
+    | "<=" -> BoolValue(compare a b <= 0)
+    | ">" -> BoolValue(compare a b > 0)
+    | ">=" -> BoolValue(compare a b >= 0)
+    | "in" ->
+      match b with
+      | StringValue s -> BoolValue(s.Contains(text a))
+      | b -> BoolValue(items b |> List.exists (equal a))
+    | op -> arithmetic op a b
+
+  let private method (target: ScriptValue) (name: string) =
+    let call (f: ScriptValue list -> ScriptValue) = FunctionValue(name, f)
+
+    match target, name with
+    | DictValue entries, "items" ->
+      call (fun _ -> ListValue [ for k, x in entries -> ListValue [ k; x ] ])
+    | DictValue entries, "keys" ->
+      call (fun _ -> ListValue(List.map fst entries))
+    | DictValue entries, "values" ->
+      call (fun _ -> ListValue(List.map snd entries))
+    | DictValue entries, "get" ->
+      call (fun args ->
+        match args with
+        | [ key ] -> lookup entries key |> Option.defaultValue NoneValue
+        | [ key; fallback ] ->
+          lookup entries key |> Option.defaultValue fallback
+        | _ -> failwith "get takes a key and an optional default")
+    | StringValue s, "join" ->
+      call (fun args ->
+        match args with
+        | [ xs ] -> StringValue(String.Join(s, items xs |> List.map text))
+        | _ -> failwith "join takes a list of strings")
+    | StringValue s, "upper" ->
+      call (fun _ -> StringValue(s.ToUpperInvariant()))
+    | StringValue s, "lower" ->
+      call (fun _ -> StringValue(s.ToLowerInvariant()))
+    | StringValue s, "startswith" ->
+      call (fun args -> BoolValue(s.StartsWith(text (List.head args))))
+    | StringValue s, "endswith" ->
+      call (fun args -> BoolValue(s.EndsWith(text (List.head args))))
+    | StringValue s, "format" ->
+      // Each {} takes the next argument in turn.
+      call (fun args ->
+        let parts = s.Split("{}")
+
+        if parts.Length - 1 > args.Length then
+          failwith "not enough arguments for format"
+
+        let result = StringBuilder(parts[0])
+
+        for i in 1 .. parts.Length - 1 do
+          result.Append(show false (args[i - 1])).Append(parts[i]) |> ignore
+
+        StringValue(result.ToString()))
+    | v, name -> failwith $"{typeName v} has no attribute '{name}'"
+
+  // Evaluation.
+
+  let rec private evaluate (scope: Dictionary<string, ScriptValue> list) e =
+    let eval = evaluate scope
+
+    match e with
+    | Constant v -> v
+    | Name x ->
+      match scope |> List.tryFind (fun s -> s.ContainsKey x) with
+      | Some s -> s[x]
+      | None -> failwith $"name '{x}' is not defined"
+    | ListOf xs -> ListValue(List.map eval xs)
+    | DictOf entries ->
+      entries
+      |> List.fold (fun d (k, x) -> update d (eval k) (eval x)) (DictValue [])
+    | Comprehension(body, names, source, condition) ->
+      ListValue
+        [ for item in items (eval source) do
+            let local = Dictionary<string, ScriptValue>()
+            bind local names item
+            let inner = local :: scope
+
+            if condition |> Option.forall (evaluate inner >> truthy) then
+              evaluate inner body ]
+    | Subscript(target, key) -> index (eval target) (eval key)
+    | Attribute(target, name) -> method (eval target) name
+    | Call(f, args) ->
+      match eval f with
+      | FunctionValue(_, call) -> call (List.map eval args)
+      | v -> failwith $"{typeName v} is not callable"
+    | Unary("not", x) -> BoolValue(not (truthy (eval x)))
+    | Unary(op, x) ->
+      match op, eval x with
+      | "-", IntValue i -> IntValue(-i)
+      | "-", FloatValue f -> FloatValue(-f)
+      | "+", (IntValue _ | FloatValue _ as v) -> v
+      | _, v -> failwith $"bad operand type for unary {op}: {typeName v}"
+    | Binary(op, a, b) -> binary op (eval a) (eval b)
+    | And(a, b) ->
+      match eval a with
+      | x when truthy x -> eval b
+      | x -> x
+    | Or(a, b) ->
+      match eval a with
+      | x when truthy x -> x
+      | _ -> eval b
+    | Conditional(condition, whenTrue, whenFalse) ->
+      if truthy (eval condition) then eval whenTrue else eval whenFalse
+
+  /// Binds the names of a for loop to an item, unpacking it over several.
+  and private bind (local: Dictionary<string, ScriptValue>) names item =
+    match names, item with
+    | [ x ], _ -> local[x] <- item
+    | _, ListValue xs when xs.Length = names.Length ->
+      List.iter2 (fun x v -> local[x] <- v) names xs
+    | _ -> failwith $"cannot unpack {typeName item} into {names.Length} names"
+
+  /// Fails unless a function was given as many arguments as it takes.
+  let private arguments name count (args: ScriptValue list) =
+    if args.Length <> count then
+      failwith $"{name}() takes {count} arguments but {args.Length} were given"
+
+  let rec private execute (scope: Dictionary<string, ScriptValue> list) body =
+    let local = List.head scope
+
+    let rec run statements =
+      match statements with
+      | [] -> Normal
+      | s :: rest ->
+        match step s with
+        | Normal -> run rest
+        | signal -> signal
+
+    and step (s: Statement) =
+      let at =
+        match s with
+        | Assign(line, _, _, _)
+        | Augment(line, _, _, _)
+        | Evaluate(line, _)
+        | If(line, _, _)
+        | For(line, _, _, _)
+        | Def(line, _, _, _)
+        | Return(line, _)
+        | Break line
+        | Continue line -> line
+        | Pass -> 0
+
+      try
+        match s with
+        | Assign(_, name, None, value) ->
+          local[name] <- evaluate scope value
+          Normal
+        | Assign(_, name, Some key, value) ->
+          let target = evaluate scope (Name name)
+          let key = evaluate scope key
+          local[name] <- update target key (evaluate scope value)
+          Normal
+        | Augment(_, name, op, value) ->
+          let current = evaluate scope (Name name)
+          local[name] <- binary op current (evaluate scope value)
+          Normal
+        | Evaluate(_, e) ->
+          evaluate scope e |> ignore
+          Normal
+        | If(_, branches, otherwise) ->
+          let taken =
+            branches
+            |> List.tryFind (fun (condition, _) ->
+              truthy (evaluate scope condition))
+
+          match taken with
+          | Some(_, body) -> run body
+          | None -> run otherwise
+        | For(_, names, source, body) ->
+          let rec loop xs =
+            match xs with
+            | [] -> Normal
+            | x :: rest ->
+              bind local names x
+
+              match run body with
+              | Normal
+              | Continued -> loop rest
+              | Broken -> Normal
+              | returned -> returned
+
+          loop (items (evaluate scope source))
+        | Def(_, name, parameters, body) ->
+          // Functions see their own locals, then the scope they were
+          // defined in.
+          let call (args: ScriptValue list) =
+            arguments name parameters.Length args
+            let frame = Dictionary<string, ScriptValue>()
+            List.iter2 (fun p a -> frame[p] <- a) parameters args
+
+            match execute (frame :: scope) body with
+            | Returned v -> v
+            | _ -> NoneValue
+
+          local[name] <- FunctionValue(name, call)
+          Normal
+        | Return(_, None) -> Returned NoneValue
+        | Return(_, Some value) -> Returned(evaluate scope value)
+        | Break _ -> Broken
+        | Continue _ -> Continued
+        | Pass -> Normal
+      with
+      | :? RuntimeException -> reraise ()
+      | ex -> raise (RuntimeException(at, ex.Message))
+
+    run body
+
+  // Builtins.
+
+  let private function' name (f: ScriptValue list -> ScriptValue) =
+    name, FunctionValue(name, f)
+
+  let private model (v: ScriptValue) =
+    match v with
+    | ModelValue m -> m
+    | v -> failwith $"expected a model but got {typeName v}"
+
+  let private result (v: ScriptValue) =
+    match v with
+    | ResultValue r -> r
+    | v -> failwith $"expected a result but got {typeName v}"
+
+  let private dof (v: ScriptValue) =
+    match Dof.tryParse (text v) with
+    | Some d -> d
+    | None -> failwith $"unknown degree of freedom '{text v}'"
+
+  let private ofFloats (xs: float array) =
+    ListValue [ for x in xs -> FloatValue x ]
+
+  let private core =
+    [ function' "print" (fun args ->
+        Console.WriteLine(String.Join(" ", args |> List.map toString))
+        NoneValue)
+      function' "fail" (fun args ->
+        failwith (String.Join(" ", args |> List.map toString)))
+      function' "len" (fun args ->
+        match args with
+        | [ StringValue s ] -> IntValue(int64 s.Length)
+        | [ x ] -> IntValue(int64 (List.length (items x)))
+        | _ -> failwith "len() takes one argument")
+      function' "str" (fun args ->
+        arguments "str" 1 args
+        StringValue(toString (args[0])))
+      function' "int" (fun args ->
+        match args with
+        | [ StringValue s ] ->
+          match Int64.TryParse(s.Trim(), NumberStyles.Integer, culture) with
+          | true, x -> IntValue x
+          | _ -> failwith $"invalid literal for int(): '{s}'"
+        | [ x ] -> IntValue(int64 (truncate (number x)))
+        | _ -> failwith "int() takes one argument")
+      function' "float" (fun args ->
+        match args with
+        | [ StringValue s ] ->
+          match Double.TryParse(s.Trim(), NumberStyles.Float, culture) with
+          | true, x -> FloatValue x
+          | _ -> failwith $"invalid literal for float(): '{s}'"
+        | [ x ] -> FloatValue(number x)
+        | _ -> failwith "float() takes one argument")
+      function' "bool" (fun args ->
+        arguments "bool" 1 args
+        BoolValue(truthy (args[0])))
+      function' "type" (fun args ->
+        arguments "type" 1 args
+        StringValue(typeName (args[0])))
+      function' "abs" (fun args ->
+        match args with
+        | [ IntValue x ] -> IntValue(abs x)
+        | [ x ] -> FloatValue(abs (number x))
+        | _ -> failwith "abs() takes one argument")
+      function' "range" (fun args ->
+        let whole v =
+          match v with
+          | IntValue x -> x
+          | v -> failwith $"range() takes integers, not {typeName v}"
+
+        let start, stop, step =
+          match List.map whole args with
+          | [ stop ] -> 0L, stop, 1L
+          | [ start; stop ] -> start, stop, 1L
+          | [ start; stop; step ] when step <> 0L -> start, stop, step
+          | _ -> failwith "range() takes one to three arguments, step not 0"
+
+        let last = if step > 0L then stop - 1L else stop + 1L
+        ListValue [ for x in start..step..last -> IntValue x ])
+      function' "min" (fun args ->
+        let values =
+          match args with
+          | [ xs ] -> items xs
+          | xs -> xs
+
+        if values.IsEmpty then
+          failwith "min() of an empty list"
+
+        values |> List.reduce (fun a b -> if compare b a < 0 then b else a))
+      function' "max" (fun args ->
+        let values =
+          match args with
+          | [ xs ] -> items xs
+          | xs -> xs
+
+        if values.IsEmpty then
+          failwith "max() of an empty list"
+
+        values |> List.reduce (fun a b -> if compare b a > 0 then b else a))
+      function' "sum" (fun args ->
+        match args with
+        | [ xs ] -> items xs |> List.fold (arithmetic "+") (IntValue 0L)
+        | _ -> failwith "sum() takes one list")
+      function' "sorted" (fun args ->
+        match args with
+        | [ xs ] -> ListValue(items xs |> List.sortWith compare)
+        | _ -> failwith "sorted() takes one list") ]
+
+  let private gazelle =
+    [ function' "model" (fun args ->
+        arguments "model" 0 args
+        ModelValue(Script.model ()))
+      function' "load_model" (fun args ->
+        match args with
+        | [ path ] -> ModelValue(Script.load (text path))
+        | [ path; DictValue parameters ] ->
+          let overrides =
+            parameters
+            |> List.map (fun (k, v) -> text k, toString v)
+            |> Map.ofList
+
+          let options =
+            { Model.defaultReadOptions with
+                Parameters = overrides }
+
+          match Model.readWith options (text path) with
+          | Ok m -> ModelValue m
+          | Error e -> failwith (ModelError.getAsString e)
+        | _ -> failwith "load_model() takes a path and optional parameters")
+      function' "save_model" (fun args ->
+        arguments "save_model" 2 args
+        Script.save (text (args[0])) (model (args[1]))
+        NoneValue)
+      function' "nodes" (fun args ->
+        arguments "nodes" 1 args
+        let m = model (args[0])
+        ListValue [ for KeyValue(id, _) in m.Nodes -> StringValue id ])
+      function' "elements" (fun args ->
+        arguments "elements" 1 args
+        let m = model (args[0])
+        ListValue [ for KeyValue(id, _) in m.Elements -> StringValue id ])
+      function' "add_node" (fun args ->
+        let m, id, x, y, z =
+          match args with
+          | [ m; id; x; y ] -> model m, text id, number x, number y, 0.0
+          | [ m; id; x; y; z ] -> model m, text id, number x, number y, number z
+          | _ -> failwith "add_node() takes a model, id, x, y and optional z"
+
+        let n: Node = { Id = id; X = x; Y = y; Z = z }
+        ModelValue { m with Nodes = Map.add id n m.Nodes })
+      function' "add_element" (fun args ->
+        arguments "add_element" 6 args
+        let m = model (args[0])
+        let id = text (args[1])
+
+        let properties =
+          match args[5] with
+          | DictValue entries ->
+            entries |> List.map (fun (k, v) -> text k, number v) |> Map.ofList
+          | v -> failwith $"expected a dict of properties but got {typeName v}"
+
+        let e: Element =
+          { Id = id
+            Type = text (args[2])
+            Nodes = items (args[3]) |> List.map text
+            Material = text (args[4])
+            Properties = Some properties
+            Releases = None }
+
+        ModelValue { m with Elements = Map.add id e m.Elements })
+      function' "add_support" (fun args ->
+        arguments "add_support" 4 args
+        let m = model (args[0])
+        let id = text (args[1])
+
+        let c: Constraint =
+          { Id = id
+            Type = "Fixed"
+            Node = text (args[2])
+            Dof = items (args[3]) |> List.map (dof >> Dof.getAsString)
+            Angle = None
+            Stiffness = None
+            Displacement = None }
+
+        ModelValue { m with Constraints = Map.add id c m.Constraints })
+      function' "add_force" (fun args ->
+        let m, id, node, direction, magnitude, case =
+          match args with
+          | [ m; id; node; direction; magnitude ] ->
+            model m, text id, text node, text direction, number magnitude, None
+          | [ m; id; node; direction; magnitude; case ] ->
+            let case = Some(text case)
+            model m, text id, text node, text direction, number magnitude, case
+          | _ ->
+            failwith
+              "add_force() takes a model, id, node, direction, magnitude \
+               and optional case"
+
+        let l: Load =
+          { Id = id
+            Type = "Force"
+            Node = Some node
+            Element = None
+            Direction = direction
+            Magnitude = magnitude
+            Position = None
+            End = None
+            EndMagnitude = None
+            Datum = None
+            Gradient = None
+            Case = case }
+
+        ModelValue { m with Loads = Map.add id l m.Loads })
+      function' "analyse" (fun args ->
+        arguments "analyse" 1 args
+
+        DictValue
+          [ for KeyValue(name, r) in Script.analyse (model (args[0])) ->
+              StringValue name, ResultValue r ])
+      function' "max_displacement" (fun args ->
+        arguments "max_displacement" 1 args
+        FloatValue(Script.maxDisplacement (result (args[0]))))
+      function' "displacement" (fun args ->
+        arguments "displacement" 3 args
+        let r = result (args[0])
+
+        r.Displacements.TryFind(text (args[1]))
+        |> Option.bind (Map.tryFind (dof (args[2])))
+        |> Option.defaultValue 0.0
+        |> FloatValue)
+      function' "reaction" (fun args ->
+        arguments "reaction" 3 args
+        let r = result (args[0])
+
+        r.Reactions.TryFind(text (args[1]))
+        |> Option.bind (Map.tryFind (dof (args[2])))
+        |> Option.defaultValue 0.0
+        |> FloatValue)
+      function' "member_forces" (fun args ->
+        arguments "member_forces" 2 args
+        let r = result (args[0])
+
+        match r.MemberForces.TryFind(text (args[1])) with
+        | Some forces -> ofFloats forces
+        | None -> failwith $"no member forces for '{text (args[1])}'")
+      function' "check" (fun args ->
+        arguments "check" 2 args
+        Script.check (text (args[0])) (truthy (args[1]))
+        NoneValue) ]
+
+  /// <summary>
+  /// Runs a script, printing what it prints to standard output.
+  /// </summary>
+  /// <param name="source">Text of the script.</param>
+  /// <returns>
+  /// Global variables the script defined, or the ScriptError that stopped
+  /// it.
+  /// </returns>
+  let run (source: string) : Result<Map<string, ScriptValue>, ScriptError> =
+    let builtins = Dictionary<string, ScriptValue>()
+
+    for name, f in core @ gazelle do
+      builtins[name] <- f
+
+    let globals = Dictionary<string, ScriptValue>()
+
+    try
+      let statements = tokenize source |> parse
+      execute [ globals; builtins ] statements |> ignore
+      Ok(globals |> Seq.map (fun kv -> kv.Key, kv.Value) |> Map.ofSeq)
+    with
+    | :? SyntaxException as ex -> Error(SyntaxError(ex.Line, ex.Message))
+    | :? RuntimeException as ex -> Error(RuntimeError(ex.Line, ex.Message))
@@ -0,0 +1,1767 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+open Gazelle.Model
+
+/// <summary>
+/// Numbered degrees of freedom and global stiffness matrix of a model.
+/// </summary>
+type Assembly =
+  {
+    /// Node and degree of freedom of each row and column.
+    Dofs: (string * Dof) array
+    /// Whether each degree of freedom is restrained by a constraint.
+    Restrained: bool array
+    /// Displacement imposed on each restrained degree of freedom, zero but
+    /// at prescribed supports.
+    Prescribed: float array
+    Stiffness: SparseMatrix
+    /// Inclination in radians of each inclined support, by node; the Ux
+    /// and Uy of these nodes are numbered in the support's axes.
+    Angles: Map<string, float>
+    /// Slack Cable and Strut elements, left out of the stiffness.
+    Inactive: Set<string>
+  }
+
+/// <summary>
+/// Method used to solve the free degrees of freedom of an assembly.
+/// </summary>
+[<RequireQualifiedAccess>]
+type LinearSolver =
+  /// LU factorisation of the dense matrix; small models only.
+  | Dense
+  /// Cholesky factorisation in skyline storage after reordering.
+  | Skyline of Reordering
+  /// Preconditioned conjugate gradients on the sparse matrix.
+  | Pcg of Preconditioner
+
+[<RequireQualifiedAccess>]
+module LinearSolver =
+
+  let private names =
+    [ "dense", LinearSolver.Dense
+      "skyline", LinearSolver.Skyline Reordering.Automatic
+      "skyline:rcm", LinearSolver.Skyline Reordering.ReverseCuthillMcKee
+      "skyline:natural", LinearSolver.Skyline Reordering.Natural
+      "pcg", LinearSolver.Pcg Preconditioner.IncompleteCholesky
+      "pcg:jacobi", LinearSolver.Pcg Preconditioner.Jacobi
+      // Earlier name of Jacobi-preconditioned conjugate gradients.
+      "sparse", LinearSolver.Pcg Preconditioner.Jacobi ]
+
+  let getAsString (s: LinearSolver) : string =
+    names |> List.find (snd >> (=) s) |> fst
+
+  /// Name of each solver, without earlier aliases.
+  let all: string list = names |> List.distinctBy snd |> List.map fst
+
+  /// Skyline Cholesky with automatic reordering, used unless another is
+  /// chosen.
+  let defaultSolver = LinearSolver.Skyline Reordering.Automatic
+
+  /// Residual, relative to the load vector, at which conjugate gradients
+  /// stop.
+  [<Literal>]
+  let Tolerance = 1e-10
+
+  /// <summary>
+  /// Parses a solver name: "dense"; "skyline", reordered by reverse
+  /// Cuthill-McKee where that holds fewer entries, "skyline:rcm" always and
+  /// "skyline:natural" never; or "pcg" for conjugate gradients
+  /// preconditioned by incomplete Cholesky and "pcg:jacobi" by the diagonal.
+  /// </summary>
+  /// <param name="text">Solver name, in any case.</param>
+  /// <returns>Matching solver, or None.</returns>
+  let tryParse (text: string) : LinearSolver option =
+    names
+    |> List.tryFind (fun (name, _) -> name = text.Trim().ToLowerInvariant())
+    |> Option.map snd
+
+/// <summary>
+/// How element mass is distributed over the degrees of freedom.
+/// </summary>
+[<RequireQualifiedAccess>]
+type MassMatrix =
+  /// Half of each member's mass at each end, translations only.
+  | Lumped
+  /// Mass consistent with the displacement shape functions, coupling the
+  /// ends and rotations of bending members.
+  | Consistent
+
+[<RequireQualifiedAccess>]
+module MassMatrix =
+
+  let private names =
+    [ "lumped", MassMatrix.Lumped; "consistent", MassMatrix.Consistent ]
+
+  let getAsString (m: MassMatrix) : string =
+    names |> List.find (snd >> (=) m) |> fst
+
+  /// <summary>
+  /// Parses a mass matrix kind: "lumped" or "consistent".
+  /// </summary>
+  /// <param name="text">Kind, in any case.</param>
+  /// <returns>Matching kind, or None.</returns>
+  let tryParse (text: string) : MassMatrix option =
+    names
+    |> List.tryFind (fun (name, _) -> name = text.Trim().ToLowerInvariant())
+    |> Option.map snd
+
+/// <summary>
+/// Sign convention of reported support reactions.
+/// </summary>
+[<RequireQualifiedAccess>]
+type ReactionConvention =
+  /// Force the support exerts on the structure, opposing the loads.
+  | OnStructure
+  /// Force the structure exerts on the support, e.g. for foundations.
+  | OnSupport
+
+[<RequireQualifiedAccess>]
+module ReactionConvention =
+
+  let private names =
+    [ "structure", ReactionConvention.OnStructure
+      "support", ReactionConvention.OnSupport ]
+
+  let getAsString (c: ReactionConvention) : string =
+    names |> List.find (snd >> (=) c) |> fst
+
+  /// <summary>
+  /// Parses a reaction convention: "structure" or "support".
+  /// </summary>
+  /// <param name="text">Convention, in any case.</param>
+  /// <returns>Matching convention, or None.</returns>
+  let tryParse (text: string) : ReactionConvention option =
+    names
+    |> List.tryFind (fun (name, _) -> name = text.Trim().ToLowerInvariant())
+    |> Option.map snd
+
+  /// <summary>
+  /// Describes a convention in words, e.g. to accompany reported reactions.
+  /// </summary>
+  /// <param name="c">Convention.</param>
+  /// <returns>Description.</returns>
+  let describe (c: ReactionConvention) : string =
+    match c with
+    | ReactionConvention.OnStructure ->
+      "Force of each support on the structure, positive along the axes."
+    | ReactionConvention.OnSupport ->
+      "Force of the structure on each support, positive along the axes."
+
+  /// <summary>
+  /// Applies a convention to reactions given as forces on the structure.
+  /// </summary>
+  /// <param name="c">Convention.</param>
+  /// <param name="reactions">Reactions by node, e.g. of a StaticResult.</param>
+  /// <returns>Reactions by node in the convention.</returns>
+  let apply
+    (c: ReactionConvention)
+    (reactions: Map<string, Map<Dof, float>>)
+    : Map<string, Map<Dof, float>> =
+    match c with
+    | ReactionConvention.OnStructure -> reactions
+    | ReactionConvention.OnSupport ->
+      reactions |> Map.map (fun _ -> Map.map (fun _ x -> -x))
+
+/// <summary>
+/// Linear static response of a model to one load set.
+/// </summary>
+type StaticResult =
+  {
+    /// Displacement of each active degree of freedom, by node.
+    Displacements: Map<string, Map<Dof, float>>
+    /// Support reaction of each restrained degree of freedom, by node, in
+    /// global axes: the force the support exerts on the structure.
+    Reactions: Map<string, Map<Dof, float>>
+    /// Reactions of inclined supports, by node, in the support's axes.
+    LocalReactions: Map<string, Map<Dof, float>>
+    /// Forces on each member at its ends in local axes: [Fx1; Fx2] for
+    /// trusses and Cable, [Fy1; Mz1; Fy2; Mz2] for Beam2D,
+    /// [Fx1; Fy1; Mz1; Fx2; Fy2; Mz2] for Frame2D, and for each end in
+    /// turn [Fy; Fz; Mx; My; Mz] for Beam3D and [Fx; Fy; Fz; Mx; My; Mz]
+    /// for Frame3D.
+    MemberForces: Map<string, float array>
+    /// Mean stress resultants of each Plate and Shell element per unit
+    /// width in its local axes: [Nx; Ny; Nxy; Mx; My; Mxy; Qx; Qy].
+    PlateForces: Map<string, float array>
+    /// Force in each Spring element along each degree of freedom it
+    /// stiffens, positive in tension; moments for rotations.
+    SpringForces: Map<string, Map<Dof, float>>
+  }
+
+/// <summary>
+/// Errors raised whilst assembling or solving a model.
+/// </summary>
+type StaticError =
+  | UnsupportedElement of element: string * elementType: string
+  | MissingSection of element: string * property: string
+  | MissingMaterial of element: string * material: string
+  | MissingDensity of element: string * material: string
+  | MissingShearModulus of element: string * material: string
+  | MisalignedElement of element: string * reason: string
+  | ZeroLength of element: string
+  | InvalidConstraint of id: string * dof: string
+  | UnresistedLoad of node: string * dof: Dof
+  | Mechanism of dofs: (string * Dof) list
+  | IllConditioned of dofs: (string * Dof) list * ratio: float
+  | NotConverged
+  | UnsettledElements of iterations: int
+  | FailedLoads of LoadError
+
+[<RequireQualifiedAccess>]
+module StaticError =
+
+  /// Names freedoms such as "n2 Ux", the first few where there are many.
+  let private describe (dofs: (string * Dof) list) =
+    let shown = 8
+
+    let names =
+      dofs
+      |> List.truncate shown
+      |> List.map (fun (node, dof) -> $"{node} {Dof.getAsString dof}")
+      |> String.concat ", "
+
+    if dofs.Length > shown then
+      $"{names} and {dofs.Length - shown} more"
+    else
+      names
+
+  let getAsString (e: StaticError) : string =
+    match e with
+    | UnsupportedElement(element, elementType) ->
+      $"Element '{element}' has type '{elementType}' which static analysis "
+      + "does not support."
+    | MissingSection(element, property) ->
+      $"Element '{element}' needs section property '{property}'."
+    | MissingMaterial(element, material) ->
+      $"Element '{element}' uses material '{material}' which does not exist."
+    | MissingDensity(element, material) ->
+      $"Element '{element}' needs a density for material '{material}'."
+    | MissingShearModulus(element, material) ->
+      $"Element '{element}' needs a shear modulus for material '{material}'."
+    | MisalignedElement(element, reason) -> $"Element '{element}' {reason}."
+    | ZeroLength element -> $"Element '{element}' has zero length."
+    | InvalidConstraint(c, dof) ->
+      $"Constraint '{c}' restrains unknown degree of freedom '{dof}'."
+    | UnresistedLoad(node, dof) ->
+      let name = Dof.getAsString dof
+      $"Load at node '{node}' acts along {name} which nothing resists."
+    | Mechanism [] ->
+      "Structure is a mechanism; add constraints or connect its parts."
+    | Mechanism dofs ->
+      $"Structure is a mechanism, free to move along {describe dofs}; add "
+      + "constraints or connect its parts."
+    | IllConditioned(dofs, ratio) ->
+      $"Stiffness is ill-conditioned at {describe dofs}: pivots fell up to "
+      + $"{ratio:g2} times below the diagonal in factorisation; check for "
+      + "nearly unrestrained parts or extreme contrasts of stiffness."
+    | NotConverged ->
+      "Conjugate gradients did not converge; the structure may be a "
+      + "mechanism or ill-conditioned, so try another solver."
+    | UnsettledElements iterations ->
+      $"Cable and Strut elements did not settle in {iterations} iterations; "
+      + "some may alternate between slack and taut."
+    | FailedLoads e -> LoadError.getAsString e
+
+/// <summary>
+/// Linear static finite element analysis of planar and space trusses, beams
+/// and frames, Cable and Strut elements, and Plate and Shell elements.
+/// </summary>
+/// <remarks>
+/// Element stiffness matrices are assembled into a global matrix over the
+/// degrees of freedom the elements provide. Those without stiffness and
+/// load, e.g. out-of-plane translations of planar cables, are dropped; the
+/// rest are solved as chosen by LinearSolver, by default with Cholesky
+/// factorisation in skyline storage. The global matrix is held sparse, so
+/// only the dense solver forms it in full. Member
+/// loads act through their consistent nodal loads, so member end forces
+/// exclude fixed-end forces. Cable elements carry tension only and Strut
+/// elements compression only: solveWith repeats the solution, leaving out
+/// those strained the wrong way and restoring those strained the right way,
+/// until the set of slack elements settles. A Cable's "pretension" acts as
+/// a lack of fit: its taut length is short by the stretch that induces the
+/// pretension, so it pulls its ends together and carries the pretension on
+/// top of the force of its strain, going slack only once that is lost.
+/// RigidLink elements tie their other nodes to the rigid-body motion of
+/// their first by penalty stiffness, 10⁸ times the stiffest element.
+/// Thermal loads are the exception to fixed-end forces being left out:
+/// withThermal restores them, so restrained members report their thermal
+/// stresses.
+/// Released member ends are condensed out of the member stiffness, so they
+/// carry no end force along the released freedoms. Prescribed displacements
+/// of restrained freedoms, such as support settlements, are eliminated from
+/// the free equations and apply in every load set, unfactored. Models
+/// declared 2D hold the freedoms out of their plane, Uz, Rx and Ry, so
+/// cables, springs and links in the plane need no restraint out of it.
+/// Space frame members take their local y
+/// axis normal to the member and global Z, as planar frames do, or along
+/// global Y when parallel to Z; "iz" resists bending in the XY plane.
+/// Plates and shells are flat elements of 3 or 4 nodes, formulated by
+/// Shell; Plate elements lie in the XY plane and only bend.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Static =
+
+  /// Relative tolerance for alignment checks.
+  let private tolerance = 1e-9
+
+  /// Element stiffness in local axes, its local-to-global transformation
+  /// and the global degrees of freedom it acts on, with the rotation of
+  /// these into the axes of inclined supports. Plates recover their stress
+  /// resultants from local displacements; members have no rows to do so.
+  /// Released member ends are condensed out of Local but not of Fixed.
+  type private ElementStiffness =
+    { Element: Element
+      Length: float
+      Local: float[,]
+      Fixed: float[,]
+      Released: int list
+      Transform: float[,]
+      Recovery: float[,]
+      Rotation: float[,]
+      Dofs: (string * Dof) list }
+
+  /// Inclination in radians of each inclined support, by node.
+  let private inclinations (m: Model) =
+    m.Constraints
+    |> Map.toSeq
+    |> Seq.choose (fun (_, c) ->
+      match c.Angle with
+      | Some angle when angle % 360.0 <> 0.0 ->
+        Some(c.Node, angle * Math.PI / 180.0)
+      | _ -> None)
+    |> Map.ofSeq
+
+  /// Rotation from the support axes of each node to global axes over a
+  /// list of degrees of freedom; identity away from inclined supports.
+  let private rotation
+    (angles: Map<string, float>)
+    (dofs: (string * Dof) list)
+    =
+    let dofs = Array.ofList dofs
+    let n = dofs.Length
+    let r = Array2D.init n n (fun i j -> if i = j then 1.0 else 0.0)
+
+    for i in 0 .. n - 1 do
+      match dofs[i], angles.TryFind(fst dofs[i]) with
+      | (node, Ux), Some angle ->
+        match Array.tryFindIndex ((=) (node, Uy)) dofs with
+        | Some j ->
+          let c, s = cos angle, sin angle
+          r[i, i] <- c
+          r[i, j] <- -s
+          r[j, i] <- s
+          r[j, j] <- c
+        | None -> ()
+      | _ -> ()
+
+    r
+
+  /// Transformation from the element's degrees of freedom to local axes.
+  let private axes (k: ElementStiffness) =
+    Matrix.product k.Transform k.Rotation
+
+  /// Rotates a matrix over global degrees of freedom into support axes.
+  let private nodal (k: ElementStiffness) (block: float[,]) =
+    let r = k.Rotation
+    Matrix.product (Matrix.transpose r) (Matrix.product block r)
+
+  let private property (e: Element) (names: string list) =
+    let value =
+      e.Properties |> Option.bind (fun ps -> List.tryPick ps.TryFind names)
+
+    match value with
+    | Some x -> Ok x
+    | None -> Error(MissingSection(e.Id, names.Head))
+
+  let private blockDiagonal (blocks: float[,] list) =
+    let n = blocks |> List.sumBy Array2D.length1
+    let t = Array2D.zeroCreate n n
+    let mutable at = 0
+
+    for b in blocks do
+      Array2D.blit b 0 0 t at at (Array2D.length1 b) (Array2D.length2 b)
+      at <- at + Array2D.length1 b
+
+    t
+
+  /// Euler-Bernoulli bending stiffness over [v1; θ1; v2; θ2].
+  let private bending (ei: float) (l: float) =
+    let k = ei / l ** 3.0
+
+    array2D
+      [ [ 12.0; 6.0 * l; -12.0; 6.0 * l ]
+        [ 6.0 * l; 4.0 * l * l; -6.0 * l; 2.0 * l * l ]
+        [ -12.0; -6.0 * l; 12.0; -6.0 * l ]
+        [ 6.0 * l; 2.0 * l * l; -6.0 * l; 4.0 * l * l ] ]
+    |> Array2D.map ((*) k)
+
+  /// Reverses the rotations of a matrix over [w1; θ1; w2; θ2], for bending
+  /// about local y, where a positive rotation reduces w.
+  let private reversed (k: float[,]) =
+    let sign i = if i % 2 = 0 then 1.0 else -1.0
+    Array2D.init 4 4 (fun i j -> sign i * sign j * k[i, j])
+
+  /// Space frame stiffness over [u; v; w; θx; θy; θz] at either end, for
+  /// modulus e and torsional rigidity gj.
+  let private spaceFrame e area gj iy iz (l: float) =
+    let k = Array2D.zeroCreate 12 12
+    let pair x = array2D [ [ x; -x ]; [ -x; x ] ]
+    Matrix.scatter [| 0; 6 |] (pair (e * area / l)) k
+    Matrix.scatter [| 3; 9 |] (pair (gj / l)) k
+    Matrix.scatter [| 1; 5; 7; 11 |] (bending (e * iz) l) k
+    Matrix.scatter [| 2; 4; 8; 10 |] (reversed (bending (e * iy) l)) k
+    k
+
+  /// Rotation from global to member axes for a member along d.
+  let private memberAxes (d: Vector3) =
+    let x, y, z = Vector3.memberAxes d
+    array2D [ for v in [ x; y; z ] -> [ v.X; v.Y; v.Z ] ]
+
+  /// Indices of the bending and torsion freedoms of a space frame, which a
+  /// Beam3D keeps.
+  let private flexural = [| 1; 2; 3; 4; 5; 7; 8; 9; 10; 11 |]
+
+  /// Rotation from global to the axes of a flat plate, with x along its
+  /// first edge and z normal to it by the right-hand rule over its nodes,
+  /// and its corners in those axes.
+  let private plateAxes (points: Vector3 list) =
+    let p = Array.ofList points
+    let unit v = Vector3.scale (1.0 / Vector3.norm v) v
+
+    let size =
+      p |> Array.map (fun q -> Vector3.norm (Vector3.sub q p[0])) |> Array.max
+
+    let normal =
+      match p with
+      | [| a; b; c |] -> Vector3.cross (Vector3.sub b a) (Vector3.sub c a)
+      | _ -> Vector3.cross (Vector3.sub p[2] p[0]) (Vector3.sub p[3] p[1])
+
+    let edge = Vector3.sub p[1] p[0]
+
+    if Vector3.norm edge = 0.0 || Vector3.norm normal <= tolerance * size ** 2.0
+    then
+      Error "has zero area"
+    else
+      let x, z = unit edge, unit normal
+      let y = Vector3.cross z x
+      let local q = Vector3.sub q p[0] |> fun d -> Vector3.dot d x, Vector3.dot d y
+
+      let warped =
+        p
+        |> Array.exists (fun q ->
+          abs (Vector3.dot (Vector3.sub q p[0]) z) > tolerance * size)
+
+      if warped then
+        Error "must be flat"
+      else
+        Ok(
+          array2D [ for v in [ x; y; z ] -> [ v.X; v.Y; v.Z ] ],
+          [ for q in p -> local q ]
+        )
+
+  /// Indices of the bending freedoms of a shell, which a Plate keeps.
+  let private plateBending (nodes: int) =
+    Array.init nodes (fun i -> [| 6 * i + 2; 6 * i + 3; 6 * i + 4 |])
+    |> Array.concat
+
+  let private plates = set [ "Plate"; "Shell" ]
+
+  /// Members that carry tension only (Cable) or compression only (Strut).
+  let private unilateral = set [ "Cable"; "Strut" ]
+
+  /// Most solutions taken to settle which Cable and Strut elements are slack.
+  let private settlingIterations = 50
+
+  /// Whether an element is a member, reporting end forces.
+  let private isMember (e: Element) =
+    not (plates.Contains e.Type) && e.Type <> "Spring"
+
+  let private supported =
+    set
+      [ "Truss2D"
+        "Beam2D"
+        "Frame2D"
+        "Truss3D"
+        "Beam3D"
+        "Frame3D"
+        "Cable"
+        "Strut"
+        "Plate"
+        "Shell"
+        "Spring" ]
+
+  /// Applies a function to each item, stopping at the first error.
+  let private traverse (f: 'T -> Result<'U, StaticError>) (items: 'T list) =
+    let folder item acc =
+      match f item, acc with
+      | Ok x, Ok rest -> Ok(x :: rest)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder items (Ok [])
+
+  /// Members whose ends may be released.
+  let private releasable = set [ "Beam2D"; "Frame2D"; "Beam3D"; "Frame3D" ]
+
+  /// Local indices of the freedoms released at the ends of a member, whose
+  /// local freedoms at each end are those of Dof.ofElementType in order.
+  let private releases (e: Element) =
+    let dofs = Dof.ofElementType e.Type |> Option.defaultValue []
+
+    defaultArg e.Releases Map.empty
+    |> Map.toList
+    |> List.collect (fun (node, names) -> names |> List.map (fun n -> node, n))
+    |> traverse (fun (node, name) ->
+      let at = List.tryFindIndex ((=) node) e.Nodes
+
+      let index =
+        Dof.tryParse name
+        |> Option.bind (fun d -> List.tryFindIndex ((=) d) dofs)
+
+      match at, index with
+      | Some n, Some i -> Ok(n * dofs.Length + i)
+      | _ ->
+        Error(MisalignedElement(e.Id, $"cannot release '{name}' at '{node}'")))
+
+  /// Stiffness of a Spring element along each degree of freedom it
+  /// declares, from properties "ux" to "rz".
+  let private springStiffness (e: Element) =
+    let properties = Option.defaultValue Map.empty e.Properties
+
+    Dof.all
+    |> List.choose (fun d ->
+      properties.TryFind((Dof.getAsString d).ToLowerInvariant())
+      |> Option.map (fun k -> d, k))
+
+  let private stiffness (m: Model) (e: Element) =
+    let dofs =
+      match e.Type with
+      | "Spring" -> springStiffness e |> List.map fst
+      | _ -> Dof.ofElementType e.Type |> Option.defaultValue []
+      |> fun dofs ->
+        e.Nodes |> List.collect (fun n -> dofs |> List.map (fun d -> n, d))
+
+    let angles = inclinations m
+
+    // Inclined supports act in the plane of Ux and Uy.
+    let skewed =
+      e.Nodes
+      |> List.exists (fun n ->
+        angles.ContainsKey n && not (List.contains (n, Ux) dofs))
+
+    let build length local transform recovery =
+      Ok
+        { Element = e
+          Length = length
+          Local = local
+          Fixed = local
+          Released = []
+          Transform = transform
+          Recovery = recovery
+          Rotation = rotation angles dofs
+          Dofs = dofs }
+
+    match Materials.ofElement m e, e.Nodes with
+    | _ when not (supported.Contains e.Type) ->
+      Error(UnsupportedElement(e.Id, e.Type))
+    | _ when
+      not (releasable.Contains e.Type)
+      && not (Map.isEmpty (defaultArg e.Releases Map.empty))
+      ->
+      Error(MisalignedElement(e.Id, "cannot have its ends released"))
+    | _, nodes when e.Type = "Spring" ->
+      let k = springStiffness e |> List.map snd |> Array.ofList
+      let n = k.Length
+      let size = dofs.Length
+
+      // A spring to ground when it connects one node.
+      let local =
+        Array2D.init size size (fun i j ->
+          match i % n = j % n, i = j with
+          | false, _ -> 0.0
+          | true, true -> k[i % n]
+          | true, false -> -k[i % n])
+
+      let identity = Array2D.init size size (fun i j -> if i = j then 1.0 else 0.0)
+
+      match nodes.Length with
+      | 1
+      | 2 when n > 0 -> build 0.0 local identity (Array2D.zeroCreate 0 size)
+      | 1
+      | 2 -> Error(MissingSection(e.Id, "ux"))
+      | _ -> Error(MisalignedElement(e.Id, "must connect 1 or 2 nodes"))
+    | None, _ -> Error(MissingMaterial(e.Id, e.Material))
+    | Some _, nodes when
+      plates.Contains e.Type && nodes.Length <> 3 && nodes.Length <> 4
+      ->
+      Error(MisalignedElement(e.Id, "must connect 3 or 4 nodes"))
+    | Some material, nodes when plates.Contains e.Type ->
+      let points = nodes |> List.map (fun n -> Vector3.ofNode m.Nodes[n])
+      let modulus = material.ElasticModulus
+
+      match plateAxes points, property e [ "thickness"; "t" ] with
+      | _ when skewed ->
+        Error(MisalignedElement(e.Id, "cannot bear on an inclined support"))
+      | Error reason, _ -> Error(MisalignedElement(e.Id, reason))
+      | Ok(r, _), _ when e.Type = "Plate" && abs r[2, 0] + abs r[2, 1] > 1e-9 ->
+        Error(MisalignedElement(e.Id, "must lie in the XY plane"))
+      | _, Error err -> Error err
+      | Ok(r, xy), Ok t ->
+        match material.ShearModulus with
+        | None -> Error(MissingShearModulus(e.Id, e.Material))
+        | Some g ->
+          // Poisson's ratio of an isotropic material.
+          let poisson = modulus / (2.0 * g) - 1.0
+          let local = Shell.stiffness modulus poisson t xy
+          let recovery = Shell.resultants modulus poisson t xy
+          let transform = blockDiagonal (List.replicate (2 * xy.Length) r)
+
+          if e.Type = "Shell" then
+            build 0.0 local transform recovery
+          else
+            let keep = plateBending xy.Length
+
+            build
+              0.0
+              (Matrix.select keep keep local)
+              (Matrix.select keep [| 0 .. 6 * xy.Length - 1 |] transform)
+              (Matrix.select [| 0..7 |] keep recovery)
+    | Some material, [ a; b ] ->
+      let start, finish = Vector3.ofNode m.Nodes[a], Vector3.ofNode m.Nodes[b]
+      let d = Vector3.sub finish start
+      let length = Vector3.norm d
+      let c, s = d.X / length, d.Y / length
+      let planar = abs d.Z <= tolerance * length
+      let modulus = material.ElasticModulus
+
+      let element local transform =
+        let size = Array2D.length1 local
+
+        match releases e with
+        | Error err -> Error err
+        | Ok released ->
+          build length local transform (Array2D.zeroCreate 0 size)
+          |> Result.map (fun k ->
+            let condensed, _ =
+              Matrix.condense released local (Array.zeroCreate size)
+
+            { k with
+                Local = condensed
+                Released = released })
+
+      match e.Type with
+      | _ when length = 0.0 -> Error(ZeroLength e.Id)
+      | _ when skewed ->
+        Error(MisalignedElement(e.Id, "cannot bear on an inclined support"))
+      | "Truss2D"
+      | "Frame2D" when not planar ->
+        Error(MisalignedElement(e.Id, "must lie in the XY plane"))
+      | "Beam2D" when not planar || abs d.Y > tolerance * length ->
+        Error(MisalignedElement(e.Id, "must lie along X"))
+      | "Beam3D" when abs d.Y + abs d.Z > tolerance * length ->
+        Error(MisalignedElement(e.Id, "must lie along X"))
+      | "Truss2D"
+      | "Truss3D"
+      | "Cable"
+      | "Strut" ->
+        property e [ "area"; "a" ]
+        |> Result.bind (fun area ->
+          let k = modulus * area / length
+
+          let direction =
+            if e.Type = "Truss2D" then
+              [| c; s |]
+            else
+              [| c; s; d.Z / length |]
+
+          // Projects end displacements onto the member axis.
+          let n = direction.Length
+          let transform = Array2D.zeroCreate 2 (2 * n)
+
+          for i in 0 .. n - 1 do
+            transform[0, i] <- direction[i]
+            transform[1, n + i] <- direction[i]
+
+          element (array2D [ [ k; -k ]; [ -k; k ] ]) transform)
+      | "Beam2D" ->
+        property e [ "i"; "iz" ]
+        |> Result.bind (fun i ->
+          // Local y is reversed for members pointing along -X.
+          let flip = array2D [ [ c; 0.0 ]; [ 0.0; 1.0 ] ]
+          element (bending (modulus * i) length) (blockDiagonal [ flip; flip ]))
+      | "Beam3D"
+      | "Frame3D" ->
+        let area =
+          if e.Type = "Frame3D" then property e [ "area"; "a" ] else Ok 0.0
+
+        let torsion =
+          match property e [ "j"; "ix" ], material.ShearModulus with
+          | Error e, _ -> Error e
+          | Ok _, None -> Error(MissingShearModulus(e.Id, e.Material))
+          | Ok j, Some g -> Ok(g * j)
+
+        match area, property e [ "iy" ], property e [ "iz"; "i" ], torsion with
+        | Error e, _, _, _
+        | _, Error e, _, _
+        | _, _, Error e, _
+        | _, _, _, Error e -> Error e
+        | Ok area, Ok iy, Ok iz, Ok gj ->
+          let local = spaceFrame modulus area gj iy iz length
+          let r = memberAxes d
+          let transform = blockDiagonal [ r; r; r; r ]
+
+          if e.Type = "Frame3D" then
+            element local transform
+          else
+            let keep = Matrix.select flexural flexural
+            element (keep local) (keep transform)
+      | _ ->
+        match property e [ "area"; "a" ], property e [ "i"; "iz" ] with
+        | Error e, _
+        | _, Error e -> Error e
+        | Ok area, Ok i ->
+          let axial = modulus * area / length
+          let flexure = bending (modulus * i) length
+          let local = Array2D.zeroCreate 6 6
+          let stretch = array2D [ [ axial; -axial ]; [ -axial; axial ] ]
+
+          let rotation =
+            array2D [ [ c; s; 0.0 ]; [ -s; c; 0.0 ]; [ 0.0; 0.0; 1.0 ] ]
+
+          Matrix.scatter [| 0; 3 |] stretch local
+          Matrix.scatter [| 1; 2; 4; 5 |] flexure local
+          element local (blockDiagonal [ rotation; rotation ])
+    | Some _, _ ->
+      Error(MisalignedElement(e.Id, "must connect exactly 2 nodes"))
+
+  /// Stiffness of each element, keyed by element ID.
+  /// Stiffness of every element but rigid links, which are assembled as
+  /// constraints.
+  let private elements (m: Model) =
+    m.Elements
+    |> Map.toList
+    |> List.filter (fun (_, e) -> e.Type <> "RigidLink")
+    |> traverse (fun (id, e) -> stiffness m e |> Result.map (fun k -> id, k))
+
+  /// Tension a Cable element is installed with, from its "pretension".
+  let private pretensionOf (e: Element) =
+    match e.Type, e.Properties |> Option.bind (Map.tryFind "pretension") with
+    | "Cable", Some t -> t
+    | _ -> 0.0
+
+  /// <summary>
+  /// Returns the equivalent nodal loads of the pretension of the taut Cable
+  /// elements of an assembly: each pulls its ends together with its
+  /// pretension, as would a cable made short by the stretch that induces
+  /// it.
+  /// </summary>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <returns>
+  /// Load on each degree of freedom, or the first StaticError.
+  /// </returns>
+  let pretensionLoads
+    (m: Model)
+    (a: Assembly)
+    : Result<float array, StaticError> =
+    elements m
+    |> Result.map (fun elements ->
+      let f = Array.zeroCreate a.Dofs.Length
+      let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+
+      for id, e in elements do
+        let t = pretensionOf e.Element
+
+        if t <> 0.0 && not (a.Inactive.Contains id) then
+          let g = Matrix.multiply (Matrix.transpose (axes e)) [| t; -t |]
+
+          e.Dofs
+          |> List.iteri (fun k d -> f[index[d]] <- f[index[d]] + g[k])
+
+      f)
+
+  /// Geometric stiffness of a member under axial force n, tension positive,
+  /// in local axes for frames and in global axes.
+  let private geometric (k: ElementStiffness) (n: float) =
+    let size = Array2D.length2 k.Transform
+    let l = k.Length
+
+    // Beam-column stiffness over [v1; θ1; v2; θ2].
+    let beamColumn () =
+      let a, b, c = l / 10.0, 2.0 * l * l / 15.0, l * l / 30.0
+
+      array2D
+        [ [ 1.2; a; -1.2; a ]
+          [ a; b; -a; -c ]
+          [ -1.2; -a; 1.2; -a ]
+          [ a; -c; -a; b ] ]
+      |> Array2D.map ((*) (n / l))
+
+    // Released ends are condensed out of K + K_G, less the condensed K.
+    let toGlobal local =
+      let t = k.Transform
+
+      let local =
+        if k.Released.IsEmpty then
+          local
+        else
+          let tangent = Matrix.combine [ 1.0, k.Fixed; 1.0, local ]
+          let zeros = Array.zeroCreate (Array2D.length1 local)
+          let condensed, _ = Matrix.condense k.Released tangent zeros
+          Matrix.combine [ 1.0, condensed; -1.0, k.Local ]
+
+      local, Matrix.product (Matrix.transpose t) (Matrix.product local t)
+
+    match k.Element.Type with
+    | "Frame2D" ->
+      let local = Array2D.zeroCreate 6 6
+      Matrix.scatter [| 1; 2; 4; 5 |] (beamColumn ()) local
+      toGlobal local
+    | "Frame3D" ->
+      // Torsion is not stiffened by axial force.
+      let local = Array2D.zeroCreate 12 12
+      Matrix.scatter [| 1; 5; 7; 11 |] (beamColumn ()) local
+      Matrix.scatter [| 2; 4; 8; 10 |] (reversed (beamColumn ())) local
+      toGlobal local
+    | "Truss2D"
+    | "Truss3D"
+    | "Cable"
+    | "Strut" ->
+      // Chord rotation is resisted by N/L·(I - d·dᵀ) at either end.
+      let dims = size / 2
+      let d = Array.init dims (fun i -> k.Transform[0, i])
+      let g = Array2D.zeroCreate size size
+
+      for i in 0 .. dims - 1 do
+        for j in 0 .. dims - 1 do
+          let x = n / l * ((if i = j then 1.0 else 0.0) - d[i] * d[j])
+          g[i, j] <- x
+          g[dims + i, dims + j] <- x
+          g[i, dims + j] <- -x
+          g[dims + i, j] <- -x
+
+      Array2D.zeroCreate 2 2, g
+    | _ -> Array2D.zeroCreate size size, Array2D.zeroCreate size size
+
+  /// Consistent mass of a bending member over [v1; θ1; v2; θ2].
+  let private bendingMass (total: float) (l: float) =
+    array2D
+      [ [ 156.0; 22.0 * l; 54.0; -13.0 * l ]
+        [ 22.0 * l; 4.0 * l * l; 13.0 * l; -3.0 * l * l ]
+        [ 54.0; 13.0 * l; 156.0; -22.0 * l ]
+        [ -13.0 * l; -3.0 * l * l; -22.0 * l; 4.0 * l * l ] ]
+    |> Array2D.map (fun x -> x * total / 420.0)
+
+  /// Mass of an element over its global degrees of freedom.
+  let private mass (kind: MassMatrix) (m: Model) (k: ElementStiffness) =
+    let e = k.Element
+    let density = Materials.ofElement m e |> Option.bind (fun x -> x.Density)
+
+    let diagonal (xs: float list) =
+      Array2D.init xs.Length xs.Length (fun i j -> if i = j then xs[i] else 0.0)
+
+    let toGlobal local =
+      Matrix.product
+        (Matrix.transpose k.Transform)
+        (Matrix.product local k.Transform)
+
+    let section =
+      if plates.Contains e.Type then
+        property e [ "thickness"; "t" ]
+      else
+        property e [ "area"; "a" ]
+
+    match density, section with
+    | _ when e.Type = "Spring" ->
+      let size = k.Dofs.Length
+      Ok(Array2D.zeroCreate size size)
+    | None, _ -> Error(MissingDensity(e.Id, e.Material))
+    | _, Error err -> Error err
+    | Some rho, Ok t when plates.Contains e.Type ->
+      // Lumped equally on the translations of each corner.
+      let points = e.Nodes |> List.map (fun n -> Vector3.ofNode m.Nodes[n])
+
+      match plateAxes points with
+      | Error reason -> Error(MisalignedElement(e.Id, reason))
+      | Ok(_, xy) ->
+        let xy = Array.ofList xy
+        let n = xy.Length
+
+        let area =
+          Array.init n (fun i ->
+            let (x1, y1), (x2, y2) = xy[i], xy[(i + 1) % n]
+            x1 * y2 - x2 * y1)
+          |> Array.sum
+          |> fun twice -> abs twice / 2.0
+
+        let share = rho * t * area / float n
+        let node = [ share; share; share; 0.0; 0.0; 0.0 ]
+        Ok(diagonal (List.replicate n node |> List.concat))
+    | Some rho, Ok area ->
+      let total = rho * area * k.Length
+      let half = total / 2.0
+
+      match e.Type, kind with
+      | "Truss2D", _
+      | "Truss3D", _
+      | "Cable", _
+      | "Strut", _ ->
+        // Translational inertia is the same along every axis.
+        let n = k.Dofs.Length / 2
+
+        let own, coupled =
+          match kind with
+          | MassMatrix.Lumped -> half, 0.0
+          | MassMatrix.Consistent -> total / 3.0, total / 6.0
+
+        Array2D.init (2 * n) (2 * n) (fun i j ->
+          if i = j then own
+          elif i % n = j % n then coupled
+          else 0.0)
+        |> Ok
+      | "Beam2D", MassMatrix.Lumped -> Ok(diagonal [ half; 0.0; half; 0.0 ])
+      | "Beam2D", MassMatrix.Consistent ->
+        Ok(toGlobal (bendingMass total k.Length))
+      | "Beam3D", MassMatrix.Lumped ->
+        Ok(diagonal [ half; half; 0.0; 0.0; 0.0; half; half; 0.0; 0.0; 0.0 ])
+      | "Frame3D", MassMatrix.Lumped ->
+        let node = [ half; half; half; 0.0; 0.0; 0.0 ]
+        Ok(diagonal (node @ node))
+      | "Beam3D", MassMatrix.Consistent
+      | "Frame3D", MassMatrix.Consistent ->
+        // Rotary inertia of the section is neglected.
+        let local = Array2D.zeroCreate 12 12
+        let axial = array2D [ [ 2.0; 1.0 ]; [ 1.0; 2.0 ] ]
+        let flexure = bendingMass total k.Length
+        Matrix.scatter [| 0; 6 |] (Array2D.map ((*) (total / 6.0)) axial) local
+        Matrix.scatter [| 1; 5; 7; 11 |] flexure local
+        Matrix.scatter [| 2; 4; 8; 10 |] (reversed flexure) local
+
+        if e.Type = "Frame3D" then
+          Ok(toGlobal local)
+        else
+          Ok(toGlobal (Matrix.select flexural flexural local))
+      | _, MassMatrix.Lumped ->
+        Ok(diagonal [ half; half; 0.0; half; half; 0.0 ])
+      | _, MassMatrix.Consistent ->
+        let local = Array2D.zeroCreate 6 6
+        let axial = array2D [ [ 2.0; 1.0 ]; [ 1.0; 2.0 ] ]
+        Matrix.scatter [| 0; 3 |] (Array2D.map ((*) (total / 6.0)) axial) local
+        Matrix.scatter [| 1; 2; 4; 5 |] (bendingMass total k.Length) local
+        Ok(toGlobal local)
+
+  /// Entries of element matrices at their global degrees of freedom.
+  let private entries
+    (index: Map<string * Dof, int>)
+    (blocks: ((string * Dof) list * float[,]) list)
+    =
+    seq {
+      for dofs, block in blocks do
+        let at = dofs |> List.map (fun d -> index[d]) |> Array.ofList
+
+        for r in 0 .. at.Length - 1 do
+          for c in 0 .. at.Length - 1 do
+            at[r], at[c], block[r, c]
+    }
+
+  /// Stiffness of elastic supports, summed by node and degree of freedom.
+  /// Freedoms a constraint also restrains are rigid and so are skipped.
+  let private supportSprings (m: Model) =
+    m.Constraints
+    |> Map.toList
+    |> traverse (fun (id, c) ->
+      defaultArg c.Stiffness Map.empty
+      |> Map.toList
+      |> List.filter (fun (name, _) -> not (List.contains name c.Dof))
+      |> traverse (fun (name, k) ->
+        match Dof.tryParse name with
+        | Some dof -> Ok((c.Node, dof), k)
+        | None -> Error(InvalidConstraint(id, name))))
+    |> Result.map (
+      List.concat
+      >> List.groupBy fst
+      >> List.map (fun (dof, ks) -> dof, List.sumBy snd ks)
+      >> Map.ofList
+    )
+
+  /// Stiffness of a RigidLink, relative to the stiffest element freedom.
+  let private penalty = 1e8
+
+  /// Freedoms of the nodes of each rigid link: those that the elements give
+  /// any of its nodes, so that a master needs no elements of its own.
+  let private linkDofs (m: Model) (dofs: (string * Dof) list) =
+    let kinds = dofs |> List.groupBy fst |> Map.ofList
+
+    [ for KeyValue(_, e) in m.Elements do
+        if e.Type = "RigidLink" then
+          let shared =
+            e.Nodes
+            |> List.collect (fun n -> defaultArg (kinds.TryFind n) [])
+            |> List.map snd
+            |> List.distinct
+
+          for node in e.Nodes do
+            for dof in shared -> node, dof ]
+
+  /// Penalty stiffness α·cᵀ·c of each constraint c·u = 0 that ties a
+  /// freedom of a slave node to the rigid-body motion of its master, the
+  /// first node of a RigidLink: u_s = u_m + θ_m × r and θ_s = θ_m.
+  let private rigidLinks
+    (m: Model)
+    (index: Map<string * Dof, int>)
+    (alpha: float)
+    =
+    let angles = inclinations m
+
+    [ for KeyValue(_, e) in m.Elements do
+        if e.Type = "RigidLink" then
+          let master = e.Nodes.Head
+          let origin = Vector3.ofNode m.Nodes[master]
+
+          for slave in e.Nodes.Tail do
+            let r = Vector3.sub (Vector3.ofNode m.Nodes[slave]) origin
+
+            let rows =
+              [ Ux, [ Ux, 1.0; Ry, r.Z; Rz, -r.Y ]
+                Uy, [ Uy, 1.0; Rz, r.X; Rx, -r.Z ]
+                Uz, [ Uz, 1.0; Rx, r.Y; Ry, -r.X ]
+                Rx, [ Rx, 1.0 ]
+                Ry, [ Ry, 1.0 ]
+                Rz, [ Rz, 1.0 ] ]
+
+            for dof, terms in rows do
+              if index.ContainsKey(slave, dof) then
+                let coefficients =
+                  ((slave, dof), 1.0)
+                  :: [ for d, c in terms do
+                         if index.ContainsKey(master, d) then
+                           (master, d), -c ]
+
+                let dofs = coefficients |> List.map fst
+                let row = coefficients |> List.map snd |> Array.ofList
+
+                // In support axes at inclined supports.
+                let c =
+                  Matrix.multiply
+                    (Matrix.transpose (rotation angles dofs))
+                    row
+
+                let n = c.Length
+                dofs, Array2D.init n n (fun i j -> alpha * c[i] * c[j]) ]
+
+  /// <summary>
+  /// Assembles the stiffness of a model without some slack elements, over
+  /// the freedoms of all its elements so that numbering does not change.
+  /// </summary>
+  /// <param name="inactive">IDs of the slack Cable and Strut elements.</param>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Assembly, or the first StaticError.</returns>
+  let assembleWithout
+    (inactive: Set<string>)
+    (m: Model)
+    : Result<Assembly, StaticError> =
+    let restraints =
+      m.Constraints
+      |> Map.toList
+      |> traverse (fun (id, c) ->
+        c.Dof
+        |> traverse (fun name ->
+          match Dof.tryParse name with
+          | Some dof -> Ok(c.Node, dof)
+          | None -> Error(InvalidConstraint(id, name))))
+      |> Result.map (List.concat >> set)
+
+    // Imposed displacements of the freedoms their constraints restrain.
+    let prescribed =
+      m.Constraints
+      |> Map.toList
+      |> traverse (fun (id, c) ->
+        defaultArg c.Displacement Map.empty
+        |> Map.toList
+        |> List.filter (fun (name, _) -> List.contains name c.Dof)
+        |> traverse (fun (name, x) ->
+          match Dof.tryParse name with
+          | Some dof -> Ok((c.Node, dof), x)
+          | None -> Error(InvalidConstraint(id, name))))
+      |> Result.map (List.concat >> Map.ofList)
+
+    match elements m, restraints, supportSprings m, prescribed with
+    | Error e, _, _, _
+    | _, Error e, _, _
+    | _, _, Error e, _
+    | _, _, _, Error e -> Error e
+    | Ok elements, Ok restraints, Ok springs, Ok prescribed ->
+      let dofs =
+        let own = elements |> List.collect (fun (_, k) -> k.Dofs)
+
+        own @ linkDofs m own |> List.distinct |> List.sort |> Array.ofList
+
+      let index = dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+
+      let blocks =
+        elements
+        |> List.filter (fun (id, _) -> not (inactive.Contains id))
+        |> List.map (fun (_, e) ->
+          let t = axes e
+          let k = Matrix.product (Matrix.transpose t) (Matrix.product e.Local t)
+          e.Dofs, k)
+
+      // Supports only stiffen freedoms that their node's elements provide.
+      let supports =
+        springs
+        |> Map.toList
+        |> List.filter (fun (dof, _) -> index.ContainsKey dof)
+        |> List.map (fun (dof, k) -> [ dof ], array2D [ [ k ] ])
+
+      let stiffest =
+        blocks
+        |> List.collect (fun (_, k) ->
+          List.init (Array2D.length1 k) (fun i -> abs k[i, i]))
+        |> List.fold max 0.0
+
+      let blocks = blocks @ supports @ rigidLinks m index (penalty * stiffest)
+
+      let allowed = Dof.ofDimensions m
+
+      Ok
+        { Dofs = dofs
+          Restrained =
+            dofs
+            |> Array.map (fun (node, dof) ->
+              restraints.Contains(node, dof) || not (List.contains dof allowed))
+          Prescribed =
+            dofs |> Array.map (fun d -> defaultArg (prescribed.TryFind d) 0.0)
+          Stiffness = Sparse.ofEntries dofs.Length (entries index blocks)
+          Angles = inclinations m
+          Inactive = inactive }
+
+  /// <summary>
+  /// Numbers the degrees of freedom of a model and assembles its global
+  /// stiffness matrix. Elastic supports stiffen the freedoms they act on.
+  /// Every Cable and Strut element starts taut.
+  /// </summary>
+  /// <param name="m">Valid model.</param>
+  /// <returns>Assembly, or the first StaticError.</returns>
+  let assemble (m: Model) : Result<Assembly, StaticError> =
+    assembleWithout Set.empty m
+
+  /// <summary>
+  /// Assembles the global mass matrix of a model over the degrees of
+  /// freedom of its assembly. Members take their "area" and the density of
+  /// their material. Point masses are lumped at their nodes whatever the
+  /// kind, acting along each translational freedom and, with their rotary
+  /// inertia, about each rotational freedom named.
+  /// </summary>
+  /// <param name="kind">Lumped or consistent mass.</param>
+  /// <param name="m">Valid model.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <returns>Mass matrix, or the first StaticError.</returns>
+  let assembleMass
+    (kind: MassMatrix)
+    (m: Model)
+    (a: Assembly)
+    : Result<SparseMatrix, StaticError> =
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+
+    let points =
+      [ for KeyValue(_, x) in defaultArg m.Masses Map.empty do
+          for dof in [ Ux; Uy; Uz ] do
+            (x.Node, dof), x.Mass
+          for KeyValue(name, inertia) in defaultArg x.Inertia Map.empty do
+            match Dof.tryParse name with
+            | Some dof -> (x.Node, dof), inertia
+            | None -> () ]
+      |> List.filter (fun (dof, _) -> index.ContainsKey dof)
+      |> List.map (fun (dof, x) -> [ dof ], array2D [ [ x ] ])
+
+    elements m
+    |> Result.bind (
+      traverse (fun (_, k) ->
+        mass kind m k |> Result.map (fun x -> k.Dofs, nodal k x))
+    )
+    |> Result.map (fun blocks ->
+      Sparse.ofEntries a.Dofs.Length (entries index (blocks @ points)))
+
+  /// <summary>
+  /// Returns the free degrees of freedom of an assembly: those that are
+  /// neither restrained nor without stiffness.
+  /// </summary>
+  /// <param name="a">Assembly.</param>
+  /// <returns>Indices of the free degrees of freedom, ascending.</returns>
+  let free (a: Assembly) : int array =
+    Array.init a.Dofs.Length id
+    |> Array.filter (fun i ->
+      not a.Restrained[i] && Sparse.get a.Stiffness i i <> 0.0)
+
+  /// <summary>
+  /// Returns the strain energy of each element, ½·uᵀ·K·u, under a
+  /// displacement of the assembly, e.g. a mode shape; slack elements of
+  /// the assembly store none.
+  /// </summary>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="u">Displacement of each degree of freedom.</param>
+  /// <returns>Strain energy by element, or the first StaticError.</returns>
+  let strainEnergies
+    (m: Model)
+    (a: Assembly)
+    (u: float array)
+    : Result<Map<string, float>, StaticError> =
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+
+    elements m
+    |> Result.map (
+      List.map (fun (id, e) ->
+        let ue = e.Dofs |> List.map (fun d -> u[index[d]]) |> Array.ofList
+        let local = Matrix.multiply (axes e) ue
+        let forces = Matrix.multiply e.Local local
+
+        if a.Inactive.Contains id then
+          id, 0.0
+        else
+          id, 0.5 * Array.fold2 (fun s x f -> s + x * f) 0.0 local forces)
+      >> Map.ofList
+    )
+
+  /// <summary>
+  /// Rotates the Ux and Uy values of a node from the axes of its inclined
+  /// support, if any, to global axes.
+  /// </summary>
+  /// <param name="a">Assembly.</param>
+  /// <param name="node">Node ID.</param>
+  /// <param name="values">Values by degree of freedom at the node.</param>
+  /// <returns>Values in global axes.</returns>
+  let toGlobal
+    (a: Assembly)
+    (node: string)
+    (values: Map<Dof, float>)
+    : Map<Dof, float> =
+    match a.Angles.TryFind node with
+    | Some angle when values.ContainsKey Ux || values.ContainsKey Uy ->
+      let at dof = values.TryFind dof |> Option.defaultValue 0.0
+      let c, s = cos angle, sin angle
+
+      values
+      |> Map.add Ux (c * at Ux - s * at Uy)
+      |> Map.add Uy (s * at Ux + c * at Uy)
+    | _ -> values
+
+  /// <summary>
+  /// Sums nodal loads into a load vector over the degrees of freedom of an
+  /// assembly, in the axes of inclined supports at their nodes.
+  /// </summary>
+  /// <param name="a">Assembly.</param>
+  /// <param name="loads">Nodal loads, e.g. of a load set.</param>
+  /// <returns>
+  /// Load on each degree of freedom, or UnresistedLoad when a load acts
+  /// along a freedom without stiffness.
+  /// </returns>
+  let loadVector
+    (a: Assembly)
+    (loads: NodalLoad list)
+    : Result<float array, StaticError> =
+    let n = a.Dofs.Length
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+    let f = Array.zeroCreate n
+
+    let applied =
+      loads
+      |> traverse (fun l ->
+        match Dof.ofDirection l.Direction with
+        | Some dof when index.ContainsKey(l.Node, dof) ->
+          let i = index[l.Node, dof]
+          f[i] <- f[i] + l.Magnitude
+          Ok()
+        | Some dof -> Error(UnresistedLoad(l.Node, dof))
+        | None -> Ok())
+
+    for KeyValue(node, angle) in a.Angles do
+      match index.TryFind(node, Ux), index.TryFind(node, Uy) with
+      | Some i, Some j ->
+        let c, s = cos angle, sin angle
+        let x, y = f[i], f[j]
+        f[i] <- c * x + s * y
+        f[j] <- -s * x + c * y
+      | _ -> ()
+
+    // Free freedoms without stiffness are dropped unless loaded.
+    let unresisted =
+      Seq.init n id
+      |> Seq.tryFind (fun i ->
+        not a.Restrained[i] && Sparse.get a.Stiffness i i = 0.0 && f[i] <> 0.0)
+
+    match applied, unresisted with
+    | Error e, _ -> Error e
+    | _, Some i -> Error(UnresistedLoad a.Dofs[i])
+    | Ok _, None -> Ok f
+
+  /// Entries of the geometric stiffness of the members under axial forces.
+  let private geometricEntries
+    (m: Model)
+    (a: Assembly)
+    (axial: Map<string, float>)
+    =
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+
+    elements m
+    |> Result.map (fun elements ->
+      elements
+      |> List.choose (fun (id, e) ->
+        axial.TryFind id
+        |> Option.map (fun n -> e.Dofs, nodal e (snd (geometric e n))))
+      |> entries index)
+
+  /// <summary>
+  /// Assembles the geometric stiffness K_G of a model's members under given
+  /// axial forces, e.g. for a linear buckling analysis.
+  /// </summary>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="axial">Axial force by element, tension positive.</param>
+  /// <returns>Geometric stiffness matrix, or the first StaticError.</returns>
+  let geometricStiffness
+    (m: Model)
+    (a: Assembly)
+    (axial: Map<string, float>)
+    : Result<SparseMatrix, StaticError> =
+    geometricEntries m a axial
+    |> Result.map (Sparse.ofEntries a.Dofs.Length)
+
+  /// <summary>
+  /// Assembles the tangent stiffness of a model, K + K_G, adding the
+  /// geometric stiffness of its members under given axial forces.
+  /// </summary>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="axial">Axial force by element, tension positive.</param>
+  /// <returns>Tangent stiffness matrix, or the first StaticError.</returns>
+  let tangentStiffness
+    (m: Model)
+    (a: Assembly)
+    (axial: Map<string, float>)
+    : Result<SparseMatrix, StaticError> =
+    geometricEntries m a axial
+    |> Result.map (fun geometric ->
+      let linear =
+        seq {
+          for i in 0 .. a.Dofs.Length - 1 do
+            for j, x in Sparse.row a.Stiffness i -> i, j, x
+        }
+
+      Sparse.ofEntries a.Dofs.Length (Seq.append linear geometric))
+
+  /// <summary>
+  /// Factorises K over the free degrees of freedom of an assembly once, for
+  /// systems solved for many loads, diagnosing a singular or ill-conditioned
+  /// K by the freedoms at fault.
+  /// </summary>
+  /// <param name="solver">Linear solver.</param>
+  /// <param name="dofs">Node and degree of freedom of each row of K.</param>
+  /// <param name="k">Stiffness over the free degrees of freedom.</param>
+  /// <returns>
+  /// Solution of K·x = b for any b, or Mechanism or IllConditioned; the
+  /// iterative solver factorises nothing and may fail with NotConverged.
+  /// </returns>
+  let factoriseSystem
+    (solver: LinearSolver)
+    (dofs: (string * Dof) array)
+    (k: SparseMatrix)
+    : Result<float array -> Result<float array, StaticError>, StaticError> =
+    let named rows = rows |> List.map (fun i -> dofs[i])
+
+    // Freedoms whose pivots vanish, found by skyline factorisation, which
+    // holds each as it is found and carries on. Pivots lost to rounding
+    // alone, to within 10⁻¹⁴ of their diagonal, mark a mechanism; larger
+    // ones a structure too ill-conditioned to solve reliably.
+    let mechanism (s: Skyline) =
+      let rows = Skyline.singular s
+      let free = rows |> List.filter (fun (_, ratio) -> ratio >= 1e14)
+
+      match free, rows with
+      | [], [] -> Mechanism []
+      | [], rows ->
+        let worst = rows |> List.map snd |> List.max
+        IllConditioned(named (List.map fst rows), worst)
+      | free, _ -> Mechanism(named (List.map fst free))
+
+    match solver with
+    | _ when Sparse.order k = 0 -> Ok(fun _ -> Ok [||])
+    | LinearSolver.Dense ->
+      match Sparse.toMatrix k |> Matrix.factorise with
+      | Some lu -> Ok(fun b -> Ok(Matrix.solve lu b))
+      | None -> Error(mechanism (Skyline.ofSparse k))
+    | LinearSolver.Skyline reordering ->
+      let s = Skyline.ofSparseWith reordering k
+
+      match Skyline.factorise s with
+      | Some f -> Ok(fun b -> Ok(Skyline.solve f b))
+      | None -> Error(mechanism s)
+    | LinearSolver.Pcg preconditioner ->
+      Ok(fun b ->
+        let solution =
+          Sparse.preconditionedConjugateGradient
+            preconditioner
+            LinearSolver.Tolerance
+            k
+            b
+
+        match solution with
+        | Some x -> Ok x
+        | None ->
+          match mechanism (Skyline.ofSparse k) with
+          | Mechanism [] -> Error NotConverged
+          | e -> Error e)
+
+  /// <summary>
+  /// Solves K·x = b over the free degrees of freedom of an assembly,
+  /// diagnosing a singular or ill-conditioned K by the freedoms at fault.
+  /// </summary>
+  /// <param name="solver">Linear solver.</param>
+  /// <param name="dofs">Node and degree of freedom of each row of K.</param>
+  /// <param name="k">Stiffness over the free degrees of freedom.</param>
+  /// <param name="b">Load on each free degree of freedom.</param>
+  /// <returns>
+  /// Solution, or Mechanism, IllConditioned or NotConverged.
+  /// </returns>
+  let solveSystem
+    (solver: LinearSolver)
+    (dofs: (string * Dof) array)
+    (k: SparseMatrix)
+    (b: float array)
+    : Result<float array, StaticError> =
+    factoriseSystem solver dofs k |> Result.bind (fun solve -> solve b)
+
+  /// <summary>
+  /// Recovers the response of an assembled model from its displacements,
+  /// including the geometric stiffness of members under axial force.
+  /// </summary>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="axial">
+  /// Axial force by element, tension positive; empty for a linear response.
+  /// </param>
+  /// <param name="u">Displacement of each degree of freedom.</param>
+  /// <param name="f">Load on each degree of freedom.</param>
+  /// <returns>Displacements, reactions and member forces.</returns>
+  let respond
+    (m: Model)
+    (a: Assembly)
+    (axial: Map<string, float>)
+    (u: float array)
+    (f: float array)
+    : Result<StaticResult, StaticError> =
+    let n = a.Dofs.Length
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+    let inert i = Sparse.get a.Stiffness i i = 0.0
+
+    let stiffness =
+      if axial.IsEmpty then
+        Ok a.Stiffness
+      else
+        tangentStiffness m a axial
+
+    match stiffness, elements m, supportSprings m with
+    | Error e, _, _
+    | _, Error e, _
+    | _, _, Error e -> Error e
+    | Ok k, Ok elements, Ok springs ->
+      let ku = Sparse.multiply k u
+
+      let byNode (entries: (int * float) seq) =
+        entries
+        |> Seq.groupBy (fun (i, _) -> fst a.Dofs[i])
+        |> Seq.map (fun (node, xs) ->
+          node, xs |> Seq.map (fun (i, x) -> snd a.Dofs[i], x) |> Map.ofSeq)
+        |> Map.ofSeq
+
+      let endForces (id: string) (e: ElementStiffness) =
+        let ue = e.Dofs |> List.map (fun d -> u[index[d]]) |> Array.ofList
+        let local = Matrix.multiply (axes e) ue
+        // A pretensioned cable carries its pretension before it strains.
+        let forces =
+          match pretensionOf e.Element, Matrix.multiply e.Local local with
+          | 0.0, forces -> forces
+          | t, forces -> Array.map2 (+) forces [| -t; t |]
+
+        match axial.TryFind id with
+        | _ when a.Inactive.Contains id -> Array.zeroCreate forces.Length
+        | Some force ->
+          let extra = Matrix.multiply (fst (geometric e force)) local
+          Array.map2 (+) forces extra
+        | None -> forces
+
+      // Extension of the spring, from ground for one node, times stiffness.
+      let springForces (e: ElementStiffness) =
+        let ue = e.Dofs |> List.map (fun d -> u[index[d]]) |> Array.ofList
+        let local = Matrix.multiply (axes e) ue
+        let n = local.Length / e.Element.Nodes.Length
+
+        e.Dofs
+        |> List.take n
+        |> List.mapi (fun i (_, dof) ->
+          let extension = if local.Length > n then local[n + i] - local[i] else local[i]
+          dof, e.Local[i, i] * extension)
+        |> Map.ofList
+
+      let plateForces (e: ElementStiffness) =
+        let ue = e.Dofs |> List.map (fun d -> u[index[d]]) |> Array.ofList
+        Matrix.multiply e.Recovery (Matrix.multiply (axes e) ue)
+
+      // Elastic supports push back against the movement of their freedom.
+      let elastic =
+        springs
+        |> Map.toSeq
+        |> Seq.choose (fun (dof, k) ->
+          match index.TryFind dof with
+          | Some i when not a.Restrained[i] -> Some(i, -k * u[i])
+          | _ -> None)
+
+      // Reactions in the axes each support restrains, leaving out the
+      // freedoms held out of a 2D model's plane.
+      let allowed = Dof.ofDimensions m
+
+      let reactions =
+        Seq.init n id
+        |> Seq.filter (fun i ->
+          a.Restrained[i] && List.contains (snd a.Dofs[i]) allowed)
+        |> Seq.map (fun i -> i, ku[i] - f[i])
+        |> Seq.append elastic
+        |> byNode
+
+      Ok
+        { Displacements =
+            Seq.init n id
+            |> Seq.filter (inert >> not)
+            |> Seq.map (fun i -> i, u[i])
+            |> byNode
+            |> Map.map (toGlobal a)
+          Reactions = reactions |> Map.map (toGlobal a)
+          LocalReactions =
+            reactions |> Map.filter (fun node _ -> a.Angles.ContainsKey node)
+          MemberForces =
+            elements
+            |> List.filter (fun (_, e) -> isMember e.Element)
+            |> List.map (fun (id, e) -> id, endForces id e)
+            |> Map.ofList
+          PlateForces =
+            elements
+            |> List.filter (fun (_, e) -> plates.Contains e.Element.Type)
+            |> List.map (fun (id, e) -> id, plateForces e)
+            |> Map.ofList
+          SpringForces =
+            elements
+            |> List.filter (fun (_, e) -> e.Element.Type = "Spring")
+            |> List.map (fun (id, e) -> id, springForces e)
+            |> Map.ofList }
+
+  /// Cable elements that shorten and Strut elements that lengthen under a
+  /// displacement, which carry no force.
+  let private slackElements
+    (a: Assembly)
+    (elements: (string * ElementStiffness) list)
+    (u: float array)
+    =
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+
+    elements
+    |> List.filter (fun (_, e) -> unilateral.Contains e.Element.Type)
+    |> List.filter (fun (_, e) ->
+      let ue = e.Dofs |> List.map (fun d -> u[index[d]]) |> Array.ofList
+      let local = Matrix.multiply (axes e) ue
+      let extension = local[1] - local[0]
+
+      // Pretension holds a cable taut until it shortens by the stretch
+      // that induced it.
+      let stretch = pretensionOf e.Element / e.Local[0, 0]
+
+      match e.Element.Type with
+      | "Cable" -> extension + stretch < -tolerance * e.Length
+      | _ -> extension > tolerance * e.Length)
+    |> List.map fst
+    |> set
+
+  /// <summary>
+  /// Solves an assembled model for nodal loads with a chosen solver.
+  /// </summary>
+  /// <param name="solver">Solver for the free degrees of freedom.</param>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="loads">Nodal loads, e.g. of a load set.</param>
+  /// <returns>Displacements, reactions and member forces.</returns>
+  let solveWith
+    (solver: LinearSolver)
+    (m: Model)
+    (a: Assembly)
+    (loads: NodalLoad list)
+    : Result<StaticResult, StaticError> =
+    match loadVector a loads with
+    | Error e -> Error e
+    | Ok f ->
+      // Taut cables add the loads of their pretension.
+      let loaded (a: Assembly) =
+        pretensionLoads m a |> Result.map (Array.map2 (+) f)
+
+      // Prescribed displacements are eliminated: K_ff·u_f = f_f − K_fr·u_r.
+      let linear (a: Assembly) (f: float array) =
+        let free = free a
+        let kff = Sparse.select free a.Stiffness
+        let imposed = Sparse.multiply a.Stiffness a.Prescribed
+
+        let loads = free |> Array.map (fun i -> f[i] - imposed[i])
+
+        solveSystem solver (Array.map (Array.get a.Dofs) free) kff loads
+        |> Result.map (fun solution ->
+          let u = Array.copy a.Prescribed
+          solution |> Array.iteri (fun j x -> u[free[j]] <- x)
+          u)
+
+      let rec settle iteration (a: Assembly) =
+        let solved =
+          loaded a
+          |> Result.bind (fun f -> linear a f |> Result.map (fun u -> f, u))
+
+        match solved, elements m with
+        | Error e, _
+        | _, Error e -> Error e
+        | Ok(f, u), Ok elements ->
+          let slack = slackElements a elements u
+
+          if slack = a.Inactive then
+            respond m a Map.empty u f
+          elif iteration >= settlingIterations then
+            Error(UnsettledElements iteration)
+          else
+            // Loads on nodes held only by slack elements are unresisted.
+            assembleWithout slack m
+            |> Result.bind (fun next ->
+              loadVector next loads |> Result.map (fun _ -> next))
+            |> Result.bind (settle (iteration + 1))
+
+      if m.Elements |> Map.exists (fun _ e -> unilateral.Contains e.Type) then
+        settle 1 a
+      else
+        loaded a
+        |> Result.bind (fun f ->
+          linear a f |> Result.bind (fun u -> respond m a Map.empty u f))
+
+  /// <summary>
+  /// Solves an assembled model for nodal loads by skyline Cholesky.
+  /// </summary>
+  /// <param name="m">Model the assembly belongs to.</param>
+  /// <param name="a">Assembly of the model.</param>
+  /// <param name="loads">Nodal loads, e.g. of a load set.</param>
+  /// <returns>Displacements, reactions and member forces.</returns>
+  let solve
+    (m: Model)
+    (a: Assembly)
+    (loads: NodalLoad list)
+    : Result<StaticResult, StaticError> =
+    solveWith LinearSolver.defaultSolver m a loads
+
+  /// <summary>
+  /// Subtracts from the member end forces of a response the equivalent
+  /// nodal loads of the thermal loads in its load set, so that members
+  /// restrained against thermal strain report the forces it induces.
+  /// </summary>
+  /// <param name="m">Model the response belongs to.</param>
+  /// <param name="set">Load set analysed.</param>
+  /// <param name="r">Static response to the load set.</param>
+  /// <returns>Response with thermal member forces, or StaticError.</returns>
+  let withThermal
+    (m: Model)
+    (set: LoadSet)
+    (r: StaticResult)
+    : Result<StaticResult, StaticError> =
+    let thermal = set.Loads |> List.filter (fun (_, l) -> l.Type = "Thermal")
+
+    let restrain (forces: Map<string, float array>) (factor, l: Load) =
+      match l.Element with
+      | Some id when forces.ContainsKey id ->
+        elements m
+        |> Result.bind (fun elements ->
+          NodalLoads.ofLoad m factor l
+          |> Result.mapError FailedLoads
+          |> Result.map (fun loads ->
+            let e = elements |> List.find (fst >> (=) id) |> snd
+
+            let along (node, dof) =
+              loads
+              |> List.filter (fun x ->
+                x.Node = node && Dof.ofDirection x.Direction = Some dof)
+              |> List.sumBy (fun x -> x.Magnitude)
+
+            let fe = e.Dofs |> List.map along |> Array.ofList
+            let local = Matrix.multiply (axes e) fe
+            Map.add id (Array.map2 (-) forces[id] local) forces))
+      | _ -> Ok forces
+
+    thermal
+    |> List.fold
+      (fun acc load -> acc |> Result.bind (fun forces -> restrain forces load))
+      (Ok r.MemberForces)
+    |> Result.map (fun forces -> { r with MemberForces = forces })
+
+  /// <summary>
+  /// Analyses a model under one load set.
+  /// </summary>
+  /// <param name="m">Valid model.</param>
+  /// <param name="set">Load set.</param>
+  /// <returns>Static response, or the first StaticError.</returns>
+  let analyse (m: Model) (set: LoadSet) : Result<StaticResult, StaticError> =
+    NodalLoads.ofLoadSet m set
+    |> Result.mapError FailedLoads
+    |> Result.bind (fun loads ->
+      assemble m |> Result.bind (fun a -> solve m a loads))
+    |> Result.bind (withThermal m set)
+
+  /// <summary>
+  /// Extends the response of a model cut on a symmetry plane, by
+  /// Symmetry.apply, to the whole model under symmetric loads.
+  /// Displacements, reactions and member forces are mirrored; plate and
+  /// spring forces and the reactions of inclined supports are left for
+  /// the part only.
+  /// </summary>
+  /// <param name="p">Symmetry plane the model was cut on.</param>
+  /// <param name="whole">Model before the cut.</param>
+  /// <param name="r">Static response of the part.</param>
+  /// <returns>Static response of the whole.</returns>
+  let mirror
+    (p: SymmetryPlane)
+    (whole: Model)
+    (r: StaticResult)
+    : StaticResult =
+    { r with
+        Displacements = Symmetry.mirrorNodes p whole r.Displacements
+        Reactions = Symmetry.mirrorReactions p whole r.Reactions
+        MemberForces = Symmetry.mirrorMembers p whole r.MemberForces }
+
+  /// <summary>
+  /// Returns the axial force of a member from its end forces, taken at the
+  /// second end.
+  /// </summary>
+  /// <param name="forces">Member end forces in local axes.</param>
+  /// <returns>Axial force, positive in tension, or None for beams.</returns>
+  let axialForce (forces: float array) : float option =
+    match forces.Length with
+    | 2 -> Some forces[1]
+    | 6 -> Some forces[3]
+    | 12 -> Some forces[6]
+    | _ -> None
+
+  /// <summary>
+  /// Returns the axial force of each member that carries one, from its
+  /// force at the second end.
+  /// </summary>
+  /// <param name="r">Static response.</param>
+  /// <returns>Axial force by element, positive in tension.</returns>
+  let axialForces (r: StaticResult) : Map<string, float> =
+    r.MemberForces
+    |> Map.toSeq
+    |> Seq.choose (fun (id, forces) ->
+      axialForce forces |> Option.map (fun n -> id, n))
+    |> Map.ofSeq
@@ -0,0 +1,412 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Sub-model condensed onto the freedoms of its boundary nodes, ready to be
+/// placed any number of times in a model.
+/// </summary>
+type Substructure =
+  {
+    /// Assembly of the sub-model, numbering its nodal loads.
+    Assembly: Assembly
+    /// Freedoms of the assembly the superelement is condensed from.
+    Free: int array
+    Superelement: Superelement
+  }
+
+/// <summary>
+/// Substructure joined to nodes of a model.
+/// </summary>
+type Placement =
+  {
+    Id: string
+    Substructure: Substructure
+    /// Model node each boundary node of the substructure is joined to.
+    Nodes: Map<string, string>
+    /// Loads on nodes of the substructure, e.g. of its load set.
+    Loads: NodalLoad list
+  }
+
+/// <summary>
+/// Response of a model with placed substructures.
+/// </summary>
+type SubstructureResult =
+  {
+    /// Response of the model, including the boundary nodes.
+    Model: StaticResult
+    /// Displacement of every node of each placement, by placement ID and
+    /// node of the substructure.
+    Placements: Map<string, Map<string, Map<Dof, float>>>
+  }
+
+/// <summary>
+/// Errors raised whilst condensing, placing or solving substructures.
+/// </summary>
+type SubstructureError =
+  | FailedSubmodel of StaticError
+  | FailedCondensation of CondensationError
+  | FailedModel of StaticError
+  | UnknownBoundary of node: string
+  | UnjoinedNode of placement: string * node: string
+  | UnjoinedDof of placement: string * node: string * dof: Dof
+  | InclinedJoint of placement: string * node: string
+  | UnilateralModel of element: string
+  | MismatchedMatrices of dofs: int * order: int
+  | FailedModes of ModalError
+
+[<RequireQualifiedAccess>]
+module SubstructureError =
+
+  let getAsString (e: SubstructureError) : string =
+    match e with
+    | FailedSubmodel e -> $"Substructure: {StaticError.getAsString e}"
+    | FailedCondensation e -> CondensationError.getAsString e
+    | FailedModel e -> StaticError.getAsString e
+    | UnknownBoundary node ->
+      $"Boundary node '{node}' has no free degree of freedom in the "
+      + "substructure."
+    | UnjoinedNode(placement, node) ->
+      $"Placement '{placement}' does not join boundary node '{node}' to the "
+      + "model."
+    | UnjoinedDof(placement, node, dof) ->
+      let name = Dof.getAsString dof
+      $"Placement '{placement}' joins {name} at node '{node}', which the "
+      + "model's elements do not provide."
+    | InclinedJoint(placement, node) ->
+      $"Placement '{placement}' joins node '{node}', which has an inclined "
+      + "support."
+    | UnilateralModel element ->
+      $"Element '{element}' is a Cable or Strut, which models with "
+      + "substructures do not support."
+    | MismatchedMatrices(dofs, order) ->
+      $"Matrices of order {order} do not match {dofs} degrees of freedom."
+    | FailedModes e -> ModalError.getAsString e
+
+/// <summary>
+/// Static substructuring: a repeated part of a model, e.g. a panel of a
+/// lattice tower, is condensed once by Superelement onto its boundary
+/// nodes and placed wherever it recurs, so each solve factorises only the
+/// freedoms of the model and the boundaries.
+/// </summary>
+/// <remarks>
+/// A substructure is assembled from a sub-model of its own, usually without
+/// supports, and condensed exactly for static analysis. Placing it adds
+/// its condensed stiffness to the freedoms of the model nodes its boundary
+/// nodes are joined to, which the model's own elements must provide. The
+/// sub-model is placed as it is oriented, so a placement translates it but
+/// does not rotate it. Loads on a placement are condensed onto the
+/// boundary, and its interior displacements recovered after the solve.
+/// A substructure may instead be a black box of stiffness and mass at
+/// boundary freedoms alone, e.g. a vendor's bearing model read by
+/// MatrixExport.read, whose mass joins that of the model in modes.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Substructure =
+
+  let private traverse (f: 'T -> Result<'U, 'E>) (items: 'T list) =
+    let folder item acc =
+      match f item, acc with
+      | Ok x, Ok xs -> Ok(x :: xs)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder items (Ok [])
+
+  let private direction (dof: Dof) =
+    match dof with
+    | Ux -> "Fx"
+    | Uy -> "Fy"
+    | Uz -> "Fz"
+    | Rx -> "Mx"
+    | Ry -> "My"
+    | Rz -> "Mz"
+
+  /// Node and degree of freedom of each freedom of the superelement.
+  let private dofs (s: Substructure) =
+    s.Free |> Array.map (fun i -> s.Assembly.Dofs[i])
+
+  /// <summary>
+  /// Condenses a sub-model onto the freedoms of its boundary nodes.
+  /// </summary>
+  /// <param name="boundary">Nodes of the sub-model to retain.</param>
+  /// <param name="m">Valid sub-model.</param>
+  /// <returns>Substructure, or SubstructureError.</returns>
+  let condense
+    (boundary: string list)
+    (m: Model)
+    : Result<Substructure, SubstructureError> =
+    Static.assemble m
+    |> Result.mapError FailedSubmodel
+    |> Result.bind (fun a ->
+      let free = Static.free a
+      let nodes = free |> Array.map (fun i -> fst a.Dofs[i])
+
+      let unknown =
+        boundary |> List.tryFind (fun n -> not (Array.contains n nodes))
+
+      match unknown with
+      | Some node -> Error(UnknownBoundary node)
+      | None ->
+        let retained =
+          nodes
+          |> Array.indexed
+          |> Array.filter (fun (_, n) -> List.contains n boundary)
+          |> Array.map fst
+
+        let k = Sparse.select free a.Stiffness |> Sparse.toMatrix
+        let n = Array2D.length1 k
+        let zero = Array2D.zeroCreate n n
+
+        { Mass = zero
+          Damping = zero
+          Stiffness = k }
+        |> Superelement.condense retained
+        |> Result.mapError FailedCondensation
+        |> Result.map (fun se ->
+          { Assembly = a
+            Free = free
+            Superelement = se }))
+
+  /// <summary>
+  /// Makes a substructure of stiffness and mass matrices at boundary
+  /// freedoms, with no interior, e.g. as MatrixExport.read reads them.
+  /// </summary>
+  /// <param name="dofs">Node and degree of freedom of each row and column.
+  /// </param>
+  /// <param name="stiffness">Symmetric stiffness matrix.</param>
+  /// <param name="mass">Symmetric mass matrix, or None if massless.</param>
+  /// <returns>Substructure, or SubstructureError.</returns>
+  let ofMatrices
+    (dofs: (string * Dof) array)
+    (stiffness: SparseMatrix)
+    (mass: SparseMatrix option)
+    : Result<Substructure, SubstructureError> =
+    let n = dofs.Length
+
+    let mismatched =
+      stiffness :: Option.toList mass
+      |> List.tryFind (fun a -> Sparse.order a <> n)
+
+    match mismatched with
+    | Some a -> Error(MismatchedMatrices(n, Sparse.order a))
+    | None ->
+      let a =
+        { Dofs = dofs
+          Restrained = Array.create n false
+          Prescribed = Array.zeroCreate n
+          Stiffness = stiffness
+          Angles = Map.empty
+          Inactive = Set.empty }
+
+      let zero = Array2D.zeroCreate n n
+
+      { Mass = mass |> Option.map Sparse.toMatrix |> Option.defaultValue zero
+        Damping = zero
+        Stiffness = Sparse.toMatrix stiffness }
+      |> Superelement.condense (Array.init n id)
+      |> Result.mapError FailedCondensation
+      |> Result.map (fun se ->
+        { Assembly = a
+          Free = Array.init n id
+          Superelement = se })
+
+  /// Freedom of the assembly each boundary freedom of a placement joins.
+  let private joints (a: Assembly) (p: Placement) =
+    let index = a.Dofs |> Array.mapi (fun i d -> d, i) |> Map.ofArray
+    let dofs = dofs p.Substructure
+
+    p.Substructure.Superelement.Boundary
+    |> List.ofArray
+    |> traverse (fun j ->
+      let node, dof = dofs[j]
+
+      match p.Nodes.TryFind node with
+      | None -> Error(UnjoinedNode(p.Id, node))
+      | Some target when a.Angles.ContainsKey target ->
+        Error(InclinedJoint(p.Id, target))
+      | Some target ->
+        match index.TryFind(target, dof) with
+        | Some i -> Ok i
+        | None -> Error(UnjoinedDof(p.Id, target, dof)))
+    |> Result.map Array.ofList
+
+  /// Load on each freedom of the superelement of a placement.
+  let private loadsOf (p: Placement) =
+    let s = p.Substructure
+
+    Static.loadVector s.Assembly p.Loads
+    |> Result.map (fun f -> s.Free |> Array.map (fun i -> f[i]))
+    |> Result.mapError FailedSubmodel
+
+  /// Adds a condensed matrix of each placement to one of the assembly.
+  let private add
+    (condensed: StructuralSystem -> float[,])
+    (placements: Placement list)
+    (a: Assembly)
+    (matrix: SparseMatrix)
+    =
+    placements
+    |> traverse (fun p -> joints a p |> Result.map (fun rows -> p, rows))
+    |> Result.map (fun joined ->
+      let n = Sparse.order matrix
+
+      let entries =
+        seq {
+          for i in 0 .. n - 1 do
+            for j, x in Sparse.row matrix i -> i, j, x
+
+          for p, rows in joined do
+            let k = condensed p.Substructure.Superelement.Reduced
+
+            for r in 0 .. rows.Length - 1 do
+              for c in 0 .. rows.Length - 1 -> rows[r], rows[c], k[r, c]
+        }
+
+      Sparse.ofEntries n entries)
+
+  /// <summary>
+  /// Adds the condensed stiffness of placed substructures to an assembly.
+  /// </summary>
+  /// <param name="placements">Substructures and their joints.</param>
+  /// <param name="a">Assembly of the model they are placed in.</param>
+  /// <returns>Assembly with the substructures, or SubstructureError.</returns>
+  let attach
+    (placements: Placement list)
+    (a: Assembly)
+    : Result<Assembly, SubstructureError> =
+    add (fun s -> s.Stiffness) placements a a.Stiffness
+    |> Result.map (fun k -> { a with Stiffness = k })
+
+  /// <summary>
+  /// Adds the condensed mass of placed substructures to the mass matrix of
+  /// an assembly.
+  /// </summary>
+  /// <param name="placements">Substructures and their joints.</param>
+  /// <param name="a">Assembly of the model they are placed in.</param>
+  /// <param name="mass">Mass matrix of the model over the assembly's
+  /// freedoms.</param>
+  /// <returns>Mass matrix with the substructures, or SubstructureError.
+  /// </returns>
+  let attachMass
+    (placements: Placement list)
+    (a: Assembly)
+    (mass: SparseMatrix)
+    : Result<SparseMatrix, SubstructureError> =
+    add (fun s -> s.Mass) placements a mass
+
+  /// Cable or Strut element of a model, which substructures cannot join.
+  let private unilateral (m: Model) =
+    m.Elements
+    |> Map.tryFindKey (fun _ e -> e.Type = "Cable" || e.Type = "Strut")
+
+  /// <summary>
+  /// Solves a model with placed substructures for nodal loads.
+  /// </summary>
+  /// <param name="solver">Solver for the free degrees of freedom.</param>
+  /// <param name="m">Valid model the substructures are placed in.</param>
+  /// <param name="placements">Substructures, their joints and loads.</param>
+  /// <param name="loads">Nodal loads on the model.</param>
+  /// <returns>Response, or SubstructureError.</returns>
+  let solve
+    (solver: LinearSolver)
+    (m: Model)
+    (placements: Placement list)
+    (loads: NodalLoad list)
+    : Result<SubstructureResult, SubstructureError> =
+    match unilateral m with
+    | Some id -> Error(UnilateralModel id)
+    | None ->
+      Static.assemble m
+      |> Result.mapError FailedModel
+      |> Result.bind (attach placements)
+      |> Result.bind (fun a ->
+        placements
+        |> traverse (fun p ->
+          joints a p
+          |> Result.bind (fun rows ->
+            loadsOf p |> Result.map (fun f -> p, rows, f)))
+        |> Result.map (fun joined -> a, joined))
+      |> Result.bind (fun (a, joined) ->
+        // Loads on each placement act on the model through its boundary.
+        let condensed =
+          [ for p, rows, f in joined do
+              let fb = Superelement.loads p.Substructure.Superelement f
+
+              for j, i in Array.indexed rows do
+                if fb[j] <> 0.0 then
+                  let node, dof = a.Dofs[i]
+
+                  { Node = node
+                    Direction = direction dof
+                    Magnitude = fb[j] } ]
+
+        Static.solveWith solver m a (loads @ condensed)
+        |> Result.mapError FailedModel
+        |> Result.map (fun r ->
+          let at (node, dof) =
+            r.Displacements.TryFind node
+            |> Option.bind (Map.tryFind dof)
+            |> Option.defaultValue 0.0
+
+          { Model = r
+            Placements =
+              joined
+              |> List.map (fun (p, rows, f) ->
+                let se = p.Substructure.Superelement
+                let ub = rows |> Array.map (fun i -> at a.Dofs[i])
+                let u = Superelement.expand se f ub
+
+                let shape =
+                  dofs p.Substructure
+                  |> Array.mapi (fun i (node, dof) -> node, (dof, u[i]))
+                  |> Array.groupBy fst
+                  |> Array.map (fun (node, xs) ->
+                    node, xs |> Array.map snd |> Map.ofArray)
+                  |> Map.ofArray
+
+                p.Id, shape)
+              |> Map.ofList }))
+
+  /// <summary>
+  /// Computes the lowest natural modes of a model with placed
+  /// substructures, whose condensed mass joins that of the model.
+  /// </summary>
+  /// <param name="kind">Lumped or consistent mass of the model.</param>
+  /// <param name="count">Number of modes sought.</param>
+  /// <param name="m">Valid model the substructures are placed in.</param>
+  /// <param name="placements">Substructures and their joints.</param>
+  /// <returns>Modes over the free degrees of freedom of the model, or
+  /// SubstructureError.</returns>
+  let modes
+    (kind: MassMatrix)
+    (count: int)
+    (m: Model)
+    (placements: Placement list)
+    : Result<ModalResult, SubstructureError> =
+    match unilateral m with
+    | Some id -> Error(UnilateralModel id)
+    | None ->
+      Static.assemble m
+      |> Result.bind (fun a ->
+        Static.assembleMass kind m a |> Result.map (fun mass -> a, mass))
+      |> Result.mapError FailedModel
+      |> Result.bind (fun (a, mass) ->
+        attach placements a
+        |> Result.bind (fun a ->
+          attachMass placements a mass |> Result.map (fun mass -> a, mass)))
+      |> Result.bind (fun (a, mass) ->
+        let free = Static.free a
+
+        Modal.lowestModes
+          count
+          (Sparse.select free a.Stiffness)
+          (Sparse.select free mass)
+        |> Result.mapError FailedModes
+        |> Result.map (fun modes ->
+          { Dofs = free |> Array.map (fun i -> a.Dofs[i])
+            Modes = modes }))
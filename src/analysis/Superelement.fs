@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+/// <summary>
+/// Sub-model condensed to its boundary degrees of freedom, so a repeated
+/// module, e.g. a volumetric unit of a modular building, is reduced once
+/// and placed many times in a larger assembly.
+/// </summary>
+type Superelement =
+  {
+    /// Degrees of freedom of the sub-model that are retained.
+    Boundary: int array
+    /// Degrees of freedom of the sub-model that are condensed out.
+    Interior: int array
+    /// Condensed matrices at the boundary degrees of freedom.
+    Reduced: StructuralSystem
+    /// Interior displacements per unit boundary displacement.
+    Recovery: float[,]
+    /// Factors of the interior stiffness, for loads on interior freedoms.
+    InteriorStiffness: LuFactors option
+  }
+
+/// <summary>
+/// Errors raised whilst condensing a sub-model.
+/// </summary>
+type CondensationError =
+  | InvalidBoundary of dof: int
+  | SingularInterior
+
+[<RequireQualifiedAccess>]
+module CondensationError =
+
+  let getAsString (e: CondensationError) : string =
+    match e with
+    | InvalidBoundary dof ->
+      $"Boundary degree of freedom {dof} is not part of the sub-model."
+    | SingularInterior ->
+      "Interior degrees of freedom are unrestrained by the boundary."
+
+/// <summary>
+/// Static (Guyan) condensation of sub-models into superelements.
+/// </summary>
+/// <remarks>
+/// Stiffness and loads are condensed exactly, so static boundary and
+/// recovered interior displacements match those of the full model. Mass
+/// and damping are condensed with the static shapes, which is accurate for
+/// modes whose frequencies are well below those of the fixed-boundary
+/// interior.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Superelement =
+
+  /// <summary>
+  /// Condenses a sub-model onto boundary degrees of freedom.
+  /// </summary>
+  /// <param name="boundary">Degrees of freedom to retain.</param>
+  /// <param name="s">Matrices of the sub-model.</param>
+  /// <returns>Superelement, or CondensationError.</returns>
+  let condense
+    (boundary: int array)
+    (s: StructuralSystem)
+    : Result<Superelement, CondensationError> =
+    let n = Matrix.order s.Stiffness
+    let retained = set boundary
+
+    match boundary |> Array.tryFind (fun d -> d < 0 || d >= n) with
+    | Some dof -> Error(InvalidBoundary dof)
+    | None ->
+      let b = Array.distinct boundary
+      let i = [| 0 .. n - 1 |] |> Array.filter (retained.Contains >> not)
+      let kib = Matrix.select i b s.Stiffness
+
+      let interior =
+        if i.Length = 0 then
+          Ok None
+        else
+          match Matrix.factorise (Matrix.select i i s.Stiffness) with
+          | Some lu -> Ok(Some lu)
+          | None -> Error SingularInterior
+
+      match interior with
+      | Error e -> Error e
+      | Ok factors ->
+        // Columns of T = [I; -Kii⁻¹·Kib] give the displaced shape of the
+        // sub-model for a unit displacement of each boundary freedom.
+        let recovery =
+          match factors with
+          | None -> Array2D.zeroCreate 0 b.Length
+          | Some lu ->
+            let columns =
+              Array.init b.Length (fun j ->
+                Matrix.solve lu (Array.init i.Length (fun r -> -kib[r, j])))
+
+            Array2D.init i.Length b.Length (fun r j -> columns[j][r])
+
+        let order = Array.append b i
+
+        let shapes =
+          Array2D.init n b.Length (fun r j ->
+            if r < b.Length then
+              (if r = j then 1.0 else 0.0)
+            else
+              recovery[r - b.Length, j])
+
+        let reduce (a: float[,]) =
+          let a = Matrix.select order order a
+          Matrix.product (Matrix.transpose shapes) (Matrix.product a shapes)
+
+        Ok
+          { Boundary = b
+            Interior = i
+            Reduced =
+              { Mass = reduce s.Mass
+                Damping = reduce s.Damping
+                Stiffness = reduce s.Stiffness }
+            Recovery = recovery
+            InteriorStiffness = factors }
+
+  /// <summary>
+  /// Condenses loads on the sub-model onto its boundary.
+  /// </summary>
+  /// <param name="se">Superelement.</param>
+  /// <param name="f">Load on each degree of freedom of the sub-model.</param>
+  /// <returns>Equivalent loads on the boundary freedoms.</returns>
+  let loads (se: Superelement) (f: float array) : float array =
+    let fi = se.Interior |> Array.map (fun d -> f[d])
+
+    se.Boundary
+    |> Array.mapi (fun j d ->
+      let mutable sum = f[d]
+
+      for r in 0 .. fi.Length - 1 do
+        sum <- sum + se.Recovery[r, j] * fi[r]
+
+      sum)
+
+  /// <summary>
+  /// Recovers every displacement of the sub-model from the boundary
+  /// displacements of the assembly solve.
+  /// </summary>
+  /// <param name="se">Superelement.</param>
+  /// <param name="f">Load on each degree of freedom of the sub-model.</param>
+  /// <param name="ub">Displacement of each boundary freedom.</param>
+  /// <returns>Every displacement of the sub-model.</returns>
+  let expand
+    (se: Superelement)
+    (f: float array)
+    (ub: float array)
+    : float array =
+    let u = Array.zeroCreate (se.Boundary.Length + se.Interior.Length)
+    let fi = se.Interior |> Array.map (fun d -> f[d])
+
+    let local =
+      match se.InteriorStiffness with
+      | Some lu -> Matrix.solve lu fi
+      | None -> [||]
+
+    let recovered = Matrix.multiply se.Recovery ub
+    se.Boundary |> Array.iteri (fun j d -> u[d] <- ub[j])
+    se.Interior |> Array.iteri (fun r d -> u[d] <- recovered[r] + local[r])
+
+    u
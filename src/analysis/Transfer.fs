@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Errors raised when transferring support reactions between models.
+/// </summary>
+type TransferError =
+  | InvalidNodePair of text: string
+  | MissingSourceNode of node: string
+  | MissingTargetNode of node: string
+  | UnmatchedSupport of node: string
+  | MismatchedUnits of source: string * target: string
+  | ClashingLoad of id: string
+  | FailedSelection of SelectionError
+  | FailedAnalysis of loadSet: string * error: StaticError
+
+[<RequireQualifiedAccess>]
+module TransferError =
+
+  let getAsString (e: TransferError) : string =
+    match e with
+    | InvalidNodePair text ->
+      $"Invalid node pair '{text}'; expected source=target, e.g. n1=f1."
+    | MissingSourceNode node ->
+      $"Node '{node}' does not exist in the source model."
+    | MissingTargetNode node ->
+      $"Node '{node}' does not exist in the target model."
+    | UnmatchedSupport node ->
+      $"Support node '{node}' has no target node at its position; "
+      + "pair it explicitly or widen the tolerance."
+    | MismatchedUnits(source, target) ->
+      $"Source units '{source}' differ from target units '{target}'; "
+      + "convert one model first."
+    | ClashingLoad id -> $"Target model already has a load '{id}'."
+    | FailedSelection e -> SelectionError.getAsString e
+    | FailedAnalysis(set, e) ->
+      $"Load set '{set}': {StaticError.getAsString e}"
+
+/// <summary>
+/// Transfers the support reactions of one model, e.g. a superstructure, as
+/// applied loads onto another, e.g. its foundation mat.
+/// </summary>
+/// <remarks>
+/// Each load case of the source is analysed and the reactions at its
+/// supports are applied, reversed, at the matching target nodes under the
+/// same case: the structure bears on the foundation with equal and
+/// opposite force. Supports are matched to target nodes by explicit pairs,
+/// then by position within a tolerance. Source combinations of transferred
+/// cases are copied unless the target already defines them.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Transfer =
+
+  let private directions =
+    [ Ux, ("Force", "Fx")
+      Uy, ("Force", "Fy")
+      Uz, ("Force", "Fz")
+      Rx, ("Moment", "Mx")
+      Ry, ("Moment", "My")
+      Rz, ("Moment", "Mz") ]
+    |> Map.ofList
+
+  /// <summary>
+  /// Parses an explicit node pair, e.g. "n1=f1".
+  /// </summary>
+  /// <param name="text">Source and target node IDs joined by '='.</param>
+  /// <returns>Source and target IDs, or InvalidNodePair.</returns>
+  let tryParsePair (text: string) : Result<string * string, TransferError> =
+    match text.Split('=') |> Array.map (fun s -> s.Trim()) with
+    | [| source; target |] when source <> "" && target <> "" ->
+      Ok(source, target)
+    | _ -> Error(InvalidNodePair text)
+
+  /// <summary>
+  /// Matches source nodes to target nodes: explicit pairs first, then the
+  /// nearest target node within a tolerance.
+  /// </summary>
+  /// <param name="tolerance">Greatest distance between matched nodes.</param>
+  /// <param name="pairs">Explicit source and target node pairs.</param>
+  /// <param name="source">Source model.</param>
+  /// <param name="target">Target model.</param>
+  /// <param name="nodes">Source nodes to match.</param>
+  /// <returns>Target node of each source node, or the first error.</returns>
+  let mapNodes
+    (tolerance: float)
+    (pairs: (string * string) list)
+    (source: Model)
+    (target: Model)
+    (nodes: string list)
+    : Result<Map<string, string>, TransferError> =
+    let explicit = Map.ofList pairs
+
+    let nearest (node: Node) =
+      let at = Vector3.ofNode node
+
+      target.Nodes
+      |> Map.toList
+      |> List.map (fun (id, n) ->
+        id, Vector3.norm (Vector3.sub (Vector3.ofNode n) at))
+      |> List.filter (fun (_, d) -> d <= tolerance)
+      |> List.sortBy snd
+      |> List.tryHead
+      |> Option.map fst
+
+    let matchNode node =
+      match explicit.TryFind node, source.Nodes.TryFind node with
+      | _, None -> Error(MissingSourceNode node)
+      | Some t, _ when not (target.Nodes.ContainsKey t) ->
+        Error(MissingTargetNode t)
+      | Some t, _ -> Ok(node, t)
+      | None, Some n ->
+        match nearest n with
+        | Some t -> Ok(node, t)
+        | None -> Error(UnmatchedSupport node)
+
+    let unknown =
+      pairs |> List.tryFind (fst >> source.Nodes.ContainsKey >> not)
+
+    match unknown with
+    | Some(node, _) -> Error(MissingSourceNode node)
+    | None ->
+      List.foldBack
+        (fun node acc ->
+          match matchNode node, acc with
+          | Ok pair, Ok rest -> Ok(pair :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        nodes
+        (Ok [])
+      |> Result.map Map.ofList
+
+  /// <summary>
+  /// Converts the reactions of one load case into loads on target nodes.
+  /// </summary>
+  /// <param name="mapping">Target node of each support node.</param>
+  /// <param name="case">Load case the reactions belong to.</param>
+  /// <param name="reactions">Support reactions by node.</param>
+  /// <returns>
+  /// Reversed reactions as nodal forces and moments, summed where supports
+  /// share a target node.
+  /// </returns>
+  let loads
+    (mapping: Map<string, string>)
+    (case: string)
+    (reactions: Map<string, Map<Dof, float>>)
+    : Load list =
+    [ for KeyValue(node, components) in reactions do
+        for KeyValue(dof, reaction) in components do
+          (mapping[node], dof), -reaction ]
+    |> List.groupBy fst
+    |> List.map (fun (key, xs) -> key, List.sumBy snd xs)
+    |> List.filter (fun (_, magnitude) -> magnitude <> 0.0)
+    |> List.map (fun ((at, dof), magnitude) ->
+      let kind, direction = directions[dof]
+
+      { Id = $"reaction-{case}-{at}-{direction}"
+        Type = kind
+        Node = Some at
+        Element = None
+        Direction = direction
+        Magnitude = magnitude
+        Position = None
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = None
+        Case = if case = LoadCases.DefaultCase then None else Some case })
+
+  /// <summary>
+  /// Analyses the source model and applies its support reactions to the
+  /// target model.
+  /// </summary>
+  /// <param name="solver">Linear solver for the source analysis.</param>
+  /// <param name="tolerance">Greatest distance between matched nodes.</param>
+  /// <param name="pairs">Explicit source and target node pairs.</param>
+  /// <param name="cases">Load cases to transfer; all when None.</param>
+  /// <param name="source">Source model, e.g. a superstructure.</param>
+  /// <param name="target">Target model, e.g. a foundation.</param>
+  /// <returns>Target model with the transferred loads.</returns>
+  let apply
+    (solver: LinearSolver)
+    (tolerance: float)
+    (pairs: (string * string) list)
+    (cases: string list option)
+    (source: Model)
+    (target: Model)
+    : Result<Model, TransferError> =
+    let analyse (set: LoadSet) =
+      NodalLoads.ofLoadSet source set
+      |> Result.mapError FailedLoads
+      |> Result.bind (fun nodal ->
+        Static.assemble source
+        |> Result.bind (fun a -> Static.solveWith solver source a nodal))
+      |> Result.map (fun r -> set.Name, r.Reactions)
+      |> Result.mapError (fun e -> FailedAnalysis(set.Name, e))
+
+    let sets =
+      let names = defaultArg cases (LoadCases.cases source)
+      LoadCases.select source (Some names) None
+      |> Result.mapError FailedSelection
+
+    let collect f items =
+      List.foldBack
+        (fun item acc ->
+          match f item, acc with
+          | Ok x, Ok rest -> Ok(x :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        items
+        (Ok [])
+
+    if source.Info.Units <> target.Info.Units then
+      Error(MismatchedUnits(source.Info.Units, target.Info.Units))
+    else
+      sets
+      |> Result.bind (collect analyse)
+      |> Result.bind (fun results ->
+        let supports =
+          results
+          |> List.collect (snd >> Map.toList >> List.map fst)
+          |> List.distinct
+
+        mapNodes tolerance pairs source target supports
+        |> Result.bind (fun mapping ->
+          let transferred =
+            results |> List.collect (fun (case, r) -> loads mapping case r)
+
+          let clash =
+            transferred |> List.tryFind (fun l -> target.Loads.ContainsKey l.Id)
+
+          match clash with
+          | Some l -> Error(ClashingLoad l.Id)
+          | None ->
+            let names = results |> List.map fst |> set
+
+            let combinations =
+              source.Combinations
+              |> Map.filter (fun id c ->
+                not (target.Combinations.ContainsKey id)
+                && c.Factors |> Map.forall (fun case _ -> names.Contains case))
+
+            Ok
+              { target with
+                  Loads =
+                    transferred
+                    |> List.fold (fun ls l -> Map.add l.Id l ls) target.Loads
+                  Combinations =
+                    combinations
+                    |> Map.fold
+                      (fun cs id c -> Map.add id c cs)
+                      target.Combinations }))
@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open System
+
+/// <summary>
+/// How the equations of motion are integrated in a transient analysis.
+/// </summary>
+type TransientMethod =
+  /// Step the full system of equations through time.
+  | DirectIntegration
+  /// Integrate the system projected onto its lowest modes.
+  | ModalSuperposition of modes: int
+
+/// <summary>
+/// Natural mode of vibration with a mass-normalised shape.
+/// </summary>
+type Mode =
+  { Number: int
+    /// Natural circular frequency in rad/s.
+    AngularFrequency: float
+    /// Displacement of each degree of freedom, scaled so that the modal
+    /// mass is one.
+    Shape: float array }
+
+/// <summary>
+/// Displacement, velocity and acceleration of each degree of freedom at
+/// each time step.
+/// </summary>
+type TransientResponse =
+  { Displacements: float array array
+    Velocities: float array array
+    Accelerations: float array array }
+
+/// <summary>
+/// Errors raised whilst integrating a transient response.
+/// </summary>
+type TransientError =
+  | InvalidTimeStep of step: float
+  | InvalidMode of mode: int * reason: string
+  | MismatchedLoads of step: int * expected: int * actual: int
+  | SingularMatrix of name: string
+  | UnstableTimeStep of step: float * critical: float
+  | InvalidIntegrator of reason: string
+
+[<RequireQualifiedAccess>]
+module TransientMethod =
+
+  let getAsString (m: TransientMethod) : string =
+    match m with
+    | DirectIntegration -> "direct"
+    | ModalSuperposition modes -> $"modal:{modes}"
+
+  /// <summary>
+  /// Parses a method name, e.g. "direct", or "modal:10" to superpose the
+  /// lowest ten modes.
+  /// </summary>
+  /// <param name="name">Method name, case-insensitive.</param>
+  /// <returns>Matching method, if any.</returns>
+  let tryParse (name: string) : TransientMethod option =
+    match name.Trim().ToLowerInvariant().Split(':') with
+    | [| "direct" |] -> Some DirectIntegration
+    | [| "modal"; count |] ->
+      match Int32.TryParse count with
+      | true, n when n > 0 -> Some(ModalSuperposition n)
+      | _ -> None
+    | _ -> None
+
+[<RequireQualifiedAccess>]
+module TransientError =
+
+  let getAsString (e: TransientError) : string =
+    match e with
+    | InvalidTimeStep step -> $"Time step {step} must be positive."
+    | InvalidMode(mode, reason) -> $"Mode {mode} {reason}."
+    | MismatchedLoads(step, expected, actual) ->
+      $"Loads at step {step} cover {actual} degrees of freedom, not {expected}."
+    | SingularMatrix name -> $"The {name} matrix is singular."
+    | UnstableTimeStep(step, critical) ->
+      $"Time step {step} exceeds the critical time step {critical:G4}."
+    | InvalidIntegrator reason -> $"Integrator {reason}."
+
+/// <summary>
+/// Transient response by modal superposition: the equations of motion are
+/// projected onto a truncated set of modes, each uncoupled modal equation
+/// is integrated exactly for loads varying linearly over a step, and the
+/// modal responses are summed. Far cheaper than direct integration when a
+/// few modes capture the response.
+/// </summary>
+[<RequireQualifiedAccess>]
+module ModalSuperposition =
+
+  /// Displacement and velocity of a unit-mass oscillator at each step.
+  let private states
+    (omega: float)
+    (zeta: float)
+    (dt: float)
+    (p: float array)
+    =
+    let k = omega * omega
+    let root = sqrt (1.0 - zeta * zeta)
+    let wd = omega * root
+    let e = exp (-zeta * omega * dt)
+    let s, c = sin (wd * dt), cos (wd * dt)
+    let r = 2.0 * zeta / (omega * dt)
+
+    let a = e * (zeta / root * s + c)
+    let b = e * s / wd
+
+    let z2 = 2.0 * zeta * zeta
+    let cs = ((1.0 - z2) / (wd * dt) - zeta / root) * s - (1.0 + r) * c
+    let cp = (r + e * cs) / k
+    let dp = (1.0 - r + e * ((z2 - 1.0) / (wd * dt) * s + r * c)) / k
+    let av = -e * omega / root * s
+    let bv = e * (c - zeta / root * s)
+
+    let cv =
+      (-1.0 / dt + e * ((omega / root + zeta / (dt * root)) * s + c / dt)) / k
+
+    let dv = (1.0 - e * (zeta / root * s + c)) / (k * dt)
+
+    let u = Array.zeroCreate p.Length
+    let v = Array.zeroCreate p.Length
+
+    for i in 0 .. p.Length - 2 do
+      u[i + 1] <- a * u[i] + b * v[i] + cp * p[i] + dp * p[i + 1]
+      v[i + 1] <- av * u[i] + bv * v[i] + cv * p[i] + dv * p[i + 1]
+
+    u, v
+
+  /// <summary>
+  /// Integrates a single-degree-of-freedom oscillator of unit mass from rest,
+  /// using the exact recurrence for piecewise-linear loading.
+  /// </summary>
+  /// <param name="omega">Natural circular frequency in rad/s.</param>
+  /// <param name="zeta">Damping ratio, in [0, 1).</param>
+  /// <param name="dt">Time step.</param>
+  /// <param name="p">Load at each step.</param>
+  /// <returns>Displacement at each step.</returns>
+  let oscillator
+    (omega: float)
+    (zeta: float)
+    (dt: float)
+    (p: float array)
+    : float array =
+    states omega zeta dt p |> fst
+
+  /// <summary>
+  /// Computes the response of a structure from rest by superposing the
+  /// response of its lowest modes. The acceleration of each mode follows
+  /// from its equation of motion, q̈ = p − 2ζω·q̇ − ω²·q.
+  /// </summary>
+  /// <param name="count">Number of modes to superpose.</param>
+  /// <param name="ratio">Damping ratio of a mode.</param>
+  /// <param name="modes">Computed modes, in any order.</param>
+  /// <param name="dt">Time step.</param>
+  /// <param name="loads">Load on each degree of freedom at each step.</param>
+  /// <returns>Response at each step, or TransientError.</returns>
+  let history
+    (count: int)
+    (ratio: Mode -> float)
+    (modes: Mode list)
+    (dt: float)
+    (loads: float array array)
+    : Result<TransientResponse, TransientError> =
+    let selected =
+      modes |> List.sortBy (fun x -> x.AngularFrequency) |> List.truncate count
+
+    let dofs =
+      selected |> List.tryHead |> Option.map (fun x -> x.Shape.Length)
+
+    let invalid =
+      selected
+      |> List.tryPick (fun x ->
+        match ratio x with
+        | _ when x.AngularFrequency <= 0.0 ->
+          Some(InvalidMode(x.Number, "has no positive frequency"))
+        | z when z < 0.0 || z >= 1.0 ->
+          Some(InvalidMode(x.Number, $"has damping ratio {z} not in [0, 1)"))
+        | _ when Some x.Shape.Length <> dofs ->
+          Some(InvalidMode(x.Number, "has a shape of different length"))
+        | _ -> None)
+
+    let mismatched =
+      dofs
+      |> Option.bind (fun n ->
+        loads
+        |> Array.tryFindIndex (fun f -> f.Length <> n)
+        |> Option.map (fun i -> MismatchedLoads(i, n, loads[i].Length)))
+
+    let zeros () = loads |> Array.map (Array.map (fun _ -> 0.0))
+
+    match invalid, mismatched, dofs with
+    | _ when dt <= 0.0 -> Error(InvalidTimeStep dt)
+    | Some e, _, _
+    | None, Some e, _ -> Error e
+    | None, None, None ->
+      Ok
+        { Displacements = zeros ()
+          Velocities = zeros ()
+          Accelerations = zeros () }
+    | None, None, Some n ->
+      let u, v, a = zeros (), zeros (), zeros ()
+
+      for x in selected do
+        let project f = Array.fold2 (fun s y z -> s + y * z) 0.0 x.Shape f
+        let omega, zeta = x.AngularFrequency, ratio x
+        let p = loads |> Array.map project
+        let q, dq = states omega zeta dt p
+
+        for i in 0 .. loads.Length - 1 do
+          let ddq = p[i] - 2.0 * zeta * omega * dq[i] - omega * omega * q[i]
+
+          for j in 0 .. n - 1 do
+            u[i][j] <- u[i][j] + x.Shape[j] * q[i]
+            v[i][j] <- v[i][j] + x.Shape[j] * dq[i]
+            a[i][j] <- a[i][j] + x.Shape[j] * ddq
+
+      Ok
+        { Displacements = u
+          Velocities = v
+          Accelerations = a }
+
+  /// <summary>
+  /// Computes the displacement history of a structure from rest by
+  /// superposing the response of its lowest modes.
+  /// </summary>
+  /// <param name="count">Number of modes to superpose.</param>
+  /// <param name="ratio">Damping ratio of a mode.</param>
+  /// <param name="modes">Computed modes, in any order.</param>
+  /// <param name="dt">Time step.</param>
+  /// <param name="loads">Load on each degree of freedom at each step.</param>
+  /// <returns>Displacement of each degree of freedom at each step.</returns>
+  let response
+    (count: int)
+    (ratio: Mode -> float)
+    (modes: Mode list)
+    (dt: float)
+    (loads: float array array)
+    : Result<float array array, TransientError> =
+    history count ratio modes dt loads
+    |> Result.map (fun r -> r.Displacements)
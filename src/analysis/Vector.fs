@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// Cartesian vector in global coordinates.
+/// </summary>
+type Vector3 = { X: float; Y: float; Z: float }
+
+[<RequireQualifiedAccess>]
+module Vector3 =
+
+  let zero = { X = 0.0; Y = 0.0; Z = 0.0 }
+
+  /// Position vector of a node.
+  let ofNode (n: Node) : Vector3 = { X = n.X; Y = n.Y; Z = n.Z }
+
+  let add (a: Vector3) (b: Vector3) : Vector3 =
+    { X = a.X + b.X
+      Y = a.Y + b.Y
+      Z = a.Z + b.Z }
+
+  let sub (a: Vector3) (b: Vector3) : Vector3 =
+    { X = a.X - b.X
+      Y = a.Y - b.Y
+      Z = a.Z - b.Z }
+
+  let scale (k: float) (a: Vector3) : Vector3 =
+    { X = k * a.X
+      Y = k * a.Y
+      Z = k * a.Z }
+
+  let dot (a: Vector3) (b: Vector3) : float = a.X * b.X + a.Y * b.Y + a.Z * b.Z
+
+  let cross (a: Vector3) (b: Vector3) : Vector3 =
+    { X = a.Y * b.Z - a.Z * b.Y
+      Y = a.Z * b.X - a.X * b.Z
+      Z = a.X * b.Y - a.Y * b.X }
+
+  let norm (a: Vector3) : float = sqrt (dot a a)
+
+  /// <summary>
+  /// Returns the local axes of a member along d: x along the member, y
+  /// normal to it and global Z, or along global Y when it is parallel to
+  /// Z, and z completing a right-handed set.
+  /// </summary>
+  /// <param name="d">Vector from the first node to the second.</param>
+  /// <returns>Unit vectors along local x, y and z.</returns>
+  let memberAxes (d: Vector3) : Vector3 * Vector3 * Vector3 =
+    let unit v = scale (1.0 / norm v) v
+    let x = unit d
+    let normal = cross { X = 0.0; Y = 0.0; Z = 1.0 } x
+
+    let y =
+      if norm normal <= 1e-9 then
+        { X = 0.0; Y = 1.0; Z = 0.0 }
+      else
+        unit normal
+
+    x, y, cross x y
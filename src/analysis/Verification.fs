@@ -0,0 +1,340 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Analysis
+
+open Gazelle.Model
+
+/// <summary>
+/// A quantity of a benchmark problem with a closed-form solution.
+/// </summary>
+type BenchmarkQuantity =
+  {
+    /// What is compared, e.g. "midspan deflection".
+    Name: string
+    /// Value from the closed-form solution.
+    Theoretical: float
+    /// Reads the computed value from the static response.
+    Read: StaticResult -> float option
+  }
+
+/// <summary>
+/// A model whose static response is known in closed form.
+/// </summary>
+type Benchmark =
+  { Name: string
+    Description: string
+    Model: Model
+    Quantities: BenchmarkQuantity list }
+
+/// <summary>
+/// Computed and theoretical values of one benchmark quantity.
+/// </summary>
+type BenchmarkCheck =
+  { Benchmark: string
+    Quantity: string
+    Computed: float
+    Theoretical: float
+    /// Difference from the theoretical value as a percentage of it.
+    PercentError: float
+    Passed: bool }
+
+/// <summary>
+/// Errors raised whilst analysing a benchmark problem.
+/// </summary>
+type VerificationError =
+  | FailedBenchmark of benchmark: string * error: StaticError
+  | MissingQuantity of benchmark: string * quantity: string
+
+[<RequireQualifiedAccess>]
+module VerificationError =
+
+  let getAsString (e: VerificationError) : string =
+    match e with
+    | FailedBenchmark(name, e) ->
+      $"Benchmark '{name}': {StaticError.getAsString e}"
+    | MissingQuantity(name, quantity) ->
+      $"Benchmark '{name}' has no computed {quantity}."
+
+/// <summary>
+/// Closed-form benchmark problems that verify the static solver: simply
+/// supported and fixed beams, pin-jointed trusses and a portal frame.
+/// </summary>
+/// <remarks>
+/// Cubic beam elements are exact at their nodes under nodal loads, so the
+/// beams and trusses agree with theory to rounding. The portal's closed
+/// form neglects axial shortening of its members, which are given a large
+/// area so that the difference is negligible. Each benchmark uses steel
+/// with E = 210 GPa.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Verification =
+
+  /// Largest percentage error of a passing quantity.
+  let tolerance = 0.1
+
+  let private modulus = 210e9
+
+  let private node id x y = id, { Id = id; X = x; Y = y; Z = 0.0 }
+
+  let private element id kind nodes properties =
+    id,
+    { Id = id
+      Type = kind
+      Nodes = nodes
+      Material = "steel"
+      Properties = Some(Map properties)
+      Releases = None }
+
+  let private support id node dofs =
+    id,
+    { Id = id
+      Type = "Fixed"
+      Node = node
+      Dof = dofs
+      Angle = None
+      Stiffness = None
+      Displacement = None }
+
+  let private force id node direction magnitude =
+    id,
+    { Id = id
+      Type = "Force"
+      Node = Some node
+      Element = None
+      Direction = direction
+      Magnitude = magnitude
+      Position = None
+      End = None
+      EndMagnitude = None
+      Datum = None
+      Gradient = None
+      Case = None }
+
+  let private model name nodes elements constraints loads =
+    { Info =
+        { Name = name
+          Description = None
+          Units = "SI"
+          Version = "1.0"
+          Dimensions = Some 2 }
+      Parameters = None
+      Gravity = None
+      Damping = None
+      TimeHistory = None
+      Nodes = Map nodes
+      Elements = Map elements
+      Materials =
+        Map
+          [ "steel",
+            { Id = "steel"
+              Name = "S355"
+              Type = "Steel"
+              ElasticModulus = modulus
+              Density = None
+              YieldStrength = None
+              ShearModulus = None
+              DampingRatio = None
+              ThermalExpansion = None } ]
+      Loads = Map loads
+      Combinations = Map.empty
+      Constraints = Map constraints
+      Masses = None
+      Panels = None }
+
+  let private quantity name theoretical read =
+    { Name = name
+      Theoretical = theoretical
+      Read = read }
+
+  let private displacement node dof (r: StaticResult) =
+    r.Displacements.TryFind node |> Option.bind (Map.tryFind dof)
+
+  let private reaction node dof (r: StaticResult) =
+    r.Reactions.TryFind node |> Option.bind (Map.tryFind dof)
+
+  let private memberForce id index (r: StaticResult) =
+    r.MemberForces.TryFind id
+    |> Option.bind (fun xs -> if index < xs.Length then Some xs[index] else None)
+
+  /// Beam of two members under a central point load.
+  let private beam name (fixity: string list) =
+    let span, i, p = 6.0, 8e-5, -50e3
+    let section = [ "area", 1e-2; "i", i ]
+
+    model
+      name
+      [ node "n1" 0.0 0.0; node "n2" (span / 2.0) 0.0; node "n3" span 0.0 ]
+      [ element "e1" "Frame2D" [ "n1"; "n2" ] section
+        element "e2" "Frame2D" [ "n2"; "n3" ] section ]
+      [ support "c1" "n1" ("Ux" :: "Uy" :: fixity)
+        support "c2" "n3" ("Uy" :: fixity) ]
+      [ force "l1" "n2" "Fy" p ],
+    span,
+    modulus * i,
+    p
+
+  let private simplySupported =
+    let m, l, ei, p = beam "Simply supported beam" []
+
+    { Name = m.Info.Name
+      Description = "Central point load P on span L"
+      Model = m
+      Quantities =
+        [ quantity
+            "midspan deflection PL³/48EI"
+            (p * l ** 3.0 / (48.0 * ei))
+            (displacement "n2" Uy)
+          quantity
+            "end rotation PL²/16EI"
+            (p * l ** 2.0 / (16.0 * ei))
+            (displacement "n1" Rz)
+          quantity "reaction P/2" (-p / 2.0) (reaction "n1" Uy)
+          quantity "midspan moment PL/4" (-p * l / 4.0) (memberForce "e1" 5) ] }
+
+  let private fixedEnded =
+    let m, l, ei, p = beam "Fixed beam" [ "Rz" ]
+
+    { Name = m.Info.Name
+      Description = "Central point load P on span L, both ends fixed"
+      Model = m
+      Quantities =
+        [ quantity
+            "midspan deflection PL³/192EI"
+            (p * l ** 3.0 / (192.0 * ei))
+            (displacement "n2" Uy)
+          quantity "reaction P/2" (-p / 2.0) (reaction "n1" Uy)
+          quantity "end moment PL/8" (-p * l / 8.0) (reaction "n1" Rz)
+          quantity "midspan moment PL/8" (-p * l / 8.0) (memberForce "e1" 5) ] }
+
+  /// Two bars from pinned supports meeting at a loaded apex.
+  let private twoBar =
+    let half, rise, area, p = 3.0, 4.0, 1e-3, -100e3
+    let length = sqrt (half ** 2.0 + rise ** 2.0)
+    let sin = rise / length
+    let section = [ "area", area ]
+
+    { Name = "Two-bar truss"
+      Description = "Apex load P on two bars at angle θ to the horizontal"
+      Model =
+        model
+          "Two-bar truss"
+          [ node "n1" 0.0 0.0; node "n2" half rise; node "n3" (2.0 * half) 0.0 ]
+          [ element "e1" "Truss2D" [ "n1"; "n2" ] section
+            element "e2" "Truss2D" [ "n3"; "n2" ] section ]
+          [ support "c1" "n1" [ "Ux"; "Uy" ]; support "c2" "n3" [ "Ux"; "Uy" ] ]
+          [ force "l1" "n2" "Fy" p ]
+      Quantities =
+        [ quantity "bar force P/2sinθ" (p / (2.0 * sin)) (memberForce "e1" 1)
+          quantity
+            "apex deflection PL/2EAsin²θ"
+            (p * length / (2.0 * modulus * area * sin ** 2.0))
+            (displacement "n2" Uy) ] }
+
+  /// Triangle of two rafters and a tie on a pin and a roller.
+  let private triangle =
+    let half, rise, area, p = 4.0, 3.0, 2e-3, -60e3
+    let rafter = sqrt (half ** 2.0 + rise ** 2.0)
+    let tan = rise / half
+    let section = [ "area", area ]
+
+    { Name = "Triangulated truss"
+      Description = "Apex load P on rafters at θ tied across span L"
+      Model =
+        model
+          "Triangulated truss"
+          [ node "n1" 0.0 0.0; node "n2" half rise; node "n3" (2.0 * half) 0.0 ]
+          [ element "e1" "Truss2D" [ "n1"; "n2" ] section
+            element "e2" "Truss2D" [ "n2"; "n3" ] section
+            element "e3" "Truss2D" [ "n1"; "n3" ] section ]
+          [ support "c1" "n1" [ "Ux"; "Uy" ]; support "c2" "n3" [ "Uy" ] ]
+          [ force "l1" "n2" "Fy" p ]
+      Quantities =
+        [ quantity
+            "rafter force P/2sinθ"
+            (p * rafter / (2.0 * rise))
+            (memberForce "e1" 1)
+          quantity "tie force P/2tanθ" (-p / (2.0 * tan)) (memberForce "e3" 1)
+          quantity
+            "roller movement PL/2EAtanθ"
+            (-p * 2.0 * half / (2.0 * modulus * area * tan))
+            (displacement "n3" Ux) ] }
+
+  /// Fixed-base portal under a horizontal load at its beam.
+  let private portal =
+    let h, l, area, ic, ib, hforce = 4.0, 6.0, 1.0, 1e-4, 2e-4, 10e3
+    let k = (ib / l) / (ic / h)
+    let column = [ "area", area; "i", ic ]
+
+    { Name = "Portal sway"
+      Description = "Horizontal load H on a fixed-base portal, k = (Ib/L)/(Ic/h)"
+      Model =
+        model
+          "Portal sway"
+          [ node "n1" 0.0 0.0; node "n2" 0.0 h; node "n3" l h; node "n4" l 0.0 ]
+          [ element "e1" "Frame2D" [ "n1"; "n2" ] column
+            element "e2" "Frame2D" [ "n2"; "n3" ] [ "area", area; "i", ib ]
+            element "e3" "Frame2D" [ "n4"; "n3" ] column ]
+          [ support "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+            support "c2" "n4" [ "Ux"; "Uy"; "Rz" ] ]
+          [ force "l1" "n2" "Fx" hforce ]
+      Quantities =
+        [ quantity
+            "sway Hh³(3k + 2)/12EIc(6k + 1)"
+            (hforce * h ** 3.0 * (3.0 * k + 2.0)
+             / (12.0 * modulus * ic * (6.0 * k + 1.0)))
+            (displacement "n2" Ux)
+          quantity "base shear H/2" (-hforce / 2.0) (reaction "n1" Ux) ] }
+
+  /// <summary>
+  /// Every built-in benchmark problem.
+  /// </summary>
+  let all: Benchmark list =
+    [ simplySupported; fixedEnded; twoBar; triangle; portal ]
+
+  /// <summary>
+  /// Analyses a benchmark and compares each quantity with theory.
+  /// </summary>
+  /// <param name="b">Benchmark problem.</param>
+  /// <returns>Check of each quantity, or the VerificationError.</returns>
+  let run (b: Benchmark) : Result<BenchmarkCheck list, VerificationError> =
+    let set =
+      { Name = "default"
+        Kind = LoadCase
+        Loads = b.Model.Loads |> Map.toList |> List.map (fun (_, l) -> 1.0, l) }
+
+    Static.analyse b.Model set
+    |> Result.mapError (fun e -> FailedBenchmark(b.Name, e))
+    |> Result.bind (fun r ->
+      let folder (q: BenchmarkQuantity) acc =
+        match q.Read r, acc with
+        | None, _ -> Error(MissingQuantity(b.Name, q.Name))
+        | _, Error e -> Error e
+        | Some computed, Ok rest ->
+          let error = 100.0 * abs (computed - q.Theoretical) / abs q.Theoretical
+
+          Ok(
+            { Benchmark = b.Name
+              Quantity = q.Name
+              Computed = computed
+              Theoretical = q.Theoretical
+              PercentError = error
+              Passed = error <= tolerance }
+            :: rest
+          )
+
+      List.foldBack folder b.Quantities (Ok []))
+
+  /// <summary>
+  /// Runs every built-in benchmark.
+  /// </summary>
+  /// <returns>Checks of all benchmarks, or the first VerificationError.</returns>
+  let runAll () : Result<BenchmarkCheck list, VerificationError> =
+    let folder b acc =
+      match run b, acc with
+      | Ok checks, Ok rest -> Ok(checks @ rest)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder all (Ok [])
@@ -50,6 +50,9 @@ type SAPModel =
 [<RequireQualifiedAccess>]
 module ETABS =
 
+  /// Indicates whether ETABS interop is compiled into this build.
+  let isAvailable = true
+
   /// Refreshes ETABS window, allowing any model changes to be displayed.
   let refreshView (s: SAPModel) : unit =
     match s with
@@ -190,6 +193,9 @@ module ETABS =
 [<RequireQualifiedAccess>]
 module ETABS =
 
+  /// Indicates whether ETABS interop is compiled into this build.
+  let isAvailable = false
+
   let start () : Result<unit, IOError> =
     Error(
       UnsupportedVersion
@@ -0,0 +1,726 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Collections.Generic
+open System.Globalization
+open System.Text.Json.Nodes
+
+/// Defect in an Abaqus input file.
+type private AbaqusException(line: int, reason: string) =
+  inherit Exception($"line {line}: {reason}")
+
+/// Keyword of an Abaqus input file, with its parameters and data lines.
+type private Keyword =
+  { Line: int
+    Name: string
+    Parameters: Map<string, string>
+    Data: (int * string list) list }
+
+/// <summary>
+/// Reads Abaqus input files (.inp) as the same document tree as a JSON
+/// model.
+/// </summary>
+/// <remarks>
+/// *NODE becomes nodes n1, n2, ... and *ELEMENT elements e1, e2, ...:
+/// Truss2D or Truss3D for T2D2 and T3D2, Frame2D for B21 and B23, Frame3D
+/// for B31 and B33, Shell for S3, S3R, S4 and S4R, and Spring for SPRING1
+/// and SPRING2. *SOLID SECTION, *SHELL SECTION, *BEAM SECTION (RECT, CIRC
+/// or PIPE) and *BEAM GENERAL SECTION give the elements of their sets
+/// properties and materials, *MATERIAL with *ELASTIC, *DENSITY,
+/// *EXPANSION and *PLASTIC gives materials, and trusses of materials with
+/// *NO COMPRESSION or *NO TENSION become cables or struts. *BOUNDARY gives
+/// supports and settlements, *RELEASE beam end releases and *SPRING spring
+/// stiffnesses. Each *STEP becomes a load case, named after the step, of
+/// its *CLOAD forces and moments and *DLOAD distributed loads (PX, PY and
+/// PZ along beams, P on shells and GRAV self-weight). Abaqus has no units,
+/// so values are taken as SI. Keywords that define other parts of a model
+/// stop the import with an error naming them; those that only control the
+/// analysis or its output are ignored.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Abaqus =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  /// Gazelle element types of Abaqus element types.
+  let private types =
+    Map
+      [ "T2D2", "Truss2D"
+        "T3D2", "Truss3D"
+        "B21", "Frame2D"
+        "B23", "Frame2D"
+        "B31", "Frame3D"
+        "B33", "Frame3D"
+        "S3", "Shell"
+        "S3R", "Shell"
+        "S4", "Shell"
+        "S4R", "Shell"
+        "SPRING1", "Spring"
+        "SPRING2", "Spring" ]
+
+  /// Abaqus element types of plane models.
+  let private planar = set [ "T2D2"; "B21"; "B23" ]
+
+  /// Freedoms of Abaqus degree of freedom numbers, also for plane models,
+  /// which rotate about 6.
+  let private freedoms = [| "Ux"; "Uy"; "Uz"; "Rx"; "Ry"; "Rz" |]
+
+  /// Freedoms held by the named boundary conditions.
+  let private conditions =
+    Map
+      [ "ENCASTRE", [ 1..6 ]
+        "PINNED", [ 1; 2; 3 ]
+        "XSYMM", [ 1; 5; 6 ]
+        "YSYMM", [ 2; 4; 6 ]
+        "ZSYMM", [ 3; 4; 5 ]
+        "XASYMM", [ 2; 3; 4 ]
+        "YASYMM", [ 1; 3; 5 ]
+        "ZASYMM", [ 1; 2; 6 ] ]
+
+  /// Keywords that control an analysis or its output rather than define the
+  /// model.
+  let private ignored =
+    set
+      [ "PREPRINT"
+        "RESTART"
+        "STATIC"
+        "FREQUENCY"
+        "BUCKLE"
+        "CONTROLS"
+        "MONITOR"
+        "OUTPUT"
+        "NODE OUTPUT"
+        "ELEMENT OUTPUT"
+        "NODE PRINT"
+        "EL PRINT"
+        "NODE FILE"
+        "EL FILE"
+        "ENERGY PRINT"
+        "PART"
+        "END PART"
+        "ASSEMBLY"
+        "END ASSEMBLY"
+        "END INSTANCE"
+        "DAMPING" ]
+
+  let private value (x: float) : JsonNode = JsonValue.Create x
+  let private text (x: string) : JsonNode = JsonValue.Create x
+
+  let private list (xs: JsonNode seq) : JsonNode = JsonArray(Array.ofSeq xs)
+
+  let private record (properties: (string * JsonNode) list) : JsonNode =
+    let o = JsonObject()
+
+    for name, x in properties do
+      o[name] <- x
+
+    o
+
+  let private fail (line: int) (reason: string) =
+    raise (AbaqusException(line, reason))
+
+  /// Fields of a data line, without the empty ones of trailing commas.
+  let private filled (fields: string list) = List.filter ((<>) "") fields
+
+  let private number (line: int) (field: string) =
+    match Double.TryParse(field, NumberStyles.Float, culture) with
+    | true, x when Double.IsFinite x -> x
+    | _ -> fail line $"'{field}' is not a number"
+
+  let private label (line: int) (field: string) =
+    match Int32.TryParse field with
+    | true, n -> n
+    | _ -> fail line $"'{field}' is not a label"
+
+  /// Splits a file into keywords and their data, joining lines continued
+  /// by a trailing comma.
+  let private keywords (source: string) : Keyword list =
+    let lines = ResizeArray<int * string>()
+    let mutable pending: (int * string) option = None
+
+    for i, line in Array.indexed (source.Split '\n') do
+      let line = line.Trim()
+
+      if line <> "" && not (line.StartsWith "**") then
+        let start, line =
+          match pending with
+          | Some(start, before) -> start, before + line
+          | None -> i + 1, line
+
+        if line.EndsWith ',' then
+          pending <- Some(start, line)
+        else
+          pending <- None
+          lines.Add(start, line)
+
+    let fields (line: string) =
+      line.Split ',' |> Array.map (fun f -> f.Trim()) |> List.ofArray
+
+    let parameter (field: string) =
+      match field.IndexOf '=' with
+      | -1 -> field.ToUpperInvariant(), ""
+      | i ->
+        field.Substring(0, i).Trim().ToUpperInvariant(),
+        field.Substring(i + 1).Trim().Trim('"')
+
+    let found = ResizeArray<Keyword>()
+
+    for line, content in lines do
+      if content.StartsWith '*' then
+        match fields (content.Substring 1) with
+        | name :: parameters ->
+          let options = StringSplitOptions.RemoveEmptyEntries
+          let words = name.ToUpperInvariant().Split(' ', options)
+
+          found.Add
+            { Line = line
+              Name = String.Join(" ", words)
+              Parameters = parameters |> List.map parameter |> Map.ofList
+              Data = [] }
+        | [] -> ()
+      elif found.Count = 0 then
+        fail line "data precedes any keyword"
+      else
+        let last = found[found.Count - 1]
+        let data = last.Data @ [ line, fields content ]
+        found[found.Count - 1] <- { last with Data = data }
+
+    List.ofSeq found
+
+  /// Area, second moments I11 and I22, and torsion constant of a beam
+  /// section of a standard shape.
+  let private shape (line: int) (kind: string) (dimensions: float list) =
+    match kind, dimensions with
+    | "RECT", a :: b :: _ ->
+      let long, short = max a b, min a b
+      let taper = 1.0 - short ** 4.0 / (12.0 * long ** 4.0)
+      let j = long * short ** 3.0 * (1.0 / 3.0 - 0.21 * short / long * taper)
+      a * b, a * b ** 3.0 / 12.0, b * a ** 3.0 / 12.0, j
+    | "CIRC", r :: _ ->
+      let i = Math.PI * r ** 4.0 / 4.0
+      Math.PI * r * r, i, i, 2.0 * i
+    | "PIPE", r :: t :: _ ->
+      let inner = r - t
+      let i = Math.PI * (r ** 4.0 - inner ** 4.0) / 4.0
+      Math.PI * (r * r - inner * inner), i, i, 2.0 * i
+    | _ -> fail line $"has unsupported section {kind}"
+
+  /// Model as a document tree.
+  let private translate (source: string) : JsonNode =
+    let nodes = SortedDictionary<int, float[]>()
+    let elements = SortedDictionary<int, string * string * int list>()
+    let nsets = Dictionary<string, int list>(StringComparer.OrdinalIgnoreCase)
+    let elsets = Dictionary<string, int list>(StringComparer.OrdinalIgnoreCase)
+    let properties = Dictionary<int, (string * float) list>()
+    let assigned = Dictionary<int, string>()
+    let ends = Dictionary<int * int, Set<string>>()
+    let held = SortedDictionary<int, Set<int>>()
+    let settled = Dictionary<int, Map<int, float>>()
+    let loads = JsonObject()
+    let counts = Dictionary<string, int>()
+
+    // Material properties by name, and whether a material only takes
+    // tension ("Cable") or compression ("Strut").
+    let materials =
+      Dictionary<string, Map<string, float>>(StringComparer.OrdinalIgnoreCase)
+
+    let variants = Dictionary<string, string>(StringComparer.OrdinalIgnoreCase)
+    let mutable title = None
+    let mutable material = None
+    let mutable case = None
+    let mutable steps = 0
+    let mutable gravity: (float * float list) option = None
+
+    let add (sets: Dictionary<string, int list>) name (labels: int list) =
+      match sets.TryGetValue name with
+      | true, before -> sets[name] <- before @ labels
+      | _ -> sets[name] <- labels
+
+    // Labels of a data field naming a label or a set.
+    let members (sets: Dictionary<string, int list>) line (field: string) =
+      match Int32.TryParse field with
+      | true, n -> [ n ]
+      | _ ->
+        match sets.TryGetValue field with
+        | true, labels -> labels
+        | _ -> fail line $"set '{field}' is not defined"
+
+    // Labels of a set's data, listed or generated from first, last, step.
+    let listed (k: Keyword) =
+      if k.Parameters.ContainsKey "GENERATE" then
+        [ for line, fields in k.Data do
+            match filled fields |> List.map (label line) with
+            | [ a; b ] -> yield! [ a..b ]
+            | [ a; b; s ] -> yield! [ a..s..b ]
+            | _ -> fail line "needs first, last and step" ]
+      else
+        [ for line, fields in k.Data do
+            for f in fields do
+              if f <> "" then
+                let sets = if k.Name = "NSET" then nsets else elsets
+                yield! members sets line f ]
+
+    let required (k: Keyword) name =
+      match k.Parameters.TryFind name with
+      | Some x when x <> "" -> x
+      | _ -> fail k.Line $"*{k.Name} needs {name}"
+
+    let numbers (k: Keyword) =
+      match k.Data with
+      | (line, fields) :: _ ->
+        filled fields |> List.map (number line)
+      | [] -> fail k.Line $"*{k.Name} needs data"
+
+    let setMaterial (k: Keyword) (fields: (string * float) list) =
+      match material with
+      | Some name ->
+        materials[name] <-
+          List.fold (fun acc (f, x) -> Map.add f x acc) materials[name] fields
+      | None -> fail k.Line $"*{k.Name} precedes *MATERIAL"
+
+    let caseOf (k: Keyword) =
+      match case with
+      | Some name -> name
+      | None -> fail k.Line $"*{k.Name} is outside a *STEP"
+
+    let addLoad (k: Keyword) (fields: (string * JsonNode) list) =
+      let name = caseOf k
+
+      let n =
+        match counts.TryGetValue name with
+        | true, n -> n + 1
+        | _ -> 1
+
+      counts[name] <- n
+      let id = $"{name}-{n}"
+      loads[id] <- record ([ "id", text id ] @ fields @ [ "case", text name ])
+
+    for k in keywords source do
+      match k.Name with
+      | "HEADING" ->
+        title <-
+          k.Data
+          |> List.tryHead
+          |> Option.map (fun (_, f) -> String.Join(", ", f))
+      | "NODE" ->
+        for line, fields in k.Data do
+          match filled fields with
+          | n :: xs when xs.Length >= 1 && xs.Length <= 3 ->
+            let xs = List.map (number line) xs
+            let at i = List.tryItem i xs |> Option.defaultValue 0.0
+            nodes[label line n] <- Array.init 3 at
+          | _ -> fail line "needs a label and coordinates"
+
+        match k.Parameters.TryFind "NSET" with
+        | Some name ->
+          add nsets name [ for line, f in k.Data -> label line f.Head ]
+        | None -> ()
+      | "ELEMENT" ->
+        let abaqus = (required k "TYPE").ToUpperInvariant()
+
+        let kind =
+          match types.TryFind abaqus with
+          | Some kind -> kind
+          | None -> fail k.Line $"has unsupported element type {abaqus}"
+
+        let labels =
+          [ for line, fields in k.Data do
+              match filled fields |> List.map (label line) with
+              | id :: connected ->
+                elements[id] <- (kind, abaqus, connected)
+                id
+              | [] -> () ]
+
+        match k.Parameters.TryFind "ELSET" with
+        | Some name -> add elsets name labels
+        | None -> ()
+      | "NSET" -> add nsets (required k "NSET") (listed k)
+      | "ELSET" -> add elsets (required k "ELSET") (listed k)
+      | "MATERIAL" ->
+        let name = required k "NAME"
+        material <- Some name
+        materials[name] <- Map.empty
+      | "ELASTIC" ->
+        match k.Parameters.TryFind "TYPE" with
+        | Some t when t.ToUpperInvariant() <> "ISOTROPIC" ->
+          fail k.Line $"has unsupported elasticity {t}"
+        | _ ->
+          match numbers k with
+          | e :: nu :: _ ->
+            let g = e / (2.0 + 2.0 * nu)
+            setMaterial k [ "elastic_modulus", e; "shear_modulus", g ]
+          | [ e ] -> setMaterial k [ "elastic_modulus", e ]
+          | [] -> fail k.Line "*ELASTIC needs a modulus"
+      | "DENSITY" -> setMaterial k [ "density", List.head (numbers k) ]
+      | "EXPANSION" ->
+        setMaterial k [ "thermal_expansion", List.head (numbers k) ]
+      | "PLASTIC" -> setMaterial k [ "yield_strength", List.head (numbers k) ]
+      | "NO COMPRESSION"
+      | "NO TENSION" ->
+        match material with
+        | Some name ->
+          variants[name] <-
+            if k.Name = "NO COMPRESSION" then "Cable" else "Strut"
+        | None -> fail k.Line $"*{k.Name} precedes *MATERIAL"
+      | "SOLID SECTION" ->
+        let area = List.head (numbers k)
+        let material = required k "MATERIAL"
+
+        for id in members elsets k.Line (required k "ELSET") do
+          assigned[id] <- material
+          properties[id] <- [ "area", area ]
+      | "SHELL SECTION" ->
+        let thickness = List.head (numbers k)
+        let material = required k "MATERIAL"
+
+        for id in members elsets k.Line (required k "ELSET") do
+          assigned[id] <- material
+          properties[id] <- [ "thickness", thickness ]
+      | "BEAM SECTION"
+      | "BEAM GENERAL SECTION" ->
+        let general = k.Name = "BEAM GENERAL SECTION"
+        let elset = required k "ELSET"
+
+        let kind =
+          match k.Parameters.TryFind "SECTION" with
+          | Some s -> s.ToUpperInvariant()
+          | None when general -> "GENERAL"
+          | None -> fail k.Line "*BEAM SECTION needs SECTION"
+
+        let area, i11, i22, j =
+          match kind, numbers k with
+          | "GENERAL", [ a; i11; _; i22; j ] -> a, i11, i22, j
+          | "GENERAL", _ ->
+            fail k.Line "needs A, I11, I12, I22 and J"
+          | _, dimensions -> shape k.Line kind dimensions
+
+        // General sections give their own modulus and shear modulus.
+        let material =
+          if general then
+            match List.tryItem 2 k.Data with
+            | Some(line, fields) ->
+              match filled fields |> List.map (number line) with
+              | e :: g :: rest ->
+                let density =
+                  k.Parameters.TryFind "DENSITY"
+                  |> Option.map (number k.Line)
+                  |> Option.map (fun rho -> "density", rho)
+                  |> Option.toList
+
+                let expansion =
+                  rest
+                  |> List.truncate 1
+                  |> List.map (fun a -> "thermal_expansion", a)
+
+                materials[elset] <-
+                  Map(
+                    [ "elastic_modulus", e; "shear_modulus", g ]
+                    @ density
+                    @ expansion
+                  )
+
+                elset
+              | _ -> fail line "needs E and G"
+            | None -> fail k.Line "needs a line of E and G"
+          else
+            required k "MATERIAL"
+
+        for id in members elsets k.Line elset do
+          assigned[id] <- material
+
+          properties[id] <-
+            match elements.TryGetValue id with
+            | true, ("Frame2D", _, _) -> [ "area", area; "i", i11 ]
+            | _ -> [ "area", area; "iy", i11; "iz", i22; "j", j ]
+      | "RELEASE" ->
+        for line, fields in k.Data do
+          match filled fields with
+          | [ target; side; combination ] ->
+            let side =
+              match side.ToUpperInvariant() with
+              | "S1" -> 0
+              | "S2" -> 1
+              | s -> fail line $"has end {s}"
+
+            for id in members elsets line target do
+              let plane =
+                match elements.TryGetValue id with
+                | true, (kind, _, _) -> kind.EndsWith "2D"
+                | _ -> false
+
+              let released =
+                match combination.ToUpperInvariant() with
+                | "ALLM" -> [ "M1"; "M2"; "T" ]
+                | c -> List.ofArray (c.Split '-')
+                |> List.map (function
+                  | "M1" when plane -> "Rz"
+                  | "M1" -> "Ry"
+                  | "M2" -> "Rz"
+                  | "T" -> "Rx"
+                  | m -> fail line $"has release {m}")
+                |> List.filter (fun r -> not plane || r = "Rz")
+
+              let before =
+                match ends.TryGetValue((id, side)) with
+                | true, s -> s
+                | _ -> Set.empty
+
+              ends[(id, side)] <- before + set released
+          | _ -> fail line "needs an element, end and release"
+      | "SPRING" ->
+        match k.Data with
+        | (line, dofs) :: (_, stiffness) :: _ ->
+          let dofs = filled dofs |> List.map (label line) |> List.distinct
+
+          match dofs, stiffness |> List.filter ((<>) "") with
+          | [ d ], k' :: _ when d >= 1 && d <= 6 ->
+            let property = freedoms[d - 1].ToLowerInvariant(), number line k'
+
+            for id in members elsets k.Line (required k "ELSET") do
+              let before =
+                match properties.TryGetValue id with
+                | true, ps -> ps
+                | _ -> []
+
+              properties[id] <- before @ [ property ]
+          | _ -> fail line "needs one freedom and a stiffness"
+        | _ -> fail k.Line "*SPRING needs freedoms and a stiffness"
+      | "BOUNDARY" ->
+        for line, fields in k.Data do
+          let fields = filled fields
+
+          let dofs, magnitude =
+            match fields with
+            | [ _; named ] when conditions.ContainsKey(named.ToUpperInvariant())
+              ->
+              conditions[named.ToUpperInvariant()], 0.0
+            | [ _; first ] -> [ label line first ], 0.0
+            | [ _; first; last ] -> [ label line first .. label line last ], 0.0
+            | [ _; first; last; u ] ->
+              [ label line first .. label line last ], number line u
+            | _ -> fail line "needs a node and freedoms"
+
+          for n in members nsets line fields.Head do
+            let before =
+              match held.TryGetValue n with
+              | true, s -> s
+              | _ -> Set.empty
+
+            held[n] <- before + set dofs
+
+            if magnitude <> 0.0 then
+              let imposed =
+                match settled.TryGetValue n with
+                | true, m -> m
+                | _ -> Map.empty
+
+              settled[n] <-
+                List.fold (fun m d -> Map.add d magnitude m) imposed dofs
+      | "STEP" ->
+        steps <- steps + 1
+
+        case <-
+          Some(
+            match k.Parameters.TryFind "NAME" with
+            | Some name when name <> "" -> name
+            | _ -> $"Step-{steps}"
+          )
+      | "END STEP" -> case <- None
+      | "CLOAD" ->
+        for line, fields in k.Data do
+          match filled fields with
+          | [ target; dof; magnitude ] ->
+            let d = label line dof
+            let x = number line magnitude
+
+            if d < 1 || d > 6 then
+              fail line $"has freedom {d}"
+
+            let force = d <= 3
+            let axis = freedoms[d - 1].Substring(1).ToLower()
+
+            for n in members nsets line target do
+              addLoad
+                k
+                [ "type", text (if force then "Force" else "Moment")
+                  "node", text $"n{n}"
+                  "direction", text ((if force then "F" else "M") + axis)
+                  "magnitude", value x ]
+          | _ -> fail line "needs a node, freedom and magnitude"
+      | "DLOAD" ->
+        for line, fields in k.Data do
+          match filled fields with
+          | _ :: kind :: magnitude :: direction when
+            kind.ToUpperInvariant() = "GRAV"
+            ->
+            let g = number line magnitude, List.map (number line) direction
+
+            match gravity with
+            | Some before when before <> g ->
+              fail line "has a second gravity"
+            | _ -> gravity <- Some g
+
+            addLoad
+              k
+              [ "type", text "SelfWeight"
+                "direction", text "Gravity"
+                "magnitude", value 1.0 ]
+          | [ target; kind; magnitude ] ->
+            let x = number line magnitude
+
+            let load =
+              match kind.ToUpperInvariant() with
+              | "PX" -> "Distributed", "Fx", x
+              | "PY" -> "Distributed", "Fy", x
+              | "PZ" -> "Distributed", "Fz", x
+              // Abaqus pressures push against the normal.
+              | "P" -> "Pressure", "Normal", -x
+              | other -> fail line $"has unsupported load {other}"
+
+            for id in members elsets line target do
+              let type', direction, magnitude = load
+
+              addLoad
+                k
+                [ "type", text type'
+                  "element", text $"e{id}"
+                  "direction", text direction
+                  "magnitude", value magnitude ]
+          | _ -> fail line "needs an element, load and magnitude"
+      | "INSTANCE" when not k.Data.IsEmpty ->
+        fail k.Line "moves its instance, which is not supported"
+      | "INSTANCE" -> ()
+      | name when ignored.Contains name -> ()
+      | name -> fail k.Line $"*{name} is not supported"
+
+    // Plane models have plane elements, besides any springs, only.
+    let plane =
+      let kinds = [ for _, abaqus, _ in elements.Values -> abaqus ]
+
+      kinds |> List.exists planar.Contains
+      && kinds
+         |> List.forall (fun t -> planar.Contains t || t.StartsWith "SPRING")
+
+    let available = if plane then [ 1; 2; 6 ] else [ 1..6 ]
+
+    let elementNodes =
+      record
+        [ for KeyValue(id, (kind, _, connected)) in elements ->
+            let kind =
+              match assigned.TryGetValue id with
+              | true, m when kind.StartsWith "Truss" ->
+                defaultArg (Option.ofObj (variants.GetValueOrDefault m)) kind
+              | _ -> kind
+
+            let released =
+              [ for side, n in List.indexed connected |> List.truncate 2 do
+                  match ends.TryGetValue((id, side)) with
+                  | true, dofs when not dofs.IsEmpty ->
+                    $"n{n}", list [ for d in dofs -> text d ]
+                  | _ -> () ]
+
+            $"e{id}",
+            record
+              [ "id", text $"e{id}"
+                "type", text kind
+                "nodes", list [ for n in connected -> text $"n{n}" ]
+                "material",
+                text (
+                  match assigned.TryGetValue id with
+                  | true, m -> m
+                  | _ -> ""
+                )
+                match properties.TryGetValue id with
+                | true, ps ->
+                  "properties", record [ for name, x in ps -> name, value x ]
+                | _ -> ()
+                if not released.IsEmpty then
+                  "releases", record released ] ]
+
+    let materialNodes =
+      record
+        [ for KeyValue(name, fields) in materials ->
+            name,
+            record (
+              [ "id", text name
+                "name", text name
+                "type", text "Generic"
+                "elastic_modulus",
+                value (defaultArg (fields.TryFind "elastic_modulus") 0.0) ]
+              @ [ for KeyValue(field, x) in fields do
+                    if field <> "elastic_modulus" then
+                      field, value x ]
+            ) ]
+
+    let constraints =
+      record
+        [ for KeyValue(n, dofs) in held ->
+            let dofs = dofs |> Set.filter (fun d -> List.contains d available)
+            let translations = available |> List.filter (fun d -> d <= 3)
+
+            let type' =
+              match Set.toList dofs with
+              | all when all = available -> "Fixed"
+              | all when all = translations -> "Pinned"
+              | _ -> "Partial"
+
+            let imposed =
+              match settled.TryGetValue n with
+              | true, m -> m |> Map.filter (fun d _ -> dofs.Contains d)
+              | _ -> Map.empty
+
+            $"s{n}",
+            record
+              [ "id", text $"s{n}"
+                "type", text type'
+                "node", text $"n{n}"
+                "dof", list [ for d in dofs -> text freedoms[d - 1] ]
+                if not imposed.IsEmpty then
+                  "displacement",
+                  record
+                    [ for KeyValue(d, u) in imposed ->
+                        freedoms[d - 1], value u ] ] ]
+
+    record
+      [ "info",
+        record
+          [ "name", text (defaultArg title "Abaqus model")
+            "units", text "SI"
+            "version", text "1.0"
+            "dimensions", JsonValue.Create(if plane then 2 else 3) ]
+        match gravity with
+        | Some(g, direction) ->
+          "gravity",
+          record
+            [ "magnitude", value g
+              "direction", list [ for x in direction -> value x ] ]
+        | None -> ()
+        "nodes",
+        record
+          [ for KeyValue(id, p) in nodes ->
+              $"n{id}",
+              record
+                [ "id", text $"n{id}"
+                  "x", value p[0]
+                  "y", value p[1]
+                  "z", value p[2] ] ]
+        "elements", elementNodes
+        "materials", materialNodes
+        "constraints", constraints
+        "loads", loads
+        "combinations", JsonObject() ]
+
+  /// <summary>
+  /// Parses an Abaqus input file into a document tree.
+  /// </summary>
+  /// <param name="text">Abaqus input file.</param>
+  /// <returns>Document tree, or MalformedModel naming the defect.</returns>
+  let internal parseNode (text: string) : Result<JsonNode, ModelError> =
+    try
+      Ok(translate text)
+    with :? AbaqusException as ex ->
+      Error(MalformedModel ex.Message)
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Nodal degree of freedom: a translation or rotation about a global axis.
+/// </summary>
+type Dof =
+  | Ux
+  | Uy
+  | Uz
+  | Rx
+  | Ry
+  | Rz
+
+[<RequireQualifiedAccess>]
+module Dof =
+
+  /// Every degree of freedom, in assembly order.
+  let all = [ Ux; Uy; Uz; Rx; Ry; Rz ]
+
+  /// Degrees of freedom of a plane model in XY.
+  let plane = [ Ux; Uy; Rz ]
+
+  let getAsString (d: Dof) : string =
+    match d with
+    | Ux -> "Ux"
+    | Uy -> "Uy"
+    | Uz -> "Uz"
+    | Rx -> "Rx"
+    | Ry -> "Ry"
+    | Rz -> "Rz"
+
+  /// <summary>
+  /// Parses a degree of freedom name, e.g. from a constraint.
+  /// </summary>
+  /// <param name="name">Name such as "Uy" or "Rz".</param>
+  /// <returns>Matching degree of freedom, if any.</returns>
+  let tryParse (name: string) : Dof option =
+    all |> List.tryFind (fun d -> getAsString d = name)
+
+  /// <summary>
+  /// Returns the degree of freedom a load direction acts along, so that
+  /// forces load translations and moments load rotations.
+  /// </summary>
+  /// <param name="direction">Load direction such as "Fy" or "Mz".</param>
+  /// <returns>Matching degree of freedom, if any.</returns>
+  let ofDirection (direction: string) : Dof option =
+    match direction with
+    | "Fx" -> Some Ux
+    | "Fy" -> Some Uy
+    | "Fz" -> Some Uz
+    | "Mx" -> Some Rx
+    | "My" -> Some Ry
+    | "Mz" -> Some Rz
+    | _ -> None
+
+  /// <summary>
+  /// Returns the degrees of freedom an element type provides at its nodes.
+  /// </summary>
+  /// <param name="elementType">Element type such as "Frame2D".</param>
+  /// <returns>Active degrees of freedom, if the type is known.</returns>
+  let ofElementType (elementType: string) : Dof list option =
+    match elementType with
+    | "Truss2D" -> Some [ Ux; Uy ]
+    | "Beam2D" -> Some [ Uy; Rz ]
+    | "Frame2D" -> Some [ Ux; Uy; Rz ]
+    | "Truss3D"
+    | "Cable"
+    | "Strut" -> Some [ Ux; Uy; Uz ]
+    | "Beam3D" -> Some [ Uy; Uz; Rx; Ry; Rz ]
+    | "Frame3D"
+    | "Spring"
+    | "RigidLink"
+    | "Beam"
+    | "Plate"
+    | "Shell" -> Some all
+    | _ -> None
+
+  /// <summary>
+  /// Returns the degrees of freedom a model's declared dimensions allow.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Plane freedoms for a 2D model, otherwise all.</returns>
+  let ofDimensions (m: Model) : Dof list =
+    match m.Info.Dimensions with
+    | Some 2 -> plane
+    | _ -> all
+
+  /// <summary>
+  /// Returns the degrees of freedom the elements connected to a node
+  /// provide between them.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="node">Node ID.</param>
+  /// <returns>
+  /// Active degrees of freedom, or None when no element connects the node
+  /// or any connected element type is unknown.
+  /// </returns>
+  let ofNode (m: Model) (node: string) : Dof list option =
+    let provided =
+      [ for KeyValue(_, e) in m.Elements do
+          if List.contains node e.Nodes then
+            ofElementType e.Type ]
+
+    if provided.IsEmpty || List.contains None provided then
+      None
+    else
+      Some(provided |> List.choose id |> List.concat |> List.distinct)
@@ -0,0 +1,369 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Dimensions of the generated simply supported beam, in SI units.
+/// </summary>
+type BeamOptions =
+  {
+    /// Length between the supports.
+    Span: float
+    /// Point load at midspan.
+    Load: float
+  }
+
+/// <summary>
+/// Dimensions of the generated truss and portal frame, in SI units.
+/// </summary>
+type BayOptions =
+  {
+    /// Distance between the supports.
+    Width: float
+    /// Depth of the truss, or height of the frame's columns.
+    Height: float
+    /// Point load at each loaded node.
+    Load: float
+  }
+
+/// <summary>
+/// Dimensions of the generated cable-stayed bridge, in SI units.
+/// </summary>
+type CableStayedOptions =
+  {
+    /// Deck length between the end supports.
+    Span: float
+    /// Height of the pylon above the deck.
+    PylonHeight: float
+    /// Number of stays on each side of the pylon in a fan arrangement.
+    CablesPerSide: int
+    /// Initial tension in each stay.
+    Pretension: float
+    /// Traffic load applied at each stay anchorage.
+    LiveLoad: float
+  }
+
+/// <summary>
+/// Errors raised when generating an example model.
+/// </summary>
+type ExampleError = InvalidOption of name: string * reason: string
+
+[<RequireQualifiedAccess>]
+module ExampleError =
+
+  let getAsString (e: ExampleError) : string =
+    match e with
+    | InvalidOption(name, reason) -> $"Option '{name}' {reason}."
+
+/// <summary>
+/// Generates realistic example models that exercise the engine end to end.
+/// </summary>
+[<RequireQualifiedAccess>]
+module Examples =
+
+  /// A 6 m beam carrying 10 kN at midspan.
+  let defaultBeam: BeamOptions = { Span = 6.0; Load = 10e3 }
+
+  /// An 8 m Warren truss, 2 m deep, carrying 20 kN at each top node.
+  let defaultTruss: BayOptions =
+    { Width = 8.0
+      Height = 2.0
+      Load = 20e3 }
+
+  /// A 6 m portal frame with 4 m columns carrying 20 kN at each knee.
+  let defaultFrame: BayOptions =
+    { Width = 6.0
+      Height = 4.0
+      Load = 20e3 }
+
+  /// A 200 m single-pylon bridge with six pretensioned stays each side.
+  let defaultCableStayed =
+    { Span = 200.0
+      PylonHeight = 50.0
+      CablesPerSide = 6
+      Pretension = 2e6
+      LiveLoad = 1e5 }
+
+  let private node id x y = id, { Id = id; X = x; Y = y; Z = 0.0 }
+
+  let private element id elementType nodes material properties =
+    id,
+    { Id = id
+      Type = elementType
+      Nodes = nodes
+      Material = material
+      Properties = Some(Map properties)
+      Releases = None }
+
+  let private load id node direction magnitude case =
+    id,
+    { Id = id
+      Type = "Force"
+      Node = node
+      Element = None
+      Direction = direction
+      Magnitude = magnitude
+      Position = None
+      End = None
+      EndMagnitude = None
+      Datum = None
+      Gradient = None
+      Case = Some case }
+
+  let private support id supportType node dofs =
+    id,
+    { Id = id
+      Type = supportType
+      Node = node
+      Dof = dofs
+      Angle = None
+      Stiffness = None
+      Displacement = None }
+
+  let private steel =
+    "steel",
+    { Id = "steel"
+      Name = "S355"
+      Type = "Steel"
+      ElasticModulus = 210e9
+      Density = Some 7850.0
+      YieldStrength = Some 355e6
+      ShearModulus = None
+      DampingRatio = None
+      ThermalExpansion = None }
+
+  /// Steel model in the XY plane, in SI units, without combinations.
+  let private planar name description nodes elements loads constraints =
+    { Info =
+        { Name = name
+          Description = Some description
+          Units = "SI"
+          Version = "1.0"
+          Dimensions = Some 2 }
+      Parameters = None
+      Gravity = None
+      Damping = None
+      TimeHistory = None
+      Nodes = Map nodes
+      Elements = Map elements
+      Materials = Map [ steel ]
+      Loads = Map loads
+      Combinations = Map.empty
+      Constraints = Map constraints
+      Masses = None
+      Panels = None }
+
+  let private positive name (x: float) =
+    if x > 0.0 then
+      Ok x
+    else
+      Error(InvalidOption(name, "must be positive"))
+
+  /// <summary>
+  /// Generates a simply supported Frame2D beam in the XY plane, pinned at
+  /// one end and on a roller at the other, with a point load at midspan
+  /// ("LL").
+  /// </summary>
+  /// <param name="options">Beam dimensions.</param>
+  /// <returns>Model, or the first invalid option.</returns>
+  let beam (options: BeamOptions) : Result<Model, ExampleError> =
+    positive "span" options.Span
+    |> Result.map (fun span ->
+      let section = [ "area", 5e-3; "i", 8e-5 ]
+
+      planar
+        "Simple beam"
+        $"{span} m simply supported beam"
+        [ node "n1" 0.0 0.0; node "n2" (span / 2.0) 0.0; node "n3" span 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] "steel" section
+          element "e2" "Frame2D" [ "n2"; "n3" ] "steel" section ]
+        [ load "l1" (Some "n2") "Fy" -options.Load "LL" ]
+        [ support "c1" "Pinned" "n1" [ "Ux"; "Uy" ]
+          support "c2" "Roller" "n3" [ "Uy" ] ])
+
+  /// <summary>
+  /// Generates a two-bay Warren truss of Truss2D bars in the XY plane,
+  /// pinned at one end and on a roller at the other, with a point load at
+  /// each top node ("LL").
+  /// </summary>
+  /// <param name="options">Truss dimensions.</param>
+  /// <returns>Model, or the first invalid option.</returns>
+  let truss (options: BayOptions) : Result<Model, ExampleError> =
+    positive "width" options.Width
+    |> Result.bind (fun w ->
+      positive "height" options.Height |> Result.map (fun h -> w, h))
+    |> Result.map (fun (w, h) ->
+      let bar = [ "area", 2e-3 ]
+
+      let bars =
+        [ "n1", "n2"
+          "n2", "n3"
+          "n4", "n5"
+          "n1", "n4"
+          "n4", "n2"
+          "n2", "n5"
+          "n5", "n3" ]
+
+      planar
+        "Truss"
+        $"{w} m Warren truss, {h} m deep"
+        [ node "n1" 0.0 0.0
+          node "n2" (w / 2.0) 0.0
+          node "n3" w 0.0
+          node "n4" (w / 4.0) h
+          node "n5" (3.0 * w / 4.0) h ]
+        [ for i, (a, b) in List.indexed bars ->
+            element $"e{i + 1}" "Truss2D" [ a; b ] "steel" bar ]
+        [ load "l1" (Some "n4") "Fy" -options.Load "LL"
+          load "l2" (Some "n5") "Fy" -options.Load "LL" ]
+        [ support "c1" "Pinned" "n1" [ "Ux"; "Uy" ]
+          support "c2" "Roller" "n3" [ "Uy" ] ])
+
+  /// <summary>
+  /// Generates a fixed-base portal frame of Frame2D members in the XY
+  /// plane, with a point load down each knee ("LL") and half of it
+  /// sideways at the left knee ("WL").
+  /// </summary>
+  /// <param name="options">Frame dimensions.</param>
+  /// <returns>Model, or the first invalid option.</returns>
+  let frame (options: BayOptions) : Result<Model, ExampleError> =
+    positive "width" options.Width
+    |> Result.bind (fun w ->
+      positive "height" options.Height |> Result.map (fun h -> w, h))
+    |> Result.map (fun (w, h) ->
+      let column = [ "area", 6e-3; "i", 1e-4 ]
+      let rafter = [ "area", 5e-3; "i", 8e-5 ]
+      let fixity = [ "Ux"; "Uy"; "Rz" ]
+
+      planar
+        "Portal frame"
+        $"{w} m portal frame with {h} m columns"
+        [ node "n1" 0.0 0.0
+          node "n2" 0.0 h
+          node "n3" w h
+          node "n4" w 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] "steel" column
+          element "e2" "Frame2D" [ "n2"; "n3" ] "steel" rafter
+          element "e3" "Frame2D" [ "n3"; "n4" ] "steel" column ]
+        [ load "l1" (Some "n2") "Fy" -options.Load "LL"
+          load "l2" (Some "n3") "Fy" -options.Load "LL"
+          load "l3" (Some "n2") "Fx" (options.Load / 2.0) "WL" ]
+        [ support "c1" "Fixed" "n1" fixity; support "c2" "Fixed" "n4" fixity ])
+
+  /// <summary>
+  /// Generates a single-pylon, fan-stayed bridge in the XY plane. The deck
+  /// and pylon are Frame2D members; the stays are "Cable" elements carrying
+  /// a "pretension" property, loaded by self-weight ("DL") and traffic at
+  /// each anchorage ("LL"), combined as "ULS1".
+  /// </summary>
+  /// <param name="options">Bridge dimensions.</param>
+  /// <returns>Model, or the first invalid option.</returns>
+  let cableStayed
+    (options: CableStayedOptions)
+    : Result<Model, ExampleError> =
+    let o = options
+
+    match o with
+    | _ when o.Span <= 0.0 -> Error(InvalidOption("span", "must be positive"))
+    | _ when o.PylonHeight <= 0.0 ->
+      Error(InvalidOption("height", "must be positive"))
+    | _ when o.CablesPerSide < 1 ->
+      Error(InvalidOption("cables", "must be at least 1"))
+    | _ when o.Pretension < 0.0 ->
+      Error(InvalidOption("pretension", "must not be negative"))
+    | _ ->
+      let n = o.CablesPerSide
+      let spacing = o.Span / float (2 * n)
+      // Deck nodes n1..n(2n+1) from the left support; the pylon stands on
+      // the middle one and n(2n+2) is its top.
+      let deck = [ 1 .. 2 * n + 1 ] |> List.map (sprintf "n%d")
+      let middle = deck[n]
+      let top = $"n{2 * n + 2}"
+      let anchorages = deck |> List.filter ((<>) middle)
+
+      let nodes =
+        [ for i, id in List.indexed deck do
+            node id (float i * spacing - o.Span / 2.0) 0.0
+          node top 0.0 o.PylonHeight ]
+
+      let girder = [ "area", 0.5; "i", 0.2 ]
+      let pylon = [ "area", 1.0; "i", 0.5 ]
+      let stay = [ "area", 5e-3; "pretension", o.Pretension ]
+
+      let members =
+        [ for a, b in List.pairwise deck do
+            "Frame2D", [ a; b ], "steel", girder
+          "Frame2D", [ middle; top ], "steel", pylon
+          for a in anchorages do
+            "Cable", [ top; a ], "strand", stay ]
+
+      let elements =
+        members
+        |> List.mapi (fun i (t, ns, material, properties) ->
+          element $"e{i + 1}" t ns material properties)
+
+      let selfWeight =
+        "l1",
+        { Id = "l1"
+          Type = "SelfWeight"
+          Node = None
+          Element = None
+          Direction = "Gravity"
+          Magnitude = 1.0
+          Position = None
+          End = None
+          EndMagnitude = None
+          Datum = None
+          Gradient = None
+          Case = Some "DL" }
+
+      let traffic =
+        anchorages
+        |> List.mapi (fun i a ->
+          load $"l{i + 2}" (Some a) "Fy" -o.LiveLoad "LL")
+
+      let material id name fy =
+        id,
+        { Id = id
+          Name = name
+          Type = "Steel"
+          ElasticModulus = if id = "strand" then 195e9 else 210e9
+          Density = Some 7850.0
+          YieldStrength = Some fy
+          ShearModulus = None
+          DampingRatio = None
+          ThermalExpansion = None }
+
+      Ok
+        { Info =
+            { Name = "Cable-stayed bridge"
+              Description =
+                Some $"{o.Span} m single-pylon bridge with {2 * n} stays"
+              Units = "SI"
+              Version = "1.0"
+              Dimensions = Some 2 }
+          Parameters = None
+          Gravity = None
+          Damping = None
+          TimeHistory = None
+          Nodes = Map nodes
+          Elements = Map elements
+          Materials =
+            Map
+              [ material "steel" "S355" 355e6
+                material "strand" "Y1860 strand" 1860e6 ]
+          Loads = Map(selfWeight :: traffic)
+          Combinations =
+            Map
+              [ "ULS1",
+                { Id = "ULS1"
+                  Factors = Map [ "DL", 1.35; "LL", 1.5 ] } ]
+          Constraints =
+            Map
+              [ support "c1" "Pinned" (List.head deck) [ "Ux"; "Uy" ]
+                support "c2" "Fixed" middle [ "Ux"; "Uy"; "Rz" ]
+                support "c3" "Roller" (List.last deck) [ "Uy" ] ]
+          Masses = None
+          Panels = None }
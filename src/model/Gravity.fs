@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Resolves the gravity acting on a model, so that vertically-spanning or
+/// rotated models are not tied to a Y-down assumption.
+/// </summary>
+[<RequireQualifiedAccess>]
+[<CompilationRepresentation(CompilationRepresentationFlags.ModuleSuffix)>]
+module Gravity =
+
+  /// Standard gravity in metres per second squared.
+  [<Literal>]
+  let Standard = 9.80665
+
+  /// <summary>
+  /// Returns standard gravity along -Y in the model's unit system.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Default gravity.</returns>
+  let defaultFor (m: Model) : Gravity =
+    let metres =
+      match UnitSystem.tryFind m.Info.Units with
+      | Ok units -> units.Length
+      | Error _ -> 1.0
+
+    { Magnitude = Standard / metres
+      Direction = [ 0.0; -1.0; 0.0 ] }
+
+  /// <summary>
+  /// Returns the model's gravity, or the default when none is declared.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Gravity acting on the model.</returns>
+  let resolve (m: Model) : Gravity =
+    m.Gravity |> Option.defaultWith (fun () -> defaultFor m)
+
+  /// <summary>
+  /// Returns the acceleration vector of a gravity definition.
+  /// </summary>
+  /// <param name="g">Gravity.</param>
+  /// <returns>
+  /// Acceleration as (x, y, z) in model units, or None when the direction is
+  /// not a non-zero, three-component vector.
+  /// </returns>
+  let acceleration (g: Gravity) : (float * float * float) option =
+    match g.Direction with
+    | [ x; y; z ] when x <> 0.0 || y <> 0.0 || z <> 0.0 ->
+      let k = g.Magnitude / sqrt (x * x + y * y + z * z)
+      Some(k * x, k * y, k * z)
+    | _ -> None
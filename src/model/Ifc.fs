@@ -0,0 +1,1050 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Collections.Generic
+open System.Globalization
+open System.Text.Json.Nodes
+open System.Text.RegularExpressions
+
+/// Defect in an IFC file, or a part of it that cannot be imported.
+type private IfcException(reason: string) =
+  inherit Exception(reason)
+
+/// Attribute value of an entity instance in a STEP file.
+type private StepValue =
+  | Unset
+  | Text of string
+  | Real of float
+  | Enumeration of string
+  | Reference of int
+  | Aggregate of StepValue list
+  /// Value of a defined type, e.g. IFCBOOLEAN(.T.).
+  | Typed of string * StepValue
+
+/// Entity instance, e.g. #12=IFCCARTESIANPOINT((0.,0.,0.)).
+type private Instance =
+  { Id: int
+    Type: string
+    Arguments: StepValue list }
+
+/// <summary>
+/// Reads the structural analysis model of an IFC file, as exported from
+/// BIM authoring tools, as the same document tree as a JSON model.
+/// </summary>
+/// <remarks>
+/// IFC files are STEP (ISO 10303-21) files of IFC2x3 or IFC4 entities.
+/// Point connections become nodes and curve members become two-node
+/// members between the nodes at their ends: Truss3D for pin-jointed
+/// members, Cable for cables and tension members, Strut for compression
+/// members and Frame3D otherwise. Members take their material's mechanical
+/// properties and the area, second moments of area and torsion constant of
+/// rectangular, circular, hollow and I-shaped profiles, with the profile's
+/// x and y axes along the member's y and z axes. Boundary conditions of
+/// point connections become supports, rigid where the condition is true
+/// or a negative stiffness and elastic where it is a positive one; bending
+/// rotations left free where members meet connections become releases.
+/// Single forces at point connections and on members, and uniform linear
+/// forces along members, become loads in the load case of the load group
+/// they are assigned to, and load combinations become combinations. The
+/// model is in SI units, converted from the file's, with gravity along -Z
+/// as in IFC.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Ifc =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  /// Runs of \X2\ code units and \X4\ code points, \X\ bytes and \S\
+  /// characters of the upper half of ISO 8859-1 in STEP strings.
+  let private wide = Regex(@"\\X2\\((?:[0-9A-Fa-f]{4})*)\\X0\\")
+  let private wider = Regex(@"\\X4\\((?:[0-9A-Fa-f]{8})*)\\X0\\")
+  let private hex = Regex(@"\\X\\([0-9A-Fa-f]{2})")
+  let private upper = Regex(@"\\S\\(.)")
+
+  /// Decodes the escapes of a STEP string.
+  let private decode (s: string) : string =
+    let run (width: int) (m: Match) =
+      let digits = m.Groups[1].Value
+
+      String.Join(
+        "",
+        [ for i in 0..width .. digits.Length - width ->
+            let code = Convert.ToInt32(digits.Substring(i, width), 16)
+
+            if width = 4 then
+              string (char code)
+            else
+              Char.ConvertFromUtf32 code ]
+      )
+
+    let s = wide.Replace(s, MatchEvaluator(run 4))
+    let s = wider.Replace(s, MatchEvaluator(run 8))
+
+    let byte (m: Match) =
+      string (char (Convert.ToInt32(m.Groups[1].Value, 16)))
+
+    let s = hex.Replace(s, MatchEvaluator byte)
+
+    let s = upper.Replace(s, fun m -> string (char (int m.Value[3] + 128)))
+    s.Replace(@"\\", @"\")
+
+  /// Reads the entity instances of the DATA section of a STEP file.
+  let private instances (text: string) : Dictionary<int, Instance> =
+    let position = ref 0
+
+    let at () =
+      if position.Value < text.Length then text[position.Value] else '\000'
+
+    let advance () = position.Value <- position.Value + 1
+
+    let startsWith (s: string) =
+      String.CompareOrdinal(text, position.Value, s, 0, s.Length) = 0
+
+    let fail reason =
+      let before = text.Substring(0, min position.Value text.Length)
+      let line = 1 + (before |> Seq.filter ((=) '\n') |> Seq.length)
+      raise (IfcException $"line {line}: {reason}")
+
+    let rec skip () =
+      while position.Value < text.Length && Char.IsWhiteSpace(at ()) do
+        advance ()
+
+      if startsWith "/*" then
+        let close =
+          text.IndexOf("*/", position.Value + 2, StringComparison.Ordinal)
+
+        if close < 0 then
+          fail "unterminated comment"
+
+        position.Value <- close + 2
+        skip ()
+
+    let expect (c: char) =
+      skip ()
+
+      if at () <> c then
+        fail $"expected '{c}'"
+
+      advance ()
+
+    let word () =
+      let start = position.Value
+
+      while Char.IsLetterOrDigit(at ()) || at () = '_' do
+        advance ()
+
+      text.Substring(start, position.Value - start)
+
+    let name () =
+      match Int32.TryParse(word ()) with
+      | true, id -> id
+      | _ -> fail "expected an instance name after '#'"
+
+    let rec value () : StepValue =
+      skip ()
+
+      match at () with
+      | '$'
+      | '*' ->
+        advance ()
+        Unset
+      | '\'' ->
+        // Quotes within strings are doubled.
+        let s = System.Text.StringBuilder()
+        advance ()
+
+        while at () <> '\'' || startsWith "''" do
+          if position.Value >= text.Length then
+            fail "unterminated string"
+
+          s.Append(at ()) |> ignore
+          position.Value <- position.Value + (if at () = '\'' then 2 else 1)
+
+        advance ()
+        Text(decode (s.ToString()))
+      | '"' ->
+        let start = position.Value + 1
+
+        match text.IndexOf('"', start) with
+        | -1 -> fail "unterminated binary"
+        | close ->
+          position.Value <- close + 1
+          Text(text.Substring(start, close - start))
+      | '.' ->
+        advance ()
+        let item = word ()
+        expect '.'
+        Enumeration(item.ToUpperInvariant())
+      | '#' ->
+        advance ()
+        Reference(name ())
+      | '(' -> Aggregate(aggregate ())
+      | c when Char.IsDigit c || c = '-' || c = '+' ->
+        let start = position.Value
+
+        while Char.IsDigit(at ()) || "+-.Ee".Contains(at ()) do
+          advance ()
+
+        let number = text.Substring(start, position.Value - start)
+
+        match Double.TryParse(number, NumberStyles.Float, culture) with
+        | true, x -> Real x
+        | _ -> fail $"cannot read the number {number}"
+      | c when Char.IsLetter c ->
+        let kind = word().ToUpperInvariant()
+
+        match aggregate () with
+        | [ v ] -> Typed(kind, v)
+        | _ -> fail $"expected one value of {kind}"
+      | c -> fail $"unexpected '{c}'"
+
+    and aggregate () : StepValue list =
+      expect '('
+      skip ()
+
+      if at () = ')' then
+        advance ()
+        []
+      else
+        let items = ResizeArray [ value () ]
+        skip ()
+
+        while at () = ',' do
+          advance ()
+          items.Add(value ())
+          skip ()
+
+        expect ')'
+        List.ofSeq items
+
+    let found = Dictionary<int, Instance>()
+
+    match text.IndexOf("DATA;", StringComparison.Ordinal) with
+    | -1 -> raise (IfcException "not a STEP file: no DATA section")
+    | start ->
+      position.Value <- start + 5
+      skip ()
+
+      while not (startsWith "ENDSEC") do
+        if position.Value >= text.Length then
+          fail "missing ENDSEC"
+
+        expect '#'
+        let id = name ()
+        expect '='
+        skip ()
+
+        // Complex instances, of several entities at once, are skipped.
+        if at () = '(' then
+          advance ()
+          skip ()
+
+          while at () <> ')' && position.Value < text.Length do
+            word () |> ignore
+            aggregate () |> ignore
+            skip ()
+
+          advance ()
+        else
+          match word().ToUpperInvariant() with
+          | "" -> fail "expected an entity name"
+          | kind ->
+            found[id] <-
+              { Id = id
+                Type = kind
+                Arguments = aggregate () }
+
+        expect ';'
+        skip ()
+
+      found
+
+  /// Factors of the prefixes of SI units.
+  let private prefixes =
+    Map
+      [ "EXA", 1e18
+        "PETA", 1e15
+        "TERA", 1e12
+        "GIGA", 1e9
+        "MEGA", 1e6
+        "KILO", 1e3
+        "HECTO", 1e2
+        "DECA", 1e1
+        "DECI", 1e-1
+        "CENTI", 1e-2
+        "MILLI", 1e-3
+        "MICRO", 1e-6
+        "NANO", 1e-9
+        "PICO", 1e-12 ]
+
+  let private argument (k: int) (x: Instance) =
+    x.Arguments |> List.tryItem k |> Option.defaultValue Unset
+
+  let rec private real (v: StepValue) =
+    match v with
+    | Real x -> Some x
+    | Typed(_, v) -> real v
+    | _ -> None
+
+  let rec private label (v: StepValue) =
+    match v with
+    | Text s when s.Trim() <> "" -> Some(s.Trim())
+    | Typed(_, v) -> label v
+    | _ -> None
+
+  let private items (v: StepValue) =
+    match v with
+    | Aggregate xs -> xs
+    | _ -> []
+
+  let private sub (a: float[]) (b: float[]) = Array.map2 (-) a b
+  let private scale (k: float) (a: float[]) = Array.map ((*) k) a
+
+  let private dot (a: float[]) (b: float[]) =
+    Array.fold2 (fun s x y -> s + x * y) 0.0 a b
+
+  let private norm (a: float[]) = sqrt (dot a a)
+
+  let private cross (a: float[]) (b: float[]) =
+    [| a[1] * b[2] - a[2] * b[1]
+       a[2] * b[0] - a[0] * b[2]
+       a[0] * b[1] - a[1] * b[0] |]
+
+  /// Vector of components along a set of axes, in the axes' own system.
+  let private combine (axes: float[][]) (v: float[]) =
+    Array.init 3 (fun k ->
+      v[0] * axes[0][k] + v[1] * axes[1][k] + v[2] * axes[2][k])
+
+  let private number (x: float) : JsonNode = JsonValue.Create x
+  let private text (x: string) : JsonNode = JsonValue.Create x
+
+  let private list (xs: JsonNode seq) : JsonNode = JsonArray(Array.ofSeq xs)
+
+  let private record (properties: (string * JsonNode) list) : JsonNode =
+    let o = JsonObject()
+
+    for key, value in properties do
+      o[key] <- value
+
+    o
+
+  /// Stiffness of a freedom under a boundary condition, infinite where it
+  /// is rigid and zero where it is free, or None where it is unset.
+  let private fixity (v: StepValue) : float option =
+    match v with
+    | Unset -> None
+    | Typed(_, Enumeration "T")
+    | Enumeration "T" -> Some infinity
+    | Typed(_, Enumeration _)
+    | Enumeration _ -> Some 0.0
+    | v -> real v |> Option.map (fun k -> if k < 0.0 then infinity else k)
+
+  /// Area, second moments of area and torsion constant of a profile of
+  /// dimensions in metres, by the index of its attributes.
+  let private section
+    (profile: string)
+    (size: int -> float option)
+    : (string * float) list =
+    let solid b h =
+      let a, c = max b h, min b h
+      let beta = 1.0 / 3.0 - 0.21 * c / a * (1.0 - c ** 4.0 / (12.0 * a ** 4.0))
+
+      [ "area", b * h
+        "iy", b * h ** 3.0 / 12.0
+        "iz", h * b ** 3.0 / 12.0
+        "j", beta * a * c ** 3.0 ]
+
+    let tube r t =
+      let i = Math.PI * (r ** 4.0 - (r - t) ** 4.0) / 4.0
+
+      [ "area", Math.PI * (r ** 2.0 - (r - t) ** 2.0)
+        "iy", i
+        "iz", i
+        "j", 2.0 * i ]
+
+    match profile, size 3, size 4, size 5, size 6 with
+    | "IFCRECTANGLEPROFILEDEF", Some b, Some h, _, _ -> solid b h
+    | "IFCRECTANGLEHOLLOWPROFILEDEF", Some b, Some h, Some t, _ ->
+      let bi, hi = b - 2.0 * t, h - 2.0 * t
+
+      // Bredt's thin-walled torsion constant about the wall's midline.
+      let enclosed = (b - t) * (h - t)
+
+      [ "area", b * h - bi * hi
+        "iy", (b * h ** 3.0 - bi * hi ** 3.0) / 12.0
+        "iz", (h * b ** 3.0 - hi * bi ** 3.0) / 12.0
+        "j", 4.0 * enclosed ** 2.0 * t / (2.0 * (b + h - 2.0 * t)) ]
+    | "IFCCIRCLEPROFILEDEF", Some r, _, _, _ -> tube r r
+    | "IFCCIRCLEHOLLOWPROFILEDEF", Some r, Some t, _, _ -> tube r t
+    | "IFCISHAPEPROFILEDEF", Some b, Some h, Some tw, Some tf ->
+      let web = h - 2.0 * tf
+
+      [ "area", 2.0 * b * tf + web * tw
+        "iy", (b * h ** 3.0 - (b - tw) * web ** 3.0) / 12.0
+        "iz", (2.0 * tf * b ** 3.0 + web * tw ** 3.0) / 12.0
+        "j", (2.0 * b * tf ** 3.0 + (h - tf) * tw ** 3.0) / 3.0 ]
+    | _ -> []
+
+  /// Converts the instances of an IFC file to a model document tree.
+  let private toNode (all: Dictionary<int, Instance>) : JsonNode =
+    let deref (v: StepValue) =
+      match v with
+      | Reference id ->
+        match all.TryGetValue id with
+        | true, x -> Some x
+        | _ -> None
+      | _ -> None
+
+    let ofType (types: string list) =
+      all.Values
+      |> Seq.filter (fun x -> List.contains x.Type types)
+      |> Seq.sortBy (fun x -> x.Id)
+      |> List.ofSeq
+
+    // Factor converting a unit to SI.
+    let rec factor (u: Instance) : float =
+      match u.Type with
+      | "IFCSIUNIT" ->
+        let prefix =
+          match argument 2 u with
+          | Enumeration p -> prefixes.TryFind p |> Option.defaultValue 1.0
+          | _ -> 1.0
+
+        match argument 3 u with
+        | Enumeration "SQUARE_METRE" -> prefix ** 2.0
+        | Enumeration "CUBIC_METRE" -> prefix ** 3.0
+        | Enumeration "GRAM" -> prefix * 1e-3
+        | _ -> prefix
+      | "IFCDERIVEDUNIT" ->
+        let power (e: Instance) =
+          match deref (argument 0 e), real (argument 1 e) with
+          | Some u, Some exponent -> factor u ** exponent
+          | _ -> 1.0
+
+        argument 0 u
+        |> items
+        |> List.choose deref
+        |> List.fold (fun acc e -> acc * power e) 1.0
+      | "IFCCONVERSIONBASEDUNIT"
+      | "IFCCONVERSIONBASEDUNITWITHOFFSET" ->
+        match deref (argument 3 u) with
+        | Some m ->
+          let value = real (argument 0 m) |> Option.defaultValue 1.0
+          let basis = deref (argument 1 m) |> Option.map factor
+          value * Option.defaultValue 1.0 basis
+        | None -> 1.0
+      | _ -> 1.0
+
+    let units =
+      ofType [ "IFCUNITASSIGNMENT" ]
+      |> List.collect (fun a -> argument 0 a |> items |> List.choose deref)
+      |> List.choose (fun u ->
+        match argument 1 u with
+        | Enumeration kind -> Some(kind, factor u)
+        | _ -> None)
+      |> Map.ofList
+
+    // Units that are not assigned are SI.
+    let unit (kinds: string list) =
+      kinds |> List.tryPick units.TryFind |> Option.defaultValue 1.0
+
+    let length = unit [ "LENGTHUNIT" ]
+    let force = unit [ "FORCEUNIT" ]
+    let torque = unit [ "TORQUEUNIT" ]
+    let linearForce = unit [ "LINEARFORCEUNIT" ]
+    let modulus = unit [ "MODULUSOFELASTICITYUNIT"; "PRESSUREUNIT" ]
+    let stress = unit [ "PRESSUREUNIT" ]
+    let density = unit [ "MASSDENSITYUNIT" ]
+    let expansion = unit [ "THERMALEXPANSIONCOEFFICIENTUNIT" ]
+    let linearStiffness = unit [ "LINEARSTIFFNESSUNIT" ]
+    let rotationalStiffness = unit [ "ROTATIONALSTIFFNESSUNIT" ]
+
+    // Coordinates of a point or direction, in three dimensions.
+    let coordinates (x: Instance option) =
+      let c =
+        x
+        |> Option.map (fun p -> argument 0 p |> items |> List.choose real)
+        |> Option.defaultValue []
+        |> Array.ofList
+
+      Array.init 3 (fun k -> if k < c.Length then c[k] else 0.0)
+
+    let direction (v: StepValue) (otherwise: float[]) =
+      match deref v with
+      | Some d -> coordinates (Some d)
+      | None -> otherwise
+
+    let unitVector (a: float[]) = scale (1.0 / norm a) a
+
+    // Origin and axes of an axis placement.
+    let axes (p: Instance) =
+      let z, x =
+        match p.Type with
+        | "IFCAXIS2PLACEMENT3D" -> argument 1 p, argument 2 p
+        | _ -> Unset, argument 1 p
+
+      let z = unitVector (direction z [| 0.0; 0.0; 1.0 |])
+      let x = direction x [| 1.0; 0.0; 0.0 |]
+      let x = unitVector (sub x (scale (dot x z) z))
+      coordinates (deref (argument 0 p)), [| x; cross z x; z |]
+
+    // Position in global axes of a point in an object placement.
+    let rec place (placement: StepValue) (p: float[]) =
+      match deref placement with
+      | Some l when l.Type = "IFCLOCALPLACEMENT" ->
+        let local =
+          match deref (argument 1 l) with
+          | Some a ->
+            let origin, frame = axes a
+            Array.map2 (+) origin (combine frame p)
+          | None -> p
+
+        place (argument 0 l) local
+      | _ -> p
+
+    // Topological items of a product's representations.
+    let representation (x: Instance) =
+      deref (argument 6 x)
+      |> Option.toList
+      |> List.collect (fun s -> argument 2 s |> items |> List.choose deref)
+      |> List.collect (fun r -> argument 3 r |> items |> List.choose deref)
+
+    // Position in metres of a vertex of a product.
+    let vertex (x: Instance) (v: Instance) =
+      match v.Type, deref (argument 0 v) with
+      | "IFCVERTEXPOINT", Some p ->
+        Some(scale length (place (argument 5 x) (coordinates (Some p))))
+      | _ -> None
+
+    let rec ends (item: Instance) =
+      match item.Type with
+      | "IFCEDGE"
+      | "IFCEDGECURVE"
+      | "IFCSUBEDGE" ->
+        match deref (argument 0 item), deref (argument 1 item) with
+        | Some a, Some b -> Some(a, b)
+        | _ -> None
+      | "IFCORIENTEDEDGE" ->
+        deref (argument 2 item)
+        |> Option.bind ends
+        |> Option.map (fun (a, b) ->
+          if argument 3 item = Enumeration "F" then b, a else a, b)
+      | _ -> None
+
+    // Unique identifier from a name, else the prefixed instance name.
+    let fresh (used: HashSet<string>) (prefix: string) (name: StepValue) id =
+      let id =
+        match label name with
+        | Some l when not (used.Contains l) -> l
+        | _ -> $"{prefix}{id}"
+
+      used.Add id |> ignore
+      id
+
+    let nodes = JsonObject()
+    let nodeIds = HashSet<string>()
+    let positions = Dictionary<float * float * float, string>()
+
+    // Node at a position, shared by everything within a micrometre of it.
+    let nodeAt (name: StepValue) (instance: int) (p: float[]) =
+      let key =
+        Math.Round(p[0], 6) + 0.0,
+        Math.Round(p[1], 6) + 0.0,
+        Math.Round(p[2], 6) + 0.0
+
+      match positions.TryGetValue key with
+      | true, id -> id
+      | _ ->
+        let id = fresh nodeIds "n" name instance
+
+        nodes[id] <-
+          record
+            [ "id", text id
+              "x", number p[0]
+              "y", number p[1]
+              "z", number p[2] ]
+
+        positions[key] <- id
+        id
+
+    let constraints = JsonObject()
+    let connections = Dictionary<int, string>()
+
+    for c in ofType [ "IFCSTRUCTURALPOINTCONNECTION" ] do
+      let origin () =
+        scale length (place (argument 5 c) [| 0.0; 0.0; 0.0 |])
+
+      let p =
+        representation c
+        |> List.tryPick (vertex c)
+        |> Option.defaultWith origin
+
+      let id = nodeAt (argument 2 c) c.Id p
+      connections[c.Id] <- id
+
+      match deref (argument 7 c) with
+      | Some condition when
+        condition.Type.StartsWith "IFCBOUNDARYNODECONDITION"
+        ->
+        let freedoms =
+          [ for k, dof in List.indexed [ "Ux"; "Uy"; "Uz"; "Rx"; "Ry"; "Rz" ] do
+              let stiffness =
+                if k < 3 then linearStiffness else rotationalStiffness
+
+              match fixity (argument (k + 1) condition) with
+              | Some s when s > 0.0 -> dof, s * stiffness
+              | _ -> () ]
+
+        let held, springs =
+          freedoms |> List.partition (snd >> Double.IsPositiveInfinity)
+
+        let kind =
+          match List.map fst held, springs with
+          | [ _; _; _; _; _; _ ], _ -> "Fixed"
+          | [ "Ux"; "Uy"; "Uz" ], [] -> "Pinned"
+          | _, [] -> "Partial"
+          | _ -> "Elastic"
+
+        if not freedoms.IsEmpty then
+          constraints[id] <-
+            record
+              [ "id", text id
+                "type", text kind
+                "node", text id
+                "dof", list [ for dof, _ in held -> text dof ]
+                if not springs.IsEmpty then
+                  "stiffness",
+                  record [ for dof, k in springs -> dof, number k ] ]
+      | _ -> ()
+
+    // Material and profile of an association with a product.
+    let rec association (x: Instance) =
+      let first k =
+        argument k x
+        |> items
+        |> List.tryPick deref
+        |> Option.map association
+        |> Option.defaultValue (None, None)
+
+      match x.Type with
+      | "IFCMATERIAL" -> Some x, None
+      | "IFCMATERIALPROFILE" -> deref (argument 2 x), deref (argument 3 x)
+      | "IFCMATERIALPROFILESET" -> first 2
+      | "IFCMATERIALPROFILESETUSAGE"
+      | "IFCMATERIALPROFILESETUSAGETAPERING" ->
+        match deref (argument 0 x) with
+        | Some set -> association set
+        | None -> None, None
+      | "IFCMATERIALLIST" -> first 0
+      | _ -> None, None
+
+    let associations = Dictionary<int, Instance option * Instance option>()
+
+    for r in ofType [ "IFCRELASSOCIATESMATERIAL" ] do
+      match deref (argument 5 r) with
+      | Some m ->
+        for x in argument 4 r |> items |> List.choose deref do
+          associations[x.Id] <- association m
+      | None -> ()
+
+    // Mechanical properties by material, from IFC4 property sets and
+    // IFC2x3 material properties.
+    let properties = Dictionary<int, Map<string, float>>()
+
+    let setProperty (material: StepValue) (key: string) (value: StepValue) =
+      match deref material, real value with
+      | Some m, Some x ->
+        let known =
+          match properties.TryGetValue m.Id with
+          | true, known -> known
+          | _ -> Map.empty
+
+        properties[m.Id] <- Map.add key x known
+      | _ -> ()
+
+    for p in ofType [ "IFCMATERIALPROPERTIES" ] do
+      for v in argument 2 p |> items |> List.choose deref do
+        match v.Type, label (argument 0 v) with
+        | "IFCPROPERTYSINGLEVALUE", Some key ->
+          setProperty (argument 3 p) key (argument 2 v)
+        | _ -> ()
+
+    let mechanical =
+      [ "IFCMECHANICALMATERIALPROPERTIES"
+        "IFCMECHANICALSTEELMATERIALPROPERTIES"
+        "IFCMECHANICALCONCRETEMATERIALPROPERTIES" ]
+
+    for p in ofType mechanical do
+      let keys =
+        [ 2, "YoungModulus"
+          3, "ShearModulus"
+          4, "PoissonRatio"
+          5, "ThermalExpansionCoefficient"
+          if p.Type = "IFCMECHANICALSTEELMATERIALPROPERTIES" then
+            6, "YieldStress" ]
+
+      for k, key in keys do
+        setProperty (argument 0 p) key (argument k p)
+
+    for p in ofType [ "IFCGENERALMATERIALPROPERTIES" ] do
+      setProperty (argument 0 p) "MassDensity" (argument 3 p)
+
+    let materials = JsonObject()
+    let materialIds = Dictionary<int, string>()
+    let materialNames = HashSet<string>()
+
+    // Identifier of a material, added to the model when first used.
+    let material (m: Instance) =
+      match materialIds.TryGetValue m.Id with
+      | true, id -> id
+      | _ ->
+        let id = fresh materialNames "m" (argument 0 m) m.Id
+
+        let known =
+          match properties.TryGetValue m.Id with
+          | true, known -> known
+          | _ -> Map.empty
+
+        let value key (unit: float) =
+          known.TryFind key |> Option.map ((*) unit)
+
+        let elastic = value "YoungModulus" modulus
+
+        let shear =
+          match value "ShearModulus" modulus, known.TryFind "PoissonRatio" with
+          | Some g, _ -> Some g
+          | None, Some nu ->
+            elastic |> Option.map (fun e -> e / (2.0 + 2.0 * nu))
+          | None, None -> None
+
+        // IFC4 materials have a category such as "steel" or "concrete".
+        let kind =
+          match label (argument 2 m) with
+          | Some c ->
+            c.Substring(0, 1).ToUpperInvariant()
+            + c.Substring(1).ToLowerInvariant()
+          | None -> "Generic"
+
+        let optional =
+          [ "density", value "MassDensity" density
+            "yield_strength", value "YieldStress" stress
+            "shear_modulus", shear
+            "thermal_expansion",
+            value "ThermalExpansionCoefficient" expansion ]
+
+        materials[id] <-
+          record (
+            [ "id", text id
+              "name", text (label (argument 0 m) |> Option.defaultValue id)
+              "type", text kind
+              "elastic_modulus", number (defaultArg elastic 0.0) ]
+            @ [ for field, x in optional do
+                  match x with
+                  | Some x -> field, number x
+                  | None -> () ]
+          )
+
+        materialIds[m.Id] <- id
+        id
+
+    let elements = JsonObject()
+    let elementIds = HashSet<string>()
+
+    // Element, ends and local axes of each curve member by instance name.
+    let members =
+      Dictionary<int, string * float[] * float[] * float[][] option>()
+
+    let curves =
+      [ "IFCSTRUCTURALCURVEMEMBER"; "IFCSTRUCTURALCURVEMEMBERVARYING" ]
+
+    for m in ofType curves do
+      let id = fresh elementIds "e" (argument 2 m) m.Id
+
+      let node (v: Instance) =
+        match vertex m v with
+        | Some p -> nodeAt Unset v.Id p, p
+        | None ->
+          raise (IfcException $"curve member #{m.Id} has no point at an end")
+
+      let (i, p), (j, q) =
+        match representation m |> List.tryPick ends with
+        | Some(a, b) -> node a, node b
+        | None -> raise (IfcException $"curve member #{m.Id} has no edge")
+
+      let kind =
+        match argument 7 m with
+        | Enumeration "PIN_JOINED_MEMBER" -> "Truss3D"
+        | Enumeration "CABLE"
+        | Enumeration "TENSION_MEMBER" -> "Cable"
+        | Enumeration "COMPRESSION_MEMBER" -> "Strut"
+        | _ -> "Frame3D"
+
+      let substance, profile =
+        match associations.TryGetValue m.Id with
+        | true, found -> found
+        | _ -> None, None
+
+      let size (p: Instance) k =
+        real (argument k p) |> Option.map ((*) length)
+
+      let properties =
+        match profile with
+        | Some p -> section p.Type (size p)
+        | None -> []
+
+      // Local z lies towards the member's axis, IFC4 only, else global Z.
+      let x = sub q p
+      let axis = direction (argument 8 m) [| 0.0; 0.0; 1.0 |]
+      let z = sub axis (scale (dot axis x / dot x x) x)
+
+      let frame =
+        if norm x = 0.0 || norm z < 1e-9 * norm axis then
+          None
+        else
+          let x, z = unitVector x, unitVector z
+          Some [| x; cross z x; z |]
+
+      members[m.Id] <- (id, p, q, frame)
+
+      elements[id] <-
+        record
+          [ "id", text id
+            "type", text kind
+            "nodes", list [ text i; text j ]
+            "material",
+            text (substance |> Option.map material |> Option.defaultValue "")
+            if not properties.IsEmpty then
+              "properties", record [ for k, v in properties -> k, number v ] ]
+
+    // Bending rotations free where members meet connections are released.
+    let relations =
+      [ "IFCRELCONNECTSSTRUCTURALMEMBER"; "IFCRELCONNECTSWITHECCENTRICITY" ]
+
+    for r in ofType relations do
+      let m, c = deref (argument 4 r), deref (argument 5 r)
+
+      match m, c, deref (argument 6 r) with
+      | Some m, Some c, Some condition when
+        members.ContainsKey m.Id && connections.ContainsKey c.Id
+        ->
+        let id, _, _, _ = members[m.Id]
+        let element = elements[id].AsObject()
+
+        let free =
+          [ for k, dof in [ 5, "Ry"; 6, "Rz" ] do
+              if fixity (argument k condition) = Some 0.0 then
+                text dof ]
+
+        let frame = element["type"].GetValue<string>() = "Frame3D"
+
+        if frame && not free.IsEmpty then
+          if not (element.ContainsKey "releases") then
+            element["releases"] <- JsonObject()
+
+          element["releases"][connections[c.Id]] <- list free
+      | _ -> ()
+
+    // Activities by the member or connection they act on.
+    let targets = Dictionary<int, Instance>()
+
+    for r in ofType [ "IFCRELCONNECTSSTRUCTURALACTIVITY" ] do
+      match deref (argument 4 r), deref (argument 5 r) with
+      | Some target, Some activity -> targets[activity.Id] <- target
+      | _ -> ()
+
+    let isGroup (g: Instance) =
+      g.Type = "IFCSTRUCTURALLOADGROUP" || g.Type = "IFCSTRUCTURALLOADCASE"
+
+    let kindOf (g: Instance) =
+      match argument 5 g with
+      | Enumeration kind -> kind
+      | _ -> ""
+
+    // Objects, the groups they are assigned to and any factor on them.
+    let assignments =
+      [ for r in
+          ofType [ "IFCRELASSIGNSTOGROUP"; "IFCRELASSIGNSTOGROUPBYFACTOR" ] do
+          match deref (argument 6 r) with
+          | Some g when isGroup g ->
+            for x in argument 4 r |> items |> List.choose deref do
+              x, g, real (argument 7 r)
+          | _ -> () ]
+
+    let groupOf (x: Instance) =
+      assignments
+      |> List.tryPick (fun (y, g, _) ->
+        if y.Id = x.Id && kindOf g <> "LOAD_COMBINATION" then Some g else None)
+
+    let caseName (g: Instance) =
+      label (argument 2 g) |> Option.defaultValue $"case{g.Id}"
+
+    // Load case of an activity: that of its load group, or of the load
+    // case that group belongs to.
+    let caseOf (x: Instance) =
+      groupOf x
+      |> Option.map (fun g ->
+        match groupOf g with
+        | Some parent when
+          kindOf g = "LOAD_GROUP" && kindOf parent = "LOAD_CASE"
+          ->
+          caseName parent
+        | _ -> caseName g)
+
+    let combinations = JsonObject()
+
+    for g in ofType [ "IFCSTRUCTURALLOADGROUP" ] do
+      let factors =
+        [ for x, parent, f in assignments do
+            if parent.Id = g.Id && isGroup x then
+              let coefficient = real (argument 8 x)
+              let factor = f |> Option.orElse coefficient
+              caseName x, Option.defaultValue 1.0 factor ]
+
+      if kindOf g = "LOAD_COMBINATION" && not factors.IsEmpty then
+        let id = caseName g
+
+        combinations[id] <-
+          record
+            [ "id", text id
+              "factors", record [ for c, f in factors -> c, number f ] ]
+
+    let loads = JsonObject()
+    let loadIds = HashSet<string>()
+
+    let actions =
+      [ "IFCSTRUCTURALPOINTACTION"
+        "IFCSTRUCTURALCURVEACTION"
+        "IFCSTRUCTURALLINEARACTION" ]
+
+    for a in ofType actions do
+      let fail reason = raise (IfcException $"action #{a.Id} {reason}")
+      let id = fresh loadIds "l" (argument 2 a) a.Id
+      let local = argument 8 a = Enumeration "LOCAL_COORDS"
+      let case = caseOf a
+
+      // Components of three attributes of a load from k.
+      let components (load: Instance) k (unit: float) =
+        Array.init 3 (fun i ->
+          unit * (real (argument (k + i) load) |> Option.defaultValue 0.0))
+
+      // Adds a load per non-zero component, in global axes.
+      let add kind (directions: string list) (v: float[]) fields =
+        for d, x in List.zip directions (List.ofArray v) do
+          if x <> 0.0 then
+            let key = $"{id}-{d}"
+
+            loads[key] <-
+              record (
+                [ "id", text key; "type", text kind ]
+                @ fields
+                @ [ "direction", text d
+                    "magnitude", number x
+                    match case with
+                    | Some c -> "case", text c
+                    | None -> () ]
+              )
+
+      let forces = [ "Fx"; "Fy"; "Fz" ]
+
+      let inMember (frame: float[][] option) (v: float[]) =
+        match frame with
+        | _ when not local -> v
+        | Some axes -> combine axes v
+        | None -> fail "acts in member axes of a member without them"
+
+      let target =
+        match targets.TryGetValue a.Id with
+        | true, t -> t
+        | _ -> fail "acts on nothing"
+
+      let onMember =
+        match members.TryGetValue target.Id with
+        | true, found -> Some found
+        | _ -> None
+
+      match deref (argument 7 a) with
+      | Some load when load.Type.StartsWith "IFCSTRUCTURALLOADSINGLEFORCE" ->
+        let f = components load 1 force
+        let moments = components load 4 torque
+
+        match connections.TryGetValue target.Id, onMember with
+        | (true, node), _ ->
+          // IFC4 connections may have their own axes.
+          let rotate v =
+            match deref (argument 8 target) with
+            | Some system when local -> combine (snd (axes system)) v
+            | _ -> v
+
+          let at = [ "node", text node ]
+          add "Force" forces (rotate f) at
+          add "Moment" [ "Mx"; "My"; "Mz" ] (rotate moments) at
+        | _, Some(element, p, q, frame) ->
+          if Array.exists ((<>) 0.0) moments then
+            fail "applies a moment to a member, which is not supported"
+
+          let point =
+            representation a
+            |> List.tryPick (vertex a)
+            |> Option.defaultWith (fun () -> fail "has no point on its member")
+
+          let chord = sub q p
+          let position = dot (sub point p) chord / dot chord chord
+
+          add
+            "Force"
+            forces
+            (inMember frame f)
+            [ "element", text element
+              "position", number (max 0.0 (min 1.0 position)) ]
+        | _ -> fail "acts on neither a point connection nor a curve member"
+      | Some load when load.Type = "IFCSTRUCTURALLOADLINEARFORCE" ->
+        match onMember with
+        | Some(element, _, _, frame) ->
+          if Array.exists ((<>) 0.0) (components load 4 1.0) then
+            fail "applies a linear moment, which is not supported"
+
+          let w = inMember frame (components load 1 linearForce)
+          add "Distributed" forces w [ "element", text element ]
+        | None -> fail "acts along something other than a curve member"
+      | Some load -> fail $"applies an unsupported {load.Type}"
+      | None -> fail "has no load"
+
+    let name =
+      [ "IFCSTRUCTURALANALYSISMODEL"; "IFCPROJECT" ]
+      |> List.tryPick (fun t ->
+        ofType [ t ] |> List.tryPick (argument 2 >> label))
+      |> Option.defaultValue "IFC model"
+
+    record
+      [ "info",
+        record
+          [ "name", text name
+            "units", text "SI"
+            "version", text "1.0"
+            "dimensions", JsonValue.Create 3 ]
+        "gravity",
+        record
+          [ "magnitude", number 9.80665
+            "direction", list [ number 0.0; number 0.0; number (-1.0) ] ]
+        "nodes", nodes :> JsonNode
+        "elements", elements
+        "materials", materials
+        "loads", loads
+        "combinations", combinations
+        "constraints", constraints ]
+
+  /// <summary>
+  /// Parses the structural analysis model of an IFC file into a document
+  /// tree.
+  /// </summary>
+  /// <param name="text">IFC file in STEP format.</param>
+  /// <returns>Document tree, or MalformedModel naming the defect.</returns>
+  let internal parseNode (text: string) : Result<JsonNode, ModelError> =
+    try
+      Ok(toNode (instances text))
+    with :? IfcException as ex ->
+      Error(MalformedModel ex.Message)
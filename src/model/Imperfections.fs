@@ -0,0 +1,397 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+
+/// <summary>
+/// Buckling curve of a member, which sets its bow imperfection per
+/// EN 1993-1-1 Table 5.1.
+/// </summary>
+[<RequireQualifiedAccess>]
+type BucklingCurve =
+  | A0
+  | A
+  | B
+  | C
+  | D
+
+/// <summary>
+/// Largest offset of an imperfection shaped like a buckling mode.
+/// </summary>
+[<RequireQualifiedAccess>]
+type Amplitude =
+  /// L / ratio, for the length L of the member that moves most.
+  | Ratio of ratio: float
+  /// Fixed length in model units.
+  | Length of length: float
+
+/// <summary>
+/// Equivalent geometric imperfection per EN 1993-1-1 5.3.2, acting along a
+/// global translation, or shaped like a buckling mode per 5.3.2(11).
+/// </summary>
+type Imperfection =
+  /// Global initial sway of the whole frame, for m columns in a row.
+  | Sway of along: Dof * columns: int
+  /// Initial bow of each member, with amplitude L / ratio at midspan.
+  | Bow of along: Dof * curve: BucklingCurve
+  /// Shape of the numbered elastic buckling mode under a load set.
+  | Eigenmode of number: int * amplitude: Amplitude
+
+/// <summary>
+/// Errors raised when imperfecting a model.
+/// </summary>
+type ImperfectionError =
+  | InvalidImperfection of text: string
+  | VerticalSway of along: Dof
+  | InvalidGravity
+  | UnresolvedMode of number: int
+  | UnmeasuredMode of node: string
+
+[<RequireQualifiedAccess>]
+module Imperfection =
+
+  let private axes = [ "X", Ux; "Y", Uy; "Z", Uz ]
+
+  let private curves =
+    [ "a0", BucklingCurve.A0
+      "a", BucklingCurve.A
+      "b", BucklingCurve.B
+      "c", BucklingCurve.C
+      "d", BucklingCurve.D ]
+
+  let private axisName (dof: Dof) =
+    axes |> List.find (snd >> (=) dof) |> fst
+
+  let getAsString (i: Imperfection) : string =
+    match i with
+    | Sway(along, 1) -> $"sway:{axisName along}"
+    | Sway(along, columns) -> $"sway:{axisName along}:{columns}"
+    | Bow(along, curve) ->
+      let name = curves |> List.find (snd >> (=) curve) |> fst
+      $"bow:{axisName along}:{name}"
+    | Eigenmode(number, Amplitude.Ratio ratio) -> $"mode{number}:L/{ratio}"
+    | Eigenmode(number, Amplitude.Length length) -> $"mode{number}:{length}"
+
+  /// <summary>
+  /// Parses an imperfection, e.g. "sway:X", "sway:X:4" for four columns in
+  /// a row, "bow:Y:c" for members on buckling curve c, or "mode1:L/250"
+  /// and "mode2:0.01" for the first buckling mode with an amplitude of
+  /// L/250 and the second with an amplitude of 0.01.
+  /// </summary>
+  /// <param name="text">Kind, axis and sway columns or buckling curve.</param>
+  /// <returns>Matching imperfection or InvalidImperfection error.</returns>
+  let tryParse (text: string) : Result<Imperfection, ImperfectionError> =
+    let find name table =
+      table
+      |> List.tryFind (fun (key: string, _) ->
+        String.Equals(key, name, StringComparison.OrdinalIgnoreCase))
+      |> Option.map snd
+
+    let parts = text.Trim().Split(':') |> List.ofArray
+
+    let positive (text: string) =
+      match
+        Double.TryParse(
+          text,
+          Globalization.NumberStyles.Float,
+          Globalization.CultureInfo.InvariantCulture
+        )
+      with
+      | true, x when x > 0.0 && Double.IsFinite x -> Some x
+      | _ -> None
+
+    let amplitude (text: string) =
+      if text.StartsWith("L/", StringComparison.OrdinalIgnoreCase) then
+        positive text[2..] |> Option.map Amplitude.Ratio
+      else
+        positive text |> Option.map Amplitude.Length
+
+    let parsed =
+      match parts |> List.map (fun p -> p.Trim()) with
+      | [ kind; axis ] when kind.ToLowerInvariant() = "sway" ->
+        find axis axes |> Option.map (fun along -> Sway(along, 1))
+      | [ kind; axis; columns ] when kind.ToLowerInvariant() = "sway" ->
+        match find axis axes, Int32.TryParse columns with
+        | Some along, (true, m) when m >= 1 -> Some(Sway(along, m))
+        | _ -> None
+      | [ kind; axis; curve ] when kind.ToLowerInvariant() = "bow" ->
+        Option.map2
+          (fun along curve -> Bow(along, curve))
+          (find axis axes)
+          (find curve curves)
+      | [ mode; size ] when
+        mode.StartsWith("mode", StringComparison.OrdinalIgnoreCase)
+        ->
+        match Int32.TryParse mode[4..], amplitude size with
+        | (true, n), Some a when n >= 1 -> Some(Eigenmode(n, a))
+        | _ -> None
+      | _ -> None
+
+    match parsed with
+    | Some i -> Ok i
+    | None -> Error(InvalidImperfection text)
+
+[<RequireQualifiedAccess>]
+module ImperfectionError =
+
+  let getAsString (e: ImperfectionError) : string =
+    match e with
+    | InvalidImperfection text ->
+      $"Invalid imperfection '{text}'; expected e.g. sway:X, sway:X:4, "
+      + "bow:X:c or mode1:L/250."
+    | VerticalSway along ->
+      $"Sway along {Dof.getAsString along} must be horizontal, across gravity."
+    | InvalidGravity ->
+      "Gravity direction must be a non-zero vector of 3 components."
+    | UnresolvedMode number ->
+      $"Imperfection mode{number} follows a buckling mode, which depends on "
+      + "the load set; pass it to gz analyze instead."
+    | UnmeasuredMode node ->
+      $"Buckling mode moves node '{node}' most, which lies on no member to "
+      + "measure L from; give the amplitude as a length instead."
+
+/// <summary>
+/// Perturbs node coordinates with the equivalent imperfections of
+/// EN 1993-1-1 5.3.2, producing imperfect geometry for second-order
+/// analysis.
+/// </summary>
+/// <remarks>
+/// Height is measured against gravity. Sway rotates the frame by
+/// φ = φ0·αh·αm, with φ0 = 1/200, αh = 2/√h within [2/3, 1] for the
+/// height h in metres and αm = √(0.5·(1 + 1/m)). Bow offsets the interior
+/// nodes of each member by e0·sin(πx/L), with e0 = L/350, L/300, L/250,
+/// L/200 or L/150 for curves a0 to d, across the member towards the axis
+/// given. A buckling mode shape is scaled so that its largest translation
+/// is the amplitude, with L the longest member through the node moving
+/// most.
+/// Members are runs of collinear two-node elements, so a member needs
+/// interior nodes to take a bow.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Imperfections =
+
+  /// Basic sway imperfection φ0.
+  [<Literal>]
+  let BasicSway = 0.005
+
+  let private dot (ax, ay, az) (bx, by, bz) = ax * bx + ay * by + az * bz
+  let private scale k (x, y, z) = k * x, k * y, k * z
+  let private sub (ax, ay, az) (bx, by, bz) = ax - bx, ay - by, az - bz
+  let private norm v = sqrt (dot v v)
+  let private point (n: Node) = n.X, n.Y, n.Z
+
+  let private unit (dof: Dof) =
+    match dof with
+    | Ux -> 1.0, 0.0, 0.0
+    | Uy -> 0.0, 1.0, 0.0
+    | _ -> 0.0, 0.0, 1.0
+
+  let private move (x, y, z) (n: Node) =
+    { n with
+        X = n.X + x
+        Y = n.Y + y
+        Z = n.Z + z }
+
+  /// <summary>
+  /// Returns the sway imperfection φ of a frame.
+  /// </summary>
+  /// <param name="height">Height of the structure in metres.</param>
+  /// <param name="columns">Columns in a row carrying at least half the
+  /// average vertical load per column.</param>
+  /// <returns>Initial out-of-plumb as a rotation.</returns>
+  let swayAngle (height: float) (columns: int) : float =
+    let alphaH = 2.0 / sqrt height |> max (2.0 / 3.0) |> min 1.0
+    let alphaM = sqrt (0.5 * (1.0 + 1.0 / float columns))
+    BasicSway * alphaH * alphaM
+
+  /// <summary>
+  /// Returns the bow imperfection of a member as a fraction of its length.
+  /// </summary>
+  /// <param name="curve">Buckling curve.</param>
+  /// <returns>e0 / L for elastic analysis.</returns>
+  let bowRatio (curve: BucklingCurve) : float =
+    match curve with
+    | BucklingCurve.A0 -> 1.0 / 350.0
+    | BucklingCurve.A -> 1.0 / 300.0
+    | BucklingCurve.B -> 1.0 / 250.0
+    | BucklingCurve.C -> 1.0 / 200.0
+    | BucklingCurve.D -> 1.0 / 150.0
+
+  /// <summary>
+  /// Groups two-node elements into members: runs of collinear elements
+  /// joined at nodes no other element connects to.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Node IDs along each member, from end to end.</returns>
+  let members (m: Model) : string list list =
+    let bars =
+      m.Elements
+      |> Map.filter (fun _ e ->
+        e.Nodes.Length = 2 && e.Nodes |> List.forall m.Nodes.ContainsKey)
+
+    let attached =
+      m.Elements
+      |> Map.toList
+      |> List.collect (fun (id, e) -> e.Nodes |> List.map (fun n -> n, id))
+      |> List.groupBy fst
+      |> List.map (fun (n, ids) -> n, List.map snd ids)
+      |> Map.ofList
+
+    let direction (e: Element) =
+      let d = sub (point m.Nodes[e.Nodes[1]]) (point m.Nodes[e.Nodes[0]])
+      scale (1.0 / max (norm d) Double.Epsilon) d
+
+    // A node is interior when exactly two collinear bars meet there.
+    let continues node =
+      match attached.TryFind node |> Option.defaultValue [] with
+      | [ a; b ] when bars.ContainsKey a && bars.ContainsKey b ->
+        abs (dot (direction bars[a]) (direction bars[b])) > 1.0 - 1e-9
+      | _ -> false
+
+    let other (e: Element) node =
+      if e.Nodes[0] = node then e.Nodes[1] else e.Nodes[0]
+
+    let visited = Collections.Generic.HashSet<string>()
+
+    // Walks from a node away from an element until the member ends.
+    let rec walk (from: string) (node: string) =
+      if continues node then
+        let next = attached[node] |> List.find ((<>) from)
+
+        if visited.Add next then
+          let ahead = other bars[next] node
+          ahead :: walk next ahead
+        else
+          []
+      else
+        []
+
+    [ for KeyValue(id, e) in bars do
+        if visited.Add id then
+          let back = walk id e.Nodes[0] |> List.rev
+          let forward = walk id e.Nodes[1]
+          back @ e.Nodes @ forward ]
+
+  /// <summary>
+  /// Offsets a model's nodes by a buckling mode shape, scaled so that its
+  /// largest translation is the amplitude.
+  /// </summary>
+  /// <param name="amplitude">Largest offset.</param>
+  /// <param name="shape">Mode shape by node and degree of freedom.</param>
+  /// <param name="m">Model the mode belongs to.</param>
+  /// <returns>Imperfect model, or ImperfectionError.</returns>
+  let applyShape
+    (amplitude: Amplitude)
+    (shape: Map<string, Map<Dof, float>>)
+    (m: Model)
+    : Result<Model, ImperfectionError> =
+    let translation (dofs: Map<Dof, float>) =
+      let at dof = dofs.TryFind dof |> Option.defaultValue 0.0
+      at Ux, at Uy, at Uz
+
+    let moves =
+      shape
+      |> Map.toList
+      |> List.filter (fst >> m.Nodes.ContainsKey)
+      |> List.map (fun (node, dofs) -> node, translation dofs)
+
+    match moves |> List.sortByDescending (snd >> norm) with
+    | [] -> Ok m
+    | (_, peak) :: _ when norm peak = 0.0 -> Ok m
+    | (node, peak) :: _ ->
+      let size =
+        match amplitude with
+        | Amplitude.Length length -> Ok length
+        | Amplitude.Ratio ratio ->
+          let lengths =
+            [ for path in members m do
+                if List.contains node path then
+                  let first = point m.Nodes[path.Head]
+                  norm (sub (point m.Nodes[List.last path]) first) ]
+
+          match lengths with
+          | [] -> Error(UnmeasuredMode node)
+          | _ -> Ok(List.max lengths / ratio)
+
+      size
+      |> Result.map (fun size ->
+        let k = size / norm peak
+        let offsets = Map.ofList moves
+
+        { m with
+            Nodes =
+              m.Nodes
+              |> Map.map (fun id n ->
+                match offsets.TryFind id with
+                | Some offset -> move (scale k offset) n
+                | None -> n) })
+
+  /// <summary>
+  /// Applies an imperfection to a model's node coordinates. Buckling mode
+  /// imperfections need the mode shape, so are applied by applyShape.
+  /// </summary>
+  /// <param name="i">Imperfection.</param>
+  /// <param name="m">Model.</param>
+  /// <returns>Imperfect model, or ImperfectionError.</returns>
+  let apply (i: Imperfection) (m: Model) : Result<Model, ImperfectionError> =
+    match Gravity.resolve m |> Gravity.acceleration with
+    | None -> Error InvalidGravity
+    | Some g ->
+      let up = scale (-1.0 / norm g) g
+
+      match i with
+      | Eigenmode(number, _) -> Error(UnresolvedMode number)
+      | Sway(along, _) when abs (dot (unit along) up) > 1e-9 ->
+        Error(VerticalSway along)
+      | Sway(along, columns) ->
+        let levels = m.Nodes |> Map.toList |> List.map (snd >> point >> dot up)
+
+        let metres =
+          match UnitSystem.tryFind m.Info.Units with
+          | Ok units -> units.Length
+          | Error _ -> 1.0
+
+        let nodes =
+          if levels.IsEmpty then
+            m.Nodes
+          else
+            let bottom = List.min levels
+            let height = (List.max levels - bottom) * metres
+            let phi = swayAngle height columns
+
+            m.Nodes
+            |> Map.map (fun _ n ->
+              let drift = phi * (dot up (point n) - bottom)
+              move (scale drift (unit along)) n)
+
+        Ok { m with Nodes = nodes }
+      | Bow(along, curve) ->
+        let offsets =
+          [ for path in members m do
+              let first = point m.Nodes[path.Head]
+              let chord = sub (point m.Nodes[List.last path]) first
+              let length = norm chord
+              let t = scale (1.0 / length) chord
+              let across = sub (unit along) (scale (dot (unit along) t) t)
+
+              // Members along the axis cannot bow towards it.
+              if path.Length > 2 && norm across > 1e-9 then
+                let e0 = bowRatio curve * length
+                let d = scale (1.0 / norm across) across
+
+                for node in path do
+                  let x = dot (sub (point m.Nodes[node]) first) t
+                  node, scale (e0 * sin (Math.PI * x / length)) d ]
+          |> Map.ofList
+
+        let nodes =
+          m.Nodes
+          |> Map.map (fun id n ->
+            match offsets.TryFind id with
+            | Some offset -> move offset n
+            | None -> n)
+
+        Ok { m with Nodes = nodes }
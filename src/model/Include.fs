@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.IO
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// <summary>
+/// Resolves composition directives so that models can share definitions
+/// held in other files, e.g. a common materials library.
+/// </summary>
+/// <remarks>
+/// <c>{ "$ref": "materials.json#/materials" }</c> is replaced by the referenced
+/// document (or the part selected by the JSON pointer after '#').
+/// <c>"$include": [ "shared.json" ]</c> merges whole documents into the
+/// enclosing object; definitions in the including file take precedence.
+/// Paths are relative to the file containing the directive.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Include =
+
+  [<Literal>]
+  let Ref = "$ref"
+
+  [<Literal>]
+  let Includes = "$include"
+
+  let private documentOptions =
+    JsonDocumentOptions(
+      CommentHandling = JsonCommentHandling.Skip,
+      AllowTrailingCommas = true
+    )
+
+  /// Parses JSON text into a mutable document tree.
+  let internal parseNode (text: string) : Result<JsonNode, ModelError> =
+    try
+      match JsonNode.Parse(text, documentOptions = documentOptions) with
+      | null -> Error(MalformedModel "document is empty")
+      | node -> Ok node
+    with :? JsonException as ex ->
+      Error(MalformedModel ex.Message)
+
+  /// <summary>
+  /// Parses text in a format into a mutable document tree.
+  /// </summary>
+  /// <param name="format">Serialization format of the text.</param>
+  /// <param name="text">Serialized document.</param>
+  /// <returns>Document tree or ModelError.</returns>
+  let internal parseAs
+    (format: ModelFormat)
+    (text: string)
+    : Result<JsonNode, ModelError> =
+    match format with
+    | Json -> parseNode text
+    | Yaml -> Yaml.parseNode text
+    | Ifc -> Ifc.parseNode text
+    | Staad -> Staad.parseNode text
+    | Abaqus -> Abaqus.parseNode text
+    | Protobuf ->
+      Error(UnsupportedFormat "binary models cannot be read as text")
+
+  /// Applies a function to each item, stopping at the first error.
+  let private traverse
+    (f: 'T -> Result<'U, ModelError>)
+    (items: 'T list)
+    : Result<'U list, ModelError> =
+    let folder item acc =
+      match f item, acc with
+      | Ok x, Ok xs -> Ok(x :: xs)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder items (Ok [])
+
+  /// Selects the part of a document addressed by a JSON pointer, e.g. /a/b.
+  let private select
+    (pointer: string)
+    (node: JsonNode)
+    : Result<JsonNode, string> =
+    pointer.Split('/', StringSplitOptions.RemoveEmptyEntries)
+    |> Array.map (fun s -> s.Replace("~1", "/").Replace("~0", "~"))
+    |> Array.fold
+      (fun current segment ->
+        current
+        |> Result.bind (fun (n: JsonNode) ->
+          match n with
+          | :? JsonObject as o when o.ContainsKey segment -> Ok o[segment]
+          | :? JsonArray as a ->
+            match Int32.TryParse segment with
+            | true, i when i >= 0 && i < a.Count -> Ok a[i]
+            | _ -> Error $"no index '{segment}'"
+          | _ -> Error $"no member '{segment}'"))
+      (Ok node)
+
+  /// Merges source into target; members already in target are kept.
+  let rec private merge (target: JsonObject) (source: JsonObject) : unit =
+    for KeyValue(key, value) in Seq.toList source do
+      match target[key], value with
+      | (:? JsonObject as t), (:? JsonObject as s) -> merge t s
+      | null, v when not (target.ContainsKey key) ->
+        target[key] <- if isNull v then null else v.DeepClone()
+      | _ -> ()
+
+  let rec private resolveNode
+    (chain: string list)
+    (directory: string)
+    (location: string)
+    (node: JsonNode)
+    : Result<JsonNode, ModelError> =
+    match node with
+    | :? JsonObject as o when o.ContainsKey Ref ->
+      match o[Ref] with
+      | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+        resolveReference chain directory location (v.GetValue<string>())
+      | _ -> Error(UnresolvedReference(location, "'$ref' must be a string"))
+    | :? JsonObject as o ->
+      let members =
+        o
+        |> Seq.filter (fun kv -> kv.Key <> Includes)
+        |> Seq.toList
+        |> traverse (fun (KeyValue(key, child)) ->
+          match child with
+          | null -> Ok(key, null)
+          | c ->
+            resolveNode chain directory $"{location}.{key}" c
+            |> Result.map (fun r -> key, r))
+
+      let includes =
+        match o[Includes] with
+        | null -> Ok []
+        | :? JsonArray as paths ->
+          paths
+          |> Seq.mapi (fun i p -> i, p)
+          |> Seq.toList
+          |> traverse (fun (i, p) ->
+            let here = $"{location}.{Includes}[{i}]"
+
+            match p with
+            | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+              resolveReference chain directory here (v.GetValue<string>())
+              |> Result.bind (fun doc ->
+                match doc with
+                | :? JsonObject as source -> Ok source
+                | _ -> Error(UnresolvedReference(here, "must be an object")))
+            | _ -> Error(UnresolvedReference(here, "paths must be strings")))
+        | _ ->
+          Error(UnresolvedReference(location, "'$include' must be an array"))
+
+      match members, includes with
+      | Ok ms, Ok incs ->
+        let result = JsonObject()
+
+        for key, child in ms do
+          result[key] <- child
+
+        for source in incs do
+          merge result source
+
+        Ok(result :> JsonNode)
+      | Error e, _
+      | _, Error e -> Error e
+    | :? JsonArray as a ->
+      a
+      |> Seq.mapi (fun i item -> i, item)
+      |> Seq.toList
+      |> traverse (fun (i, item) ->
+        match item with
+        | null -> Ok null
+        | it -> resolveNode chain directory $"{location}[{i}]" it)
+      |> Result.map (fun items -> JsonArray(List.toArray items) :> JsonNode)
+    | leaf -> Ok(leaf.DeepClone())
+
+  and private resolveReference
+    (chain: string list)
+    (directory: string)
+    (location: string)
+    (reference: string)
+    : Result<JsonNode, ModelError> =
+    let file, pointer =
+      match reference.IndexOf '#' with
+      | -1 -> reference, ""
+      | i -> reference.Substring(0, i), reference.Substring(i + 1)
+
+    let path = Path.GetFullPath(Path.Combine(directory, file))
+    let here = $"{location} in {List.head chain}"
+
+    if List.contains path chain then
+      Error(CyclicReference(List.rev (path :: chain)))
+    elif not (File.Exists path) then
+      Error(UnresolvedReference(here, $"file not found '{file}'"))
+    else
+      ModelFormat.fromPath path
+      |> Result.bind (fun format -> parseAs format (File.ReadAllText path))
+      |> Result.bind (
+        resolveNode (path :: chain) (Path.GetDirectoryName path) "$"
+      )
+      |> Result.bind (fun doc ->
+        select pointer doc
+        |> Result.map (fun n -> if isNull n then null else n.DeepClone())
+        |> Result.mapError (fun msg ->
+          UnresolvedReference(here, $"'{reference}': {msg}")))
+
+  /// <summary>
+  /// Resolves all "$ref" and "$include" directives within a document.
+  /// </summary>
+  /// <param name="origin">Path of the file the document was read from.</param>
+  /// <param name="node">Parsed document.</param>
+  /// <returns>Document with all directives replaced, or ModelError.</returns>
+  let resolve (origin: string) (node: JsonNode) : Result<JsonNode, ModelError> =
+    let path = Path.GetFullPath origin
+    resolveNode [ path ] (Path.GetDirectoryName path) "$" node
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Whether a load set is a single case or a factored combination.
+/// </summary>
+type LoadSetKind =
+  | LoadCase
+  | LoadCombination
+
+/// <summary>
+/// Factored loads analysed together and reported under one name.
+/// </summary>
+type LoadSet =
+  { Name: string
+    Kind: LoadSetKind
+    Loads: (float * Load) list }
+
+/// <summary>
+/// Errors raised when selecting load sets by name.
+/// </summary>
+type SelectionError =
+  | UnknownCase of name: string * available: string list
+  | UnknownCombination of name: string * available: string list
+
+[<RequireQualifiedAccess>]
+module SelectionError =
+
+  let getAsString (e: SelectionError) : string =
+    let list (names: string list) = System.String.Join(", ", names)
+
+    match e with
+    | UnknownCase(name, available) ->
+      $"Unknown load case '{name}'. Available: {list available}."
+    | UnknownCombination(name, available) ->
+      $"Unknown combination '{name}'. Available: {list available}."
+
+[<RequireQualifiedAccess>]
+module LoadCases =
+
+  /// Case assigned to loads that do not name one.
+  [<Literal>]
+  let DefaultCase = "default"
+
+  /// Case analysed for a model whose cables are pretensioned but which has
+  /// no loads, so that the pretension alone is still analysed.
+  [<Literal>]
+  let PretensionCase = "pretension"
+
+  /// <summary>
+  /// Returns the load case a load belongs to.
+  /// </summary>
+  /// <param name="l">Load.</param>
+  /// <returns>Case name.</returns>
+  let caseOf (l: Load) : string =
+    l.Case |> Option.defaultValue DefaultCase
+
+  /// <summary>
+  /// Lists the distinct load case names used by a model.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>Sorted case names.</returns>
+  let cases (m: Model) : string list =
+    m.Loads
+    |> Map.toList
+    |> List.map (snd >> caseOf)
+    |> List.distinct
+    |> List.sort
+
+  /// <summary>
+  /// Collects the loads of a single case with unit factors.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="name">Case name.</param>
+  /// <returns>Load set for the case.</returns>
+  let ofCase (m: Model) (name: string) : LoadSet =
+    { Name = name
+      Kind = LoadCase
+      Loads =
+        m.Loads
+        |> Map.toList
+        |> List.map snd
+        |> List.filter (fun l -> caseOf l = name)
+        |> List.map (fun l -> 1.0, l) }
+
+  /// <summary>
+  /// Expands a combination into its factored loads.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="c">Combination.</param>
+  /// <returns>Load set for the combination.</returns>
+  let ofCombination (m: Model) (c: Combination) : LoadSet =
+    { Name = c.Id
+      Kind = LoadCombination
+      Loads =
+        c.Factors
+        |> Map.toList
+        |> List.collect (fun (case, factor) ->
+          (ofCase m case).Loads |> List.map (fun (_, l) -> factor, l)) }
+
+  /// Whether any Cable element of a model declares a pretension.
+  let private pretensioned (m: Model) =
+    m.Elements
+    |> Map.exists (fun _ e ->
+      e.Type = "Cable"
+      && e.Properties
+         |> Option.bind (Map.tryFind "pretension")
+         |> Option.exists (fun t -> t <> 0.0))
+
+  /// <summary>
+  /// Selects the load sets to analyse. With no selection, every case and
+  /// combination is analysed; otherwise only those named. A model with
+  /// pretensioned cables but no loads has a single case, PretensionCase,
+  /// with no loads, in which its cables and structure self-equilibrate.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <param name="caseNames">Cases to analyse, if selected.</param>
+  /// <param name="combinationNames">Combinations, if selected.</param>
+  /// <returns>Selected load sets or the first unknown name.</returns>
+  let select
+    (m: Model)
+    (caseNames: string list option)
+    (combinationNames: string list option)
+    : Result<LoadSet list, SelectionError> =
+    let available =
+      match cases m with
+      | [] when pretensioned m -> [ PretensionCase ]
+      | names -> names
+
+    let combinations = m.Combinations |> Map.toList |> List.map fst
+
+    let caseNames, combinationNames =
+      match caseNames, combinationNames with
+      | None, None -> available, combinations
+      | cs, combos -> defaultArg cs [], defaultArg combos []
+
+    let pickCase name =
+      if List.contains name available then
+        Ok(ofCase m name)
+      else
+        Error(UnknownCase(name, available))
+
+    let pickCombination name =
+      match m.Combinations.TryFind name with
+      | Some c -> Ok(ofCombination m c)
+      | None -> Error(UnknownCombination(name, combinations))
+
+    let folder pick acc name =
+      match acc, pick name with
+      | Ok sets, Ok set -> Ok(sets @ [ set ])
+      | Error e, _
+      | _, Error e -> Error e
+
+    let selectedCases = List.fold (folder pickCase) (Ok []) caseNames
+    List.fold (folder pickCombination) selectedCases combinationNames
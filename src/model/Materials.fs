@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Resolves the material of each element, applying element-level overrides
+/// of material defaults, e.g. a reduced modulus for cracked concrete.
+/// </summary>
+/// <remarks>
+/// Elements override their material with properties named as the material's
+/// fields: "elastic_modulus", "density", "yield_strength",
+/// "shear_modulus", "damping_ratio" and "thermal_expansion".
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Materials =
+
+  /// Property names that override material fields.
+  let overrides =
+    [ "elastic_modulus"
+      "density"
+      "yield_strength"
+      "shear_modulus"
+      "damping_ratio"
+      "thermal_expansion" ]
+
+  /// <summary>
+  /// Returns whether an element takes its stiffness and mass from a
+  /// material. Springs and rigid links do not: they are weightless and
+  /// massless.
+  /// </summary>
+  /// <param name="e">Element.</param>
+  /// <returns>True unless the element is a Spring or RigidLink.</returns>
+  let isRequired (e: Element) : bool =
+    e.Type <> "Spring" && e.Type <> "RigidLink"
+
+  /// <summary>
+  /// Returns the material of an element with its overrides applied.
+  /// </summary>
+  /// <param name="m">Model the element belongs to.</param>
+  /// <param name="e">Element.</param>
+  /// <returns>Effective material, or None when it does not exist.</returns>
+  let ofElement (m: Model) (e: Element) : Material option =
+    let property name =
+      e.Properties |> Option.bind (fun ps -> ps.TryFind name)
+
+    let orDeclared name value = property name |> Option.orElse value
+
+    m.Materials.TryFind e.Material
+    |> Option.map (fun x ->
+      { x with
+          ElasticModulus =
+            property "elastic_modulus" |> Option.defaultValue x.ElasticModulus
+          Density = orDeclared "density" x.Density
+          YieldStrength = orDeclared "yield_strength" x.YieldStrength
+          ShearModulus = orDeclared "shear_modulus" x.ShearModulus
+          DampingRatio = orDeclared "damping_ratio" x.DampingRatio
+          ThermalExpansion =
+            orDeclared "thermal_expansion" x.ThermalExpansion })
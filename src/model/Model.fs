@@ -0,0 +1,271 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.IO
+open System.Text.Json
+open System.Text.Json.Nodes
+
+[<RequireQualifiedAccess>]
+[<CompilationRepresentation(CompilationRepresentationFlags.ModuleSuffix)>]
+module Model =
+
+  /// Path used to denote standard input in place of a model file.
+  [<Literal>]
+  let StdIn = "-"
+
+  /// Default read options: detect the format and apply no overrides.
+  let defaultReadOptions: ReadOptions =
+    { Format = None
+      Parameters = Map.empty }
+
+  let private jsonOptions =
+    let options = JsonSerializerOptions()
+    options.PropertyNamingPolicy <- JsonNamingPolicy.SnakeCaseLower
+    options.PropertyNameCaseInsensitive <- true
+    options.ReadCommentHandling <- JsonCommentHandling.Skip
+    options.AllowTrailingCommas <- true
+    options.WriteIndented <- true
+
+    options.DefaultIgnoreCondition <-
+      Serialization.JsonIgnoreCondition.WhenWritingNull
+
+    options
+
+  /// Replaces collections omitted from the source document with empty maps.
+  let private normalise (m: Model) : Model =
+    let orEmpty (x: Map<string, 'T>) =
+      if isNull (box x) then Map.empty else x
+
+    { m with
+        Nodes = orEmpty m.Nodes
+        Elements = orEmpty m.Elements
+        Materials = orEmpty m.Materials
+        Loads = orEmpty m.Loads
+        Combinations = orEmpty m.Combinations
+        Constraints = orEmpty m.Constraints }
+
+  /// Converts a fully resolved document tree into a model.
+  let private fromNode (node: JsonNode) : Result<Model, ModelError> =
+    try
+      match node.Deserialize<Model>(jsonOptions) with
+      | m when isNull (box m) -> Error(MalformedModel "document is empty")
+      | m when isNull (box m.Info) -> Error(MalformedModel "missing 'info'")
+      | m -> Ok(normalise m)
+    with :? JsonException as ex ->
+      Error(MalformedModel ex.Message)
+
+  /// Parses text, resolving composition directives relative to origin
+  /// and then substituting parameters.
+  let private parseFrom
+    (origin: string)
+    (parameters: Map<string, string>)
+    (format: ModelFormat)
+    (text: string)
+    : Result<Model, ModelError> =
+    Include.parseAs format text
+    |> Result.bind (Include.resolve origin)
+    |> Result.bind (Parameters.substitute parameters)
+    |> Result.bind fromNode
+
+  /// <summary>
+  /// Parses model text in the given format.
+  /// Composition directives resolve relative to the working directory.
+  /// </summary>
+  /// <param name="format">Serialization format of the text.</param>
+  /// <param name="text">Serialized model.</param>
+  /// <returns>Parsed model or ModelError.</returns>
+  let parse (format: ModelFormat) (text: string) : Result<Model, ModelError> =
+    parseFrom "stdin" Map.empty format text
+
+  /// <summary>
+  /// Serializes a model to text in the given format.
+  /// </summary>
+  /// <param name="format">Target serialization format.</param>
+  /// <param name="model">Model to serialize.</param>
+  /// <returns>Serialized model.</returns>
+  /// <exception cref="System.ArgumentException">For IFC, STAAD and Abaqus,
+  /// which are only read, and Protobuf, which is binary; see encode.
+  /// </exception>
+  let serialize (format: ModelFormat) (model: Model) : string =
+    match format with
+    | Json -> JsonSerializer.Serialize(model, jsonOptions)
+    | Yaml -> Yaml.write (JsonSerializer.SerializeToNode(model, jsonOptions))
+    | Ifc -> invalidArg (nameof format) "IFC models cannot be written"
+    | Staad -> invalidArg (nameof format) "STAAD models cannot be written"
+    | Abaqus -> invalidArg (nameof format) "Abaqus models cannot be written"
+    | Protobuf -> invalidArg (nameof format) "Protobuf models are binary"
+
+  /// <summary>
+  /// Encodes a model in the Protocol Buffers binary format, which decode
+  /// reads back many times faster than JSON.
+  /// </summary>
+  /// <param name="model">Model to encode.</param>
+  /// <returns>Encoded model.</returns>
+  let encode (model: Model) : byte array = Protobuf.writeModel model
+
+  /// <summary>
+  /// Decodes a model from the Protocol Buffers binary format.
+  /// </summary>
+  /// <param name="bytes">Model as encode writes it.</param>
+  /// <returns>Decoded model or ModelError.</returns>
+  let decode (bytes: byte array) : Result<Model, ModelError> =
+    Protobuf.readModel bytes
+
+  /// <summary>
+  /// Reads a model from a file, or from standard input when the path is "-".
+  /// An explicit format bypasses extension-based detection.
+  /// Standard input is assumed to be JSON unless a format is given. Binary
+  /// models are written with their parameters substituted, so take no
+  /// overrides.
+  /// </summary>
+  /// <param name="options">Format override and parameter values.</param>
+  /// <param name="path">Path to model file or "-".</param>
+  /// <returns>Parsed model or ModelError.</returns>
+  let readWith
+    (options: ReadOptions)
+    (path: string)
+    : Result<Model, ModelError> =
+    let detected =
+      match options.Format, path with
+      | Some f, _ -> Ok f
+      | None, StdIn -> Ok Json
+      | None, p -> ModelFormat.fromPath p
+
+    let reading (read: unit -> 'T) =
+      try
+        Ok(read ())
+      with
+      | :? IOException as ex -> Error(UnreadableSource ex.Message)
+      | :? UnauthorizedAccessException as ex ->
+        Error(UnreadableSource ex.Message)
+
+    let readText () =
+      match path with
+      | StdIn -> Console.In.ReadToEnd()
+      | p -> File.ReadAllText p
+
+    let readBytes () =
+      match path with
+      | StdIn ->
+        use buffer = new MemoryStream()
+        Console.OpenStandardInput().CopyTo buffer
+        buffer.ToArray()
+      | p -> File.ReadAllBytes p
+
+    let origin = if path = StdIn then "stdin" else path
+
+    detected
+    |> Result.bind (fun f ->
+      match f with
+      | Protobuf when not options.Parameters.IsEmpty ->
+        let reason = "binary models have their parameters substituted"
+        Error(UnsupportedFormat reason)
+      | Protobuf -> reading readBytes |> Result.bind decode
+      | f ->
+        reading readText
+        |> Result.bind (parseFrom origin options.Parameters f))
+
+  /// <summary>
+  /// Reads a model from a file, or from standard input when the path is "-".
+  /// </summary>
+  /// <param name="format">Optional format override.</param>
+  /// <param name="path">Path to model file or "-".</param>
+  /// <returns>Parsed model or ModelError.</returns>
+  let read
+    (format: ModelFormat option)
+    (path: string)
+    : Result<Model, ModelError> =
+    readWith { defaultReadOptions with Format = format } path
+
+  /// <summary>
+  /// Parses a model from tables with one row per node, element, material,
+  /// support or load; see Tables.
+  /// </summary>
+  /// <param name="tables">Name, e.g. the file name, and CSV text of each
+  /// table.</param>
+  /// <returns>Parsed model or ModelError.</returns>
+  let parseTables
+    (tables: (string * string) list)
+    : Result<Model, ModelError> =
+    Tables.parseNode tables |> Result.bind fromNode
+
+  /// <summary>
+  /// Reads a model from CSV files with one row per node, element,
+  /// material, support or load, e.g. exported from a spreadsheet.
+  /// </summary>
+  /// <param name="paths">Paths to the tables, in any order.</param>
+  /// <returns>Parsed model or ModelError.</returns>
+  let readTables (paths: string list) : Result<Model, ModelError> =
+    try
+      paths
+      |> List.map (fun p -> Path.GetFileName p, File.ReadAllText p)
+      |> parseTables
+    with
+    | :? IOException as ex -> Error(UnreadableSource ex.Message)
+    | :? UnauthorizedAccessException as ex -> Error(UnreadableSource ex.Message)
+
+  /// <summary>
+  /// Reads a model from the sheets of an Excel workbook, each a table as
+  /// readTables reads, e.g. one written by writeWorkbook and edited.
+  /// </summary>
+  /// <param name="path">Path to the .xlsx file.</param>
+  /// <returns>Parsed model, named after the file unless the workbook has a
+  /// sheet of info, or ModelError.</returns>
+  let readWorkbook (path: string) : Result<Model, ModelError> =
+    try
+      use stream = File.OpenRead path
+      let name = Path.GetFileNameWithoutExtension path
+
+      Workbook.read stream
+      |> Tables.parseRows name
+      |> Result.bind fromNode
+    with
+    | :? InvalidDataException as ex -> Error(MalformedModel ex.Message)
+    | :? Xml.XmlException as ex -> Error(MalformedModel ex.Message)
+    | :? IOException as ex -> Error(UnreadableSource ex.Message)
+    | :? UnauthorizedAccessException as ex -> Error(UnreadableSource ex.Message)
+
+  /// <summary>
+  /// Writes a model to an Excel workbook with a sheet each of info, nodes,
+  /// elements, materials, constraints, loads and combinations, which
+  /// readWorkbook reads back.
+  /// </summary>
+  /// <remarks>
+  /// Parameters are written as their values, and gravity, damping, time
+  /// histories, point masses and panels are left out.
+  /// </remarks>
+  /// <param name="path">Destination .xlsx file path.</param>
+  /// <param name="model">Model to write.</param>
+  let writeWorkbook (path: string) (model: Model) : unit =
+    use stream = File.Create path
+    Workbook.write (Tables.layout model) stream
+
+  /// <summary>
+  /// Writes a model to a file in the given format.
+  /// </summary>
+  /// <param name="format">Target serialization format.</param>
+  /// <param name="path">Destination file path.</param>
+  /// <param name="model">Model to write.</param>
+  let write (format: ModelFormat) (path: string) (model: Model) : unit =
+    match format with
+    | Protobuf -> File.WriteAllBytes(path, encode model)
+    | format -> File.WriteAllText(path, serialize format model)
+
+  /// <summary>
+  /// Writes a model to a file in the format of its extension, as read
+  /// detects it.
+  /// </summary>
+  /// <param name="path">Destination file path, e.g. model.yaml.</param>
+  /// <param name="model">Model to write.</param>
+  /// <returns>Unit, or UnsupportedFormat for an unknown extension or one
+  /// that is only read.</returns>
+  let save (path: string) (model: Model) : Result<unit, ModelError> =
+    match ModelFormat.fromPath path with
+    | Ok Ifc -> Error(UnsupportedFormat "IFC models cannot be written")
+    | Ok Staad -> Error(UnsupportedFormat "STAAD models cannot be written")
+    | Ok Abaqus -> Error(UnsupportedFormat "Abaqus models cannot be written")
+    | format -> format |> Result.map (fun f -> write f path model)
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Globalization
+open System.Text
+open System.Text.Json
+open System.Text.Json.Nodes
+open System.Text.RegularExpressions
+
+/// <summary>
+/// Substitutes <c>${NAME}</c> placeholders in model documents so that one
+/// template model can be analysed across many configurations.
+/// </summary>
+/// <remarks>
+/// Names resolve against the model's "parameters" block (after any
+/// overrides, e.g. from --set) and then environment variables.
+/// <c>${NAME:-default}</c> supplies a fallback value. A string consisting
+/// solely of a placeholder takes the value's type, so <c>"${span}"</c> can
+/// stand in for a number. Parameters may be numbers or text, but only
+/// numbers are kept in Model.Parameters.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Parameters =
+
+  [<Literal>]
+  let Key = "parameters"
+
+  let private placeholder =
+    let pattern = @"\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}"
+    Regex(pattern, RegexOptions.Compiled)
+
+  /// Converts text to a JSON value, preferring numbers where it parses.
+  let private toValue (text: string) : JsonNode =
+    let styles = NumberStyles.Float
+
+    match Double.TryParse(text, styles, CultureInfo.InvariantCulture) with
+    | true, x -> JsonValue.Create x
+    | _ -> JsonValue.Create text
+
+  /// Renders a JSON value as text for interpolation within a string.
+  let private toText (node: JsonNode) : string =
+    match node with
+    | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+      v.GetValue<string>()
+    | n -> n.ToJsonString()
+
+  let private isString (node: JsonNode) =
+    match node with
+    | :? JsonValue as v -> v.GetValueKind() = JsonValueKind.String
+    | _ -> false
+
+  /// Replaces placeholders within a single string value.
+  let private substituteText
+    (lookup: string -> JsonNode option)
+    (location: string)
+    (text: string)
+    : Result<JsonNode option, ModelError> =
+    let resolveMatch (m: Match) =
+      let name = m.Groups[1].Value
+
+      match lookup name, m.Groups[2].Success with
+      | Some value, _ -> Ok value
+      | None, true -> Ok(toValue m.Groups[2].Value)
+      | None, false -> Error(UnresolvedParameter(location, name))
+
+    let matches = placeholder.Matches text |> Seq.toList
+
+    match matches with
+    | [] -> Ok None
+    | [ m ] when m.Length = text.Length ->
+      resolveMatch m |> Result.map (fun v -> Some(v.DeepClone()))
+    | _ ->
+      let builder = StringBuilder()
+
+      let folder (acc: Result<int, ModelError>) (m: Match) =
+        acc
+        |> Result.bind (fun position ->
+          resolveMatch m
+          |> Result.map (fun value ->
+            builder
+              .Append(text, position, m.Index - position)
+              .Append(toText value)
+            |> ignore
+
+            m.Index + m.Length))
+
+      List.fold folder (Ok 0) matches
+      |> Result.map (fun position ->
+        builder.Append(text.Substring position) |> ignore
+        Some(JsonValue.Create(builder.ToString()) :> JsonNode))
+
+  /// Walks a document, replacing placeholders in place.
+  let rec private walk
+    (lookup: string -> JsonNode option)
+    (location: string)
+    (node: JsonNode)
+    : Result<unit, ModelError> =
+    let visit (here: string) (child: JsonNode) (replace: JsonNode -> unit) =
+      match child with
+      | null -> Ok()
+      | c when isString c ->
+        substituteText lookup here (toText c)
+        |> Result.map (Option.iter replace)
+      | c -> walk lookup here c
+
+    match node with
+    | :? JsonObject as o ->
+      o
+      |> Seq.map (fun kv -> kv.Key)
+      |> Seq.toList
+      |> List.fold
+        (fun acc key ->
+          acc
+          |> Result.bind (fun () ->
+            visit $"{location}.{key}" o[key] (fun v -> o[key] <- v)))
+        (Ok())
+    | :? JsonArray as a ->
+      [ 0 .. a.Count - 1 ]
+      |> List.fold
+        (fun acc i ->
+          acc
+          |> Result.bind (fun () ->
+            visit $"{location}[{i}]" a[i] (fun v -> a[i] <- v)))
+        (Ok())
+    | _ -> Ok()
+
+  let private environment (name: string) : JsonNode option =
+    match Environment.GetEnvironmentVariable name with
+    | null -> None
+    | value -> Some(toValue value)
+
+  /// <summary>
+  /// Applies parameter overrides and substitutes placeholders in place.
+  /// </summary>
+  /// <param name="overrides">Values replacing declared parameters.</param>
+  /// <param name="node">Document with composition directives resolved.</param>
+  /// <returns>Substituted document, or ModelError.</returns>
+  let substitute
+    (overrides: Map<string, string>)
+    (node: JsonNode)
+    : Result<JsonNode, ModelError> =
+    let declared =
+      match node with
+      | :? JsonObject as o ->
+        match o[Key] with
+        | :? JsonObject as p -> Some p
+        | _ -> None
+      | _ -> None
+
+    let unknown =
+      overrides
+      |> Map.toList
+      |> List.tryFind (fun (name, _) ->
+        declared |> Option.forall (fun p -> not (p.ContainsKey name)))
+
+    match unknown, declared with
+    | Some(name, _), _ -> Error(UnknownParameter name)
+    | None, None -> walk environment "$" node |> Result.map (fun () -> node)
+    | None, Some parameters ->
+      for KeyValue(name, value) in overrides do
+        parameters[name] <- toValue value
+
+      let lookup (name: string) =
+        match parameters[name] with
+        | null -> environment name
+        | value -> Some value
+
+      walk environment $"$.{Key}" parameters
+      |> Result.bind (fun () -> walk lookup "$" node)
+      |> Result.map (fun () ->
+        // Text values serve only their placeholders; models keep numbers.
+        let texts =
+          [ for KeyValue(name, value) in parameters do
+              if isString value then
+                name ]
+
+        for name in texts do
+          parameters.Remove name |> ignore
+
+        node)
@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.IO
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// <summary>
+/// Connection between a node of one part of an assembly and a node of
+/// another.
+/// </summary>
+type Interface =
+  { Id: string
+    /// "Rigid" ties the second node to the first; "Spring" joins them with
+    /// the stiffness along each freedom in Stiffness.
+    Type: string
+    /// The two nodes joined, each qualified by its part, e.g. "core.n12".
+    Nodes: string list
+    /// Stiffness by freedom of a spring interface, e.g. "ux".
+    Stiffness: Map<string, float> option }
+
+/// <summary>
+/// Assembles a project model from sub-models, or parts, held in their own
+/// files, so that teams can model parts of a large project separately.
+/// </summary>
+/// <remarks>
+/// An assembly is a model document that names its parts in
+/// <c>"parts": { "core": "core.json" }</c>, with paths relative to the
+/// assembly, and joins their nodes with <c>interfaces</c>. It is flattened
+/// into a single model when read: each part is converted to the units of
+/// the assembly and the IDs of its entities, including materials, are
+/// qualified by the part's name, so "n12" of "core" becomes "core.n12".
+/// Load cases keep their names and so are shared between parts, as are
+/// combinations, which the assembly's own definitions override. The
+/// assembly may add nodes, elements, loads and constraints of its own,
+/// referring to those of its parts by qualified ID; its gravity, damping
+/// and time history apply to the whole. Parts are read as plain models
+/// with the values their parameters declare.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Parts =
+
+  [<Literal>]
+  let Property = "parts"
+
+  [<Literal>]
+  let Interfaces = "interfaces"
+
+  /// Separator between the name of a part and the IDs of its entities.
+  [<Literal>]
+  let Separator = "."
+
+  let private jsonOptions =
+    let options = JsonSerializerOptions()
+    options.PropertyNamingPolicy <- JsonNamingPolicy.SnakeCaseLower
+    options.PropertyNameCaseInsensitive <- true
+    options
+
+  let private traverse
+    (f: 'T -> Result<'U, ModelError>)
+    (items: 'T list)
+    : Result<'U list, ModelError> =
+    let folder item acc =
+      match f item, acc with
+      | Ok x, Ok xs -> Ok(x :: xs)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder items (Ok [])
+
+  /// <summary>
+  /// Qualifies the ID of every entity of a part, and every reference to
+  /// one, by the part's name.
+  /// </summary>
+  /// <param name="part">Name of the part.</param>
+  /// <param name="m">Model of the part.</param>
+  /// <returns>Model with qualified IDs.</returns>
+  let qualify (part: string) (m: Model) : Model =
+    let name (id: string) = part + Separator + id
+
+    let rekey (entries: Map<string, 'T>) (update: string -> 'T -> 'T) =
+      entries
+      |> Map.toList
+      |> List.map (fun (id, entity) -> name id, update (name id) entity)
+      |> Map.ofList
+
+    // Springs and rigid links name no material.
+    let material (id: string) = if id = "" then id else name id
+
+    { m with
+        Nodes = rekey m.Nodes (fun id n -> { n with Id = id })
+        Elements =
+          rekey m.Elements (fun id e ->
+            { e with
+                Id = id
+                Nodes = List.map name e.Nodes
+                Material = material e.Material
+                Releases =
+                  e.Releases
+                  |> Option.map (fun rs ->
+                    rs
+                    |> Map.toList
+                    |> List.map (fun (n, dofs) -> name n, dofs)
+                    |> Map.ofList) })
+        Materials = rekey m.Materials (fun id x -> { x with Id = id })
+        Loads =
+          rekey m.Loads (fun id l ->
+            { l with
+                Id = id
+                Node = Option.map name l.Node
+                Element = Option.map name l.Element })
+        Constraints =
+          rekey m.Constraints (fun id c ->
+            { c with
+                Id = id
+                Node = name c.Node })
+        Masses =
+          m.Masses
+          |> Option.map (fun xs ->
+            rekey xs (fun id x ->
+              { x with
+                  Id = id
+                  Node = name x.Node }))
+        Panels =
+          m.Panels
+          |> Option.map (fun ps ->
+            rekey ps (fun id p ->
+              { p with
+                  Id = id
+                  Nodes = List.map name p.Nodes })) }
+
+  /// Element joining the nodes of an interface.
+  let private connect (nodes: Map<string, Node>) (i: Interface) =
+    let nodeList = if isNull (box i.Nodes) then [] else i.Nodes
+    let unknown = nodeList |> List.tryFind (fun n -> not (nodes.ContainsKey n))
+
+    let element kind properties =
+      { Id = i.Id
+        Type = kind
+        Nodes = nodeList
+        Material = ""
+        Properties = properties
+        Releases = None }
+
+    match nodeList, unknown with
+    | _, Some node ->
+      Error(InvalidInterface(i.Id, $"joins unknown node '{node}'"))
+    | [ a; b ], None when a = b ->
+      Error(InvalidInterface(i.Id, "joins a node to itself"))
+    | [ _; _ ], None ->
+      match i.Type, i.Stiffness with
+      | "Rigid", _ -> Ok(element "RigidLink" None)
+      | "Spring", Some ks when not ks.IsEmpty -> Ok(element "Spring" (Some ks))
+      | "Spring", _ -> Error(InvalidInterface(i.Id, "has no stiffness"))
+      | kind, _ ->
+        Error(InvalidInterface(i.Id, $"has unknown type '{kind}'"))
+    | _ -> Error(InvalidInterface(i.Id, "must join exactly two nodes"))
+
+  /// <summary>
+  /// Flattens an assembly and its parts into a single model.
+  /// </summary>
+  /// <param name="assembly">Assembly's own definitions.</param>
+  /// <param name="parts">Model of each part, by name.</param>
+  /// <param name="interfaces">Connections between nodes of the parts.</param>
+  /// <returns>Model in the units of the assembly, or ModelError.</returns>
+  let flatten
+    (assembly: Model)
+    (parts: (string * Model) list)
+    (interfaces: Interface list)
+    : Result<Model, ModelError> =
+    let units =
+      UnitSystem.tryFind assembly.Info.Units
+      |> Result.mapError (fun e ->
+        MalformedModel((ConversionError.getAsString e).TrimEnd('.')))
+
+    // Entries of the second map take precedence.
+    let union (a: Map<string, 'T>) (b: Map<string, 'T>) =
+      Map.fold (fun acc k v -> Map.add k v acc) a b
+
+    let unionOption a b =
+      match a, b with
+      | None, None -> None
+      | _ ->
+        let orEmpty = Option.defaultValue Map.empty
+        Some(union (orEmpty a) (orEmpty b))
+
+    units
+    |> Result.bind (fun target ->
+      parts
+      |> traverse (fun (name, m) ->
+        UnitSystem.convert target m
+        |> Result.mapError (fun e ->
+          let reason = (ConversionError.getAsString e).TrimEnd('.')
+          InvalidPart(name, $"cannot be converted: {reason}"))
+        |> Result.map (fun m -> name, qualify name m)))
+    |> Result.bind (fun parts ->
+      // Combinations are shared; a part may not redefine another's.
+      let combinations =
+        parts
+        |> List.fold
+          (fun acc (name, m) ->
+            acc
+            |> Result.bind (fun (cs: Map<string, Combination>) ->
+              let clash =
+                m.Combinations
+                |> Map.tryFindKey (fun id c ->
+                  match cs.TryFind id with
+                  | Some other -> other.Factors <> c.Factors
+                  | None -> false)
+
+              match clash with
+              | Some id ->
+                let reason = $"redefines combination '{id}' of another part"
+                Error(InvalidPart(name, reason))
+              | None -> Ok(union m.Combinations cs)))
+          (Ok Map.empty)
+
+      combinations
+      |> Result.bind (fun combinations ->
+        let merged =
+          parts
+          |> List.fold
+            (fun (acc: Model) (_, m) ->
+              { acc with
+                  Nodes = union m.Nodes acc.Nodes
+                  Elements = union m.Elements acc.Elements
+                  Materials = union m.Materials acc.Materials
+                  Loads = union m.Loads acc.Loads
+                  Constraints = union m.Constraints acc.Constraints
+                  Masses = unionOption m.Masses acc.Masses
+                  Panels = unionOption m.Panels acc.Panels })
+            assembly
+
+        let clash =
+          interfaces |> List.tryFind (fun i -> merged.Elements.ContainsKey i.Id)
+
+        match clash with
+        | Some i ->
+          Error(InvalidInterface(i.Id, "has the ID of an element"))
+        | None ->
+          interfaces
+          |> traverse (connect merged.Nodes)
+          |> Result.map (fun links ->
+            { merged with
+                Elements =
+                  links
+                  |> List.fold
+                    (fun acc e -> Map.add e.Id e acc)
+                    merged.Elements
+                Combinations = union combinations assembly.Combinations })))
+
+  /// Reads the parts and interfaces an assembly document declares.
+  let private declarations (path: string) (document: JsonObject) =
+    let directory = Path.GetDirectoryName(Path.GetFullPath path)
+
+    let read (name: string, file: JsonNode) =
+      match file with
+      | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+        let target = Path.Combine(directory, v.GetValue<string>())
+
+        Model.readWith Model.defaultReadOptions target
+        |> Result.map (fun m -> name, m)
+        |> Result.mapError (fun e ->
+          let reason = (ModelError.getAsString e).TrimEnd('.')
+          InvalidPart(name, $"cannot be read: {reason}"))
+      | _ -> Error(InvalidPart(name, "must name a model file"))
+
+    let parts =
+      match document[Property] with
+      | :? JsonObject as o ->
+        o
+        |> Seq.map (fun kv -> kv.Key, kv.Value)
+        |> List.ofSeq
+        |> traverse read
+      | _ -> Error(MalformedModel $"'{Property}' must map names to files")
+
+    let interfaces =
+      match document[Interfaces] with
+      | null -> Ok []
+      | node ->
+        try
+          node.Deserialize<Map<string, Interface>>(jsonOptions)
+          |> Map.toList
+          |> List.map (fun (id, i) -> { i with Id = id })
+          |> Ok
+        with :? JsonException as ex ->
+          Error(MalformedModel ex.Message)
+
+    match parts, interfaces with
+    | Error e, _
+    | _, Error e -> Error e
+    | Ok parts, Ok interfaces -> Ok(parts, interfaces)
+
+  /// <summary>
+  /// Reads a model as Model.readWith does, flattening it when it is an
+  /// assembly of parts.
+  /// </summary>
+  /// <param name="options">Format override and parameter values, which
+  /// apply to the assembly's own document.</param>
+  /// <param name="path">Path to model or assembly file, or "-".</param>
+  /// <returns>Parsed model or ModelError.</returns>
+  let readWith
+    (options: ReadOptions)
+    (path: string)
+    : Result<Model, ModelError> =
+    let assembly =
+      if path = Model.StdIn then
+        None
+      else
+        try
+          let format =
+            match options.Format with
+            | Some f -> Ok f
+            | None -> ModelFormat.fromPath path
+
+          match format with
+          // Binary models are already flat.
+          | Ok Protobuf -> None
+          | Ok f ->
+            match Include.parseAs f (File.ReadAllText path) with
+            | Ok(:? JsonObject as o) when o.ContainsKey Property -> Some o
+            | _ -> None
+          | Error _ -> None
+        with
+        | :? IOException
+        | :? UnauthorizedAccessException -> None
+
+    match assembly with
+    | None -> Model.readWith options path
+    | Some document ->
+      Model.readWith options path
+      |> Result.bind (fun own ->
+        declarations path document
+        |> Result.bind (fun (parts, interfaces) ->
+          flatten own parts interfaces))
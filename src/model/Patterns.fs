@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+
+/// <summary>
+/// Errors raised when generating pattern load cases.
+/// </summary>
+type PatternError =
+  | MissingCase of case: string
+  | NoSpans of case: string
+  | NameTaken of name: string
+
+[<RequireQualifiedAccess>]
+module PatternError =
+
+  let getAsString (e: PatternError) : string =
+    match e with
+    | MissingCase case -> $"Load case '{case}' has no loads."
+    | NoSpans case ->
+      $"Load case '{case}' loads no continuous beam of two or more spans."
+    | NameTaken name ->
+      $"Pattern '{name}' is already used by a load, case or combination."
+
+/// <summary>
+/// Generates pattern (skip) arrangements of a variable load case over the
+/// spans of continuous beams, as design codes require for the greatest
+/// span and support moments.
+/// </summary>
+/// <remarks>
+/// A beam line is a run of collinear two-node beam or frame elements; it
+/// is divided into spans at nodes that are restrained or where any other
+/// element joins it, such as a column. Spans are numbered from the end of
+/// each line with the least X, then Y, then Z coordinate. The patterns
+/// load the odd spans of every line, the even spans, and each pair of
+/// adjacent spans either side of an interior support. A load belongs to
+/// the span of the element it acts on or the span whose interior node it
+/// acts at; any other load of the case, e.g. at a support or on a plate,
+/// is applied in every pattern.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Patterns =
+
+  let private members = set [ "Beam2D"; "Frame2D"; "Beam3D"; "Frame3D" ]
+
+  let private direction (m: Model) (e: Element) =
+    let a, b = m.Nodes[e.Nodes[0]], m.Nodes[e.Nodes[1]]
+    let d = [| b.X - a.X; b.Y - a.Y; b.Z - a.Z |]
+    let length = sqrt (Array.sumBy (fun x -> x * x) d)
+    d |> Array.map (fun x -> x / max length Double.Epsilon)
+
+  /// <summary>
+  /// Finds the spans of the continuous beams in a model.
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>
+  /// Each beam line, as its spans in order along it, each span as the IDs
+  /// of its elements.
+  /// </returns>
+  let spans (m: Model) : string list list list =
+    let bars =
+      m.Elements
+      |> Map.filter (fun _ e ->
+        members.Contains e.Type
+        && e.Nodes.Length = 2
+        && e.Nodes |> List.forall m.Nodes.ContainsKey)
+
+    let attached =
+      m.Elements
+      |> Map.toList
+      |> List.collect (fun (id, e) -> e.Nodes |> List.map (fun n -> n, id))
+      |> List.groupBy fst
+      |> List.map (fun (n, ids) -> n, List.map snd ids |> List.distinct)
+      |> Map.ofList
+
+    let restrained =
+      m.Constraints |> Map.toList |> List.map (fun (_, c) -> c.Node) |> set
+
+    // The bar continuing a line through a node, if any.
+    let next (from: string) (node: string) =
+      let d = direction m bars[from]
+
+      attached[node]
+      |> List.filter (fun id -> id <> from && bars.ContainsKey id)
+      |> List.filter (fun id ->
+        let along = direction m bars[id]
+        abs (Array.fold2 (fun s a b -> s + a * b) 0.0 d along) > 1.0 - 1e-9)
+      |> List.tryExactlyOne
+
+    let other (e: Element) node =
+      if e.Nodes[0] = node then e.Nodes[1] else e.Nodes[0]
+
+    let visited = Collections.Generic.HashSet<string>()
+
+    // Each joint and the bar beyond it, walking away from a bar.
+    let rec walk (from: string) (node: string) =
+      match next from node with
+      | Some id when visited.Add id ->
+        (node, id) :: walk id (other bars[id] node)
+      | _ -> []
+
+    // A line divides where it is restrained or another element joins it.
+    let divides node (line: string list) =
+      restrained.Contains node
+      || attached[node] |> List.exists (fun id -> not (List.contains id line))
+
+    let position (n: string) = m.Nodes[n].X, m.Nodes[n].Y, m.Nodes[n].Z
+
+    [ for KeyValue(id, e) in bars do
+        if visited.Add id then
+          let back = walk id e.Nodes[0] |> List.rev
+          let forward = walk id e.Nodes[1]
+
+          // Bars in order along the line, with the joint before each but
+          // the first.
+          let line = List.map snd back @ [ id ] @ List.map snd forward
+          let joints = List.map fst back @ List.map fst forward
+
+          let first =
+            match back with
+            | (node, bar) :: _ -> other bars[bar] node
+            | [] -> e.Nodes[0]
+
+          let last =
+            match List.tryLast forward with
+            | Some(node, bar) -> other bars[bar] node
+            | None -> e.Nodes[1]
+
+          // Spans are numbered from the end with the least coordinates.
+          let line, joints =
+            if position last < position first then
+              List.rev line, List.rev joints
+            else
+              line, joints
+
+          List.zip joints line.Tail
+          |> List.fold
+            (fun spans (node, bar) ->
+              match spans with
+              | current :: rest when not (divides node line) ->
+                (bar :: current) :: rest
+              | _ -> [ bar ] :: spans)
+            [ [ line.Head ] ]
+          |> List.map List.rev
+          |> List.rev ]
+
+  /// <summary>
+  /// Adds the pattern arrangements of a load case to a model as new load
+  /// cases, named after the case, e.g. "LL-odd", "LL-even" and
+  /// "LL-spans1-2", and repeats each combination that factors the case
+  /// once per pattern.
+  /// </summary>
+  /// <param name="case">Variable load case to arrange, e.g. "LL".</param>
+  /// <param name="m">Model.</param>
+  /// <returns>Model with the patterns added, or PatternError.</returns>
+  let generate (case: string) (m: Model) : Result<Model, PatternError> =
+    let loads =
+      m.Loads
+      |> Map.toList
+      |> List.map snd
+      |> List.filter (fun l -> LoadCases.caseOf l = case)
+
+    let lines = spans m
+
+    // Span index of each element and of each node inside a span.
+    let positions =
+      [ for line in lines do
+          if line.Length > 1 then
+            for i, span in List.indexed line do
+              let nodes =
+                span
+                |> List.collect (fun id -> m.Elements[id].Nodes)
+                |> List.countBy id
+
+              for id in span do
+                id, i + 1
+
+              // Nodes shared by two elements of the span are inside it.
+              for node, count in nodes do
+                if count > 1 then
+                  node, i + 1 ]
+      |> Map.ofList
+
+    let spanOf (l: Load) =
+      match l.Element, l.Node with
+      | Some e, _ -> positions.TryFind e
+      | None, Some n -> positions.TryFind n
+      | None, None -> None
+
+    let most = lines |> List.map List.length |> List.fold max 0
+
+    // Suffix of each pattern and whether it loads a span.
+    let patterns =
+      [ "odd", (fun span -> span % 2 = 1)
+        "even", (fun span -> span % 2 = 0)
+        for k in 1 .. most - 1 do
+          $"spans{k}-{k + 1}", (fun span -> span = k || span = k + 1) ]
+
+    let added =
+      [ for suffix, loaded in patterns do
+          for l in loads do
+            match spanOf l with
+            | Some span when not (loaded span) -> ()
+            | _ ->
+              let id = $"{l.Id}-{suffix}"
+              id, { l with Id = id; Case = Some $"{case}-{suffix}" } ]
+
+    let combinations =
+      [ for KeyValue(_, c) in m.Combinations do
+          match c.Factors.TryFind case with
+          | Some factor ->
+            for suffix, _ in patterns do
+              let id = $"{c.Id}-{suffix}"
+              let factors = c.Factors |> Map.remove case
+              id, { Id = id; Factors = Map.add $"{case}-{suffix}" factor factors }
+          | None -> () ]
+
+    let taken =
+      [ yield! added |> List.map fst
+        yield! combinations |> List.map fst
+        yield! patterns |> List.map (fun (suffix, _) -> $"{case}-{suffix}") ]
+      |> List.tryFind (fun name ->
+        m.Loads.ContainsKey name
+        || m.Combinations.ContainsKey name
+        || List.contains name (LoadCases.cases m))
+
+    match taken with
+    | _ when loads.IsEmpty -> Error(MissingCase case)
+    | _ when not (loads |> List.exists (spanOf >> Option.isSome)) ->
+      Error(NoSpans case)
+    | Some name -> Error(NameTaken name)
+    | None ->
+      Ok
+        { m with
+            Loads =
+              List.fold (fun acc (id, l) -> Map.add id l acc) m.Loads added
+            Combinations =
+              List.fold
+                (fun acc (id, c) -> Map.add id c acc)
+                m.Combinations
+                combinations }
@@ -0,0 +1,581 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Buffers.Binary
+open System.Globalization
+open System.IO
+open System.Text
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// Defect in a Protocol Buffers message.
+type private ProtobufException(reason: string) =
+  inherit Exception(reason)
+
+/// Field of a message as encoded on the wire.
+type private Wire =
+  | Varint of uint64
+  | Fixed64 of uint64
+  | Delimited of start: int * length: int
+  | Fixed32 of uint32
+
+/// <summary>
+/// Reads and writes models, and result records, in the Protocol Buffers
+/// binary encoding of the schema in .agents/schemas/model.proto, which is
+/// read many times faster than JSON for very large models.
+/// </summary>
+/// <remarks>
+/// Models are written with their parameters substituted, so binary models
+/// take neither composition directives nor overrides. Result records may
+/// be any document tree, encoded as a google.protobuf.Value, and are read
+/// back as the JSON they were written from, so readers of records treat
+/// both alike. Unknown fields are skipped, so models and records written
+/// by later releases stay readable.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Protobuf =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  let private fail reason = raise (ProtobufException reason)
+
+  // Writing.
+
+  let private varint (s: Stream) (x: uint64) =
+    let mutable x = x
+
+    while x >= 0x80UL do
+      s.WriteByte(byte (x &&& 0x7FUL ||| 0x80UL))
+      x <- x >>> 7
+
+    s.WriteByte(byte x)
+
+  let private key (s: Stream) (field: int) (wire: int) =
+    varint s (uint64 (field <<< 3 ||| wire))
+
+  let private fixed64 (s: Stream) (x: float) =
+    let bytes = Array.zeroCreate<byte> 8
+    BinaryPrimitives.WriteDoubleLittleEndian(Span bytes, x)
+    s.Write(bytes, 0, bytes.Length)
+
+  let private real (s: Stream) (field: int) (x: float) =
+    key s field 1
+    fixed64 s x
+
+  let private integer (s: Stream) (field: int) (x: int) =
+    key s field 0
+    varint s (uint64 (int64 x))
+
+  let private boolean (s: Stream) (field: int) (x: bool) =
+    key s field 0
+    varint s (if x then 1UL else 0UL)
+
+  /// Writes a string, unless null as absent from its document.
+  let private text (s: Stream) (field: int) (x: string) =
+    if not (isNull x) then
+      let bytes = Encoding.UTF8.GetBytes x
+      key s field 2
+      varint s (uint64 bytes.Length)
+      s.Write(bytes, 0, bytes.Length)
+
+  let private message (s: Stream) (field: int) (write: Stream -> unit) =
+    use inner = new MemoryStream()
+    write inner
+    key s field 2
+    varint s (uint64 inner.Length)
+    inner.WriteTo s
+
+  let private option write (s: Stream) (field: int) (x: 'T option) =
+    x |> Option.iter (write s field)
+
+  /// Writes repeated doubles packed, as proto3 does.
+  let private reals (s: Stream) (field: int) (xs: float list) =
+    if not (isNull (box xs)) && not xs.IsEmpty then
+      message s field (fun inner -> xs |> List.iter (fixed64 inner))
+
+  let private texts (s: Stream) (field: int) (xs: string list) =
+    if not (isNull (box xs)) then
+      xs |> List.iter (text s field)
+
+  /// Writes each entry of a map as a message of its key and value.
+  let private entries write (s: Stream) (field: int) (m: Map<string, 'T>) =
+    if not (isNull (box m)) then
+      for KeyValue(k, v) in m do
+        message s field (fun entry ->
+          text entry 1 k
+          write entry 2 v)
+
+  /// Writes a map within a message of its own, so that an empty map is
+  /// told apart from an absent one.
+  let private doubles (s: Stream) (field: int) (m: Map<string, float>) =
+    message s field (fun inner -> entries real inner 1 m)
+
+  let private info (s: Stream) (field: int) (i: ModelInfo) =
+    message s field (fun s ->
+      text s 1 i.Name
+      option text s 2 i.Description
+      text s 3 i.Units
+      text s 4 i.Version
+      option integer s 5 i.Dimensions)
+
+  let private node (s: Stream) (field: int) (n: Node) =
+    message s field (fun s ->
+      text s 1 n.Id
+      real s 2 n.X
+      real s 3 n.Y
+      real s 4 n.Z)
+
+  let private element (s: Stream) (field: int) (e: Element) =
+    let strings (s: Stream) (field: int) (xs: string list) =
+      message s field (fun s -> texts s 1 xs)
+
+    message s field (fun s ->
+      text s 1 e.Id
+      text s 2 e.Type
+      texts s 3 e.Nodes
+      text s 4 e.Material
+      option doubles s 5 e.Properties
+
+      e.Releases
+      |> Option.iter (fun r -> message s 6 (fun s -> entries strings s 1 r)))
+
+  let private material (s: Stream) (field: int) (m: Material) =
+    message s field (fun s ->
+      text s 1 m.Id
+      text s 2 m.Name
+      text s 3 m.Type
+      real s 4 m.ElasticModulus
+      option real s 5 m.Density
+      option real s 6 m.YieldStrength
+      option real s 7 m.ShearModulus
+      option real s 8 m.DampingRatio
+      option real s 9 m.ThermalExpansion)
+
+  let private load (s: Stream) (field: int) (l: Load) =
+    message s field (fun s ->
+      text s 1 l.Id
+      text s 2 l.Type
+      option text s 3 l.Node
+      option text s 4 l.Element
+      text s 5 l.Direction
+      real s 6 l.Magnitude
+      option real s 7 l.Position
+      option real s 8 l.End
+      option real s 9 l.EndMagnitude
+      option real s 10 l.Datum
+      option real s 11 l.Gradient
+      option text s 12 l.Case)
+
+  let private combination (s: Stream) (field: int) (c: Combination) =
+    message s field (fun s ->
+      text s 1 c.Id
+      entries real s 2 c.Factors)
+
+  let private gravity (s: Stream) (field: int) (g: Gravity) =
+    message s field (fun s ->
+      real s 1 g.Magnitude
+      reals s 2 g.Direction)
+
+  let private damping (s: Stream) (field: int) (d: Damping) =
+    message s field (fun s ->
+      option real s 1 d.Ratio
+      option doubles s 2 d.Modes
+
+      d.Rayleigh
+      |> Option.iter (fun r ->
+        message s 3 (fun s ->
+          real s 1 r.Mass
+          real s 2 r.Stiffness)))
+
+  let private timeHistory (s: Stream) (field: int) (t: TimeHistory) =
+    let history (s: Stream) (field: int) (h: LoadHistory) =
+      message s field (fun s ->
+        reals s 1 h.Times
+        reals s 2 h.Factors)
+
+    message s field (fun s ->
+      real s 1 t.TimeStep
+      real s 2 t.Duration
+      entries history s 3 t.Cases)
+
+  let private panel (s: Stream) (field: int) (p: Panel) =
+    message s field (fun s ->
+      text s 1 p.Id
+      text s 2 p.Type
+      texts s 3 p.Nodes
+      entries real s 4 p.Loads)
+
+  let private pointMass (s: Stream) (field: int) (m: PointMass) =
+    message s field (fun s ->
+      text s 1 m.Id
+      text s 2 m.Node
+      real s 3 m.Mass
+      option doubles s 4 m.Inertia)
+
+  let private constraint' (s: Stream) (field: int) (c: Constraint) =
+    message s field (fun s ->
+      text s 1 c.Id
+      text s 2 c.Type
+      text s 3 c.Node
+      texts s 4 c.Dof
+      option real s 5 c.Angle
+      option doubles s 6 c.Stiffness
+      option doubles s 7 c.Displacement)
+
+  /// <summary>
+  /// Encodes a model as a Model message.
+  /// </summary>
+  /// <param name="m">Model to encode.</param>
+  /// <returns>Protocol Buffers encoding of the model.</returns>
+  let writeModel (m: Model) : byte array =
+    use s = new MemoryStream()
+    info s 1 m.Info
+    option doubles s 2 m.Parameters
+    option gravity s 3 m.Gravity
+    option damping s 4 m.Damping
+    option timeHistory s 5 m.TimeHistory
+    entries node s 6 m.Nodes
+    entries element s 7 m.Elements
+    entries material s 8 m.Materials
+    entries load s 9 m.Loads
+    entries combination s 10 m.Combinations
+    entries constraint' s 11 m.Constraints
+
+    m.Masses
+    |> Option.iter (fun xs -> message s 12 (fun s -> entries pointMass s 1 xs))
+
+    m.Panels
+    |> Option.iter (fun xs -> message s 13 (fun s -> entries panel s 1 xs))
+
+    s.ToArray()
+
+  let rec private value (s: Stream) (node: JsonNode) =
+    match node with
+    | null -> integer s 1 0
+    | :? JsonObject as o ->
+      message s 5 (fun s ->
+        for KeyValue(k, v) in o do
+          message s 1 (fun entry ->
+            text entry 1 k
+            message entry 2 (fun inner -> value inner v)))
+    | :? JsonArray as xs ->
+      message s 6 (fun s ->
+        for x in xs do
+          message s 1 (fun inner -> value inner x))
+    | :? JsonValue as v ->
+      match v.GetValueKind() with
+      | JsonValueKind.String -> text s 3 (v.GetValue<string>())
+      | JsonValueKind.Number ->
+        match v.TryGetValue<float>() with
+        | true, x -> real s 2 x
+        | _ -> real s 2 (Double.Parse(v.ToJsonString(), culture))
+      | JsonValueKind.True -> boolean s 4 true
+      | JsonValueKind.False -> boolean s 4 false
+      | _ -> integer s 1 0
+    | _ -> integer s 1 0
+
+  /// <summary>
+  /// Encodes a document tree, e.g. a result record, as a
+  /// google.protobuf.Value.
+  /// </summary>
+  /// <param name="node">Document tree.</param>
+  /// <returns>Protocol Buffers encoding of the tree.</returns>
+  let writeRecord (node: JsonNode) : byte array =
+    use s = new MemoryStream()
+    value s node
+    s.ToArray()
+
+  // Reading.
+
+  let private readVarint (b: byte array) (finish: int) (start: int) =
+    let rec go i shift acc =
+      if i >= finish || shift > 63 then
+        fail "ends within a varint"
+      else
+        let x = b[i]
+        let acc = acc ||| (uint64 (x &&& 0x7Fuy) <<< shift)
+        if x < 0x80uy then acc, i + 1 else go (i + 1) (shift + 7) acc
+
+    go start 0 0UL
+
+  /// Fields of the message from start to finish, in order.
+  let private fields (b: byte array) (start: int) (finish: int) =
+    let rec go i acc =
+      if i >= finish then
+        List.rev acc
+      else
+        let k, i = readVarint b finish i
+        let field = int (k >>> 3)
+
+        match int (k &&& 7UL) with
+        | 0 ->
+          let x, i = readVarint b finish i
+          go i ((field, Varint x) :: acc)
+        | 1 when i + 8 <= finish ->
+          let x = BinaryPrimitives.ReadUInt64LittleEndian(ReadOnlySpan(b, i, 8))
+          go (i + 8) ((field, Fixed64 x) :: acc)
+        | 2 ->
+          let n, i = readVarint b finish i
+
+          if n > uint64 (finish - i) then
+            fail $"field {field} runs past the end of its message"
+
+          go (i + int n) ((field, Delimited(i, int n)) :: acc)
+        | 5 when i + 4 <= finish ->
+          let x = BinaryPrimitives.ReadUInt32LittleEndian(ReadOnlySpan(b, i, 4))
+          go (i + 4) ((field, Fixed32 x) :: acc)
+        | 1
+        | 5 -> fail $"field {field} runs past the end of its message"
+        | wire -> fail $"field {field} has unknown wire type {wire}"
+
+    go start []
+
+  let private within (b: byte array) (wire: Wire) =
+    match wire with
+    | Delimited(start, length) -> fields b start (start + length)
+    | _ -> fail "a message is not length-delimited"
+
+  let private toReal (wire: Wire) =
+    match wire with
+    | Fixed64 x -> BitConverter.Int64BitsToDouble(int64 x)
+    | _ -> fail "a double is not 64-bit"
+
+  let private toText (b: byte array) (wire: Wire) =
+    match wire with
+    | Delimited(start, length) -> Encoding.UTF8.GetString(b, start, length)
+    | _ -> fail "a string is not length-delimited"
+
+  let private toInt (wire: Wire) =
+    match wire with
+    | Varint x -> int x
+    | _ -> fail "an integer is not a varint"
+
+  /// Values of a field, e.g. each item of a repeated field.
+  let private every (field: int) (fs: (int * Wire) list) =
+    fs |> List.choose (fun (f, w) -> if f = field then Some w else None)
+
+  /// Value of a singular field, the last where repeated.
+  let private last (field: int) (fs: (int * Wire) list) =
+    fs |> List.tryFindBack (fst >> (=) field) |> Option.map snd
+
+  let private getText b field fs =
+    last field fs |> Option.map (toText b) |> Option.defaultValue ""
+
+  let private getReal field fs =
+    last field fs |> Option.map toReal |> Option.defaultValue 0.0
+
+  let private getTexts b field fs = every field fs |> List.map (toText b)
+
+  /// Repeated doubles, packed or not.
+  let private getReals (b: byte array) (field: int) fs =
+    every field fs
+    |> List.collect (fun wire ->
+      match wire with
+      | Delimited(start, length) when length % 8 = 0 ->
+        [ for i in start .. 8 .. start + length - 1 ->
+            BinaryPrimitives.ReadDoubleLittleEndian(ReadOnlySpan(b, i, 8)) ]
+      | wire -> [ toReal wire ])
+
+  /// Entries of a map field, with a value read from its fields, which are
+  /// empty where the value is absent.
+  let private getEntries b field (read: (int * Wire) list -> 'T) fs =
+    every field fs
+    |> List.map (fun wire ->
+      let entry = within b wire
+      let value = last 2 entry |> Option.map (within b)
+      getText b 1 entry, read (defaultArg value []))
+    |> Map.ofList
+
+  /// Map of doubles, whose values are not messages.
+  let private getDoubles b field fs =
+    every field fs
+    |> List.map (fun wire ->
+      let entry = within b wire
+      getText b 1 entry, getReal 2 entry)
+    |> Map.ofList
+
+  /// Map of doubles wrapped in a message of its own, if present.
+  let private getWrapped b field fs =
+    last field fs |> Option.map (within b >> getDoubles b 1)
+
+  let private getInfo b fs : ModelInfo =
+    { Name = getText b 1 fs
+      Description = last 2 fs |> Option.map (toText b)
+      Units = getText b 3 fs
+      Version = getText b 4 fs
+      Dimensions = last 5 fs |> Option.map toInt }
+
+  let private getNode b fs : Node =
+    { Id = getText b 1 fs
+      X = getReal 2 fs
+      Y = getReal 3 fs
+      Z = getReal 4 fs }
+
+  let private getElement b fs : Element =
+    { Id = getText b 1 fs
+      Type = getText b 2 fs
+      Nodes = getTexts b 3 fs
+      Material = getText b 4 fs
+      Properties = getWrapped b 5 fs
+      Releases =
+        last 6 fs
+        |> Option.map (within b >> getEntries b 1 (getTexts b 1)) }
+
+  let private getMaterial b fs : Material =
+    { Id = getText b 1 fs
+      Name = getText b 2 fs
+      Type = getText b 3 fs
+      ElasticModulus = getReal 4 fs
+      Density = last 5 fs |> Option.map toReal
+      YieldStrength = last 6 fs |> Option.map toReal
+      ShearModulus = last 7 fs |> Option.map toReal
+      DampingRatio = last 8 fs |> Option.map toReal
+      ThermalExpansion = last 9 fs |> Option.map toReal }
+
+  let private getLoad b fs : Load =
+    { Id = getText b 1 fs
+      Type = getText b 2 fs
+      Node = last 3 fs |> Option.map (toText b)
+      Element = last 4 fs |> Option.map (toText b)
+      Direction = getText b 5 fs
+      Magnitude = getReal 6 fs
+      Position = last 7 fs |> Option.map toReal
+      End = last 8 fs |> Option.map toReal
+      EndMagnitude = last 9 fs |> Option.map toReal
+      Datum = last 10 fs |> Option.map toReal
+      Gradient = last 11 fs |> Option.map toReal
+      Case = last 12 fs |> Option.map (toText b) }
+
+  let private getCombination b fs : Combination =
+    { Id = getText b 1 fs
+      Factors = getDoubles b 2 fs }
+
+  let private getGravity b fs : Gravity =
+    { Magnitude = getReal 1 fs
+      Direction = getReals b 2 fs }
+
+  let private getDamping b fs : Damping =
+    { Ratio = last 1 fs |> Option.map toReal
+      Modes = getWrapped b 2 fs
+      Rayleigh =
+        last 3 fs
+        |> Option.map (fun wire ->
+          let fs = within b wire
+
+          ({ Mass = getReal 1 fs
+             Stiffness = getReal 2 fs }
+          : Rayleigh)) }
+
+  let private getTimeHistory b fs : TimeHistory =
+    let history fs : LoadHistory =
+      { Times = getReals b 1 fs
+        Factors = getReals b 2 fs }
+
+    { TimeStep = getReal 1 fs
+      Duration = getReal 2 fs
+      Cases = getEntries b 3 history fs }
+
+  let private getPanel b fs : Panel =
+    { Id = getText b 1 fs
+      Type = getText b 2 fs
+      Nodes = getTexts b 3 fs
+      Loads = getDoubles b 4 fs }
+
+  let private getPointMass b fs : PointMass =
+    { Id = getText b 1 fs
+      Node = getText b 2 fs
+      Mass = getReal 3 fs
+      Inertia = getWrapped b 4 fs }
+
+  let private getConstraint b fs : Constraint =
+    { Id = getText b 1 fs
+      Type = getText b 2 fs
+      Node = getText b 3 fs
+      Dof = getTexts b 4 fs
+      Angle = last 5 fs |> Option.map toReal
+      Stiffness = getWrapped b 6 fs
+      Displacement = getWrapped b 7 fs }
+
+  /// <summary>
+  /// Decodes a model from a Model message.
+  /// </summary>
+  /// <param name="bytes">Protocol Buffers encoding of a model.</param>
+  /// <returns>Model, or MalformedModel.</returns>
+  let readModel (bytes: byte array) : Result<Model, ModelError> =
+    let b = bytes
+
+    try
+      let fs = fields b 0 b.Length
+      let nested field read = last field fs |> Option.map (within b >> read b)
+
+      match last 1 fs with
+      | None -> Error(MalformedModel "binary model has no info")
+      | Some info ->
+        Ok
+          { Info = getInfo b (within b info)
+            Parameters = getWrapped b 2 fs
+            Gravity = nested 3 getGravity
+            Damping = nested 4 getDamping
+            TimeHistory = nested 5 getTimeHistory
+            Nodes = getEntries b 6 (getNode b) fs
+            Elements = getEntries b 7 (getElement b) fs
+            Materials = getEntries b 8 (getMaterial b) fs
+            Loads = getEntries b 9 (getLoad b) fs
+            Combinations = getEntries b 10 (getCombination b) fs
+            Constraints = getEntries b 11 (getConstraint b) fs
+            Masses = nested 12 (fun b -> getEntries b 1 (getPointMass b))
+            Panels = nested 13 (fun b -> getEntries b 1 (getPanel b)) }
+    with :? ProtobufException as ex ->
+      Error(MalformedModel $"binary model {ex.Message}")
+
+  let rec private writeJson (b: byte array) (w: Utf8JsonWriter) fs =
+    // Fields 1 to 6 are the kinds of value, one of which is set.
+    match fs |> List.tryFindBack (fun (f, _) -> f >= 1 && f <= 6) with
+    | None
+    | Some(1, _) -> w.WriteNullValue()
+    | Some(2, wire) ->
+      match toReal wire with
+      | x when Double.IsFinite x -> w.WriteNumberValue x
+      | x -> w.WriteStringValue(x.ToString(culture))
+    | Some(3, wire) -> w.WriteStringValue(toText b wire)
+    | Some(4, wire) -> w.WriteBooleanValue(toInt wire <> 0)
+    | Some(5, wire) ->
+      w.WriteStartObject()
+
+      for entry in every 1 (within b wire) do
+        let entry = within b entry
+        let value = last 2 entry |> Option.map (within b)
+        w.WritePropertyName(getText b 1 entry)
+        writeJson b w (defaultArg value [])
+
+      w.WriteEndObject()
+    | Some(_, wire) ->
+      w.WriteStartArray()
+
+      for item in every 1 (within b wire) do
+        writeJson b w (within b item)
+
+      w.WriteEndArray()
+
+  /// <summary>
+  /// Decodes a document tree, e.g. a result record, from a
+  /// google.protobuf.Value.
+  /// </summary>
+  /// <param name="bytes">Protocol Buffers encoding of a tree.</param>
+  /// <returns>The tree as the JSON it was written from, or the reason it
+  /// could not be read.</returns>
+  let readRecord (bytes: byte array) : Result<JsonNode, string> =
+    try
+      use json = new MemoryStream()
+
+      do
+        use w = new Utf8JsonWriter(json)
+        writeJson bytes w (fields bytes 0 bytes.Length)
+
+      Ok(JsonNode.Parse(ReadOnlySpan(json.GetBuffer(), 0, int json.Length)))
+    with :? ProtobufException as ex ->
+      Error ex.Message
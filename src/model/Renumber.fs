@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Text.RegularExpressions
+
+/// <summary>
+/// ID prefixes used when renumbering a model.
+/// </summary>
+type RenumberOptions =
+  { NodePrefix: string
+    ElementPrefix: string
+    LoadPrefix: string
+    ConstraintPrefix: string
+    Start: int }
+
+/// <summary>
+/// Renames nodes, elements, loads and constraints to sequential IDs, e.g.
+/// after merges, imports and deletions leave the ID space fragmented.
+/// </summary>
+/// <remarks>
+/// Entities are numbered in natural order of their current IDs, so "n2"
+/// precedes "n10". Material IDs are kept as they are usually meaningful
+/// names, as are panel IDs. References to entities that do not exist are
+/// left unchanged.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Renumber =
+
+  /// Default prefixes, matching the model schema's ID patterns, e.g. n1.
+  let defaultOptions =
+    { NodePrefix = "n"
+      ElementPrefix = "e"
+      LoadPrefix = "l"
+      ConstraintPrefix = "c"
+      Start = 1 }
+
+  /// Sort key ordering embedded numbers by value rather than by text.
+  let private naturalKey (id: string) =
+    Regex.Split(id, @"(\d+)")
+    |> Array.filter (fun part -> part <> "")
+    |> Array.map (fun part ->
+      match Int64.TryParse part with
+      | true, n -> 0, n, ""
+      | _ -> 1, 0L, part)
+    |> Array.toList
+
+  /// <summary>
+  /// Assigns sequential IDs to the keys of a collection.
+  /// </summary>
+  /// <param name="prefix">Prefix of the new IDs.</param>
+  /// <param name="start">First sequence number.</param>
+  /// <param name="entries">Collection keyed by current ID.</param>
+  /// <returns>New ID keyed by current ID.</returns>
+  let mapping
+    (prefix: string)
+    (start: int)
+    (entries: Map<string, 'T>)
+    : Map<string, string> =
+    entries
+    |> Map.toList
+    |> List.map fst
+    |> List.sortBy naturalKey
+    |> List.mapi (fun i id -> id, $"{prefix}{start + i}")
+    |> Map.ofList
+
+  /// <summary>
+  /// Renumbers a model and rewrites every reference to the renamed entities.
+  /// </summary>
+  /// <param name="options">ID prefixes and first sequence number.</param>
+  /// <param name="m">Model to renumber.</param>
+  /// <returns>Renumbered model.</returns>
+  let apply (options: RenumberOptions) (m: Model) : Model =
+    let rename (ids: Map<string, string>) (id: string) =
+      ids.TryFind id |> Option.defaultValue id
+
+    let nodes = mapping options.NodePrefix options.Start m.Nodes
+    let elements = mapping options.ElementPrefix options.Start m.Elements
+    let loads = mapping options.LoadPrefix options.Start m.Loads
+    let constraints =
+      mapping options.ConstraintPrefix options.Start m.Constraints
+
+    let rekey ids (entries: Map<string, 'T>) (update: string -> 'T -> 'T) =
+      entries
+      |> Map.toList
+      |> List.map (fun (id, entity) ->
+        let renamed = rename ids id
+        renamed, update renamed entity)
+      |> Map.ofList
+
+    { m with
+        Nodes = rekey nodes m.Nodes (fun id n -> { n with Id = id })
+        Elements =
+          rekey elements m.Elements (fun id e ->
+            { e with
+                Id = id
+                Nodes = List.map (rename nodes) e.Nodes
+                Releases =
+                  e.Releases
+                  |> Option.map (fun rs ->
+                    rs
+                    |> Map.toList
+                    |> List.map (fun (n, dofs) -> rename nodes n, dofs)
+                    |> Map.ofList) })
+        Loads =
+          rekey loads m.Loads (fun id l ->
+            { l with
+                Id = id
+                Node = Option.map (rename nodes) l.Node
+                Element = Option.map (rename elements) l.Element })
+        Constraints =
+          rekey constraints m.Constraints (fun id c ->
+            { c with
+                Id = id
+                Node = rename nodes c.Node })
+        Masses =
+          m.Masses
+          |> Option.map (
+            Map.map (fun _ x -> { x with Node = rename nodes x.Node })
+          )
+        Panels =
+          m.Panels
+          |> Option.map (
+            Map.map (fun _ p ->
+              { p with Nodes = List.map (rename nodes) p.Nodes })
+          ) }
@@ -0,0 +1,983 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Collections.Generic
+open System.Globalization
+open System.Text.Json.Nodes
+
+/// Defect in a STAAD input file.
+type private StaadException(line: int, reason: string) =
+  inherit Exception($"line {line}: {reason}")
+
+/// Command of a STAAD input file, in upper case, and the line it is on.
+type private Command = { Line: int; Words: string list }
+
+/// Block of a STAAD input file that data commands belong to.
+type private Block =
+  | Idle
+  | Information
+  | Joints
+  | Incidences
+  | Properties
+  | Kinds of kind: string
+  | Releases
+  | Supports
+  | Materials
+  | Constants
+  | JointLoads
+  | MemberLoads
+  | Combination of number: int
+  /// Block of an unsupported command, whose data is skipped.
+  | Skipped
+
+/// Material properties of a member, in SI units.
+type private Substance =
+  { Name: string option
+    Type: string option
+    Modulus: float option
+    Shear: float option
+    Poisson: float option
+    /// Weight per unit volume, as STAAD gives density.
+    Weight: float option
+    Expansion: float option
+    Damping: float option
+    Yield: float option }
+
+/// <summary>
+/// Reads STAAD.Pro input files (.std) as the same document tree as a JSON
+/// model.
+/// </summary>
+/// <remarks>
+/// JOINT COORDINATES become nodes n1, n2, ... and MEMBER INCIDENCES members
+/// m1, m2, ...: Frame2D for STAAD PLANE, Frame3D for STAAD SPACE, Truss2D
+/// or Truss3D for STAAD TRUSS or MEMBER TRUSS, Cable for MEMBER TENSION or
+/// CABLE and Strut for MEMBER COMPRESSION. MEMBER PROPERTY gives prismatic
+/// sections, from their properties or rectangular and circular depths;
+/// DEFINE MATERIAL and CONSTANTS give materials, with STAAD's STEEL,
+/// CONCRETE and ALUMINUM built in; MEMBER RELEASE gives bending releases;
+/// SUPPORTS gives pinned, fixed and partially fixed supports and springs.
+/// Each LOAD becomes a load case L1, L2, ... of JOINT LOAD forces and
+/// moments, MEMBER LOAD uniform, concentrated and linearly varying forces
+/// and a SELFWEIGHT, and each LOAD COMBINATION a combination. The model is
+/// in SI units, converted from those of each UNIT command. Commands that
+/// are not imported, such as section tables or other kinds of load, are
+/// reported by unsupported rather than stopping the import.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Staad =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  /// Metres per length unit and newtons per force unit of UNIT commands.
+  let private lengths =
+    Map
+      [ "INCH", 0.0254
+        "INCHES", 0.0254
+        "IN", 0.0254
+        "FEET", 0.3048
+        "FOOT", 0.3048
+        "FT", 0.3048
+        "CM", 0.01
+        "CMS", 0.01
+        "METER", 1.0
+        "METERS", 1.0
+        "METRE", 1.0
+        "METRES", 1.0
+        "MET", 1.0
+        "M", 1.0
+        "MMS", 0.001
+        "MM", 0.001
+        "DME", 0.1
+        "KM", 1000.0 ]
+
+  let private forces =
+    Map
+      [ "KIP", 4448.2216152605
+        "KIPS", 4448.2216152605
+        "POUND", 4.4482216152605
+        "POUNDS", 4.4482216152605
+        "LB", 4.4482216152605
+        "LBS", 4.4482216152605
+        "KG", 9.80665
+        "KGS", 9.80665
+        "MTON", 9806.65
+        "MTONS", 9806.65
+        "NEWTON", 1.0
+        "NEWTONS", 1.0
+        "N", 1.0
+        "DNS", 10.0
+        "KN", 1000.0
+        "KNS", 1000.0
+        "MN", 1e6
+        "MNS", 1e6 ]
+
+  let private empty =
+    { Name = None
+      Type = None
+      Modulus = None
+      Shear = None
+      Poisson = None
+      Weight = None
+      Expansion = None
+      Damping = None
+      Yield = None }
+
+  /// STAAD's built-in materials.
+  let private builtIn =
+    let material name kind e nu weight alpha damping =
+      name,
+      { empty with
+          Name = Some name
+          Type = Some kind
+          Modulus = Some e
+          Poisson = Some nu
+          Weight = Some weight
+          Expansion = Some alpha
+          Damping = Some damping }
+
+    Map
+      [ material "STEEL" "Steel" 199.948e9 0.3 76.8195e3 1.2e-5 0.03
+        material "CONCRETE" "Concrete" 21.7185e9 0.17 23.5616e3 1e-5 0.05
+        material "ALUMINUM" "Aluminium" 68.9476e9 0.33 26.6018e3 2.3e-5 0.03 ]
+
+  /// Freedom named by a STAAD direction, e.g. FX or MZ.
+  let private freedoms =
+    Map
+      [ "FX", "Ux"
+        "FY", "Uy"
+        "FZ", "Uz"
+        "MX", "Rx"
+        "MY", "Ry"
+        "MZ", "Rz" ]
+
+  /// Words STAAD lets be shortened to their first four letters.
+  let private key (word: string) =
+    if word.Length > 4 then word.Substring(0, 4) else word
+
+  /// Words joined back into a phrase, e.g. for notes.
+  let private phrase (words: string list) = String.concat " " words
+
+  let private isNumber (word: string) =
+    fst (Double.TryParse(word, NumberStyles.Float, culture))
+
+  let private number (line: int) (word: string) =
+    match Double.TryParse(word, NumberStyles.Float, culture) with
+    | true, x when Double.IsFinite x -> x
+    | _ -> raise (StaadException(line, $"'{word}' is not a number"))
+
+  let private integer (line: int) (word: string) =
+    match Int32.TryParse word with
+    | true, n -> n
+    | _ -> raise (StaadException(line, $"'{word}' is not a number"))
+
+  let private value (x: float) : JsonNode = JsonValue.Create x
+  let private text (x: string) : JsonNode = JsonValue.Create x
+
+  let private list (xs: JsonNode seq) : JsonNode = JsonArray(Array.ofSeq xs)
+
+  let private record (properties: (string * JsonNode) list) : JsonNode =
+    let o = JsonObject()
+
+    for name, x in properties do
+      o[name] <- x
+
+    o
+
+  /// Splits a file into commands, joining lines continued by a trailing
+  /// hyphen and splitting those separated by semicolons.
+  let private commands (text: string) : Command list =
+    let lines = ResizeArray<int * string>()
+    let mutable pending: (int * string) option = None
+
+    for i, line in Array.indexed (text.Split '\n') do
+      let line = line.Trim()
+
+      if line <> "" && not (line.StartsWith '*') then
+        let start, line =
+          match pending with
+          | Some(start, before) -> start, before + " " + line
+          | None -> i + 1, line
+
+        if line.EndsWith " -" || line = "-" then
+          pending <- Some(start, line.TrimEnd('-'))
+        else
+          pending <- None
+          lines.Add(start, line)
+
+    [ for line, content in lines do
+        for part in content.ToUpperInvariant().Split ';' do
+          let separators = [| ' '; '\t'; ',' |]
+          let options = StringSplitOptions.RemoveEmptyEntries
+
+          match List.ofArray (part.Split(separators, options)) with
+          | [] -> ()
+          | words -> { Line = line; Words = words } ]
+
+  /// Numbers of a list such as "1 TO 9 BY 2 12" or "ALL", and the words
+  /// after it.
+  let private numbers
+    (line: int)
+    (all: int seq)
+    (words: string list)
+    : int list * string list =
+    let rec go acc words =
+      match words with
+      | "ALL" :: rest -> go (List.rev (List.ofSeq all) @ acc) rest
+      | a :: "TO" :: b :: "BY" :: s :: rest ->
+        let a, b, s = integer line a, integer line b, integer line s
+        go (List.rev [ a..s..b ] @ acc) rest
+      | a :: "TO" :: b :: rest ->
+        go (List.rev [ integer line a .. integer line b ] @ acc) rest
+      | a :: rest when fst (Int32.TryParse a) -> go (int a :: acc) rest
+      | w :: rest when List.contains (key w) [ "MEMB"; "JOIN"; "LIST" ] ->
+        go acc rest
+      | rest -> List.rev acc, rest
+
+    go [] words
+
+  /// Model as a document tree, and what was not imported.
+  let private translate (source: string) : JsonNode * string list =
+    let notes = ResizeArray<string>()
+
+    let note (c: Command) (what: string) =
+      notes.Add $"line {c.Line}: {what} is not imported"
+
+    let mutable kind = "SPACE"
+    let mutable title = None
+    let mutable length, force = 0.3048, 4448.2216152605
+    let mutable block = Idle
+    let mutable case: string option = None
+    let mutable gravity: float[] option = None
+
+    let joints = SortedDictionary<int, float[]>()
+    let members = SortedDictionary<int, int * int>()
+    let kinds = Dictionary<int, string>()
+    let sections = Dictionary<int, Map<string, float>>()
+    let ends = Dictionary<int * int, Set<string>>()
+    let supports = SortedDictionary<int, string list * (string * float) list>()
+    let defined = Dictionary<string, Substance>()
+    let assigned = Dictionary<int, Substance>()
+    let mutable current: string option = None
+    let loads = JsonObject()
+    let counts = Dictionary<string, int>()
+    let combinations = JsonObject()
+
+    let node (n: int) = $"n{n}"
+    let element (n: int) = $"m{n}"
+
+    let substance (name: string) =
+      match defined.TryGetValue name with
+      | true, s -> Some s
+      | _ -> builtIn.TryFind name
+
+    let assign (ids: int list) (f: Substance -> Substance) =
+      for id in ids do
+        let before =
+          match assigned.TryGetValue id with
+          | true, s -> s
+          | _ -> empty
+
+        assigned[id] <- f before
+
+    let caseOf (c: Command) =
+      match case with
+      | Some name -> name
+      | None -> raise (StaadException(c.Line, "loads precede any LOAD"))
+
+    let addLoad (c: Command) (fields: (string * JsonNode) list) =
+      let name = caseOf c
+
+      let k =
+        match counts.TryGetValue name with
+        | true, k -> k + 1
+        | _ -> 1
+
+      counts[name] <- k
+      let id = $"{name}-{k}"
+
+      loads[id] <-
+        record ([ "id", text id ] @ fields @ [ "case", text name ])
+
+    // Chord of a member in SI units.
+    let chord (c: Command) (id: int) =
+      match members.TryGetValue id with
+      | true, (i, j) when joints.ContainsKey i && joints.ContainsKey j ->
+        Array.map2 (-) joints[j] joints[i]
+      | _ -> raise (StaadException(c.Line, $"member {id} is not defined"))
+
+    let rec joint (c: Command) =
+      match c.Words with
+      | [ id; x; y ] -> joint { c with Words = [ id; x; y; "0" ] }
+      | [ id; x; y; z ] ->
+        joints[integer c.Line id] <-
+          [| x; y; z |] |> Array.map (fun w -> number c.Line w * length)
+      | _ -> note c "generation of joints"
+
+    let incidence (c: Command) =
+      match c.Words with
+      | [ id; i; j ] ->
+        members[integer c.Line id] <- (integer c.Line i, integer c.Line j)
+      | _ -> note c "generation of members"
+
+    let property (c: Command) =
+      match numbers c.Line members.Keys c.Words with
+      | ids, w :: values when key w = "PRIS" ->
+        let rec pairs acc words =
+          match words with
+          | name :: x :: rest when isNumber x ->
+            pairs (Map.add name (number c.Line x) acc) rest
+          | [] -> acc
+          | w :: _ ->
+            note c $"prismatic property {w}"
+            acc
+
+        let given = pairs Map.empty values
+
+        let at name power =
+          given.TryFind name |> Option.map (fun x -> x * length ** power)
+
+        // Rectangles of depth YD and width ZD, or circles of diameter YD.
+        let shape =
+          match at "YD" 1.0, at "ZD" 1.0 with
+          | Some d, Some b ->
+            let a, t = max d b, min d b
+            let taper = 1.0 - t ** 4.0 / (12.0 * a ** 4.0)
+            let j = a * t ** 3.0 * (1.0 / 3.0 - 0.21 * t / a * taper)
+
+            Map
+              [ "AX", d * b
+                "IZ", b * d ** 3.0 / 12.0
+                "IY", d * b ** 3.0 / 12.0
+                "IX", j ]
+          | Some d, None ->
+            let i = Math.PI * d ** 4.0 / 64.0
+
+            Map
+              [ "AX", Math.PI * d * d / 4.0
+                "IZ", i
+                "IY", i
+                "IX", 2.0 * i ]
+          | _ -> Map.empty
+
+        let explicit =
+          [ "AX", 2.0; "IX", 4.0; "IY", 4.0; "IZ", 4.0 ]
+          |> List.choose (fun (name, power) ->
+            at name power |> Option.map (fun x -> name, x))
+
+        let section = List.fold (fun s (k, x) -> Map.add k x s) shape explicit
+
+        for id in ids do
+          sections[id] <- section
+      | _, w :: _ -> note c $"{w} section properties"
+      | _ -> raise (StaadException(c.Line, "gives no section"))
+
+    let release (c: Command) =
+      let ids, rest = numbers c.Line members.Keys c.Words
+
+      let rec go side words =
+        match words with
+        | w :: rest when key w = "STAR" -> go (Some 0) rest
+        | "END" :: rest -> go (Some 1) rest
+        | ("MY" | "MZ") as dof :: rest when side.IsSome ->
+          for id in ids do
+            let k = id, side.Value
+
+            let before =
+              match ends.TryGetValue k with
+              | true, s -> s
+              | _ -> Set.empty
+
+            ends[k] <- before.Add freedoms[dof]
+
+          go side rest
+        | x :: rest when isNumber x -> go side rest
+        | w :: rest ->
+          note c $"release {w}"
+          go side rest
+        | [] -> ()
+
+      go None rest
+
+    let support (c: Command) =
+      let ids, rest = numbers c.Line joints.Keys c.Words
+
+      let condition =
+        match List.map key rest with
+        | [ "PINN" ] -> Some([ "MX"; "MY"; "MZ" ], [])
+        | [ "FIXE" ] -> Some([], [])
+        | "FIXE" :: "BUT" :: _ ->
+          let spring (w: string) =
+            w.StartsWith "K" && freedoms.ContainsKey(w.Substring 1)
+
+          // Released freedoms, and springs in SI units.
+          let rec go free springs words =
+            match words with
+            | w :: rest when freedoms.ContainsKey w ->
+              go (w :: free) springs rest
+            | w :: x :: rest when spring w ->
+              let scale =
+                if w[1] = 'F' then force / length else force * length
+
+              let k = w.Substring 1, number c.Line x * scale
+              go free (k :: springs) rest
+            | w :: rest ->
+              note c $"support condition {w}"
+              go free springs rest
+            | [] -> Some(List.rev free, List.rev springs)
+
+          go [] [] (List.skip 2 rest)
+        | _ -> None
+
+      match condition with
+      | Some(free, springs) ->
+        for id in ids do
+          supports[id] <- (free, springs)
+      | None -> note c $"{phrase rest} support"
+
+    let material (c: Command) =
+      let set f =
+        match current with
+        | Some name -> defined[name] <- f defined[name]
+        | None -> raise (StaadException(c.Line, "property precedes ISOTROPIC"))
+
+      match c.Words with
+      | w :: name :: _ when key w = "ISOT" ->
+        current <- Some name
+        defined[name] <- { empty with Name = Some name }
+      | w :: x :: _ when isNumber x ->
+        let x = number c.Line x
+
+        let stress = x * force / length ** 2.0
+
+        match key w with
+        | "E" -> set (fun s -> { s with Modulus = Some stress })
+        | "G" -> set (fun s -> { s with Shear = Some stress })
+        | "POIS" -> set (fun s -> { s with Poisson = Some x })
+        | "DENS" ->
+          let weight = x * force / length ** 3.0
+          set (fun s -> { s with Weight = Some weight })
+        | "ALPH" -> set (fun s -> { s with Expansion = Some x })
+        | "DAMP" -> set (fun s -> { s with Damping = Some x })
+        | _ -> note c $"material property {w}"
+      | [ "TYPE"; t ] ->
+        let t = t.Substring(0, 1) + t.Substring(1).ToLowerInvariant()
+        set (fun s -> { s with Type = Some t })
+      | w :: "FY" :: x :: _ when key w = "STRE" ->
+        let x = number c.Line x * force / length ** 2.0
+        set (fun s -> { s with Yield = Some x })
+      | w :: _ -> note c $"material property {w}"
+      | [] -> ()
+
+    let constant (c: Command) =
+      match c.Words with
+      | w :: given :: rest ->
+        let ids, after = numbers c.Line members.Keys rest
+
+        if not after.IsEmpty then
+          note c $"CONSTANTS {phrase after}"
+
+        // A number in current units, or the property of a material.
+        let pick (scale: float) (f: Substance -> float option) =
+          if isNumber given then
+            Some(number c.Line given * scale)
+          else
+            match substance given with
+            | Some s -> f s
+            | None -> raise (StaadException(c.Line, $"{given} is no material"))
+
+        let stress = force / length ** 2.0
+
+        match key w with
+        | "MATE" ->
+          match substance given with
+          | Some s -> assign ids (fun _ -> s)
+          | None -> raise (StaadException(c.Line, $"{given} is no material"))
+        | "E" ->
+          let x = pick stress (fun s -> s.Modulus)
+          assign ids (fun s -> { s with Modulus = x })
+        | "G" ->
+          let x = pick stress (fun s -> s.Shear)
+          assign ids (fun s -> { s with Shear = x })
+        | "POIS" ->
+          let x = pick 1.0 (fun s -> s.Poisson)
+          assign ids (fun s -> { s with Poisson = x })
+        | "DENS" ->
+          let x = pick (force / length ** 3.0) (fun s -> s.Weight)
+          assign ids (fun s -> { s with Weight = x })
+        | "ALPH" ->
+          let x = pick 1.0 (fun s -> s.Expansion)
+          assign ids (fun s -> { s with Expansion = x })
+        | "DAMP" ->
+          let x = pick 1.0 (fun s -> s.Damping)
+          assign ids (fun s -> { s with Damping = x })
+        | "BETA" when isNumber given && number c.Line given = 0.0 -> ()
+        | _ -> note c $"CONSTANTS {w}"
+      | _ -> note c "CONSTANTS"
+
+    let jointLoad (c: Command) =
+      let ids, rest = numbers c.Line joints.Keys c.Words
+
+      let rec go words =
+        match words with
+        | d :: x :: rest when freedoms.ContainsKey d ->
+          let x = number c.Line x
+          let moment = d.StartsWith "M"
+          let scale = if moment then force * length else force
+          let direction = d.Substring(0, 1) + d.Substring(1).ToLower()
+
+          if x <> 0.0 then
+            for id in ids do
+              addLoad
+                c
+                [ "type", text (if moment then "Moment" else "Force")
+                  "node", text (node id)
+                  "direction", text direction
+                  "magnitude", value (x * scale) ]
+
+          go rest
+        | w :: rest ->
+          note c $"joint load {w}"
+          go rest
+        | [] -> ()
+
+      go rest
+
+    let memberLoad (c: Command) =
+      let ids, rest = numbers c.Line members.Keys c.Words
+
+      match rest with
+      | form :: direction :: values when List.forall isNumber values ->
+        let values = List.map (number c.Line) values
+        let perLength = force / length
+        let fraction span (d: float) = max 0.0 (min 1.0 (d * length / span))
+
+        // Load type, intensity in SI units and further fields, by span.
+        let shape =
+          match key form, values with
+          | "UNI", w :: d when d.Length <= 2 || d.Length = 3 && d[2] = 0.0 ->
+            Some(fun span ->
+              "Distributed",
+              w * perLength,
+              [ match d with
+                | d1 :: _ -> "position", fraction span d1
+                | [] -> ()
+                match d with
+                | _ :: d2 :: _ -> "end", fraction span d2
+                | _ -> () ])
+          | "CON", w :: d when d.Length <= 1 || d.Length = 2 && d[1] = 0.0 ->
+            Some(fun span ->
+              let at = List.tryHead d |> Option.map (fraction span)
+              "Force", w * force, [ "position", defaultArg at 0.5 ])
+          | "TRAP", [ w1; w2 ]
+          | "LIN", [ w1; w2 ] ->
+            Some(fun _ ->
+              "Distributed",
+              w1 * perLength,
+              [ "end_magnitude", w2 * perLength ])
+          | "TRAP", [ w1; w2; d1; d2 ] ->
+            Some(fun span ->
+              "Distributed",
+              w1 * perLength,
+              [ "end_magnitude", w2 * perLength
+                "position", fraction span d1
+                "end", fraction span d2 ])
+          | _ -> None
+
+        // Global shares of the load, given the chord and span of a member.
+        let along =
+          match direction with
+          | "GX" -> Some(fun _ _ -> [| 1.0; 0.0; 0.0 |])
+          | "GY" -> Some(fun _ _ -> [| 0.0; 1.0; 0.0 |])
+          | "GZ" -> Some(fun _ _ -> [| 0.0; 0.0; 1.0 |])
+          | "X" when kind = "PLANE" ->
+            Some(fun (x: float[]) span -> Array.map (fun v -> v / span) x)
+          | "Y" when kind = "PLANE" ->
+            Some(fun (x: float[]) span -> [| -x[1] / span; x[0] / span; 0.0 |])
+          | _ -> None
+
+        match shape, along with
+        | Some shape, Some along ->
+          for id in ids do
+            let x = chord c id
+            let span = sqrt (Array.sumBy (fun v -> v * v) x)
+            let type', w, fields = shape span
+
+            for d, share in Array.zip [| "Fx"; "Fy"; "Fz" |] (along x span) do
+              if share <> 0.0 then
+                addLoad
+                  c
+                  ([ "type", text type'
+                     "element", text (element id)
+                     "direction", text d
+                     "magnitude", value (w * share) ]
+                   @ [ for name, v in fields ->
+                         if name = "end_magnitude" then
+                           name, value (v * share)
+                         else
+                           name, value v ])
+        | _ -> note c $"MEMBER LOAD {form} {direction}"
+      | _ -> note c $"MEMBER LOAD {phrase rest}"
+
+    let selfWeight (c: Command) =
+      match c.Words with
+      | [ _; axis; factor ] when List.contains axis [ "X"; "Y"; "Z" ] ->
+        let f = number c.Line factor
+        let unit =
+          [| "X"; "Y"; "Z" |]
+          |> Array.map (fun a -> if a = axis then float (sign f) else 0.0)
+
+        match gravity with
+        | Some g when g <> unit -> note c $"SELFWEIGHT along another axis"
+        | _ ->
+          gravity <- Some unit
+
+          addLoad
+            c
+            [ "type", text "SelfWeight"
+              "direction", text "Gravity"
+              "magnitude", value (abs f) ]
+      | _ -> note c (phrase c.Words)
+
+    let combination (c: Command) (number': int) =
+      let id = $"L{number'}"
+
+      let factors =
+        match combinations[id] with
+        | null -> JsonObject()
+        | x -> x["factors"].AsObject()
+
+      let rec go words =
+        match words with
+        | n :: f :: rest ->
+          factors[$"L{integer c.Line n}"] <- value (number c.Line f)
+          go rest
+        | [ w ] -> raise (StaadException(c.Line, $"'{w}' has no factor"))
+        | [] -> ()
+
+      go c.Words
+
+      if combinations[id] = null then
+        combinations[id] <- record [ "id", text id; "factors", factors ]
+
+    let data (c: Command) =
+      match block with
+      | Joints -> joint c
+      | Incidences -> incidence c
+      | Properties -> property c
+      | Kinds k ->
+        let ids, rest = numbers c.Line members.Keys c.Words
+
+        for id in ids do
+          kinds[id] <- k
+
+        if not rest.IsEmpty then
+          note c $"{phrase rest} of {k.ToLowerInvariant()} members"
+      | Releases -> release c
+      | Supports -> support c
+      | Materials -> material c
+      | Constants -> constant c
+      | JointLoads -> jointLoad c
+      | MemberLoads -> memberLoad c
+      | Combination n -> combination c n
+      | Information
+      | Skipped -> ()
+      | Idle -> note c (phrase c.Words)
+
+    let constants =
+      set [ "E"; "G"; "POIS"; "DENS"; "ALPH"; "BETA"; "MATE"; "DAMP"; "CDAM" ]
+
+    for c in commands source do
+      let isData =
+        match block, c.Words with
+        | Information, w :: _
+        | Materials, w :: _ -> w <> "END"
+        | Constants, w :: _ -> constants.Contains(key w)
+        | _, w :: _ ->
+          Char.IsDigit w[0] || w[0] = '-' || w[0] = '.' || w = "ALL"
+        | _, [] -> false
+
+      if isData then
+        data c
+      else
+        match List.map key c.Words, c.Words with
+        | "STAA" :: k :: _, _ :: _ :: rest ->
+          kind <-
+            match key k with
+            | "PLAN" -> "PLANE"
+            | "TRUS" -> "TRUSS"
+            | "SPAC" -> "SPACE"
+            | other ->
+              note c $"STAAD {k}"
+              "SPACE"
+
+          if not rest.IsEmpty then
+            title <- Some(phrase rest)
+        | "UNIT" :: _, _ :: units ->
+          for u in units do
+            match lengths.TryFind u, forces.TryFind u with
+            | Some l, _ -> length <- l
+            | _, Some f -> force <- f
+            | _ -> note c $"unit {u}"
+        | "STAR" :: "JOB" :: _, _ -> block <- Information
+        | "END" :: "JOB" :: _, _
+        | "END" :: "DEFI" :: _, _ -> block <- Idle
+        | "JOIN" :: "COOR" :: _, _ -> block <- Joints
+        | "JOIN" :: "LOAD" :: _, _ -> block <- JointLoads
+        | "MEMB" :: "INCI" :: _, _ -> block <- Incidences
+        | "MEMB" :: "PROP" :: _, _ -> block <- Properties
+        | "MEMB" :: "RELE" :: _, _ -> block <- Releases
+        | "MEMB" :: "LOAD" :: _, _ -> block <- MemberLoads
+        | "MEMB" :: k :: _, _ :: _ :: rest when
+          List.contains k [ "TRUS"; "TENS"; "COMP"; "CABL" ]
+          ->
+          block <-
+            Kinds(
+              match k with
+              | "TRUS" -> "Truss"
+              | "COMP" -> "Strut"
+              | _ -> "Cable"
+            )
+
+          if not rest.IsEmpty then
+            data { c with Words = rest }
+        | "SUPP" :: _, _ -> block <- Supports
+        | "DEFI" :: "MATE" :: _, _ -> block <- Materials
+        | "CONS" :: _, _ -> block <- Constants
+        | "LOAD" :: "COMB" :: n :: _, _ when fst (Int32.TryParse n) ->
+          block <- Combination(int n)
+        | "LOAD" :: "LIST" :: _, _ -> ()
+        | "LOAD" :: n :: _, _ when fst (Int32.TryParse n) ->
+          case <- Some $"L{n}"
+          block <- Idle
+        | "SELF" :: _, _ -> selfWeight c
+        | ("INPU" | "PAGE" | "PRIN" | "PERF" | "FINI" | "SET") :: _, _ -> ()
+        | _ when block = Skipped -> ()
+        | _ ->
+          note c (phrase (List.truncate 2 c.Words))
+          block <- Skipped
+
+    let plane =
+      kind = "PLANE"
+      || kind = "TRUSS" && joints.Values |> Seq.forall (fun p -> p[2] = 0.0)
+
+    let dimensions = if plane then 2 else 3
+
+    let nodes =
+      record
+        [ for KeyValue(id, p) in joints ->
+            node id,
+            record
+              [ "id", text (node id)
+                "x", value p[0]
+                "y", value p[1]
+                "z", value p[2] ] ]
+
+    // One material per distinct set of properties, named after the first
+    // material it came from.
+    let variants =
+      members.Keys
+      |> Seq.choose (fun id ->
+        match assigned.TryGetValue id with
+        | true, s -> Some(id, s)
+        | _ -> None)
+      |> Seq.groupBy snd
+      |> Seq.mapi (fun i (s, ids) -> s, ids |> Seq.map fst |> List.ofSeq, i)
+      |> List.ofSeq
+
+    let materialIds = Dictionary<int, string>()
+    let materials = JsonObject()
+
+    for s, ids, i in variants do
+      let base' = defaultArg s.Name "MATERIAL"
+
+      let id =
+        if materials.ContainsKey base' then $"{base'}-{i + 1}" else base'
+
+      for m in ids do
+        materialIds[m] <- id
+
+      let optional =
+        [ "shear_modulus",
+          match s.Shear, s.Modulus, s.Poisson with
+          | Some g, _, _ -> Some g
+          | None, Some e, Some nu -> Some(e / (2.0 + 2.0 * nu))
+          | _ -> None
+          "density", s.Weight |> Option.map (fun w -> w / 9.80665)
+          "thermal_expansion", s.Expansion
+          "damping_ratio", s.Damping
+          "yield_strength", s.Yield ]
+
+      materials[id] <-
+        record (
+          [ "id", text id
+            "name", text (defaultArg s.Name id)
+            "type", text (defaultArg s.Type "Generic")
+            "elastic_modulus", value (defaultArg s.Modulus 0.0) ]
+          @ [ for field, x in optional do
+                match x with
+                | Some x -> field, value x
+                | None -> () ]
+        )
+
+    let elements =
+      record
+        [ for KeyValue(id, (i, j)) in members ->
+            let kind =
+              match kinds.TryGetValue id, kind with
+              | (true, "Truss"), _
+              | _, "TRUSS" -> if plane then "Truss2D" else "Truss3D"
+              | (true, other), _ -> other
+              | _, "PLANE" -> "Frame2D"
+              | _ -> "Frame3D"
+
+            let section =
+              match sections.TryGetValue id with
+              | true, s -> s
+              | _ -> Map.empty
+
+            let properties =
+              match kind with
+              | "Frame2D" -> [ "area", "AX"; "i", "IZ" ]
+              | "Frame3D" -> [ "area", "AX"; "iy", "IY"; "iz", "IZ"; "j", "IX" ]
+              | _ -> [ "area", "AX" ]
+              |> List.choose (fun (name, staad) ->
+                section.TryFind staad |> Option.map (fun x -> name, value x))
+
+            let released =
+              [ for side, n in [ 0, i; 1, j ] do
+                  match ends.TryGetValue((id, side)) with
+                  | true, dofs when kind.StartsWith "Frame" ->
+                    let dofs =
+                      if plane then Set.intersect dofs (set [ "Rz" ]) else dofs
+
+                    if not dofs.IsEmpty then
+                      node n, list [ for d in dofs -> text d ]
+                  | _ -> () ]
+
+            element id,
+            record
+              [ "id", text (element id)
+                "type", text kind
+                "nodes", list [ text (node i); text (node j) ]
+                "material",
+                text (
+                  match materialIds.TryGetValue id with
+                  | true, m -> m
+                  | _ -> ""
+                )
+                if not properties.IsEmpty then
+                  "properties", record properties
+                if not released.IsEmpty then
+                  "releases", record released ] ]
+
+    let available =
+      match kind with
+      | "PLANE" -> [ "FX"; "FY"; "MZ" ]
+      | "TRUSS" when plane -> [ "FX"; "FY" ]
+      | "TRUSS" -> [ "FX"; "FY"; "FZ" ]
+      | _ -> [ "FX"; "FY"; "FZ"; "MX"; "MY"; "MZ" ]
+
+    let constraints =
+      record
+        [ for KeyValue(id, (free, springs)) in supports ->
+            let springs =
+              springs |> List.filter (fun (d, _) -> List.contains d available)
+
+            let held =
+              available
+              |> List.filter (fun d ->
+                not (List.contains d free || List.exists (fst >> (=) d) springs)
+              )
+
+            let translations =
+              available |> List.filter (fun d -> d.StartsWith "F")
+
+            let type' =
+              match held, springs with
+              | _, [] when held = available -> "Fixed"
+              | _, [] when held = translations -> "Pinned"
+              | _, [] -> "Partial"
+              | _ -> "Elastic"
+
+            let name = $"s{id}"
+
+            name,
+            record
+              [ "id", text name
+                "type", text type'
+                "node", text (node id)
+                "dof", list [ for d in held -> text freedoms[d] ]
+                if not springs.IsEmpty then
+                  "stiffness",
+                  record [ for d, k in springs -> freedoms[d], value k ] ] ]
+
+    for KeyValue(id, _) in members do
+      if not (materialIds.ContainsKey id) then
+        notes.Add $"member {id} has no material"
+
+    // Cases whose loads were not imported cannot be combined.
+    let loaded =
+      set [ for KeyValue(_, l) in loads -> l["case"].GetValue<string>() ]
+
+    for KeyValue(id, combination) in List.ofSeq combinations do
+      let factors = combination["factors"].AsObject()
+
+      for KeyValue(case, _) in List.ofSeq factors do
+        if not (loaded.Contains case) then
+          factors.Remove case |> ignore
+          notes.Add $"combination {id} omits {case}, which has no loads"
+
+      if factors.Count = 0 then
+        combinations.Remove id |> ignore
+
+    let document =
+      record
+        [ "info",
+          record
+            [ "name", text (defaultArg title "STAAD model")
+              "units", text "SI"
+              "version", text "1.0"
+              "dimensions", JsonValue.Create dimensions ]
+          match gravity with
+          | Some g ->
+            "gravity",
+            record
+              [ "magnitude", value 9.80665
+                "direction", list [ for x in g -> value x ] ]
+          | None -> ()
+          "nodes", nodes
+          "elements", elements
+          "materials", materials
+          "constraints", constraints
+          "loads", loads
+          "combinations", combinations ]
+
+    document, List.ofSeq notes
+
+  /// <summary>
+  /// Parses a STAAD input file into a document tree.
+  /// </summary>
+  /// <param name="text">STAAD input file.</param>
+  /// <returns>Document tree, or MalformedModel naming the defect.</returns>
+  let internal parseNode (text: string) : Result<JsonNode, ModelError> =
+    try
+      Ok(fst (translate text))
+    with :? StaadException as ex ->
+      Error(MalformedModel ex.Message)
+
+  /// <summary>
+  /// Lists the commands of a STAAD input file that are not imported, such
+  /// as section tables, plate elements or other kinds of load.
+  /// </summary>
+  /// <param name="text">STAAD input file.</param>
+  /// <returns>One note per command, naming its line, or MalformedModel
+  /// naming the defect.</returns>
+  let unsupported (text: string) : Result<string list, ModelError> =
+    try
+      Ok(snd (translate text))
+    with :? StaadException as ex ->
+      Error(MalformedModel ex.Message)
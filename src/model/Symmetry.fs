@@ -0,0 +1,426 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Globalization
+
+/// <summary>
+/// Plane of structural symmetry, named by the axes it contains and placed
+/// at a coordinate along its normal, e.g. YZ at x = 0.
+/// </summary>
+type SymmetryPlane =
+  | YZ of x: float
+  | XZ of y: float
+  | XY of z: float
+
+/// <summary>
+/// Errors raised when cutting a model on a symmetry plane.
+/// </summary>
+type SymmetryError =
+  | InvalidPlane of name: string
+  | CrossingElement of element: string
+  | PlateOnPlane of element: string
+
+[<RequireQualifiedAccess>]
+module SymmetryPlane =
+
+  let getAsString (p: SymmetryPlane) : string =
+    let culture = CultureInfo.InvariantCulture
+
+    match p with
+    | YZ 0.0 -> "YZ"
+    | XZ 0.0 -> "XZ"
+    | XY 0.0 -> "XY"
+    | YZ x -> $"YZ:{x.ToString culture}"
+    | XZ y -> $"XZ:{y.ToString culture}"
+    | XY z -> $"XY:{z.ToString culture}"
+
+  /// <summary>
+  /// Parses a plane, e.g. "YZ" through the origin or "XZ:2.5" at y = 2.5.
+  /// </summary>
+  /// <param name="name">Plane name and optional coordinate.</param>
+  /// <returns>Matching plane or InvalidPlane error.</returns>
+  let tryParse (name: string) : Result<SymmetryPlane, SymmetryError> =
+    let styles = NumberStyles.Float
+    let culture = CultureInfo.InvariantCulture
+
+    let axes, at =
+      match name.Trim().ToUpperInvariant().Split(':') with
+      | [| axes |] -> axes, Some 0.0
+      | [| axes; text |] ->
+        match Double.TryParse(text, styles, culture) with
+        | true, x -> axes, Some x
+        | _ -> axes, None
+      | _ -> "", None
+
+    match axes, at with
+    | ("YZ" | "ZY"), Some x -> Ok(YZ x)
+    | ("XZ" | "ZX"), Some y -> Ok(XZ y)
+    | ("XY" | "YX"), Some z -> Ok(XY z)
+    | _ -> Error(InvalidPlane name)
+
+[<RequireQualifiedAccess>]
+module SymmetryError =
+
+  let getAsString (e: SymmetryError) : string =
+    match e with
+    | InvalidPlane name ->
+      $"Invalid symmetry plane '{name}'; expected YZ, XZ or XY, e.g. YZ:0."
+    | CrossingElement element ->
+      $"Element '{element}' crosses the symmetry plane; add a node on it."
+    | PlateOnPlane element ->
+      $"Plate '{element}' lies on the symmetry plane and cannot be halved."
+
+/// <summary>
+/// Reduces symmetric structures to the part on one side of their planes of
+/// symmetry, so a half or quarter model is analysed in place of the whole.
+/// </summary>
+/// <remarks>
+/// The part on the positive side of the plane is kept. Nodes on the plane
+/// are restrained against translation normal to it and rotation about the
+/// axes within it. Members lying on the plane keep half their section
+/// properties and nodal loads on the plane are halved, as each is shared
+/// with the mirrored half. Results for the removed part follow by
+/// mirroring, reversing the components that <c>sign</c> marks, as
+/// mirrorNodes, mirrorReactions and mirrorMembers do.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Symmetry =
+
+  /// Section properties that member stiffness and weight scale with.
+  let private sectionProperties =
+    set
+      [ "a"; "area"; "ay"; "az"; "i"; "iy"; "iz"; "ix"; "j"
+        "sy"; "sz"; "zy"; "zz" ]
+
+  let private distance (p: SymmetryPlane) (n: Node) =
+    match p with
+    | YZ x -> n.X - x
+    | XZ y -> n.Y - y
+    | XY z -> n.Z - z
+
+  /// <summary>
+  /// Returns the degrees of freedom restrained on a symmetry plane.
+  /// </summary>
+  /// <param name="p">Symmetry plane.</param>
+  /// <returns>Normal translation and in-plane rotations.</returns>
+  let restrained (p: SymmetryPlane) : Dof list =
+    match p with
+    | YZ _ -> [ Ux; Ry; Rz ]
+    | XZ _ -> [ Uy; Rx; Rz ]
+    | XY _ -> [ Uz; Rx; Ry ]
+
+  /// <summary>
+  /// Returns the factor mapping a result component to its mirror image.
+  /// </summary>
+  /// <param name="p">Symmetry plane.</param>
+  /// <param name="dof">Component of displacement or force.</param>
+  /// <returns>-1 for components reversed by the mirror, else 1.</returns>
+  let sign (p: SymmetryPlane) (dof: Dof) : float =
+    if List.contains dof (restrained p) then -1.0 else 1.0
+
+  /// <summary>
+  /// Reflects a node in a symmetry plane.
+  /// </summary>
+  /// <param name="p">Symmetry plane.</param>
+  /// <param name="n">Node.</param>
+  /// <returns>Node at the mirrored position.</returns>
+  let mirror (p: SymmetryPlane) (n: Node) : Node =
+    let d = 2.0 * distance p n
+
+    match p with
+    | YZ _ -> { n with X = n.X - d }
+    | XZ _ -> { n with Y = n.Y - d }
+    | XY _ -> { n with Z = n.Z - d }
+
+  /// Distance within which a node is taken to lie on the plane.
+  let private toleranceOf (p: SymmetryPlane) (m: Model) =
+    let extent =
+      m.Nodes
+      |> Map.fold (fun e _ n -> max e (abs (distance p n))) 1.0
+
+    1e-9 * extent
+
+  /// Kept node at the reflection of each node on the removed side.
+  let private images (p: SymmetryPlane) (m: Model) =
+    let tolerance = toleranceOf p m
+
+    let kept =
+      m.Nodes
+      |> Map.toList
+      |> List.map snd
+      |> List.filter (fun n -> distance p n >= -tolerance)
+
+    let coincide (a: Node) (b: Node) =
+      abs (a.X - b.X) <= tolerance
+      && abs (a.Y - b.Y) <= tolerance
+      && abs (a.Z - b.Z) <= tolerance
+
+    m.Nodes
+    |> Map.toList
+    |> List.filter (fun (_, n) -> distance p n < -tolerance)
+    |> List.choose (fun (id, n) ->
+      kept
+      |> List.tryFind (coincide (mirror p n))
+      |> Option.map (fun k -> id, k.Id))
+    |> Map.ofList
+
+  /// <summary>
+  /// Extends nodal values of a model cut on a symmetry plane, e.g. its
+  /// displacements, to the whole: each removed node takes the values of
+  /// the node at its reflection, reversing the components sign marks.
+  /// </summary>
+  /// <param name="p">Symmetry plane.</param>
+  /// <param name="whole">Model before the cut.</param>
+  /// <param name="values">Values of each node of the part, by node.</param>
+  /// <returns>Values of each node of the whole.</returns>
+  let mirrorNodes
+    (p: SymmetryPlane)
+    (whole: Model)
+    (values: Map<string, Map<Dof, float>>)
+    : Map<string, Map<Dof, float>> =
+    images p whole
+    |> Map.fold
+      (fun acc id image ->
+        match values.TryFind image with
+        | Some dofs ->
+          acc |> Map.add id (dofs |> Map.map (fun dof x -> sign p dof * x))
+        | None -> acc)
+      values
+
+  /// <summary>
+  /// Extends the reactions of a model cut on a symmetry plane to the
+  /// whole. Supports on the plane are shared by both halves, so they carry
+  /// twice the components the mirror keeps and none of those it reverses;
+  /// the latter are reported only where the whole model restrains them.
+  /// </summary>
+  /// <param name="p">Symmetry plane.</param>
+  /// <param name="whole">Model before the cut.</param>
+  /// <param name="values">Reactions of the part, by node.</param>
+  /// <returns>Reactions of the whole, by node.</returns>
+  let mirrorReactions
+    (p: SymmetryPlane)
+    (whole: Model)
+    (values: Map<string, Map<Dof, float>>)
+    : Map<string, Map<Dof, float>> =
+    let tolerance = toleranceOf p whole
+
+    let supported node (dof: Dof) =
+      whole.Constraints
+      |> Map.exists (fun _ c ->
+        c.Node = node && List.contains (Dof.getAsString dof) c.Dof)
+
+    values
+    |> Map.map (fun node dofs ->
+      match whole.Nodes.TryFind node with
+      | Some n when abs (distance p n) <= tolerance ->
+        dofs
+        |> Map.filter (fun dof _ -> sign p dof > 0.0 || supported node dof)
+        |> Map.map (fun dof x -> if sign p dof > 0.0 then 2.0 * x else 0.0)
+      | _ -> dofs)
+    |> Map.filter (fun _ dofs -> not dofs.IsEmpty)
+    |> mirrorNodes p whole
+
+  /// <summary>
+  /// Extends the member end forces of a model cut on a symmetry plane to
+  /// the whole: each removed member takes the forces of the member at its
+  /// reflection, in its own local axes, whichever way round its nodes run.
+  /// </summary>
+  /// <remarks>
+  /// Axial members mirror in any plane, and Beam2D and Frame2D members in
+  /// the YZ and XZ planes. Three-dimensional members, whose local axes a
+  /// mirror turns left-handed, are reported for the part only.
+  /// </remarks>
+  /// <param name="p">Symmetry plane.</param>
+  /// <param name="whole">Model before the cut.</param>
+  /// <param name="forces">End forces of each member of the part.</param>
+  /// <returns>End forces of each member of the whole.</returns>
+  let mirrorMembers
+    (p: SymmetryPlane)
+    (whole: Model)
+    (forces: Map<string, float array>)
+    : Map<string, float array> =
+    let images = images p whole
+    let image id = images.TryFind id |> Option.defaultValue id
+
+    let planar =
+      match p with
+      | XY _ -> false
+      | YZ _
+      | XZ _ -> true
+
+    // Shears and moments about the plane's normal reverse with the mirror;
+    // reversing a member's nodes reverses its axial and shear forces.
+    let reflect (e: Element) reversed (f: float array) =
+      match e.Type with
+      | "Truss2D"
+      | "Truss3D"
+      | "Cable"
+      | "Strut" -> Some(if reversed then [| -f[1]; -f[0] |] else f)
+      | "Beam2D" when planar ->
+        if reversed then
+          Some [| f[2]; -f[3]; f[0]; -f[1] |]
+        else
+          Some(Array.map (~-) f)
+      | "Frame2D" when planar ->
+        if reversed then
+          Some [| -f[3]; f[4]; -f[5]; -f[0]; f[1]; -f[2] |]
+        else
+          Some [| f[0]; -f[1]; -f[2]; f[3]; -f[4]; -f[5] |]
+      | _ -> None
+
+    let byNodes =
+      whole.Elements
+      |> Map.toList
+      |> List.filter (fun (id, _) -> forces.ContainsKey id)
+      |> List.map (fun (id, e) -> (e.Type, e.Nodes), id)
+      |> Map.ofList
+
+    whole.Elements
+    |> Map.fold
+      (fun acc id e ->
+        let nodes = e.Nodes |> List.map image
+
+        let counterpart =
+          match
+            byNodes.TryFind(e.Type, nodes),
+            byNodes.TryFind(e.Type, List.rev nodes)
+          with
+          | Some k, _ -> Some(k, false)
+          | None, Some k -> Some(k, true)
+          | None, None -> None
+
+        match counterpart with
+        | Some(k, reversed) when not (forces.ContainsKey id) ->
+          match reflect e reversed forces[k] with
+          | Some f -> Map.add id f acc
+          | None -> acc
+        | _ -> acc)
+      forces
+
+  /// <summary>
+  /// Cuts a model on a symmetry plane, keeping the positive side and
+  /// applying symmetry conditions on the plane.
+  /// </summary>
+  /// <param name="p">Symmetry plane.</param>
+  /// <param name="m">Symmetric model.</param>
+  /// <returns>Reduced model, or SymmetryError.</returns>
+  let apply (p: SymmetryPlane) (m: Model) : Result<Model, SymmetryError> =
+    let tolerance = toleranceOf p m
+
+    // 1 on the kept side, -1 on the removed side and 0 on the plane.
+    let side (n: Node) =
+      match distance p n with
+      | d when d > tolerance -> 1
+      | d when d < -tolerance -> -1
+      | _ -> 0
+
+    let onPlane id = side m.Nodes[id] = 0
+    let kept = m.Nodes |> Map.filter (fun _ n -> side n >= 0)
+
+    let isPlate (e: Element) = e.Type = "Plate" || e.Type = "Shell"
+
+    let crossing =
+      m.Elements
+      |> Map.tryPick (fun id e ->
+        let sides =
+          e.Nodes
+          |> List.filter m.Nodes.ContainsKey
+          |> List.map (fun n -> side m.Nodes[n])
+
+        let onBoth = List.contains 1 sides && List.contains -1 sides
+        let allOn = not sides.IsEmpty && List.forall ((=) 0) sides
+
+        if onBoth then Some(CrossingElement id)
+        elif allOn && isPlate e then Some(PlateOnPlane id)
+        else None)
+
+    match crossing with
+    | Some e -> Error e
+    | None ->
+      let elements =
+        m.Elements
+        |> Map.filter (fun _ e -> e.Nodes |> List.forall kept.ContainsKey)
+        |> Map.map (fun _ e ->
+          if e.Nodes |> List.forall onPlane then
+            let halve (name: string) x =
+              if sectionProperties.Contains(name.ToLowerInvariant()) then
+                x / 2.0
+              else
+                x
+
+            { e with
+                Properties = e.Properties |> Option.map (Map.map halve) }
+          else
+            e)
+
+      let loads =
+        m.Loads
+        |> Map.filter (fun _ l ->
+          Option.forall kept.ContainsKey l.Node
+          && Option.forall elements.ContainsKey l.Element)
+        |> Map.map (fun _ l ->
+          match l.Node with
+          | Some n when onPlane n -> { l with Magnitude = l.Magnitude / 2.0 }
+          | _ -> l)
+
+      let provided node =
+        let types =
+          [ for KeyValue(_, e) in elements do
+              if List.contains node e.Nodes then
+                Dof.ofElementType e.Type ]
+
+        if types.IsEmpty || List.contains None types then
+          Dof.all
+        else
+          types |> List.choose id |> List.concat
+
+      let restrain node =
+        restrained p
+        |> List.filter (fun d -> List.contains d (provided node))
+        |> List.map Dof.getAsString
+
+      let constraints =
+        m.Constraints |> Map.filter (fun _ c -> kept.ContainsKey c.Node)
+
+      let planeNodes =
+        kept |> Map.toList |> List.map fst |> List.filter onPlane
+
+      let constraints =
+        planeNodes
+        |> List.fold
+          (fun (cs: Map<string, Constraint>) node ->
+            let existing =
+              cs |> Map.tryFindKey (fun _ c -> c.Node = node)
+
+            match existing, restrain node with
+            | _, [] -> cs
+            | Some id, dofs ->
+              let c = cs[id]
+              Map.add id { c with Dof = List.distinct (c.Dof @ dofs) } cs
+            | None, dofs ->
+              let id =
+                Seq.initInfinite (fun i -> $"c{i + 1}")
+                |> Seq.find (cs.ContainsKey >> not)
+
+              let c =
+                { Id = id
+                  Type = "Symmetry"
+                  Node = node
+                  Dof = dofs
+                  Angle = None
+                  Stiffness = None
+                  Displacement = None }
+
+              Map.add id c cs)
+          constraints
+
+      Ok
+        { m with
+            Nodes = kept
+            Elements = elements
+            Loads = loads
+            Constraints = constraints }
@@ -0,0 +1,677 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Globalization
+open System.Text
+open System.Text.Json.Nodes
+
+/// Defect in a row of a table.
+type private TableException(table: string, line: int, reason: string) =
+  inherit Exception($"{table} line {line}: {reason}")
+  member _.Table = table
+  member _.Line = line
+  member _.Reason = reason
+
+/// Kind of entity a table has one row of per entity.
+type private TableKind =
+  | NodeTable
+  | ElementTable
+  | MaterialTable
+  | SupportTable
+  | LoadTable
+  | CombinationTable
+  | InfoTable
+
+/// Kind, column names and rows of a table, each row by line number with
+/// its nonblank cells by column.
+type private ParsedTable =
+  TableKind * string list * (int * Map<string, string>) list
+
+/// Cell of a table written from a model.
+type internal TableCell =
+  | Number of float
+  | Text of string
+
+/// <summary>
+/// Reads models from tables, e.g. CSV files exported from spreadsheets,
+/// with one row per node, element, material, support or load, and lays
+/// models out as such tables.
+/// </summary>
+/// <remarks>
+/// The first row of each table names its columns, as the snake_case fields
+/// of a JSON model in any case, with spaces for underscores and units in
+/// brackets ignored, e.g. "Elastic modulus (Pa)". Its columns tell what it
+/// holds: x and y a table of nodes (id, x, y, z); magnitude loads (id,
+/// type, node, element, direction, magnitude, case, ...); elastic_modulus
+/// or e materials (id, name, type, elastic_modulus, density, ...); dof
+/// supports (id, type, node, dof, angle, stiffness, displacement); node1,
+/// node2, ... or nodes elements (id, type, material, node1, node2, ...,
+/// releases), whose other columns are properties such as area or i; factor
+/// the factors of combinations (id, case, factor); and units the model's
+/// info (name, units, dimensions, description, version). Fields are
+/// separated by commas, or by semicolons or tabs if the header has them,
+/// and may be quoted. Blank cells are omitted, lists such as nodes or dof
+/// are separated by spaces, as are the entries of releases (node:dof) and
+/// of stiffness and displacement (dof:value), and rows without an id are
+/// numbered l1, l2, ... for loads and s1, s2, ... for supports. Loads
+/// default to a Force at a node, a Moment about an axis, or a Distributed
+/// load on an element. Without a table of info, a model whose nodes have
+/// no z column has dimensions 2, and the model is in SI units.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Tables =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  let private value (x: float) : JsonNode = JsonValue.Create x
+  let private text (x: string) : JsonNode = JsonValue.Create x
+
+  let private list (xs: JsonNode seq) : JsonNode = JsonArray(Array.ofSeq xs)
+
+  let private record (properties: (string * JsonNode) list) : JsonNode =
+    let o = JsonObject()
+
+    for name, x in properties do
+      o[name] <- x
+
+    o
+
+  /// Column names of each kind of table, other than element properties.
+  let private columns =
+    Map
+      [ NodeTable, [ "id"; "x"; "y"; "z" ]
+        MaterialTable,
+        [ "id"
+          "name"
+          "type"
+          "elastic_modulus"
+          "shear_modulus"
+          "density"
+          "yield_strength"
+          "thermal_expansion"
+          "damping_ratio" ]
+        SupportTable,
+        [ "id"; "type"; "node"; "dof"; "angle"; "stiffness"; "displacement" ]
+        LoadTable,
+        [ "id"
+          "type"
+          "node"
+          "element"
+          "direction"
+          "magnitude"
+          "end_magnitude"
+          "position"
+          "end"
+          "datum"
+          "gradient"
+          "case" ]
+        CombinationTable, [ "id"; "case"; "factor" ]
+        InfoTable, [ "name"; "units"; "dimensions"; "description"; "version" ] ]
+
+  /// Columns of the same fields under shorter names.
+  let private aliases =
+    Map [ "e", "elastic_modulus"; "g", "shear_modulus"; "fy", "yield_strength" ]
+
+  let private numeric =
+    set
+      [ "x"
+        "y"
+        "z"
+        "elastic_modulus"
+        "shear_modulus"
+        "density"
+        "yield_strength"
+        "thermal_expansion"
+        "damping_ratio"
+        "angle"
+        "magnitude"
+        "end_magnitude"
+        "position"
+        "end"
+        "datum"
+        "gradient" ]
+
+  /// Column name as a JSON field, e.g. "Elastic modulus (Pa)" as
+  /// elastic_modulus.
+  let private field (header: string) =
+    let bracket = header.IndexOfAny [| '('; '[' |]
+    let name = if bracket >= 0 then header.Substring(0, bracket) else header
+
+    let name =
+      name.Trim().ToLowerInvariant().Replace(' ', '_').Replace('-', '_')
+
+    defaultArg (aliases.TryFind name) name
+
+  /// Splits a row into fields at a separator outside double quotes.
+  let private split (separator: char) (row: string) =
+    let fields = ResizeArray<string>()
+    let current = StringBuilder()
+    let mutable quoted = false
+    let mutable i = 0
+
+    while i < row.Length do
+      match row[i] with
+      | '"' when quoted && i + 1 < row.Length && row[i + 1] = '"' ->
+        current.Append '"' |> ignore
+        i <- i + 1
+      | '"' -> quoted <- not quoted
+      | c when c = separator && not quoted ->
+        fields.Add(current.ToString().Trim())
+        current.Clear() |> ignore
+      | c -> current.Append c |> ignore
+
+      i <- i + 1
+
+    fields.Add(current.ToString().Trim())
+    List.ofSeq fields
+
+  /// Kind of a table, from the columns of its header.
+  let private kindOf (table: string) (line: int) (names: string list) =
+    let has name = List.contains name names
+
+    if has "x" && has "y" then
+      NodeTable
+    elif has "magnitude" then
+      LoadTable
+    elif has "elastic_modulus" then
+      MaterialTable
+    elif has "dof" then
+      SupportTable
+    elif has "nodes" || has "node1" then
+      ElementTable
+    elif has "factor" then
+      CombinationTable
+    elif has "units" then
+      InfoTable
+    else
+      let reason =
+        "has no x and y (nodes), node1 or nodes (elements), "
+        + "elastic_modulus (materials), dof (supports), magnitude (loads), "
+        + "factor (combinations) or units (info) column"
+
+      raise (TableException(table, line, reason))
+
+  /// Reads a table from its rows of fields by line number, the first
+  /// naming the columns.
+  let private read
+    (table: string)
+    (lines: (int * string list) list)
+    : ParsedTable =
+    let skipped (fields: string list) =
+      match fields with
+      | first :: _ when first.StartsWith '#' -> true
+      | _ -> List.forall ((=) "") fields
+
+    match lines |> List.filter (snd >> skipped >> not) with
+    | [] -> raise (TableException(table, 1, "is empty"))
+    | (first, header) :: body ->
+      let names = header |> List.map field
+      let kind = kindOf table first names
+      let known = columns.TryFind kind
+
+      let unknown =
+        names
+        |> List.tryFind (fun n ->
+          known |> Option.exists (List.contains n >> not))
+
+      match unknown with
+      | Some name ->
+        raise (TableException(table, first, $"has an unknown column '{name}'"))
+      | None -> ()
+
+      let cells =
+        [ for line, fields in body ->
+            // Blank cells past the last column, e.g. formatted in a sheet.
+            let fields =
+              fields
+              |> List.rev
+              |> List.skipWhile ((=) "")
+              |> List.rev
+
+            if fields.Length > names.Length then
+              let count = $"{fields.Length} fields for {names.Length} columns"
+              raise (TableException(table, line, $"has {count}"))
+
+            let cells =
+              List.zip (List.truncate fields.Length names) fields
+              |> List.filter (fun (_, x) -> x <> "")
+              |> Map.ofList
+
+            line, cells ]
+
+      kind, names, cells
+
+  /// Rows of fields of CSV text by line number.
+  let private lines (content: string) =
+    let rows =
+      content.Split '\n'
+      |> Array.mapi (fun i line -> i + 1, line.TrimEnd '\r')
+      |> Array.filter (fun (_, line) ->
+        line.Trim() <> "" && not (line.TrimStart().StartsWith '#'))
+      |> List.ofArray
+
+    match rows with
+    | [] -> []
+    | (_, header) :: _ ->
+      let separator =
+        if header.Contains '\t' then '\t'
+        elif header.Contains ';' && not (header.Contains ',') then ';'
+        else ','
+
+      rows |> List.map (fun (i, row) -> i, split separator row)
+
+  let private number (table: string) (line: int) (name: string) (x: string) =
+    match Double.TryParse(x, NumberStyles.Float, culture) with
+    | true, v when Double.IsFinite v -> v
+    | _ ->
+      let reason = $"has {name} '{x}', which is not a number"
+      raise (TableException(table, line, reason))
+
+  let private words (x: string) =
+    x.Split([| ' '; '|'; '+' |], StringSplitOptions.RemoveEmptyEntries)
+    |> List.ofArray
+
+  /// Pairs of a list such as "n2:Rz n3:Rz", split at the first colon.
+  let private pairs (table: string) (line: int) (name: string) (x: string) =
+    [ for word in words x ->
+        match word.IndexOf ':' with
+        | i when i > 0 && i < word.Length - 1 ->
+          word.Substring(0, i), word.Substring(i + 1)
+        | _ ->
+          let reason = $"has {name} '{word}', which is not of the form a:b"
+          raise (TableException(table, line, reason)) ]
+
+  /// Builds a model's document tree from parsed tables, named by default.
+  let private build
+    (name: string)
+    (parsed: (string * ParsedTable) list)
+    : JsonNode =
+    let required table line (row: Map<string, string>) name =
+      match row.TryFind name with
+      | Some x -> x
+      | None -> raise (TableException(table, line, $"has no {name}"))
+
+    let measure table line (row: Map<string, string>) name =
+      number table line name (required table line row name)
+
+    // Fields of a row other than those named, as numbers or text.
+    let fields table line (row: Map<string, string>) (except: string list) =
+      [ for KeyValue(name, x) in row do
+          if not (List.contains name except) then
+            if numeric.Contains name then
+              name, value (number table line name x)
+            else
+              name, text x ]
+
+    // Values of a column of dof:value pairs, e.g. "Ux:1e6 Rz:2e4".
+    let valued table line (row: Map<string, string>) name =
+      row.TryFind name
+      |> Option.map (fun x ->
+        name,
+        record
+          [ for dof, v in pairs table line name x ->
+              dof, value (number table line name v) ])
+
+    let rowsOf kind =
+      [ for table, (k, _, cells) in parsed do
+          if k = kind then
+            for line, row in cells -> table, line, row ]
+
+    // Entities of the rows of every table of a kind, by ID; rows without
+    // an ID are numbered with a prefix, if given.
+    let entities kind (prefix: string option) build =
+      record
+        [ for i, (table, line, row) in List.indexed (rowsOf kind) ->
+            let id =
+              match row.TryFind "id", prefix with
+              | Some id, _ -> id
+              | None, Some prefix -> $"{prefix}{i + 1}"
+              | None, None -> required table line row "id"
+
+            id, build table line id row ]
+
+    let nodes =
+      entities NodeTable None (fun table line id row ->
+        let z =
+          row.TryFind "z"
+          |> Option.map (number table line "z")
+          |> Option.defaultValue 0.0
+
+        record
+          [ "id", text id
+            "x", value (measure table line row "x")
+            "y", value (measure table line row "y")
+            "z", value z ])
+
+    let elements =
+      entities ElementTable None (fun table line id row ->
+        // Nodes of node1, node2, ... in order, after any of nodes.
+        let numbered =
+          [ for KeyValue(name, x) in row do
+              match Int32.TryParse(name.Substring(min 4 name.Length)) with
+              | true, k when name.StartsWith "node" -> k, x
+              | _ -> () ]
+          |> List.sortBy fst
+          |> List.map snd
+
+        let given = row.TryFind "nodes" |> Option.map words
+        let connected = defaultArg given [] @ numbered
+
+        let properties =
+          [ for KeyValue(name, x) in row do
+              let named = [ "id"; "type"; "material"; "nodes"; "releases" ]
+
+              if not (List.contains name named || name.StartsWith "node") then
+                name, value (number table line name x) ]
+
+        // Released freedoms by end node, e.g. "n2:Rz n2:Ry".
+        let releases =
+          row.TryFind "releases"
+          |> Option.map (pairs table line "releases")
+          |> Option.map (fun released ->
+            record
+              [ for node, ends in List.groupBy fst released ->
+                  node, list [ for _, dof in ends -> text dof ] ])
+
+        record
+          [ "id", text id
+            "type", text (required table line row "type")
+            "nodes", list [ for n in connected -> text n ]
+            "material", text (required table line row "material")
+            if not properties.IsEmpty then
+              "properties", record properties
+            if releases.IsSome then
+              "releases", releases.Value ])
+
+    let materials =
+      entities MaterialTable None (fun table line id row ->
+        record
+          [ "id", text id
+            "name", text (defaultArg (row.TryFind "name") id)
+            "type", text (defaultArg (row.TryFind "type") "Generic")
+            yield! fields table line row [ "id"; "name"; "type" ] ])
+
+    let supports =
+      entities SupportTable (Some "s") (fun table line id row ->
+        let dofs = row.TryFind "dof" |> Option.map words
+        let named = [ "id"; "type"; "node"; "dof" ]
+        let maps = [ "stiffness"; "displacement" ]
+
+        record
+          [ "id", text id
+            "type", text (defaultArg (row.TryFind "type") "Support")
+            "node", text (required table line row "node")
+            "dof", list [ for d in defaultArg dofs [] -> text d ]
+            yield! fields table line row (named @ maps)
+            yield! maps |> List.choose (valued table line row) ])
+
+    let loads =
+      entities LoadTable (Some "l") (fun table line id row ->
+        let direction = required table line row "direction"
+
+        let kind =
+          match row.TryFind "type", row.TryFind "element" with
+          | Some kind, _ -> kind
+          | None, Some _ -> "Distributed"
+          | None, None when direction.StartsWith "M" -> "Moment"
+          | None, None -> "Force"
+
+        record
+          [ "id", text id
+            "type", text kind
+            yield! fields table line row [ "id"; "type" ] ])
+
+    // Factors of each combination, a row per case.
+    let combinations =
+      let factors =
+        [ for table, line, row in rowsOf CombinationTable ->
+            required table line row "id",
+            (required table line row "case",
+             measure table line row "factor") ]
+
+      record
+        [ for id, rows in List.groupBy fst factors ->
+            id,
+            record
+              [ "id", text id
+                "factors",
+                record [ for _, (case, f) in rows -> case, value f ] ] ]
+
+    let info =
+      match rowsOf InfoTable with
+      | [] -> None
+      | [ row ] -> Some row
+      | _ :: (table, line, _) :: _ ->
+        raise (TableException(table, line, "is a second row of info"))
+
+    // Nodes without a z column lie in the XY plane.
+    let planar =
+      parsed
+      |> List.filter (fun (_, (kind, _, _)) -> kind = NodeTable)
+      |> function
+        | [] -> false
+        | tables ->
+          tables
+          |> List.forall (fun (_, (_, names, _)) ->
+            not (List.contains "z" names))
+
+    let dimensions =
+      match info with
+      | Some(table, line, row) ->
+        row.TryFind "dimensions"
+        |> Option.map (fun x ->
+          match Int32.TryParse(x, NumberStyles.Integer, culture) with
+          | true, d -> d
+          | _ ->
+            let reason = $"has dimensions '{x}', which is not 2 or 3"
+            raise (TableException(table, line, reason)))
+      | None when planar -> Some 2
+      | None -> None
+
+    let declared name fallback =
+      info
+      |> Option.bind (fun (_, _, row) -> Map.tryFind name row)
+      |> Option.defaultValue fallback
+
+    let description =
+      info |> Option.bind (fun (_, _, row) -> row.TryFind "description")
+
+    record
+      [ "info",
+        record
+          [ "name", text (declared "name" name)
+            "units", text (declared "units" "SI")
+            "version", text (declared "version" "1.0")
+            if description.IsSome then
+              "description", text description.Value
+            if dimensions.IsSome then
+              "dimensions", JsonValue.Create dimensions.Value ]
+        "nodes", nodes
+        "elements", elements
+        "materials", materials
+        "constraints", supports
+        "loads", loads
+        "combinations", combinations ]
+
+  /// <summary>
+  /// Builds a model's document tree from tables.
+  /// </summary>
+  /// <param name="tables">Name, e.g. the file name, and text of each table.
+  /// </param>
+  /// <returns>Document tree, or MalformedModel naming the table and line.
+  /// </returns>
+  let internal parseNode
+    (tables: (string * string) list)
+    : Result<JsonNode, ModelError> =
+    try
+      tables
+      |> List.map (fun (table, content) -> table, read table (lines content))
+      |> build "CSV model"
+      |> Ok
+    with :? TableException as ex ->
+      Error(MalformedModel ex.Message)
+
+  /// <summary>
+  /// Builds a model's document tree from tables of cells, e.g. the sheets
+  /// of a workbook; empty tables are skipped.
+  /// </summary>
+  /// <param name="name">Name of the model without a table of info.</param>
+  /// <param name="tables">Name of each table and its rows of cells, by row
+  /// number.</param>
+  /// <returns>Document tree, or MalformedModel naming the table and row.
+  /// </returns>
+  let internal parseRows
+    (name: string)
+    (tables: (string * (int * string list) list) list)
+    : Result<JsonNode, ModelError> =
+    try
+      tables
+      |> List.filter (fun (_, rows) ->
+        rows |> List.exists (snd >> List.exists ((<>) "")))
+      |> List.map (fun (table, rows) -> table, read table rows)
+      |> build name
+      |> Ok
+    with :? TableException as ex ->
+      Error(MalformedModel $"{ex.Table} row {ex.Line}: {ex.Reason}")
+
+  /// <summary>
+  /// Lays a model out as the tables that parseRows reads back: Info,
+  /// Nodes, Elements, Materials, Constraints, Loads and Combinations.
+  /// </summary>
+  /// <remarks>
+  /// Optional columns are left out where every row is blank. Parameters,
+  /// gravity, damping, time histories, point masses and panels have no
+  /// table.
+  /// </remarks>
+  /// <param name="m">Model to lay out.</param>
+  /// <returns>Name and rows of each table, the first naming the columns.
+  /// </returns>
+  let internal layout (m: Model) : (string * TableCell list list) list =
+    let number x = Some(Number x)
+    let word x = if isNull x then None else Some(Text x)
+    let numbers (x: float option) = Option.map Number x
+    let format (x: float) = x.ToString("R", culture)
+
+    // Text of a list, or none for an empty list.
+    let joined (xs: string list) =
+      if xs.IsEmpty then None else word (String.concat " " xs)
+
+    let valued (x: Map<string, float> option) =
+      x
+      |> Option.map (Map.toList >> List.map (fun (d, v) -> $"{d}:{format v}"))
+      |> Option.bind joined
+
+    // Rows of a table by column, each with its header and whether it is
+    // written when blank in every row.
+    let table name (rows: 'T list) columns =
+      let kept =
+        columns
+        |> List.filter (fun (_, always, cell) ->
+          always || List.exists (cell >> Option.isSome) rows)
+
+      name,
+      [ for header, _, _ in kept -> Text header ]
+      :: [ for row in rows ->
+             [ for _, _, cell in kept -> defaultArg (cell row) (Text "") ] ]
+
+    let values (x: Map<string, 'T>) = x |> Map.toList |> List.map snd
+    let planar = m.Info.Dimensions = Some 2
+
+    let elements = values m.Elements
+
+    let connected =
+      elements |> List.map (fun e -> e.Nodes.Length) |> List.fold max 2
+
+    let properties =
+      elements
+      |> List.collect (fun e ->
+        e.Properties |> Option.map Map.toList |> Option.defaultValue [])
+      |> List.map fst
+      |> List.distinct
+      |> List.sort
+
+    let nodeAt k (e: Element) =
+      List.tryItem (k - 1) e.Nodes |> Option.map Text
+
+    let property name (e: Element) =
+      e.Properties |> Option.bind (Map.tryFind name) |> numbers
+
+    let releases (e: Element) =
+      e.Releases
+      |> Option.map (fun r ->
+        [ for KeyValue(node, dofs) in r do
+            for d in dofs -> $"{node}:{d}" ])
+      |> Option.bind joined
+
+    [ table
+        "Info"
+        [ m.Info ]
+        [ "name", true, fun (i: ModelInfo) -> word i.Name
+          "units", true, fun i -> word i.Units
+          "dimensions", false, fun i -> numbers (Option.map float i.Dimensions)
+          "description", false, fun i -> Option.map Text i.Description
+          "version", true, fun i -> word i.Version ]
+      table
+        "Nodes"
+        (values m.Nodes)
+        [ "id", true, fun (n: Node) -> word n.Id
+          "x", true, fun n -> number n.X
+          "y", true, fun n -> number n.Y
+          "z", not planar, fun n -> if planar then None else number n.Z ]
+      table
+        "Elements"
+        elements
+        ([ "id", true, fun (e: Element) -> word e.Id
+           "type", true, fun e -> word e.Type
+           "material", true, fun e -> word e.Material ]
+         @ [ for k in 1..connected -> $"node{k}", true, nodeAt k ]
+         @ [ for p in properties -> p, true, property p ]
+         @ [ "releases", false, releases ])
+      table
+        "Materials"
+        (values m.Materials)
+        [ "id", true, fun (x: Material) -> word x.Id
+          "name", true, fun x -> word x.Name
+          "type", true, fun x -> word x.Type
+          "elastic_modulus", true, fun x -> number x.ElasticModulus
+          "shear_modulus", false, fun x -> numbers x.ShearModulus
+          "density", true, fun x -> numbers x.Density
+          "yield_strength", false, fun x -> numbers x.YieldStrength
+          "thermal_expansion", false, fun x -> numbers x.ThermalExpansion
+          "damping_ratio", false, fun x -> numbers x.DampingRatio ]
+      table
+        "Constraints"
+        (values m.Constraints)
+        [ "id", true, fun (c: Constraint) -> word c.Id
+          "type", true, fun c -> word c.Type
+          "node", true, fun c -> word c.Node
+          "dof", true, fun c -> joined c.Dof
+          "angle", false, fun c -> numbers c.Angle
+          "stiffness", false, fun c -> valued c.Stiffness
+          "displacement", false, fun c -> valued c.Displacement ]
+      table
+        "Loads"
+        (values m.Loads)
+        [ "id", true, fun (l: Load) -> word l.Id
+          "type", true, fun l -> word l.Type
+          "node", true, fun l -> Option.map Text l.Node
+          "element", true, fun l -> Option.map Text l.Element
+          "direction", true, fun l -> word l.Direction
+          "magnitude", true, fun l -> number l.Magnitude
+          "end_magnitude", false, fun l -> numbers l.EndMagnitude
+          "position", false, fun l -> numbers l.Position
+          "end", false, fun l -> numbers l.End
+          "datum", false, fun l -> numbers l.Datum
+          "gradient", false, fun l -> numbers l.Gradient
+          "case", true, fun l -> Option.map Text l.Case ]
+      table
+        "Combinations"
+        [ for c in values m.Combinations do
+            for KeyValue(case, f) in c.Factors -> c.Id, case, f ]
+        [ "id", true, fun (id, _, _) -> word id
+          "case", true, fun (_, case, _) -> word case
+          "factor", true, fun (_, _, f) -> number f ] ]
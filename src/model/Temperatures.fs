@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Globalization
+open System.IO
+
+/// <summary>
+/// Temperature of a node or member in a temperature field, e.g. from a
+/// heat-transfer analysis or sensors.
+/// </summary>
+type TemperatureReading =
+  {
+    /// ID of a member, else of a node.
+    Id: string
+    Temperature: float
+    /// Temperature difference per unit depth along member local y, for
+    /// members only.
+    Gradient: float option
+  }
+
+/// <summary>
+/// Errors raised whilst reading a temperature field or applying it.
+/// </summary>
+type TemperatureError =
+  | MalformedTemperatures of line: int * reason: string
+  | UnreadableTemperatures of reason: string
+  | UnknownTarget of id: string
+  | GradientAtNode of id: string
+  | NothingHeated
+  | CaseTaken of name: string
+
+[<RequireQualifiedAccess>]
+module TemperatureError =
+
+  let getAsString (e: TemperatureError) : string =
+    match e with
+    | MalformedTemperatures(line, reason) ->
+      $"Malformed temperatures: line {line} {reason}."
+    | UnreadableTemperatures reason -> $"Cannot read temperatures: {reason}"
+    | UnknownTarget id -> $"Temperature of '{id}' names no node or element."
+    | GradientAtNode id ->
+      $"Temperature of node '{id}' has a gradient, which only members take."
+    | NothingHeated -> "Temperature field changes no member's temperature."
+    | CaseTaken name ->
+      $"Load case '{name}' is already used by a load, case or combination."
+
+/// <summary>
+/// Applies temperature fields, such as the output of a heat-transfer
+/// analysis or sensor readings, to a model as thermal loads.
+/// </summary>
+/// <remarks>
+/// A field has one reading per line: the ID of a member or node, its
+/// temperature and, for members, an optional gradient through the depth,
+/// separated by commas, semicolons, tabs or spaces. Blank lines, lines
+/// starting with '#' and a header line are skipped. Each two-node member
+/// takes the temperature given for it, else the mean of those of its end
+/// nodes when both have one, and is loaded by a Thermal load of the
+/// change from the reference temperature at which the model is free of
+/// thermal stress. Plates, springs and links are not heated.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Temperatures =
+
+  /// Element types that thermal loads act on.
+  let private members =
+    set
+      [ "Truss2D"
+        "Truss3D"
+        "Cable"
+        "Strut"
+        "Beam2D"
+        "Frame2D"
+        "Beam3D"
+        "Frame3D" ]
+
+  /// <summary>
+  /// Parses a temperature field from text, e.g. CSV.
+  /// </summary>
+  /// <param name="text">Temperature field text.</param>
+  /// <returns>Readings in order, or MalformedTemperatures.</returns>
+  let parse (text: string) : Result<TemperatureReading list, TemperatureError> =
+    let culture = CultureInfo.InvariantCulture
+    let separators = [| ','; ';'; '\t'; ' ' |]
+    let options = StringSplitOptions.RemoveEmptyEntries
+
+    let number (s: string) =
+      match Double.TryParse(s, NumberStyles.Float, culture) with
+      | true, x -> Some x
+      | _ -> None
+
+    let fields (text: string) =
+      text.Split(separators, options) |> Array.map (fun f -> f.Trim('"'))
+
+    let lines =
+      text.Split('\n')
+      |> Array.mapi (fun i line -> i + 1, line.Trim())
+      |> Array.filter (fun (_, line) -> line <> "" && not (line.StartsWith '#'))
+      |> List.ofArray
+
+    // A header names its temperature column rather than giving one.
+    let rows =
+      match lines with
+      | (_, first) :: rest when
+        fields first |> Array.tryItem 1 |> Option.bind number |> Option.isNone
+        ->
+        rest
+      | all -> all
+
+    let reading (line, text) =
+      match fields text with
+      | [| id; t |] ->
+        match number t with
+        | Some t ->
+          Ok
+            { Id = id
+              Temperature = t
+              Gradient = None }
+        | None -> Error(MalformedTemperatures(line, $"has temperature '{t}'"))
+      | [| id; t; g |] ->
+        match number t, number g with
+        | Some t, Some g ->
+          Ok
+            { Id = id
+              Temperature = t
+              Gradient = Some g }
+        | _ -> Error(MalformedTemperatures(line, "has a non-numeric value"))
+      | _ ->
+        let reason = "needs an ID, temperature and gradient"
+        Error(MalformedTemperatures(line, reason))
+
+    let readings =
+      List.foldBack
+        (fun row acc ->
+          match reading row, acc with
+          | Ok r, Ok rest -> Ok(r :: rest)
+          | Error e, _
+          | _, Error e -> Error e)
+        rows
+        (Ok [])
+
+    match readings with
+    | Ok [] -> Error(MalformedTemperatures(0, "has no readings"))
+    | other -> other
+
+  /// <summary>
+  /// Reads a temperature field file.
+  /// </summary>
+  /// <param name="path">Path to temperature field file, e.g. CSV.</param>
+  /// <returns>Readings, or TemperatureError.</returns>
+  let read (path: string) : Result<TemperatureReading list, TemperatureError> =
+    try
+      File.ReadAllText path |> parse
+    with
+    | :? IOException as ex -> Error(UnreadableTemperatures ex.Message)
+    | :? UnauthorizedAccessException as ex ->
+      Error(UnreadableTemperatures ex.Message)
+
+  /// <summary>
+  /// Adds a load case of thermal loads on the members of a model, from a
+  /// temperature field.
+  /// </summary>
+  /// <param name="readings">Temperature field.</param>
+  /// <param name="reference">Temperature at which the model is free of
+  /// thermal stress.</param>
+  /// <param name="case">Name of the new load case, e.g. "T1".</param>
+  /// <param name="m">Model.</param>
+  /// <returns>Model with a Thermal load per member heated, named after the
+  /// case and member, or TemperatureError.</returns>
+  let apply
+    (readings: TemperatureReading list)
+    (reference: float)
+    (case: string)
+    (m: Model)
+    : Result<Model, TemperatureError> =
+    let unknown =
+      readings
+      |> List.tryFind (fun r ->
+        not (m.Elements.ContainsKey r.Id || m.Nodes.ContainsKey r.Id))
+
+    let atNode =
+      readings
+      |> List.tryFind (fun r ->
+        r.Gradient.IsSome && not (m.Elements.ContainsKey r.Id))
+
+    // Later readings of the same node or member replace earlier ones.
+    let byId = readings |> List.map (fun r -> r.Id, r) |> Map.ofList
+
+    let loads =
+      [ for KeyValue(id, e) in m.Elements do
+          let temperature, gradient =
+            match byId.TryFind id, e.Nodes |> List.map byId.TryFind with
+            | Some r, _ -> Some r.Temperature, r.Gradient
+            | None, [ Some a; Some b ] ->
+              Some((a.Temperature + b.Temperature) / 2.0), None
+            | None, _ -> None, None
+
+          match temperature with
+          | Some t when
+            members.Contains e.Type
+            && e.Nodes.Length = 2
+            && (t <> reference || gradient.IsSome)
+            ->
+            let name = $"{case}-{id}"
+
+            name,
+            { Id = name
+              Type = "Thermal"
+              Node = None
+              Element = Some id
+              Direction = "Temperature"
+              Magnitude = t - reference
+              Position = None
+              End = None
+              EndMagnitude = None
+              Datum = None
+              Gradient = gradient
+              Case = Some case }
+          | _ -> () ]
+
+    let taken =
+      case :: List.map fst loads
+      |> List.tryFind (fun name ->
+        m.Loads.ContainsKey name
+        || m.Combinations.ContainsKey name
+        || List.contains name (LoadCases.cases m))
+
+    match unknown, atNode, taken with
+    | Some r, _, _ -> Error(UnknownTarget r.Id)
+    | _, Some r, _ -> Error(GradientAtNode r.Id)
+    | _ when loads.IsEmpty -> Error NothingHeated
+    | _, _, Some name -> Error(CaseTaken name)
+    | None, None, None ->
+      Ok
+        { m with
+            Loads =
+              List.fold (fun acc (id, l) -> Map.add id l acc) m.Loads loads }
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Errors raised when distributing panel loads to beams.
+/// </summary>
+type TributaryError =
+  | UnsupportedPanel of panel: string * reason: string
+  | UnsupportedEdge of panel: string * start: string * finish: string
+  | UnalignedGravity
+  | LoadTaken of load: string
+
+[<RequireQualifiedAccess>]
+module TributaryError =
+
+  let getAsString (e: TributaryError) : string =
+    match e with
+    | UnsupportedPanel(panel, reason) -> $"Panel '{panel}' {reason}."
+    | UnsupportedEdge(panel, start, finish) ->
+      $"Panel '{panel}' has no beams along its edge '{start}' to '{finish}'."
+    | UnalignedGravity ->
+      "Gravity must act along a global axis to distribute panel loads."
+    | LoadTaken load -> $"Load '{load}' already exists."
+
+/// <summary>
+/// Distributes the area loads of slab panels to the beams along their edges
+/// as triangular and trapezoidal line loads, by tributary area.
+/// </summary>
+/// <remarks>
+/// Panels are rectangles of four corner nodes. A two-way panel is divided
+/// by lines at 45° from its corners, so each shorter edge takes a triangle
+/// of load and each longer edge a trapezoid, both peaking at the pressure
+/// times half the shorter side. A one-way panel spans its shorter direction,
+/// loading its two longer edges (the first and third, if square) uniformly
+/// with the pressure times half the span. Each edge must be covered by
+/// collinear beam or frame elements between its corners, which receive
+/// "Distributed" loads along gravity in the panel's load cases.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Tributary =
+
+  let private members = set [ "Beam2D"; "Frame2D"; "Beam3D"; "Frame3D" ]
+
+  let private sub (a: Node) (b: Node) = [| b.X - a.X; b.Y - a.Y; b.Z - a.Z |]
+
+  let private dot (u: float[]) (v: float[]) =
+    Array.fold2 (fun s a b -> s + a * b) 0.0 u v
+
+  let private norm (u: float[]) = sqrt (dot u u)
+
+  /// Intensity per unit pressure along an edge, as pieces (s0, s1, w0, w1)
+  /// varying linearly with distance s from its first corner.
+  let private profile oneWay (length: float) (other: float) first =
+    let span = min length other
+    let peak = span / 2.0
+
+    if oneWay then
+      let loaded = length > other || length = other && first
+      if loaded then [ 0.0, length, peak, peak ] else []
+    else
+      [ 0.0, peak, 0.0, peak
+        peak, length - peak, peak, peak
+        length - peak, length, peak, 0.0 ]
+      |> List.filter (fun (s0, s1, _, _) -> s1 > s0)
+
+  /// Axis and sense of the model's gravity, e.g. ("Fy", -1.0).
+  let private direction (m: Model) =
+    match Gravity.resolve m |> Gravity.acceleration with
+    | Some(x, y, z) ->
+      let g = [| x; y; z |]
+      let size = norm g
+
+      [ "Fx", x; "Fy", y; "Fz", z ]
+      |> List.filter (fun (_, c) -> abs c > 1e-9 * size)
+      |> function
+        | [ axis, c ] -> Ok(axis, float (sign c))
+        | _ -> Error UnalignedGravity
+    | None -> Error UnalignedGravity
+
+  /// Line loads per unit pressure on the beams of a panel, as (element,
+  /// start, finish, intensity at start, intensity at finish).
+  let private shares (m: Model) (p: Panel) =
+    let corners = p.Nodes |> List.choose m.Nodes.TryFind
+
+    match p.Type, corners with
+    | t, _ when t <> "OneWay" && t <> "TwoWay" ->
+      Error(UnsupportedPanel(p.Id, $"has unknown type '{t}'"))
+    | _, [ _; _; _; _ ] when p.Nodes.Length = 4 ->
+      let corners = Array.ofList corners
+      let edges = Array.init 4 (fun k -> corners[k], corners[(k + 1) % 4])
+      let lengths = edges |> Array.map (fun (a, b) -> norm (sub a b))
+      let tolerance = 1e-6 * Array.max lengths
+
+      let square k =
+        let a, b = edges[k]
+        let _, c = edges[(k + 1) % 4]
+        abs (dot (sub a b) (sub b c)) <= tolerance * lengths[(k + 1) % 4]
+
+      if Array.min lengths <= tolerance then
+        Error(UnsupportedPanel(p.Id, "has coincident corners"))
+      elif not (Array.forall square [| 0; 1; 2; 3 |]) then
+        Error(UnsupportedPanel(p.Id, "must be a rectangle"))
+      else
+        let beams =
+          m.Elements
+          |> Map.filter (fun _ e ->
+            members.Contains e.Type
+            && e.Nodes.Length = 2
+            && e.Nodes |> List.forall m.Nodes.ContainsKey)
+
+        [ for k in 0..3 ->
+            let a, b = edges[k]
+            let length = lengths[k]
+            let u = sub a b |> Array.map (fun x -> x / length)
+
+            // Distance along the edge of a node on it.
+            let along (n: Node) =
+              let d = sub a n
+              let s = dot d u
+              let off = norm (Array.map2 (fun x y -> x - s * y) d u)
+              let within = s >= -tolerance && s <= length + tolerance
+
+              if off <= tolerance && within then Some s else None
+
+            let spans =
+              [ for KeyValue(id, e) in beams do
+                  match e.Nodes |> List.map (fun n -> along m.Nodes[n]) with
+                  | [ Some si; Some sj ] when abs (sj - si) > tolerance ->
+                    id, si, sj
+                  | _ -> () ]
+              |> List.sortBy (fun (_, si, sj) -> min si sj)
+
+            let reach =
+              spans
+              |> List.fold
+                (fun reached (_, si, sj) ->
+                  if min si sj <= reached + tolerance then
+                    max reached (max si sj)
+                  else
+                    reached)
+                0.0
+
+            if reach < length - tolerance then
+              Error(UnsupportedEdge(p.Id, a.Id, b.Id))
+            else
+              let other = lengths[(k + 1) % 4]
+              let pieces = profile (p.Type = "OneWay") length other (k % 2 = 0)
+
+              Ok
+                [ for id, si, sj in spans do
+                    for s0, s1, w0, w1 in pieces do
+                      let lo = max s0 (min si sj)
+                      let hi = min s1 (max si sj)
+
+                      if hi - lo > tolerance then
+                        let w s = w0 + (w1 - w0) * (s - s0) / (s1 - s0)
+                        let fraction s = (s - si) / (sj - si)
+                        let ends = [ fraction lo, w lo; fraction hi, w hi ]
+                        let (t0, q0), (t1, q1) = List.min ends, List.max ends
+                        id, max 0.0 t0, min 1.0 t1, q0, q1 ] ]
+        |> List.fold
+          (fun acc edge ->
+            match acc, edge with
+            | Ok xs, Ok ys -> Ok(xs @ ys)
+            | Error e, _
+            | _, Error e -> Error e)
+          (Ok [])
+    | _ -> Error(UnsupportedPanel(p.Id, "needs 4 existing corner nodes"))
+
+  /// <summary>
+  /// Replaces the panels of a model with "Distributed" loads on the beams
+  /// that support them, named after the panel and case, e.g. "p1-LL-3".
+  /// </summary>
+  /// <param name="m">Model.</param>
+  /// <returns>
+  /// Model with the panel loads distributed and its panels removed, so they
+  /// are not applied twice, or TributaryError.
+  /// </returns>
+  let distribute (m: Model) : Result<Model, TributaryError> =
+    let panels = defaultArg m.Panels Map.empty |> Map.toList |> List.map snd
+
+    let loads axis sense =
+      panels
+      |> List.fold
+        (fun acc p ->
+          match acc, shares m p with
+          | Error e, _
+          | _, Error e -> Error e
+          | Ok ls, Ok lines ->
+            Ok
+              [ yield! ls
+                for KeyValue(case, pressure) in p.Loads do
+                  for k, (element, t0, t1, q0, q1) in List.indexed lines do
+                    let id = $"{p.Id}-{case}-{k + 1}"
+
+                    { Id = id
+                      Type = "Distributed"
+                      Node = None
+                      Element = Some element
+                      Direction = axis
+                      Magnitude = sense * pressure * q0
+                      Position = Some t0
+                      End = Some t1
+                      EndMagnitude = Some(sense * pressure * q1)
+                      Datum = None
+                      Gradient = None
+                      Case =
+                        if case = LoadCases.DefaultCase then
+                          None
+                        else
+                          Some case } ])
+        (Ok [])
+
+    match direction m with
+    | Error e -> Error e
+    | Ok(axis, sense) ->
+      match loads axis sense with
+      | Error e -> Error e
+      | Ok added ->
+        match added |> List.tryFind (fun l -> m.Loads.ContainsKey l.Id) with
+        | Some l -> Error(LoadTaken l.Id)
+        | None ->
+          Ok
+            { m with
+                Loads =
+                  added |> List.fold (fun acc l -> Map.add l.Id l acc) m.Loads
+                Panels = None }
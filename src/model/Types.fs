@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.IO
+
+/// <summary>
+/// Descriptive metadata for a structural model.
+/// </summary>
+type ModelInfo =
+  { Name: string
+    Description: string option
+    Units: string
+    Version: string
+    /// Number of spatial dimensions: 2 for a plane model in XY, whose
+    /// freedoms are Ux, Uy and Rz, or 3. Undeclared, the freedoms follow
+    /// from the element types.
+    Dimensions: int option }
+
+/// <summary>
+/// Point in space to which elements, loads and constraints attach.
+/// </summary>
+type Node =
+  { Id: string
+    X: float
+    Y: float
+    Z: float }
+
+/// <summary>
+/// Structural member connecting two or more nodes.
+/// </summary>
+type Element =
+  { Id: string
+    Type: string
+    Nodes: string list
+    Material: string
+    Properties: Map<string, float> option
+    /// Freedoms released at the ends of a beam or frame member, in member
+    /// axes and keyed by end node, e.g. "Rz" for a pinned end.
+    Releases: Map<string, string list> option }
+
+/// <summary>
+/// Material definition referenced by elements.
+/// </summary>
+type Material =
+  { Id: string
+    Name: string
+    Type: string
+    ElasticModulus: float
+    Density: float option
+    YieldStrength: float option
+    /// Shear modulus, resisting the torsion of space frame members and
+    /// giving plates and shells their Poisson's ratio.
+    ShearModulus: float option
+    /// Viscous damping ratio combined across materials by strain energy.
+    DampingRatio: float option
+    /// Coefficient of linear thermal expansion, per degree, for thermal
+    /// loads.
+    ThermalExpansion: float option }
+
+/// <summary>
+/// Load applied at a node, along a member, or across a plate element.
+/// Loads without a case belong to the default load case.
+/// </summary>
+/// <remarks>
+/// "Force" and "Moment" loads act at a node; a "Force" may instead act on a
+/// member at a fractional Position along it. "Distributed" loads act on a
+/// member per unit length, varying linearly from Magnitude at Position (0 if
+/// omitted) to EndMagnitude at End (1 if omitted). "Pressure" loads act
+/// uniformly over a plate element; "Hydrostatic" loads take Magnitude as
+/// the fluid's unit weight and vary with depth below Datum. Surface loads act along the
+/// element normal when Direction is "Normal", else along a global axis.
+/// "SelfWeight" loads apply the weight of every element along gravity,
+/// scaled by Magnitude, and take "Gravity" as their Direction. "Thermal"
+/// loads change the temperature of a member uniformly by Magnitude and
+/// through its depth by Gradient, and take "Temperature" as their Direction.
+/// </remarks>
+type Load =
+  { Id: string
+    Type: string
+    Node: string option
+    Element: string option
+    Direction: string
+    Magnitude: float
+    /// Fraction of member length from its first node for member loads.
+    Position: float option
+    /// Fraction of member length at which a distributed load ends.
+    End: float option
+    /// Intensity at End of a linearly varying distributed load; Magnitude
+    /// if omitted.
+    EndMagnitude: float option
+    /// Fluid surface level, measured against gravity, for hydrostatic loads.
+    Datum: float option
+    /// Temperature difference per unit depth along member local y for
+    /// thermal loads, positive when the +y face is hotter.
+    Gradient: float option
+    Case: string option }
+
+/// <summary>
+/// Linear combination of load cases, e.g. 1.35 DL + 1.5 LL.
+/// </summary>
+type Combination =
+  { Id: string
+    Factors: Map<string, float> }
+
+/// <summary>
+/// Gravitational acceleration used for self-weight and hydrostatic loads.
+/// </summary>
+type Gravity =
+  {
+    /// Acceleration in model units, e.g. 9.80665 for SI.
+    Magnitude: float
+    /// Direction as [x; y; z] in global coordinates; need not be unit length.
+    Direction: float list
+  }
+
+/// <summary>
+/// Rayleigh damping C = a0·M + a1·K for direct time integration.
+/// </summary>
+type Rayleigh =
+  {
+    /// Mass-proportional coefficient a0, in 1/s.
+    Mass: float
+    /// Stiffness-proportional coefficient a1, in s.
+    Stiffness: float
+  }
+
+/// <summary>
+/// Viscous damping ratios for modal-superposition and response spectrum
+/// analyses, e.g. 0.05 for 5 % of critical.
+/// </summary>
+type Damping =
+  {
+    /// Ratio for modes without their own; 0.05 if omitted.
+    Ratio: float option
+    /// Ratio per mode number, e.g. { "1": 0.02 }.
+    Modes: Map<string, float> option
+    /// Coefficients for time-history analysis; if omitted, chosen to give
+    /// Ratio in the first two modes.
+    Rayleigh: Rayleigh option
+  }
+
+/// <summary>
+/// Piecewise-linear factor on a load case over time, zero outside the times
+/// given.
+/// </summary>
+type LoadHistory =
+  {
+    /// Times in ascending order.
+    Times: float list
+    /// Factor at each time.
+    Factors: float list
+  }
+
+/// <summary>
+/// Time stepping and time-varying loads of a time-history analysis.
+/// </summary>
+type TimeHistory =
+  {
+    /// Integration time step.
+    TimeStep: float
+    /// Time to integrate from rest to.
+    Duration: float
+    /// Factor on each load case over time, keyed by case; other cases are
+    /// not applied.
+    Cases: Map<string, LoadHistory>
+  }
+
+/// <summary>
+/// Floor or roof slab panel spanning between beams, whose area loads are
+/// distributed to the beams along its edges by tributary area.
+/// </summary>
+type Panel =
+  { Id: string
+    /// "OneWay" panels span their shorter direction onto their two longer
+    /// edges; "TwoWay" panels load every edge.
+    Type: string
+    /// Corner nodes in order around the panel.
+    Nodes: string list
+    /// Pressure on the panel by load case, acting along gravity.
+    Loads: Map<string, float> }
+
+/// <summary>
+/// Mass attached to a node, such as equipment, a tank or cladding, that
+/// adds to the mass of the elements in dynamic analyses.
+/// </summary>
+type PointMass =
+  { Id: string
+    Node: string
+    /// Mass acting along every translational degree of freedom.
+    Mass: float
+    /// Rotary inertia by rotational degree of freedom, e.g. "Rz".
+    Inertia: Map<string, float> option }
+
+/// <summary>
+/// Boundary condition restraining degrees of freedom at a node.
+/// </summary>
+type Constraint =
+  { Id: string
+    Type: string
+    Node: string
+    Dof: string list
+    /// Inclination of an inclined support in degrees, anticlockwise about Z
+    /// from global X to its local x axis; its Ux and Uy are then local.
+    Angle: float option
+    /// Stiffness of an elastic support by degree of freedom, e.g. "Rz" for
+    /// partial fixity; freedoms in Dof are restrained instead.
+    Stiffness: Map<string, float> option
+    /// Imposed displacement by degree of freedom, e.g. a support settlement,
+    /// at which freedoms in Dof are held in every load set.
+    Displacement: Map<string, float> option }
+
+/// <summary>
+/// Structural model as described by the Gazelle model schema.
+/// Collections are keyed by entity ID.
+/// </summary>
+type Model =
+  { Info: ModelInfo
+    Parameters: Map<string, float> option
+    /// Gravity acting on the model; standard gravity along -Y if omitted.
+    Gravity: Gravity option
+    Damping: Damping option
+    TimeHistory: TimeHistory option
+    Nodes: Map<string, Node>
+    Elements: Map<string, Element>
+    Materials: Map<string, Material>
+    Loads: Map<string, Load>
+    Combinations: Map<string, Combination>
+    Constraints: Map<string, Constraint>
+    /// Point masses at nodes.
+    Masses: Map<string, PointMass> option
+    /// Slab panels whose loads are yet to be distributed to beams.
+    Panels: Map<string, Panel> option }
+
+/// <summary>
+/// Serialization formats supported when reading and writing models.
+/// </summary>
+type ModelFormat =
+  | Json
+  | Yaml
+  /// Structural analysis model of an IFC file, which is only read.
+  | Ifc
+  /// STAAD.Pro input file, which is only read.
+  | Staad
+  /// Abaqus input file, which is only read; Gazelle exports them instead.
+  | Abaqus
+  /// Protocol Buffers binary encoding, fastest to read for large models.
+  | Protobuf
+
+/// <summary>
+/// Options controlling how a model is read.
+/// </summary>
+type ReadOptions =
+  {
+    /// Parser to use; detected from the file extension when omitted.
+    Format: ModelFormat option
+    /// Values overriding declared model parameters, e.g. from --set.
+    Parameters: Map<string, string>
+  }
+
+/// <summary>
+/// Errors raised whilst reading or writing a model.
+/// </summary>
+type ModelError =
+  | UnsupportedFormat of string
+  | UnreadableSource of string
+  | MalformedModel of string
+  | UnresolvedReference of location: string * reason: string
+  | CyclicReference of chain: string list
+  | UnresolvedParameter of location: string * name: string
+  | UnknownParameter of name: string
+  | InvalidPart of part: string * reason: string
+  | InvalidInterface of id: string * reason: string
+
+/// <summary>
+/// Functions for naming and detecting model serialization formats.
+/// </summary>
+[<RequireQualifiedAccess>]
+module ModelFormat =
+
+  /// <summary>
+  /// Parses a user-supplied format name, e.g. from --input-format.
+  /// </summary>
+  /// <param name="name">Format name, case-insensitive.</param>
+  /// <returns>Matching format or UnsupportedFormat error.</returns>
+  let tryParse (name: string) : Result<ModelFormat, ModelError> =
+    match name.Trim().ToLowerInvariant() with
+    | "json" -> Ok Json
+    | "yaml"
+    | "yml" -> Ok Yaml
+    | "ifc" -> Ok Ifc
+    | "std"
+    | "staad" -> Ok Staad
+    | "inp"
+    | "abaqus" -> Ok Abaqus
+    | "pb"
+    | "protobuf" -> Ok Protobuf
+    | other -> Error(UnsupportedFormat $"'{other}' is not a known format")
+
+  /// <summary>
+  /// Detects the format of a model file from its extension.
+  /// </summary>
+  /// <param name="path">Path to model file.</param>
+  /// <returns>Matching format or UnsupportedFormat error.</returns>
+  let fromPath (path: string) : Result<ModelFormat, ModelError> =
+    match Path.GetExtension(path).ToLowerInvariant() with
+    | ".json" -> Ok Json
+    | ".yaml"
+    | ".yml" -> Ok Yaml
+    | ".ifc" -> Ok Ifc
+    | ".std" -> Ok Staad
+    | ".inp" -> Ok Abaqus
+    | ".pb" -> Ok Protobuf
+    | "" -> Error(UnsupportedFormat $"cannot detect format of '{path}'")
+    | ext -> Error(UnsupportedFormat $"unrecognised extension '{ext}'")
+
+[<RequireQualifiedAccess>]
+module ModelError =
+
+  let getAsString (e: ModelError) : string =
+    match e with
+    | UnsupportedFormat msg -> $"Unsupported Format: {msg}."
+    | UnreadableSource msg -> $"Unreadable Source: {msg}."
+    | MalformedModel msg -> $"Malformed Model: {msg}."
+    | UnresolvedReference(location, reason) ->
+      $"Unresolved Reference: {reason} at {location}."
+    | CyclicReference chain ->
+      let path = String.Join(" -> ", chain)
+      $"Cyclic Reference: {path}."
+    | UnresolvedParameter(location, name) ->
+      $"Unresolved Parameter: '{name}' has no value at {location}."
+    | UnknownParameter name ->
+      $"Unknown Parameter: '{name}' is not declared by the model."
+    | InvalidPart(part, reason) -> $"Invalid Part: '{part}' {reason}."
+    | InvalidInterface(id, reason) -> $"Invalid Interface: '{id}' {reason}."
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+
+/// <summary>
+/// Consistent system of units in which model quantities are expressed.
+/// Time is in seconds and mass is derived from force and length, so that
+/// force = mass × acceleration holds without further factors.
+/// </summary>
+type UnitSystem =
+  {
+    /// Name stored in ModelInfo.Units, e.g. "kN-m".
+    Name: string
+    /// Length unit in metres.
+    Length: float
+    /// Force unit in newtons.
+    Force: float
+  }
+
+/// <summary>
+/// Errors raised whilst converting a model between unit systems.
+/// </summary>
+type ConversionError =
+  | UnknownUnitSystem of name: string * available: string list
+  | UnknownProperty of element: string * property: string
+
+[<RequireQualifiedAccess>]
+module ConversionError =
+
+  let getAsString (e: ConversionError) : string =
+    match e with
+    | UnknownUnitSystem(name, available) ->
+      let names = String.Join(", ", available)
+      $"Unknown unit system '{name}'. Available: {names}."
+    | UnknownProperty(element, property) ->
+      $"Element '{element}' has property '{property}' of unknown dimension."
+
+[<RequireQualifiedAccess>]
+module UnitSystem =
+
+  let private inch = 0.0254
+  let private foot = 0.3048
+  let private poundForce = 4.4482216152605
+
+  /// Supported unit systems; "SI" is newtons and metres.
+  let all =
+    [ { Name = "SI"; Length = 1.0; Force = 1.0 }
+      { Name = "kN-m"; Length = 1.0; Force = 1e3 }
+      { Name = "N-mm"; Length = 1e-3; Force = 1.0 }
+      { Name = "kN-mm"; Length = 1e-3; Force = 1e3 }
+      { Name = "lb-in"; Length = inch; Force = poundForce }
+      { Name = "lb-ft"; Length = foot; Force = poundForce }
+      { Name = "kip-in"; Length = inch; Force = 1e3 * poundForce }
+      { Name = "kip-ft"; Length = foot; Force = 1e3 * poundForce } ]
+
+  /// Length and force exponents of element properties, by property name.
+  let private propertyDimensions =
+    Map
+      [ for p in [ "k"; "ky"; "kz" ] do
+          p, (0, 0)
+        for p in [ "b"; "d"; "h"; "t"; "width"; "depth"; "thickness" ] do
+          p, (1, 0)
+        for p in [ "a"; "area"; "ay"; "az" ] do
+          p, (2, 0)
+        for p in [ "sy"; "sz"; "zy"; "zz" ] do
+          p, (3, 0)
+        for p in [ "i"; "iy"; "iz"; "ix"; "j" ] do
+          p, (4, 0)
+        "pretension", (0, 1)
+        // Exposed surface over volume of steel members, see Fire.
+        "section_factor", (-1, 0)
+        // Plate buckling of cold-formed steel members, see ColdFormed.
+        "flat_width", (1, 0)
+        "k_sigma", (0, 0)
+        // Reinforcement ratios of concrete slabs, see Punching.
+        for p in [ "rho_x"; "rho_y" ] do
+          p, (0, 0)
+        // Stiffness of springs, by degree of freedom.
+        for p in [ "ux"; "uy"; "uz" ] do
+          p, (-1, 1)
+        for p in [ "rx"; "ry"; "rz" ] do
+          p, (1, 1)
+        // Overrides of material defaults, see Materials.
+        for p in [ "elastic_modulus"; "yield_strength"; "shear_modulus" ] do
+          p, (-2, 1)
+        "density", (-4, 1)
+        "damping_ratio", (0, 0)
+        "thermal_expansion", (0, 0) ]
+
+  /// <summary>
+  /// Finds a unit system by name.
+  /// </summary>
+  /// <param name="name">Unit system name, case-insensitive.</param>
+  /// <returns>Matching unit system or UnknownUnitSystem error.</returns>
+  let tryFind (name: string) : Result<UnitSystem, ConversionError> =
+    let matches (u: UnitSystem) =
+      String.Equals(u.Name, name.Trim(), StringComparison.OrdinalIgnoreCase)
+
+    match List.tryFind matches all with
+    | Some u -> Ok u
+    | None -> Error(UnknownUnitSystem(name, all |> List.map (fun u -> u.Name)))
+
+  /// <summary>
+  /// Returns the factor converting a quantity between unit systems.
+  /// </summary>
+  /// <param name="source">Unit system the quantity is expressed in.</param>
+  /// <param name="target">Unit system to express the quantity in.</param>
+  /// <param name="length">Length exponent of the quantity.</param>
+  /// <param name="force">Force exponent of the quantity.</param>
+  /// <returns>Multiplier to apply to the quantity.</returns>
+  let factor
+    (source: UnitSystem)
+    (target: UnitSystem)
+    (length: int)
+    (force: int)
+    : float =
+    (source.Length / target.Length) ** float length
+    * (source.Force / target.Force) ** float force
+
+  /// <summary>
+  /// Converts every quantity in a model to another unit system and updates
+  /// ModelInfo.Units.
+  /// </summary>
+  /// <param name="target">Unit system to convert to.</param>
+  /// <param name="m">Model expressed in the system named by its units.</param>
+  /// <returns>Converted model or ConversionError.</returns>
+  /// <remarks>
+  /// Declared parameters are left unchanged as their dimensions are unknown.
+  /// </remarks>
+  let convert (target: UnitSystem) (m: Model) : Result<Model, ConversionError> =
+    tryFind m.Info.Units
+    |> Result.bind (fun source ->
+      let scale length force (x: float) = x * factor source target length force
+      let length = scale 1 0
+      let stress = scale -2 1
+      // Mass is force / acceleration, so density is force / length^4.
+      let density = scale -4 1
+
+      let convertProperties id (properties: Map<string, float>) =
+        properties
+        |> Map.toList
+        |> List.fold
+          (fun acc (name, value) ->
+            match acc, propertyDimensions.TryFind(name.ToLowerInvariant()) with
+            | Ok ps, Some(n, f) -> Ok(Map.add name (scale n f value) ps)
+            | Ok _, None -> Error(UnknownProperty(id, name))
+            | Error e, _ -> Error e)
+          (Ok Map.empty)
+
+      let elements =
+        m.Elements
+        |> Map.toList
+        |> List.fold
+          (fun acc (id, e) ->
+            match acc, e.Properties with
+            | Error e, _ -> Error e
+            | Ok es, None -> Ok(Map.add id e es)
+            | Ok es, Some ps ->
+              convertProperties id ps
+              |> Result.map (fun ps ->
+                Map.add id { e with Properties = Some ps } es))
+          (Ok Map.empty)
+
+      // Elastic supports share the dimensions of spring properties.
+      let constraints =
+        m.Constraints
+        |> Map.toList
+        |> List.fold
+          (fun acc (id, c) ->
+            match acc, c.Stiffness with
+            | Error e, _ -> Error e
+            | Ok cs, None -> Ok(Map.add id c cs)
+            | Ok cs, Some ks ->
+              convertProperties id ks
+              |> Result.map (fun ks ->
+                Map.add id { c with Stiffness = Some ks } cs))
+          (Ok Map.empty)
+        // Prescribed translations are lengths; rotations are unitless.
+        |> Result.map (
+          Map.map (fun _ c ->
+            let settle (name: string) x =
+              if name.StartsWith("U", StringComparison.Ordinal) then
+                length x
+              else
+                x
+
+            { c with
+                Displacement = c.Displacement |> Option.map (Map.map settle) })
+        )
+
+      let convertLoad (l: Load) =
+        let lengthExponent =
+          match l.Type with
+          | "SelfWeight" -> 0
+          | "Distributed" -> -1
+          | "Pressure" -> -2
+          | "Hydrostatic" -> -3
+          | _ when l.Direction.StartsWith("M", StringComparison.Ordinal) -> 1
+          | _ -> 0
+
+        // Temperatures are the same in every unit system, and self-weight
+        // is a multiple of gravity.
+        let forceExponent =
+          match l.Type with
+          | "Thermal"
+          | "SelfWeight" -> 0
+          | _ -> 1
+
+        { l with
+            Magnitude = scale lengthExponent forceExponent l.Magnitude
+            EndMagnitude =
+              Option.map (scale lengthExponent forceExponent) l.EndMagnitude
+            Datum = Option.map length l.Datum
+            Gradient = Option.map (scale -1 0) l.Gradient }
+
+      // Mass is force / acceleration, and rotary inertia mass × length².
+      let convertMass (x: PointMass) =
+        { x with
+            Mass = scale -1 1 x.Mass
+            Inertia = x.Inertia |> Option.map (Map.map (fun _ -> scale 1 1)) }
+
+      // Panel loads are pressures.
+      let convertPanel (p: Panel) =
+        { p with Loads = p.Loads |> Map.map (fun _ q -> scale -2 1 q) }
+
+      match elements, constraints with
+      | Error e, _
+      | _, Error e -> Error e
+      | Ok elements, Ok constraints ->
+        Ok
+          { m with
+              Info = { m.Info with Units = target.Name }
+              Gravity =
+                m.Gravity
+                |> Option.map (fun g -> { g with Magnitude = length g.Magnitude })
+              Nodes =
+                m.Nodes
+                |> Map.map (fun _ n ->
+                  { n with
+                      X = length n.X
+                      Y = length n.Y
+                      Z = length n.Z })
+              Elements = elements
+              Materials =
+                m.Materials
+                |> Map.map (fun _ x ->
+                  { x with
+                      ElasticModulus = stress x.ElasticModulus
+                      Density = Option.map density x.Density
+                      YieldStrength = Option.map stress x.YieldStrength
+                      ShearModulus = Option.map stress x.ShearModulus })
+              Loads = m.Loads |> Map.map (fun _ l -> convertLoad l)
+              Constraints = constraints
+              Masses =
+                m.Masses |> Option.map (Map.map (fun _ x -> convertMass x))
+              Panels =
+                m.Panels |> Option.map (Map.map (fun _ p -> convertPanel p)) })
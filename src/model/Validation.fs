@@ -0,0 +1,771 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+/// <summary>
+/// Defects that make a model unfit for analysis.
+/// </summary>
+type ValidationError =
+  | KeyMismatch of collection: string * key: string * id: string
+  | DanglingNode of owner: string * node: string
+  | DanglingElement of owner: string * element: string
+  | DanglingMaterial of element: string * material: string
+  | InvalidMaterial of element: string * reason: string
+  | InvalidLoad of load: string * reason: string
+  | InactiveDof of load: string * dof: Dof
+  | InvalidGravity
+  | InvalidDamping of reason: string
+  | InvalidTimeHistory of reason: string
+  | TooFewNodes of element: string * count: int
+  | ZeroLength of element: string
+  | InvalidSpring of owner: string * reason: string
+  | InvalidLink of element: string * reason: string
+  | InvalidRelease of element: string * reason: string
+  | InvalidSettlement of support: string * reason: string
+  | InvalidRestraint of support: string * reason: string
+  | InvalidPanel of panel: string * reason: string
+  | InvalidMass of mass: string * reason: string
+  | InvalidDimensions of dimensions: int
+  | DimensionMismatch of owner: string * reason: string
+  | UndefinedCase of combination: string * case: string
+
+/// <summary>
+/// Suspicious but analysable model features.
+/// </summary>
+type ValidationWarning =
+  | OrphanNode of node: string
+  | NoConstraints
+  | NoLoads
+  | UndistributedPanel of panel: string
+  | InactiveRestraint of support: string * dof: Dof
+  | UnsupportedPart of nodes: string list
+  | Underconstrained of freedoms: int
+
+/// <summary>
+/// Outcome of validating a model.
+/// </summary>
+type ValidationReport =
+  { Errors: ValidationError list
+    Warnings: ValidationWarning list }
+
+[<RequireQualifiedAccess>]
+module ValidationError =
+
+  let getAsString (e: ValidationError) : string =
+    match e with
+    | KeyMismatch(collection, key, id) ->
+      $"{collection} '{key}' declares a different id '{id}'."
+    | DanglingNode(owner, node) ->
+      $"'{owner}' references node '{node}' which does not exist."
+    | DanglingElement(owner, element) ->
+      $"'{owner}' references element '{element}' which does not exist."
+    | DanglingMaterial(element, material) ->
+      $"'{element}' references material '{material}' which does not exist."
+    | InvalidMaterial(element, reason) -> $"Element '{element}' {reason}."
+    | InvalidLoad(load, reason) -> $"Load '{load}' {reason}."
+    | InactiveDof(load, dof) ->
+      let name = Dof.getAsString dof
+      $"Load '{load}' acts along {name} which its elements do not provide."
+    | InvalidGravity ->
+      "Gravity direction must be a non-zero vector of 3 components."
+    | InvalidDamping reason -> $"Damping {reason}."
+    | InvalidTimeHistory reason -> $"Time history {reason}."
+    | TooFewNodes(element, count) ->
+      $"Element '{element}' connects {count} node(s); at least 2 required."
+    | ZeroLength element ->
+      $"Element '{element}' has zero length; its nodes coincide."
+    | InvalidSpring(owner, reason) -> $"Spring '{owner}' {reason}."
+    | InvalidLink(element, reason) -> $"Rigid link '{element}' {reason}."
+    | InvalidRelease(element, reason) -> $"Element '{element}' {reason}."
+    | InvalidSettlement(support, reason)
+    | InvalidRestraint(support, reason) -> $"Constraint '{support}' {reason}."
+    | InvalidPanel(panel, reason) -> $"Panel '{panel}' {reason}."
+    | InvalidMass(mass, reason) -> $"Point mass '{mass}' {reason}."
+    | InvalidDimensions dimensions ->
+      $"Model dimensions {dimensions} must be 2 or 3."
+    | DimensionMismatch(owner, reason) -> $"'{owner}' {reason}."
+    | UndefinedCase(combination, case) ->
+      $"Combination '{combination}' references undefined load case '{case}'."
+
+  /// <summary>
+  /// Returns the ID of the entity an error is reported against, e.g. to
+  /// place it in an editor.
+  /// </summary>
+  /// <param name="e">Validation error.</param>
+  /// <returns>Entity ID, or None for model-wide errors.</returns>
+  let subject (e: ValidationError) : string option =
+    match e with
+    | KeyMismatch(_, key, _) -> Some key
+    | DanglingNode(owner, _)
+    | DanglingElement(owner, _) -> Some owner
+    | DanglingMaterial(element, _)
+    | InvalidMaterial(element, _) -> Some element
+    | InvalidLoad(load, _)
+    | InactiveDof(load, _) -> Some load
+    | TooFewNodes(element, _)
+    | ZeroLength element -> Some element
+    | InvalidSpring(owner, _) -> Some owner
+    | InvalidSettlement(support, _)
+    | InvalidRestraint(support, _) -> Some support
+    | InvalidLink(element, _)
+    | InvalidRelease(element, _) -> Some element
+    | InvalidPanel(panel, _) -> Some panel
+    | InvalidMass(mass, _) -> Some mass
+    | DimensionMismatch(owner, _) -> Some owner
+    | UndefinedCase(combination, _) -> Some combination
+    | InvalidGravity
+    | InvalidDimensions _
+    | InvalidDamping _
+    | InvalidTimeHistory _ -> None
+
+[<RequireQualifiedAccess>]
+module ValidationWarning =
+
+  let getAsString (w: ValidationWarning) : string =
+    match w with
+    | OrphanNode node -> $"Node '{node}' is not connected to any element."
+    | NoConstraints -> "Model has no constraints; it cannot resist loads."
+    | NoLoads -> "Model has no loads."
+    | UndistributedPanel panel ->
+      $"Panel '{panel}' loads no beams until distributed by tributary area."
+    | InactiveRestraint(support, dof) ->
+      let name = Dof.getAsString dof
+      $"Constraint '{support}' restrains {name} which its node's elements "
+      + "do not provide."
+    | UnsupportedPart nodes ->
+      let shown = List.truncate 5 nodes |> String.concat "', '"
+      let more =
+        if nodes.Length > 5 then $" and {nodes.Length - 5} more" else ""
+      match nodes with
+      | [ node ] ->
+        $"Node '{node}' connects to no constraint; it is free to move."
+      | _ ->
+        $"Nodes '{shown}'{more} connect to no constraint; "
+        + "they are free to move."
+    | Underconstrained freedoms ->
+      $"Model has {freedoms} more freedom(s) than member forces and "
+      + "reactions to hold them; it is a mechanism."
+
+  /// <summary>
+  /// Returns the ID of the entity a warning is reported against.
+  /// </summary>
+  /// <param name="w">Validation warning.</param>
+  /// <returns>Entity ID, or None for model-wide warnings.</returns>
+  let subject (w: ValidationWarning) : string option =
+    match w with
+    | OrphanNode node -> Some node
+    | UndistributedPanel panel -> Some panel
+    | InactiveRestraint(support, _) -> Some support
+    | UnsupportedPart nodes -> List.tryHead nodes
+    | Underconstrained _
+    | NoConstraints
+    | NoLoads -> None
+
+[<RequireQualifiedAccess>]
+module Validation =
+
+  /// Checks that each entity's Id matches the key it is stored under.
+  let private keysMatchIds (m: Model) : ValidationError list =
+    let check collection (entries: Map<string, 'T>) (getId: 'T -> string) =
+      entries
+      |> Map.toList
+      |> List.choose (fun (key, entity) ->
+        match getId entity with
+        | id when id <> key -> Some(KeyMismatch(collection, key, id))
+        | _ -> None)
+
+    [ yield! check "Node" m.Nodes (fun n -> n.Id)
+      yield! check "Element" m.Elements (fun e -> e.Id)
+      yield! check "Material" m.Materials (fun x -> x.Id)
+      yield! check "Load" m.Loads (fun l -> l.Id)
+      yield! check "Combination" m.Combinations (fun c -> c.Id)
+      yield! check "Constraint" m.Constraints (fun c -> c.Id)
+      yield! check "Mass" (defaultArg m.Masses Map.empty) (fun x -> x.Id)
+      yield! check "Panel" (defaultArg m.Panels Map.empty) (fun p -> p.Id) ]
+
+  /// Checks that elements, loads, constraints, point masses and panels
+  /// reference existing nodes.
+  let private nodesExist (m: Model) : ValidationError list =
+    let dangling owner nodes =
+      nodes
+      |> List.filter (fun n -> not (m.Nodes.ContainsKey n))
+      |> List.map (fun n -> DanglingNode(owner, n))
+
+    [ for KeyValue(id, e) in m.Elements do
+        yield! dangling id e.Nodes
+      for KeyValue(id, l) in m.Loads do
+        yield! dangling id (Option.toList l.Node)
+      for KeyValue(id, c) in m.Constraints do
+        yield! dangling id [ c.Node ]
+      for KeyValue(id, x) in defaultArg m.Masses Map.empty do
+        yield! dangling id [ x.Node ]
+      for KeyValue(id, p) in defaultArg m.Panels Map.empty do
+        yield! dangling id p.Nodes ]
+
+  /// Checks that elements reference existing materials, and that their
+  /// overrides of material defaults are positive.
+  let private materialsExist (m: Model) : ValidationError list =
+    let positive = [ "elastic_modulus"; "density"; "yield_strength" ]
+
+    [ for KeyValue(id, e) in m.Elements do
+        if
+          Materials.isRequired e && not (m.Materials.ContainsKey e.Material)
+        then
+          DanglingMaterial(id, e.Material)
+
+        let properties = Option.defaultValue Map.empty e.Properties
+
+        for name in positive do
+          match properties.TryFind name with
+          | Some value when value <= 0.0 ->
+            InvalidMaterial(id, $"overrides {name} with {value}; must be > 0")
+          | _ -> () ]
+
+  /// Checks that every element connects at least two nodes, or one for a
+  /// spring to ground, and that rigid links tie each node once.
+  let private elementsConnect (m: Model) : ValidationError list =
+    m.Elements
+    |> Map.toList
+    |> List.choose (fun (id, e) ->
+      match List.length e.Nodes with
+      | 1 when e.Type = "Spring" -> None
+      | n when n < 2 -> Some(TooFewNodes(id, n))
+      | n when n > 2 && e.Type = "Spring" ->
+        Some(InvalidSpring(id, $"connects {n} nodes; at most 2 allowed"))
+      | _ when e.Type = "RigidLink" && List.distinct e.Nodes <> e.Nodes ->
+        Some(InvalidLink(id, "ties a node to itself"))
+      | _ -> None)
+
+  /// Checks that members do not start and end at the same point, which
+  /// leaves them no direction.
+  let private membersHaveLength (m: Model) : ValidationError list =
+    [ for KeyValue(id, e) in m.Elements do
+        match e.Type, List.map m.Nodes.TryFind e.Nodes with
+        | ("Spring" | "RigidLink"), _ -> ()
+        | _, [ Some a; Some b ] when a.X = b.X && a.Y = b.Y && a.Z = b.Z ->
+          ZeroLength id
+        | _ -> () ]
+
+  /// Checks that springs and elastic supports give a non-negative
+  /// stiffness along known degrees of freedom: "ux" to "rz" for springs
+  /// and "Ux" to "Rz" for supports.
+  let private springsAreValid (m: Model) : ValidationError list =
+    let check id parse (stiffness: Map<string, float>) =
+      [ for KeyValue(name, k) in stiffness do
+          match parse name with
+          | None -> InvalidSpring(id, $"has unknown degree of freedom '{name}'")
+          | Some _ when k < 0.0 ->
+            InvalidSpring(id, $"has negative stiffness {k} along {name}")
+          | Some _ -> () ]
+
+    let lower name =
+      Dof.all
+      |> List.tryFind (fun d -> (Dof.getAsString d).ToLowerInvariant() = name)
+
+    [ for KeyValue(id, e) in m.Elements do
+        if e.Type = "Spring" then
+          let properties = Option.defaultValue Map.empty e.Properties
+
+          if properties.IsEmpty then
+            InvalidSpring(id, "needs a stiffness along a degree of freedom")
+
+          yield! check id lower properties
+      for KeyValue(id, c) in m.Constraints do
+        yield! check id Dof.tryParse (defaultArg c.Stiffness Map.empty) ]
+
+  /// Checks that end releases name an end node of a beam or frame member
+  /// and freedoms the member has.
+  let private releasesAreValid (m: Model) : ValidationError list =
+    let members = set [ "Beam2D"; "Frame2D"; "Beam3D"; "Frame3D" ]
+
+    [ for KeyValue(id, e) in m.Elements do
+        let releases = defaultArg e.Releases Map.empty
+
+        if not releases.IsEmpty && not (members.Contains e.Type) then
+          InvalidRelease(id, $"is a {e.Type}, whose ends cannot be released")
+        else
+          let dofs = Dof.ofElementType e.Type |> Option.defaultValue []
+
+          for KeyValue(node, names) in releases do
+            if not (List.contains node e.Nodes) then
+              InvalidRelease(id, $"releases node '{node}' it does not connect")
+
+            for name in names do
+              match Dof.tryParse name with
+              | Some dof when List.contains dof dofs -> ()
+              | _ ->
+                InvalidRelease(id, $"cannot release '{name}' at '{node}'") ]
+
+  /// Checks that prescribed displacements name freedoms their constraint
+  /// restrains.
+  let private settlementsAreValid (m: Model) : ValidationError list =
+    [ for KeyValue(id, c) in m.Constraints do
+        for KeyValue(name, _) in defaultArg c.Displacement Map.empty do
+          match Dof.tryParse name with
+          | None ->
+            InvalidSettlement(id, $"has unknown degree of freedom '{name}'")
+          | Some _ when not (List.contains name c.Dof) ->
+            let reason = $"prescribes '{name}' but does not restrain it"
+            InvalidSettlement(id, reason)
+          | Some _ -> () ]
+
+  /// Checks that constraints restrain known degrees of freedom, suggesting
+  /// the intended one for a load direction or a name in the wrong case.
+  let private restraintsAreValid (m: Model) : ValidationError list =
+    let suggest (name: string) =
+      let lower = name.ToLowerInvariant()
+      let sameName d = (Dof.getAsString d).ToLowerInvariant() = lower
+
+      match Dof.ofDirection name, List.tryFind sameName Dof.all with
+      | Some d, _
+      | None, Some d -> $"; did you mean '{Dof.getAsString d}'?"
+      | None, None -> ""
+
+    [ for KeyValue(id, c) in m.Constraints do
+        for name in c.Dof do
+          if (Dof.tryParse name).IsNone then
+            let reason = $"has unknown degree of freedom '{name}'"
+            InvalidRestraint(id, reason + suggest name) ]
+
+  let private isSurface (l: Load) =
+    l.Type = "Pressure" || l.Type = "Hydrostatic"
+
+  let private isPlate (e: Element) = e.Type = "Plate" || e.Type = "Shell"
+
+  /// Members that carry axial force alone.
+  let private isAxial (e: Element) =
+    e.Type.StartsWith "Truss" || e.Type = "Cable" || e.Type = "Strut"
+
+  /// Checks that each load acts on a node, a member at a position along
+  /// it, over a part of it or through its temperature, or a plate for
+  /// surface loads.
+  let private loadsAttach (m: Model) : ValidationError list =
+    [ for KeyValue(id, l) in m.Loads do
+        match l.Node, l.Element with
+        | None, None when l.Type = "SelfWeight" -> ()
+        | _ when l.Type = "SelfWeight" ->
+          InvalidLoad(id, "is self-weight so acts on every element")
+        | Some _, None when not (isSurface l) -> ()
+        | None, Some element when l.Type = "Force" ->
+          match m.Elements.TryFind element, l.Position with
+          | None, _ -> DanglingElement(id, element)
+          | Some e, _ when isPlate e || e.Nodes.Length <> 2 ->
+            InvalidLoad(id, $"acts on '{element}' which is not a member")
+          | Some _, Some p when p >= 0.0 && p <= 1.0 -> ()
+          | Some _, _ -> InvalidLoad(id, "needs a position between 0 and 1")
+        | None, Some element when l.Type = "Thermal" ->
+          let expansion =
+            m.Elements.TryFind element
+            |> Option.bind (Materials.ofElement m)
+            |> Option.bind (fun x -> x.ThermalExpansion)
+
+          match m.Elements.TryFind element with
+          | None -> DanglingElement(id, element)
+          | Some e when
+            isPlate e || e.Nodes.Length <> 2 || not (Materials.isRequired e)
+            ->
+            InvalidLoad(id, $"acts on '{element}' which is not a member")
+          | Some e when l.Gradient.IsSome && isAxial e ->
+            InvalidLoad(id, $"has a gradient but '{element}' cannot bend")
+          | Some _ when expansion.IsNone ->
+            InvalidLoad(id, $"needs the thermal expansion of '{element}'")
+          | Some _ -> ()
+        | None, Some element when l.Type = "Distributed" ->
+          let start = defaultArg l.Position 0.0
+          let finish = defaultArg l.End 1.0
+
+          match m.Elements.TryFind element with
+          | None -> DanglingElement(id, element)
+          | Some e when isPlate e || e.Nodes.Length <> 2 ->
+            InvalidLoad(id, $"acts on '{element}' which is not a member")
+          | Some _ when start >= 0.0 && start < finish && finish <= 1.0 -> ()
+          | Some _ ->
+            InvalidLoad(id, "needs 0 <= position < end <= 1 along the member")
+        | None, Some element when isSurface l ->
+          match m.Elements.TryFind element with
+          | None -> DanglingElement(id, element)
+          | Some e when not (isPlate e) ->
+            InvalidLoad(id, $"acts on '{element}' which is not a plate")
+          | Some e when e.Nodes.Length <> 3 && e.Nodes.Length <> 4 ->
+            InvalidLoad(id, $"acts on '{element}' which needs 3 or 4 nodes")
+          | Some _ when l.Type = "Hydrostatic" && l.Datum.IsNone ->
+            InvalidLoad(id, "is hydrostatic but has no datum")
+          | Some _ -> ()
+        | _ when isSurface l -> InvalidLoad(id, "must act on an element")
+        | _ -> InvalidLoad(id, "must act on a node") ]
+
+  /// Checks that load directions are known and act along degrees of
+  /// freedom provided by the loaded node's elements or the loaded member.
+  let private loadsMatchDofs (m: Model) : ValidationError list =
+    let isTranslation dof = List.contains dof [ Ux; Uy; Uz ]
+    let allowed = Dof.ofDimensions m
+
+    [ for KeyValue(id, l) in m.Loads do
+        let element = l.Element |> Option.bind m.Elements.TryFind
+
+        match l.Direction, Dof.ofDirection l.Direction, element with
+        | "Normal", _, _ when isSurface l -> ()
+        | "Gravity", _, _ when l.Type = "SelfWeight" -> ()
+        | "Temperature", _, _ when l.Type = "Thermal" -> ()
+        | d, None, _ -> InvalidLoad(id, $"has unknown direction '{d}'")
+        | _, Some dof, _ when not (List.contains dof allowed) -> ()
+        | _, Some dof, Some _ when not (isTranslation dof) ->
+          InvalidLoad(id, "on an element must act along Fx, Fy or Fz")
+        | _, Some dof, _ ->
+          let available =
+            match l.Node, element with
+            | Some node, _ -> Dof.ofNode m node
+            | None, Some e -> Dof.ofElementType e.Type
+            | None, None -> None
+
+          match available with
+          | Some dofs when not (List.contains dof dofs) -> InactiveDof(id, dof)
+          | _ -> () ]
+
+  /// Checks that a model conforms to its declared dimensions: a 2D model
+  /// lies in the XY plane, holds no space members or plates, and restrains
+  /// and loads only Ux, Uy and Rz; a 3D model holds no plane members.
+  let private dimensionsConform (m: Model) : ValidationError list =
+    let outside = "out of the plane of a 2D model"
+
+    match m.Info.Dimensions with
+    | None -> []
+    | Some d when d <> 2 && d <> 3 -> [ InvalidDimensions d ]
+    | Some d ->
+      let plane = d = 2
+
+      let misfits (e: Element) =
+        if plane then
+          e.Type.EndsWith "3D" || isPlate e
+        else
+          e.Type.EndsWith "2D"
+
+      [ for KeyValue(id, e) in m.Elements do
+          if misfits e then
+            let reason = $"is a {e.Type}, which a {d}D model cannot hold"
+            DimensionMismatch(id, reason)
+        if plane then
+          for KeyValue(id, n) in m.Nodes do
+            if n.Z <> 0.0 then
+              DimensionMismatch(id, $"lies at z = {n.Z}, {outside}")
+          for KeyValue(id, c) in m.Constraints do
+            let stiffness = defaultArg c.Stiffness Map.empty
+            let names = c.Dof @ List.ofSeq stiffness.Keys |> List.distinct
+
+            for dof in List.choose Dof.tryParse names do
+              if not (List.contains dof Dof.plane) then
+                let name = Dof.getAsString dof
+                DimensionMismatch(id, $"restrains {name}, {outside}")
+          for KeyValue(id, l) in m.Loads do
+            match Dof.ofDirection l.Direction with
+            | Some dof when not (List.contains dof Dof.plane) ->
+              DimensionMismatch(id, $"acts along {l.Direction}, {outside}")
+            | _ -> ()
+          for KeyValue(id, x) in defaultArg m.Masses Map.empty do
+            let names = defaultArg x.Inertia Map.empty |> Map.keys
+
+            for dof in names |> Seq.choose Dof.tryParse do
+              if not (List.contains dof Dof.plane) then
+                let name = Dof.getAsString dof
+                DimensionMismatch(id, $"has inertia about {name}, {outside}") ]
+
+  /// Checks that a declared gravity direction is a usable vector.
+  let private gravityIsValid (m: Model) : ValidationError list =
+    match m.Gravity |> Option.map Gravity.acceleration with
+    | Some None -> [ InvalidGravity ]
+    | _ -> []
+
+  /// Checks that damping ratios lie in [0, 1) and modes are numbered from 1.
+  let private dampingIsValid (m: Model) : ValidationError list =
+    let isRatio r = r >= 0.0 && r < 1.0
+
+    [ for KeyValue(id, x) in m.Materials do
+        match x.DampingRatio with
+        | Some r when not (isRatio r) ->
+          InvalidDamping $"ratio {r} of material '{id}' is not in [0, 1)"
+        | _ -> ()
+      for KeyValue(id, e) in m.Elements do
+        let ratio =
+          e.Properties |> Option.bind (fun ps -> ps.TryFind "damping_ratio")
+
+        match ratio with
+        | Some r when not (isRatio r) ->
+          InvalidDamping $"ratio {r} of element '{id}' is not in [0, 1)"
+        | _ -> ()
+      match m.Damping with
+      | None -> ()
+      | Some d ->
+        match d.Ratio with
+        | Some r when not (isRatio r) ->
+          InvalidDamping $"ratio {r} is not in [0, 1)"
+        | _ -> ()
+
+        for KeyValue(mode, r) in Option.defaultValue Map.empty d.Modes do
+          match System.Int32.TryParse mode with
+          | true, n when n >= 1 && isRatio r -> ()
+          | true, n when n >= 1 ->
+            InvalidDamping $"ratio {r} of mode {n} is not in [0, 1)"
+          | _ -> InvalidDamping $"mode '{mode}' is not a number from 1"
+
+        match d.Rayleigh with
+        | Some r when r.Mass < 0.0 || r.Stiffness < 0.0 ->
+          InvalidDamping "Rayleigh coefficients must not be negative"
+        | _ -> () ]
+
+  /// Checks the time step and duration are positive and each load history
+  /// names a load case and pairs ascending times with factors.
+  let private timeHistoryIsValid (m: Model) : ValidationError list =
+    let defined = LoadCases.cases m |> set
+
+    match m.TimeHistory with
+    | None -> []
+    | Some h ->
+      [ if h.TimeStep <= 0.0 then
+          InvalidTimeHistory $"time step {h.TimeStep} must be positive"
+        if h.Duration <= 0.0 then
+          InvalidTimeHistory $"duration {h.Duration} must be positive"
+        for KeyValue(case, x) in h.Cases do
+          let ascending =
+            x.Times |> List.pairwise |> List.forall (fun (a, b) -> a < b)
+
+          if not (defined.Contains case) then
+            InvalidTimeHistory $"case '{case}' has no loads"
+          elif x.Times.IsEmpty || x.Times.Length <> x.Factors.Length then
+            InvalidTimeHistory $"case '{case}' needs one factor per time"
+          elif not ascending then
+            InvalidTimeHistory $"times of case '{case}' must ascend" ]
+
+  /// Checks that panels have a known type and four corners.
+  let private panelsAreValid (m: Model) : ValidationError list =
+    [ for KeyValue(id, p) in defaultArg m.Panels Map.empty do
+        if p.Type <> "OneWay" && p.Type <> "TwoWay" then
+          InvalidPanel(id, $"has unknown type '{p.Type}'")
+
+        if p.Nodes.Length <> 4 then
+          InvalidPanel(id, $"has {p.Nodes.Length} corner(s); 4 required") ]
+
+  /// Checks that point masses and their rotary inertias are not negative,
+  /// and that inertias are about rotational freedoms.
+  let private massesAreValid (m: Model) : ValidationError list =
+    let rotations = [ Rx; Ry; Rz ]
+
+    [ for KeyValue(id, x) in defaultArg m.Masses Map.empty do
+        if x.Mass < 0.0 then
+          InvalidMass(id, $"has mass {x.Mass}; must be >= 0")
+
+        for KeyValue(name, inertia) in defaultArg x.Inertia Map.empty do
+          match Dof.tryParse name with
+          | Some dof when List.contains dof rotations ->
+            if inertia < 0.0 then
+              InvalidMass(id, $"has {name} inertia {inertia}; must be >= 0")
+          | _ ->
+            InvalidMass(id, $"has inertia about '{name}'; use Rx, Ry or Rz") ]
+
+  /// Checks that combinations only factor load cases that have loads.
+  let private casesExist (m: Model) : ValidationError list =
+    let defined = LoadCases.cases m |> set
+
+    [ for KeyValue(id, c) in m.Combinations do
+        for KeyValue(case, _) in c.Factors do
+          if not (defined.Contains case) then
+            UndefinedCase(id, case) ]
+
+  /// Flags restraints of freedoms that no element at the node provides,
+  /// such as Uz in a plane frame, which have no effect.
+  let private inactiveRestraints (m: Model) : ValidationWarning list =
+    [ for KeyValue(id, c) in m.Constraints do
+        match Dof.ofNode m c.Node with
+        | Some provided ->
+          // Freedoms out of a 2D model's plane are errors instead.
+          let inactive dof =
+            List.contains dof (Dof.ofDimensions m)
+            && not (List.contains dof provided)
+
+          for dof in List.choose Dof.tryParse c.Dof do
+            if inactive dof then
+              InactiveRestraint(id, dof)
+        | None -> () ]
+
+  /// Freedoms an element stiffens at its nodes and the independent forces
+  /// it carries between them, or None for an unknown type.
+  let private freedoms (m: Model) (e: Element) : (Dof list * int) option =
+    let allowed = Dof.ofDimensions m
+    let active dofs = List.filter (fun d -> List.contains d allowed) dofs
+    let nodes = e.Nodes |> List.distinct |> List.length
+
+    let released =
+      defaultArg e.Releases Map.empty
+      |> Seq.sumBy (fun (KeyValue(_, names)) ->
+        List.length (List.distinct names))
+
+    let spring =
+      Option.defaultValue Map.empty e.Properties
+      |> Map.keys
+      |> Seq.choose (fun name ->
+        let lower d = (Dof.getAsString d).ToLowerInvariant()
+        Dof.all |> List.tryFind (fun d -> lower d = name))
+      |> List.ofSeq
+      |> active
+
+    let held forces =
+      Dof.ofElementType e.Type
+      |> Option.map (fun dofs -> active dofs, forces - released)
+
+    match e.Type with
+    | "Truss2D"
+    | "Truss3D"
+    | "Cable"
+    | "Strut" -> held 1
+    | "Beam2D" -> held 2
+    | "Frame2D" -> held 3
+    | "Beam3D" -> held 5
+    | "Frame3D" -> held 6
+    | "Plate" ->
+      let dofs = active [ Uz; Rx; Ry ]
+      Some(dofs, (nodes - 1) * dofs.Length)
+    | "Shell"
+    | "RigidLink" ->
+      let dofs = active Dof.all
+      Some(dofs, (nodes - 1) * dofs.Length)
+    | "Spring" -> Some(spring, spring.Length)
+    | _ -> None
+
+  /// Flags parts of the model that no constraint or grounded spring holds,
+  /// and, by counting, models with more freedoms than the member forces and
+  /// reactions that could hold them, which are mechanisms whatever their
+  /// stiffness. A count that balances does not prove a model stable.
+  let private determinacy (m: Model) : ValidationWarning list =
+    let grounded =
+      [ for KeyValue(_, c) in m.Constraints -> c.Node
+        for KeyValue(_, e) in m.Elements do
+          match e.Type, e.Nodes with
+          | "Spring", [ node ] -> yield node
+          | _ -> () ]
+      |> set
+
+    // Nodes joined to each node through shared elements.
+    let neighbours =
+      m.Elements
+      |> Map.toList
+      |> List.collect (fun (_, e) -> [ for a in e.Nodes -> a, e.Nodes ])
+      |> List.groupBy fst
+      |> List.map (fun (node, lists) -> node, List.collect snd lists)
+      |> Map.ofList
+
+    let rec reach (seen: Set<string>) (frontier: string list) =
+      match frontier with
+      | [] -> seen
+      | node :: rest when seen.Contains node -> reach seen rest
+      | node :: rest ->
+        let next = defaultArg (neighbours.TryFind node) []
+        reach (seen.Add node) (next @ rest)
+
+    let parts =
+      neighbours
+      |> Map.keys
+      |> Seq.fold
+        (fun (parts: Set<string> list) node ->
+          if parts |> List.exists (fun p -> p.Contains node) then
+            parts
+          else
+            reach Set.empty [ node ] :: parts)
+        []
+      |> List.rev
+
+    let unsupported =
+      parts
+      |> List.filter (Set.intersect grounded >> Set.isEmpty)
+      |> List.map (Set.toList >> UnsupportedPart)
+
+    let counted =
+      m.Elements
+      |> Map.toList
+      |> List.map (fun (_, e) -> freedoms m e |> Option.map (fun f -> e, f))
+
+    let mechanism =
+      if List.contains None counted then
+        []
+      else
+        let counted = List.choose id counted
+
+        let provided =
+          counted
+          |> List.collect (fun (e, (dofs, _)) ->
+            [ for node in e.Nodes do
+                for dof in dofs -> node, dof ])
+          |> set
+
+        let reactions =
+          [ for KeyValue(_, c) in m.Constraints do
+              let stiffness = defaultArg c.Stiffness Map.empty
+
+              for name in c.Dof @ List.ofSeq stiffness.Keys do
+                match Dof.tryParse name with
+                | Some dof when provided.Contains(c.Node, dof) -> c.Node, dof
+                | _ -> () ]
+          |> set
+
+        let forces = counted |> List.sumBy (fun (_, (_, n)) -> n)
+        let deficit = provided.Count - forces - reactions.Count
+
+        if deficit > 0 then [ Underconstrained deficit ] else []
+
+    if m.Constraints.IsEmpty then [] else unsupported @ mechanism
+
+  /// Flags nodes that no element connects to.
+  let private orphanNodes (m: Model) : ValidationWarning list =
+    let connected =
+      m.Elements |> Map.toSeq |> Seq.collect (fun (_, e) -> e.Nodes) |> set
+
+    m.Nodes
+    |> Map.toList
+    |> List.filter (fun (id, _) -> not (connected.Contains id))
+    |> List.map (fst >> OrphanNode)
+
+  /// <summary>
+  /// Validates a model, reporting every error and warning found.
+  /// </summary>
+  /// <param name="m">Model to validate.</param>
+  /// <returns>Report listing errors and warnings.</returns>
+  let validate (m: Model) : ValidationReport =
+    { Errors =
+        keysMatchIds m
+        @ nodesExist m
+        @ materialsExist m
+        @ elementsConnect m
+        @ membersHaveLength m
+        @ springsAreValid m
+        @ releasesAreValid m
+        @ restraintsAreValid m
+        @ settlementsAreValid m
+        @ loadsAttach m
+        @ loadsMatchDofs m
+        @ dimensionsConform m
+        @ panelsAreValid m
+        @ massesAreValid m
+        @ casesExist m
+        @ gravityIsValid m
+        @ dampingIsValid m
+        @ timeHistoryIsValid m
+      Warnings =
+        [ yield! orphanNodes m
+          yield! inactiveRestraints m
+          yield! determinacy m
+          if m.Constraints.IsEmpty then
+            NoConstraints
+          if m.Loads.IsEmpty then
+            NoLoads
+          for KeyValue(id, _) in defaultArg m.Panels Map.empty do
+            UndistributedPanel id ] }
+
+  /// <summary>
+  /// Indicates whether a report passes, optionally treating warnings as
+  /// failures.
+  /// </summary>
+  /// <param name="strict">Whether warnings also fail validation.</param>
+  /// <param name="report">Validation report.</param>
+  /// <returns>True when the report passes.</returns>
+  let passes (strict: bool) (report: ValidationReport) : bool =
+    report.Errors.IsEmpty && (not strict || report.Warnings.IsEmpty)
@@ -0,0 +1,427 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.IO
+open System.Text.Json
+open System.Text.Json.Nodes
+
+/// <summary>
+/// Axle of a vehicle, or wheel of a crane along its rail.
+/// </summary>
+type Axle =
+  {
+    /// Distance behind the axle in front; omitted for the leading axle.
+    Spacing: float option
+    /// Load of the axle, acting along gravity.
+    Load: float
+  }
+
+/// <summary>
+/// Train of axle or wheel loads that travels along a path of members.
+/// </summary>
+type Vehicle =
+  { Id: string
+    Name: string
+    /// Values the axles may reference as <c>${NAME}</c> placeholders,
+    /// e.g. a variable axle spacing.
+    Parameters: Map<string, float> option
+    /// Axles from the front of the vehicle to the back.
+    Axles: Axle list }
+
+/// <summary>
+/// Errors raised whilst reading vehicles or placing them on a model.
+/// </summary>
+type VehicleError =
+  | UnknownVehicle of id: string * available: string list
+  | InvalidVehicle of id: string * reason: string
+  | InvalidLibrary of reason: string
+  | InvalidPath of reason: string
+  | CaseTaken of name: string
+
+[<RequireQualifiedAccess>]
+module VehicleError =
+
+  let getAsString (e: VehicleError) : string =
+    match e with
+    | UnknownVehicle(id, available) ->
+      let names = String.Join(", ", available)
+      $"Unknown vehicle '{id}'. Available: {names}."
+    | InvalidVehicle(id, reason) -> $"Vehicle '{id}' {reason}."
+    | InvalidLibrary reason -> $"Vehicle library {reason}."
+    | InvalidPath reason -> $"Path {reason}."
+    | CaseTaken name ->
+      $"Load case '{name}' is already used by a load, case or combination."
+
+/// <summary>
+/// Library of standard vehicles and crane wheel loads, extensible with
+/// libraries of the user's own, placed on a path of members as static
+/// wheel loads at each position of their travel.
+/// </summary>
+/// <remarks>
+/// A library is a JSON document naming its <c>units</c>, SI if omitted,
+/// and its <c>vehicles</c> by ID, each with a name, the axles from front
+/// to back and optionally parameters its axles reference with
+/// <c>${NAME}</c> placeholders, resolved as for models. The standard
+/// library is in SI and holds AASHTO and EN 1991-2 road vehicles and
+/// overhead crane end carriages. A path is a chain of two-node members,
+/// along which the vehicle travels from the free end of its first member
+/// to the free end of its last; axles off the path carry no load. Loads
+/// act along the model's gravity.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Vehicles =
+
+  [<Literal>]
+  let Key = "vehicles"
+
+  /// Standard vehicles, in SI units.
+  let private standard =
+    """
+    {
+      "units": "SI",
+      "vehicles": {
+        "hs20": {
+          "name": "AASHTO HS20-44 truck",
+          "parameters": { "spacing": 4.27 },
+          "axles": [
+            { "load": 35.6e3 },
+            { "spacing": 4.27, "load": 142.3e3 },
+            { "spacing": "${spacing}", "load": 142.3e3 }
+          ]
+        },
+        "tandem": {
+          "name": "AASHTO HL-93 design tandem",
+          "axles": [ { "load": 111.2e3 }, { "spacing": 1.22, "load": 111.2e3 } ]
+        },
+        "lm1": {
+          "name": "EN 1991-2 LM1 tandem system, lane 1",
+          "parameters": { "axle": 300e3 },
+          "axles": [
+            { "load": "${axle}" },
+            { "spacing": 1.2, "load": "${axle}" }
+          ]
+        },
+        "lm2": {
+          "name": "EN 1991-2 LM2 single axle",
+          "axles": [ { "load": 400e3 } ]
+        },
+        "crane": {
+          "name": "Overhead crane end carriage",
+          "parameters": { "wheel": 100e3, "wheelbase": 3.0 },
+          "axles": [
+            { "load": "${wheel}" },
+            { "spacing": "${wheelbase}", "load": "${wheel}" }
+          ]
+        },
+        "crane-pair": {
+          "name": "Two overhead cranes buffer to buffer",
+          "parameters": { "wheel": 100e3, "wheelbase": 3.0, "gap": 1.5 },
+          "axles": [
+            { "load": "${wheel}" },
+            { "spacing": "${wheelbase}", "load": "${wheel}" },
+            { "spacing": "${gap}", "load": "${wheel}" },
+            { "spacing": "${wheelbase}", "load": "${wheel}" }
+          ]
+        }
+      }
+    }
+    """
+
+  let private jsonOptions =
+    let options = JsonSerializerOptions()
+    options.PropertyNamingPolicy <- JsonNamingPolicy.SnakeCaseLower
+    options.PropertyNameCaseInsensitive <- true
+    options
+
+  let private traverse
+    (f: 'T -> Result<'U, VehicleError>)
+    (items: 'T list)
+    : Result<'U list, VehicleError> =
+    let folder item acc =
+      match f item, acc with
+      | Ok x, Ok xs -> Ok(x :: xs)
+      | Error e, _
+      | _, Error e -> Error e
+
+    List.foldBack folder items (Ok [])
+
+  /// Parses library text into its unit system and vehicle definitions.
+  let private parse (text: string) =
+    Include.parseNode text
+    |> Result.mapError (fun e ->
+      InvalidLibrary $"is not valid JSON: {(ModelError.getAsString e)}")
+    |> Result.bind (fun node ->
+      match node with
+      | :? JsonObject as o ->
+        let units =
+          match o["units"] with
+          | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+            v.GetValue<string>()
+          | _ -> "SI"
+
+        match o[Key] with
+        | :? JsonObject as vehicles ->
+          UnitSystem.tryFind units
+          |> Result.mapError (fun e ->
+            InvalidLibrary $"has {(ConversionError.getAsString e)}")
+          |> Result.map (fun u ->
+            [ for KeyValue(id, v) in vehicles -> id, (u, v) ] |> Map.ofList)
+        | _ -> Error(InvalidLibrary $"has no '{Key}'")
+      | _ -> Error(InvalidLibrary "is not a JSON object"))
+
+  /// <summary>
+  /// Reads vehicle libraries, later libraries overriding vehicles of the
+  /// same ID in earlier ones, after the standard library.
+  /// </summary>
+  /// <param name="paths">Paths to the user's own libraries.</param>
+  /// <returns>
+  /// Unit system and unresolved definition of each vehicle, by ID, or
+  /// VehicleError.
+  /// </returns>
+  let library
+    (paths: string list)
+    : Result<Map<string, UnitSystem * JsonNode>, VehicleError> =
+    let read (path: string) =
+      try
+        Ok(File.ReadAllText path)
+      with
+      | :? IOException as ex -> Error(InvalidLibrary $"'{path}' {ex.Message}")
+      | :? UnauthorizedAccessException as ex ->
+        Error(InvalidLibrary $"'{path}' {ex.Message}")
+
+    paths
+    |> traverse (fun p -> read p |> Result.bind parse)
+    |> Result.bind (fun libraries ->
+      parse standard
+      |> Result.map (fun s ->
+        libraries
+        |> List.fold
+          (fun acc l -> Map.fold (fun acc k v -> Map.add k v acc) acc l)
+          s))
+
+  /// <summary>
+  /// Parses a vehicle and its parameter values, e.g. "hs20:spacing=9".
+  /// </summary>
+  /// <param name="text">Vehicle ID, optionally followed by a colon and
+  /// comma-separated name=value pairs.</param>
+  /// <returns>Vehicle ID and parameter values, or VehicleError.</returns>
+  let tryParse
+    (text: string)
+    : Result<string * Map<string, string>, VehicleError> =
+    let id, rest =
+      match text.IndexOf ':' with
+      | -1 -> text.Trim(), ""
+      | i -> text[.. i - 1].Trim(), text[i + 1 ..]
+
+    rest.Split(',', StringSplitOptions.RemoveEmptyEntries)
+    |> List.ofArray
+    |> traverse (fun pair ->
+      match pair.Split('=', 2) with
+      | [| name; value |] when name.Trim() <> "" ->
+        Ok(name.Trim(), value.Trim())
+      | _ -> Error(InvalidVehicle(id, $"has malformed parameter '{pair}'")))
+    |> Result.map (fun pairs -> id, Map.ofList pairs)
+
+  /// <summary>
+  /// Resolves a vehicle of a library, in the units of a model.
+  /// </summary>
+  /// <param name="library">Vehicles, as read by library.</param>
+  /// <param name="id">Vehicle ID, e.g. "hs20".</param>
+  /// <param name="overrides">Values replacing its declared parameters.</param>
+  /// <param name="target">Unit system to express the vehicle in.</param>
+  /// <returns>Vehicle, or VehicleError.</returns>
+  let resolve
+    (library: Map<string, UnitSystem * JsonNode>)
+    (id: string)
+    (overrides: Map<string, string>)
+    (target: UnitSystem)
+    : Result<Vehicle, VehicleError> =
+    match library.TryFind id with
+    | None ->
+      Error(UnknownVehicle(id, library |> Map.toList |> List.map fst))
+    | Some(source, definition) ->
+      let invalid reason = Error(InvalidVehicle(id, reason))
+      let factor = UnitSystem.factor source target
+
+      Parameters.substitute overrides (definition.DeepClone())
+      |> Result.mapError (fun e ->
+        InvalidVehicle(id, (ModelError.getAsString e).TrimEnd('.')))
+      |> Result.bind (fun node ->
+        try
+          match node.Deserialize<Vehicle>(jsonOptions) with
+          | v when isNull (box v) -> invalid "is empty"
+          | v when isNull (box v.Axles) || v.Axles.IsEmpty ->
+            invalid "has no axles"
+          | v when
+            v.Axles.Tail
+            |> List.exists (fun a -> Option.forall (fun s -> s < 0.0) a.Spacing)
+            ->
+            invalid "needs a non-negative spacing for each axle but the first"
+          | v ->
+            Ok
+              { v with
+                  Id = id
+                  Name = if isNull v.Name then id else v.Name
+                  Axles =
+                    v.Axles
+                    |> List.map (fun a ->
+                      { Spacing = Option.map (fun s -> s * factor 1 0) a.Spacing
+                        Load = a.Load * factor 0 1 }) }
+        with :? JsonException as ex ->
+          invalid $"is malformed: {ex.Message}")
+
+  /// <summary>
+  /// Returns the distance of each axle behind the leading axle.
+  /// </summary>
+  /// <param name="v">Vehicle.</param>
+  /// <returns>Offset of each axle, front to back.</returns>
+  let offsets (v: Vehicle) : float list =
+    let spacing (a: Axle) = Option.defaultValue 0.0 a.Spacing
+    v.Axles.Tail |> List.scan (fun offset a -> offset + spacing a) 0.0
+
+  /// Members of a path in order, with the node each is entered at and the
+  /// distance along the path at which it starts.
+  let private chain (m: Model) (path: string list) =
+    let members =
+      path
+      |> traverse (fun id ->
+        match m.Elements.TryFind id with
+        | Some e when e.Nodes.Length = 2 -> Ok e
+        | Some _ -> Error(InvalidPath $"member '{id}' does not have two nodes")
+        | None -> Error(InvalidPath $"has unknown element '{id}'"))
+
+    let length (e: Element) =
+      let a, b = m.Nodes[e.Nodes[0]], m.Nodes[e.Nodes[1]]
+      sqrt ((b.X - a.X) ** 2.0 + (b.Y - a.Y) ** 2.0 + (b.Z - a.Z) ** 2.0)
+
+    members
+    |> Result.bind (fun members ->
+      match members with
+      | [] -> Error(InvalidPath "has no members")
+      | first :: rest ->
+        // The path enters its first member at the node not shared with the
+        // next.
+        let entry =
+          match rest with
+          | next :: _ when List.contains first.Nodes[0] next.Nodes ->
+            first.Nodes[1]
+          | _ -> first.Nodes[0]
+
+        members
+        |> List.fold
+          (fun acc e ->
+            acc
+            |> Result.bind (fun (node, start, placed) ->
+              if not (List.contains node e.Nodes) then
+                Error(InvalidPath $"is not continuous at '{e.Id}'")
+              else
+                let exit = if e.Nodes[0] = node then e.Nodes[1] else e.Nodes[0]
+                let l = length e
+                Ok(exit, start + l, (e, node, start, l) :: placed)))
+          (Ok(entry, 0.0, []))
+        |> Result.map (fun (_, total, placed) -> List.rev placed, total))
+
+  /// Loads of a vehicle with its leading axle at a distance along a path.
+  let private wheelLoads
+    (m: Model)
+    (members: (Element * string * float * float) list)
+    (v: Vehicle)
+    (front: float)
+    (case: string)
+    =
+    let g =
+      Gravity.acceleration (Gravity.resolve m)
+      |> Option.defaultValue (0.0, -1.0, 0.0)
+
+    let gx, gy, gz = g
+    let norm = sqrt (gx * gx + gy * gy + gz * gz)
+
+    let components =
+      [ "Fx", gx / norm; "Fy", gy / norm; "Fz", gz / norm ]
+      |> List.filter (fun (_, c) -> c <> 0.0)
+
+    [ for k, (axle, offset) in List.indexed (List.zip v.Axles (offsets v)) do
+        let s = front - offset
+
+        let on =
+          members
+          |> List.tryFind (fun (_, _, start, l) -> s >= start && s <= start + l)
+
+        match on with
+        | Some(e, entry, start, l) ->
+          let t = if l > 0.0 then (s - start) / l else 0.0
+          let position = if e.Nodes[0] = entry then t else 1.0 - t
+
+          for direction, c in components do
+            let suffix = if components.Length > 1 then direction else ""
+            let id = $"{case}-a{k + 1}{suffix}"
+
+            id,
+            { Id = id
+              Type = "Force"
+              Node = None
+              Element = Some e.Id
+              Direction = direction
+              Magnitude = axle.Load * c
+              Position = Some position
+              End = None
+              EndMagnitude = None
+              Datum = None
+              Gradient = None
+              Case = Some case }
+        | None -> () ]
+
+  /// <summary>
+  /// Adds a load case for each position of a vehicle as it crosses a path,
+  /// named after the case and numbered from 1, e.g. "HS20-1", stepping its
+  /// leading axle from the start of the path until its last axle leaves.
+  /// </summary>
+  /// <param name="v">Vehicle in the units of the model.</param>
+  /// <param name="path">IDs of the members it travels along, in order.</param>
+  /// <param name="step">Distance between positions.</param>
+  /// <param name="case">Name of the cases.</param>
+  /// <param name="m">Model.</param>
+  /// <returns>Model with the cases added, or VehicleError.</returns>
+  let cross
+    (v: Vehicle)
+    (path: string list)
+    (step: float)
+    (case: string)
+    (m: Model)
+    : Result<Model, VehicleError> =
+    if not (step > 0.0) then
+      Error(InvalidPath "needs a positive step")
+    else
+      chain m path
+      |> Result.bind (fun (members, total) ->
+        let span = total + List.last (offsets v)
+        let count = int (floor (span / step + 1e-9)) + 1
+
+        let cases =
+          [ for i in 1..count do
+              let name = $"{case}-{i}"
+              name, wheelLoads m members v (float (i - 1) * step) name ]
+          |> List.filter (fun (_, loads) -> not loads.IsEmpty)
+
+        let taken =
+          [ for name, loads in cases do
+              name
+              yield! List.map fst loads ]
+          |> List.tryFind (fun name ->
+            m.Loads.ContainsKey name
+            || m.Combinations.ContainsKey name
+            || List.contains name (LoadCases.cases m))
+
+        match taken with
+        | Some name -> Error(CaseTaken name)
+        | None ->
+          Ok
+            { m with
+                Loads =
+                  cases
+                  |> List.collect snd
+                  |> List.fold (fun acc (id, l) -> Map.add id l acc) m.Loads })
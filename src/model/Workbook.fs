@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Globalization
+open System.IO
+open System.IO.Compression
+open System.Security
+open System.Text
+open System.Xml.Linq
+
+/// <summary>
+/// Reads and writes the sheets of Excel (.xlsx) workbooks as tables of
+/// cells, for models reviewed and edited in spreadsheets; see Tables.
+/// </summary>
+/// <remarks>
+/// Workbooks are Office Open XML packages: a zip of a workbook listing its
+/// sheets, and a part per sheet holding its rows. Only values are read,
+/// whether numbers, text, shared strings or the cached results of
+/// formulas; styles, dates and formulas themselves are ignored. Sheets are
+/// written with text inline and the first row bold and frozen as a header.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Workbook =
+
+  let private culture = CultureInfo.InvariantCulture
+
+  let private openXml = "http://schemas.openxmlformats.org/"
+  let private main = openXml + "spreadsheetml/2006/main"
+  let private relationships = openXml + "officeDocument/2006/relationships"
+  let private package = openXml + "package/2006/"
+
+  let private contentType =
+    "application/vnd.openxmlformats-officedocument.spreadsheetml."
+
+  let private relationshipsType =
+    "application/vnd.openxmlformats-package.relationships+xml"
+
+  let private declaration =
+    "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>"
+
+  /// Child elements of a name in any namespace, as strict and transitional
+  /// workbooks differ only in namespace.
+  let private children (name: string) (e: XElement) =
+    e.Elements() |> Seq.filter (fun x -> x.Name.LocalName = name)
+
+  let private attribute (name: string) (e: XElement) =
+    e.Attributes()
+    |> Seq.tryFind (fun a -> a.Name.LocalName = name)
+    |> Option.map (fun a -> a.Value)
+
+  let private load (zip: ZipArchive) (path: string) =
+    match zip.GetEntry path with
+    | null -> raise (InvalidDataException $"The workbook has no {path}")
+    | entry ->
+      use stream = entry.Open()
+      XDocument.Load(stream).Root
+
+  /// Text of a string item, joining its runs of rich text.
+  let private text (e: XElement) =
+    [ for x in e.Elements() do
+        match x.Name.LocalName with
+        | "t" -> x.Value
+        | "r" -> yield! children "t" x |> Seq.map (fun t -> t.Value)
+        | _ -> () ]
+    |> String.concat ""
+
+  /// Index from 0 of the column of a cell reference, e.g. 27 for AB3.
+  let private column (reference: string) =
+    let letters = reference |> Seq.takeWhile Char.IsLetter
+
+    let n =
+      letters
+      |> Seq.fold (fun n c -> n * 26 + int (Char.ToUpperInvariant c) - 64) 0
+
+    n - 1
+
+  /// Cell reference of a column and row from 0, e.g. B1 for 1 and 0.
+  let private reference (column: int) (row: int) =
+    let rec letters n acc =
+      if n < 0 then
+        acc
+      else
+        letters (n / 26 - 1) (string (char (65 + n % 26)) + acc)
+
+    letters column "" + string (row + 1)
+
+  /// Rows of a sheet by number, with a blank for each missing cell.
+  let private rows (strings: string array) (sheet: XElement) =
+    let value (cell: XElement) =
+      let v = children "v" cell |> Seq.tryHead |> Option.map (fun v -> v.Value)
+
+      match attribute "t" cell, v with
+      | Some "s", Some i -> strings[int i]
+      | Some "inlineStr", _ ->
+        children "is" cell
+        |> Seq.tryHead
+        |> Option.map text
+        |> Option.defaultValue ""
+      | Some "b", Some b -> if b = "1" then "TRUE" else "FALSE"
+      | _, Some v -> v
+      | _, None -> ""
+
+    // Rows and cells may omit their references, following the last.
+    [ for data in children "sheetData" sheet do
+        yield! children "row" data ]
+    |> List.mapFold
+      (fun last row ->
+        let number =
+          attribute "r" row |> Option.map int |> Option.defaultValue (last + 1)
+
+        let cells =
+          children "c" row
+          |> Seq.mapi (fun i cell ->
+            let at = attribute "r" cell |> Option.map column
+            defaultArg at i, value cell)
+          |> Map.ofSeq
+
+        let width = if cells.IsEmpty then 0 else Seq.max cells.Keys + 1
+        let fields = List.init width (fun i -> defaultArg (cells.TryFind i) "")
+        (number, fields), number)
+      0
+    |> fst
+
+  /// <summary>
+  /// Reads the sheets of a workbook in order.
+  /// </summary>
+  /// <param name="stream">Workbook, e.g. an .xlsx file.</param>
+  /// <returns>Name of each sheet and its rows of cells, by row number.
+  /// </returns>
+  /// <exception cref="System.IO.InvalidDataException">If the stream is
+  /// not a workbook.</exception>
+  /// <exception cref="System.Xml.XmlException">If a part of the workbook
+  /// is malformed.</exception>
+  let internal read
+    (stream: Stream)
+    : (string * (int * string list) list) list =
+    use zip = new ZipArchive(stream, ZipArchiveMode.Read, true)
+    let book = load zip "xl/workbook.xml"
+
+    let targets =
+      load zip "xl/_rels/workbook.xml.rels"
+      |> children "Relationship"
+      |> Seq.choose (fun r ->
+        match attribute "Id" r, attribute "Target" r with
+        | Some id, Some target when target.StartsWith '/' ->
+          Some(id, target.TrimStart '/')
+        | Some id, Some target -> Some(id, "xl/" + target)
+        | _ -> None)
+      |> Map.ofSeq
+
+    let strings =
+      match zip.GetEntry "xl/sharedStrings.xml" with
+      | null -> [||]
+      | _ ->
+        load zip "xl/sharedStrings.xml"
+        |> children "si"
+        |> Seq.map text
+        |> Array.ofSeq
+
+    [ for sheets in children "sheets" book do
+        for sheet in children "sheet" sheets ->
+          let name = defaultArg (attribute "name" sheet) ""
+
+          let path =
+            sheet.Attributes()
+            |> Seq.tryFind (fun a -> a.Name = XName.Get("id", relationships))
+            |> Option.bind (fun a -> targets.TryFind a.Value)
+
+          match path with
+          | Some path -> name, rows strings (load zip path)
+          | None ->
+            raise (InvalidDataException $"Sheet '{name}' has no part") ]
+
+  let private escape (x: string) = SecurityElement.Escape x
+
+  /// XML of a sheet, its first row a bold header frozen above the rest.
+  let private sheet (table: TableCell list list) =
+    let xml = StringBuilder()
+    let add (x: string) = xml.Append x |> ignore
+
+    // Columns as wide as their longest text, within reason.
+    let widths =
+      table
+      |> List.collect (List.mapi (fun i cell ->
+        match cell with
+        | Number x -> i, x.ToString("R", culture).Length
+        | Text x -> i, x.Length))
+      |> List.groupBy fst
+      |> List.map (fun (i, lengths) ->
+        i, lengths |> List.map snd |> List.max |> (+) 2 |> max 8 |> min 40)
+
+    add declaration
+    add $"<worksheet xmlns=\"{main}\"><sheetViews>"
+    add "<sheetView workbookViewId=\"0\"><pane ySplit=\"1\" "
+    add "topLeftCell=\"A2\" activePane=\"bottomLeft\" state=\"frozen\"/>"
+    add "</sheetView></sheetViews>"
+
+    if not widths.IsEmpty then
+      add "<cols>"
+
+      for i, width in widths do
+        add $"<col min=\"{i + 1}\" max=\"{i + 1}\" width=\"{width}\"/>"
+
+      add "</cols>"
+
+    add "<sheetData>"
+
+    for r, row in List.indexed table do
+      add $"<row r=\"{r + 1}\">"
+      let style = if r = 0 then " s=\"1\"" else ""
+
+      for c, cell in List.indexed row do
+        let at = reference c r
+
+        match cell with
+        | Number x ->
+          let v = x.ToString("R", culture)
+          add $"<c r=\"{at}\"{style}><v>{v}</v></c>"
+        | Text "" -> ()
+        | Text x ->
+          add $"<c r=\"{at}\"{style} t=\"inlineStr\"><is>"
+          add $"<t xml:space=\"preserve\">{escape x}</t></is></c>"
+
+      add "</row>"
+
+    add "</sheetData></worksheet>"
+    xml.ToString()
+
+  /// Styles of a workbook: the default font, and a bold one for headers.
+  let private styles =
+    $"{declaration}<styleSheet xmlns=\"{main}\">\
+      <fonts count=\"2\"><font><sz val=\"11\"/><name val=\"Calibri\"/></font>\
+      <font><b/><sz val=\"11\"/><name val=\"Calibri\"/></font></fonts>\
+      <fills count=\"2\"><fill><patternFill patternType=\"none\"/></fill>\
+      <fill><patternFill patternType=\"gray125\"/></fill></fills>\
+      <borders count=\"1\"><border/></borders>\
+      <cellStyleXfs count=\"1\">\
+      <xf numFmtId=\"0\" fontId=\"0\" fillId=\"0\" borderId=\"0\"/>\
+      </cellStyleXfs><cellXfs count=\"2\">\
+      <xf numFmtId=\"0\" fontId=\"0\" fillId=\"0\" borderId=\"0\" xfId=\"0\"/>\
+      <xf numFmtId=\"0\" fontId=\"1\" fillId=\"0\" borderId=\"0\" xfId=\"0\" \
+      applyFont=\"1\"/></cellXfs>\
+      </styleSheet>"
+
+  /// <summary>
+  /// Writes tables as the sheets of a workbook.
+  /// </summary>
+  /// <param name="sheets">Name of each sheet, at most 31 characters, and
+  /// its rows of cells, the first a header.</param>
+  /// <param name="stream">Destination, e.g. an .xlsx file.</param>
+  let internal write
+    (sheets: (string * TableCell list list) list)
+    (stream: Stream)
+    : unit =
+    use zip = new ZipArchive(stream, ZipArchiveMode.Create, true)
+
+    let add (path: string) (xml: string) =
+      use part = zip.CreateEntry(path, CompressionLevel.Optimal).Open()
+      let bytes = UTF8Encoding(false).GetBytes xml
+      part.Write(bytes, 0, bytes.Length)
+
+    let numbered = List.indexed sheets |> List.map (fun (i, s) -> i + 1, s)
+
+    let overrides =
+      [ for i, _ in numbered ->
+          $"<Override PartName=\"/xl/worksheets/sheet{i}.xml\" \
+            ContentType=\"{contentType}worksheet+xml\"/>" ]
+      |> String.concat ""
+
+    add
+      "[Content_Types].xml"
+      $"{declaration}<Types xmlns=\"{package}content-types\">\
+        <Default Extension=\"rels\" \
+        ContentType=\"{relationshipsType}\"/>\
+        <Default Extension=\"xml\" ContentType=\"application/xml\"/>\
+        <Override PartName=\"/xl/workbook.xml\" \
+        ContentType=\"{contentType}sheet.main+xml\"/>\
+        <Override PartName=\"/xl/styles.xml\" \
+        ContentType=\"{contentType}styles+xml\"/>{overrides}</Types>"
+
+    add
+      "_rels/.rels"
+      $"{declaration}<Relationships xmlns=\"{package}relationships\">\
+        <Relationship Id=\"rId1\" \
+        Type=\"{relationships}/officeDocument\" \
+        Target=\"xl/workbook.xml\"/></Relationships>"
+
+    let entries =
+      [ for i, (name, _) in numbered ->
+          $"<sheet name=\"{escape name}\" sheetId=\"{i}\" r:id=\"rId{i}\"/>" ]
+      |> String.concat ""
+
+    add
+      "xl/workbook.xml"
+      $"{declaration}<workbook xmlns=\"{main}\" xmlns:r=\"{relationships}\">\
+        <sheets>{entries}</sheets></workbook>"
+
+    let links =
+      [ for i, _ in numbered ->
+          $"<Relationship Id=\"rId{i}\" \
+            Type=\"{relationships}/worksheet\" \
+            Target=\"worksheets/sheet{i}.xml\"/>" ]
+      |> String.concat ""
+
+    let styled = numbered.Length + 1
+
+    add
+      "xl/_rels/workbook.xml.rels"
+      $"{declaration}<Relationships xmlns=\"{package}relationships\">{links}\
+        <Relationship Id=\"rId{styled}\" Type=\"{relationships}/styles\" \
+        Target=\"styles.xml\"/></Relationships>"
+
+    add "xl/styles.xml" styles
+
+    for i, (_, rows) in numbered do
+      add $"xl/worksheets/sheet{i}.xml" (sheet rows)
@@ -0,0 +1,533 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+namespace Gazelle.Model
+
+open System
+open System.Globalization
+open System.Text
+open System.Text.Encodings.Web
+open System.Text.Json
+open System.Text.Json.Nodes
+open System.Text.RegularExpressions
+
+/// Defect in a YAML document, at a line numbered from 1.
+type private YamlException(line: int, reason: string) =
+  inherit Exception($"line {line}: {reason}")
+
+/// <summary>
+/// Reads and writes YAML documents as the same document trees as JSON, so
+/// that composition directives and parameters apply to both alike.
+/// </summary>
+/// <remarks>
+/// Model files need only part of YAML 1.2, which is what is supported:
+/// block mappings and sequences, flow collections such as <c>[n1, n2]</c>,
+/// plain and quoted scalars, literal and folded block scalars, and
+/// comments. Anchors, aliases, tags and multiple documents are not. Plain
+/// scalars follow the core schema: null, true and false, and integers and
+/// decimals as numbers; anything else is a string.
+/// </remarks>
+[<RequireQualifiedAccess>]
+module Yaml =
+
+  let private integer = Regex(@"^[-+]?[0-9]+$")
+
+  let private decimal =
+    Regex(@"^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$")
+
+  /// Converts a plain scalar to its value.
+  let private plain (text: string) : JsonNode =
+    let culture = CultureInfo.InvariantCulture
+
+    match text with
+    | ""
+    | "~"
+    | "null"
+    | "Null"
+    | "NULL" -> null
+    | "true"
+    | "True"
+    | "TRUE" -> JsonValue.Create true
+    | "false"
+    | "False"
+    | "FALSE" -> JsonValue.Create false
+    | t when integer.IsMatch t ->
+      match Int64.TryParse(t, NumberStyles.Integer, culture) with
+      | true, n -> JsonValue.Create n
+      | _ -> JsonValue.Create(Double.Parse(t, culture))
+    | t when decimal.IsMatch t ->
+      JsonValue.Create(Double.Parse(t, NumberStyles.Float, culture))
+    | t -> JsonValue.Create t
+
+  /// Index of the quote closing one opened at start, or -1.
+  let private closing (text: string) (start: int) =
+    let quote = text[start]
+
+    let rec scan i =
+      if i >= text.Length then
+        -1
+      elif quote = '"' && text[i] = '\\' then
+        scan (i + 2)
+      elif text[i] = quote && quote = '\'' && i + 1 < text.Length
+           && text[i + 1] = '\'' then
+        scan (i + 2)
+      elif text[i] = quote then
+        i
+      else
+        scan (i + 1)
+
+    scan (start + 1)
+
+  /// Value of a quoted scalar, quotes included.
+  let private unquote (line: int) (text: string) : string =
+    if text.StartsWith "'" then
+      text.Substring(1, text.Length - 2).Replace("''", "'")
+    else
+      try
+        JsonSerializer.Deserialize<string> text
+      with :? JsonException ->
+        raise (YamlException(line, $"cannot read the string {text}"))
+
+  /// Converts a scalar, quoted or plain, to its value.
+  let private scalar (line: int) (text: string) : JsonNode =
+    match text with
+    | t when t.Length > 1 && (t[0] = '"' || t[0] = '\'') ->
+      if closing t 0 <> t.Length - 1 then
+        raise (YamlException(line, $"unexpected text after {t}"))
+
+      JsonValue.Create(unquote line t)
+    | t when t.StartsWith "&" || t.StartsWith "*" || t.StartsWith "!" ->
+      raise (YamlException(line, "anchors, aliases and tags are not supported"))
+    | t -> plain t
+
+  /// Whether a quote may open at a position: at the start of a token.
+  let private opensAt (text: string) (i: int) =
+    i = 0 || " [{,:-".Contains text[i - 1]
+
+  /// Removes a comment from a line, leaving quoted '#' alone.
+  let private uncomment (line: string) : string =
+    let rec scan i =
+      if i >= line.Length then
+        line
+      else
+        match line[i] with
+        | '#' when i = 0 || Char.IsWhiteSpace line[i - 1] ->
+          line.Substring(0, i)
+        | '"'
+        | '\'' when opensAt line i ->
+          match closing line i with
+          | -1 -> line
+          | j -> scan (j + 1)
+        | _ -> scan (i + 1)
+
+    (scan 0).TrimEnd()
+
+  /// Net depth of the flow brackets a text opens, outside quotes.
+  let private depth (text: string) : int =
+    let rec scan i d =
+      if i >= text.Length then
+        d
+      else
+        match text[i] with
+        | '['
+        | '{' -> scan (i + 1) (d + 1)
+        | ']'
+        | '}' -> scan (i + 1) (d - 1)
+        | '"'
+        | '\'' when opensAt text i ->
+          match closing text i with
+          | -1 -> d
+          | j -> scan (j + 1) d
+        | _ -> scan (i + 1) d
+
+    scan 0 0
+
+  /// Splits a mapping entry into its key and the rest of the line.
+  let private entry (line: int) (text: string) : (string * string) option =
+    let after i = text.Substring(i + 1).Trim()
+    let separates i = i + 1 = text.Length || text[i + 1] = ' '
+
+    if text.StartsWith "\"" || text.StartsWith "'" then
+      match closing text 0 with
+      | j when j > 0 && j + 1 < text.Length && text[j + 1] = ':'
+               && separates (j + 1) ->
+        Some(unquote line (text.Substring(0, j + 1)), after (j + 1))
+      | _ -> None
+    elif text.StartsWith "[" || text.StartsWith "{" then
+      None
+    else
+      let rec find i =
+        match text.IndexOf(':', (i: int)) with
+        | -1 -> None
+        | j when separates j -> Some(text.Substring(0, j).Trim(), after j)
+        | j -> find (j + 1)
+
+      find 0
+
+  /// Parses a flow collection or scalar, e.g. [n1, n2] or {x: 1}.
+  let private flow (line: int) (text: string) : JsonNode =
+    let fail reason = raise (YamlException(line, reason))
+
+    let rec skip i =
+      if i < text.Length && text[i] = ' ' then skip (i + 1) else i
+
+    // Plain scalar up to a flow indicator, or a ':' within a mapping.
+    let token i key =
+      let stops (j: int) =
+        ",[]{}".Contains text[j]
+        || key && text[j] = ':'
+           && (j + 1 = text.Length || " ,]}".Contains text[j + 1])
+
+      let rec finish j =
+        if j < text.Length && not (stops j) then finish (j + 1) else j
+
+      let j = finish i
+      text.Substring(i, j - i).Trim(), j
+
+    let rec value i key : JsonNode * int =
+      let i = skip i
+
+      if i >= text.Length then
+        fail "unclosed flow collection"
+      else
+        match text[i] with
+        | '[' -> sequence (i + 1) (JsonArray())
+        | '{' -> mapping (i + 1) (JsonObject())
+        | '"'
+        | '\'' ->
+          match closing text i with
+          | -1 -> fail "unclosed quote"
+          | j -> scalar line (text.Substring(i, j - i + 1)), j + 1
+        | _ ->
+          let t, j = token i key
+          scalar line t, j
+
+    and sequence i (items: JsonArray) =
+      let i = skip i
+
+      if i < text.Length && text[i] = ']' then
+        items :> JsonNode, i + 1
+      else
+        let item, j = value i false
+        items.Add item
+        let j = skip j
+
+        match (if j < text.Length then text[j] else ' ') with
+        | ',' -> sequence (j + 1) items
+        | ']' -> items :> JsonNode, j + 1
+        | _ -> fail "expected ',' or ']' in a flow sequence"
+
+    and mapping i (entries: JsonObject) =
+      let i = skip i
+
+      if i < text.Length && text[i] = '}' then
+        entries :> JsonNode, i + 1
+      else
+        let key, j = value i true
+        let j = skip j
+
+        if j >= text.Length || text[j] <> ':' then
+          fail "expected ':' after a key in a flow mapping"
+
+        let item, k =
+          match skip (j + 1) with
+          | k when k < text.Length && (text[k] = ',' || text[k] = '}') ->
+            null, k
+          | k -> value k false
+
+        let name =
+          match key with
+          | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+            v.GetValue<string>()
+          | null -> fail "empty key in a flow mapping"
+          | other -> other.ToJsonString()
+
+        entries[name] <- item
+        let k = skip k
+
+        match (if k < text.Length then text[k] else ' ') with
+        | ',' -> mapping (k + 1) entries
+        | '}' -> entries :> JsonNode, k + 1
+        | _ -> fail "expected ',' or '}' in a flow mapping"
+
+    let node, i = value 0 false
+
+    if skip i < text.Length then
+      fail $"unexpected text after a flow collection: {text.Substring i}"
+
+    node
+
+  /// <summary>
+  /// Parses YAML text into a mutable document tree.
+  /// </summary>
+  /// <param name="text">YAML document.</param>
+  /// <returns>Document tree, or MalformedModel at the line at fault.
+  /// </returns>
+  let internal parseNode (text: string) : Result<JsonNode, ModelError> =
+    let lines =
+      text.Replace("\r\n", "\n").Split('\n')
+      |> Array.takeWhile (fun l -> l.TrimEnd() <> "...")
+
+    // Directives and the marker opening the document carry no content.
+    let opening =
+      lines
+      |> Array.tryFindIndex (fun l ->
+        let t = uncomment l
+        t <> "" && not (t.StartsWith "%"))
+
+    match opening with
+    | Some i when lines[i].TrimEnd() = "---" ->
+      for j in 0..i do
+        lines[j] <- ""
+    | _ -> ()
+
+    let fail i reason = raise (YamlException(i + 1, reason))
+
+    let indentOf i =
+      let line = lines[i]
+      let indent = line.Length - line.TrimStart(' ').Length
+
+      if indent < line.Length && line[indent] = '\t' then
+        fail i "indent with spaces, not tabs"
+
+      indent
+
+    let body i = (uncomment lines[i]).Trim()
+
+    let isItem (t: string) = t = "-" || t.StartsWith "- "
+
+    let rec next i =
+      if i < lines.Length && body i = "" then next (i + 1)
+      elif i < lines.Length && body i = "---" then
+        fail i "multiple documents are not supported"
+      else i
+
+    // Literal (|) or folded (>) block scalar following line i.
+    let blockScalar i indent (header: string) : JsonNode * int =
+      let rec extent j =
+        if j < lines.Length
+           && (lines[j].Trim() = "" || indentOf j > indent) then
+          extent (j + 1)
+        else
+          j
+
+      let stop = extent (i + 1)
+      let content = lines[i + 1 .. stop - 1]
+
+      let margin =
+        content
+        |> Array.filter (fun l -> l.Trim() <> "")
+        |> Array.map (fun l -> l.Length - l.TrimStart(' ').Length)
+        |> Array.fold min Int32.MaxValue
+
+      let kept =
+        content
+        |> Array.map (fun l -> if l.Length > margin then l[margin..] else "")
+
+      let joined =
+        if header.StartsWith "|" then
+          String.Join("\n", kept)
+        else
+          kept
+          |> Array.fold
+            (fun (acc: string) l ->
+              match acc, l with
+              | "", _ -> l
+              | _, "" -> acc + "\n"
+              | _ when acc.EndsWith "\n" -> acc + l
+              | _ -> acc + " " + l)
+            ""
+
+      let value =
+        match header with
+        | "|-"
+        | ">-" -> joined.TrimEnd('\n')
+        | "|+"
+        | ">+" -> joined + "\n"
+        | _ -> joined.TrimEnd('\n') + "\n"
+
+      JsonValue.Create value, stop
+
+    // Value given on line i after its key or dash, and the next line.
+    let rec inline' i indent (rest: string) : JsonNode * int =
+      match rest with
+      | "|"
+      | "|-"
+      | "|+"
+      | ">"
+      | ">-"
+      | ">+" -> blockScalar i indent rest
+      | r when r.StartsWith "[" || r.StartsWith "{" ->
+        let rec gather j (acc: string) =
+          if depth acc <= 0 then
+            acc, j
+          elif j >= lines.Length then
+            fail i "unclosed flow collection"
+          else
+            gather (j + 1) (acc + " " + body j)
+
+        let whole, j = gather (i + 1) r
+        flow (i + 1) whole, j
+      | r -> scalar (i + 1) r, i + 1
+
+    and block i : JsonNode * int =
+      let indent = indentOf i
+      let t = body i
+
+      if isItem t then
+        sequence i indent (JsonArray())
+      else
+        match entry (i + 1) t with
+        | Some _ -> mapping i indent (JsonObject())
+        | None -> inline' i indent t
+
+    // Nested value of an entry or item with nothing after it on line i.
+    and nested i indent : JsonNode * int =
+      match next (i + 1) with
+      | j when j < lines.Length && indentOf j > indent -> block j
+      | j when j < lines.Length && indentOf j = indent && isItem (body j) ->
+        sequence j indent (JsonArray())
+      | _ -> null, i + 1
+
+    and mapping i indent (entries: JsonObject) : JsonNode * int =
+      match next i with
+      | j when j >= lines.Length || indentOf j < indent -> entries, j
+      | j when indentOf j > indent -> fail j "unexpected indentation"
+      | j ->
+        match entry (j + 1) (body j) with
+        | None when isItem (body j) -> entries, j
+        | None -> fail j $"expected 'key: value', not '{body j}'"
+        | Some(key, _) when entries.ContainsKey key ->
+          fail j $"duplicate key '{key}'"
+        | Some(key, rest) ->
+          let value, k =
+            if rest = "" then nested j indent else inline' j indent rest
+
+          entries[key] <- value
+          mapping k indent entries
+
+    and sequence i indent (items: JsonArray) : JsonNode * int =
+      match next i with
+      | j when j >= lines.Length || indentOf j < indent -> items, j
+      | j when indentOf j > indent -> fail j "unexpected indentation"
+      | j when not (isItem (body j)) -> items, j
+      | j ->
+        let t = body j
+        let rest = t.Substring(1).TrimStart()
+
+        let item, k =
+          if rest = "" then
+            nested j indent
+          elif isItem rest || (entry (j + 1) rest).IsSome then
+            // Read a nested collection as if it started below the dash.
+            lines[j] <- String(' ', indent + t.Length - rest.Length) + rest
+            block j
+          else
+            inline' j indent rest
+
+        items.Add item
+        sequence k indent items
+
+    try
+      match next 0 with
+      | i when i >= lines.Length -> Error(MalformedModel "document is empty")
+      | i ->
+        let node, j = block i
+
+        match next j with
+        | k when k < lines.Length -> fail k $"unexpected '{body k}'"
+        | _ when isNull node -> Error(MalformedModel "document is empty")
+        | _ -> Ok node
+    with :? YamlException as ex ->
+      Error(MalformedModel ex.Message)
+
+  let private quoteOptions =
+    JsonSerializerOptions(Encoder = JavaScriptEncoder.UnsafeRelaxedJsonEscaping)
+
+  /// Words that YAML 1.1 readers take for booleans.
+  let private booleans =
+    set [ "yes"; "no"; "on"; "off" ]
+
+  /// Whether a string reads back as itself without quotes.
+  let private isPlain (s: string) =
+    s <> ""
+    && s.Trim() = s
+    && not ("-?:,[]{}#&*!|>'\"%@`".Contains s[0])
+    && not (s.Contains ": " || s.Contains " #" || s.EndsWith ":")
+    && not (s |> Seq.exists (fun c -> Char.IsControl c || ",[]{}".Contains c))
+    && not (booleans.Contains(s.ToLowerInvariant()))
+    && match plain s with
+       | :? JsonValue as v -> v.GetValueKind() = JsonValueKind.String
+       | _ -> false
+
+  let private text (s: string) =
+    if isPlain s then s else JsonSerializer.Serialize(s, quoteOptions)
+
+  /// Writes a scalar, or a collection that fits on one line.
+  let private oneLine (node: JsonNode) : string option =
+    let scalar (n: JsonNode) =
+      match n with
+      | null -> Some "null"
+      | :? JsonValue as v when v.GetValueKind() = JsonValueKind.String ->
+        Some(text (v.GetValue<string>()))
+      | :? JsonValue as v -> Some(v.ToJsonString())
+      | _ -> None
+
+    match node with
+    | :? JsonArray as a ->
+      let items = a |> Seq.map scalar |> List.ofSeq
+
+      if List.contains None items then
+        None
+      else
+        Some("[" + String.Join(", ", List.choose id items) + "]")
+    | :? JsonObject as o when o.Count = 0 -> Some "{}"
+    | :? JsonObject -> None
+    | n -> scalar n
+
+  /// <summary>
+  /// Writes a document tree as YAML in block style, with sequences of
+  /// scalars in flow style.
+  /// </summary>
+  /// <param name="node">Document tree.</param>
+  /// <returns>YAML document.</returns>
+  let internal write (node: JsonNode) : string =
+    let out = StringBuilder()
+
+    let rec mapping indent (lead: string) (o: JsonObject) =
+      o
+      |> Seq.iteri (fun i (KeyValue(key, value)) ->
+        let start = if i = 0 then lead else String(' ', indent)
+        out.Append(start).Append(text key).Append(':') |> ignore
+
+        match oneLine value with
+        | Some v -> out.Append(' ').Append(v).Append('\n') |> ignore
+        | None ->
+          out.Append('\n') |> ignore
+          block (indent + 2) value)
+
+    and sequence indent (a: JsonArray) =
+      for item in a do
+        let dash = String(' ', indent) + "- "
+
+        match oneLine item, item with
+        | Some v, _ -> out.Append(dash).Append(v).Append('\n') |> ignore
+        | None, (:? JsonObject as o) -> mapping (indent + 2) dash o
+        | None, _ ->
+          out.Append(dash.TrimEnd()).Append('\n') |> ignore
+          block (indent + 2) item
+
+    and block indent (n: JsonNode) =
+      match n with
+      | :? JsonObject as o -> mapping indent (String(' ', indent)) o
+      | :? JsonArray as a -> sequence indent a
+      | n ->
+        let v = defaultArg (oneLine n) "null"
+        out.Append(' ', indent).Append(v).Append('\n') |> ignore
+
+    match oneLine node with
+    | Some v -> v + "\n"
+    | None ->
+      block 0 node
+      out.ToString()
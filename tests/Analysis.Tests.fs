@@ -0,0 +1,4064 @@
+namespace Gazelle.Analysis.Tests
+
+open Xunit
+open Gazelle.Analysis
+
+module ResultBlockTests =
+
+  [<Fact>]
+  let ``Result block names round-trip`` () =
+    for b in ResultBlock.all do
+      Assert.Equal(Some b, ResultBlock.tryParse (ResultBlock.getAsString b))
+
+  [<Fact>]
+  let ``Unknown result block name is reported`` () =
+    match ResultBlock.parseAll [ "reactions"; "strains" ] with
+    | Error name -> Assert.Equal("strains", name)
+    | Ok blocks -> Assert.Fail($"Unexpected result: {blocks}")
+
+module NodalLoadsTests =
+
+  open Gazelle.Model
+
+  let private node id x z = { Id = id; X = x; Y = 0.0; Z = z }
+
+  /// 2 m × 3 m plate in the XZ plane, its normal pointing along -Y.
+  let private model =
+    { Info =
+        { Name = "Slab"
+          Description = None
+          Units = "SI"
+          Version = "1.0"
+          Dimensions = None }
+      Parameters = None
+      Gravity = None
+      Damping = None
+      TimeHistory = None
+      Nodes =
+        Map
+          [ "n1", node "n1" 0.0 0.0
+            "n2", node "n2" 2.0 0.0
+            "n3", node "n3" 2.0 3.0
+            "n4", node "n4" 0.0 3.0 ]
+      Elements =
+        Map
+          [ "e1",
+            { Id = "e1"
+              Type = "Plate"
+              Nodes = [ "n1"; "n2"; "n3"; "n4" ]
+              Material = "concrete"
+              Properties = None
+              Releases = None } ]
+      Materials = Map.empty
+      Loads = Map.empty
+      Combinations = Map.empty
+      Constraints = Map.empty
+      Masses = None
+      Panels = None }
+
+  let private pressure direction magnitude =
+    { Id = "l1"
+      Type = "Pressure"
+      Node = None
+      Element = Some "e1"
+      Direction = direction
+      Magnitude = magnitude
+      Position = None
+      End = None
+      EndMagnitude = None
+      Datum = None
+      Gradient = None
+      Case = None }
+
+  [<Fact>]
+  let ``Uniform pressure shares total force equally between nodes`` () =
+    match NodalLoads.ofLoad model 1.0 (pressure "Normal" 5.0) with
+    | Ok loads ->
+      Assert.Equal(4, loads.Length)
+
+      for l in loads do
+        Assert.Equal("Fy", l.Direction)
+        Assert.Equal(-7.5, l.Magnitude, 9)
+    | Error e -> Assert.Fail(LoadError.getAsString e)
+
+  [<Fact>]
+  let ``Global pressure direction is independent of node order`` () =
+    match NodalLoads.ofLoad model 2.0 (pressure "Fz" -1.0) with
+    | Ok loads ->
+      Assert.Equal(-12.0, (NodalLoads.resultant loads)["Fz"], 9)
+    | Error e -> Assert.Fail(LoadError.getAsString e)
+
+  [<Fact>]
+  let ``Hydrostatic pressure favours the deeper nodes`` () =
+    // Rotate the plate into the vertical XY plane, 3 m deep below Datum.
+    let wall =
+      { model with
+          Nodes =
+            model.Nodes
+            |> Map.map (fun _ n -> { n with Y = n.Z; Z = 0.0 }) }
+
+    let load =
+      { pressure "Normal" 10.0 with
+          Type = "Hydrostatic"
+          Datum = Some 3.0 }
+
+    match NodalLoads.ofLoad wall 1.0 load with
+    | Ok loads ->
+      let force node =
+        (loads |> List.find (fun l -> l.Node = node)).Magnitude
+
+      Assert.Equal(30.0, force "n1", 9)
+      Assert.Equal(15.0, force "n4", 9)
+      Assert.Equal(90.0, (NodalLoads.resultant loads)["Fz"], 9)
+    | Error e -> Assert.Fail(LoadError.getAsString e)
+
+  [<Fact>]
+  let ``Point force on a member becomes fixed-end forces and moments`` () =
+    let beam =
+      { model with
+          Elements =
+            Map
+              [ "e1",
+                { model.Elements["e1"] with
+                    Type = "Frame2D"
+                    Nodes = [ "n1"; "n2" ] } ] }
+
+    // 10 kN down at a quarter span of a 2 m beam: a = 0.5, b = 1.5.
+    let load =
+      { pressure "Fy" -10.0 with
+          Type = "Force"
+          Position = Some 0.25 }
+
+    match NodalLoads.ofLoad beam 1.0 load with
+    | Ok loads ->
+      let find node direction =
+        (loads
+         |> List.find (fun l -> l.Node = node && l.Direction = direction))
+          .Magnitude
+
+      Assert.Equal(-8.4375, find "n1" "Fy", 9)
+      Assert.Equal(-1.5625, find "n2" "Fy", 9)
+      Assert.Equal(-2.8125, find "n1" "Mz", 9)
+      Assert.Equal(0.9375, find "n2" "Mz", 9)
+    | Error e -> Assert.Fail(LoadError.getAsString e)
+
+  [<Fact>]
+  let ``Triangular line load on a member gives its fixed-end forces`` () =
+    let beam =
+      { model with
+          Elements =
+            Map
+              [ "e1",
+                { model.Elements["e1"] with
+                    Type = "Frame2D"
+                    Nodes = [ "n1"; "n2" ] } ] }
+
+    // Rising from zero to 6 kN/m down over a 2 m beam: 3qL/20 and 7qL/20
+    // shears, qL²/30 and qL²/20 moments.
+    let load =
+      { pressure "Fy" 0.0 with
+          Type = "Distributed"
+          EndMagnitude = Some -6.0 }
+
+    match NodalLoads.ofLoad beam 1.0 load with
+    | Ok loads ->
+      let total node direction =
+        loads
+        |> List.filter (fun l -> l.Node = node && l.Direction = direction)
+        |> List.sumBy (fun l -> l.Magnitude)
+
+      Assert.Equal(-1.8, total "n1" "Fy", 9)
+      Assert.Equal(-4.2, total "n2" "Fy", 9)
+      Assert.Equal(-0.8, total "n1" "Mz", 9)
+      Assert.Equal(1.2, total "n2" "Mz", 9)
+    | Error e -> Assert.Fail(LoadError.getAsString e)
+
+  [<Fact>]
+  let ``Self-weight acts along the declared gravity`` () =
+    let slab =
+      { model with
+          Gravity =
+            Some
+              { Magnitude = 10.0
+                Direction = [ 0.0; 0.0; -2.0 ] }
+          Elements =
+            model.Elements
+            |> Map.map (fun _ e ->
+              { e with
+                  Properties = Some(Map [ "thickness", 0.2 ]) })
+          Materials =
+            Map
+              [ "concrete",
+                { Id = "concrete"
+                  Name = "C30/37"
+                  Type = "Concrete"
+                  ElasticModulus = 33e9
+                  Density = Some 2500.0
+                  YieldStrength = None
+                  ShearModulus = None
+                  DampingRatio = None
+                  ThermalExpansion = None } ] }
+
+    let load =
+      { pressure "Gravity" 1.0 with
+          Type = "SelfWeight"
+          Element = None }
+
+    match NodalLoads.ofLoad slab 1.5 load with
+    | Ok loads ->
+      let total = NodalLoads.resultant loads
+      Assert.Equal(-1.5 * 2500.0 * 0.2 * 6.0 * 10.0, total["Fz"], 6)
+      Assert.False(total.ContainsKey "Fy")
+    | Error e -> Assert.Fail(LoadError.getAsString e)
+
+module BucklingTests =
+
+  open Gazelle.Model
+
+  let private column =
+    match Model.parse Json Gazelle.Model.Tests.ModelTests.json with
+    | Ok m ->
+      let fixedBase =
+        { Id = "c1"
+          Type = "Fixed"
+          Node = "n1"
+          Dof = [ "Ux"; "Uy"; "Rz" ]
+          Angle = None
+          Stiffness = None
+          Displacement = None }
+
+      let properties = Map [ "area", 0.01; "i", 1e-4 ]
+
+      { m with
+          Elements =
+            m.Elements
+            |> Map.map (fun _ e -> { e with Properties = Some properties })
+          Constraints = Map [ "c1", fixedBase ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Cantilever buckles over twice its length`` () =
+    match Buckling.ofModel column with
+    | Ok [ b ] ->
+      Assert.Equal(2.0, b.EffectiveLengthFactor)
+      Assert.Equal(6.0 / 0.1, b.Slenderness, 9)
+      let expected = System.Math.PI ** 2.0 * 210e9 * 1e-4 / 36.0
+      Assert.Equal(expected, b.CriticalLoad, 3)
+      Assert.Equal(0.5, Buckling.utilisation (-expected / 2.0) b, 9)
+      Assert.Equal(0.0, Buckling.utilisation expected b)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Declared effective length factor takes precedence`` () =
+    let braced =
+      { column with
+          Elements =
+            column.Elements
+            |> Map.map (fun _ e ->
+              let properties = e.Properties |> Option.map (Map.add "k" 0.85)
+              { e with Properties = properties }) }
+
+    match Buckling.ofModel braced with
+    | Ok [ b ] -> Assert.Equal(0.85, b.EffectiveLengthFactor)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module DesignTests =
+
+  open Gazelle.Model
+
+  let private column yieldStrength =
+    match Model.parse Json Gazelle.Model.Tests.ModelTests.json with
+    | Ok m ->
+      let fixedBase =
+        { Id = "c1"
+          Type = "Fixed"
+          Node = "n1"
+          Dof = [ "Ux"; "Uy"; "Rz" ]
+          Angle = None
+          Stiffness = None
+          Displacement = None }
+
+      let properties = Map [ "area", 0.01; "i", 1e-4; "zz", 1e-3 ]
+
+      { m with
+          Elements =
+            m.Elements
+            |> Map.map (fun _ e -> { e with Properties = Some properties })
+          Materials =
+            m.Materials
+            |> Map.map (fun _ s -> { s with YieldStrength = yieldStrength })
+          Constraints = Map [ "c1", fixedBase ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Strength adds axial and bending stress over the yield strength`` () =
+    let forces = [| -100e3; 0.0; 0.0; 100e3; 0.0; 20e3 |]
+
+    match Design.check (column (Some 355e6)) "e1" forces [] with
+    | Some c ->
+      Assert.Equal((100e3 / 0.01 + 20e3 / 1e-3) / 355e6, c.Strength.Value, 9)
+      Assert.Equal(Some 0.0, c.Buckling)
+      Assert.Equal(c.Strength.Value, c.Utilisation)
+    | None -> Assert.Fail("Expected a check")
+
+  [<Fact>]
+  let ``Buckling governs compression without a yield strength`` () =
+    let critical = System.Math.PI ** 2.0 * 210e9 * 1e-4 / 36.0
+    let forces = [| critical / 2.0; 0.0; 0.0; -critical / 2.0; 0.0; 0.0 |]
+
+    match Design.check (column None) "e1" forces [] with
+    | Some c ->
+      Assert.Equal(None, c.Strength)
+      Assert.Equal(0.5, c.Buckling.Value, 9)
+      Assert.Equal(0.5, c.Utilisation, 9)
+    | None -> Assert.Fail("Expected a check")
+
+  [<Fact>]
+  let ``Member stresses split signed axial and extreme fibre bending`` () =
+    let forces = [| -100e3; 0.0; 0.0; 100e3; 0.0; 20e3 |]
+    let s = Design.memberStress (column (Some 355e6)) "e1" forces []
+    Assert.Equal(Some 1e7, s.Axial)
+    Assert.Equal(Some 2e7, s.Bending)
+    Assert.Equal(None, s.VonMises)
+    Assert.Equal(3e7 / 355e6, s.Ratio.Value, 9)
+
+  [<Fact>]
+  let ``Plate stresses combine shear into von Mises`` () =
+    let m = column (Some 355e6)
+    let e = { m.Elements["e1"] with Properties = Some(Map [ "t", 0.1 ]) }
+    let m = { m with Elements = m.Elements.Add("e1", e) }
+    let forces = [| 0.0; 0.0; 1e5; 0.0; 0.0; 0.0; 0.0; 0.0 |]
+    let s = Design.surfaceStress m "e1" forces
+    Assert.Equal(sqrt 3.0 * 1e6, s.VonMises.Value, 6)
+    Assert.Equal(Some 0.0, s.Bending)
+    Assert.Equal(s.VonMises.Value, s.Stress)
+
+  [<Fact>]
+  let ``Governing checks take the worst scenario of each member`` () =
+    let governing scenario element utilisation =
+      { Scenario = scenario
+        LoadSet = "ULS"
+        Check =
+          { Element = element
+            Strength = Some utilisation
+            Buckling = None
+            Utilisation = utilisation } }
+
+    let checks =
+      [ governing "a" "e2" 0.4
+        governing "a" "e1" 0.9
+        governing "b" "e1" 1.1
+        governing "b" "e2" 0.3 ]
+
+    let governed =
+      Design.govern checks |> List.map (fun c -> c.Check.Element, c.Scenario)
+
+    Assert.Equal<(string * string) list>([ "e1", "b"; "e2", "a" ], governed)
+
+module DampingTests =
+
+  open Gazelle.Model
+
+  let private model =
+    match Model.parse Json Gazelle.Model.Tests.ModelTests.json with
+    | Ok m -> m
+    | Error e -> failwith (ModelError.getAsString e)
+
+  let private withMaterialRatio ratio (m: Model) =
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x -> { x with DampingRatio = Some ratio }) }
+
+  [<Fact>]
+  let ``Composite damping weights ratios by strain energy`` () =
+    match Damping.composite [ 0.02, 3.0; 0.05, 1.0 ] with
+    | Some ratio -> Assert.Equal(0.0275, ratio, 9)
+    | None -> Assert.Fail("Expected a composite ratio")
+
+    Assert.Equal(None, Damping.composite [ 0.02, 0.0 ])
+
+  [<Fact>]
+  let ``Declared mode ratio overrides material and default ratios`` () =
+    let damped =
+      { withMaterialRatio 0.02 model with
+          Damping =
+            Some
+              { Ratio = Some 0.03
+                Modes = Some(Map [ "1", 0.01 ])
+                Rayleigh = None } }
+
+    let energies = Map [ "e1", 1.0 ]
+    Assert.Equal(0.01, Damping.ratio damped 1 energies)
+    Assert.Equal(0.02, Damping.ratio damped 2 energies)
+    let undamped = { damped with Materials = model.Materials }
+    Assert.Equal(0.03, Damping.ratio undamped 2 energies)
+    Assert.Equal(Damping.DefaultRatio, Damping.ratio model 1 energies)
+
+module ModalSuperpositionTests =
+
+  let private omega = 2.0 * System.Math.PI
+
+  [<Fact>]
+  let ``Undamped oscillator matches the exact step response`` () =
+    let dt = 0.01
+    let u = ModalSuperposition.oscillator omega 0.0 dt (Array.create 101 1.0)
+    let exact t = (1.0 - cos (omega * t)) / (omega * omega)
+
+    for i in [ 25; 50; 100 ] do
+      Assert.Equal(exact (float i * dt), u[i], 9)
+
+  [<Fact>]
+  let ``Damped oscillator settles at the static displacement`` () =
+    let u = ModalSuperposition.oscillator omega 0.2 0.01 (Array.create 2001 1.0)
+    Assert.Equal(1.0 / (omega * omega), Array.last u, 6)
+
+  [<Fact>]
+  let ``Superposition truncates to the lowest modes`` () =
+    let modes =
+      [ { Number = 2
+          AngularFrequency = 2.0 * omega
+          Shape = [| 0.0; 1.0 |] }
+        { Number = 1
+          AngularFrequency = omega
+          Shape = [| 1.0; 0.0 |] } ]
+
+    let loads = Array.create 51 [| 1.0; 1.0 |]
+    let step = Array.create 51 1.0
+    let single = ModalSuperposition.oscillator omega 0.0 0.01 step
+
+    match ModalSuperposition.response 1 (fun _ -> 0.0) modes 0.01 loads with
+    | Ok u ->
+      Assert.Equal(single[50], u[50][0], 12)
+      Assert.Equal(0.0, u[50][1])
+    | Error e -> Assert.Fail(TransientError.getAsString e)
+
+  [<Fact>]
+  let ``Transient methods parse from their names`` () =
+    Assert.Equal(Some DirectIntegration, TransientMethod.tryParse "direct")
+    let modal = TransientMethod.tryParse "Modal:10"
+    Assert.Equal(Some(ModalSuperposition 10), modal)
+    Assert.Equal(None, TransientMethod.tryParse "modal:0")
+
+module FrequencyTests =
+
+  // 2 Hz for 4 s sampled at 128 Hz, so its period spans whole samples.
+  let private dt = 1.0 / 128.0
+
+  let private sine =
+    Array.init 512 (fun i ->
+      3.0 * sin (2.0 * System.Math.PI * 2.0 * float i * dt))
+
+  [<Fact>]
+  let ``Fourier spectrum recovers a sinusoid`` () =
+    match Frequency.amplitudes dt sine with
+    | Ok components ->
+      Assert.Equal(257, components.Length)
+      Assert.Equal(64.0, components[256].Frequency, 12)
+
+      match Frequency.dominant components with
+      | Some c ->
+        Assert.Equal(2.0, c.Frequency, 12)
+        Assert.Equal(3.0, c.Amplitude, 9)
+      | None -> Assert.Fail "Expected a dominant frequency."
+    | Error e -> Assert.Fail(FrequencyError.getAsString e)
+
+  [<Fact>]
+  let ``Rigid oscillators follow the peak acceleration`` () =
+    match Frequency.responseSpectrum 0.05 dt [ 0.005; 0.5 ] sine with
+    | Ok s ->
+      Assert.Equal<float list>([ 0.005; 0.5 ], s.Periods)
+      Assert.InRange(s.Accelerations[0], 2.97, 3.03)
+      // Near resonance the oscillator amplifies the input.
+      Assert.True(s.Accelerations[1] > 10.0)
+    | Error e -> Assert.Fail(FrequencyError.getAsString e)
+
+  [<Fact>]
+  let ``Single samples are rejected`` () =
+    match Frequency.amplitudes dt [| 1.0 |] with
+    | Error(TooFewSamples 1) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module TimeHistoryTests =
+
+  let private omega = 2.0 * System.Math.PI
+
+  // Two uncoupled oscillators of unit mass at 1 Hz and 20 Hz.
+  let private system =
+    { Mass = array2D [ [ 1.0; 0.0 ]; [ 0.0; 1.0 ] ]
+      Damping = Array2D.zeroCreate 2 2
+      Stiffness =
+        array2D [ [ omega ** 2.0; 0.0 ]; [ 0.0; (20.0 * omega) ** 2.0 ] ] }
+
+  let private exact t = (1.0 - cos (omega * t)) / (omega * omega)
+
+  let private run integrator dt steps =
+    let loads = Array.create steps [| 1.0; 0.0 |]
+
+    match TimeHistory.integrate integrator system dt loads with
+    | Ok r -> r.Displacements |> Array.map (fun u -> u[0])
+    | Error e -> failwith (TransientError.getAsString e)
+
+  [<Fact>]
+  let ``Integrators follow the exact step response`` () =
+    let names =
+      [ "newmark"; "hht-alpha:0"; "hht-alpha"; "generalized-alpha" ]
+
+    for name in names do
+      match Integrator.tryParse name with
+      | Ok integrator ->
+        let u = run integrator 0.001 501
+        Assert.Equal(exact 0.25, u[250], 4)
+        Assert.Equal(exact 0.5, u[500], 4)
+      | Error e -> Assert.Fail(TransientError.getAsString e)
+
+    let u = run CentralDifference 0.001 501
+    Assert.Equal(exact 0.5, u[500], 4)
+
+  [<Fact>]
+  let ``Damped Newmark lengthens and decays the step response`` () =
+    // With γ above 1/2 the scheme is first order: it damps by a ratio of
+    // (γ - 1/2)·Ω/2 and lengthens the period by about Ω²/12, Ω = ω·Δt.
+    let dt = 0.01
+    let h = omega * dt
+    let u = run (Newmark(0.3, 0.6)) dt 1001
+    // Swing about the static displacement, relative to it.
+    let swing = u |> Array.map (fun x -> x * omega * omega - 1.0)
+
+    let crossings =
+      [ for i in 1 .. swing.Length - 1 do
+          if swing[i - 1] < 0.0 && swing[i] >= 0.0 then
+            let a, b = swing[i - 1], swing[i]
+            (float (i - 1) - a / (b - a)) * dt ]
+
+    let peaks =
+      [ for i in 1 .. swing.Length - 2 do
+          if swing[i] > swing[i - 1] && swing[i] >= swing[i + 1] then
+            swing[i] ]
+
+    let cycles = float (crossings.Length - 1)
+    let period = (List.last crossings - List.head crossings) / cycles
+
+    let ratio =
+      log (List.head peaks / List.last peaks)
+      / (2.0 * System.Math.PI * float (peaks.Length - 1))
+
+    Assert.InRange(period - 1.0, 0.95 * h * h / 12.0, 1.05 * h * h / 12.0)
+    Assert.InRange(ratio, 0.99 * 0.05 * h, 1.01 * 0.05 * h)
+
+  [<Fact>]
+  let ``Critical time step follows the highest frequency`` () =
+    match TimeHistory.criticalTimeStep system with
+    | Ok dt -> Assert.Equal(2.0 / (20.0 * omega), dt, 6)
+    | Error e -> Assert.Fail(TransientError.getAsString e)
+
+  [<Fact>]
+  let ``Central difference rejects unstable time steps`` () =
+    let loads = Array.create 10 [| 1.0; 0.0 |]
+
+    match TimeHistory.integrate CentralDifference system 0.05 loads with
+    | Error(UnstableTimeStep(step, _)) -> Assert.Equal(0.05, step)
+    | _ -> Assert.Fail "Expected an unstable time step."
+
+module ResultStreamTests =
+
+  type Row = { Step: int; Label: string; Peak: float option }
+
+  let private rows =
+    [ { Step = 0; Label = "rest"; Peak = None }
+      { Step = 1; Label = "a, b"; Peak = Some 0.5 } ]
+
+  let private written format extension =
+    let temp = System.IO.Path.GetTempFileName()
+    let path = System.IO.Path.ChangeExtension(temp, extension)
+    System.IO.File.Delete temp
+
+    let s = ResultStream.create format path
+    rows |> List.iter (ResultStream.write s)
+    ResultStream.close s
+    let lines = System.IO.File.ReadAllLines path
+    System.IO.File.Delete path
+    lines
+
+  [<Fact>]
+  let ``Results stream as JSON Lines`` () =
+    let lines = written JsonLines ".jsonl"
+    Assert.Equal(2, lines.Length)
+    let expected = """{"formatVersion":7,"step":1,"label":"a, b","peak":0.5}"""
+    Assert.Equal(expected, lines[1])
+
+  [<Fact>]
+  let ``Results stream as CSV with a header`` () =
+    let lines = written Csv ".csv"
+    Assert.Equal<string list>(
+      [ "step,label,peak"; "0,rest,"; "1,\"a, b\",0.5" ],
+      List.ofArray lines
+    )
+
+  [<Fact>]
+  let ``Stream format follows the file extension`` () =
+    Assert.Equal(Some JsonLines, StreamFormat.fromPath "out.NDJSON")
+    Assert.Equal(Some Csv, StreamFormat.fromPath "runs/out.csv")
+    Assert.Equal(None, StreamFormat.fromPath "out.h5")
+
+module ResultFileTests =
+
+  let private lines =
+    [ """{"step":0,"displacements":{"n1":{"Uy":0},"n2":{"Uy":0}}}"""
+      ""
+      """{"step":1,"displacements":{"n1":{"Uy":0},"n2":{"Uy":-0.01}}}""" ]
+
+  let private withFile (test: ResultFile -> unit) =
+    let path = System.IO.Path.GetTempFileName()
+    System.IO.File.WriteAllLines(path, lines)
+
+    match ResultFile.openFile path with
+    | Ok f ->
+      try
+        test f
+      finally
+        ResultFile.close f
+        System.IO.File.Delete path
+    | Error e -> Assert.Fail(ResultFileError.getAsString e)
+
+  [<Fact>]
+  let ``Result files index each record`` () =
+    withFile (fun f ->
+      Assert.Equal(2, ResultFile.count f)
+
+      match ResultFile.record f 1 with
+      | Ok o -> Assert.Equal(1, o["step"].GetValue<int>())
+      | Error e -> Assert.Fail(ResultFileError.getAsString e))
+
+  [<Fact>]
+  let ``Result files load only the requested nodes`` () =
+    withFile (fun f ->
+      match ResultFile.select f 1 "displacements" [ "n2" ] with
+      | Ok entries ->
+        Assert.Equal<string list>([ "n2" ], entries |> Map.keys |> List.ofSeq)
+        let uy = entries["n2"]["Uy"]
+        Assert.Equal(-0.01, uy.GetValue<float>())
+      | Error e -> Assert.Fail(ResultFileError.getAsString e)
+
+      match ResultFile.record f 2 with
+      | Error(MissingRecord(2, 2)) -> ()
+      | _ -> Assert.Fail "Expected a missing record.")
+
+module ResultFormatTests =
+
+  open System.Text.Json.Nodes
+
+  let private parse (text: string) = JsonNode.Parse(text).AsObject()
+
+  [<Fact>]
+  let ``Unversioned analysis results gain the blocks readers expect`` () =
+    let record = parse """{"modelName":"m","loadSets":[]}"""
+
+    match ResultFormat.migrate record with
+    | Ok o ->
+      Assert.Equal(ResultFormat.Version, o["formatVersion"].GetValue<int>())
+      Assert.Empty(o["reactions"].AsArray())
+      Assert.Empty(o["memberForces"].AsArray())
+      Assert.Empty(o["internalForces"].AsArray())
+      Assert.Empty(o["stresses"].AsArray())
+      Assert.Empty(o["warnings"].AsArray())
+    | Error e -> Assert.Fail(ResultFormatError.getAsString e)
+
+  [<Fact>]
+  let ``Current records are left unchanged`` () =
+    let text = """{"formatVersion":7,"step":0,"displacements":{}}"""
+
+    match ResultFormat.migrate (parse text) with
+    | Ok o -> Assert.Equal(text, o.ToJsonString())
+    | Error e -> Assert.Fail(ResultFormatError.getAsString e)
+
+  [<Fact>]
+  let ``Records of a newer format are rejected`` () =
+    match ResultFormat.migrate (parse """{"formatVersion":99}""") with
+    | Error(NewerVersion 99) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module ResultUnitsTests =
+
+  open System.Text.Json.Nodes
+  open Gazelle.Model
+
+  let private parse (text: string) = JsonNode.Parse(text).AsObject()
+
+  let private units name =
+    match UnitSystem.tryFind name with
+    | Ok u -> u
+    | Error e -> failwith (ConversionError.getAsString e)
+
+  [<Fact>]
+  let ``Results convert to the units a reader asks for`` () =
+    let record =
+      parse
+        """{"units":"kN-m","maxDisplacement":0.01,
+            "displacements":{"n1":{"Ux":0.002,"Rz":0.1}},
+            "memberForces":[{"element":"e1","forces":[1,2,3,4,5,6]}],
+            "stresses":[{"element":"e1","stress":250000,"ratio":0.5}]}"""
+
+    match ResultUnits.convert (units "N-mm") record with
+    | Ok o ->
+      let number (node: JsonNode) = node.GetValue<float>()
+      Assert.Equal("N-mm", o["units"].GetValue<string>())
+      Assert.Equal(10.0, number (o["maxDisplacement"]), 9)
+      Assert.Equal(2.0, number (o["displacements"]["n1"]["Ux"]), 9)
+      Assert.Equal(0.1, number (o["displacements"]["n1"]["Rz"]), 9)
+
+      let forces = (o["memberForces"][0]["forces"]).AsArray()
+      Assert.Equal(1e3, number (forces[0]), 6)
+      Assert.Equal(3e6, number (forces[2]), 6)
+      Assert.Equal(250.0, number (o["stresses"][0]["stress"]), 9)
+      Assert.Equal(0.5, number (o["stresses"][0]["ratio"]), 9)
+    | Error e -> Assert.Fail(ResultUnitsError.getAsString e)
+
+  [<Fact>]
+  let ``Results without units are not converted`` () =
+    let record = parse """{"formatVersion":5,"maxDisplacement":0.01}"""
+
+    match ResultUnits.convert (units "SI") record with
+    | Error UnstatedUnits -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module ResultFilterTests =
+
+  let private entry =
+    System.Text.Json.Nodes.JsonNode.Parse """{"Ux": 0.0, "Uy": -0.02}"""
+
+  [<Fact>]
+  let ``Filters compare a component ignoring case`` () =
+    let passes text =
+      match ResultFilter.tryParse text with
+      | Some f -> ResultFilter.matches f entry
+      | None -> failwith $"'{text}' did not parse"
+
+    Assert.True(passes "uy<-0.01")
+    Assert.True(passes "UY <= -0.02")
+    Assert.False(passes "uy>=0")
+    Assert.False(passes "rz<0")
+
+  [<Fact>]
+  let ``Filters round-trip through their text`` () =
+    match ResultFilter.tryParse "uy!=-0.01" with
+    | Some f -> Assert.Equal("uy!=-0.01", ResultFilter.getAsString f)
+    | None -> Assert.Fail "Expected a filter."
+
+    Assert.Equal(None, ResultFilter.tryParse "uy<<1")
+    Assert.Equal(None, ResultFilter.tryParse "<1")
+
+module InitialStateTests =
+
+  [<Fact>]
+  let ``Initial state reads displacements from a results file`` () =
+    let text =
+      """{"status": "Success", "displacements": {"n2": {"Uy": -0.01}}}"""
+
+    match InitialState.parse text with
+    | Ok s ->
+      Assert.Equal(-0.01, InitialState.displacement s "n2" Gazelle.Model.Uy)
+      Assert.Equal(0.0, InitialState.displacement s "n2" Gazelle.Model.Rz)
+      Assert.Equal(0.0, InitialState.displacement s "n1" Gazelle.Model.Uy)
+    | Error e -> Assert.Fail(InitialStateError.getAsString e)
+
+  [<Fact>]
+  let ``Initial state rejects unknown DOFs`` () =
+    match InitialState.parse """{"displacements": {"n2": {"Wy": 1}}}""" with
+    | Error(MalformedState _) -> ()
+    | _ -> Assert.Fail "Expected a malformed state."
+
+module SuperelementTests =
+
+  // Three unit springs in series between freedoms 0 and 3.
+  let private chain =
+    { Stiffness =
+        array2D
+          [ [ 1.0; -1.0; 0.0; 0.0 ]
+            [ -1.0; 2.0; -1.0; 0.0 ]
+            [ 0.0; -1.0; 2.0; -1.0 ]
+            [ 0.0; 0.0; -1.0; 1.0 ] ]
+      Mass = Array2D.init 4 4 (fun i j -> if i = j then 1.0 else 0.0)
+      Damping = Array2D.zeroCreate 4 4 }
+
+  // Fixes freedom 0 of the condensed pair and solves for freedom 3.
+  let private solveTip (se: Superelement) (f: float array) =
+    let k = se.Reduced.Stiffness
+    let fb = Superelement.loads se f
+    Superelement.expand se f [| 0.0; fb[1] / k[1, 1] |]
+
+  [<Fact>]
+  let ``Condensed springs in series have the series stiffness`` () =
+    match Superelement.condense [| 0; 3 |] chain with
+    | Ok se ->
+      Assert.Equal(1.0 / 3.0, se.Reduced.Stiffness[1, 1], 12)
+      Assert.Equal(-1.0 / 3.0, se.Reduced.Stiffness[0, 1], 12)
+      let u = solveTip se [| 0.0; 0.0; 0.0; 1.0 |]
+      Array.iter2 (fun e a -> Assert.Equal(e, a, 9)) [| 0.0; 1.0; 2.0; 3.0 |] u
+    | Error e -> Assert.Fail(CondensationError.getAsString e)
+
+  [<Fact>]
+  let ``Interior loads are condensed and recovered exactly`` () =
+    match Superelement.condense [| 0; 3 |] chain with
+    | Ok se ->
+      let u = solveTip se [| 0.0; 1.0; 0.0; 0.0 |]
+      Array.iter2 (fun e a -> Assert.Equal(e, a, 9)) [| 0.0; 1.0; 1.0; 1.0 |] u
+    | Error e -> Assert.Fail(CondensationError.getAsString e)
+
+  [<Fact>]
+  let ``Boundary outside the sub-model is rejected`` () =
+    match Superelement.condense [| 0; 4 |] chain with
+    | Error(InvalidBoundary dof) -> Assert.Equal(4, dof)
+    | _ -> Assert.Fail "Expected an invalid boundary."
+
+module SkylineTests =
+
+  // Chain of unit springs grounded at both ends, numbered out of order so
+  // its band is wide until reordered.
+  let private numbering = [| 0; 5; 1; 4; 2; 3 |]
+
+  let private chain =
+    let k = Array2D.zeroCreate 6 6
+
+    for i in 0 .. 5 do
+      k[numbering[i], numbering[i]] <- 2.0
+
+      if i < 5 then
+        k[numbering[i], numbering[i + 1]] <- -1.0
+        k[numbering[i + 1], numbering[i]] <- -1.0
+
+    k
+
+  [<Fact>]
+  let ``Reordering narrows the band of a chain to one`` () =
+    let natural = Skyline.ofMatrix (Array.init 6 id) chain
+    let reordered = Skyline.ofMatrix (Skyline.ordering chain) chain
+    Assert.Equal(5, Skyline.bandwidth natural)
+    Assert.Equal(1, Skyline.bandwidth reordered)
+    Assert.Equal(11, Skyline.size reordered)
+
+  [<Fact>]
+  let ``Skyline solution matches the dense solution`` () =
+    let b = [| 1.0; -2.0; 0.5; 3.0; 0.0; 1.5 |]
+    let s = Skyline.ofMatrix (Skyline.ordering chain) chain
+
+    match Skyline.factorise s, Matrix.factorise chain with
+    | Some f, Some lu ->
+      Array.iter2
+        (fun e a -> Assert.Equal(e, a, 9))
+        (Matrix.solve lu b)
+        (Skyline.solve f b)
+    | _ -> Assert.Fail "Expected the chain to factorise."
+
+  [<Fact>]
+  let ``Unrestrained chain is not positive definite`` () =
+    let k = Array2D.copy chain
+    k[numbering[0], numbering[0]] <- 1.0
+    k[numbering[5], numbering[5]] <- 1.0
+    let s = Skyline.ofMatrix (Skyline.ordering k) k
+    Assert.True((Skyline.factorise s).IsNone)
+
+    match Skyline.singular s with
+    | [ _, ratio ] -> Assert.True(ratio >= 1e14)
+    | other -> Assert.Fail($"Expected one singular row: {other}")
+
+  [<Fact>]
+  let ``Automatic reordering holds no more entries than either ordering`` () =
+    let banded =
+      Array.init 6 (fun i -> i, i, 2.0)
+      |> Array.append (
+        Array.init 5 (fun i -> [| i, i + 1, -1.0; i + 1, i, -1.0 |])
+        |> Array.concat
+      )
+      |> Sparse.ofEntries 6
+
+    let scattered = Sparse.ofMatrix chain
+
+    let size reordering a =
+      Skyline.ofSparseWith reordering a |> Skyline.size
+
+    Assert.Equal(15, size Reordering.Natural scattered)
+    Assert.Equal(11, size Reordering.ReverseCuthillMcKee scattered)
+    Assert.Equal(11, size Reordering.Automatic scattered)
+    Assert.Equal(11, size Reordering.Natural banded)
+    Assert.Equal(11, size Reordering.Automatic banded)
+
+module SparseTests =
+
+  // Three unit springs in series, grounded at the first node.
+  let private springs =
+    Sparse.ofEntries
+      3
+      [ 0, 0, 1.0
+        for i in 0..1 do
+          i, i, 1.0
+          i, i + 1, -1.0
+          i + 1, i, -1.0
+          i + 1, i + 1, 1.0 ]
+
+  [<Fact>]
+  let ``Entries at the same position are summed`` () =
+    Assert.Equal(7, Sparse.nonZeros springs)
+    Assert.Equal(2.0, Sparse.get springs 0 0)
+    Assert.Equal(2.0, Sparse.get springs 1 1)
+    Assert.Equal(0.0, Sparse.get springs 0 2)
+    Assert.Equal<(int * float) list>(
+      [ 1, -1.0; 2, 1.0 ],
+      Sparse.row springs 2 |> List.ofArray
+    )
+
+  [<Fact>]
+  let ``Conjugate gradients match the dense solution`` () =
+    let b = [| 1.0; -2.0; 0.5 |]
+
+    match
+      Matrix.factorise (Sparse.toMatrix springs),
+      Sparse.conjugateGradient 1e-12 springs b
+    with
+    | Some lu, Some x ->
+      Array.iter2 (fun e a -> Assert.Equal(e, a, 9)) (Matrix.solve lu b) x
+    | _ -> Assert.Fail "Expected the springs to solve."
+
+  [<Fact>]
+  let ``Incomplete Cholesky preconditioning matches the dense solution`` () =
+    // Grounded chain of 20 springs, whose IC(0) factor is exact.
+    let n = 20
+
+    let chain =
+      Sparse.ofEntries
+        n
+        [ for i in 0 .. n - 1 do
+            i, i, 2.0
+
+            if i < n - 1 then
+              i, i + 1, -1.0
+              i + 1, i, -1.0 ]
+
+    let b = Array.init n (fun i -> float (i % 3) - 1.0)
+
+    match
+      Matrix.factorise (Sparse.toMatrix chain),
+      Sparse.preconditionedConjugateGradient
+        Preconditioner.IncompleteCholesky
+        1e-12
+        chain
+        b
+    with
+    | Some lu, Some x ->
+      Array.iter2 (fun e a -> Assert.Equal(e, a, 9)) (Matrix.solve lu b) x
+    | _ -> Assert.Fail "Expected the chain to solve."
+
+  [<Fact>]
+  let ``Skyline built from sparse storage matches the dense build`` () =
+    let b = [| 3.0; 0.0; -1.0 |]
+
+    match
+      Skyline.ofSparse springs |> Skyline.factorise,
+      Matrix.factorise (Sparse.toMatrix springs)
+    with
+    | Some f, Some lu ->
+      Array.iter2
+        (fun e a -> Assert.Equal(e, a, 9))
+        (Matrix.solve lu b)
+        (Skyline.solve f b)
+    | _ -> Assert.Fail "Expected the springs to factorise."
+
+module StaticTests =
+
+  open System
+  open Gazelle.Model
+
+  let private steel =
+    { Id = "steel"
+      Name = "S355"
+      Type = "Steel"
+      ElasticModulus = 200e9
+      Density = None
+      YieldStrength = None
+      ShearModulus = None
+      DampingRatio = None
+      ThermalExpansion = None }
+
+  let element id kind nodes properties =
+    id,
+    { Id = id
+      Type = kind
+      Nodes = nodes
+      Material = "steel"
+      Properties = Some(Map properties)
+      Releases = None }
+
+  let fixity id node dofs =
+    id,
+    { Id = id
+      Type = "Fixed"
+      Node = node
+      Dof = dofs
+      Angle = None
+      Stiffness = None
+      Displacement = None }
+
+  let force id node direction magnitude =
+    id,
+    { Id = id
+      Type = "Force"
+      Node = Some node
+      Element = None
+      Direction = direction
+      Magnitude = magnitude
+      Position = None
+      End = None
+      EndMagnitude = None
+      Datum = None
+      Gradient = None
+      Case = None }
+
+  let model nodes elements constraints loads =
+    { Info =
+        { Name = "Static"
+          Description = None
+          Units = "SI"
+          Version = "1.0"
+          Dimensions = None }
+      Parameters = None
+      Gravity = None
+      Damping = None
+      TimeHistory = None
+      Nodes =
+        nodes
+        |> List.map (fun (id, x, y) -> id, { Id = id; X = x; Y = y; Z = 0.0 })
+        |> Map
+      Elements = Map elements
+      Materials = Map [ "steel", steel ]
+      Loads = Map loads
+      Combinations = Map.empty
+      Constraints = Map constraints
+      Masses = None
+      Panels = None }
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Cantilever frame deflects by PL³/3EI`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0; "n3", 4.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ]
+          element "e2" "Frame2D" [ "n2"; "n3" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n3" "Fy" -10e3; force "l2" "n3" "Fx" 50e3 ]
+
+    match analyse m with
+    | Ok r ->
+      let tip = r.Displacements["n3"]
+      let support = r.Reactions["n1"]
+      Assert.Equal(-10e3 * 4.0 ** 3.0 / (3.0 * 200e9 * 1e-4), tip[Uy], 12)
+      Assert.Equal(50e3 * 4.0 / (200e9 * 0.01), tip[Ux], 12)
+      Assert.Equal(10e3, support[Uy], 6)
+      Assert.Equal(-50e3, support[Ux], 6)
+      Assert.Equal(40e3, support[Rz], 6)
+      Assert.Equal(50e3, r.MemberForces["e2"][3], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Reactions balance the applied loads`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n2" "Fy" -10e3; force "l2" "n2" "Fx" 5e3 ]
+
+    let set = LoadCases.select m None None |> Result.map List.head
+
+    match set |> Result.map (NodalLoads.ofLoadSet m), analyse m with
+    | Ok(Ok loads), Ok r ->
+      let balance = Equilibrium.check Equilibrium.Tolerance m loads r
+      Assert.True(balance.Converged)
+      Assert.True(balance.Residual < 1e-12)
+      Assert.Equal(10e3, balance.Reactions["Fy"], 6)
+
+      let lost = { r with Reactions = Map.empty }
+      let balance = Equilibrium.check Equilibrium.Tolerance m loads lost
+      Assert.False(balance.Converged)
+      Assert.Equal(10e3 / 15e3, balance.Residual, 12)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Simply supported beam deflects by PL³/48EI`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 3.0, 0.0; "n3", 6.0, 0.0 ]
+        [ element "e1" "Beam2D" [ "n1"; "n2" ] [ "i", 2e-5 ]
+          element "e2" "Beam2D" [ "n3"; "n2" ] [ "i", 2e-5 ] ]
+        [ fixity "c1" "n1" [ "Uy" ]; fixity "c2" "n3" [ "Uy" ] ]
+        [ force "l1" "n2" "Fy" -12e3 ]
+
+    match analyse m with
+    | Ok r ->
+      let expected = -12e3 * 6.0 ** 3.0 / (48.0 * 200e9 * 2e-5)
+      Assert.Equal(expected, r.Displacements["n2"][Uy], 12)
+      Assert.Equal(0.0, r.Displacements["n2"][Rz], 12)
+      Assert.Equal(6e3, r.Reactions["n3"][Uy], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Two-bar truss carries load by axial force`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0; "n3", 2.0, 2.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n3" ] [ "area", 1e-3 ]
+          element "e2" "Truss2D" [ "n2"; "n3" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Ux"; "Uy" ] ]
+        [ force "l1" "n3" "Fy" -20e3 ]
+
+    match analyse m with
+    | Ok r ->
+      // Each bar at 45° carries P/√2 in compression.
+      let n = -20e3 / sqrt 2.0
+      let length = 2.0 * sqrt 2.0
+      let shortening = n * length / (200e9 * 1e-3)
+      Assert.Equal(n, r.MemberForces["e1"][1], 6)
+      Assert.Equal(shortening * sqrt 2.0, r.Displacements["n3"][Uy], 12)
+      Assert.Equal(0.0, r.Displacements["n3"][Ux], 12)
+      Assert.Equal(10e3, r.Reactions["n2"][Uy], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Axial forces are positive in tension`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0; "n3", 4.0, 3.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n3" ] [ "area", 1e-3 ]
+          element "e2" "Truss2D" [ "n2"; "n3" ] [ "area", 1e-3 ]
+          element "e3" "Beam2D" [ "n1"; "n2" ] [ "i", 1e-5 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]; fixity "c2" "n2" [ "Ux"; "Uy" ] ]
+        [ force "l1" "n3" "Fx" 30e3 ]
+
+    match analyse m with
+    | Ok r ->
+      // The diagonal pulls n3 back against the load; the post props it.
+      let forces = Static.axialForces r
+      Assert.Equal(37.5e3, forces["e1"], 6)
+      Assert.Equal(-22.5e3, forces["e2"], 6)
+      Assert.False(forces.ContainsKey "e3")
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Inclined roller reacts normal to its surface`` () =
+    let roller =
+      { snd (fixity "c2" "n2" [ "Uy" ]) with
+          Angle = Some 30.0
+          Stiffness = None
+          Displacement = None }
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; "c2", roller ]
+        [ force "l1" "n2" "Fy" -10e3 ]
+
+    match analyse m with
+    | Ok r ->
+      // The roller pushes n2 back along the bar as it lifts the load.
+      let c, s = cos (Math.PI / 6.0), sin (Math.PI / 6.0)
+      let normal = 10e3 / c
+      let moved = r.Displacements["n2"]
+      let forces = Static.axialForces r
+      Assert.Equal(normal, r.LocalReactions["n2"][Uy], 6)
+      Assert.Equal(-normal * s, r.Reactions["n2"][Ux], 6)
+      Assert.Equal(10e3, r.Reactions["n2"][Uy], 6)
+      Assert.Equal(-normal * s, forces["e1"], 6)
+      Assert.Equal(s / c, moved[Uy] / moved[Ux], 9)
+      Assert.False(r.LocalReactions.ContainsKey "n1")
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Reactions on supports oppose those on the structure`` () =
+    let reactions = Map [ "n1", Map [ Ux, 2.0; Uy, -3.0 ] ]
+    let apply c = ReactionConvention.apply c reactions
+    let flipped = apply ReactionConvention.OnSupport
+    let kept = apply ReactionConvention.OnStructure
+    Assert.Equal(-2.0, flipped["n1"][Ux])
+    Assert.Equal(3.0, flipped["n1"][Uy])
+    Assert.Equal<Map<string, Map<Dof, float>>>(reactions, kept)
+
+  [<Fact>]
+  let ``Solvers agree on a portal frame`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 3.0; "n3", 4.0, 3.0; "n4", 4.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ]
+          element "e2" "Frame2D" [ "n2"; "n3" ] [ "area", 0.01; "i", 2e-4 ]
+          element "e3" "Frame2D" [ "n4"; "n3" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c2" "n4" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n2" "Fx" 5e3; force "l2" "n3" "Fy" -20e3 ]
+
+    let solve solver =
+      match LoadCases.select m None None with
+      | Ok [ set ] ->
+        NodalLoads.ofLoadSet m set
+        |> Result.mapError FailedLoads
+        |> Result.bind (fun loads ->
+          Static.assemble m
+          |> Result.bind (fun a -> Static.solveWith solver m a loads))
+      | other -> failwith $"Unexpected load sets: {other}"
+
+    match
+      solve LinearSolver.defaultSolver,
+      solve (LinearSolver.Skyline Reordering.Natural),
+      solve LinearSolver.Dense,
+      solve (LinearSolver.Pcg Preconditioner.Jacobi),
+      solve (LinearSolver.Pcg Preconditioner.IncompleteCholesky)
+    with
+    | Ok skyline, Ok natural, Ok dense, Ok jacobi, Ok cholesky ->
+      for r in [ natural; dense; jacobi; cholesky ] do
+        for KeyValue(node, dofs) in skyline.Displacements do
+          for KeyValue(dof, x) in dofs do
+            Assert.Equal(x, r.Displacements[node][dof], 9)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Unrestrained structure is a mechanism`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Uy" ] ]
+        [ force "l1" "n2" "Fy" -1.0 ]
+
+    // Free to slide along X and to rotate about the support.
+    match analyse m with
+    | Error(Mechanism dofs) -> Assert.Equal(2, dofs.Length)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Nearly singular stiffness is ill-conditioned, not a mechanism`` () =
+    // Unit spring grounded only through a spring of 10⁻¹³.
+    let k =
+      Sparse.ofEntries
+        2
+        [ 0, 0, 1.0; 0, 1, -1.0; 1, 0, -1.0; 1, 1, 1.0 + 1e-13 ]
+
+    let dofs = [| "n1", Ux; "n2", Ux |]
+    let solver = LinearSolver.defaultSolver
+
+    match Static.solveSystem solver dofs k [| 0.0; 1.0 |] with
+    | Error(IllConditioned([ _ ], ratio)) -> Assert.InRange(ratio, 1e12, 1e14)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  let private heat id element temperature gradient =
+    let _, l = force id "" "Temperature" temperature
+
+    id,
+    { l with
+        Type = "Thermal"
+        Node = None
+        Element = Some element
+        Gradient = gradient }
+
+  let private expanding (m: Model) =
+    { m with
+        Materials =
+          Map [ "steel", { steel with ThermalExpansion = Some 12e-6 } ] }
+
+  [<Fact>]
+  let ``Restrained bar is compressed by heating`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 3.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Ux"; "Uy" ] ]
+        [ heat "l1" "e1" 40.0 None ]
+      |> expanding
+
+    match analyse m with
+    | Ok r ->
+      let n = -200e9 * 1e-3 * 12e-6 * 40.0
+      Assert.Equal(n, r.MemberForces["e1"][1], 6)
+      Assert.Equal(n, r.Reactions["n2"][Ux], 6)
+      Assert.Equal(0.0, r.Displacements["n2"][Ux], 12)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Free bar expands by αΔTL`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 3.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        [ heat "l1" "e1" 40.0 None ]
+      |> expanding
+
+    match analyse m with
+    | Ok r ->
+      Assert.Equal(12e-6 * 40.0 * 3.0, r.Displacements["n2"][Ux], 12)
+      Assert.Equal(0.0, r.MemberForces["e1"][1], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Thermal gradient bends a fixed beam by EIαΔT/h`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c2" "n2" [ "Ux"; "Uy"; "Rz" ] ]
+        [ heat "l1" "e1" 0.0 (Some 50.0) ]
+      |> expanding
+
+    match analyse m with
+    | Ok r ->
+      let moment = 200e9 * 1e-4 * 12e-6 * 50.0
+      Assert.Equal(-moment, r.MemberForces["e1"][2], 6)
+      Assert.Equal(moment, r.MemberForces["e1"][5], 6)
+      Assert.Equal(0.0, r.MemberForces["e1"][4], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Thermal gradient rotates simple supports by αgL/2`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0 ]
+        [ element "e1" "Beam2D" [ "n1"; "n2" ] [ "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        [ heat "l1" "e1" 0.0 (Some 50.0) ]
+      |> expanding
+
+    match analyse m with
+    | Ok r ->
+      let rotation = 12e-6 * 50.0 * 4.0 / 2.0
+      Assert.Equal(rotation, r.Displacements["n1"][Rz], 12)
+      Assert.Equal(-rotation, r.Displacements["n2"][Rz], 12)
+      Assert.Equal(0.0, r.MemberForces["e1"][3], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+module SubstructureTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private section = [ "area", 0.01; "i", 1e-4 ]
+
+  // Two-element panel from a to b, condensed onto its end nodes.
+  let private panel =
+    model
+      [ "a", 0.0, 0.0; "m", 0.0, 1.0; "b", 0.0, 2.0 ]
+      [ element "p1" "Frame2D" [ "a"; "m" ] section
+        element "p2" "Frame2D" [ "m"; "b" ] section ]
+      []
+      []
+
+  // Cantilever whose middle 2 m is the panel, joined at n2 and n3.
+  let private column =
+    model
+      [ "n1", 0.0, 0.0; "n2", 0.0, 2.0; "n3", 0.0, 4.0; "n4", 0.0, 6.0 ]
+      [ element "e1" "Frame2D" [ "n1"; "n2" ] section
+        element "e3" "Frame2D" [ "n3"; "n4" ] section ]
+      [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+      []
+
+  let private full =
+    model
+      [ "n1", 0.0, 0.0
+        "n2", 0.0, 2.0
+        "nm", 0.0, 3.0
+        "n3", 0.0, 4.0
+        "n4", 0.0, 6.0 ]
+      [ element "e1" "Frame2D" [ "n1"; "n2" ] section
+        element "p1" "Frame2D" [ "n2"; "nm" ] section
+        element "p2" "Frame2D" [ "nm"; "n3" ] section
+        element "e3" "Frame2D" [ "n3"; "n4" ] section ]
+      [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+      []
+
+  let private load node direction magnitude : NodalLoad =
+    { Node = node
+      Direction = direction
+      Magnitude = magnitude }
+
+  [<Fact>]
+  let ``Placed substructures match the full model`` () =
+    let expected =
+      Static.assemble full
+      |> Result.bind (fun a ->
+        Static.solve full a [ load "n4" "Fx" 1e3; load "nm" "Fx" 500.0 ])
+
+    let placed =
+      Substructure.condense [ "a"; "b" ] panel
+      |> Result.bind (fun s ->
+        let placement =
+          { Id = "panel"
+            Substructure = s
+            Nodes = Map [ "a", "n2"; "b", "n3" ]
+            Loads = [ load "m" "Fx" 500.0 ] }
+
+        Substructure.solve
+          LinearSolver.defaultSolver
+          column
+          [ placement ]
+          [ load "n4" "Fx" 1e3 ])
+
+    match expected, placed with
+    | Ok e, Ok r ->
+      let tip = e.Displacements["n4"]
+      let middle = e.Displacements["nm"]
+      Assert.Equal(tip[Ux], r.Model.Displacements["n4"][Ux], 12)
+      Assert.Equal(tip[Rz], r.Model.Displacements["n4"][Rz], 12)
+      Assert.Equal(middle[Ux], r.Placements["panel"]["m"][Ux], 12)
+      Assert.Equal(e.Reactions["n1"][Ux], r.Model.Reactions["n1"][Ux], 6)
+    | Error e, _ -> Assert.Fail(StaticError.getAsString e)
+    | _, Error e -> Assert.Fail(SubstructureError.getAsString e)
+
+  [<Fact>]
+  let ``Placements join every boundary node`` () =
+    let placed =
+      Substructure.condense [ "a"; "b" ] panel
+      |> Result.bind (fun s ->
+        let placement =
+          { Id = "panel"
+            Substructure = s
+            Nodes = Map [ "a", "n2" ]
+            Loads = [] }
+
+        Substructure.solve LinearSolver.defaultSolver column [ placement ] [])
+
+    match placed with
+    | Error(UnjoinedNode("panel", "b")) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  // Bar of axial stiffness 1e8 N/m whose free end is held by a spring.
+  let private bar =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        []
+
+    let steel = m.Materials["steel"]
+
+    { m with
+        Materials = Map [ "steel", { steel with Density = Some 7850.0 } ] }
+
+  let private spring (k: float) (mass: float) =
+    let matrix x = Sparse.ofMatrix (array2D [ [ x ] ])
+
+    Substructure.ofMatrices [| "s", Ux |] (matrix k) (Some(matrix mass))
+    |> Result.map (fun s ->
+      { Id = "bearing"
+        Substructure = s
+        Nodes = Map [ "s", "n2" ]
+        Loads = [] })
+
+  [<Fact>]
+  let ``Imported matrices act at the nodes they are joined to`` () =
+    let placed =
+      spring 3e8 0.0
+      |> Result.bind (fun p ->
+        Substructure.solve
+          LinearSolver.defaultSolver
+          bar
+          [ p ]
+          [ load "n2" "Fx" 4e3 ])
+
+    match placed with
+    | Ok r -> Assert.Equal(1e-5, r.Model.Displacements["n2"][Ux], 12)
+    | Error e -> Assert.Fail(SubstructureError.getAsString e)
+
+  [<Fact>]
+  let ``Imported mass joins the model in modes`` () =
+    let modes =
+      spring 0.0 100.0
+      |> Result.bind (fun p ->
+        Substructure.modes MassMatrix.Lumped 1 bar [ p ])
+
+    // Half the bar's 15.7 kg is lumped at its free end.
+    let expected = sqrt (1e8 / (100.0 + 7.85)) / (2.0 * System.Math.PI)
+
+    match modes with
+    | Ok r -> Assert.Equal(expected, Modal.frequency r.Modes.Head, 6)
+    | Error e -> Assert.Fail(SubstructureError.getAsString e)
+
+module PunchingTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // Four 2 m plates around n5 of C30/37 concrete.
+  let private slab =
+    let plate id nodes =
+      let reinforced = [ "rho_x", 0.005; "rho_y", 0.005 ]
+      element id "Plate" nodes ([ "thickness", 0.25; "d", 0.2 ] @ reinforced)
+
+    let m =
+      model
+        [ for j in 0..2 do
+            for i in 0..2 -> $"n{3 * j + i + 1}", 2.0 * float i, 2.0 * float j ]
+        [ plate "p1" [ "n1"; "n2"; "n5"; "n4" ]
+          plate "p2" [ "n2"; "n3"; "n6"; "n5" ]
+          plate "p3" [ "n4"; "n5"; "n8"; "n7" ]
+          plate "p4" [ "n5"; "n6"; "n9"; "n8" ] ]
+        []
+        []
+
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x ->
+            { x with
+                Type = "Concrete"
+                YieldStrength = Some 30e6 }) }
+
+  [<Fact>]
+  let ``Internal columns check v_Ed against v_Rd,c`` () =
+    match Punching.check slab (Some(0.4, 0.4)) "n5" (Map [ "Uz", 365e3 ]) with
+    | Some c ->
+      let u1 = 1.6 + 4.0 * System.Math.PI * 0.2
+      Assert.Equal(1.15, c.Beta)
+      Assert.Equal(u1, c.Perimeter, 9)
+      Assert.Equal(1.15 * 365e3 / (u1 * 0.2), c.Stress, 3)
+      // k = 2, so v_Rd,c = 0.12 × 2 × (100 × 0.005 × 30)^⅓ MPa.
+      Assert.Equal(0.24 * 15.0 ** (1.0 / 3.0) * 1e6, c.Resistance, 3)
+    | None -> Assert.Fail("Expected a check")
+
+  [<Fact>]
+  let ``Edge and corner supports enhance the shear on part perimeters`` () =
+    let check node = Punching.check slab None node (Map [ "Uz", -1e5 ])
+
+    match check "n2", check "n1", check "e1" with
+    | Some edge, Some corner, None ->
+      Assert.Equal(1.4, edge.Beta)
+      Assert.Equal(2.0 * System.Math.PI * 0.2, edge.Perimeter, 9)
+      Assert.Equal(1.5, corner.Beta)
+      Assert.Equal(System.Math.PI * 0.2, corner.Perimeter, 9)
+      Assert.Equal(1e5, corner.Force)
+    | other -> Assert.Fail($"Unexpected checks: {other}")
+
+module FireTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // Pin-ended steel column 4 m long, with a section factor of 200/m.
+  let private column =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 4.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [
+            "area", 0.01
+            "i", 1e-4
+            "zz", 1e-3
+            "section_factor", 200.0
+          ] ]
+        []
+        []
+
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x -> { x with YieldStrength = Some 355e6 }) }
+
+  [<Fact>]
+  let ``Reduction factors interpolate EN 1993-1-2 Table 3.1`` () =
+    let ky, ke = Fire.reduction 550.0
+    Assert.Equal(0.625, ky, 9)
+    Assert.Equal(0.455, ke, 9)
+    Assert.Equal((1.0, 1.0), Fire.reduction 20.0)
+    Assert.Equal((0.0, 0.0), Fire.reduction 1250.0)
+
+  [<Fact>]
+  let ``Critical temperature is where the reduced strength is used up`` () =
+    // k_y,θ = 0.5 lies 28/31 of the way from 500 °C to 600 °C.
+    let critical = Fire.critical (Some 0.5) None
+    Assert.Equal(500.0 + 2800.0 / 31.0, critical.Value, 1)
+    Assert.Equal(None, Fire.critical (Some 1.2) None)
+
+  [<Fact>]
+  let ``Unprotected steel lags the standard fire`` () =
+    let gas = Fire.standardFire 30.0
+    let slender = Fire.steelTemperature 200.0 30.0
+    let stocky = Fire.steelTemperature 50.0 30.0
+    Assert.Equal(841.8, gas, 1)
+    Assert.InRange(slender, stocky, gas)
+    Assert.InRange(stocky, 400.0, slender)
+
+  [<Fact>]
+  let ``Fire divides utilisations by the reduced strength and stiffness`` () =
+    let forces = [| -100e3; 0.0; 0.0; 100e3; 0.0; 20e3 |]
+
+    match
+      Design.check column "e1" forces [],
+      Fire.check column (FireExposure.Temperature 550.0) "e1" forces []
+    with
+    | Some ambient, Some hot ->
+      Assert.Equal(ambient.Strength.Value / 0.625, hot.Strength.Value, 9)
+      Assert.Equal(ambient.Buckling.Value / 0.455, hot.Buckling.Value, 9)
+      Assert.Equal(
+        Fire.critical ambient.Strength ambient.Buckling,
+        hot.CriticalTemperature
+      )
+    | other -> Assert.Fail($"Unexpected checks: {other}")
+
+  [<Fact>]
+  let ``Standard fire heats members by their section factor`` () =
+    let forces = [| -100e3; 0.0; 0.0; 100e3; 0.0; 0.0 |]
+
+    match Fire.check column (FireExposure.Duration 30.0) "e1" forces [] with
+    | Some c -> Assert.Equal(Fire.steelTemperature 200.0 30.0, c.Temperature)
+    | None -> Assert.Fail("Expected a check")
+
+  [<Fact>]
+  let ``Fire exposures parse as durations or temperatures`` () =
+    Assert.Equal(Some(FireExposure.Duration 60.0), FireExposure.tryParse "R60")
+    Assert.Equal(
+      Some(FireExposure.Temperature 550.0),
+      FireExposure.tryParse "550C"
+    )
+    Assert.Equal(None, FireExposure.tryParse "R300")
+    Assert.Equal("R60", FireExposure.getAsString (FireExposure.Duration 60.0))
+
+module MasonryTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // Pier 3 m tall, 200 mm thick and 1 m wide, of masonry with fk = 5 MPa.
+  let private pier =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 3.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [
+            "thickness", 0.2
+            "width", 1.0
+            "i", 6.67e-4
+          ] ]
+        []
+        []
+
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x ->
+            { x with
+                Type = "Masonry"
+                ElasticModulus = 5e9
+                YieldStrength = Some 5e6 }) }
+
+  [<Fact>]
+  let ``End factor takes at least the minimum eccentricity`` () =
+    Assert.Equal(0.9, Masonry.endFactor 0.2 0.0, 12)
+    Assert.Equal(0.5, Masonry.endFactor 0.2 0.05, 12)
+    Assert.Equal(0.0, Masonry.endFactor 0.2 0.15)
+
+  [<Fact>]
+  let ``Slender piers lose resistance at mid-height`` () =
+    let stocky = Masonry.middleFactor 0.2 0.01 1.0 1000.0
+    let slender = Masonry.middleFactor 0.2 0.01 4.0 1000.0
+    Assert.InRange(slender, 0.0, stocky)
+    Assert.InRange(stocky, 0.0, 0.9)
+    Assert.Equal(0.0, Masonry.middleFactor 0.2 0.01 6.0 1000.0)
+
+  [<Fact>]
+  let ``Concentric load is checked at the ends and mid-height`` () =
+    let forces = [| 100e3; 0.0; 0.0; -100e3; 0.0; 0.0 |]
+    let resistance = 0.2 * 5e6
+    let middle = Masonry.middleFactor 0.2 0.01 3.0 1000.0
+
+    match Design.check pier "e1" forces [] with
+    | Some c ->
+      Assert.Equal(100e3 / (0.9 * resistance), c.Strength.Value, 9)
+      Assert.Equal(100e3 / (middle * resistance), c.Buckling.Value, 9)
+      Assert.Equal(c.Buckling.Value, c.Utilisation)
+    | None -> Assert.Fail("Expected a check")
+
+  [<Fact>]
+  let ``Masonry in tension has no resistance`` () =
+    let forces = [| -10e3; 0.0; 0.0; 10e3; 0.0; 0.0 |]
+
+    match Masonry.check pier pier.Elements["e1"] forces [] with
+    | Some(ends, _) -> Assert.True(System.Double.IsPositiveInfinity ends)
+    | None -> Assert.Fail("Expected a check")
+
+module ColdFormedTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // Stud whose web is 60 times as wide as it is thick, with fy = 235 MPa.
+  let private stud kind =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 3.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [
+            "area", 4e-4
+            "i", 1e-6
+            "zz", 2e-5
+            "flat_width", 0.06
+            "t", 0.001
+          ] ]
+        []
+        []
+
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x ->
+            { x with
+                Type = kind
+                YieldStrength = Some 235e6 }) }
+
+  [<Fact>]
+  let ``Stocky plates are fully effective`` () =
+    Assert.Equal(1.0, ColdFormed.reduction 0.6 4.0)
+    Assert.Equal(1.0, ColdFormed.reduction 0.7 0.43)
+    Assert.Equal(0.78, ColdFormed.reduction 1.0 4.0, 12)
+    Assert.Equal(0.812, ColdFormed.reduction 1.0 0.43, 12)
+
+  [<Fact>]
+  let ``Slender webs reduce the effective section`` () =
+    let m = stud "ColdFormedSteel"
+    let slenderness = 60.0 / (28.4 * 2.0)
+    let rho = (slenderness - 0.22) / slenderness ** 2.0
+    Assert.Equal(rho, ColdFormed.effectiveFactor m m.Elements["e1"], 12)
+
+  [<Fact>]
+  let ``Cold-formed members are stressed on their effective section`` () =
+    let forces = [| 40e3; 0.0; 1e3; -40e3; 0.0; 0.0 |]
+    let m = stud "ColdFormedSteel"
+    let rho = ColdFormed.effectiveFactor m m.Elements["e1"]
+    let effective = Design.memberStress m "e1" forces []
+    let gross = Design.memberStress (stud "Steel") "e1" forces []
+    Assert.Equal(gross.Stress / rho, effective.Stress, 6)
+
+module SpaceFrameTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private section = [ "area", 0.01; "iy", 2e-5; "iz", 1e-4; "j", 3e-5 ]
+
+  let private clamp = [ "Ux"; "Uy"; "Uz"; "Rx"; "Ry"; "Rz" ]
+
+  /// Places the nodes of a model in space and gives its steel a shear
+  /// modulus.
+  let private spatial nodes (m: Model) =
+    { m with
+        Nodes =
+          nodes
+          |> List.map (fun (id, x, y, z) ->
+            id, { Id = id; X = x; Y = y; Z = z })
+          |> Map
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x -> { x with ShearModulus = Some 80e9 }) }
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Space cantilever bends about both axes and twists`` () =
+    let m =
+      model
+        []
+        [ element "e1" "Frame3D" [ "n1"; "n2" ] section ]
+        [ fixity "c1" "n1" clamp ]
+        [ force "l1" "n2" "Fy" -2e3
+          force "l2" "n2" "Fz" 1e3
+          force "l3" "n2" "Mx" 500.0 ]
+      |> spatial [ "n1", 0.0, 0.0, 0.0; "n2", 3.0, 0.0, 0.0 ]
+
+    match analyse m with
+    | Ok r ->
+      let tip = r.Displacements["n2"]
+      Assert.Equal(-2e3 * 27.0 / (3.0 * 200e9 * 1e-4), tip[Uy], 12)
+      Assert.Equal(1e3 * 27.0 / (3.0 * 200e9 * 2e-5), tip[Uz], 12)
+      Assert.Equal(-1e3 * 9.0 / (2.0 * 200e9 * 2e-5), tip[Ry], 12)
+      Assert.Equal(500.0 * 3.0 / (80e9 * 3e-5), tip[Rx], 12)
+      Assert.Equal(-500.0, r.Reactions["n1"][Rx], 6)
+      Assert.Equal(3e3, r.Reactions["n1"][Ry], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Vertical column takes its local y axis along global Y`` () =
+    let m =
+      model
+        []
+        [ element "e1" "Frame3D" [ "n1"; "n2" ] section ]
+        [ fixity "c1" "n1" clamp ]
+        [ force "l1" "n2" "Fx" 1e3; force "l2" "n2" "Fy" 1e3 ]
+      |> spatial [ "n1", 0.0, 0.0, 0.0; "n2", 0.0, 0.0, 4.0 ]
+
+    match analyse m with
+    | Ok r ->
+      // Sway along X bends about local y; sway along Y about local z.
+      let tip = r.Displacements["n2"]
+      Assert.Equal(1e3 * 64.0 / (3.0 * 200e9 * 2e-5), tip[Ux], 12)
+      Assert.Equal(1e3 * 64.0 / (3.0 * 200e9 * 1e-4), tip[Uy], 12)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Tripod shares a vertical load between its legs`` () =
+    let legs = [ "n2", 0.0; "n3", 120.0; "n4", 240.0 ]
+
+    let m =
+      model
+        []
+        [ for i, (node, _) in List.indexed legs do
+            element $"e{i + 1}" "Truss3D" [ node; "n1" ] [ "area", 1e-3 ] ]
+        [ for node, _ in legs do
+            fixity $"c{node}" node [ "Ux"; "Uy"; "Uz" ] ]
+        [ force "l1" "n1" "Fz" -30e3 ]
+      |> spatial
+        [ "n1", 0.0, 0.0, 4.0
+          for node, angle in legs do
+            let a = angle * System.Math.PI / 180.0
+            node, 3.0 * cos a, 3.0 * sin a, 0.0 ]
+
+    match analyse m with
+    | Ok r ->
+      // Each 3-4-5 leg carries a third of the load over its slope.
+      for i in 1..3 do
+        Assert.Equal(-12.5e3, r.MemberForces[$"e{i}"][1], 6)
+
+      Assert.Equal(10e3, r.Reactions["n2"][Uz], 6)
+      Assert.Equal(0.0, r.Displacements["n1"][Ux], 12)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Beam3D twists and bends as a space frame along X`` () =
+    let build kind =
+      model
+        []
+        [ element "e1" kind [ "n1"; "n2" ] section ]
+        [ fixity "c1" "n1" clamp ]
+        [ force "l1" "n2" "Fz" 1e3; force "l2" "n2" "Mx" 500.0 ]
+      |> spatial [ "n1", 0.0, 0.0, 0.0; "n2", 3.0, 0.0, 0.0 ]
+
+    match analyse (build "Beam3D"), analyse (build "Frame3D") with
+    | Ok beam, Ok frame ->
+      for dof in [ Uz; Rx; Ry ] do
+        let expected = frame.Displacements["n2"][dof]
+        Assert.Equal(expected, beam.Displacements["n2"][dof], 12)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Space frame needs a shear modulus`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 3.0, 0.0 ]
+        [ element "e1" "Frame3D" [ "n1"; "n2" ] section ]
+        [ fixity "c1" "n1" clamp ]
+        [ force "l1" "n2" "Fz" 1e3 ]
+
+    match analyse m with
+    | Error(MissingShearModulus("e1", "steel")) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module ShellTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private clamp = [ "Ux"; "Uy"; "Uz"; "Rx"; "Ry"; "Rz" ]
+
+  /// Cantilever strip 4 m long and 1 m wide, clamped along x = 0, of
+  /// plates in the XY plane or the XZ plane, loaded at its tip.
+  let private strip kind vertical direction =
+    let count = 16
+
+    let nodes =
+      [ for i in 0..count do
+          let x = 0.25 * float i
+          $"a{i}", { Id = $"a{i}"; X = x; Y = 0.0; Z = 0.0 }
+
+          let b =
+            if vertical then
+              { Id = $"b{i}"; X = x; Y = 0.0; Z = 1.0 }
+            else
+              { Id = $"b{i}"; X = x; Y = 1.0; Z = 0.0 }
+
+          $"b{i}", b ]
+
+    let m =
+      model
+        []
+        [ for i in 0 .. count - 1 do
+            let corners = [ $"a{i}"; $"a{i + 1}"; $"b{i + 1}"; $"b{i}" ]
+            element $"e{i}" kind corners [ "thickness", 0.1 ] ]
+        [ fixity "ca" "a0" clamp; fixity "cb" "b0" clamp ]
+        [ force "la" $"a{count}" direction 500.0
+          force "lb" $"b{count}" direction 500.0 ]
+
+    { m with
+        Nodes = Map nodes
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x -> { x with ShearModulus = Some 80e9 }) }
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Slab strip deflects as a cantilever of plate rigidity`` () =
+    // D = Et³/12(1 - ν²) with ν = E/2G - 1 = 0.25.
+    let rigidity = 200e9 * 0.1 ** 3.0 / (12.0 * (1.0 - 0.25 ** 2.0))
+
+    match analyse (strip "Plate" false "Fz") with
+    | Ok r ->
+      let expected = 1e3 * 64.0 / (3.0 * rigidity)
+      Assert.InRange(r.Displacements["a16"][Uz], expected, 1.1 * expected)
+      Assert.Equal(-500.0, r.Reactions["a0"][Uz], 6)
+      // The mean moment of the first plate is taken at x = 0.125.
+      let forces = r.PlateForces["e0"]
+      Assert.Equal(-1e3 * 3.875, forces[3], 6)
+      Assert.Equal(1e3, forces[6], 6)
+      Assert.Empty(r.MemberForces)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Shell wall matches a slab strip turned on its side`` () =
+    match analyse (strip "Plate" false "Fz"), analyse (strip "Shell" true "Fy") with
+    | Ok slab, Ok wall ->
+      let expected = slab.Displacements["a16"][Uz]
+      Assert.Equal(expected, wall.Displacements["a16"][Uy], 12)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Shell stretches in its plane under tension`` () =
+    match analyse (strip "Shell" false "Fx") with
+    | Ok r ->
+      // Poisson contraction restrained at the clamp stiffens it slightly.
+      let expected = 1e3 * 4.0 / (200e9 * 0.1)
+      Assert.InRange(r.Displacements["a16"][Ux], 0.98 * expected, expected)
+      Assert.Equal(1e3, r.PlateForces["e8"][0], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Warped shell is rejected`` () =
+    let m =
+      strip "Shell" false "Fz"
+      |> fun m ->
+        { m with
+            Nodes = m.Nodes.Add("b1", { Id = "b1"; X = 0.25; Y = 1.0; Z = 0.2 }) }
+
+    match analyse m with
+    | Error(MisalignedElement("e0", "must be flat")) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module SpringTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Bar and grounded spring share a load by stiffness`` () =
+    let bar = 200e9 * 1e-3 / 2.0
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ]
+          element "s1" "Spring" [ "n2" ] [ "ux", bar ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ] ]
+        [ force "l1" "n2" "Fx" 10e3 ]
+
+    match analyse m with
+    | Ok r ->
+      Assert.Equal(10e3 / (2.0 * bar), r.Displacements["n2"][Ux], 12)
+      Assert.Equal(5e3, r.SpringForces["s1"][Ux], 6)
+      Assert.Equal(-5e3, r.Reactions["n1"][Ux], 6)
+      Assert.False(r.MemberForces.ContainsKey "s1")
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Rotational support spring gives partial fixity`` () =
+    let k = 1e7
+    let elastic =
+      { snd (fixity "c1" "n1" [ "Ux"; "Uy" ]) with
+          Stiffness = Some(Map [ "Rz", k ]) }
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ "c1", elastic ]
+        [ force "l1" "n2" "Fy" -10e3 ]
+
+    match analyse m with
+    | Ok r ->
+      // Bending of the cantilever plus rigid rotation about the spring.
+      let expected =
+        -10e3 * 4.0 ** 3.0 / (3.0 * 200e9 * 1e-4) - 10e3 * 4.0 ** 2.0 / k
+
+      Assert.Equal(expected, r.Displacements["n2"][Uy], 12)
+      Assert.Equal(40e3, r.Reactions["n1"][Rz], 6)
+      Assert.Equal(10e3, r.Reactions["n1"][Uy], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Settlement of a fixed end adds 12EIδ/L³ to its reaction`` () =
+    let delta = -0.01
+    let clamp = [ "Ux"; "Uy"; "Rz" ]
+
+    let settled =
+      { snd (fixity "c2" "n3" clamp) with
+          Type = "Prescribed"
+          Displacement = Some(Map [ "Uy", delta ]) }
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 3.0, 0.0; "n3", 6.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ]
+          element "e2" "Frame2D" [ "n2"; "n3" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" clamp; "c2", settled ]
+        [ force "l1" "n2" "Fy" -12e3 ]
+
+    match analyse m with
+    | Ok r ->
+      let ei = 200e9 * 1e-4
+      let shear = 12.0 * ei * delta / 6.0 ** 3.0
+      Assert.Equal(delta, r.Displacements["n3"][Uy], 12)
+      Assert.Equal(6e3 + shear, r.Reactions["n3"][Uy], 6)
+      Assert.Equal(6e3 - shear, r.Reactions["n1"][Uy], 6)
+      let moment = 12e3 * 6.0 / 8.0 - 6.0 * ei * delta / 6.0 ** 2.0
+      Assert.Equal(moment, r.Reactions["n1"][Rz], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+module EnergyTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  [<Fact>]
+  let ``Cantilever stores the work of its tip load, mostly at the root`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0; "n3", 4.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ]
+          element "e2" "Frame2D" [ "n2"; "n3" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n3" "Fy" -10e3 ]
+
+    let set = LoadCases.select m None None |> Result.map List.head
+    let loads = set |> Result.map (NodalLoads.ofLoadSet m)
+
+    match loads, Static.assemble m, set |> Result.map (Static.analyse m) with
+    | Ok(Ok loads), Ok a, Ok(Ok r) ->
+      match Energy.ofStatic m a loads r with
+      | Ok b ->
+        let work = 10e3 ** 2.0 * 4.0 ** 3.0 / (6.0 * 200e9 * 1e-4)
+        Assert.Equal(work, b.ExternalWork, 9)
+        Assert.Equal(work, b.StrainEnergy, 9)
+        Assert.Equal(0.0, b.Imbalance, 12)
+        Assert.Equal(0.0, b.Supports, 9)
+        Assert.Equal(7.0 / 8.0 * work, b.Elements["e1"], 9)
+        Assert.Equal(1.0 / 8.0 * work, b.Elements["e2"], 9)
+      | Error e -> Assert.Fail(StaticError.getAsString e)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Average acceleration conserves energy over a damped history`` () =
+    let omega = 2.0 * System.Math.PI
+
+    let d: DynamicSystem =
+      { Dofs = [| "n1", Ux |]
+        System =
+          { Mass = array2D [ [ 1.0 ] ]
+            Damping = array2D [ [ 0.1 * omega ] ]
+            Stiffness = array2D [ [ omega ** 2.0 ] ] }
+        TimeStep = 0.01
+        Loads = Array.init 200 (fun k -> [| sin (0.05 * float k) |]) }
+
+    match TimeHistory.integrate (Newmark(0.25, 0.5)) d.System 0.01 d.Loads with
+    | Ok response ->
+      let r = { Dofs = d.Dofs; Times = [||]; Response = response }
+      let energies = Energy.ofDynamic d r
+      Assert.Equal(200, energies.Length)
+      Assert.Equal(0.0, energies[0].ExternalWork)
+
+      for e in energies do
+        Assert.Equal(0.0, e.Imbalance, 12)
+
+      let last = energies[199]
+      Assert.True(last.Damping > 0.0)
+      Assert.Equal(1.99, last.Time, 12)
+    | Error e -> Assert.Fail(TransientError.getAsString e)
+
+  [<Fact>]
+  let ``Elements rank by their densest load set`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0; "n3", 4.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ]
+          element "e2" "Truss2D" [ "n2"; "n3" ] [ "area", 2e-3 ]
+          element "s1" "Spring" [ "n3" ] [ "ux", 1e6 ] ]
+        []
+        []
+
+    let energies =
+      [ "DL", Map [ "e1", 4.0; "e2", 2.0; "s1", 1.0 ]
+        "LL", Map [ "e1", 1.0; "e2", 6.0 ] ]
+
+    match Energy.rank m energies with
+    | [ first; second ] ->
+      Assert.Equal("e1", first.Element)
+      Assert.Equal("DL", first.LoadSet)
+      Assert.Equal(2000.0, first.Density, 9)
+      Assert.Equal(2.0, first.Relative, 12)
+      Assert.Equal("e2", second.Element)
+      Assert.Equal("LL", second.LoadSet)
+      Assert.Equal(1500.0, second.Density, 9)
+      Assert.Equal(1500.0 / (7.0 / 6e-3), second.Relative, 12)
+    | other -> Assert.Fail($"Unexpected ranking: {other}")
+
+module UnilateralTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Cross-braced panel sheds its compression diagonal`` () =
+    let bar = [ "area", 1e-2 ]
+    let brace = [ "area", 5e-4 ]
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0; "n3", 4.0, 3.0; "n4", 0.0, 3.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n4" ] bar
+          element "e2" "Truss2D" [ "n2"; "n3" ] bar
+          element "e3" "Truss2D" [ "n4"; "n3" ] bar
+          element "e4" "Cable" [ "n1"; "n3" ] brace
+          element "e5" "Cable" [ "n2"; "n4" ] brace ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Ux"; "Uy" ] ]
+        [ force "l1" "n4" "Fx" 10e3 ]
+
+    match analyse m with
+    | Ok r ->
+      // The tension diagonal alone carries the shear, H·5/4.
+      Assert.Equal(12.5e3, r.MemberForces["e4"][1], 6)
+      Assert.Equal<float array>([| 0.0; 0.0 |], r.MemberForces["e5"])
+      Assert.Equal(-10e3, r.Reactions["n1"][Ux] + r.Reactions["n2"][Ux], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Strut lifts off under uplift`` () =
+    let m load =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 1.0; "n3", 0.0, 3.0 ]
+        [ element "e1" "Strut" [ "n1"; "n2" ] [ "area", 1e-3 ]
+          element "e2" "Truss2D" [ "n2"; "n3" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c3" "n3" [ "Ux"; "Uy" ] ]
+        [ force "l1" "n2" "Fy" load ]
+
+    match analyse (m 30e3), analyse (m -30e3) with
+    | Ok uplift, Ok bearing ->
+      Assert.Equal(0.0, uplift.MemberForces["e1"][1])
+      Assert.Equal(30e3 * 2.0 / (200e9 * 1e-3), uplift.Displacements["n2"][Uy], 12)
+      Assert.Equal(-30e3, uplift.Reactions["n3"][Uy], 6)
+      // Bearing, the strut is twice as stiff as the bar above and carries
+      // two thirds of the load.
+      Assert.Equal(-20e3, bearing.MemberForces["e1"][1], 6)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Pretensioned cable shares its lack of fit with a bar in series`` () =
+    let stay = [ "area", 1e-3; "pretension", 50e3 ]
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0; "n3", 4.0, 0.0 ]
+        [ element "e1" "Cable" [ "n1"; "n2" ] stay
+          element "e2" "Truss2D" [ "n2"; "n3" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]
+          fixity "c2" "n2" [ "Uy" ]
+          fixity "c3" "n3" [ "Ux"; "Uy" ] ]
+        []
+
+    match analyse m with
+    | Ok r ->
+      // Cable and bar are equally stiff, EA/L = 1e8 N/m, so the cable
+      // shortens by half its lack of fit and each carries half the
+      // pretension.
+      Assert.Equal(-50e3 / 2e8, r.Displacements["n2"][Ux], 12)
+      Assert.Equal(25e3, r.MemberForces["e1"][1], 6)
+      Assert.Equal(25e3, r.MemberForces["e2"][1], 6)
+      Assert.Equal(0.0, r.Reactions["n1"][Ux] + r.Reactions["n3"][Ux], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+module SymmetryTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Half a symmetric portal mirrors to the whole`` () =
+    let frame = [ "area", 0.01; "i", 1e-4 ]
+
+    // The right-hand members run the other way to their mirror images.
+    let portal =
+      model
+        [ "n1", -3.0, 0.0
+          "n2", -3.0, 4.0
+          "n3", 0.0, 4.0
+          "n4", 3.0, 4.0
+          "n5", 3.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] frame
+          element "e2" "Frame2D" [ "n2"; "n3" ] frame
+          element "e3" "Frame2D" [ "n3"; "n4" ] frame
+          element "e4" "Frame2D" [ "n4"; "n5" ] frame ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c5" "n5" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l2" "n2" "Fy" -10e3
+          force "l3" "n3" "Fy" -20e3
+          force "l4" "n4" "Fy" -10e3 ]
+
+    let plane = YZ 0.0
+
+    let half =
+      Symmetry.apply plane portal
+      |> Result.mapError SymmetryError.getAsString
+      |> Result.bind (analyse >> Result.mapError StaticError.getAsString)
+      |> Result.map (Static.mirror plane portal)
+
+    match analyse portal, half with
+    | Ok whole, Ok mirrored ->
+      for KeyValue(node, dofs) in whole.Displacements do
+        for KeyValue(dof, x) in dofs do
+          let y = mirrored.Displacements[node].TryFind dof
+          Assert.Equal(x, defaultArg y 0.0, 12)
+
+      Assert.Equal<string seq>(whole.Reactions.Keys, mirrored.Reactions.Keys)
+
+      for KeyValue(node, dofs) in whole.Reactions do
+        for KeyValue(dof, x) in dofs do
+          Assert.Equal(x, mirrored.Reactions[node][dof], 6)
+
+      for KeyValue(id, forces) in whole.MemberForces do
+        Assert.Equal(forces.Length, mirrored.MemberForces[id].Length)
+
+        for i in 0 .. forces.Length - 1 do
+          Assert.Equal(forces[i], mirrored.MemberForces[id][i], 6)
+    | Error e, _ -> Assert.Fail(StaticError.getAsString e)
+    | _, Error e -> Assert.Fail e
+
+module RigidLinkTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  let private column = [ "area", 0.01; "i", 1e-4 ]
+
+  let private link id nodes =
+    let id, e = element id "RigidLink" nodes []
+    id, { e with Material = "" }
+
+  [<Fact>]
+  let ``Offset load acts through a link as a force and a moment`` () =
+    let cantilever links loads =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 3.0; "n3", 1.0, 3.0 ]
+        (element "e1" "Frame2D" [ "n1"; "n2" ] column :: links)
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        loads
+
+    let linked =
+      cantilever
+        [ link "l1" [ "n3"; "n2" ] ]
+        [ force "p" "n3" "Fy" -20e3 ]
+
+    let direct =
+      cantilever
+        []
+        [ force "p" "n2" "Fy" -20e3
+          "m", { snd (force "m" "n2" "Mz" -20e3) with Type = "Moment" } ]
+      |> fun m -> { m with Nodes = m.Nodes.Remove "n3" }
+
+    match analyse linked, analyse direct with
+    | Ok linked, Ok direct ->
+      let top = linked.Displacements["n2"]
+
+      // The penalty leaves an error of order 10⁻⁶ of the displacement.
+      for dof in [ Ux; Uy; Rz ] do
+        Assert.Equal(direct.Displacements["n2"][dof], top[dof], 7)
+
+      let master = linked.Displacements["n3"]
+      Assert.Equal(top[Uy] + top[Rz] * 1.0, master[Uy], 7)
+      Assert.Equal(20e3, linked.Reactions["n1"][Rz], 0)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``2D models hold linked nodes in their plane`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 3.0; "n3", 1.0, 3.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] column
+          link "l1" [ "n3"; "n2" ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "p" "n3" "Fy" -20e3 ]
+
+    let plane = { m with Info = { m.Info with Dimensions = Some 2 } }
+
+    match analyse m, analyse plane with
+    | Ok spatial, Ok plane ->
+      let tip (r: StaticResult) = r.Displacements["n3"][Uy]
+      Assert.Equal(tip spatial, tip plane, 9)
+
+      // Held freedoms are not supports, so only n1 reacts.
+      let reactions = plane.Reactions |> Map.toList |> List.map fst
+      Assert.Equal<string list>([ "n1" ], reactions)
+
+      let dofs = plane.Reactions["n1"] |> Map.toList |> List.map fst
+      Assert.Equal<Dof list>([ Ux; Uy; Rz ], dofs)
+
+      for KeyValue(_, u) in plane.Displacements do
+        for dof in [ Uz; Rx; Ry ] do
+          Assert.Equal(0.0, defaultArg (u.TryFind dof) 0.0)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Linked column heads sway together`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 0.0, 3.0; "n3", 6.0, 0.0; "n4", 6.0, 3.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] column
+          element "e2" "Frame2D" [ "n3"; "n4" ] column
+          link "l1" [ "n2"; "n4" ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c2" "n3" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "h" "n2" "Fx" 10e3 ]
+
+    match analyse m with
+    | Ok r ->
+      // The link acts as a rigid beam, so each column carries half the
+      // shear with its head all but fixed against rotation.
+      let sway = 5e3 * 3.0 ** 3.0 / (12.0 * 200e9 * 1e-4)
+      let head = r.Displacements["n2"][Ux]
+      Assert.InRange(head, sway, 1.01 * sway)
+      Assert.Equal(head, r.Displacements["n4"][Ux], 9)
+      Assert.Equal(-5e3, r.Reactions["n3"][Ux], 2)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+module DiagramsTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private section = [ "area", 0.01; "i", 1e-4 ]
+
+  let private onMember id kind magnitude position =
+    id,
+    { snd (force id "n1" "Fy" magnitude) with
+        Type = kind
+        Node = None
+        Element = Some "e1"
+        Position = position }
+
+  let private diagram count (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] ->
+      Static.analyse m set
+      |> Result.mapError StaticError.getAsString
+      |> Result.bind (fun r ->
+        Diagrams.ofResult m set count r
+        |> Result.mapError LoadError.getAsString)
+      |> Result.map (fun stations -> Array.ofList stations["e1"])
+    | other -> Error $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Fixed beam under a central point load has PL/8 moments`` () =
+    let p, l = 10e3, 6.0
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", l, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] section ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c2" "n2" [ "Ux"; "Uy"; "Rz" ] ]
+        [ onMember "p" "Force" -p (Some 0.5) ]
+
+    match diagram 3 m with
+    | Ok [| start; middle; finish |] ->
+      Assert.Equal(l / 2.0, middle.Distance, 9)
+      Assert.Equal(-p * l / 8.0, start.MomentZ, 3)
+      Assert.Equal(p * l / 8.0, middle.MomentZ, 3)
+      Assert.Equal(-p * l / 8.0, finish.MomentZ, 3)
+      Assert.Equal(-p / 2.0, start.ShearY, 3)
+      Assert.Equal(p / 2.0, finish.ShearY, 3)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Simply supported beam under a uniform load peaks at wL²/8`` () =
+    let w, l = 10e3, 6.0
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", l, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] section ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        [ onMember "w" "Distributed" -w None ]
+
+    match diagram 5 m with
+    | Ok stations ->
+      Assert.Equal(0.0, stations[0].MomentZ, 3)
+      Assert.Equal(3.0 * w * l ** 2.0 / 32.0, stations[1].MomentZ, 3)
+      Assert.Equal(w * l ** 2.0 / 8.0, stations[2].MomentZ, 3)
+      Assert.Equal(0.0, stations[4].MomentZ, 3)
+      Assert.Equal(-w * l / 2.0, stations[0].ShearY, 3)
+      Assert.Equal(0.0, stations[2].ShearY, 3)
+
+      for s in stations do
+        Assert.Equal(0.0, s.Axial, 3)
+    | Error e -> Assert.Fail e
+
+  [<Fact>]
+  let ``Design stresses a fixed beam by the moments of its uniform load`` () =
+    let w, l, zz, fy = 10e3, 6.0, 1e-4, 355e6
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", l, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] (("zz", zz) :: section) ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c2" "n2" [ "Ux"; "Uy"; "Rz" ] ]
+        [ onMember "w" "Distributed" -w None ]
+
+    let m =
+      { m with
+          Materials =
+            m.Materials
+            |> Map.map (fun _ x -> { x with YieldStrength = Some fy }) }
+
+    let moment = w * l ** 2.0 / 12.0
+
+    match LoadCases.select m None None with
+    | Ok [ set ] ->
+      match Static.analyse m set with
+      | Ok r ->
+        let forces = r.MemberForces["e1"]
+
+        match Design.stresses m set r, Diagrams.critical m set "e1" forces with
+        | Ok [ s ], Ok stations ->
+          Assert.Equal(moment / zz, s.Bending.Value, 0)
+
+          match Design.check m "e1" forces stations with
+          | Some c -> Assert.Equal(moment / zz / fy, c.Utilisation, 6)
+          | None -> Assert.Fail("Expected a check")
+        | other -> Assert.Fail($"Unexpected stresses: {other}")
+      | Error e -> Assert.Fail(StaticError.getAsString e)
+    | other -> Assert.Fail($"Unexpected load sets: {other}")
+
+module ReleaseTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> Static.analyse m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  let private beam = [ "area", 0.01; "i", 1e-4 ]
+
+  let private released id nodes (releases: (string * string list) list) =
+    let id, e = element id "Frame2D" nodes beam
+    id, { e with Releases = Some(Map releases) }
+
+  let private fixedEnds =
+    [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+      fixity "c2" "n2" [ "Ux"; "Uy"; "Rz" ] ]
+
+  [<Fact>]
+  let ``Pinned end turns a fixed beam into a propped cantilever`` () =
+    let midspan =
+      { snd (force "p" "n1" "Fy" -16e3) with
+          Node = None
+          Element = Some "e1"
+          Position = Some 0.5 }
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0 ]
+        [ released "e1" [ "n1"; "n2" ] [ "n2", [ "Rz" ] ] ]
+        fixedEnds
+        [ "p", midspan ]
+
+    match analyse m with
+    | Ok r ->
+      // Fixed at n1 and propped at n2: R = 11P/16 and 5P/16, M = 3PL/16.
+      Assert.Equal(11e3, r.Reactions["n1"][Uy], 6)
+      Assert.Equal(5e3, r.Reactions["n2"][Uy], 6)
+      Assert.Equal(12e3, r.Reactions["n1"][Rz], 6)
+      Assert.Equal(0.0, r.MemberForces["e1"][5], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Hinged beams share a load as cantilevers`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 3.0, 0.0; "n3", 6.0, 0.0 ]
+        [ released "e1" [ "n1"; "n2" ] [ "n2", [ "Rz" ] ]
+          released "e2" [ "n2"; "n3" ] [ "n2", [ "Rz" ] ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+          fixity "c3" "n3" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "p" "n2" "Fy" -10e3 ]
+
+    match analyse m with
+    | Ok r ->
+      let tip = 5e3 * 3.0 ** 3.0 / (3.0 * 200e9 * 1e-4)
+      Assert.Equal(-tip, r.Displacements["n2"][Uy], 12)
+      Assert.False(r.Displacements["n2"].ContainsKey Rz)
+      Assert.Equal(15e3, r.Reactions["n1"][Rz], 6)
+      Assert.Equal(0.0, r.MemberForces["e1"][5], 6)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Trusses cannot release their ends`` () =
+    let id, truss = element "e1" "Truss2D" [ "n1"; "n2" ] beam
+
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 4.0, 0.0 ]
+        [ id, { truss with Releases = Some(Map [ "n2", [ "Rz" ] ]) } ]
+        fixedEnds
+        []
+
+    match Static.assemble m with
+    | Error(MisalignedElement("e1", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module SecondOrderTests =
+
+  open System
+  open Gazelle.Model
+  open StaticTests
+
+  /// Cantilever column along Y under a vertical and a horizontal tip load.
+  let private column (p: float) (h: float) =
+    let length, count = 4.0, 8
+    let section = [ "area", 0.01; "i", 1e-4 ]
+
+    let nodes =
+      [ for i in 0..count -> $"n{i}", 0.0, length * float i / float count ]
+
+    let elements =
+      [ for i in 1..count ->
+          element $"e{i}" "Frame2D" [ $"n{i - 1}"; $"n{i}" ] section ]
+
+    model
+      nodes
+      elements
+      [ fixity "c1" "n0" [ "Ux"; "Uy"; "Rz" ] ]
+      [ force "l1" $"n{count}" "Fy" -p; force "l2" $"n{count}" "Fx" h ]
+
+  let private analyse (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> SecondOrder.analyse SecondOrder.defaults m set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Cantilever sway matches the closed-form P-Delta deflection`` () =
+    let p, h, ei = 1e6, 1e4, 200e9 * 1e-4
+
+    match analyse (column p h) with
+    | Ok r ->
+      let k = sqrt (p / ei)
+      let expected = h / (p * k) * (tan (k * 4.0) - k * 4.0)
+      let linear = h * 4.0 ** 3.0 / (3.0 * ei)
+      let sway = r.Response.Displacements["n8"][Ux]
+      Assert.Equal(1.0, sway / expected, 3)
+      Assert.Equal(sway / linear, r.Amplification, 6)
+      Assert.True(r.Iterations > 1)
+    | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+
+  [<Fact>]
+  let ``Base moment includes the load acting through the sway`` () =
+    let p, h = 1e6, 1e4
+
+    match analyse (column p h) with
+    | Ok r ->
+      let sway = r.Response.Displacements["n8"][Ux]
+      let forces = r.Response.MemberForces["e1"]
+      Assert.Equal(1.0, abs forces[2] / (h * 4.0 + p * sway), 3)
+    | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+
+  [<Fact>]
+  let ``Unloaded columns converge at once`` () =
+    match analyse (column 0.0 0.0) with
+    | Ok r -> Assert.Equal(1, r.Iterations)
+    | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+
+  [<Fact>]
+  let ``Load increments reach the response of the whole load`` () =
+    let m = column 1e6 1e4
+
+    let settings =
+      { SecondOrder.defaults with
+          MaxStep = 0.25 }
+
+    match analyse m, LoadCases.select m None None with
+    | Ok whole, Ok [ set ] ->
+      match SecondOrder.analyse settings m set with
+      | Ok stepped ->
+        let sway (r: SecondOrderResult) = r.Response.Displacements["n8"][Ux]
+        Assert.Equal(1, whole.Steps)
+        Assert.Equal(4, stepped.Steps)
+        Assert.Equal(1.0, sway stepped / sway whole, 6)
+        Assert.Equal(whole.Amplification, stepped.Amplification, 6)
+      | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``BFGS and line search reach the Newton-Raphson response`` () =
+    let m = column 1e6 1e4
+    let sway (r: SecondOrderResult) = r.Response.Displacements["n8"][Ux]
+
+    match analyse m, LoadCases.select m None None with
+    | Ok newton, Ok [ set ] ->
+      for scheme, search in
+        [ IterationScheme.NewtonRaphson, true
+          IterationScheme.Bfgs, false
+          IterationScheme.Bfgs, true ] do
+        let settings =
+          { SecondOrder.defaults with
+              Scheme = scheme
+              LineSearch = search }
+
+        match SecondOrder.analyse settings m set with
+        | Ok r ->
+          Assert.Equal(1.0, sway r / sway newton, 5)
+
+          if scheme = IterationScheme.Bfgs then
+            Assert.True(r.Iterations > newton.Iterations)
+        | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Iteration schemes are parsed by name`` () =
+    for scheme in [ IterationScheme.NewtonRaphson; IterationScheme.Bfgs ] do
+      let name = IterationScheme.getAsString scheme
+      Assert.Equal(Some scheme, IterationScheme.tryParse name)
+
+    Assert.Equal(
+      Some IterationScheme.NewtonRaphson,
+      IterationScheme.tryParse "Newton-Raphson"
+    )
+
+    Assert.Equal(None, IterationScheme.tryParse "secant")
+
+  [<Fact>]
+  let ``Loads beyond the critical load stop at the factor reached`` () =
+    let p = 4e6
+    let critical = Math.PI ** 2.0 * 200e9 * 1e-4 / (4.0 * 4.0 ** 2.0)
+
+    match analyse (column p 1e4) with
+    | Error(Diverged factor) ->
+      let limit = critical / p
+      Assert.InRange(factor, limit - SecondOrder.defaults.MinStep, limit)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Starting from a converged state takes fewer iterations`` () =
+    let m = column 1e6 1e4
+    let sway (r: SecondOrderResult) = r.Response.Displacements["n8"][Ux]
+
+    let solve initial =
+      match LoadCases.select m None None with
+      | Ok [ set ] ->
+        NodalLoads.ofLoadSet m set
+        |> Result.mapError (FailedLoads >> FailedIteration)
+        |> Result.bind (fun loads ->
+          Static.assemble m
+          |> Result.mapError FailedIteration
+          |> Result.bind (fun a ->
+            let solver = LinearSolver.defaultSolver
+            let settings = SecondOrder.defaults
+            SecondOrder.solveWith settings solver initial m a loads))
+      | other -> failwith $"Unexpected load sets: {other}"
+
+    match solve InitialState.empty with
+    | Ok cold ->
+      let state: InitialState = { Displacements = cold.Response.Displacements }
+
+      match solve state with
+      | Ok warm ->
+        Assert.True(warm.Iterations < cold.Iterations)
+        Assert.Equal(1.0, sway warm / sway cold, 6)
+        Assert.Equal(cold.Amplification, warm.Amplification, 6)
+      | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+    | Error e -> Assert.Fail(SecondOrderError.getAsString e)
+
+module StabilityTests =
+
+  open System
+  open Gazelle.Model
+  open StaticTests
+
+  /// Cantilever column along Y, 4 long, under an axial load at its tip.
+  let private column (p: float) =
+    let section = [ "area", 0.01; "i", 1e-4 ]
+    let nodes = [ for i in 0..8 -> $"n{i}", 0.0, 0.5 * float i ]
+
+    let elements =
+      [ for i in 1..8 ->
+          element $"e{i}" "Frame2D" [ $"n{i - 1}"; $"n{i}" ] section ]
+
+    model
+      nodes
+      elements
+      [ fixity "c1" "n0" [ "Ux"; "Uy"; "Rz" ] ]
+      [ force "l1" "n8" "Fy" -p ]
+
+  let private set (m: Model) =
+    match LoadCases.select m None None with
+    | Ok [ set ] -> set
+    | other -> failwith $"Unexpected load sets: {other}"
+
+  [<Fact>]
+  let ``Cantilever buckles at the Euler load`` () =
+    let m = column 1e6
+
+    match Stability.analyse 2 m (set m) with
+    | Ok r ->
+      let euler = Math.PI ** 2.0 * 200e9 * 1e-4 / (4.0 * 4.0 ** 2.0)
+      let first = r.Modes.Head
+      Assert.Equal(1.0, first.LoadFactor * 1e6 / euler, 3)
+      let tip = (Stability.shape r first)["n8"]
+      Assert.Equal(1.0, abs tip[Ux], 9)
+      Assert.True(r.Modes[1].LoadFactor > 8.0 * first.LoadFactor)
+    | Error e -> Assert.Fail(StabilityError.getAsString e)
+
+  [<Fact>]
+  let ``Mode imperfections scale the shape to L over the ratio`` () =
+    let m = column 1e6
+
+    match Imperfection.tryParse "mode1:L/250" with
+    | Ok i ->
+      match Stability.imperfect (set m) i m with
+      | Ok imperfect ->
+        let tip = imperfect.Nodes["n8"]
+        Assert.Equal(4.0 / 250.0, abs tip.X, 9)
+        Assert.Equal(0.0, imperfect.Nodes["n0"].X)
+      | Error e -> Assert.Fail(StabilityError.getAsString e)
+    | Error e -> Assert.Fail(ImperfectionError.getAsString e)
+
+  [<Fact>]
+  let ``Members in tension do not buckle`` () =
+    let m = column -1e6
+
+    match Stability.analyse 1 m (set m) with
+    | Error Unbuckled -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module ModalTests =
+
+  open System
+  open Gazelle.Model
+  open StaticTests
+
+  let private withDensity (m: Model) =
+    let steel = m.Materials["steel"]
+
+    { m with
+        Materials = Map [ "steel", { steel with Density = Some 7850.0 } ] }
+
+  [<Fact>]
+  let ``Jacobi rotations find the eigenpairs of a symmetric matrix`` () =
+    let a = array2D [ [ 2.0; 1.0 ]; [ 1.0; 2.0 ] ]
+    let values, vectors = Matrix.symmetricEigen a
+    Assert.Equal(1.0, values[0], 12)
+    Assert.Equal(3.0, values[1], 12)
+    Assert.Equal(abs vectors[0, 1], abs vectors[1, 1], 12)
+
+  [<Fact>]
+  let ``Bar with lumped mass vibrates at the spring-mass frequency`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        []
+      |> withDensity
+
+    match Modal.analyse MassMatrix.Lumped 5 m with
+    | Ok r ->
+      // Stiffness EA/L against half the bar's mass.
+      let expected = sqrt (2.0 * 200e9 / (7850.0 * 2.0 ** 2.0))
+      Assert.Equal(1, r.Modes.Length)
+      Assert.Equal(1.0, r.Modes.Head.AngularFrequency / expected, 9)
+    | Error e -> Assert.Fail(ModalError.getAsString e)
+
+  [<Fact>]
+  let ``Point masses add to the mass of the elements`` () =
+    let tank =
+      { Id = "m1"
+        Node = "n2"
+        Mass = 100.0
+        Inertia = Some(Map [ "Rz", 5.0 ]) }
+
+    let m =
+      { model
+          [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+          [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+          [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+          [] with
+          Masses = Some(Map [ "m1", tank ]) }
+      |> withDensity
+
+    Assert.Equal(7850.0 * 2e-3 + 100.0, (Mass.total m).Value, 9)
+
+    match Modal.analyse MassMatrix.Lumped 5 m with
+    | Ok r ->
+      let expected = sqrt (200e9 * 1e-3 / 2.0 / (7850.0 * 1e-3 + 100.0))
+      Assert.Equal(1.0, r.Modes.Head.AngularFrequency / expected, 9)
+    | Error e -> Assert.Fail(ModalError.getAsString e)
+
+  [<Fact>]
+  let ``Cantilever fundamental frequency matches Euler-Bernoulli theory`` () =
+    let length, count = 4.0, 8
+    let section = [ "area", 0.01; "i", 1e-4 ]
+
+    let nodes =
+      [ for i in 0..count -> $"n{i}", length * float i / float count, 0.0 ]
+
+    let elements =
+      [ for i in 1..count ->
+          element $"e{i}" "Frame2D" [ $"n{i - 1}"; $"n{i}" ] section ]
+
+    let m =
+      model nodes elements [ fixity "c1" "n0" [ "Ux"; "Uy"; "Rz" ] ] []
+      |> withDensity
+
+    match Modal.analyse MassMatrix.Consistent 3 m with
+    | Ok r ->
+      let perLength = 7850.0 * 0.01
+      let stiffness = 200e9 * 1e-4 / (perLength * length ** 4.0)
+      let expected = 1.8751 ** 2.0 * sqrt stiffness
+      let first = r.Modes.Head
+      let shape = Modal.shape r first
+      let omega = r.Modes |> List.map (fun x -> x.AngularFrequency)
+      Assert.Equal(1.0, first.AngularFrequency / expected, 3)
+      Assert.Equal<float list>(List.sort omega, omega)
+      Assert.Equal(omega.Head / (2.0 * Math.PI), Modal.frequency first, 12)
+      let tip, middle = shape["n8"][Uy], shape["n4"][Uy]
+      Assert.True(abs tip > abs middle)
+    | Error e -> Assert.Fail(ModalError.getAsString e)
+
+  [<Fact>]
+  let ``Members without density have no mass`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ] ]
+        []
+
+    match Modal.analyse MassMatrix.Lumped 5 m with
+    | Error(FailedAssembly(MissingDensity("e1", "steel"))) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Modes are tracked by shape where their frequencies cross`` () =
+    // A node held by a bar along x and another along y, whose modes move
+    // along x and along y, at a frequency set by each bar's area.
+    let modes area =
+      let m =
+        model
+          [ "n1", 0.0, 0.0; "n2", 2.0, 0.0; "n3", 2.0, 2.0 ]
+          [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", area ]
+            element "e2" "Truss2D" [ "n2"; "n3" ] [ "area", 1e-3 ] ]
+          [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n3" [ "Ux"; "Uy" ] ]
+          []
+        |> withDensity
+
+      match Modal.analyse MassMatrix.Lumped 2 m with
+      | Ok r -> r
+      | Error e -> failwith (ModalError.getAsString e)
+
+    let soft, stiff = modes 0.5e-3, modes 2e-3
+    let alongX (r: ModalResult) (mode: Mode) = (Modal.shape r mode)["n2"][Ux]
+
+    Assert.Equal(1.0, Modal.mac soft soft.Modes[0] soft soft.Modes[0], 12)
+    Assert.Equal(0.0, Modal.mac soft soft.Modes[0] soft soft.Modes[1], 12)
+    Assert.NotEqual(0.0, alongX soft soft.Modes[0])
+    Assert.Equal(0.0, alongX stiff stiff.Modes[0], 12)
+
+    match Modal.track [ soft; stiff ] with
+    | [ x; y ] ->
+      let frequencies (t: ModeTrack) =
+        t.Modes |> List.map (Option.get >> fst >> Modal.frequency)
+
+      Assert.Equal<float list>(
+        [ Modal.frequency soft.Modes[0]; Modal.frequency stiff.Modes[1] ],
+        frequencies x
+      )
+
+      Assert.Equal<float list>(
+        [ Modal.frequency soft.Modes[1]; Modal.frequency stiff.Modes[0] ],
+        frequencies y
+      )
+
+      Assert.Equal(1.0, snd y.Modes[1].Value, 12)
+    | other -> Assert.Fail($"Unexpected tracks: {other}")
+
+  [<Fact>]
+  let ``Test mode shapes are correlated over the freedoms measured`` () =
+    let text =
+      "mode,node,dof,value\n1,n2,Uy,0.5\n1,n3,Uy,1.0\n\
+       2,n2,Uy,-1.0\n2,n3,Uy,0.5\n1,2.5\n"
+
+    let test =
+      match ModeShapes.parse text with
+      | Ok r -> r
+      | Error e -> failwith (ModeShapeError.getAsString e)
+
+    Assert.Equal(2.5, Modal.frequency test.Modes[0], 12)
+    Assert.True(Double.IsNaN(Modal.frequency test.Modes[1]))
+
+    // The same shapes, scaled, with an unmeasured rotation.
+    let model =
+      { Dofs = [| "n2", Uy; "n2", Rz; "n3", Uy |]
+        Modes =
+          [ { Number = 1
+              AngularFrequency = 1.0
+              Shape = [| -1.0; 7.0; -2.0 |] } ] }
+
+    let mac = Modal.macMatrix model test
+    Assert.Equal(1, Array2D.length1 mac)
+    Assert.Equal(1.0, mac[0, 0], 12)
+    Assert.Equal(0.0, mac[0, 1], 12)
+
+    match ModeShapes.parse "1,n2,Uy,0.5\n1,n2,Uq,0.5" with
+    | Error(MalformedShapes(2, _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module ReductionTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // A cantilever of eight frames with consistent mass.
+  let private cantilever =
+    let nodes = [ for i in 1..9 -> $"n{i}", 0.5 * float (i - 1), 0.0 ]
+
+    let elements =
+      [ for i in 1..8 ->
+          element
+            $"e{i}"
+            "Frame2D"
+            [ $"n{i}"; $"n{i + 1}" ]
+            [ "area", 0.01; "i", 1e-4 ] ]
+
+    let m =
+      model nodes elements [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ] []
+
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ x -> { x with Density = Some 7850.0 }) }
+
+  let private masters =
+    [ for n in [ "n3"; "n5"; "n7"; "n9" ] -> n, Some Uy ]
+
+  let private frequencies method =
+    let reduced =
+      Reduction.reduce method MassMatrix.Consistent masters cantilever
+
+    match reduced with
+    | Ok r ->
+      match Reduction.modes 2 r with
+      | Ok modes -> modes.Modes |> List.map Modal.frequency
+      | Error e -> failwith (ModalError.getAsString e)
+    | Error e -> failwith (ReductionError.getAsString e)
+
+  [<Fact>]
+  let ``Guyan reduction keeps the static stiffness at the masters`` () =
+    let masters = [ "n5", Some Uy; "n9", Some Uy ]
+    let guyan = ReductionMethod.Guyan
+
+    match Reduction.reduce guyan MassMatrix.Lumped masters cantilever with
+    | Ok r ->
+      // Flexibility of a cantilever at its tip, L³/3EI.
+      let flexibility = Matrix.factorise r.Stiffness |> Option.get
+      let tip = Matrix.solve flexibility [| 0.0; 1.0 |]
+      Assert.Equal(4.0 ** 3.0 / (3.0 * 200e9 * 1e-4), tip[1], 15)
+      Assert.Equal<(string * Dof) array>([| "n5", Uy; "n9", Uy |], r.Masters)
+      Assert.Equal(27 - 3, r.Dofs.Length)
+    | Error e -> Assert.Fail(ReductionError.getAsString e)
+
+  [<Fact>]
+  let ``IRS frequencies are closer to the full model than Guyan`` () =
+    let full =
+      match Modal.analyse MassMatrix.Consistent 2 cantilever with
+      | Ok r -> r.Modes |> List.map Modal.frequency
+      | Error e -> failwith (ModalError.getAsString e)
+
+    let guyan = frequencies ReductionMethod.Guyan
+    let irs = frequencies ReductionMethod.Irs
+
+    for f, g, i in List.zip3 full guyan irs do
+      // Reduction constrains the model, so it overestimates frequencies.
+      Assert.True(g >= f * (1.0 - 1e-9))
+      Assert.True(abs (i - f) < abs (g - f))
+      Assert.True(abs (i - f) / f < 1e-5)
+
+  [<Fact>]
+  let ``Masters must be free degrees of freedom`` () =
+    let reduce masters =
+      Reduction.reduce ReductionMethod.Irs MassMatrix.Lumped masters cantilever
+
+    match reduce [ "n1", Some Uy ] with
+    | Error(UnknownMaster("n1", Some Uy)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+    match reduce [] with
+    | Error NoMasters -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module MatrixExportTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  [<Fact>]
+  let ``Matrices cover the free degrees of freedom`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        []
+
+    match MatrixExport.ofModel MassMatrix.Lumped m with
+    | Ok x ->
+      Assert.Equal<(string * Dof) array>([| "n2", Ux |], x.Dofs)
+      Assert.Equal(200e9 * 1e-3 / 2.0, Sparse.get x.Stiffness 0 0, 6)
+      Assert.True(x.Mass.IsNone)
+      Assert.Equal("index,node,dof\n1,n2,Ux\n", MatrixExport.dofMap x.Dofs)
+    | Error e -> Assert.Fail(StaticError.getAsString e)
+
+  [<Fact>]
+  let ``Matrix Market files hold the lower triangle`` () =
+    let a = array2D [ [ 2.0; -1.0 ]; [ -1.0; 0.0 ] ]
+    let lines = (MatrixExport.toMatrixMarket (Sparse.ofMatrix a)).Split '\n'
+
+    Assert.Equal("%%MatrixMarket matrix coordinate real symmetric", lines[0])
+    Assert.Equal<string array>([| "2 2 2"; "1 1 2"; "2 1 -1"; "" |], lines[1..])
+
+  [<Fact>]
+  let ``Matrix Market files read back as they were written`` () =
+    let a = array2D [ [ 2.0; -1.0 ]; [ -1.0; 3.0 ] ]
+    let text = MatrixExport.toMatrixMarket (Sparse.ofMatrix a)
+    let general = "%%MatrixMarket matrix array real general\n2 2\n2\n-1\n-1\n3"
+
+    for text in [ text; general ] do
+      match MatrixExport.parseMatrixMarket "k.mtx" text with
+      | Ok k ->
+        let entries = [ for i in 0..1 do for j in 0..1 -> Sparse.get k i j ]
+        Assert.Equal<float list>([ 2.0; -1.0; -1.0; 3.0 ], entries)
+      | Error e -> Assert.Fail(MatrixError.getAsString e)
+
+    // Row 3 is outside the matrix.
+    let outside = text.Replace("2 1", "3 1")
+
+    match MatrixExport.parseMatrixMarket "k.mtx" outside with
+    | Error(MalformedMatrix("k.mtx", 4, _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Maps of degrees of freedom read back as they were written`` () =
+    let dofs = [| "n2", Ux; "n2", Rz; "n3", Uy |]
+
+    match MatrixExport.parseDofMap "k.dofs.csv" (MatrixExport.dofMap dofs) with
+    | Ok x -> Assert.Equal<(string * Dof) array>(dofs, x)
+    | Error e -> Assert.Fail(MatrixError.getAsString e)
+
+module DynamicTests =
+
+  open System
+  open Gazelle.Model
+  open StaticTests
+
+  /// Bar fixed at one end, its free end suddenly loaded axially.
+  let private bar =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        [ force "l1" "n2" "Fx" 1e3 ]
+
+    let steel = m.Materials["steel"]
+    let step = { Times = [ 0.0; 1.0 ]; Factors = [ 1.0; 1.0 ] }
+
+    { m with
+        Materials = Map [ "steel", { steel with Density = Some 7850.0 } ]
+        TimeHistory =
+          Some
+            { TimeStep = 1e-5
+              Duration = 2e-3
+              Cases = Map [ LoadCases.DefaultCase, step ] } }
+
+  [<Fact>]
+  let ``Load histories interpolate linearly and vanish outside`` () =
+    let h = { Times = [ 0.0; 1.0; 3.0 ]; Factors = [ 0.0; 2.0; 0.0 ] }
+    Assert.Equal(1.0, Dynamic.factor h 0.5, 12)
+    Assert.Equal(1.0, Dynamic.factor h 2.0, 12)
+    Assert.Equal(0.0, Dynamic.factor h 4.0, 12)
+    Assert.Equal(0.0, Dynamic.factor h -1.0, 12)
+
+  [<Fact>]
+  let ``Rayleigh damping gives the ratio at both frequencies`` () =
+    let r = Dynamic.rayleigh 0.05 10.0 40.0
+    let ratio omega = r.Mass / (2.0 * omega) + r.Stiffness * omega / 2.0
+    Assert.Equal(0.05, ratio 10.0, 12)
+    Assert.Equal(0.05, ratio 40.0, 12)
+    Assert.True(ratio 20.0 < 0.05)
+
+  [<Fact>]
+  let ``Suddenly loaded bar overshoots to twice its static extension`` () =
+    let undamped =
+      { bar with
+          Damping =
+            Some
+              { Ratio = None
+                Modes = None
+                Rayleigh = Some { Rayleigh.Mass = 0.0; Stiffness = 0.0 } } }
+
+    match Dynamic.analyse (Newmark(0.25, 0.5)) MassMatrix.Lumped undamped with
+    | Ok r ->
+      let u = r.Response.Displacements |> Array.map (fun x -> x[0])
+      let peak = Array.max u
+      let k = 200e9 * 1e-3 / 2.0
+      let omega = sqrt (2.0 * 200e9 / (7850.0 * 2.0 ** 2.0))
+      let at = r.Times[Array.findIndex ((=) peak) u]
+      Assert.Equal<(string * Dof) list>([ "n2", Ux ], List.ofArray r.Dofs)
+      Assert.Equal(201, r.Times.Length)
+      Assert.Equal(1.0, peak / (2.0 * 1e3 / k), 3)
+      Assert.Equal(Math.PI / omega, at, 5)
+    | Error e -> Assert.Fail(DynamicError.getAsString e)
+
+  [<Fact>]
+  let ``Modal superposition integrates the bar exactly`` () =
+    let undamped =
+      { bar with
+          Damping =
+            Some
+              { Ratio = Some 0.0
+                Modes = None
+                Rayleigh = None } }
+
+    let u = ResizeArray()
+    let a = ResizeArray()
+
+    let observe _ (uk: float array) _ (ak: float array) =
+      u.Add uk[0]
+      a.Add ak[0]
+
+    // The integrator is unused by modal superposition.
+    let run (d: DynamicSystem) =
+      let modal = ModalSuperposition 1
+      Dynamic.runWith modal CentralDifference undamped d observe
+
+    match Dynamic.prepare MassMatrix.Lumped undamped |> Result.bind run with
+    | Ok() ->
+      let k = 200e9 * 1e-3 / 2.0
+      let mass = 7850.0 * 1e-3 * 2.0 / 2.0
+      let omega = sqrt (k / mass)
+      let exact t = 1e3 / k * (1.0 - cos (omega * t))
+      Assert.Equal(201, u.Count)
+      Assert.Equal(1.0, a[0] / (1e3 / mass), 9)
+
+      for step in [ 20; 88; 150 ] do
+        Assert.Equal(1.0, u[step] / exact (float step * 1e-5), 9)
+    | Error e -> Assert.Fail(DynamicError.getAsString e)
+
+  [<Fact>]
+  let ``Default Rayleigh damping decays the response`` () =
+    match Dynamic.analyse (Newmark(0.25, 0.5)) MassMatrix.Lumped bar with
+    | Ok r ->
+      let u = r.Response.Displacements |> Array.map (fun x -> x[0])
+      let k = 200e9 * 1e-3 / 2.0
+      Assert.True(Array.max u < 2.0 * 1e3 / k)
+    | Error e -> Assert.Fail(DynamicError.getAsString e)
+
+  [<Fact>]
+  let ``Models without a time history are rejected`` () =
+    let m = { bar with TimeHistory = None }
+
+    match Dynamic.prepare MassMatrix.Lumped m with
+    | Error NoTimeHistory -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module SpectrumTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private flat =
+    { Periods = [ 0.1; 1.0 ]
+      Accelerations = [ 2.0; 2.0 ] }
+
+  [<Fact>]
+  let ``Spectra skip headers and comments`` () =
+    let text = "# Site class B\nPeriod,Sa\n0.0,1.0\n0.5; 2.5\n2.0\t1.0\n"
+
+    match Spectrum.parse text with
+    | Ok s ->
+      Assert.Equal<float list>([ 0.0; 0.5; 2.0 ], s.Periods)
+      Assert.Equal<float list>([ 1.0; 2.5; 1.0 ], s.Accelerations)
+    | Error e -> Assert.Fail(SpectrumError.getAsString e)
+
+  [<Fact>]
+  let ``Spectra with descending periods are rejected`` () =
+    match Spectrum.parse "0.0,1.0\n0.5,2.5\n0.4,1.0" with
+    | Error(MalformedSpectrum(3, _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Spectral acceleration interpolates and is held at the ends`` () =
+    let s =
+      { Periods = [ 0.5; 1.5 ]
+        Accelerations = [ 3.0; 1.0 ] }
+
+    Assert.Equal(2.0, Spectrum.acceleration s 1.0, 12)
+    Assert.Equal(3.0, Spectrum.acceleration s 0.1, 12)
+    Assert.Equal(1.0, Spectrum.acceleration s 4.0, 12)
+
+  [<Fact>]
+  let ``CQC reduces to SRSS for well-separated modes`` () =
+    let peaks = [ 3.0; 4.0 ]
+    let close = [ 0.05, 10.0; 0.05, 10.0 ]
+    let apart = [ 0.05, 10.0; 0.05, 1000.0 ]
+    Assert.Equal(1.0, Spectrum.correlation 0.05 0.05 10.0 10.0, 12)
+    Assert.Equal(7.0, Spectrum.combine ModalCombination.Cqc close peaks, 9)
+    Assert.Equal(5.0, Spectrum.combine ModalCombination.Srss apart peaks, 12)
+    Assert.Equal(5.0, Spectrum.combine ModalCombination.Cqc apart peaks, 3)
+
+  [<Fact>]
+  let ``Bar responds to a flat spectrum as a single oscillator`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        []
+
+    let steel = m.Materials["steel"]
+
+    let m =
+      { m with
+          Materials = Map [ "steel", { steel with Density = Some 7850.0 } ] }
+
+    let rule = ModalCombination.Cqc
+
+    match Spectrum.analyse rule MassMatrix.Lumped 5 Ux flat m with
+    | Ok r ->
+      // Half the bar's mass on a spring of stiffness EA/L.
+      let mass = 7850.0 * 1e-3 * 2.0 / 2.0
+      let omega2 = 200e9 * 1e-3 / 2.0 / mass
+      Assert.Equal(1, r.Modes.Length)
+      Assert.Equal(mass, r.Mass, 9)
+      Assert.Equal(mass, r.Modes.Head.EffectiveMass, 9)
+      Assert.Equal(1.0, r.Displacements[0] / (2.0 / omega2), 9)
+      Assert.Equal(mass * 2.0, r.BaseShear, 9)
+    | Error e -> Assert.Fail(SpectrumError.getAsString e)
+
+  [<Fact>]
+  let ``Rotations cannot excite a spectrum`` () =
+    let m = model [] [] [] []
+    let rule = ModalCombination.Srss
+
+    match Spectrum.analyse rule MassMatrix.Lumped 5 Rz flat m with
+    | Error(InvalidExcitation Rz) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module TransferTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // Portal frame on fixed feet at n1 and n4, under sway and gravity.
+  let private portal =
+    model
+      [ "n1", 0.0, 0.0; "n2", 0.0, 3.0; "n3", 4.0, 3.0; "n4", 4.0, 0.0 ]
+      [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ]
+        element "e2" "Frame2D" [ "n2"; "n3" ] [ "area", 0.01; "i", 2e-4 ]
+        element "e3" "Frame2D" [ "n4"; "n3" ] [ "area", 0.01; "i", 1e-4 ] ]
+      [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ]
+        fixity "c2" "n4" [ "Ux"; "Uy"; "Rz" ] ]
+      [ force "l1" "n2" "Fx" 5e3; force "l2" "n3" "Fy" -20e3 ]
+
+  let private mat nodes = model nodes [] [] []
+
+  let private transfer pairs target =
+    Transfer.apply LinearSolver.defaultSolver 1e-3 pairs None portal target
+
+  let private total direction (m: Model) =
+    m.Loads
+    |> Map.toList
+    |> List.filter (fun (_, l) -> l.Direction = direction)
+    |> List.sumBy (fun (_, l) -> l.Magnitude)
+
+  [<Fact>]
+  let ``Reactions are applied as equal and opposite loads`` () =
+    match transfer [] (mat [ "f1", 0.0, 0.0; "f2", 4.0, 0.0 ]) with
+    | Ok m ->
+      Assert.Equal(5e3, total "Fx" m, 6)
+      Assert.Equal(-20e3, total "Fy" m, 6)
+      Assert.True(m.Loads |> Map.forall (fun _ l -> l.Case.IsNone))
+
+      let nodes =
+        m.Loads |> Map.toList |> List.choose (fun (_, l) -> l.Node) |> set
+
+      Assert.Equal<Set<string>>(set [ "f1"; "f2" ], nodes)
+    | Error e -> Assert.Fail(TransferError.getAsString e)
+
+  [<Fact>]
+  let ``Supports away from target nodes need explicit pairs`` () =
+    let target = mat [ "f1", 0.0, -0.5; "f2", 4.0, -0.5 ]
+
+    match transfer [] target, transfer [ "n1", "f1"; "n4", "f2" ] target with
+    | Error(UnmatchedSupport "n1"), Ok m ->
+      Assert.Equal(-20e3, total "Fy" m, 6)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Node pairs parse from source=target`` () =
+    Assert.Equal(Ok("n1", "f1"), Transfer.tryParsePair "n1 = f1")
+
+    match Transfer.tryParsePair "n1" with
+    | Error(InvalidNodePair "n1") -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module BuildInfoTests =
+
+  open System
+  open System.Text.Json
+  open Gazelle
+
+  [<Fact>]
+  let ``Version JSON has every build field in order`` () =
+    let info = BuildInfo.ofAssembly (typeof<BuildInfo>.Assembly)
+    use document = JsonDocument.Parse(BuildInfo.toJson info)
+    let root = document.RootElement
+    Assert.Equal(JsonValueKind.Object, root.ValueKind)
+
+    let fields = [ for p in root.EnumerateObject() -> p.Name, p.Value ]
+    let texts = [ "version"; "commit"; "buildDate"; "runtime"; "platform" ]
+    Assert.Equal<string list>(texts @ [ "backends" ], List.map fst fields)
+
+    for name, value in fields |> List.take texts.Length do
+      Assert.Equal(JsonValueKind.String, value.ValueKind)
+      Assert.False(String.IsNullOrEmpty(value.GetString()), name)
+
+    let backends = root.GetProperty "backends"
+    Assert.Equal(JsonValueKind.Array, backends.ValueKind)
+
+    let listed = [ for b in backends.EnumerateArray() -> b.GetString() ]
+    Assert.Equal<string list>(List.ofArray info.Backends, listed)
+    Assert.Equal("unknown", root.GetProperty("commit").GetString())
+
+  [<Fact>]
+  let ``Backends list every linear solver`` () =
+    let backends = BuildInfo.backends |> List.ofArray
+    let solvers = [ "dense"; "skyline"; "skyline:rcm"; "skyline:natural" ]
+    let iterative = [ "pcg"; "pcg:jacobi" ]
+    Assert.Equal<string list>(solvers @ iterative, List.truncate 6 backends)
+
+    for name in backends |> List.truncate 6 do
+      Assert.True((LinearSolver.tryParse name).IsSome, name)
+
+module LedgerTests =
+
+  open System
+  open System.IO
+
+  let private entry mass =
+    { Timestamp = DateTimeOffset(2026, 1, 1, 0, 0, 0, TimeSpan.Zero)
+      Model = "Frame"
+      Nodes = 4
+      Elements = 3
+      Mass = mass
+      MaxDisplacement = Some 0.01
+      MaxUtilisation = None
+      Frequency = None }
+
+  [<Fact>]
+  let ``Entries are read back in the order appended`` () =
+    let path = Path.GetTempFileName()
+
+    try
+      Ledger.append path (entry (Some 100.0))
+      Ledger.append path (entry None)
+
+      match Ledger.read path with
+      | Ok entries ->
+        let expected = [ entry (Some 100.0); entry None ]
+        Assert.Equal<LedgerEntry list>(expected, entries)
+      | Error e -> Assert.Fail(LedgerError.getAsString e)
+    finally
+      File.Delete path
+
+  [<Fact>]
+  let ``Sparkline spans the range and leaves gaps`` () =
+    let values = [ Some 1.0; None; Some 3.0; Some 2.2 ]
+    Assert.Equal("▁ █▅", Ledger.sparkline values)
+    Assert.Equal("▅▅", Ledger.sparkline [ Some 2.0; Some 2.0 ])
+
+  [<Fact>]
+  let ``Total mass sums members with a density`` () =
+    let m =
+      StaticTests.model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0; "n3", 2.0, 1.0 ]
+        [ StaticTests.element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 0.01 ]
+          StaticTests.element "e2" "Truss2D" [ "n2"; "n3" ] [] ]
+        []
+        []
+
+    let steel = m.Materials["steel"]
+    Assert.Equal(None, Mass.total m)
+
+    let dense =
+      { m with
+          Materials = Map [ "steel", { steel with Density = Some 7850.0 } ] }
+
+    Assert.Equal(Some(7850.0 * 0.01 * 2.0), Mass.total dense)
+
+module ScriptTests =
+
+  open System.IO
+  open Gazelle.Model
+  open StaticTests
+
+  [<Fact>]
+  let ``Scripts analyse every load set and fail on a failed check`` () =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        [ force "l1" "n2" "Fx" 1e3 ]
+
+    let results = Script.analyse m
+    let extension = 1e3 * 2.0 / (200e9 * 1e-3)
+    let d = Script.maxDisplacement results[LoadCases.DefaultCase]
+    Assert.Equal(extension, d, 12)
+    Script.check "Extension within 1 mm" (d < 1e-3)
+    Assert.Equal(0, Script.exitCode ())
+    Script.check "Extension within 1 μm" (d < 1e-6)
+    Assert.Equal(1, Script.exitCode ())
+    Assert.Equal(2, Script.results().Length)
+
+  let private globals (source: string) =
+    match Starlark.run source with
+    | Ok values -> values
+    | Error e -> failwith (ScriptError.getAsString e)
+
+  [<Fact>]
+  let ``Starlark scripts loop, branch and call functions`` () =
+    let source =
+      String.concat
+        "\n"
+        [ "def square(x):"
+          "    return x * x"
+          ""
+          "total = 0"
+          "for i in range(5):"
+          "    if i % 2 == 0:"
+          "        continue"
+          "    total += square(i)"
+          ""
+          "evens = [i // 2 for i in range(10) if i % 2 == 0]"
+          "sizes = {\"a\": 1}"
+          "sizes[\"b\"] = len(evens)"
+          "label = \"{} of {}\".format(total, max(evens))" ]
+
+    let values = globals source
+    Assert.Equal("10", Starlark.toString values["total"])
+    Assert.Equal("[0, 1, 2, 3, 4]", Starlark.toString values["evens"])
+    Assert.Equal("{\"a\": 1, \"b\": 5}", Starlark.toString values["sizes"])
+    Assert.Equal("10 of 4", Starlark.toString values["label"])
+
+    match Starlark.run "x = 1\ny = x + \"a\"" with
+    | Error(RuntimeError(line, _)) -> Assert.Equal(2, line)
+    | _ -> Assert.Fail "Expected a runtime error on line 2"
+
+  [<Fact>]
+  let ``Starlark scripts build and analyse models`` () =
+    let m = model [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ] [] [] []
+    let name = $"gz-script-{System.Guid.NewGuid()}.json"
+    let path = Path.Combine(Path.GetTempPath(), name)
+    let forward = path.Replace('\\', '/')
+
+    let source =
+      String.concat
+        "\n"
+        [ $"m = load_model(\"{forward}\")"
+          "m = add_element(m, \"e1\", \"Truss2D\", [\"n1\", \"n2\"], \"steel\","
+          "                {\"area\": 1e-3})"
+          "m = add_support(m, \"c1\", \"n1\", [\"Ux\", \"Uy\"])"
+          "m = add_support(m, \"c2\", \"n2\", [\"Uy\"])"
+          "m = add_force(m, \"l1\", \"n2\", \"Fx\", 1e3)"
+          "r = analyse(m)[\"default\"]"
+          "ux = displacement(r, \"n2\", \"Ux\")"
+          "tension = member_forces(r, \"e1\")[1]" ]
+
+    try
+      match Model.save path m with
+      | Error e -> Assert.Fail(ModelError.getAsString e)
+      | Ok() ->
+        let values = globals source
+        let number key = float (Starlark.toString values[key])
+        Assert.Equal(1e3 * 2.0 / (200e9 * 1e-3), number "ux", 12)
+        Assert.Equal(1e3, number "tension", 6)
+    finally
+      File.Delete path
+
+module GoldenTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  let private bar =
+    model
+      [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+      [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+      [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+      [ force "l1" "n2" "Fx" 1e3 ]
+
+  let private results () =
+    match Golden.analyse bar with
+    | Ok results -> results
+    | Error e -> failwith (GoldenError.getAsString e)
+
+  [<Fact>]
+  let ``Recorded results pass against themselves`` () =
+    let results = results ()
+    let expected = Golden.record "bar.json" results
+    Assert.Empty(Golden.compare expected results)
+
+  [<Fact>]
+  let ``Values outside the tolerance or missing are mismatches`` () =
+    let extension = 1e3 * 2.0 / (200e9 * 1e-3)
+
+    let set =
+      { Displacements = Some(Map [ "n2", Map [ "Ux", extension * 1.001 ] ])
+        Reactions = Some(Map [ "n1", Map [ "Ux", -1e3 ] ])
+        MemberForces = Some(Map [ "e1", [ -1e3 * (1.0 + 1e-7); 1e3; 0.0 ] ]) }
+
+    let expected =
+      { Model = "bar.json"
+        Absolute = Golden.Absolute
+        Relative = Golden.Relative
+        LoadSets = Map [ LoadCases.DefaultCase, set; "ULS", set ] }
+
+    let mismatches = Golden.compare expected (results ())
+
+    let inDefault, inMissing =
+      mismatches |> List.partition (fun m -> m.LoadSet = LoadCases.DefaultCase)
+
+    // The truss has two end forces, so a third is missing.
+    Assert.Equal<string list>(
+      [ "displacement n2 Ux"; "member force e1[2]" ],
+      inDefault |> List.map (fun m -> m.Quantity)
+    )
+
+    Assert.Equal(None, inDefault[1].Actual)
+    Assert.Equal(5, inMissing.Length)
+    Assert.True(inMissing |> List.forall (fun m -> m.Actual.IsNone))
+
+module SnapshotTests =
+
+  open System.IO
+  open System.IO.Compression
+  open System.Text
+  open System.Text.Json.Nodes
+  open Gazelle.Model
+  open StaticTests
+
+  let private bar =
+    model
+      [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+      [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+      [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+      [ force "l1" "n2" "Fx" 1e3 ]
+
+  let private files =
+    Map [ "results.json", Encoding.UTF8.GetBytes "{\"x\": 1}" ]
+
+  [<Fact>]
+  let ``Snapshots read back the model and files they were written with`` () =
+    let path = Path.GetTempFileName()
+
+    try
+      let written = Snapshot.write path bar files
+
+      match Snapshot.read path with
+      | Ok(manifest, m, others) ->
+        Assert.Equal(written, manifest)
+        Assert.Equal(Provenance.modelHash bar, Provenance.modelHash m)
+        Assert.Equal<Map<string, byte array>>(files, others)
+      | Error e -> Assert.Fail(SnapshotError.getAsString e)
+    finally
+      File.Delete path
+
+  [<Fact>]
+  let ``Altered snapshot files are refused`` () =
+    let path = Path.GetTempFileName()
+
+    try
+      Snapshot.write path bar files |> ignore
+
+      do
+        use archive = ZipFile.Open(path, ZipArchiveMode.Update)
+        archive.GetEntry("results.json").Delete()
+        use stream = archive.CreateEntry("results.json").Open()
+        stream.Write(Encoding.UTF8.GetBytes "{\"x\": 2}")
+
+      match Snapshot.read path with
+      | Error(CorruptEntry name) -> Assert.Equal("results.json", name)
+      | other -> Assert.Fail($"Unexpected result: {other}")
+    finally
+      File.Delete path
+
+  [<Fact>]
+  let ``Results compare within tolerance, ignoring named properties`` () =
+    let expected =
+      JsonNode.Parse """{"u": 1.0, "ids": ["a"], "provenance": {"t": 1}}"""
+
+    let close =
+      JsonNode.Parse """{"u": 1.0000001, "ids": ["a"], "provenance": {}}"""
+
+    let far = JsonNode.Parse """{"u": 1.1, "ids": ["b"], "extra": 0}"""
+    let ignored = set [ "provenance" ]
+
+    Assert.Empty(Snapshot.compare ignored expected close)
+
+    Assert.Equal<string list>(
+      [ "$.u"; "$.ids[0]"; "$.extra" ],
+      Snapshot.compare ignored expected far |> List.map (fun d -> d.Path)
+    )
+
+  [<Fact>]
+  let ``Renders draw each element and support`` () =
+    let svg = Snapshot.render bar (Map [ "e1", 1.2 ])
+
+    Assert.Contains("id=\"e1\"", svg)
+    Assert.Contains("#c62828", svg)
+    Assert.Equal(2, svg.Split("<rect").Length - 1)
+
+module GltfTests =
+
+  open System
+  open System.Text
+  open System.Text.Json.Nodes
+  open Gazelle.Model
+  open StaticTests
+
+  // A frame in millimetres carrying a triangular plate.
+  let private frame =
+    { model
+        [ "n1", 0.0, 0.0; "n2", 2000.0, 0.0; "n3", 2000.0, 1000.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ]
+          element "p1" "Plate" [ "n1"; "n2"; "n3" ] [ "thickness", 0.2 ] ]
+        []
+        [] with
+        Info.Units = "N-mm" }
+
+  let private shape =
+    { Name = "DL"; Displacements = Map [ "n2", Map [ Uy, -2.0 ] ] }
+
+  [<Fact>]
+  let ``Scenes hold the model and its deformed shapes in metres`` () =
+    let gltf = JsonNode.Parse(Gltf.toGltf frame [ shape ] 100.0)
+    let name (n: JsonNode) = n["name"].GetValue<string>()
+    let names = gltf["nodes"].AsArray() |> Seq.map name
+    Assert.Equal<string list>([ "Static"; "DL" ], List.ofSeq names)
+
+    let modes =
+      (gltf["meshes"][0]["primitives"]).AsArray()
+      |> Seq.map (fun p -> p["mode"].GetValue<int>())
+
+    Assert.Equal<int list>([ 0; 1; 4 ], List.ofSeq modes)
+
+    let bound (mesh: int) (name: string) (axis: int) =
+      let position = gltf["meshes"][mesh]["primitives"][0]["attributes"]
+      let accessor = gltf["accessors"][position["POSITION"].GetValue<int>()]
+      (accessor[name][axis]).GetValue<float>()
+
+    Assert.Equal(2.0, bound 0 "max" 0, 6)
+    Assert.Equal(0.0, bound 0 "min" 1, 6)
+    Assert.Equal(-0.2, bound 1 "min" 1, 6)
+
+    let buffer = gltf["buffers"][0]
+    let uri = buffer["uri"].GetValue<string>()
+    let data = Convert.FromBase64String(uri.Substring(uri.IndexOf ',' + 1))
+    Assert.Equal(buffer["byteLength"].GetValue<int>(), data.Length)
+
+  [<Fact>]
+  let ``Binary scenes pack the JSON and buffer into aligned chunks`` () =
+    let glb = Gltf.toGlb frame [] 1.0
+    let word (i: int) = BitConverter.ToUInt32(glb, i)
+
+    Assert.Equal(0x46546C67u, word 0)
+    Assert.Equal(uint32 glb.Length, word 8)
+
+    let json = int (word 12)
+    Assert.Equal(0, json % 4)
+    let scene = JsonNode.Parse(Encoding.UTF8.GetString(glb, 20, json))
+    Assert.Equal(1, scene["nodes"].AsArray().Count)
+
+    let binary = 20 + json
+    Assert.Equal(0x004E4942u, word (binary + 4))
+    let length = (scene["buffers"][0]["byteLength"]).GetValue<int>()
+    Assert.Equal(length, int (word binary))
+
+module OpenSeesTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // A cantilever frame carrying a tip load and a uniform load.
+  let private cantilever =
+    let udl =
+      { snd (force "l2" "n1" "Fy" -500.0) with
+          Type = "Distributed"
+          Node = None
+          Element = Some "e1" }
+
+    { model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n2" "Fy" -1000.0; "l2", udl ] with
+        Info.Dimensions = Some 2 }
+
+  let private script language (m: Model) =
+    match LoadCases.select m None None with
+    | Ok sets -> OpenSees.toScript language m sets
+    | Error e -> failwith (SelectionError.getAsString e)
+
+  [<Fact>]
+  let ``Tcl scripts build and load plane frames`` () =
+    match script Tcl cantilever with
+    | Ok tcl ->
+      let lines = tcl.Split '\n'
+      Assert.Contains("model basic -ndm 2 -ndf 3", lines)
+      Assert.Contains("fix 1 1 1 1", lines)
+
+      let beam = "element elasticBeamColumn 1 1 2 0.01 200000000000.0 0.0001 1"
+      Assert.Contains(beam + " ;# e1", lines)
+      Assert.Contains("  load 2 0.0 -1000.0 0.0", lines)
+      Assert.Contains("  eleLoad -ele 1 -type -beamUniform -500.0 0.0", lines)
+      Assert.Contains("analyze 1", lines)
+    | Error e -> Assert.Fail(OpenSeesError.getAsString e)
+
+  [<Fact>]
+  let ``Python scripts call OpenSeesPy`` () =
+    match script Python cantilever with
+    | Ok py ->
+      let lines = py.Split '\n'
+      Assert.Equal("import openseespy.opensees as ops", lines[0])
+      Assert.Contains("ops.fix(1, 1, 1, 1)", lines)
+      Assert.Contains("nodes = [(1, 'n1'), (2, 'n2')]", lines)
+      Assert.Contains("ops.pattern('Plain', 1, 1)", lines)
+    | Error e -> Assert.Fail(OpenSeesError.getAsString e)
+
+  [<Fact>]
+  let ``Parts OpenSees cannot take are refused`` () =
+    let inclined =
+      { cantilever with
+          Constraints =
+            cantilever.Constraints
+            |> Map.map (fun _ c -> { c with Angle = Some 30.0 }) }
+
+    match script Tcl inclined with
+    | Error(UntranslatableSupport("c1", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+    let mixed =
+      { cantilever with
+          Info = { cantilever.Info with Dimensions = None }
+          Elements =
+            cantilever.Elements
+            |> Map.add "e2" (snd (element "e2" "Truss3D" [ "n1"; "n2" ] []))
+            |> Map.add "e3" (snd (element "e3" "Beam3D" [ "n1"; "n2" ] [])) }
+
+    match script Tcl mixed with
+    | Error(UntranslatableElement("e1", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module AbaqusExportTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // A cantilever frame carrying a tip load and a uniform load.
+  let private cantilever =
+    let udl =
+      { snd (force "l2" "n1" "Fy" -500.0) with
+          Type = "Distributed"
+          Node = None
+          Element = Some "e1" }
+
+    { model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", 1e-4 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n2" "Fy" -1000.0; "l2", udl ] with
+        Info.Dimensions = Some 2 }
+
+  let private input (m: Model) =
+    match LoadCases.select m None None with
+    | Ok sets -> AbaqusExport.toInput m sets
+    | Error e -> failwith (SelectionError.getAsString e)
+
+  [<Fact>]
+  let ``Plane frames become B23 beams of general sections`` () =
+    match input cantilever with
+    | Ok deck ->
+      let lines = deck.Split '\n'
+      Assert.Contains("*ELEMENT, TYPE=B23, ELSET=E1", lines)
+      Assert.Contains("0.01, 0.0001, 0., 0.0001, 0.0001", lines)
+      Assert.Contains("1, 6, 6", lines)
+      Assert.Contains("2, 2, -1000", lines)
+      Assert.Contains("1, PY, -500", lines)
+      Assert.Contains("** 1, e1", lines)
+    | Error e -> Assert.Fail(AbaqusError.getAsString e)
+
+  [<Fact>]
+  let ``Abaqus input reads back as the same model`` () =
+    let displacement (m: Model) =
+      match LoadCases.select m None None with
+      | Ok [ set ] ->
+        match Static.analyse m set with
+        | Ok r -> r.Displacements["n2"][Uy]
+        | Error e -> failwith $"{e}"
+      | other -> failwith $"Unexpected load sets: {other}"
+
+    match input cantilever |> Result.map (Model.parse Abaqus) with
+    | Ok(Ok m) ->
+      Assert.Equal(displacement cantilever, displacement m, 12)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Parts Abaqus cannot take are refused`` () =
+    let inclined =
+      { cantilever with
+          Constraints =
+            cantilever.Constraints
+            |> Map.map (fun _ c -> { c with Angle = Some 30.0 }) }
+
+    match input inclined with
+    | Error(UnexportableSupport("c1", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+    let beam =
+      { cantilever with
+          Elements =
+            cantilever.Elements
+            |> Map.map (fun _ e -> { e with Type = "Beam2D" }) }
+
+    match input beam with
+    | Error(UnexportableElement("e1", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module CalibrationTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // A steel cantilever whose second moment of area is a parameter.
+  let private cantilever (i: float) =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Frame2D" [ "n1"; "n2" ] [ "area", 0.01; "i", i ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy"; "Rz" ] ]
+        [ force "l1" "n2" "Fy" -1000.0 ]
+
+    { m with
+        Info.Dimensions = Some 2
+        Parameters = Some(Map [ "I", i ])
+        Materials =
+          m.Materials |> Map.map (fun _ s -> { s with Density = Some 7850.0 }) }
+
+  let private mass = MassMatrix.Consistent
+
+  // Tip deflection PL³/3EI.
+  let private deflection i = -1000.0 * 8.0 / (3.0 * 200e9 * i)
+
+  [<Fact>]
+  let ``Measurements are read after a header and comments`` () =
+    let text =
+      "# sensors\nquantity,set,node,dof,value\n\
+       displacement, default, n2, Uy, -0.5e-3\nfrequency;2;4.5\n"
+
+    match Calibration.parse text with
+    | Ok [ MeasuredDisplacement("default", "n2", Uy, -0.5e-3)
+           MeasuredFrequency(2, 4.5) ] -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+    match Calibration.parse "frequency,1,2\nfrequency,0,2" with
+    | Error(MalformedMeasurements(2, _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Predictions are compared by relative error`` () =
+    let measured = deflection 1e-4 * 1.25
+    let displacement = MeasuredDisplacement("default", "n2", Uy, measured)
+
+    match Calibration.compare mass (cantilever 1e-4) [ displacement ] with
+    | Ok [ c ] ->
+      Assert.Equal(deflection 1e-4, c.Predicted, 12)
+      Assert.Equal(0.2, c.Error, 9)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+    let frequency = MeasuredFrequency(9, 1.0)
+
+    match Calibration.compare mass (cantilever 1e-4) [ frequency ] with
+    | Error(CalibrationError.MissingMode 9) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Tuning recovers a stiffness from measurements`` () =
+    let measurements =
+      [ MeasuredDisplacement("default", "n2", Uy, deflection 2e-4) ]
+
+    let build (values: Map<string, float>) = Ok(cantilever values["I"])
+
+    let tune names =
+      Calibration.tune mass build names (cantilever 1e-4) measurements
+
+    match tune [ "I" ] with
+    | Ok r ->
+      Assert.True(r.Converged)
+      Assert.Equal(1e-4, r.Initial["I"], 12)
+      Assert.Equal(2e-4, r.Tuned["I"], 9)
+      Assert.True(Calibration.rms r.After < 1e-6)
+    | Error e -> Assert.Fail(CalibrationError.getAsString e)
+
+    match tune [ "E" ] with
+    | Error(UntunableParameter "E") -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module SizingTests =
+
+  open Gazelle.Model
+  open StaticTests
+
+  // A steel bar stressed to 100 MPa in tension, extending by 1 mm.
+  let private bar =
+    let m =
+      model
+        [ "n1", 0.0, 0.0; "n2", 2.0, 0.0 ]
+        [ element "e1" "Truss2D" [ "n1"; "n2" ] [ "area", 1e-3 ] ]
+        [ fixity "c1" "n1" [ "Ux"; "Uy" ]; fixity "c2" "n2" [ "Uy" ] ]
+        [ force "l1" "n2" "Fx" 1e5 ]
+
+    { m with
+        Materials =
+          m.Materials
+          |> Map.map (fun _ s ->
+            { s with
+                Density = Some 7850.0
+                YieldStrength = Some 355e6 }) }
+
+  let private targets =
+    { MaxUtilisation = 1.0
+      MinFrequency = None
+      MaxDeflection = None }
+
+  let private size t = Sizing.size MassMatrix.Consistent t bar
+
+  [<Fact>]
+  let ``Members are fully stressed where strength governs`` () =
+    match size { targets with MinFrequency = Some 100.0 } with
+    | Ok r ->
+      let scale = r.Members.Head.Scale
+      let area = r.Model.Elements["e1"].Properties.Value["area"]
+      Assert.InRange(scale, 100.0 / 355.0 * 0.99, 100.0 / 355.0 * 1.01)
+      Assert.Equal(1e-3 * scale, area, 12)
+      Assert.InRange(r.Utilisation, 0.99, 1.01)
+      Assert.True(r.Frequency.Value > 100.0)
+      Assert.True(r.Mass < r.InitialMass)
+    | Error e -> Assert.Fail(SizingError.getAsString e)
+
+  [<Fact>]
+  let ``Deflection and frequency limits stiffen the structure`` () =
+    match size { targets with MaxDeflection = Some 0.5e-3 } with
+    | Ok r ->
+      Assert.InRange(r.Members.Head.Scale, 1.98, 2.02)
+      Assert.True(r.Deflection <= 0.5e-3 * 1.01)
+      Assert.True(r.Utilisation < 0.2)
+    | Error e -> Assert.Fail(SizingError.getAsString e)
+
+    // The bar's own mass grows with its stiffness, so no size lifts its
+    // axial frequency of about 700 Hz.
+    match size { targets with MinFrequency = Some 1000.0 } with
+    | Error(InfeasibleMember("e1", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+    match size { targets with MaxUtilisation = 0.0 } with
+    | Error(InvalidTarget _) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module VerificationTests =
+
+  [<Fact>]
+  let ``Every benchmark agrees with its closed-form solution`` () =
+    match Verification.runAll () with
+    | Ok checks ->
+      let benchmarks = checks |> List.map (fun c -> c.Benchmark) |> List.distinct
+      Assert.Equal(Verification.all.Length, benchmarks.Length)
+
+      for c in checks do
+        let detail = $"{c.Benchmark}: {c.Quantity} off by {c.PercentError} %%"
+        Assert.True(c.Passed, detail)
+    | Error e -> Assert.Fail(VerificationError.getAsString e)
+
+module ProvenanceTests =
+
+  [<Fact>]
+  let ``Provenance traces results to the model and solver`` () =
+    let bar length =
+      StaticTests.model [ "n1", 0.0, 0.0; "n2", length, 0.0 ] [] [] []
+
+    let outcome, p = Provenance.measure "sparse" (Some 1e-10) (bar 1.0) id
+    Assert.Equal((), outcome)
+    Assert.Equal("sparse", p.Solver)
+    Assert.Equal(Some 1e-10, p.Tolerance)
+    Assert.Equal(64, p.ModelHash.Length)
+    Assert.Equal(p.ModelHash, Provenance.modelHash (bar 1.0))
+    Assert.NotEqual<string>(p.ModelHash, Provenance.modelHash (bar 2.0))
+    Assert.True(p.WallTime >= 0.0 && p.CpuTime >= 0.0)
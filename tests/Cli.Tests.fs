@@ -0,0 +1,449 @@
+namespace Gazelle.Cli.Tests
+
+open System
+open System.IO
+open Xunit
+
+module CalibrateTests =
+
+  let private row: Program.CalibrationRow =
+    { Quantity = "displacement"
+      Set = Some "LL"
+      Node = Some "n2"
+      Dof = Some "Uy"
+      Mode = None
+      Measured = -0.0143
+      Predicted = -0.015
+      Error = -0.05
+      Tuned = None
+      TunedError = None }
+
+  [<Fact>]
+  let ``Calibration rows keep every cell`` () =
+    let cells = [ "[cyan]LL: n2 Uy[/]"; "-0.0143"; "-0.015"; "-5.0%" ]
+    Assert.Equal<string list>(cells, Program.calibrationCells row)
+
+    let tuned =
+      { row with
+          Tuned = Some(-0.0144)
+          TunedError = Some 0.007 }
+
+    Assert.Equal<string list>(
+      cells @ [ "-0.0144"; "0.7%" ],
+      Program.calibrationCells tuned
+    )
+
+  [<Fact>]
+  let ``Frequencies are labelled by mode`` () =
+    let frequency =
+      { row with
+          Quantity = "frequency"
+          Set = None
+          Node = None
+          Dof = None
+          Mode = Some 1 }
+
+    match Program.calibrationCells frequency with
+    | label :: _ -> Assert.Equal("[cyan]f1 (Hz)[/]", label)
+    | [] -> Assert.Fail "Expected cells."
+
+module CreateTests =
+
+  let run (args: string list) =
+    Program.executeCommand (Program.parse (Array.ofList args))
+
+  let temp (extension: string) =
+    Path.Combine(Path.GetTempPath(), $"{Guid.NewGuid()}{extension}")
+
+  [<Fact>]
+  let ``Templates create YAML models that analyse`` () =
+    let path = temp ".yaml"
+
+    try
+      for template in [ "beam"; "truss"; "frame"; "cable-stayed" ] do
+        let create = [ "create"; "--template"; template; "--output"; path ]
+        Assert.Equal(0, run create)
+        Assert.False((File.ReadAllText path).TrimStart().StartsWith "{")
+
+        let options = Program.parse [| "analyze"; path |]
+
+        match Program.loadModel options path with
+        | Ok model ->
+          match Program.analyzeModel options model with
+          | Ok result ->
+            Assert.NotEmpty(result.LoadSets)
+            Assert.Empty(result.Errors)
+          | Error msg -> Assert.Fail $"{template}: {msg}"
+        | Error msg -> Assert.Fail $"{template}: {msg}"
+
+        Assert.Equal(0, run [ "analyze"; path ])
+    finally
+      File.Delete path
+
+  [<Fact>]
+  let ``Template parameters are checked`` () =
+    Assert.Equal(0, run [ "create"; "--template"; "beam"; "--set"; "span=8" ])
+    Assert.Equal(1, run [ "create"; "--template"; "beam"; "--set"; "span=-1" ])
+    Assert.Equal(1, run [ "create"; "--template"; "beam"; "--set"; "width=8" ])
+    Assert.Equal(1, run [ "create"; "--template"; "arch" ])
+
+module OptimizeTests =
+
+  open Gazelle.Model
+  open Gazelle.Analysis
+  open CreateTests
+
+  [<Fact>]
+  let ``Optimize writes a beam stiff enough for its deflection limit`` () =
+    let model, sized = temp ".json", temp ".json"
+
+    // 10 kN at midspan deflects the 6 m beam by PL³/48EI = 2.68 mm.
+    let optimize =
+      [ "optimize"; model; "--max-deflection"; "1e-3"; "--output"; sized ]
+
+    try
+      match Examples.beam Examples.defaultBeam with
+      | Ok m ->
+        match Model.save model m with
+        | Ok() -> ()
+        | Error e -> Assert.Fail(ModelError.getAsString e)
+      | Error e -> Assert.Fail(ExampleError.getAsString e)
+
+      Assert.Equal(0, run optimize)
+
+      match Model.read None sized with
+      | Ok m ->
+        let area = m.Elements["e1"].Properties.Value["area"]
+        Assert.InRange(area / 5e-3, 1.6, 1.7)
+
+        match LoadCases.select m None None with
+        | Ok [ set ] ->
+          match Static.analyse m set with
+          | Ok r ->
+            let deflection = -r.Displacements["n2"][Uy]
+            Assert.InRange(deflection, 0.98e-3, 1.02e-3)
+          | Error e -> Assert.Fail(StaticError.getAsString e)
+        | other -> Assert.Fail($"Unexpected load sets: {other}")
+      | Error e -> Assert.Fail(ModelError.getAsString e)
+    finally
+      File.Delete model
+      File.Delete sized
+
+module ViewTests =
+
+  open System.Text
+  open System.Text.Json
+  open Gazelle.Model
+
+  let internal generated (model: Result<Model, ExampleError>) =
+    match model with
+    | Ok m -> m
+    | Error e -> failwith (ExampleError.getAsString e)
+
+  let private truss = generated (Examples.truss Examples.defaultTruss)
+
+  [<Fact>]
+  let ``View serves the page, model and axial forces`` () =
+    let routes = Program.viewRoutes Program.defaultOptions truss None
+    let paths = [ "/"; "/forces.json"; "/loads.json"; "/model.json" ]
+    Assert.Equal<string list>(paths, List.ofSeq routes.Keys)
+
+    let contentType, page = routes["/"]
+    Assert.Equal("text/html", contentType)
+    Assert.Contains("fetch(\"model.json\")", page)
+    Assert.Equal(Ok truss, Model.parse Json (snd routes["/model.json"]))
+
+    use forces = JsonDocument.Parse(snd routes["/forces.json"])
+
+    match List.ofSeq (forces.RootElement.EnumerateArray()) with
+    | [ set ] ->
+      // 20 kN at each top node: the bottom chord pulls with 20 kN, the top
+      // chord and end diagonals push with 20 kN and 20√2 kN.
+      let axial = set.GetProperty "forces"
+      let force (id: string) = axial.GetProperty(id).GetDouble()
+      Assert.Equal("LL", set.GetProperty("name").GetString())
+      Assert.Equal(20e3, force "e1", 6)
+      Assert.Equal(-20e3, force "e3", 6)
+      Assert.Equal(-20e3 * sqrt 2.0, force "e4", 6)
+    | other -> Assert.Fail($"Unexpected load sets: {other}")
+
+  [<Fact>]
+  let ``View routes known paths only`` () =
+    let routes = Program.viewRoutes Program.defaultOptions truss (Some "{}")
+
+    match Program.viewRoute routes "/results.json" with
+    | Some(contentType, body) ->
+      Assert.Equal("application/json; charset=utf-8", contentType)
+      Assert.Equal("{}", Encoding.UTF8.GetString body)
+    | None -> Assert.Fail "Expected results."
+
+    for path in [ "/missing.json"; "/results.json/"; "results.json" ] do
+      Assert.True((Program.viewRoute routes path).IsNone, path)
+
+module LoadOverlayTests =
+
+  open System.Text.Json
+  open Gazelle.Model
+  open ViewTests
+
+  let private bridge =
+    generated (Examples.cableStayed Examples.defaultCableStayed)
+
+  /// Factored magnitude of each load of each overlaid load set.
+  let private overlays (options: Program.CliOptions) =
+    let routes = Program.viewRoutes options bridge None
+    use sets = JsonDocument.Parse(snd routes["/loads.json"])
+
+    [ for set in sets.RootElement.EnumerateArray() ->
+        let loads =
+          [ for l in set.GetProperty("loads").EnumerateArray() ->
+              l.GetProperty("id").GetString(),
+              l.GetProperty("magnitude").GetDouble() ]
+
+        set.GetProperty("name").GetString(),
+        (set.GetProperty("kind").GetString(), Map loads) ]
+    |> Map.ofList
+
+  [<Fact>]
+  let ``Overlays are the factored loads of each load set`` () =
+    let sets = overlays Program.defaultOptions
+    Assert.Equal<string list>([ "DL"; "LL"; "ULS1" ], List.ofSeq sets.Keys)
+
+    let kind, dead = sets["DL"]
+    Assert.Equal("Case", kind)
+    Assert.Equal<Map<string, float>>(Map [ "l1", 1.0 ], dead)
+
+    let _, live = sets["LL"]
+    Assert.Equal(12, live.Count)
+    Assert.Equal(-1e5, live["l2"])
+
+    // ULS1 = 1.35 DL + 1.5 LL
+    let kind, ultimate = sets["ULS1"]
+    Assert.Equal("Combination", kind)
+    Assert.Equal(13, ultimate.Count)
+    Assert.Equal(1.35, ultimate["l1"], 12)
+    Assert.Equal(-1.5e5, ultimate["l2"], 6)
+
+  [<Fact>]
+  let ``Overlays follow the selected load sets`` () =
+    let options =
+      { Program.defaultOptions with
+          Cases = Some []
+          Combinations = Some [ "ULS1" ] }
+
+    Assert.Equal<string list>([ "ULS1" ], List.ofSeq (overlays options).Keys)
+
+module LspTests =
+
+  open System.Text
+  open System.Text.Json.Nodes
+  open Gazelle.Model
+  open ViewTests
+
+  let private frame (json: string) =
+    let body = Encoding.UTF8.GetBytes json
+    let header = $"Content-Length: {body.Length}\r\n\r\n"
+    Array.append (Encoding.ASCII.GetBytes header) body
+
+  let private notify (name: string) (parameters: JsonNode) =
+    let message = Rpc.notification name parameters
+    message["jsonrpc"] <- JsonValue.Create "2.0"
+    frame (message.ToJsonString())
+
+  /// Exit code and messages written by a session of the given frames.
+  let private session (frames: byte array list) =
+    use input = new MemoryStream(Array.concat frames)
+    use output = new MemoryStream()
+    let code = Program.lspServe Program.defaultOptions input output
+    use replies = new MemoryStream(output.ToArray())
+
+    let rec read messages =
+      match Rpc.read replies with
+      | Some(Ok message) -> read (message :: messages)
+      | Some(Error reason) -> failwith reason
+      | None -> List.rev messages
+
+    code, read []
+
+  let private document (uri: string) (text: string) =
+    JsonObject(
+      dict
+        [ "uri", JsonValue.Create uri :> JsonNode
+          "text", JsonValue.Create text ]
+    )
+
+  let private change (uri: string) (text: string) =
+    JsonObject(
+      dict
+        [ "textDocument",
+          JsonObject(dict [ "uri", JsonValue.Create uri :> JsonNode ])
+          :> JsonNode
+          "contentChanges",
+          JsonArray(JsonObject(dict [ "text", JsonValue.Create text ])) ]
+    )
+
+  /// Severities of the diagnostics of a publishDiagnostics notification.
+  let private severities (message: JsonObject) =
+    Assert.Equal(
+      "textDocument/publishDiagnostics",
+      message["method"].GetValue<string>()
+    )
+
+    [ for d in message["params"]["diagnostics"].AsArray() ->
+        d["severity"].GetValue<int>() ]
+
+  let private truss = generated (Examples.truss Examples.defaultTruss)
+
+  [<Fact>]
+  let ``Initialize reports the server's capabilities`` () =
+    let request =
+      """{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}"""
+
+    match session [ frame request ] with
+    | 0, [ reply ] ->
+      Assert.Equal(1, reply["id"].GetValue<int>())
+      let capabilities = reply["result"]["capabilities"]
+      Assert.Equal(1, capabilities["textDocumentSync"].GetValue<int>())
+      Assert.True(capabilities["hoverProvider"].GetValue<bool>())
+      let server = reply["result"]["serverInfo"]
+      Assert.Equal("gazelle", server["name"].GetValue<string>())
+    | other -> Assert.Fail($"Unexpected session: {other}")
+
+  [<Fact>]
+  let ``Opened and changed documents publish diagnostics`` () =
+    let uri = "file:///truss.json"
+    let valid = Model.serialize Json truss
+    let e1 = truss.Elements["e1"]
+
+    let dangling =
+      let e1 = { e1 with Nodes = [ "n1"; "n9" ] }
+      let elements = truss.Elements.Add("e1", e1)
+      Model.serialize Json { truss with Elements = elements }
+
+    let opened =
+      let broken = document uri "{ \"info\": " :> JsonNode
+      JsonObject(dict [ "textDocument", broken ])
+
+    match
+      session
+        [ notify "textDocument/didOpen" opened
+          notify "textDocument/didChange" (change uri valid)
+          notify "textDocument/didChange" (change uri dangling) ]
+    with
+    | 0, [ broken; fixed; dangled ] ->
+      Assert.Equal<int list>([ 1 ], severities broken)
+      Assert.DoesNotContain(1, severities fixed)
+      let errors = severities dangled |> List.filter ((=) 1)
+      Assert.Equal<int list>([ 1 ], errors)
+
+      // The error is placed at the key of the element it concerns.
+      let line =
+        dangling.Split('\n')
+        |> Array.findIndex (fun l -> l.Contains "\"e1\": {")
+
+      let diagnostic = dangled["params"]["diagnostics"][0]
+      let start = diagnostic["range"]["start"]
+      Assert.Equal(line, start["line"].GetValue<int>())
+      Assert.Equal(uri, dangled["params"]["uri"].GetValue<string>())
+    | other -> Assert.Fail($"Unexpected session: {other}")
+
+  [<Fact>]
+  let ``Malformed frames are answered with parse errors`` () =
+    let missing = Encoding.ASCII.GetBytes "Content-Type: text/plain\r\n\r\n"
+    let request = """{"jsonrpc":"2.0","id":2,"method":"initialise"}"""
+
+    match session [ missing; frame "{oops"; frame "[1]"; frame request ] with
+    | 0, [ header; json; array; unknown ] ->
+      for reply in [ header; json; array ] do
+        Assert.Null(reply["id"])
+        Assert.Equal(Rpc.ParseError, reply["error"]["code"].GetValue<int>())
+
+      Assert.Equal(2, unknown["id"].GetValue<int>())
+      let code = unknown["error"]["code"].GetValue<int>()
+      Assert.Equal(Rpc.MethodNotFound, code)
+    | other -> Assert.Fail($"Unexpected session: {other}")
+
+  [<Fact>]
+  let ``Shutdown answers and exit ends the session`` () =
+    let shutdown = """{"jsonrpc":"2.0","id":3,"method":"shutdown"}"""
+    let exit = """{"jsonrpc":"2.0","method":"exit"}"""
+    let late =
+      """{"jsonrpc":"2.0","id":4,"method":"initialize","params":{}}"""
+
+    match session [ frame shutdown; frame exit; frame late ] with
+    | 0, [ reply ] ->
+      Assert.Equal(3, reply["id"].GetValue<int>())
+      Assert.True(reply.ContainsKey "result")
+      Assert.Null(reply["result"])
+    | other -> Assert.Fail($"Unexpected session: {other}")
+
+module DoctorTests =
+
+  open System.Text.Json
+  open Gazelle.Model
+  open CreateTests
+  open ViewTests
+
+  /// Exit code and JSON report of gz doctor with the given self-test model.
+  let private diagnose (example: Result<Model, string>) =
+    let report = temp ".json"
+
+    let options =
+      { Program.defaultOptions with
+          Format = "json"
+          OutputFile = Some report
+          Ledger = Some(temp ".jsonl") }
+
+    try
+      let code = Program.doctor options example
+      code, JsonDocument.Parse(File.ReadAllText report).RootElement.Clone()
+    finally
+      File.Delete report
+
+  /// Status and detail of each check, by name.
+  let private checks (report: JsonElement) =
+    [ for c in report.GetProperty("checks").EnumerateArray() ->
+        let text (name: string) = c.GetProperty(name).GetString()
+        text "name", (text "status", text "detail") ]
+    |> Map.ofList
+
+  let private beam = generated (Examples.beam Examples.defaultBeam)
+
+  [<Fact>]
+  let ``Report lists every check of a healthy installation`` () =
+    let code, report = diagnose (Ok beam)
+
+    Assert.Equal(0, code)
+    Assert.True(report.GetProperty("healthy").GetBoolean())
+    let version = report.GetProperty("version").GetString()
+    Assert.Matches(@"^\d+\.\d+\.\d+$", version)
+
+    let checks = checks report
+
+    let names =
+      [ "Runtime"
+        "Processors"
+        "Memory"
+        "Temporary Space"
+        "Ledger"
+        "Self-Test" ]
+
+    Assert.Equal<string list>(List.sort names, checks.Keys |> List.ofSeq)
+
+    for name in names do
+      Assert.Contains(fst checks[name], [ "ok"; "warn" ])
+
+    Assert.StartsWith("no ledger at ", snd checks["Ledger"])
+    Assert.Contains("in equilibrium", snd checks["Self-Test"])
+
+  [<Fact>]
+  let ``Failed self-test sets a nonzero exit code`` () =
+    // Without its roller the beam swings freely about its pin.
+    let mechanism = { beam with Constraints = beam.Constraints.Remove "c2" }
+
+    for example in [ Ok mechanism; Error "example is missing" ] do
+      let code, report = diagnose example
+      Assert.Equal(1, code)
+      Assert.False(report.GetProperty("healthy").GetBoolean())
+      let status, _ = (checks report)["Self-Test"]
+      Assert.Equal("fail", status)
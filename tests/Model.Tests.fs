@@ -0,0 +1,1835 @@
+namespace Gazelle.Model.Tests
+
+open Xunit
+open Gazelle.Model
+
+module ModelTests =
+
+  let json =
+    """
+    {
+      "info": { "name": "Cantilever", "units": "SI", "version": "1.0" },
+      "nodes": {
+        "n1": { "id": "n1", "x": 0.0, "y": 0.0, "z": 0.0 },
+        "n2": { "id": "n2", "x": 3.0, "y": 0.0, "z": 0.0 }
+      },
+      "elements": {
+        "e1": {
+          "id": "e1", "type": "Frame2D", "nodes": ["n1", "n2"],
+          "material": "steel"
+        }
+      },
+      "materials": {
+        "steel": {
+          "id": "steel", "name": "S355", "type": "Steel",
+          "elastic_modulus": 210e9
+        }
+      }
+    }
+    """
+
+  [<Fact>]
+  let ``JSON model parses nodes, elements and materials`` () =
+    match Model.parse Json json with
+    | Ok m ->
+      Assert.Equal("Cantilever", m.Info.Name)
+      Assert.Equal(2, m.Nodes.Count)
+      Assert.Equal(3.0, m.Nodes["n2"].X)
+      Assert.Equal(210e9, m.Materials["steel"].ElasticModulus)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Omitted loads and constraints parse as empty`` () =
+    match Model.parse Json json with
+    | Ok m ->
+      Assert.True(m.Loads.IsEmpty)
+      Assert.True(m.Constraints.IsEmpty)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Serialized model round-trips`` () =
+    let original = Model.parse Json json
+    let roundTrip = original |> Result.map (Model.serialize Json)
+
+    match original, roundTrip |> Result.bind (Model.parse Json) with
+    | Ok a, Ok b -> Assert.Equal(a, b)
+    | _ -> Assert.Fail("Round-trip failed")
+
+  [<Fact>]
+  let ``Malformed JSON returns MalformedModel`` () =
+    match Model.parse Json "{ \"info\": " with
+    | Error(MalformedModel _) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Explicit format overrides unconventional extension`` () =
+    let path = System.IO.Path.GetTempFileName()
+    System.IO.File.WriteAllText(path, json)
+
+    try
+      match Model.read None path, Model.read (Some Json) path with
+      | Error(UnsupportedFormat _), Ok m ->
+        Assert.Equal("Cantilever", m.Info.Name)
+      | other -> Assert.Fail($"Unexpected result: {other}")
+    finally
+      System.IO.File.Delete path
+
+  [<Fact>]
+  let ``Unknown format name is rejected`` () =
+    match ModelFormat.tryParse "s2k" with
+    | Error(UnsupportedFormat _) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  /// Writes files into a fresh temporary directory and returns its path.
+  let internal scratch (files: (string * string) list) =
+    let dir =
+      System.IO.Path.Combine(
+        System.IO.Path.GetTempPath(),
+        System.Guid.NewGuid().ToString()
+      )
+
+    System.IO.Directory.CreateDirectory dir |> ignore
+
+    for name, text in files do
+      System.IO.File.WriteAllText(System.IO.Path.Combine(dir, name), text)
+
+    dir
+
+  let private info =
+    """ "info": { "name": "M", "units": "SI", "version": "1.0" } """
+
+  [<Fact>]
+  let ``$ref replaces a collection with part of another file`` () =
+    let shared =
+      """{ "materials": { "s": { "id": "s", "name": "S355",
+           "type": "Steel", "elastic_modulus": 210e9 } } }"""
+
+    let model =
+      $$"""{ {{info}}, "materials": { "$ref": "shared.json#/materials" } }"""
+
+    let dir = scratch [ "shared.json", shared; "model.json", model ]
+
+    match Model.read None (System.IO.Path.Combine(dir, "model.json")) with
+    | Ok m -> Assert.Equal("S355", m.Materials["s"].Name)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``$include merges documents and local definitions win`` () =
+    let shared =
+      """{ "nodes": { "n1": { "id": "n1", "x": 9, "y": 0, "z": 0 },
+                       "n2": { "id": "n2", "x": 1, "y": 0, "z": 0 } } }"""
+
+    let model =
+      $$"""{ "$include": ["shared.json"], {{info}},
+            "nodes": { "n1": { "id": "n1", "x": 0, "y": 0, "z": 0 } } }"""
+
+    let dir = scratch [ "shared.json", shared; "model.json", model ]
+
+    match Model.read None (System.IO.Path.Combine(dir, "model.json")) with
+    | Ok m ->
+      Assert.Equal(2, m.Nodes.Count)
+      Assert.Equal(0.0, m.Nodes["n1"].X)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Cyclic references are reported with their chain`` () =
+    let a = $$"""{ {{info}}, "materials": { "$ref": "b.json" } }"""
+    let b = """{ "$include": ["a.json"] }"""
+    let dir = scratch [ "a.json", a; "b.json", b ]
+
+    match Model.read None (System.IO.Path.Combine(dir, "a.json")) with
+    | Error(CyclicReference chain) -> Assert.Equal(3, chain.Length)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Missing referenced file reports its location`` () =
+    let model = $$"""{ {{info}}, "materials": { "$ref": "missing.json" } }"""
+    let dir = scratch [ "model.json", model ]
+
+    match Model.read None (System.IO.Path.Combine(dir, "model.json")) with
+    | Error(UnresolvedReference(location, _)) ->
+      Assert.Contains("$.materials", location)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  let private yaml =
+    """
+    # Same cantilever as the JSON model.
+    info: { name: Cantilever, units: SI, version: "1.0" }
+    nodes:
+      n1: { id: n1, x: 0.0, y: 0.0, z: 0.0 }
+      n2:
+        id: n2
+        x: 3.0 # tip
+        y: 0.0
+        z: 0.0
+    elements:
+      e1:
+        id: e1
+        type: Frame2D
+        nodes:
+          - n1
+          - n2
+        material: steel
+    materials:
+      steel: { id: steel, name: 'S355', type: Steel, elastic_modulus: 210e9 }
+    """
+
+  [<Fact>]
+  let ``YAML model parses as its JSON does`` () =
+    match Model.parse Yaml yaml, Model.parse Json json with
+    | Ok a, Ok b -> Assert.Equal(b, a)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Model round-trips through YAML`` () =
+    let original = Model.parse Json json
+    let text = original |> Result.map (Model.serialize Yaml)
+
+    match original, text |> Result.bind (Model.parse Yaml) with
+    | Ok a, Ok b -> Assert.Equal(a, b)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``YAML is detected from its extension`` () =
+    Assert.Equal(Ok Yaml, ModelFormat.fromPath "model.yaml")
+    Assert.Equal(Ok Yaml, ModelFormat.fromPath "model.YML")
+    Assert.Equal(Ok Yaml, ModelFormat.tryParse "yaml")
+
+  [<Fact>]
+  let ``Malformed YAML names the line at fault`` () =
+    let text = "info:\n  name: M\n    units: SI\n"
+
+    match Model.parse Yaml text with
+    | Error(MalformedModel reason) ->
+      Assert.True(reason.StartsWith "line 3:", reason)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``YAML reads block scalars and references JSON files`` () =
+    let shared =
+      """{ "materials": { "s": { "id": "s", "name": "S355",
+           "type": "Steel", "elastic_modulus": 210e9 } } }"""
+
+    let model =
+      "info:\n  name: >-\n    Portal\n    frame\n  units: SI\n"
+      + "  version: '1.0'\nmaterials:\n  $ref: shared.json#/materials\n"
+
+    let dir = scratch [ "shared.json", shared; "model.yml", model ]
+
+    match Model.read None (System.IO.Path.Combine(dir, "model.yml")) with
+    | Ok m ->
+      Assert.Equal("Portal frame", m.Info.Name)
+      Assert.Equal("S355", m.Materials["s"].Name)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Model round-trips through Protocol Buffers`` () =
+    let tip: Load =
+      { Id = "p"
+        Type = "Force"
+        Node = Some "n2"
+        Element = None
+        Direction = "Fy"
+        Magnitude = -1e3
+        Position = None
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = None
+        Case = Some "LL" }
+
+    match Model.parse Json json with
+    | Ok m ->
+      let m =
+        { m with
+            Parameters = Some(Map [ "span", 3.0 ])
+            Gravity =
+              Some
+                { Magnitude = 9.81
+                  Direction = [ 0.0; -1.0; 0.0 ] }
+            Loads = Map [ "p", tip ]
+            Masses = Some Map.empty }
+
+      let dir = scratch []
+      let path = System.IO.Path.Combine(dir, "model.pb")
+      Model.write Protobuf path m
+      Assert.Equal(Ok m, Model.read None path)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Truncated binary models are malformed`` () =
+    match Model.parse Json json |> Result.map Model.encode with
+    | Ok bytes ->
+      match Model.decode bytes[.. bytes.Length - 2] with
+      | Error(MalformedModel _) -> ()
+      | other -> Assert.Fail($"Unexpected result: {other}")
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Records read back from Protocol Buffers as their JSON`` () =
+    let json =
+      """{"formatVersion":7,"modelName":"M","maxStress":null,"""
+      + """"saved":["displacements"],"loadSets":[{"converged":true,"""
+      + """"residual":0.25,"applied":{}}]}"""
+
+    let node = System.Text.Json.Nodes.JsonNode.Parse json
+
+    match Protobuf.readRecord (Protobuf.writeRecord node) with
+    | Ok x ->
+      Assert.Equal(node.ToJsonString(), x.ToJsonString())
+      Assert.Equal(7, x["formatVersion"].GetValue<int>())
+    | Error reason -> Assert.Fail reason
+
+  let private template =
+    """
+    {
+      "info": { "name": "Span ${span} m", "units": "SI", "version": "1.0" },
+      "parameters": { "span": 6 },
+      "nodes": {
+        "n1": { "id": "n1", "x": 0, "y": 0, "z": 0 },
+        "n2": { "id": "n2", "x": "${span}", "y": 0, "z": "${LIFT:-0.5}" }
+      }
+    }
+    """
+
+  let private readTemplate (overrides: Map<string, string>) =
+    let dir = scratch [ "model.json", template ]
+    let options = { Model.defaultReadOptions with Parameters = overrides }
+    Model.readWith options (System.IO.Path.Combine(dir, "model.json"))
+
+  [<Fact>]
+  let ``Placeholders take declared parameter values and defaults`` () =
+    match readTemplate Map.empty with
+    | Ok m ->
+      Assert.Equal(6.0, m.Nodes["n2"].X)
+      Assert.Equal(0.5, m.Nodes["n2"].Z)
+      Assert.Equal("Span 6 m", m.Info.Name)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Overrides replace declared parameters`` () =
+    match readTemplate (Map [ "span", "7.5" ]) with
+    | Ok m ->
+      Assert.Equal(7.5, m.Nodes["n2"].X)
+      Assert.Equal(Some 7.5, m.Parameters |> Option.map (Map.find "span"))
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Text parameters are substituted but not kept`` () =
+    let model =
+      """
+      {
+        "info": { "name": "${title}", "units": "SI", "version": "1.0" },
+        "parameters": { "title": "Footbridge", "span": 6 }
+      }
+      """
+
+    match Model.parse Json model with
+    | Ok m ->
+      Assert.Equal("Footbridge", m.Info.Name)
+      Assert.Equal(Some(Map [ "span", 6.0 ]), m.Parameters)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Overriding an undeclared parameter is rejected`` () =
+    match readTemplate (Map [ "spam", "7.5" ]) with
+    | Error(UnknownParameter "spam") -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Unresolved placeholders report their location`` () =
+    let model = $$"""{ {{info}}, "nodes": { "n1": { "id": "${NOPE_X}" } } }"""
+
+    match Model.parse Json model with
+    | Error(UnresolvedParameter(location, "NOPE_X")) ->
+      Assert.Equal("$.nodes.n1.id", location)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module IfcTests =
+
+  let private ifc =
+    """ISO-10303-21;
+HEADER;
+FILE_SCHEMA(('IFC4'));
+ENDSEC;
+DATA;
+#1=IFCUNITASSIGNMENT((#2,#3));
+#2=IFCSIUNIT(*,.LENGTHUNIT.,.MILLI.,.METRE.);
+#3=IFCSIUNIT(*,.FORCEUNIT.,.KILO.,.NEWTON.);
+#4=IFCSTRUCTURALANALYSISMODEL('a',$,'Simple beam',$,$,.LOADING_3D.,$,$,$,$);
+#10=IFCVERTEXPOINT(#11);
+#11=IFCCARTESIANPOINT((0.,0.,0.));
+#12=IFCVERTEXPOINT(#13);
+#13=IFCCARTESIANPOINT((6000.,0.,0.));
+#14=IFCPRODUCTDEFINITIONSHAPE($,$,(#15));
+#15=IFCTOPOLOGYREPRESENTATION($,'Reference','Vertex',(#10));
+#16=IFCPRODUCTDEFINITIONSHAPE($,$,(#17));
+#17=IFCTOPOLOGYREPRESENTATION($,'Reference','Vertex',(#12));
+#20=IFCBOUNDARYNODECONDITION($,IFCBOOLEAN(.T.),IFCBOOLEAN(.T.),
+  IFCBOOLEAN(.T.),IFCBOOLEAN(.F.),IFCBOOLEAN(.F.),IFCBOOLEAN(.F.));
+#21=IFCBOUNDARYNODECONDITION($,$,$,IFCLINEARSTIFFNESSMEASURE(5.E6),$,$,$);
+#22=IFCSTRUCTURALPOINTCONNECTION('b',$,'A',$,$,$,#14,#20,$);
+#23=IFCSTRUCTURALPOINTCONNECTION('c',$,'B',$,$,$,#16,#21,$);
+#30=IFCEDGE(#10,#12);
+#31=IFCPRODUCTDEFINITIONSHAPE($,$,(#32));
+#32=IFCTOPOLOGYREPRESENTATION($,'Reference','Edge',(#30));
+#33=IFCSTRUCTURALCURVEMEMBER('d',$,'Beam',$,$,$,#31,.RIGID_JOINED_MEMBER.,$);
+#34=IFCMATERIAL('S275',$,'STEEL');
+#35=IFCRECTANGLEPROFILEDEF(.AREA.,$,$,100.,300.);
+#36=IFCMATERIALPROFILE($,$,#34,#35,$,$);
+#37=IFCMATERIALPROFILESET($,$,(#36),$);
+#38=IFCRELASSOCIATESMATERIAL('e',$,$,$,(#33),#37);
+#39=IFCPROPERTYSINGLEVALUE('YoungModulus',$,
+  IFCMODULUSOFELASTICITYMEASURE(2.1E11),$);
+#40=IFCMATERIALPROPERTIES('Pset_MaterialMechanical',$,(#39),#34);
+/* A force a quarter of the way along the beam */
+#41=IFCVERTEXPOINT(#42);
+#42=IFCCARTESIANPOINT((1500.,0.,0.));
+#43=IFCPRODUCTDEFINITIONSHAPE($,$,(#44));
+#44=IFCTOPOLOGYREPRESENTATION($,'Reference','Vertex',(#41));
+#45=IFCSTRUCTURALLOADSINGLEFORCE($,0.,0.,-20.,$,$,$);
+#46=IFCSTRUCTURALPOINTACTION('f',$,'P',$,$,$,#43,#45,.GLOBAL_COORDS.,$);
+#47=IFCRELCONNECTSSTRUCTURALACTIVITY('g',$,$,$,#33,#46);
+#48=IFCSTRUCTURALLOADGROUP('h',$,'Imposed',$,$,.LOAD_CASE.,$,$,$,$);
+#49=IFCRELASSIGNSTOGROUP('i',$,$,$,(#46),$,#48);
+#50=IFCSTRUCTURALLOADGROUP('j',$,'ULS',$,$,.LOAD_COMBINATION.,$,$,$,$);
+#51=IFCRELASSIGNSTOGROUPBYFACTOR('k',$,$,$,(#48),$,#50,1.5);
+ENDSEC;
+END-ISO-10303-21;
+"""
+
+  [<Fact>]
+  let ``IFC members and connections become elements and nodes`` () =
+    match Model.parse Ifc ifc with
+    | Ok m ->
+      Assert.Equal("Simple beam", m.Info.Name)
+      Assert.Equal(6.0, m.Nodes["B"].X)
+      Assert.Equal([ "A"; "B" ], m.Elements["Beam"].Nodes)
+      Assert.Equal("Frame3D", m.Elements["Beam"].Type)
+      let properties = m.Elements["Beam"].Properties.Value
+      Assert.Equal(0.03, properties["area"], 12)
+      Assert.Equal(0.1 * 0.3 ** 3.0 / 12.0, properties["iy"], 12)
+      Assert.Equal("Steel", m.Materials["S275"].Type)
+      Assert.Equal(2.1e11, m.Materials["S275"].ElasticModulus)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``IFC supports, loads and combinations carry over in SI units`` () =
+    match Model.parse Ifc ifc with
+    | Ok m ->
+      Assert.Equal("Pinned", m.Constraints["A"].Type)
+      Assert.Equal<string list>([ "Ux"; "Uy"; "Uz" ], m.Constraints["A"].Dof)
+      Assert.Equal(Some(Map [ "Uz", 5e6 ]), m.Constraints["B"].Stiffness)
+      let load = m.Loads["P-Fz"]
+      Assert.Equal(Some "Beam", load.Element)
+      Assert.Equal(Some 0.25, load.Position)
+      Assert.Equal(-20e3, load.Magnitude)
+      Assert.Equal(Some "Imposed", load.Case)
+      Assert.Equal(1.5, m.Combinations["ULS"].Factors["Imposed"])
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``IFC is detected from its extension but cannot be saved`` () =
+    Assert.Equal(Ok Ifc, ModelFormat.fromPath "model.IFC")
+
+    match Model.parse Ifc ifc with
+    | Ok m ->
+      match Model.save "model.ifc" m with
+      | Error(UnsupportedFormat _) -> ()
+      | other -> Assert.Fail($"Unexpected result: {other}")
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Malformed IFC names the line at fault`` () =
+    let text = "ISO-10303-21;\nDATA;\n#1=IFCPROJECT('a',$;\nENDSEC;\n"
+
+    match Model.parse Ifc text with
+    | Error(MalformedModel reason) ->
+      Assert.True(reason.StartsWith "line 3:", reason)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module StaadTests =
+
+  let private staad =
+    """STAAD PLANE PORTAL
+* Column bases at joints 1 and 4
+UNIT METER KN
+JOINT COORDINATES
+1 0 0 0; 2 0 4 0; 3 6 4 0; 4 6 0 0
+MEMBER INCIDENCES
+1 1 2; 2 2 3; 3 3 4
+MEMBER PROPERTY
+1 3 PRIS YD 0.4 ZD 0.2
+2 PRIS AX 0.01 IZ 0.0002
+MEMBER RELEASE
+2 START MZ
+CONSTANTS
+E STEEL ALL
+DENSITY STEEL ALL
+SUPPORTS
+1 FIXED
+4 FIXED BUT MZ KFX 500
+UNIT MMS KN
+LOAD 1 DEAD
+SELFWEIGHT Y -1
+MEMBER LOAD
+2 UNI GY -0.01 -
+  0 3000
+2 UMOM GZ 5
+JOINT LOAD
+2 FX 15
+LOAD 2 WIND
+FLOOR LOAD
+YRANGE 3 5 FLOAD -5
+LOAD COMBINATION 3 ULS
+1 1.35 2 1.5
+"""
+
+  [<Fact>]
+  let ``STAAD joints, members and supports become a model in SI units`` () =
+    match Model.parse Staad staad with
+    | Ok m ->
+      Assert.Equal(Some 2, m.Info.Dimensions)
+      Assert.Equal(6.0, m.Nodes["n3"].X)
+      Assert.Equal([ "n2"; "n3" ], m.Elements["m2"].Nodes)
+      Assert.Equal("Frame2D", m.Elements["m2"].Type)
+      let properties = m.Elements["m1"].Properties.Value
+      Assert.Equal(0.08, properties["area"], 12)
+      Assert.Equal(0.2 * 0.4 ** 3.0 / 12.0, properties["i"], 12)
+      let releases = m.Elements["m2"].Releases.Value
+      Assert.Equal<string list>([ "Rz" ], releases["n2"])
+      let material = m.Materials[m.Elements["m1"].Material]
+      Assert.Equal(199.948e9, material.ElasticModulus)
+      Assert.Equal("Fixed", m.Constraints["s1"].Type)
+      Assert.Equal<string list>([ "Uy" ], m.Constraints["s4"].Dof)
+      Assert.Equal(Some(Map [ "Ux", 500e3 ]), m.Constraints["s4"].Stiffness)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``STAAD loads and combinations carry over in SI units`` () =
+    match Model.parse Staad staad with
+    | Ok m ->
+      Assert.Equal("SelfWeight", m.Loads["L1-1"].Type)
+      let load = m.Loads["L1-2"]
+      Assert.Equal(Some "m2", load.Element)
+      Assert.Equal("Fy", load.Direction)
+      Assert.Equal(-10e3, load.Magnitude, 9)
+      Assert.Equal(Some 0.5, load.End)
+      Assert.Equal(15e3, m.Loads["L1-3"].Magnitude, 9)
+      Assert.Equal<Map<string, float>>(
+        Map [ "L1", 1.35 ],
+        m.Combinations["L3"].Factors
+      )
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``STAAD commands not imported are reported by line`` () =
+    match Staad.unsupported staad with
+    | Ok notes ->
+      Assert.Equal<string list>(
+        [ "line 25: MEMBER LOAD UMOM GZ is not imported"
+          "line 29: FLOOR LOAD is not imported"
+          "combination L3 omits L2, which has no loads" ],
+        notes
+      )
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+module AbaqusTests =
+
+  let private abaqus =
+    """*HEADING
+Portal frame
+** Columns are rectangular, the beam a general section
+*NODE
+1, 0., 0.
+2, 0., 4.
+3, 6., 4.
+4, 6., 0.
+*ELEMENT, TYPE=B23, ELSET=COLS
+1, 1, 2
+3, 3, 4
+*ELEMENT, TYPE=B23, ELSET=BEAM
+2, 2, 3
+*MATERIAL, NAME=Steel
+*ELASTIC
+2.1E11, 0.3
+*DENSITY
+7850.
+*BEAM SECTION, ELSET=COLS, MATERIAL=Steel, SECTION=RECT
+0.2, 0.4
+0., 0., -1.
+*BEAM GENERAL SECTION, ELSET=BEAM, SECTION=GENERAL, DENSITY=7850.
+0.01, 2.E-4, 0., 1.E-4, 3.E-4
+0., 0., -1.
+2.1E11, 8.1E10
+*RELEASE
+2, S1, M1
+*BOUNDARY
+1, ENCASTRE
+4, 1, 2
+4, 2, 2, -0.001
+*STEP, NAME=Dead, PERTURBATION
+*STATIC
+*CLOAD
+2, 1, 15000.
+*DLOAD
+BEAM, PY, -10000.
+*END STEP
+"""
+
+  [<Fact>]
+  let ``Abaqus nodes, elements and sections become a plane model`` () =
+    match Model.parse Abaqus abaqus with
+    | Ok m ->
+      Assert.Equal(Some 2, m.Info.Dimensions)
+      Assert.Equal(6.0, m.Nodes["n3"].X)
+      Assert.Equal([ "n2"; "n3" ], m.Elements["e2"].Nodes)
+      Assert.Equal("Frame2D", m.Elements["e1"].Type)
+      let properties = m.Elements["e1"].Properties.Value
+      Assert.Equal(0.08, properties["area"], 12)
+      Assert.Equal(0.2 * 0.4 ** 3.0 / 12.0, properties["i"], 12)
+      Assert.Equal(2e-4, m.Elements["e2"].Properties.Value["i"], 12)
+      let releases = m.Elements["e2"].Releases.Value
+      Assert.Equal<string list>([ "Rz" ], releases["n2"])
+      let steel = m.Materials["Steel"]
+      Assert.Equal(2.1e11 / 2.6, steel.ShearModulus.Value, 3)
+      Assert.Equal<string list>([ "Ux"; "Uy"; "Rz" ], m.Constraints["s1"].Dof)
+      let settlement = m.Constraints["s4"].Displacement
+      Assert.Equal(Some(Map [ "Uy", -0.001 ]), settlement)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Abaqus steps become load cases`` () =
+    match Model.parse Abaqus abaqus with
+    | Ok m ->
+      Assert.Equal("Fx", m.Loads["Dead-1"].Direction)
+      Assert.Equal(15e3, m.Loads["Dead-1"].Magnitude)
+      let load = m.Loads["Dead-2"]
+      Assert.Equal("Distributed", load.Type)
+      Assert.Equal(Some "e2", load.Element)
+      Assert.Equal(-10e3, load.Magnitude)
+      Assert.Equal(Some "Dead", load.Case)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Abaqus keywords Gazelle cannot read are errors by line`` () =
+    let deck = abaqus.Replace("*STATIC", "*STATIC\n*TEMPERATURE\n1, 20.")
+
+    match Model.parse Abaqus deck with
+    | Error(MalformedModel reason) ->
+      Assert.Equal("line 34: *TEMPERATURE is not supported", reason)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module TablesTests =
+
+  let private tables =
+    [ "nodes.csv", "id,x (m),y (m)\nn1,0,0\nn2,0,4\nn3,6,4\n"
+      "elements.csv",
+      "id;type;node1;node2;material;area;i\n\
+       e1;Frame2D;n1;n2;steel;0.01;1e-4\n\
+       e2;Frame2D;n2;n3;steel;0.01;1e-4\n"
+      "materials.csv", "id,name,E,density\nsteel,\"S355, rolled\",210e9,7850\n"
+      "supports.csv", "node,dof\nn1,Ux Uy Rz\n"
+      "loads.csv",
+      "# Wind and dead loads\n\
+       node,element,direction,magnitude,case\n\
+       n2,,Fx,10e3,Wind\n\
+       ,e2,Fy,-5e3,Dead\n\
+       n3,,Mz,2e3,Dead\n" ]
+
+  [<Fact>]
+  let ``Tables of nodes, elements and loads become a model`` () =
+    match Model.parseTables tables with
+    | Ok m ->
+      Assert.Equal(Some 2, m.Info.Dimensions)
+      Assert.Equal(4.0, m.Nodes["n2"].Y)
+      Assert.Equal([ "n2"; "n3" ], m.Elements["e2"].Nodes)
+      Assert.Equal(1e-4, m.Elements["e2"].Properties.Value["i"])
+      Assert.Equal("S355, rolled", m.Materials["steel"].Name)
+      Assert.Equal(210e9, m.Materials["steel"].ElasticModulus)
+      Assert.Equal<string list>([ "Ux"; "Uy"; "Rz" ], m.Constraints["s1"].Dof)
+      Assert.Equal("Force", m.Loads["l1"].Type)
+      Assert.Equal("Distributed", m.Loads["l2"].Type)
+      Assert.Equal(Some "e2", m.Loads["l2"].Element)
+      Assert.Equal("Moment", m.Loads["l3"].Type)
+      Assert.Equal(Some "Dead", m.Loads["l3"].Case)
+      Assert.Empty((Validation.validate m).Errors)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Defects in tables name the table and line`` () =
+    let unknown = [ "nodes.csv", "id,x,y,w\nn1,0,0,1\n" ]
+    let malformed = [ "nodes.csv", "id,x,y\n\nn1,0,zero\n" ]
+
+    match Model.parseTables unknown, Model.parseTables malformed with
+    | Error(MalformedModel a), Error(MalformedModel b) ->
+      Assert.Equal("nodes.csv line 1: has an unknown column 'w'", a)
+      Assert.Equal("nodes.csv line 3: has y 'zero', which is not a number", b)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Workbooks read back the model they were written from`` () =
+    let extra =
+      [ "info.csv", "name,units,description\nPortal,kN-m,Pinned at n3\n"
+        "releases.csv",
+        "id,type,material,node1,node2,area,i,releases\n\
+         e3,Frame2D,steel,n3,n4,0.01,1e-4,n3:Rz\n"
+        "springs.csv", "id,node,dof,stiffness\nk1,n4,Ux Uy,Rz:5e4\n"
+        "nodes.csv", "id,x,y\nn4,6,0\n"
+        "combinations.csv", "id,case,factor\nULS,Dead,1.35\nULS,Wind,1.5\n" ]
+
+    let path = System.IO.Path.GetTempFileName()
+
+    try
+      match Model.parseTables (tables @ extra) with
+      | Ok m ->
+        Assert.Equal("kN-m", m.Info.Units)
+        let releases = m.Elements["e3"].Releases.Value
+        Assert.Equal<string list>([ "Rz" ], releases["n3"])
+        Assert.Equal(5e4, m.Constraints["k1"].Stiffness.Value["Rz"])
+        Assert.Equal(1.5, m.Combinations["ULS"].Factors["Wind"])
+
+        Model.writeWorkbook path m
+
+        match Model.readWorkbook path with
+        | Ok read ->
+          Assert.Equal(Model.serialize Json m, Model.serialize Json read)
+        | Error e -> Assert.Fail(ModelError.getAsString e)
+      | Error e -> Assert.Fail(ModelError.getAsString e)
+    finally
+      System.IO.File.Delete path
+
+module ValidationTests =
+
+  let private model =
+    match Model.parse Json ModelTests.json with
+    | Ok m -> m
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Dangling node references are errors`` () =
+    let element =
+      { model.Elements["e1"] with
+          Nodes = [ "n1"; "n9" ] }
+
+    let report =
+      Validation.validate
+        { model with
+            Elements = Map [ "e1", element ] }
+
+    let expected = [ DanglingNode("e1", "n9") ]
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+    Assert.Equal(Some "e1", ValidationError.subject report.Errors.Head)
+
+  [<Fact>]
+  let ``Moments need a rotational degree of freedom`` () =
+    let moment =
+      { Id = "l1"
+        Type = "Moment"
+        Node = Some "n2"
+        Element = None
+        Direction = "Mz"
+        Magnitude = 5.0
+        Position = None
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = None
+        Case = None }
+
+    let withType t =
+      { model with
+          Elements = Map [ "e1", { model.Elements["e1"] with Type = t } ]
+          Loads = Map [ "l1", moment ] }
+
+    Assert.Empty((Validation.validate (withType "Frame2D")).Errors)
+
+    let expected = [ InactiveDof("l1", Rz) ]
+    let report = Validation.validate (withType "Truss2D")
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+
+  [<Fact>]
+  let ``Thermal loads need an expanding member that can bend`` () =
+    let heat =
+      { Id = "l1"
+        Type = "Thermal"
+        Node = None
+        Element = Some "e1"
+        Direction = "Temperature"
+        Magnitude = 20.0
+        Position = None
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = Some 50.0
+        Case = None }
+
+    let steel = model.Materials["steel"]
+
+    let withType t expansion =
+      { model with
+          Elements = Map [ "e1", { model.Elements["e1"] with Type = t } ]
+          Materials =
+            Map [ "steel", { steel with ThermalExpansion = expansion } ]
+          Loads = Map [ "l1", heat ] }
+
+    let errors t expansion = (Validation.validate (withType t expansion)).Errors
+
+    Assert.Empty(errors "Frame2D" (Some 12e-6))
+
+    let expected =
+      [ InvalidLoad("l1", "needs the thermal expansion of 'e1'") ]
+
+    Assert.Equal<ValidationError list>(expected, errors "Frame2D" None)
+
+    let expected = [ InvalidLoad("l1", "has a gradient but 'e1' cannot bend") ]
+    Assert.Equal<ValidationError list>(expected, errors "Truss2D" (Some 12e-6))
+
+  [<Fact>]
+  let ``Prescribed displacements need a restrained freedom`` () =
+    let settled =
+      { Id = "c1"
+        Type = "Prescribed"
+        Node = "n2"
+        Dof = [ "Uy" ]
+        Angle = None
+        Stiffness = None
+        Displacement = Some(Map [ "Uy", -0.01; "Ux", 0.002; "Uw", 0.0 ]) }
+
+    let report =
+      Validation.validate
+        { model with
+            Constraints = Map [ "c1", settled ] }
+
+    let expected =
+      [ InvalidSettlement("c1", "has unknown degree of freedom 'Uw'")
+        InvalidSettlement("c1", "prescribes 'Ux' but does not restrain it") ]
+
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+
+  [<Fact>]
+  let ``Restraints must name known degrees of freedom`` () =
+    let support dofs =
+      { Id = "c1"
+        Type = "Fixed"
+        Node = "n1"
+        Dof = dofs
+        Angle = None
+        Stiffness = None
+        Displacement = None }
+
+    let report =
+      Validation.validate
+        { model with
+            Constraints = Map [ "c1", support [ "Ux"; "Fy"; "rz"; "Uw" ] ] }
+
+    let expected =
+      [ InvalidRestraint(
+          "c1",
+          "has unknown degree of freedom 'Fy'; did you mean 'Uy'?"
+        )
+        InvalidRestraint(
+          "c1",
+          "has unknown degree of freedom 'rz'; did you mean 'Rz'?"
+        )
+        InvalidRestraint("c1", "has unknown degree of freedom 'Uw'") ]
+
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+
+  [<Fact>]
+  let ``Point masses need a node and non-negative rotary inertias`` () =
+    let equipment =
+      { Id = "m1"
+        Node = "n9"
+        Mass = -1.0
+        Inertia = Some(Map [ "Rz", 2.0; "Ux", 1.0 ]) }
+
+    let report =
+      Validation.validate
+        { model with
+            Masses = Some(Map [ "m1", equipment ]) }
+
+    let expected =
+      [ DanglingNode("m1", "n9")
+        InvalidMass("m1", "has mass -1; must be >= 0")
+        InvalidMass("m1", "has inertia about 'Ux'; use Rx, Ry or Rz") ]
+
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+
+  [<Fact>]
+  let ``Restraints the elements do not provide are warnings`` () =
+    let support =
+      { Id = "c1"
+        Type = "Fixed"
+        Node = "n1"
+        Dof = [ "Ux"; "Uy"; "Uz"; "Rz" ]
+        Angle = None
+        Stiffness = None
+        Displacement = None }
+
+    let report =
+      Validation.validate
+        { model with
+            Constraints = Map [ "c1", support ] }
+
+    Assert.Empty(report.Errors)
+    Assert.Contains(InactiveRestraint("c1", Uz), report.Warnings)
+    let warning = InactiveRestraint("c1", Rz)
+    Assert.DoesNotContain(warning, report.Warnings)
+
+  [<Fact>]
+  let ``2D models lie in the XY plane and use its freedoms`` () =
+    let support =
+      { Id = "c1"
+        Type = "Fixed"
+        Node = "n1"
+        Dof = [ "Ux"; "Uy"; "Uz"; "Rz" ]
+        Angle = None
+        Stiffness = None
+        Displacement = None }
+
+    let lateral =
+      { Id = "l1"
+        Type = "Force"
+        Node = Some "n2"
+        Element = None
+        Direction = "Fz"
+        Magnitude = 5.0
+        Position = None
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = None
+        Case = None }
+
+    let declared dimensions =
+      { model with
+          Info = { model.Info with Dimensions = Some dimensions }
+          Nodes = Map.add "n2" { model.Nodes["n2"] with Z = 1.0 } model.Nodes
+          Constraints = Map [ "c1", support ]
+          Loads = Map [ "l1", lateral ] }
+
+    let outside = "out of the plane of a 2D model"
+
+    let expected =
+      [ DimensionMismatch("n2", $"lies at z = 1, {outside}")
+        DimensionMismatch("c1", $"restrains Uz, {outside}")
+        DimensionMismatch("l1", $"acts along Fz, {outside}") ]
+
+    let errors d = (Validation.validate (declared d)).Errors
+    Assert.Equal<ValidationError list>(expected, errors 2)
+
+    let planar = "is a Frame2D, which a 3D model cannot hold"
+    Assert.Contains(DimensionMismatch("e1", planar), errors 3)
+    Assert.Contains(InvalidDimensions 4, errors 4)
+
+  [<Fact>]
+  let ``Members whose nodes coincide have zero length`` () =
+    let coincident = { model.Nodes["n1"] with Id = "n2" }
+
+    let report =
+      Validation.validate
+        { model with
+            Nodes = Map.add "n2" coincident model.Nodes }
+
+    Assert.Equal<ValidationError list>([ ZeroLength "e1" ], report.Errors)
+
+  [<Fact>]
+  let ``Parts and freedoms no constraint holds are warnings`` () =
+    let pin =
+      { Id = "c1"
+        Type = "Pinned"
+        Node = "n1"
+        Dof = [ "Ux"; "Uy" ]
+        Angle = None
+        Stiffness = None
+        Displacement = None }
+
+    let floating =
+      { model.Elements["e1"] with
+          Id = "e2"
+          Nodes = [ "n3"; "n4" ] }
+
+    let report =
+      Validation.validate
+        { model with
+            Nodes =
+              model.Nodes
+              |> Map.add "n3" { Id = "n3"; X = 0.0; Y = 2.0; Z = 0.0 }
+              |> Map.add "n4" { Id = "n4"; X = 3.0; Y = 2.0; Z = 0.0 }
+            Elements = Map.add "e2" floating model.Elements
+            Constraints = Map [ "c1", pin ] }
+
+    // A pinned cantilever is free to spin, and the floating member to move.
+    Assert.Contains(UnsupportedPart [ "n3"; "n4" ], report.Warnings)
+    Assert.Contains(Underconstrained 4, report.Warnings)
+    Assert.DoesNotContain(UnsupportedPart [ "n1"; "n2" ], report.Warnings)
+
+  [<Fact>]
+  let ``Clamped cantilever is held`` () =
+    let clamp =
+      { Id = "c1"
+        Type = "Fixed"
+        Node = "n1"
+        Dof = [ "Ux"; "Uy"; "Rz" ]
+        Angle = None
+        Stiffness = None
+        Displacement = None }
+
+    let report =
+      Validation.validate
+        { model with
+            Constraints = Map [ "c1", clamp ] }
+
+    Assert.Equal<ValidationWarning list>([ NoLoads ], report.Warnings)
+
+  [<Fact>]
+  let ``Unloaded, unconstrained model only warns`` () =
+    let report = Validation.validate model
+    Assert.Empty(report.Errors)
+    Assert.Contains(NoConstraints, report.Warnings)
+    Assert.True(Validation.passes false report)
+    Assert.False(Validation.passes true report)
+
+  [<Fact>]
+  let ``Every dangling material reference is reported`` () =
+    let element id material =
+      id, { model.Elements["e1"] with Id = id; Material = material }
+
+    let report =
+      Validation.validate
+        { model with
+            Elements = Map [ element "e1" "concrete"; element "e2" "timber" ] }
+
+    let expected =
+      [ DanglingMaterial("e1", "concrete"); DanglingMaterial("e2", "timber") ]
+
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+
+  [<Fact>]
+  let ``Element overrides apply over material defaults`` () =
+    let cracked =
+      { model.Elements["e1"] with
+          Properties = Some(Map [ "elastic_modulus", 105e9 ]) }
+
+    match Materials.ofElement model cracked with
+    | Some x ->
+      Assert.Equal(105e9, x.ElasticModulus)
+      Assert.Equal("S355", x.Name)
+    | None -> Assert.Fail "Expected the element's material."
+
+    let invalid =
+      { cracked with
+          Properties = Some(Map [ "elastic_modulus", 0.0 ]) }
+
+    let report =
+      Validation.validate
+        { model with
+            Elements = Map [ "e1", invalid ] }
+
+    match report.Errors with
+    | [ InvalidMaterial("e1", _) ] -> ()
+    | errors -> Assert.Fail($"Unexpected errors: {errors}")
+
+  [<Fact>]
+  let ``Springs need known freedoms and non-negative stiffness`` () =
+    let spring =
+      { model.Elements["e1"] with
+          Id = "s1"
+          Type = "Spring"
+          Nodes = [ "n2" ]
+          Material = ""
+          Properties = Some(Map [ "ux", -1e3; "uw", 1e3 ]) }
+
+    let report =
+      Validation.validate
+        { model with
+            Elements = Map [ "e1", model.Elements["e1"]; "s1", spring ] }
+
+    match report.Errors with
+    | [ InvalidSpring("s1", a); InvalidSpring("s1", b) ] ->
+      Assert.Contains("'uw'", a)
+      Assert.Contains("negative", b)
+    | errors -> Assert.Fail($"Unexpected errors: {errors}")
+
+  [<Fact>]
+  let ``Rigid links need no material but distinct nodes`` () =
+    let link nodes =
+      { model.Elements["e1"] with
+          Id = "l1"
+          Type = "RigidLink"
+          Nodes = nodes
+          Material = ""
+          Properties = None }
+
+    let validate nodes =
+      Validation.validate
+        { model with
+            Elements = Map [ "e1", model.Elements["e1"]; "l1", link nodes ] }
+
+    Assert.Empty((validate [ "n1"; "n2" ]).Errors)
+
+    let expected = [ InvalidLink("l1", "ties a node to itself") ]
+    let report = validate [ "n1"; "n2"; "n1" ]
+    Assert.Equal<ValidationError list>(expected, report.Errors)
+
+  [<Fact>]
+  let ``Releases name end nodes and freedoms of the member`` () =
+    let validate elementType releases =
+      let e =
+        { model.Elements["e1"] with
+            Type = elementType
+            Releases = Some(Map releases) }
+
+      (Validation.validate { model with Elements = Map [ "e1", e ] }).Errors
+
+    Assert.Empty(validate "Frame2D" [ "n2", [ "Rz" ] ])
+
+    let expected =
+      [ InvalidRelease("e1", "releases node 'n3' it does not connect")
+        InvalidRelease("e1", "cannot release 'Ry' at 'n3'") ]
+
+    let errors = validate "Frame2D" [ "n3", [ "Ry" ] ]
+    Assert.Equal<ValidationError list>(expected, errors)
+
+    match validate "Truss2D" [ "n2", [ "Rz" ] ] with
+    | [ InvalidRelease("e1", reason) ] -> Assert.Contains("Truss2D", reason)
+    | errors -> Assert.Fail($"Unexpected errors: {errors}")
+
+module LoadCasesTests =
+
+  let private load id case magnitude =
+    { Id = id
+      Type = "Point"
+      Node = Some "n2"
+      Element = None
+      Direction = "Fy"
+      Magnitude = magnitude
+      Position = None
+      End = None
+      EndMagnitude = None
+      Datum = None
+      Gradient = None
+      Case = case }
+
+  let private model =
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      { m with
+          Loads =
+            Map
+              [ "l1", load "l1" (Some "DL") -10.0
+                "l2", load "l2" (Some "LL") -5.0
+                "l3", load "l3" None -1.0 ]
+          Combinations =
+            Map
+              [ "ULS1",
+                { Id = "ULS1"
+                  Factors = Map [ "DL", 1.35; "LL", 1.5 ] } ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Loads without a case fall into the default case`` () =
+    let expected = [ "DL"; "LL"; LoadCases.DefaultCase ]
+    Assert.Equal<string list>(expected, LoadCases.cases model)
+
+  [<Fact>]
+  let ``No selection analyses every case and combination`` () =
+    match LoadCases.select model None None with
+    | Ok sets ->
+      let names = sets |> List.map (fun s -> s.Name)
+      let expected = [ "DL"; "LL"; LoadCases.DefaultCase; "ULS1" ]
+      Assert.Equal<string list>(expected, names)
+    | Error e -> Assert.Fail(SelectionError.getAsString e)
+
+  [<Fact>]
+  let ``Combination resultant applies factors`` () =
+    match LoadCases.select model None (Some [ "ULS1" ]) with
+    | Ok [ set ] ->
+      Assert.Equal(LoadCombination, set.Kind)
+      let total = set.Loads |> List.sumBy (fun (f, l) -> f * l.Magnitude)
+      Assert.Equal(-21.0, total, 9)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Unknown case names are rejected`` () =
+    match LoadCases.select model (Some [ "WL" ]) None with
+    | Error(UnknownCase("WL", _)) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module RenumberTests =
+
+  let private node id x = { Id = id; X = x; Y = 0.0; Z = 0.0 }
+
+  let private model =
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      let element =
+        { m.Elements["e1"] with
+            Nodes = [ "n2"; "n10" ] }
+
+      let support =
+        { Id = "fix"
+          Type = "Fixed"
+          Node = "n10"
+          Dof = [ "Ux" ]
+          Angle = None
+          Stiffness = None
+          Displacement = None }
+
+      { m with
+          Nodes = Map [ "n2", node "n2" 0.0; "n10", node "n10" 3.0 ]
+          Elements = Map [ "e1", element ]
+          Constraints = Map [ "fix", support ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Renumbering follows natural order and rewrites references`` () =
+    let renumbered = Renumber.apply Renumber.defaultOptions model
+    let expected = [ "n1"; "n2" ]
+    let ids = renumbered.Nodes |> Map.toList |> List.map fst
+    Assert.Equal<string list>(expected, ids)
+    Assert.Equal<string list>(expected, renumbered.Elements["e1"].Nodes)
+    Assert.Equal(3.0, renumbered.Nodes["n2"].X)
+    Assert.Equal("n2", renumbered.Constraints["c1"].Node)
+    Assert.Empty((Validation.validate renumbered).Errors)
+
+module UnitSystemTests =
+
+  let private model =
+    match Model.parse Json ModelTests.json with
+    | Ok m -> m
+    | Error e -> failwith (ModelError.getAsString e)
+
+  let private convert name m =
+    UnitSystem.tryFind name |> Result.bind (fun u -> UnitSystem.convert u m)
+
+  [<Fact>]
+  let ``Converting SI to N-mm scales lengths and stresses`` () =
+    match convert "N-mm" model with
+    | Ok m ->
+      Assert.Equal("N-mm", m.Info.Units)
+      Assert.Equal(3000.0, m.Nodes["n2"].X, 9)
+      Assert.Equal(210e3, m.Materials["steel"].ElasticModulus, 6)
+    | Error e -> Assert.Fail(ConversionError.getAsString e)
+
+  [<Fact>]
+  let ``Converting to imperial and back restores the model`` () =
+    match convert "kip-in" model |> Result.bind (convert "SI") with
+    | Ok m ->
+      Assert.Equal("SI", m.Info.Units)
+      Assert.Equal(3.0, m.Nodes["n2"].X, 9)
+      Assert.Equal(210e9, m.Materials["steel"].ElasticModulus, 0)
+    | Error e -> Assert.Fail(ConversionError.getAsString e)
+
+  [<Fact>]
+  let ``Self-weight multipliers are the same in every unit system`` () =
+    let weight =
+      { Id = "sw"
+        Type = "SelfWeight"
+        Node = None
+        Element = None
+        Direction = "Gravity"
+        Magnitude = 1.35
+        Position = None
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = None
+        Case = None }
+
+    let m = { model with Loads = Map [ "sw", weight ] }
+    let restored = convert "kip-in" m |> Result.bind (convert "SI")
+
+    match convert "kN-mm" m, restored with
+    | Ok converted, Ok restored ->
+      Assert.Equal(1.35, converted.Loads["sw"].Magnitude, 12)
+      Assert.Equal(1.35, restored.Loads["sw"].Magnitude, 12)
+    | Error e, _
+    | _, Error e -> Assert.Fail(ConversionError.getAsString e)
+
+module PartsTests =
+
+  // The right-hand part is modelled in N-mm, the assembly in SI.
+  let private right =
+    ModelTests.json
+      .Replace("\"SI\"", "\"N-mm\"")
+      .Replace("\"x\": 3.0", "\"x\": 3000.0")
+      .Replace("210e9", "210e3")
+
+  let private assembly (interfaces: string) =
+    $$"""
+    {
+      "info": { "name": "Bridge", "units": "SI", "version": "1.0" },
+      "parts": { "left": "left.json", "right": "right.json" },
+      "interfaces": {{interfaces}},
+      "constraints": {
+        "c1": {
+          "id": "c1", "type": "Fixed", "node": "left.n1",
+          "dof": ["Ux", "Uy", "Rz"]
+        }
+      }
+    }
+    """
+
+  let private read interfaces =
+    let files =
+      [ "left.json", ModelTests.json
+        "right.json", right
+        "bridge.json", assembly interfaces ]
+
+    let dir = ModelTests.scratch files
+    let path = System.IO.Path.Combine(dir, "bridge.json")
+    Parts.readWith Model.defaultReadOptions path
+
+  [<Fact>]
+  let ``Assemblies qualify, convert and join their parts`` () =
+    let joint =
+      """{ "joint": { "type": "Rigid", "nodes": ["left.n2", "right.n1"] } }"""
+
+    match read joint with
+    | Ok m ->
+      Assert.Equal(4, m.Nodes.Count)
+      Assert.Equal(3.0, m.Nodes["right.n2"].X, 9)
+      Assert.Equal(210e9, m.Materials["right.steel"].ElasticModulus, 0)
+      Assert.Equal("left.steel", m.Elements["left.e1"].Material)
+      Assert.Equal("RigidLink", m.Elements["joint"].Type)
+      Assert.Equal("left.n1", m.Constraints["c1"].Node)
+      Assert.Empty((Validation.validate m).Errors)
+    | Error e -> Assert.Fail(ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Interfaces must join nodes of the parts`` () =
+    let joint =
+      """{ "joint": { "type": "Rigid", "nodes": ["left.n2", "right.n9"] } }"""
+
+    match read joint with
+    | Error(InvalidInterface("joint", reason)) ->
+      Assert.Contains("'right.n9'", reason)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module ExamplesTests =
+
+  [<Fact>]
+  let ``Cable-stayed example is a valid, fully loaded model`` () =
+    match Examples.cableStayed Examples.defaultCableStayed with
+    | Ok m ->
+      let report = Validation.validate m
+      let cables = m.Elements |> Map.filter (fun _ e -> e.Type = "Cable")
+      Assert.True(Validation.passes true report)
+      Assert.Equal(12, cables.Count)
+      Assert.Equal<string list>([ "DL"; "LL" ], LoadCases.cases m)
+    | Error e -> Assert.Fail(ExampleError.getAsString e)
+
+  [<Fact>]
+  let ``Cable-stayed example rejects a bridge without stays`` () =
+    let options = { Examples.defaultCableStayed with CablesPerSide = 0 }
+
+    match Examples.cableStayed options with
+    | Error(InvalidOption(name, _)) -> Assert.Equal("cables", name)
+    | Ok _ -> Assert.Fail "Expected an invalid option."
+
+module SymmetryTests =
+
+  let private bridge =
+    match Examples.cableStayed Examples.defaultCableStayed with
+    | Ok m -> m
+    | Error e -> failwith (ExampleError.getAsString e)
+
+  [<Fact>]
+  let ``Halving keeps one side and restrains the plane`` () =
+    match Symmetry.apply (YZ 0.0) bridge with
+    | Ok half ->
+      let pylon = half.Elements["e13"]
+      let top = half.Constraints |> Map.tryFindKey (fun _ c -> c.Node = "n14")
+      Assert.Equal(8, half.Nodes.Count)
+      Assert.Equal(Some 0.25, pylon.Properties |> Option.map (fun p -> p["i"]))
+      Assert.True(top.IsSome)
+      Assert.Equal<string list>([ "Ux"; "Rz" ], half.Constraints[top.Value].Dof)
+      Assert.Empty((Validation.validate half).Errors)
+    | Error e -> Assert.Fail(SymmetryError.getAsString e)
+
+  [<Fact>]
+  let ``Planes parse with an optional offset`` () =
+    Assert.Equal(Ok(XZ 2.5), SymmetryPlane.tryParse "xz:2.5")
+    Assert.Equal(Ok(YZ 0.0), SymmetryPlane.tryParse "YZ")
+    Assert.Equal(Error(InvalidPlane "AB"), SymmetryPlane.tryParse "AB")
+
+  [<Fact>]
+  let ``Mirroring reflects nodes and reverses normal components`` () =
+    let n = { Id = "n1"; X = 3.0; Y = 1.0; Z = 0.0 }
+    Assert.Equal(-1.0, (Symmetry.mirror (YZ 1.0) n).X)
+    Assert.Equal(-1.0, Symmetry.sign (YZ 0.0) Ux)
+    Assert.Equal(1.0, Symmetry.sign (YZ 0.0) Rx)
+
+module ImperfectionsTests =
+
+  // 4 m column in two elements under a 3 m beam, with y up.
+  let private frame =
+    let node id x y = id, { Id = id; X = x; Y = y; Z = 0.0 }
+
+    let element id a b =
+      id,
+      { Id = id
+        Type = "Frame2D"
+        Nodes = [ a; b ]
+        Material = "steel"
+        Properties = None
+        Releases = None }
+
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      { m with
+          Nodes =
+            Map
+              [ node "n1" 0.0 0.0
+                node "n2" 0.0 2.0
+                node "n3" 0.0 4.0
+                node "n4" 3.0 4.0 ]
+          Elements =
+            Map
+              [ element "e1" "n1" "n2"
+                element "e2" "n2" "n3"
+                element "e3" "n3" "n4" ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Sway angle follows EN 1993-1-1 5.3.2`` () =
+    Assert.Equal(1.0 / 200.0, Imperfections.swayAngle 4.0 1, 12)
+    Assert.Equal(sqrt 0.75 / 300.0, Imperfections.swayAngle 16.0 2, 12)
+
+  [<Fact>]
+  let ``Sway drifts nodes in proportion to height`` () =
+    match Imperfections.apply (Sway(Ux, 1)) frame with
+    | Ok m ->
+      Assert.Equal(0.01, m.Nodes["n2"].X, 12)
+      Assert.Equal(3.02, m.Nodes["n4"].X, 12)
+      Assert.Equal(2.0, m.Nodes["n2"].Y)
+    | Error e -> Assert.Fail(ImperfectionError.getAsString e)
+
+    match Imperfections.apply (Sway(Uy, 1)) frame with
+    | Error(VerticalSway Uy) -> ()
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+  [<Fact>]
+  let ``Bow offsets interior nodes of collinear members`` () =
+    Assert.Equal<string list list>(
+      [ [ "n1"; "n2"; "n3" ]; [ "n3"; "n4" ] ],
+      Imperfections.members frame
+    )
+
+    match Imperfections.apply (Bow(Ux, BucklingCurve.C)) frame with
+    | Ok m ->
+      Assert.Equal(0.02, m.Nodes["n2"].X, 12)
+      Assert.Equal(0.0, m.Nodes["n3"].X, 12)
+      Assert.Equal(3.0, m.Nodes["n4"].X)
+    | Error e -> Assert.Fail(ImperfectionError.getAsString e)
+
+  [<Fact>]
+  let ``Imperfections parse with axis, columns and curve`` () =
+    let bow = Bow(Ux, BucklingCurve.A0)
+    Assert.Equal(Ok(Sway(Uz, 4)), Imperfection.tryParse "sway:z:4")
+    Assert.Equal(Ok bow, Imperfection.tryParse "bow:X:a0")
+    Assert.Equal("bow:X:a0", Imperfection.getAsString bow)
+    Assert.Equal(Error(InvalidImperfection "bow"), Imperfection.tryParse "bow")
+    let mode = Eigenmode(1, Amplitude.Ratio 250.0)
+    Assert.Equal(Ok mode, Imperfection.tryParse "mode1:L/250")
+    Assert.Equal("mode1:L/250", Imperfection.getAsString mode)
+    let second = Eigenmode(2, Amplitude.Length 0.01)
+    Assert.Equal(Ok second, Imperfection.tryParse "mode2:0.01")
+    Assert.Equal(Error(UnresolvedMode 1), Imperfections.apply mode frame)
+
+module PatternsTests =
+
+  // Three 2 m spans of two elements each, with a column up from n3.
+  let private beam =
+    let node id x y = id, { Id = id; X = x; Y = y; Z = 0.0 }
+
+    let element id a b =
+      id,
+      { Id = id
+        Type = "Frame2D"
+        Nodes = [ a; b ]
+        Material = "steel"
+        Properties = None
+        Releases = None }
+
+    let support id node =
+      id,
+      { Id = id
+        Type = "Pinned"
+        Node = node
+        Dof = [ "Ux"; "Uy" ]
+        Angle = None
+        Stiffness = None
+        Displacement = None }
+
+    let load id case node element =
+      id,
+      { Id = id
+        Type = "Force"
+        Node = node
+        Element = element
+        Direction = "Fy"
+        Magnitude = -1e3
+        Position = element |> Option.map (fun _ -> 0.5)
+        End = None
+        EndMagnitude = None
+        Datum = None
+        Gradient = None
+        Case = Some case }
+
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      { m with
+          Nodes =
+            Map
+              [ for i in 1..7 do
+                  node $"n{i}" (float (i - 1)) 0.0
+                node "n8" 2.0 3.0 ]
+          Elements =
+            Map
+              [ for i in 1..6 do
+                  element $"e{i}" $"n{i}" $"n{i + 1}"
+                element "c1" "n3" "n8" ]
+          Constraints =
+            Map [ support "s1" "n1"; support "s5" "n5"; support "s7" "n7" ]
+          Loads =
+            Map
+              [ load "l1" "LL" None (Some "e1")
+                load "l4" "LL" (Some "n4") None
+                load "l6" "LL" None (Some "e6")
+                load "w1" "WL" None (Some "c1") ]
+          Combinations =
+            Map
+              [ "ULS",
+                { Id = "ULS"
+                  Factors = Map [ "DL", 1.35; "LL", 1.5 ] } ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  [<Fact>]
+  let ``Beam lines divide into spans at supports and joints`` () =
+    let expected =
+      [ [ [ "c1" ] ]
+        [ [ "e1"; "e2" ]; [ "e3"; "e4" ]; [ "e5"; "e6" ] ] ]
+
+    Assert.Equal<string list list list>(expected, Patterns.spans beam)
+
+  [<Fact>]
+  let ``Patterns load alternate and adjacent spans`` () =
+    match Patterns.generate "LL" beam with
+    | Ok m ->
+      let loadsOf case =
+        m.Loads
+        |> Map.toList
+        |> List.filter (fun (_, l) -> l.Case = Some case)
+        |> List.map fst
+
+      Assert.Equal<string list>([ "l1-odd"; "l6-odd" ], loadsOf "LL-odd")
+      Assert.Equal<string list>([ "l4-even" ], loadsOf "LL-even")
+      Assert.Equal<string list>(
+        [ "l1-spans1-2"; "l4-spans1-2" ],
+        loadsOf "LL-spans1-2"
+      )
+
+      Assert.Equal<string list>(
+        [ "l4-spans2-3"; "l6-spans2-3" ],
+        loadsOf "LL-spans2-3"
+      )
+
+      let factors = m.Combinations["ULS-even"].Factors
+      let expected = Map [ "DL", 1.35; "LL-even", 1.5 ]
+      Assert.Equal<Map<string, float>>(expected, factors)
+      Assert.Equal(5, m.Combinations.Count)
+    | Error e -> Assert.Fail(PatternError.getAsString e)
+
+  [<Fact>]
+  let ``Patterns need spans to load and unused names`` () =
+    let generate case m = Patterns.generate case m |> Result.map ignore
+    Assert.Equal(Error(MissingCase "SL"), generate "SL" beam)
+    Assert.Equal(Error(NoSpans "WL"), generate "WL" beam)
+
+    let twice = Patterns.generate "LL" beam |> Result.bind (generate "LL")
+    Assert.Equal(Error(NameTaken "l1-odd"), twice)
+
+module VehiclesTests =
+
+  // Two 5 m spans in kN-m, e1 drawn against the direction of travel.
+  let private beam =
+    let node id x = id, { Id = id; X = x; Y = 0.0; Z = 0.0 }
+
+    let element id a b =
+      id,
+      { Id = id
+        Type = "Frame2D"
+        Nodes = [ a; b ]
+        Material = "steel"
+        Properties = None
+        Releases = None }
+
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      { m with
+          Info = { m.Info with Units = "kN-m" }
+          Nodes = Map [ node "n1" 0.0; node "n2" 5.0; node "n3" 10.0 ]
+          Elements = Map [ element "e1" "n2" "n1"; element "e2" "n2" "n3" ] }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  let private resolve libraries text =
+    let units =
+      match UnitSystem.tryFind "kN-m" with
+      | Ok u -> u
+      | Error e -> failwith (ConversionError.getAsString e)
+
+    Vehicles.tryParse text
+    |> Result.bind (fun (id, overrides) ->
+      Vehicles.library libraries
+      |> Result.bind (fun l -> Vehicles.resolve l id overrides units))
+
+  [<Fact>]
+  let ``Vehicles cross the path in steps with their axle loads`` () =
+    let crossed =
+      resolve [] "hs20:spacing=4"
+      |> Result.bind (fun v -> Vehicles.cross v [ "e1"; "e2" ] 2.0 "HS" beam)
+
+    match crossed with
+    | Ok m ->
+      // 18.27 m of travel in 2 m steps.
+      let cases = LoadCases.cases m
+      Assert.Equal(10, cases.Length)
+
+      // At 6 m the front axle is 1 m into e2 and the rear 4.27 m further
+      // back, 3.27 m along the path on e1, drawn from its far end.
+      let front = m.Loads["HS-4-a1"]
+      Assert.Equal(Some "e2", front.Element)
+      Assert.Equal(Some 0.2, front.Position)
+      Assert.Equal(-35.6, front.Magnitude, 9)
+
+      let middle = m.Loads["HS-4-a2"]
+      Assert.Equal(Some "e1", middle.Element)
+      Assert.Equal(1.0 - 1.73 / 5.0, middle.Position.Value, 9)
+      Assert.False(m.Loads.ContainsKey "HS-4-a3")
+    | Error e -> Assert.Fail(VehicleError.getAsString e)
+
+  [<Fact>]
+  let ``User libraries add vehicles in their own units`` () =
+    let library =
+      """
+      {
+        "units": "N-mm",
+        "vehicles": {
+          "forklift": {
+            "name": "Forklift",
+            "parameters": { "rear": 20e3 },
+            "axles": [ { "load": 60e3 }, { "spacing": 1500, "load": "${rear}" } ]
+          }
+        }
+      }
+      """
+
+    let path = System.IO.Path.GetTempFileName()
+    System.IO.File.WriteAllText(path, library)
+
+    match resolve [ path ] "forklift:rear=30e3" with
+    | Ok v ->
+      Assert.Equal<float list>([ 0.0; 1.5 ], Vehicles.offsets v)
+      Assert.Equal(30.0, v.Axles[1].Load, 9)
+    | Error e -> Assert.Fail(VehicleError.getAsString e)
+
+    match resolve [ path ] "truck" with
+    | Error(UnknownVehicle("truck", available)) ->
+      Assert.Contains("forklift", available)
+      Assert.Contains("hs20", available)
+    | other -> Assert.Fail($"Unexpected result: {other}")
+
+module TributaryTests =
+
+  // A 6 m × 4 m floor panel in the XZ plane, with a beam splitting its
+  // first edge at n5 and one running against its last edge.
+  let private floor panelType =
+    let node id x z = id, { Id = id; X = x; Y = 0.0; Z = z }
+
+    let element id a b =
+      id,
+      { Id = id
+        Type = "Beam3D"
+        Nodes = [ a; b ]
+        Material = "steel"
+        Properties = None
+        Releases = None }
+
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      { m with
+          Nodes =
+            Map
+              [ node "n1" 0.0 0.0
+                node "n2" 6.0 0.0
+                node "n3" 6.0 4.0
+                node "n4" 0.0 4.0
+                node "n5" 3.0 0.0 ]
+          Elements =
+            Map
+              [ element "e1" "n1" "n5"
+                element "e2" "n5" "n2"
+                element "e3" "n2" "n3"
+                element "e4" "n3" "n4"
+                element "e5" "n1" "n4" ]
+          Loads = Map.empty
+          Panels =
+            Some(
+              Map
+                [ "p1",
+                  { Id = "p1"
+                    Type = panelType
+                    Nodes = [ "n1"; "n2"; "n3"; "n4" ]
+                    Loads = Map [ "LL", 5.0 ] } ]
+            ) }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  /// Total force of the line loads on each element.
+  let private totals (m: Model) =
+    m.Loads
+    |> Map.toList
+    |> List.map (fun (_, l) ->
+      let e = m.Elements[l.Element.Value]
+      let a, b = m.Nodes[e.Nodes[0]], m.Nodes[e.Nodes[1]]
+      let length = sqrt ((b.X - a.X) ** 2.0 + (b.Z - a.Z) ** 2.0)
+      let q1 = defaultArg l.EndMagnitude l.Magnitude
+      let extent = defaultArg l.End 1.0 - defaultArg l.Position 0.0
+      e.Id, extent * length * (l.Magnitude + q1) / 2.0)
+    |> List.groupBy fst
+    |> List.map (fun (id, xs) -> id, List.sumBy snd xs)
+    |> Map.ofList
+
+  [<Fact>]
+  let ``Two-way panels load long edges by trapezoids and short by triangles``
+    ()
+    =
+    match Tributary.distribute (floor "TwoWay") with
+    | Ok m ->
+      let forces = totals m
+      Assert.True(m.Panels.IsNone)
+      Assert.Equal(-120.0, forces |> Map.values |> Seq.sum, 9)
+      Assert.Equal(-20.0, forces["e3"], 9)
+      Assert.Equal(-20.0, forces["e5"], 9)
+      Assert.Equal(-40.0, forces["e1"] + forces["e2"], 9)
+
+      // The triangle peaks at half the short side times the pressure.
+      let peak =
+        m.Loads
+        |> Map.filter (fun _ l -> l.Element = Some "e5")
+        |> Map.toList
+        |> List.map (fun (_, l) -> l.Position.Value, l.Magnitude)
+        |> List.max
+
+      Assert.Equal((0.5, -10.0), peak)
+
+      for KeyValue(_, l) in m.Loads do
+        Assert.Equal("Distributed", l.Type)
+        Assert.Equal("Fy", l.Direction)
+        Assert.Equal(Some "LL", l.Case)
+        Assert.True(l.Position < l.End)
+    | Error e -> Assert.Fail(TributaryError.getAsString e)
+
+  [<Fact>]
+  let ``One-way panels span onto their long edges uniformly`` () =
+    match Tributary.distribute (floor "OneWay") with
+    | Ok m ->
+      let forces = totals m
+      let loaded = forces |> Map.keys |> List.ofSeq
+      Assert.Equal<string list>([ "e1"; "e2"; "e4" ], loaded)
+      Assert.Equal(-60.0, forces["e4"], 9)
+
+      for KeyValue(_, l) in m.Loads do
+        Assert.Equal(-10.0, l.Magnitude, 9)
+        Assert.Equal(Some -10.0, l.EndMagnitude)
+    | Error e -> Assert.Fail(TributaryError.getAsString e)
+
+  [<Fact>]
+  let ``Panel edges need beams along their full length`` () =
+    let m = floor "TwoWay"
+    let gap = { m with Elements = m.Elements |> Map.remove "e3" }
+    let expected = Error(UnsupportedEdge("p1", "n2", "n3"))
+    Assert.Equal(expected, Tributary.distribute gap |> Result.map ignore)
+
+    let report = Validation.validate m
+    Assert.Contains(UndistributedPanel "p1", report.Warnings)
+
+module TemperaturesTests =
+
+  // Two bars in a line, n1-n2-n3, and a spring at n3.
+  let private bars =
+    let node id x = id, { Id = id; X = x; Y = 0.0; Z = 0.0 }
+
+    let element id kind nodes =
+      id,
+      { Id = id
+        Type = kind
+        Nodes = nodes
+        Material = "steel"
+        Properties = None
+        Releases = None }
+
+    match Model.parse Json ModelTests.json with
+    | Ok m ->
+      { m with
+          Nodes = Map [ node "n1" 0.0; node "n2" 2.0; node "n3" 4.0 ]
+          Elements =
+            Map
+              [ element "e1" "Frame2D" [ "n1"; "n2" ]
+                element "e2" "Frame2D" [ "n2"; "n3" ]
+                element "s1" "Spring" [ "n3" ] ]
+          Loads = Map.empty }
+    | Error e -> failwith (ModelError.getAsString e)
+
+  let private field text =
+    match Temperatures.parse text with
+    | Ok readings -> readings
+    | Error e -> failwith (TemperatureError.getAsString e)
+
+  [<Fact>]
+  let ``Members take the mean of their end nodes`` () =
+    let readings = field "id,temperature\n# sensors\nn1,20\nn2;40\nn3 80\n"
+
+    match Temperatures.apply readings 20.0 "T1" bars with
+    | Ok m ->
+      let loaded = m.Loads |> Map.keys |> List.ofSeq
+      Assert.Equal<string list>([ "T1-e1"; "T1-e2" ], loaded)
+      Assert.Equal(10.0, m.Loads["T1-e1"].Magnitude, 9)
+      Assert.Equal(40.0, m.Loads["T1-e2"].Magnitude, 9)
+      Assert.Equal(Some "T1", m.Loads["T1-e2"].Case)
+      Assert.Equal("Thermal", m.Loads["T1-e2"].Type)
+    | Error e -> Assert.Fail(TemperatureError.getAsString e)
+
+  [<Fact>]
+  let ``Member readings override their nodes with a gradient`` () =
+    let readings = field "n1,20\nn2,20\ne1,20,100\ne2,50\n"
+
+    match Temperatures.apply readings 20.0 "T1" bars with
+    | Ok m ->
+      Assert.Equal(0.0, m.Loads["T1-e1"].Magnitude, 9)
+      Assert.Equal(Some 100.0, m.Loads["T1-e1"].Gradient)
+      Assert.Equal(30.0, m.Loads["T1-e2"].Magnitude, 9)
+      Assert.Equal(None, m.Loads["T1-e2"].Gradient)
+    | Error e -> Assert.Fail(TemperatureError.getAsString e)
+
+  [<Fact>]
+  let ``Fields name known nodes and members`` () =
+    let apply text =
+      Temperatures.apply (field text) 0.0 "T1" bars |> Result.map ignore
+
+    Assert.Equal(Error(UnknownTarget "n9"), apply "n9,20")
+    Assert.Equal(Error(GradientAtNode "n1"), apply "n1,20,5")
+    Assert.Equal(Error NothingHeated, apply "n1,0\nn2,0")
+
+    match Temperatures.apply (field "e2,10") 0.0 "T1" bars with
+    | Ok heated ->
+      let again = Temperatures.apply (field "e1,10") 0.0 "T1" heated
+      let expected = TemperatureError.CaseTaken "T1"
+      Assert.Equal(Error expected, again |> Result.map ignore)
+    | Error e -> Assert.Fail(TemperatureError.getAsString e)
+
+    let expected = MalformedTemperatures(3, "has temperature 'hot'")
+    let malformed = Temperatures.parse "id,t\nn1,20\nn2,hot\n"
+    Assert.Equal(Error expected, malformed |> Result.map ignore)
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+using System;
+using System.Collections.Generic;
+using System.Linq;
+using System.Runtime.InteropServices.JavaScript;
+using System.Text.Json;
+using System.Text.Json.Nodes;
+using Gazelle.Analysis;
+using Gazelle.Model;
+using Microsoft.FSharp.Collections;
+
+namespace Gazelle.Wasm;
+
+/// <summary>
+/// JavaScript API for analysing models in the browser, wrapped by
+/// <c>gazelle.js</c>.
+/// </summary>
+/// <remarks>
+/// Models are parsed from JSON text and held by integer handle, so nothing
+/// touches the file system. Errors are thrown, surfacing as JavaScript
+/// exceptions with the library's error message.
+/// </remarks>
+public static partial class Api
+{
+  private static readonly Dictionary<int, Model.Model> Models = new();
+  private static readonly Dictionary<int, string> Results = new();
+  private static int next;
+
+  private static readonly JsonSerializerOptions JsonOptions =
+    new() { PropertyNamingPolicy = JsonNamingPolicy.CamelCase };
+
+  private static Model.Model Find(int handle) =>
+    Models.TryGetValue(handle, out var model)
+      ? model
+      : throw new ArgumentException($"No model has handle {handle}.");
+
+  /// <summary>Parses a model from JSON text, returning its handle.</summary>
+  [JSExport]
+  public static int LoadModel(string json)
+  {
+    var result = ModelModule.parse(ModelFormat.Json, json);
+
+    if (result.IsError)
+      throw new ArgumentException(
+        ModelErrorModule.getAsString(result.ErrorValue)
+      );
+
+    Models[++next] = result.ResultValue;
+    return next;
+  }
+
+  /// <summary>Releases a model and its results.</summary>
+  [JSExport]
+  public static void FreeModel(int handle)
+  {
+    Models.Remove(handle);
+    Results.Remove(handle);
+  }
+
+  /// <summary>Validates a model, returning JSON errors and warnings.</summary>
+  [JSExport]
+  public static string Validate(int handle)
+  {
+    var report = Validation.validate(Find(handle));
+
+    return JsonSerializer.Serialize(
+      new
+      {
+        Errors = report.Errors.Select(ValidationErrorModule.getAsString),
+        Warnings = report.Warnings.Select(ValidationWarningModule.getAsString)
+      },
+      JsonOptions
+    );
+  }
+
+  // Nodal values by node and DOF name, as results files hold them.
+  private static JsonObject Named(
+    FSharpMap<string, FSharpMap<Dof, double>> values
+  )
+  {
+    var nodes = new JsonObject();
+
+    foreach (var node in values)
+    {
+      var dofs = new JsonObject();
+
+      foreach (var dof in node.Value)
+        dofs[DofModule.getAsString(dof.Key)] = dof.Value;
+
+      nodes[node.Key] = dofs;
+    }
+
+    return nodes;
+  }
+
+  // Forces of each element, in the order StaticResult holds them.
+  private static JsonObject Forces(FSharpMap<string, double[]> values)
+  {
+    var elements = new JsonObject();
+
+    foreach (var element in values)
+      elements[element.Key] = new JsonArray(
+        element.Value.Select(x => (JsonNode?)x).ToArray()
+      );
+
+    return elements;
+  }
+
+  // Static response to one load set, built as a JSON tree rather than by
+  // reflection, which trimming of the published app may break.
+  private static JsonObject Response(LoadSet set, StaticResult r) =>
+    new()
+    {
+      ["name"] = set.Name,
+      ["kind"] = set.Kind.IsLoadCase ? "Case" : "Combination",
+      ["displacements"] = Named(r.Displacements),
+      ["reactions"] = Named(r.Reactions),
+      ["memberForces"] = Forces(r.MemberForces),
+      ["plateForces"] = Forces(r.PlateForces),
+      ["springForces"] = Named(r.SpringForces)
+    };
+
+  /// <summary>
+  /// Analyses every load case and combination of a model by linear static
+  /// analysis, returning JSON displacements, reactions and member forces
+  /// per load set, which are kept for <c>GetResults</c>.
+  /// </summary>
+  [JSExport]
+  public static string Analyze(int handle)
+  {
+    var model = Find(handle);
+    var sets = LoadCases.select(model, null, null);
+
+    if (sets.IsError)
+      throw new InvalidOperationException(
+        SelectionErrorModule.getAsString(sets.ErrorValue)
+      );
+
+    var results = new JsonArray();
+
+    foreach (var set in sets.ResultValue)
+    {
+      var analysed = Static.analyse(model, set);
+
+      if (analysed.IsError)
+        throw new InvalidOperationException(
+          $"{set.Name}: {StaticErrorModule.getAsString(analysed.ErrorValue)}"
+        );
+
+      results.Add(Response(set, analysed.ResultValue));
+    }
+
+    Results[handle] = results.ToJsonString();
+    return Results[handle];
+  }
+
+  /// <summary>
+  /// Returns the JSON results of the last analysis of a model.
+  /// </summary>
+  [JSExport]
+  public static string GetResults(int handle) =>
+    Results.TryGetValue(handle, out var results)
+      ? results
+      : throw new InvalidOperationException(
+        $"Model {handle} has not been analysed."
+      );
+}
+
+/// <summary>
+/// Entry point run when the runtime starts; the API is called from
+/// JavaScript thereafter.
+/// </summary>
+public static class Program
+{
+  public static void Main() { }
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Gazelle: a fast, cross-platform engine for structural analysis & design.
+// Copyright (C) 2024 James S. Bayley
+
+import { dotnet } from "./_framework/dotnet.js";
+
+/**
+ * Starts the Gazelle runtime and returns its JavaScript API.
+ *
+ * Models are passed as JSON text or plain objects and results are returned
+ * as plain objects. Failures throw an Error carrying Gazelle's message.
+ *
+ * @example
+ * const gazelle = await createGazelle();
+ * const model = gazelle.loadModel(await (await fetch("beam.json")).json());
+ * console.log(gazelle.analyze(model));
+ */
+export async function createGazelle() {
+  const { getAssemblyExports, getConfig } = await dotnet.create();
+  const exports = await getAssemblyExports(getConfig().mainAssemblyName);
+  const api = exports.Gazelle.Wasm.Api;
+  const text = (model) =>
+    typeof model === "string" ? model : JSON.stringify(model);
+
+  return {
+    /** Parses a model, returning a handle for the other calls. */
+    loadModel: (model) => api.LoadModel(text(model)),
+    /** Releases a model and its results. */
+    freeModel: (handle) => api.FreeModel(handle),
+    /** Returns the errors and warnings of a model. */
+    validate: (handle) => JSON.parse(api.Validate(handle)),
+    /** Analyses every load case and combination of a model. */
+    analyze: (handle) => JSON.parse(api.Analyze(handle)),
+    /** Returns the results of the last analysis of a model. */
+    getResults: (handle) => JSON.parse(api.GetResults(handle)),
+  };
+}